@@ -2,17 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/Dheeraj2209/Last_mile_go/internal/config"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
 	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
 	"github.com/Dheeraj2209/Last_mile_go/internal/server"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"github.com/Dheeraj2209/Last_mile_go/services/driver"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
 )
 
@@ -46,6 +53,7 @@ func main() {
 		logger.Fatal().Err(err).Msg("invalid configuration")
 	}
 	logger.Info().Str("config", config.FormatConfig(cfg)).Msg("service config")
+	pagetoken.SetSecret(cfg.PageTokenSecret)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -62,10 +70,113 @@ func main() {
 		}
 	}()
 
-	ready, err := server.ReadyChecksFromConfig(ctx, cfg, observability.Logf())
-	if err != nil {
-		logger.Fatal().Err(err).Msg("readiness init failed")
+	var driverStore storage.DriverStore
+	var vehicleStore storage.VehicleStore
+	var mongoClient *mongo.Client
+	var redisClient *redis.Client
+	userBackend := strings.ToLower(strings.TrimSpace(cfg.UserStoreBackend))
+	switch userBackend {
+	case "", "memory":
+		driverStore = storage.NewMemoryUserStore()
+		vehicleStore = storage.NewMemoryVehicleStore()
+	case "mongo":
+		client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init mongo client")
+		}
+		mongoClient = client
+		drivers := storage.NewMongoUserStore(client, cfg.MongoDatabase, cfg.MongoRiderCollection, cfg.MongoDriverCollection, cfg.MongoPhoneCollection)
+		vehicles := storage.NewMongoVehicleStore(client, cfg.MongoDatabase, cfg.MongoVehicleCollection)
+		if drivers == nil || vehicles == nil {
+			logger.Fatal().Msg("mongo driver store init failed")
+		}
+		driverStore = drivers
+		vehicleStore = vehicles
+	case "redis":
+		client, err := storage.NewRedisClient(ctx, cfg.Redis)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init redis client")
+		}
+		redisClient = client
+		drivers := storage.NewRedisUserStore(client, cfg.Redis.KeyPrefix)
+		vehicles := storage.NewRedisVehicleStore(client, cfg.Redis.KeyPrefix)
+		if drivers == nil || vehicles == nil {
+			logger.Fatal().Msg("redis driver store init failed")
+		}
+		driverStore = drivers
+		vehicleStore = vehicles
+	default:
+		logger.Fatal().Str("backend", userBackend).Msg("unsupported user store backend")
+	}
+
+	var shiftStore storage.ShiftStore
+	shiftBackend := strings.ToLower(strings.TrimSpace(cfg.ShiftStoreBackend))
+	switch shiftBackend {
+	case "", "memory":
+		shiftStore = storage.NewMemoryShiftStore()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		shifts := storage.NewRedisShiftStore(redisClient, cfg.Redis.KeyPrefix)
+		if shifts == nil {
+			logger.Fatal().Msg("redis shift store init failed")
+		}
+		shiftStore = shifts
+	default:
+		logger.Fatal().Str("backend", shiftBackend).Msg("unsupported shift store backend")
+	}
+
+	var seatStore storage.SeatStore
+	seatBackend := strings.ToLower(strings.TrimSpace(cfg.SeatStoreBackend))
+	switch seatBackend {
+	case "", "memory":
+		seatStore = storage.NewMemorySeatStore()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		seats := storage.NewRedisSeatStore(redisClient, cfg.Redis.KeyPrefix)
+		if seats == nil {
+			logger.Fatal().Msg("redis seat store init failed")
+		}
+		seatStore = seats
+	default:
+		logger.Fatal().Str("backend", seatBackend).Msg("unsupported seat store backend")
 	}
+
+	var bus events.Bus
+	busBackend := strings.ToLower(strings.TrimSpace(cfg.EventBusBackend))
+	switch busBackend {
+	case "", "memory":
+		bus = events.NewMemoryBus()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		redisBus := events.NewRedisBus(redisClient, cfg.Redis.KeyPrefix, cfg.EventStreamMaxLen)
+		if redisBus == nil {
+			logger.Fatal().Msg("redis event bus init failed")
+		}
+		bus = redisBus
+	default:
+		logger.Fatal().Str("backend", busBackend).Msg("unsupported event bus backend")
+	}
+	defer bus.Close()
+
+	ready := server.ReadyChecksFromClients(mongoClient, redisClient, observability.Logf())
 	defer func() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -79,9 +190,34 @@ func main() {
 		}
 	}()
 
+	srv := driver.NewServerWithStores(driver.Stores{
+		Drivers:           driverStore,
+		Vehicles:          vehicleStore,
+		Seats:             seatStore,
+		Shifts:            shiftStore,
+		InactivityTimeout: cfg.InactivityTimeout,
+	})
+
+	go func() {
+		err := bus.Subscribe(ctx, events.StreamLocations, events.ConsumerConfig{
+			Group:        cfg.ServiceName,
+			Consumer:     cfg.EventConsumerName,
+			ClaimMinIdle: cfg.EventClaimMinIdle,
+		}, srv.HandleEvent)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Msg("event consumer stopped")
+		}
+	}()
+
+	go func() {
+		if err := srv.RunInactivityChecks(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Msg("inactivity checks stopped")
+		}
+	}()
+
 	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
 		func(grpcServer *grpc.Server) {
-			lastmilev1.RegisterDriverServiceServer(grpcServer, driver.NewServer())
+			lastmilev1.RegisterDriverServiceServer(grpcServer, srv)
 		},
 		lastmilev1.RegisterDriverServiceHandlerFromEndpoint,
 		ready.Checks...,
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Dheeraj2209/Last_mile_go/internal/config"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/server"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	cfg := config.Load("exporter")
+
+	var grpcListenAddr string
+	var grpcEndpoint string
+	var httpAddr string
+	var otelEndpoint string
+	var otelInsecure bool
+	var logLevel string
+
+	flag.StringVar(&grpcListenAddr, "grpc-listen", cfg.GRPCListenAddr, "gRPC listen address")
+	flag.StringVar(&grpcEndpoint, "grpc-endpoint", cfg.GRPCEndpoint, "gRPC endpoint for gateway dialing")
+	flag.StringVar(&httpAddr, "http-addr", cfg.HTTPAddr, "HTTP listen address")
+	flag.StringVar(&otelEndpoint, "otel-endpoint", cfg.OTelEndpoint, "OTel OTLP gRPC endpoint (host:port)")
+	flag.BoolVar(&otelInsecure, "otel-insecure", cfg.OTelInsecure, "Disable TLS for OTLP exporter")
+	flag.StringVar(&logLevel, "log-level", cfg.LogLevel, "Log level (debug, info, warn, error)")
+	flag.Parse()
+
+	cfg.GRPCListenAddr = grpcListenAddr
+	cfg.GRPCEndpoint = grpcEndpoint
+	cfg.HTTPAddr = httpAddr
+	cfg.OTelEndpoint = otelEndpoint
+	cfg.OTelInsecure = otelInsecure
+	cfg.LogLevel = logLevel
+
+	logger := observability.ConfigureLogger(cfg.ServiceName, cfg.LogLevel)
+	if err := config.Validate(cfg); err != nil {
+		logger.Fatal().Err(err).Msg("invalid configuration")
+	}
+	logger.Info().Str("config", config.FormatConfig(cfg)).Msg("service config")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownOTel, err := observability.Setup(ctx, cfg.ServiceName, cfg.OTelEndpoint, cfg.OTelInsecure)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to init telemetry")
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownOTel(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("telemetry shutdown error")
+		}
+	}()
+
+	var redisClient *redis.Client
+	var bus events.Bus
+	busBackend := strings.ToLower(strings.TrimSpace(cfg.EventBusBackend))
+	switch busBackend {
+	case "", "memory":
+		bus = events.NewMemoryBus()
+	case "redis":
+		client, err := storage.NewRedisClient(ctx, cfg.Redis)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init redis client")
+		}
+		redisClient = client
+		redisBus := events.NewRedisBus(client, cfg.Redis.KeyPrefix, cfg.EventStreamMaxLen)
+		if redisBus == nil {
+			logger.Fatal().Msg("redis event bus init failed")
+		}
+		bus = redisBus
+	default:
+		logger.Fatal().Str("backend", busBackend).Msg("unsupported event bus backend")
+	}
+	defer bus.Close()
+
+	ready := server.ReadyChecksFromClients(nil, redisClient, observability.Logf())
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, closer := range ready.Closers {
+			if closer == nil {
+				continue
+			}
+			if err := closer(shutdownCtx); err != nil {
+				logger.Error().Err(err).Msg("readiness close error")
+			}
+		}
+	}()
+
+	var sink events.CloudEventSink
+	sinkKind := strings.ToLower(strings.TrimSpace(cfg.CloudEventsSink))
+	switch sinkKind {
+	case "http":
+		httpSink, err := events.NewHTTPSink(cfg.CloudEventsHTTPURL, strings.ToLower(cfg.CloudEventsHTTPMode), cfg.CloudEventsHTTPTimeout)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("cloud events http sink init failed")
+		}
+		sink = httpSink
+	case "", "file":
+		// Replicas can share a directory: each writes and recovers only the
+		// segments named after its own consumer.
+		fileSink, err := events.NewFileSink(cfg.CloudEventsFileDir, "events-"+cfg.EventConsumerName, cfg.CloudEventsFileMaxBytes, cfg.CloudEventsFileMaxAge)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("cloud events file sink init failed")
+		}
+		sink = fileSink
+	default:
+		logger.Fatal().Str("sink", sinkKind).Msg("unsupported cloud events sink")
+	}
+	defer func() {
+		if err := sink.Close(); err != nil {
+			logger.Error().Err(err).Msg("cloud events sink close error")
+		}
+	}()
+
+	exporter := events.NewCloudEventExporter(cfg.CloudEventsSource, sink)
+	var consumers sync.WaitGroup
+	defer func() {
+		stop()
+		consumers.Wait()
+	}()
+	for _, stream := range []string{events.StreamRideRequests, events.StreamTrips, events.StreamMatching} {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			err := bus.Subscribe(ctx, stream, events.ConsumerConfig{
+				Group:        cfg.ServiceName,
+				Consumer:     cfg.EventConsumerName,
+				ClaimMinIdle: cfg.EventClaimMinIdle,
+			}, exporter.Handler(stream))
+			if err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error().Err(err).Str("stream", stream).Msg("event consumer stopped")
+			}
+		}()
+	}
+
+	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
+		func(*grpc.Server) {},
+		func(context.Context, *runtime.ServeMux, string, []grpc.DialOption) error { return nil },
+		ready.Checks...,
+	)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("service stopped")
+	}
+}
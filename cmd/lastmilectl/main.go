@@ -0,0 +1,246 @@
+// Command lastmilectl is an operator CLI for the lastmile services.
+//
+//	lastmilectl [-addr host:port] stations import [-format csv|geojson] [-dry-run] FILE
+//	lastmilectl [-addr host:port] stations export [-format csv|geojson] [-o FILE]
+//	lastmilectl [-addr host:port] stations import-gtfs [-timezone TZ] FEED.zip
+//
+// FILE may be "-" for stdin. The import format defaults to the file extension.
+// GTFS feeds are read locally and only parent stations and their arrivals are
+// sent.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/gtfs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const importChunkSize = 64 << 10
+
+var errRowsRejected = errors.New("some rows were rejected")
+
+func main() {
+	addr := flag.String("addr", envOr("LASTMILE_STATION_ADDR", "localhost:9090"), "station service gRPC address")
+	timeout := flag.Duration("timeout", 5*time.Minute, "request timeout")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 || args[0] != "stations" {
+		usage()
+		os.Exit(2)
+	}
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fatal(err)
+	}
+	defer conn.Close()
+	client := lastmilev1.NewStationServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch args[1] {
+	case "import":
+		err = importStations(ctx, client, args[2:])
+	case "export":
+		err = exportStations(ctx, client, args[2:])
+	case "import-gtfs":
+		err = importGtfs(ctx, client, args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func importStations(ctx context.Context, client lastmilev1.StationServiceClient, args []string) error {
+	fs := flag.NewFlagSet("stations import", flag.ExitOnError)
+	formatName := fs.String("format", "", "csv or geojson (default: from the file extension)")
+	dryRun := fs.Bool("dry-run", false, "validate without writing")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("stations import needs exactly one FILE")
+	}
+	path := fs.Arg(0)
+	if *formatName == "" {
+		*formatName = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	format, err := parseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	stream, err := client.ImportStations(ctx)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, importChunkSize)
+	first := true
+	for {
+		n, readErr := in.Read(buf)
+		if n > 0 || first {
+			req := &lastmilev1.ImportStationsRequest{Chunk: append([]byte(nil), buf[:n]...)}
+			if first {
+				req.Format = format
+				req.DryRun = *dryRun
+				first = false
+			}
+			if err := stream.Send(req); err != nil {
+				return err
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+
+	for _, rowErr := range resp.Errors {
+		if rowErr.StationId != "" {
+			fmt.Fprintf(os.Stderr, "row %d (%s): %s\n", rowErr.Row, rowErr.StationId, rowErr.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "row %d: %s\n", rowErr.Row, rowErr.Message)
+		}
+	}
+	verb := "imported"
+	if resp.DryRun {
+		verb = "would import"
+	}
+	fmt.Printf("%s %d of %d rows (%d errors)\n", verb, resp.Imported, resp.TotalRows, len(resp.Errors))
+	if len(resp.Errors) > 0 {
+		return errRowsRejected
+	}
+	return nil
+}
+
+func exportStations(ctx context.Context, client lastmilev1.StationServiceClient, args []string) error {
+	fs := flag.NewFlagSet("stations export", flag.ExitOnError)
+	formatName := fs.String("format", "csv", "csv or geojson")
+	outPath := fs.String("o", "-", "output file")
+	_ = fs.Parse(args)
+	format, err := parseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if *outPath != "-" {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	stream, err := client.ExportStations(ctx, &lastmilev1.ExportStationsRequest{Format: format})
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(resp.Chunk); err != nil {
+			return err
+		}
+	}
+}
+
+func importGtfs(ctx context.Context, client lastmilev1.StationServiceClient, args []string) error {
+	fs := flag.NewFlagSet("stations import-gtfs", flag.ExitOnError)
+	timezone := fs.String("timezone", "", "timezone for stations when the feed has no agency_timezone")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("stations import-gtfs needs exactly one FEED.zip")
+	}
+	feed, err := gtfs.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	stream, err := client.ImportGtfsStations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, station := range feed.Stations {
+		if station.Timezone == "" {
+			station.Timezone = *timezone
+		}
+		if err := stream.Send(station); err != nil {
+			return err
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %d and updated %d stations with %d arrivals\n", resp.Created, resp.Updated, resp.Arrivals)
+	return nil
+}
+
+func parseFormat(name string) (lastmilev1.StationFileFormat, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return lastmilev1.StationFileFormat_STATION_FILE_FORMAT_CSV, nil
+	case "geojson", "json":
+		return lastmilev1.StationFileFormat_STATION_FILE_FORMAT_GEOJSON, nil
+	default:
+		return lastmilev1.StationFileFormat_STATION_FILE_FORMAT_UNSPECIFIED, fmt.Errorf("unknown format %q (want csv or geojson)", name)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  lastmilectl [-addr host:port] stations import [-format csv|geojson] [-dry-run] FILE
+  lastmilectl [-addr host:port] stations export [-format csv|geojson] [-o FILE]
+  lastmilectl [-addr host:port] stations import-gtfs [-timezone TZ] FEED.zip`)
+	flag.PrintDefaults()
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "lastmilectl:", err)
+	os.Exit(1)
+}
@@ -5,14 +5,23 @@ import (
 	"flag"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/Dheeraj2209/Last_mile_go/internal/config"
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
 	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/routing"
 	"github.com/Dheeraj2209/Last_mile_go/internal/server"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	etasvc "github.com/Dheeraj2209/Last_mile_go/services/eta"
 	"github.com/Dheeraj2209/Last_mile_go/services/location"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
 )
 
@@ -62,10 +71,146 @@ func main() {
 		}
 	}()
 
-	ready, err := server.ReadyChecksFromConfig(ctx, cfg, observability.Logf())
+	profile, err := cfg.EtaProfile()
 	if err != nil {
-		logger.Fatal().Err(err).Msg("readiness init failed")
+		logger.Fatal().Err(err).Msg("invalid eta profile")
 	}
+
+	var mongoClient *mongo.Client
+	var redisClient *redis.Client
+	var bus events.Bus
+	busBackend := strings.ToLower(strings.TrimSpace(cfg.EventBusBackend))
+	switch busBackend {
+	case "", "memory":
+		bus = events.NewMemoryBus()
+	case "redis":
+		client, err := storage.NewRedisClient(ctx, cfg.Redis)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init redis client")
+		}
+		redisClient = client
+		redisBus := events.NewRedisBus(client, cfg.Redis.KeyPrefix, cfg.EventStreamMaxLen)
+		if redisBus == nil {
+			logger.Fatal().Msg("redis event bus init failed")
+		}
+		bus = redisBus
+	default:
+		logger.Fatal().Str("backend", busBackend).Msg("unsupported event bus backend")
+	}
+	defer bus.Close()
+
+	var shiftStore storage.ShiftStore
+	shiftBackend := strings.ToLower(strings.TrimSpace(cfg.ShiftStoreBackend))
+	switch shiftBackend {
+	case "", "memory":
+		shiftStore = storage.NewMemoryShiftStore()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		shifts := storage.NewRedisShiftStore(redisClient, cfg.Redis.KeyPrefix)
+		if shifts == nil {
+			logger.Fatal().Msg("redis shift store init failed")
+		}
+		shiftStore = shifts
+	default:
+		logger.Fatal().Str("backend", shiftBackend).Msg("unsupported shift store backend")
+	}
+
+	// EtaService reads stations and destinations, and drivers and their
+	// vehicles for the speed profile.
+	etaStores := etasvc.Stores{Estimator: eta.Haversine{Profile: profile}}
+	if cfg.RoutingOSMPBF != "" {
+		graph, err := routing.Load(cfg.RoutingOSMPBF)
+		if err != nil {
+			logger.Fatal().Err(err).Str("path", cfg.RoutingOSMPBF).Msg("failed to load road network")
+		}
+		logger.Info().Int("vertices", graph.Vertices()).Msg("road network loaded")
+		etaStores.Estimator = routing.Estimator{Graph: graph, Profile: profile}
+	}
+	stationBackend := strings.ToLower(strings.TrimSpace(cfg.StationStoreBackend))
+	switch stationBackend {
+	case "", "memory":
+		etaStores.Stations = storage.NewMemoryStationStore()
+		etaStores.Destinations = storage.NewMemoryDestinationStore()
+	case "mongo":
+		if mongoClient == nil {
+			client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init mongo client")
+			}
+			mongoClient = client
+		}
+		stations := storage.NewMongoStationStore(mongoClient, cfg.MongoDatabase, cfg.MongoStationCollection)
+		destinations := storage.NewMongoDestinationStore(mongoClient, cfg.MongoDatabase, cfg.MongoDestinationCollection)
+		if stations == nil || destinations == nil {
+			logger.Fatal().Msg("mongo station store init failed")
+		}
+		etaStores.Stations = stations
+		etaStores.Destinations = destinations
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		stations := storage.NewRedisStationStore(redisClient, cfg.Redis.KeyPrefix)
+		destinations := storage.NewRedisDestinationStore(redisClient, cfg.Redis.KeyPrefix)
+		if stations == nil || destinations == nil {
+			logger.Fatal().Msg("redis station store init failed")
+		}
+		etaStores.Stations = stations
+		etaStores.Destinations = destinations
+	default:
+		logger.Fatal().Str("backend", stationBackend).Msg("unsupported station store backend")
+	}
+
+	userBackend := strings.ToLower(strings.TrimSpace(cfg.UserStoreBackend))
+	switch userBackend {
+	case "", "memory":
+		etaStores.Drivers = storage.NewMemoryUserStore()
+		etaStores.Vehicles = storage.NewMemoryVehicleStore()
+	case "mongo":
+		if mongoClient == nil {
+			client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init mongo client")
+			}
+			mongoClient = client
+		}
+		drivers := storage.NewMongoUserStore(mongoClient, cfg.MongoDatabase, cfg.MongoRiderCollection, cfg.MongoDriverCollection, cfg.MongoPhoneCollection)
+		vehicles := storage.NewMongoVehicleStore(mongoClient, cfg.MongoDatabase, cfg.MongoVehicleCollection)
+		if drivers == nil || vehicles == nil {
+			logger.Fatal().Msg("mongo driver store init failed")
+		}
+		etaStores.Drivers = drivers
+		etaStores.Vehicles = vehicles
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		drivers := storage.NewRedisUserStore(redisClient, cfg.Redis.KeyPrefix)
+		vehicles := storage.NewRedisVehicleStore(redisClient, cfg.Redis.KeyPrefix)
+		if drivers == nil || vehicles == nil {
+			logger.Fatal().Msg("redis driver store init failed")
+		}
+		etaStores.Drivers = drivers
+		etaStores.Vehicles = vehicles
+	default:
+		logger.Fatal().Str("backend", userBackend).Msg("unsupported user store backend")
+	}
+
+	ready := server.ReadyChecksFromClients(mongoClient, redisClient, observability.Logf())
 	defer func() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -79,11 +224,22 @@ func main() {
 		}
 	}()
 
+	locations := storage.NewMemoryLocationStore()
+	srv := location.NewServerWithStores(locations, shiftStore, bus)
+	etaStores.Locations = locations
+	etaSrv := etasvc.NewServerWithStores(etaStores)
+
 	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
 		func(grpcServer *grpc.Server) {
-			lastmilev1.RegisterLocationServiceServer(grpcServer, location.NewServer())
+			lastmilev1.RegisterLocationServiceServer(grpcServer, srv)
+			lastmilev1.RegisterEtaServiceServer(grpcServer, etaSrv)
+		},
+		func(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error {
+			if err := lastmilev1.RegisterLocationServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+				return err
+			}
+			return lastmilev1.RegisterEtaServiceHandlerFromEndpoint(ctx, mux, endpoint, opts)
 		},
-		lastmilev1.RegisterLocationServiceHandlerFromEndpoint,
 		ready.Checks...,
 	)
 	if err != nil {
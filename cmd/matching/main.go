@@ -2,17 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/Dheeraj2209/Last_mile_go/internal/config"
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
 	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/routing"
+	"github.com/Dheeraj2209/Last_mile_go/internal/sequencing"
 	"github.com/Dheeraj2209/Last_mile_go/internal/server"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"github.com/Dheeraj2209/Last_mile_go/services/matching"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
 )
 
@@ -46,6 +55,14 @@ func main() {
 		logger.Fatal().Err(err).Msg("invalid configuration")
 	}
 	logger.Info().Str("config", config.FormatConfig(cfg)).Msg("service config")
+	profile, err := cfg.EtaProfile()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid eta profile")
+	}
+	objective, err := sequencing.ParseObjective(cfg.DropoffObjective)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid drop-off objective")
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -62,10 +79,207 @@ func main() {
 		}
 	}()
 
-	ready, err := server.ReadyChecksFromConfig(ctx, cfg, observability.Logf())
-	if err != nil {
-		logger.Fatal().Err(err).Msg("readiness init failed")
+	var mongoClient *mongo.Client
+	var redisClient *redis.Client
+	var stores matching.Stores
+	storeBackend := strings.ToLower(strings.TrimSpace(cfg.RideStoreBackend))
+	if tripBackend := strings.ToLower(strings.TrimSpace(cfg.TripStoreBackend)); tripBackend != storeBackend {
+		logger.Fatal().Str("ride_backend", storeBackend).Str("trip_backend", tripBackend).Msg("matching requires ride and trip stores on the same backend")
+	}
+	switch storeBackend {
+	case "", "memory":
+		outbox := storage.NewMemoryOutbox()
+		requests := storage.NewMemoryRideRequestStore(outbox)
+		trips := storage.NewMemoryTripStore(outbox)
+		stores.Requests = requests
+		stores.Trips = trips
+		stores.Matches = storage.NewMemoryMatchStore(trips, requests)
+		stores.Outbox = outbox
+	case "mongo":
+		client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init mongo client")
+		}
+		mongoClient = client
+		outbox := storage.NewMongoOutbox(client, cfg.MongoDatabase, cfg.MongoOutboxCollection, cfg.ServiceName)
+		if outbox == nil {
+			logger.Fatal().Msg("mongo outbox init failed")
+		}
+		if err := outbox.EnsureIndexes(ctx, cfg.OutboxRetention); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create outbox indexes")
+		}
+		requests := storage.NewMongoRideRequestStore(client, cfg.MongoDatabase, cfg.MongoRideCollection, outbox)
+		trips := storage.NewMongoTripStore(client, cfg.MongoDatabase, cfg.MongoTripCollection, outbox)
+		stores.Requests = requests
+		stores.Trips = trips
+		stores.Matches = storage.NewMongoMatchStore(trips, requests)
+		stores.Outbox = outbox
+	case "redis":
+		client, err := storage.NewRedisClient(ctx, cfg.Redis)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init redis client")
+		}
+		redisClient = client
+		outbox := storage.NewRedisOutbox(client, cfg.Redis.KeyPrefix, cfg.ServiceName)
+		if outbox == nil {
+			logger.Fatal().Msg("redis outbox init failed")
+		}
+		requests := storage.NewRedisRideRequestStore(client, cfg.Redis.KeyPrefix, outbox)
+		trips := storage.NewRedisTripStore(client, cfg.Redis.KeyPrefix, outbox)
+		stores.Requests = requests
+		stores.Trips = trips
+		stores.Matches = storage.NewRedisMatchStore(trips, requests)
+		stores.Outbox = outbox
+	default:
+		logger.Fatal().Str("backend", storeBackend).Msg("unsupported matching store backend")
+	}
+
+	userBackend := strings.ToLower(strings.TrimSpace(cfg.UserStoreBackend))
+	switch userBackend {
+	case "", "memory":
+		users := storage.NewMemoryUserStore()
+		stores.Drivers = users
+		stores.Riders = users
+		stores.Vehicles = storage.NewMemoryVehicleStore()
+	case "mongo":
+		if mongoClient == nil {
+			client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init mongo client")
+			}
+			mongoClient = client
+		}
+		drivers := storage.NewMongoUserStore(mongoClient, cfg.MongoDatabase, cfg.MongoRiderCollection, cfg.MongoDriverCollection, cfg.MongoPhoneCollection)
+		vehicles := storage.NewMongoVehicleStore(mongoClient, cfg.MongoDatabase, cfg.MongoVehicleCollection)
+		if drivers == nil || vehicles == nil {
+			logger.Fatal().Msg("mongo driver store init failed")
+		}
+		stores.Drivers = drivers
+		stores.Riders = drivers
+		stores.Vehicles = vehicles
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		drivers := storage.NewRedisUserStore(redisClient, cfg.Redis.KeyPrefix)
+		vehicles := storage.NewRedisVehicleStore(redisClient, cfg.Redis.KeyPrefix)
+		if drivers == nil || vehicles == nil {
+			logger.Fatal().Msg("redis driver store init failed")
+		}
+		stores.Drivers = drivers
+		stores.Riders = drivers
+		stores.Vehicles = vehicles
+	default:
+		logger.Fatal().Str("backend", userBackend).Msg("unsupported user store backend")
+	}
+
+	stationBackend := strings.ToLower(strings.TrimSpace(cfg.StationStoreBackend))
+	switch stationBackend {
+	case "", "memory":
+		stores.Stations = storage.NewMemoryStationStore()
+		stores.Destinations = storage.NewMemoryDestinationStore()
+	case "mongo":
+		if mongoClient == nil {
+			client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init mongo client")
+			}
+			mongoClient = client
+		}
+		stations := storage.NewMongoStationStore(mongoClient, cfg.MongoDatabase, cfg.MongoStationCollection)
+		if stations == nil {
+			logger.Fatal().Msg("mongo station store init failed")
+		}
+		stores.Stations = stations
+		stores.Destinations = storage.NewMongoDestinationStore(mongoClient, cfg.MongoDatabase, cfg.MongoDestinationCollection)
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		stations := storage.NewRedisStationStore(redisClient, cfg.Redis.KeyPrefix)
+		if stations == nil {
+			logger.Fatal().Msg("redis station store init failed")
+		}
+		stores.Stations = stations
+		stores.Destinations = storage.NewRedisDestinationStore(redisClient, cfg.Redis.KeyPrefix)
+	default:
+		logger.Fatal().Str("backend", stationBackend).Msg("unsupported station store backend")
+	}
+
+	shiftBackend := strings.ToLower(strings.TrimSpace(cfg.ShiftStoreBackend))
+	switch shiftBackend {
+	case "", "memory":
+		stores.Shifts = storage.NewMemoryShiftStore()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		shifts := storage.NewRedisShiftStore(redisClient, cfg.Redis.KeyPrefix)
+		if shifts == nil {
+			logger.Fatal().Msg("redis shift store init failed")
+		}
+		stores.Shifts = shifts
+	default:
+		logger.Fatal().Str("backend", shiftBackend).Msg("unsupported shift store backend")
+	}
+
+	seatBackend := strings.ToLower(strings.TrimSpace(cfg.SeatStoreBackend))
+	switch seatBackend {
+	case "", "memory":
+		stores.Seats = storage.NewMemorySeatStore()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		seats := storage.NewRedisSeatStore(redisClient, cfg.Redis.KeyPrefix)
+		if seats == nil {
+			logger.Fatal().Msg("redis seat store init failed")
+		}
+		stores.Seats = seats
+	default:
+		logger.Fatal().Str("backend", seatBackend).Msg("unsupported seat store backend")
+	}
+
+	var bus events.Bus
+	busBackend := strings.ToLower(strings.TrimSpace(cfg.EventBusBackend))
+	switch busBackend {
+	case "", "memory":
+		bus = events.NewMemoryBus()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		redisBus := events.NewRedisBus(redisClient, cfg.Redis.KeyPrefix, cfg.EventStreamMaxLen)
+		if redisBus == nil {
+			logger.Fatal().Msg("redis event bus init failed")
+		}
+		bus = redisBus
+	default:
+		logger.Fatal().Str("backend", busBackend).Msg("unsupported event bus backend")
 	}
+	defer bus.Close()
+
+	ready := server.ReadyChecksFromClients(mongoClient, redisClient, observability.Logf())
 	defer func() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -79,9 +293,59 @@ func main() {
 		}
 	}()
 
+	stores.MinDriverRating = cfg.MinDriverRating
+	stores.MinDriverReliability = cfg.MinDriverReliability
+	stores.NoShow = matching.NoShowConfig{
+		Interval:       cfg.NoShowInterval,
+		GeofenceMeters: cfg.NoShowGeofenceMeters,
+		Wait:           cfg.NoShowWait,
+		Limit:          int32(cfg.NoShowLimit),
+	}
+	stores.PickupPinTTL = cfg.PickupPinTTL
+	stores.MaxDetourMeters = cfg.MaxDetourMeters
+	stores.DropoffObjective = objective
+	stores.Estimator = eta.Haversine{Profile: profile}
+	if cfg.RoutingOSMPBF != "" {
+		graph, err := routing.Load(cfg.RoutingOSMPBF)
+		if err != nil {
+			logger.Fatal().Err(err).Str("path", cfg.RoutingOSMPBF).Msg("failed to load road network")
+		}
+		stores.Router = graph
+		stores.Estimator = routing.Estimator{Graph: graph, Profile: profile}
+	}
+	srv := matching.NewServerWithStores(stores)
+
+	relay := events.NewOutboxRelay(stores.Outbox, bus, cfg.OutboxRelayInterval, cfg.OutboxRelayBatch)
+	go func() {
+		if err := relay.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Msg("outbox relay stopped")
+		}
+	}()
+
+	// Trip events bring driver cancellations, whose riders are requeued;
+	// location events tell when drivers reach the station.
+	for _, stream := range []string{events.StreamRideRequests, events.StreamTrips, events.StreamLocations} {
+		go func() {
+			err := bus.Subscribe(ctx, stream, events.ConsumerConfig{
+				Group:        cfg.ServiceName,
+				Consumer:     cfg.EventConsumerName,
+				ClaimMinIdle: cfg.EventClaimMinIdle,
+			}, srv.HandleEvent)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error().Err(err).Str("stream", stream).Msg("event consumer stopped")
+			}
+		}()
+	}
+
+	go func() {
+		if err := srv.RunNoShowChecks(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Msg("no-show checks stopped")
+		}
+	}()
+
 	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
 		func(grpcServer *grpc.Server) {
-			lastmilev1.RegisterMatchingServiceServer(grpcServer, matching.NewServer())
+			lastmilev1.RegisterMatchingServiceServer(grpcServer, srv)
 		},
 		lastmilev1.RegisterMatchingServiceHandlerFromEndpoint,
 		ready.Checks...,
@@ -2,17 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/Dheeraj2209/Last_mile_go/internal/config"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
 	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
 	"github.com/Dheeraj2209/Last_mile_go/internal/server"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"github.com/Dheeraj2209/Last_mile_go/services/notification"
+	"github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
 )
 
@@ -62,10 +67,29 @@ func main() {
 		}
 	}()
 
-	ready, err := server.ReadyChecksFromConfig(ctx, cfg, observability.Logf())
-	if err != nil {
-		logger.Fatal().Err(err).Msg("readiness init failed")
+	var redisClient *redis.Client
+	var bus events.Bus
+	busBackend := strings.ToLower(strings.TrimSpace(cfg.EventBusBackend))
+	switch busBackend {
+	case "", "memory":
+		bus = events.NewMemoryBus()
+	case "redis":
+		client, err := storage.NewRedisClient(ctx, cfg.Redis)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init redis client")
+		}
+		redisClient = client
+		redisBus := events.NewRedisBus(client, cfg.Redis.KeyPrefix, cfg.EventStreamMaxLen)
+		if redisBus == nil {
+			logger.Fatal().Msg("redis event bus init failed")
+		}
+		bus = redisBus
+	default:
+		logger.Fatal().Str("backend", busBackend).Msg("unsupported event bus backend")
 	}
+	defer bus.Close()
+
+	ready := server.ReadyChecksFromClients(nil, redisClient, observability.Logf())
 	defer func() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -79,9 +103,24 @@ func main() {
 		}
 	}()
 
+	srv := notification.NewServer()
+
+	for _, stream := range []string{events.StreamTrips, events.StreamRideRequests, events.StreamPickupPins} {
+		go func() {
+			err := bus.Subscribe(ctx, stream, events.ConsumerConfig{
+				Group:        cfg.ServiceName,
+				Consumer:     cfg.EventConsumerName,
+				ClaimMinIdle: cfg.EventClaimMinIdle,
+			}, srv.HandleEvent)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error().Err(err).Str("stream", stream).Msg("event consumer stopped")
+			}
+		}()
+	}
+
 	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
 		func(grpcServer *grpc.Server) {
-			lastmilev1.RegisterNotificationServiceServer(grpcServer, notification.NewServer())
+			lastmilev1.RegisterNotificationServiceServer(grpcServer, srv)
 		},
 		lastmilev1.RegisterNotificationServiceHandlerFromEndpoint,
 		ready.Checks...,
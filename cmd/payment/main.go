@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/config"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/server"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"github.com/Dheeraj2209/Last_mile_go/services/payment"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	cfg := config.Load("payment")
+
+	var grpcListenAddr string
+	var grpcEndpoint string
+	var httpAddr string
+	var otelEndpoint string
+	var otelInsecure bool
+	var logLevel string
+
+	flag.StringVar(&grpcListenAddr, "grpc-listen", cfg.GRPCListenAddr, "gRPC listen address")
+	flag.StringVar(&grpcEndpoint, "grpc-endpoint", cfg.GRPCEndpoint, "gRPC endpoint for gateway dialing")
+	flag.StringVar(&httpAddr, "http-addr", cfg.HTTPAddr, "HTTP listen address")
+	flag.StringVar(&otelEndpoint, "otel-endpoint", cfg.OTelEndpoint, "OTel OTLP gRPC endpoint (host:port)")
+	flag.BoolVar(&otelInsecure, "otel-insecure", cfg.OTelInsecure, "Disable TLS for OTLP exporter")
+	flag.StringVar(&logLevel, "log-level", cfg.LogLevel, "Log level (debug, info, warn, error)")
+	flag.Parse()
+
+	cfg.GRPCListenAddr = grpcListenAddr
+	cfg.GRPCEndpoint = grpcEndpoint
+	cfg.HTTPAddr = httpAddr
+	cfg.OTelEndpoint = otelEndpoint
+	cfg.OTelInsecure = otelInsecure
+	cfg.LogLevel = logLevel
+
+	logger := observability.ConfigureLogger(cfg.ServiceName, cfg.LogLevel)
+	if err := config.Validate(cfg); err != nil {
+		logger.Fatal().Err(err).Msg("invalid configuration")
+	}
+	logger.Info().Str("config", config.FormatConfig(cfg)).Msg("service config")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownOTel, err := observability.Setup(ctx, cfg.ServiceName, cfg.OTelEndpoint, cfg.OTelInsecure)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to init telemetry")
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownOTel(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("telemetry shutdown error")
+		}
+	}()
+
+	var ledger storage.LedgerStore
+	var mongoClient *mongo.Client
+	var redisClient *redis.Client
+	paymentBackend := strings.ToLower(strings.TrimSpace(cfg.PaymentStoreBackend))
+	switch paymentBackend {
+	case "", "memory":
+		ledger = storage.NewMemoryLedgerStore()
+	case "mongo":
+		client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init mongo client")
+		}
+		mongoClient = client
+		mongoLedger := storage.NewMongoLedgerStore(client, cfg.MongoDatabase, cfg.MongoLedgerCollection, cfg.MongoAccountCollection)
+		if mongoLedger == nil {
+			logger.Fatal().Msg("mongo ledger store init failed")
+		}
+		if err := mongoLedger.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create ledger indexes")
+		}
+		ledger = mongoLedger
+	default:
+		logger.Fatal().Str("backend", paymentBackend).Msg("unsupported payment store backend")
+	}
+
+	var bus events.Bus
+	busBackend := strings.ToLower(strings.TrimSpace(cfg.EventBusBackend))
+	switch busBackend {
+	case "", "memory":
+		bus = events.NewMemoryBus()
+	case "redis":
+		client, err := storage.NewRedisClient(ctx, cfg.Redis)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init redis client")
+		}
+		redisClient = client
+		redisBus := events.NewRedisBus(client, cfg.Redis.KeyPrefix, cfg.EventStreamMaxLen)
+		if redisBus == nil {
+			logger.Fatal().Msg("redis event bus init failed")
+		}
+		bus = redisBus
+	default:
+		logger.Fatal().Str("backend", busBackend).Msg("unsupported event bus backend")
+	}
+	defer bus.Close()
+
+	ready := server.ReadyChecksFromClients(mongoClient, redisClient, observability.Logf())
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, closer := range ready.Closers {
+			if closer == nil {
+				continue
+			}
+			if err := closer(shutdownCtx); err != nil {
+				logger.Error().Err(err).Msg("readiness close error")
+			}
+		}
+	}()
+
+	// Charges and payouts go through the local fake until a payment provider
+	// is integrated.
+	srv := payment.NewServerWithStores(payment.Stores{
+		Ledger:     ledger,
+		Provider:   payment.NewFakeProvider(),
+		Currency:   cfg.PricingCurrency,
+		Commission: cfg.PaymentCommission,
+	})
+
+	for _, stream := range []string{events.StreamTrips, events.StreamRideRequests} {
+		go func() {
+			err := bus.Subscribe(ctx, stream, events.ConsumerConfig{
+				Group:        cfg.ServiceName,
+				Consumer:     cfg.EventConsumerName,
+				ClaimMinIdle: cfg.EventClaimMinIdle,
+			}, srv.HandleEvent)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error().Err(err).Str("stream", stream).Msg("event consumer stopped")
+			}
+		}()
+	}
+
+	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
+		func(grpcServer *grpc.Server) {
+			lastmilev1.RegisterPaymentServiceServer(grpcServer, srv)
+		},
+		lastmilev1.RegisterPaymentServiceHandlerFromEndpoint,
+		ready.Checks...,
+	)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("service stopped")
+	}
+}
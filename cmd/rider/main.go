@@ -2,17 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/Dheeraj2209/Last_mile_go/internal/config"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/fare"
 	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
 	"github.com/Dheeraj2209/Last_mile_go/internal/server"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"github.com/Dheeraj2209/Last_mile_go/services/rider"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
 )
 
@@ -46,6 +53,7 @@ func main() {
 		logger.Fatal().Err(err).Msg("invalid configuration")
 	}
 	logger.Info().Str("config", config.FormatConfig(cfg)).Msg("service config")
+	fare.SetSecret(cfg.QuoteTokenSecret)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -62,10 +70,79 @@ func main() {
 		}
 	}()
 
-	ready, err := server.ReadyChecksFromConfig(ctx, cfg, observability.Logf())
-	if err != nil {
-		logger.Fatal().Err(err).Msg("readiness init failed")
+	var mongoClient *mongo.Client
+	var redisClient *redis.Client
+	var requests storage.RideRequestStore
+	var outbox storage.Outbox
+	rideBackend := strings.ToLower(strings.TrimSpace(cfg.RideStoreBackend))
+	switch rideBackend {
+	case "", "memory":
+		store := storage.NewMemoryRideRequestStore(nil)
+		requests = store
+		outbox = store.Outbox()
+	case "mongo":
+		client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init mongo client")
+		}
+		mongoClient = client
+		mongoOutbox := storage.NewMongoOutbox(client, cfg.MongoDatabase, cfg.MongoOutboxCollection, cfg.ServiceName)
+		if mongoOutbox == nil {
+			logger.Fatal().Msg("mongo outbox init failed")
+		}
+		if err := mongoOutbox.EnsureIndexes(ctx, cfg.OutboxRetention); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create outbox indexes")
+		}
+		mongoRequests := storage.NewMongoRideRequestStore(client, cfg.MongoDatabase, cfg.MongoRideCollection, mongoOutbox)
+		if err := mongoRequests.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create ride request indexes")
+		}
+		requests = mongoRequests
+		outbox = mongoOutbox
+	case "redis":
+		client, err := storage.NewRedisClient(ctx, cfg.Redis)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init redis client")
+		}
+		redisClient = client
+		redisOutbox := storage.NewRedisOutbox(client, cfg.Redis.KeyPrefix, cfg.ServiceName)
+		if redisOutbox == nil {
+			logger.Fatal().Msg("redis outbox init failed")
+		}
+		redisRequests := storage.NewRedisRideRequestStore(client, cfg.Redis.KeyPrefix, redisOutbox)
+		if err := redisRequests.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to index ride requests by status")
+		}
+		requests = redisRequests
+		outbox = redisOutbox
+	default:
+		logger.Fatal().Str("backend", rideBackend).Msg("unsupported ride store backend")
+	}
+
+	var bus events.Bus
+	busBackend := strings.ToLower(strings.TrimSpace(cfg.EventBusBackend))
+	switch busBackend {
+	case "", "memory":
+		bus = events.NewMemoryBus()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		redisBus := events.NewRedisBus(redisClient, cfg.Redis.KeyPrefix, cfg.EventStreamMaxLen)
+		if redisBus == nil {
+			logger.Fatal().Msg("redis event bus init failed")
+		}
+		bus = redisBus
+	default:
+		logger.Fatal().Str("backend", busBackend).Msg("unsupported event bus backend")
 	}
+	defer bus.Close()
+
+	ready := server.ReadyChecksFromClients(mongoClient, redisClient, observability.Logf())
 	defer func() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -79,9 +156,32 @@ func main() {
 		}
 	}()
 
+	srv := rider.NewServerWithStores(rider.Stores{
+		Requests: requests,
+		Cancellation: rider.CancellationPolicy{
+			FreeWindow: cfg.CancelFreeWindow,
+			Fee:        cfg.CancelFee,
+		},
+	})
+
+	relay := events.NewOutboxRelay(outbox, bus, cfg.OutboxRelayInterval, cfg.OutboxRelayBatch)
+	go func() {
+		if err := relay.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Msg("outbox relay stopped")
+		}
+	}()
+
+	if cfg.GTFSRealtimeURL != "" {
+		go func() {
+			if err := srv.RunTripUpdates(ctx, cfg.GTFSRealtimeURL, cfg.GTFSRealtimeInterval); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error().Err(err).Msg("gtfs-rt consumer stopped")
+			}
+		}()
+	}
+
 	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
 		func(grpcServer *grpc.Server) {
-			lastmilev1.RegisterRiderServiceServer(grpcServer, rider.NewServer())
+			lastmilev1.RegisterRiderServiceServer(grpcServer, srv)
 		},
 		lastmilev1.RegisterRiderServiceHandlerFromEndpoint,
 		ready.Checks...,
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"os/signal"
@@ -11,10 +12,16 @@ import (
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/Dheeraj2209/Last_mile_go/internal/config"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/fare"
 	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
+	"github.com/Dheeraj2209/Last_mile_go/internal/routing"
 	"github.com/Dheeraj2209/Last_mile_go/internal/server"
 	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"github.com/Dheeraj2209/Last_mile_go/services/pricing"
 	"github.com/Dheeraj2209/Last_mile_go/services/station"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
@@ -50,6 +57,12 @@ func main() {
 		logger.Fatal().Err(err).Msg("invalid configuration")
 	}
 	logger.Info().Str("config", config.FormatConfig(cfg)).Msg("service config")
+	pagetoken.SetSecret(cfg.PageTokenSecret)
+	fare.SetSecret(cfg.QuoteTokenSecret)
+	rules, err := cfg.PricingRules()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid pricing rules")
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -67,36 +80,169 @@ func main() {
 	}()
 
 	var store storage.StationStore
+	var schedules storage.ScheduleStore
+	var areas storage.AreaStore
+	var destinations storage.DestinationStore
+	var surges storage.SurgeStore
 	var mongoClient *mongo.Client
 	var redisClient *redis.Client
 	stationBackend := strings.ToLower(strings.TrimSpace(cfg.StationStoreBackend))
 	switch stationBackend {
 	case "", "memory":
 		store = storage.NewMemoryStationStore()
+		schedules = storage.NewMemoryScheduleStore()
+		areas = storage.NewMemoryAreaStore()
+		destinations = storage.NewMemoryDestinationStore()
+		surges = storage.NewMemorySurgeStore()
 	case "mongo":
 		client, err := storage.NewMongoClient(ctx, cfg.Mongo)
 		if err != nil {
 			logger.Fatal().Err(err).Msg("failed to init mongo client")
 		}
 		mongoClient = client
-		store = storage.NewMongoStationStore(client, cfg.MongoDatabase, cfg.MongoStationCollection)
-		if store == nil {
+		stations := storage.NewMongoStationStore(client, cfg.MongoDatabase, cfg.MongoStationCollection)
+		if stations == nil {
 			logger.Fatal().Msg("mongo station store init failed")
 		}
+		if err := stations.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create station indexes")
+		}
+		store = stations
+		schedules = storage.NewMongoScheduleStore(client, cfg.MongoDatabase, cfg.MongoScheduleCollection)
+		mongoAreas := storage.NewMongoAreaStore(client, cfg.MongoDatabase, cfg.MongoAreaCollection)
+		if err := mongoAreas.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create service area indexes")
+		}
+		areas = mongoAreas
+		destinations = storage.NewMongoDestinationStore(client, cfg.MongoDatabase, cfg.MongoDestinationCollection)
+		mongoSurges := storage.NewMongoSurgeStore(client, cfg.MongoDatabase, cfg.MongoSurgeCollection, cfg.MongoSurgeChangeCollection)
+		if err := mongoSurges.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create surge indexes")
+		}
+		surges = mongoSurges
 	case "redis":
 		client, err := storage.NewRedisClient(ctx, cfg.Redis)
 		if err != nil {
 			logger.Fatal().Err(err).Msg("failed to init redis client")
 		}
 		redisClient = client
-		store = storage.NewRedisStationStore(client, cfg.Redis.KeyPrefix)
-		if store == nil {
+		stations := storage.NewRedisStationStore(client, cfg.Redis.KeyPrefix)
+		if stations == nil {
 			logger.Fatal().Msg("redis station store init failed")
 		}
+		if err := stations.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to index station locations")
+		}
+		store = stations
+		schedules = storage.NewRedisScheduleStore(client, cfg.Redis.KeyPrefix)
+		areas = storage.NewRedisAreaStore(client, cfg.Redis.KeyPrefix)
+		destinations = storage.NewRedisDestinationStore(client, cfg.Redis.KeyPrefix)
+		surges = storage.NewRedisSurgeStore(client, cfg.Redis.KeyPrefix)
 	default:
 		logger.Fatal().Str("backend", stationBackend).Msg("unsupported station store backend")
 	}
 
+	// Ride requests and trips are only read (to guard deletes and to measure
+	// surge demand), so no outbox is needed here.
+	stores := station.Stores{Stations: store, Schedules: schedules, Areas: areas, Destinations: destinations}
+	rideBackend := strings.ToLower(strings.TrimSpace(cfg.RideStoreBackend))
+	switch rideBackend {
+	case "", "memory":
+		stores.Requests = storage.NewMemoryRideRequestStore(nil)
+	case "mongo":
+		if mongoClient == nil {
+			client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init mongo client")
+			}
+			mongoClient = client
+		}
+		stores.Requests = storage.NewMongoRideRequestStore(mongoClient, cfg.MongoDatabase, cfg.MongoRideCollection, nil)
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		stores.Requests = storage.NewRedisRideRequestStore(redisClient, cfg.Redis.KeyPrefix, nil)
+	default:
+		logger.Fatal().Str("backend", rideBackend).Msg("unsupported ride store backend")
+	}
+
+	tripBackend := strings.ToLower(strings.TrimSpace(cfg.TripStoreBackend))
+	switch tripBackend {
+	case "", "memory":
+		stores.Trips = storage.NewMemoryTripStore(nil)
+	case "mongo":
+		if mongoClient == nil {
+			client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init mongo client")
+			}
+			mongoClient = client
+		}
+		stores.Trips = storage.NewMongoTripStore(mongoClient, cfg.MongoDatabase, cfg.MongoTripCollection, nil)
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		stores.Trips = storage.NewRedisTripStore(redisClient, cfg.Redis.KeyPrefix, nil)
+	default:
+		logger.Fatal().Str("backend", tripBackend).Msg("unsupported trip store backend")
+	}
+
+	// Surge supply only counts drivers on shift.
+	var shifts storage.ShiftStore
+	shiftBackend := strings.ToLower(strings.TrimSpace(cfg.ShiftStoreBackend))
+	switch shiftBackend {
+	case "", "memory":
+		shifts = storage.NewMemoryShiftStore()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		redisShifts := storage.NewRedisShiftStore(redisClient, cfg.Redis.KeyPrefix)
+		if redisShifts == nil {
+			logger.Fatal().Msg("redis shift store init failed")
+		}
+		shifts = redisShifts
+	default:
+		logger.Fatal().Str("backend", shiftBackend).Msg("unsupported shift store backend")
+	}
+
+	var bus events.Bus
+	busBackend := strings.ToLower(strings.TrimSpace(cfg.EventBusBackend))
+	switch busBackend {
+	case "", "memory":
+		bus = events.NewMemoryBus()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		redisBus := events.NewRedisBus(redisClient, cfg.Redis.KeyPrefix, cfg.EventStreamMaxLen)
+		if redisBus == nil {
+			logger.Fatal().Msg("redis event bus init failed")
+		}
+		bus = redisBus
+	default:
+		logger.Fatal().Str("backend", busBackend).Msg("unsupported event bus backend")
+	}
+	defer bus.Close()
+
 	ready := server.ReadyChecksFromClients(mongoClient, redisClient, observability.Logf())
 	defer func() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -111,11 +257,60 @@ func main() {
 		}
 	}()
 
+	var router pricing.Router
+	if cfg.RoutingOSMPBF != "" {
+		graph, err := routing.Load(cfg.RoutingOSMPBF)
+		if err != nil {
+			logger.Fatal().Err(err).Str("path", cfg.RoutingOSMPBF).Msg("failed to load road network")
+		}
+		router = graph
+	}
+	pricingSrv := pricing.NewServerWithStores(pricing.Stores{
+		Stations:     store,
+		Destinations: destinations,
+		Router:       router,
+		Requests:     stores.Requests,
+		Shifts:       shifts,
+		Surges:       surges,
+		Rules:        rules,
+		QuoteTTL:     cfg.QuoteTTL,
+		Surge: pricing.SurgeConfig{
+			Interval:     cfg.SurgeInterval,
+			Window:       cfg.SurgeWindow,
+			RadiusMeters: cfg.SurgeRadiusMeters,
+			Sensitivity:  cfg.SurgeSensitivity,
+			Max:          cfg.SurgeMax,
+		},
+	})
+
+	go func() {
+		err := bus.Subscribe(ctx, events.StreamLocations, events.ConsumerConfig{
+			Group:        cfg.ServiceName,
+			Consumer:     cfg.EventConsumerName,
+			ClaimMinIdle: cfg.EventClaimMinIdle,
+		}, pricingSrv.HandleEvent)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Msg("event consumer stopped")
+		}
+	}()
+
+	go func() {
+		if err := pricingSrv.RunSurge(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Msg("surge updates stopped")
+		}
+	}()
+
 	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
 		func(grpcServer *grpc.Server) {
-			lastmilev1.RegisterStationServiceServer(grpcServer, station.NewServerWithStore(store))
+			lastmilev1.RegisterStationServiceServer(grpcServer, station.NewServerWithStores(stores))
+			lastmilev1.RegisterPricingServiceServer(grpcServer, pricingSrv)
+		},
+		func(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error {
+			if err := lastmilev1.RegisterStationServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+				return err
+			}
+			return lastmilev1.RegisterPricingServiceHandlerFromEndpoint(ctx, mux, endpoint, opts)
 		},
-		lastmilev1.RegisterStationServiceHandlerFromEndpoint,
 		ready.Checks...,
 	)
 	if err != nil {
@@ -2,17 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/Dheeraj2209/Last_mile_go/internal/config"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
 	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
 	"github.com/Dheeraj2209/Last_mile_go/internal/server"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"github.com/Dheeraj2209/Last_mile_go/services/trip"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
 )
 
@@ -62,10 +68,124 @@ func main() {
 		}
 	}()
 
-	ready, err := server.ReadyChecksFromConfig(ctx, cfg, observability.Logf())
-	if err != nil {
-		logger.Fatal().Err(err).Msg("readiness init failed")
+	var mongoClient *mongo.Client
+	var redisClient *redis.Client
+	var trips storage.TripStore
+	var requests storage.RideRequestStore
+	var pickups storage.PickupStore
+	var outbox storage.Outbox
+	tripBackend := strings.ToLower(strings.TrimSpace(cfg.TripStoreBackend))
+	switch tripBackend {
+	case "", "memory":
+		store := storage.NewMemoryTripStore(nil)
+		requestStore := storage.NewMemoryRideRequestStore(store.Outbox())
+		trips = store
+		requests = requestStore
+		pickups = storage.NewMemoryPickupStore(store, requestStore)
+		outbox = store.Outbox()
+	case "mongo":
+		client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init mongo client")
+		}
+		mongoClient = client
+		mongoOutbox := storage.NewMongoOutbox(client, cfg.MongoDatabase, cfg.MongoOutboxCollection, cfg.ServiceName)
+		if mongoOutbox == nil {
+			logger.Fatal().Msg("mongo outbox init failed")
+		}
+		if err := mongoOutbox.EnsureIndexes(ctx, cfg.OutboxRetention); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create outbox indexes")
+		}
+		tripStore := storage.NewMongoTripStore(client, cfg.MongoDatabase, cfg.MongoTripCollection, mongoOutbox)
+		requestStore := storage.NewMongoRideRequestStore(client, cfg.MongoDatabase, cfg.MongoRideCollection, mongoOutbox)
+		trips = tripStore
+		requests = requestStore
+		pickups = storage.NewMongoPickupStore(tripStore, requestStore)
+		outbox = mongoOutbox
+	case "redis":
+		client, err := storage.NewRedisClient(ctx, cfg.Redis)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to init redis client")
+		}
+		redisClient = client
+		redisOutbox := storage.NewRedisOutbox(client, cfg.Redis.KeyPrefix, cfg.ServiceName)
+		if redisOutbox == nil {
+			logger.Fatal().Msg("redis outbox init failed")
+		}
+		tripStore := storage.NewRedisTripStore(client, cfg.Redis.KeyPrefix, redisOutbox)
+		requestStore := storage.NewRedisRideRequestStore(client, cfg.Redis.KeyPrefix, redisOutbox)
+		trips = tripStore
+		requests = requestStore
+		pickups = storage.NewRedisPickupStore(tripStore, requestStore)
+		outbox = redisOutbox
+	default:
+		logger.Fatal().Str("backend", tripBackend).Msg("unsupported trip store backend")
+	}
+
+	var riders storage.RiderStore
+	var drivers storage.DriverStore
+	userBackend := strings.ToLower(strings.TrimSpace(cfg.UserStoreBackend))
+	switch userBackend {
+	case "", "memory":
+		users := storage.NewMemoryUserStore()
+		riders = users
+		drivers = users
+	case "mongo":
+		if mongoClient == nil {
+			client, err := storage.NewMongoClient(ctx, cfg.Mongo)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init mongo client")
+			}
+			mongoClient = client
+		}
+		users := storage.NewMongoUserStore(mongoClient, cfg.MongoDatabase, cfg.MongoRiderCollection, cfg.MongoDriverCollection, cfg.MongoPhoneCollection)
+		if users == nil {
+			logger.Fatal().Msg("mongo user store init failed")
+		}
+		riders = users
+		drivers = users
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		users := storage.NewRedisUserStore(redisClient, cfg.Redis.KeyPrefix)
+		if users == nil {
+			logger.Fatal().Msg("redis user store init failed")
+		}
+		riders = users
+		drivers = users
+	default:
+		logger.Fatal().Str("backend", userBackend).Msg("unsupported user store backend")
 	}
+
+	var bus events.Bus
+	busBackend := strings.ToLower(strings.TrimSpace(cfg.EventBusBackend))
+	switch busBackend {
+	case "", "memory":
+		bus = events.NewMemoryBus()
+	case "redis":
+		if redisClient == nil {
+			client, err := storage.NewRedisClient(ctx, cfg.Redis)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to init redis client")
+			}
+			redisClient = client
+		}
+		redisBus := events.NewRedisBus(redisClient, cfg.Redis.KeyPrefix, cfg.EventStreamMaxLen)
+		if redisBus == nil {
+			logger.Fatal().Msg("redis event bus init failed")
+		}
+		bus = redisBus
+	default:
+		logger.Fatal().Str("backend", busBackend).Msg("unsupported event bus backend")
+	}
+	defer bus.Close()
+
+	ready := server.ReadyChecksFromClients(mongoClient, redisClient, observability.Logf())
 	defer func() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -79,9 +199,39 @@ func main() {
 		}
 	}()
 
+	srv := trip.NewServerWithStores(trip.Stores{
+		Trips:               trips,
+		Riders:              riders,
+		Drivers:             drivers,
+		Requests:            requests,
+		Pickups:             pickups,
+		DriverCancelPenalty: cfg.DriverCancelPenalty,
+		PickupMaxAttempts:   int32(cfg.PickupPinMaxAttempts),
+	})
+
+	relay := events.NewOutboxRelay(outbox, bus, cfg.OutboxRelayInterval, cfg.OutboxRelayBatch)
+	go func() {
+		if err := relay.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Msg("outbox relay stopped")
+		}
+	}()
+
+	// Driver cancellations are penalized from the trip's own events, so a
+	// committed cancellation is always counted.
+	go func() {
+		err := bus.Subscribe(ctx, events.StreamTrips, events.ConsumerConfig{
+			Group:        cfg.ServiceName,
+			Consumer:     cfg.EventConsumerName,
+			ClaimMinIdle: cfg.EventClaimMinIdle,
+		}, srv.HandleEvent)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Str("stream", events.StreamTrips).Msg("event consumer stopped")
+		}
+	}()
+
 	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
 		func(grpcServer *grpc.Server) {
-			lastmilev1.RegisterTripServiceServer(grpcServer, trip.NewServer())
+			lastmilev1.RegisterTripServiceServer(grpcServer, srv)
 		},
 		lastmilev1.RegisterTripServiceHandlerFromEndpoint,
 		ready.Checks...,
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"os/signal"
@@ -12,9 +13,12 @@ import (
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/Dheeraj2209/Last_mile_go/internal/config"
 	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
 	"github.com/Dheeraj2209/Last_mile_go/internal/server"
 	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"github.com/Dheeraj2209/Last_mile_go/services/user"
+	"github.com/Dheeraj2209/Last_mile_go/services/vehicle"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
@@ -50,6 +54,7 @@ func main() {
 		logger.Fatal().Err(err).Msg("invalid configuration")
 	}
 	logger.Info().Str("config", config.FormatConfig(cfg)).Msg("service config")
+	pagetoken.SetSecret(cfg.PageTokenSecret)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -68,6 +73,7 @@ func main() {
 
 	var riderStore storage.RiderStore
 	var driverStore storage.DriverStore
+	var vehicleStore storage.VehicleStore
 	var mongoClient *mongo.Client
 	var redisClient *redis.Client
 	userBackend := strings.ToLower(strings.TrimSpace(cfg.UserStoreBackend))
@@ -76,18 +82,30 @@ func main() {
 		mem := storage.NewMemoryUserStore()
 		riderStore = mem
 		driverStore = mem
+		vehicleStore = storage.NewMemoryVehicleStore()
 	case "mongo":
 		client, err := storage.NewMongoClient(ctx, cfg.Mongo)
 		if err != nil {
 			logger.Fatal().Err(err).Msg("failed to init mongo client")
 		}
 		mongoClient = client
-		store := storage.NewMongoUserStore(client, cfg.MongoDatabase, cfg.MongoRiderCollection, cfg.MongoDriverCollection)
+		store := storage.NewMongoUserStore(client, cfg.MongoDatabase, cfg.MongoRiderCollection, cfg.MongoDriverCollection, cfg.MongoPhoneCollection)
 		if store == nil {
 			logger.Fatal().Msg("mongo user store init failed")
 		}
+		if err := store.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create user indexes")
+		}
 		riderStore = store
 		driverStore = store
+		vehicles := storage.NewMongoVehicleStore(client, cfg.MongoDatabase, cfg.MongoVehicleCollection)
+		if vehicles == nil {
+			logger.Fatal().Msg("mongo vehicle store init failed")
+		}
+		if err := vehicles.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to create vehicle indexes")
+		}
+		vehicleStore = vehicles
 	case "redis":
 		client, err := storage.NewRedisClient(ctx, cfg.Redis)
 		if err != nil {
@@ -98,8 +116,16 @@ func main() {
 		if store == nil {
 			logger.Fatal().Msg("redis user store init failed")
 		}
+		if err := store.EnsureIndexes(ctx); err != nil {
+			logger.Fatal().Err(err).Msg("failed to claim driver vehicles")
+		}
 		riderStore = store
 		driverStore = store
+		vehicles := storage.NewRedisVehicleStore(client, cfg.Redis.KeyPrefix)
+		if vehicles == nil {
+			logger.Fatal().Msg("redis vehicle store init failed")
+		}
+		vehicleStore = vehicles
 	default:
 		logger.Fatal().Str("backend", userBackend).Msg("unsupported user store backend")
 	}
@@ -118,11 +144,24 @@ func main() {
 		}
 	}()
 
+	srv := user.NewServerWithStores(riderStore, driverStore, vehicleStore, cfg.DefaultPhoneRegion)
+	go func() {
+		if err := srv.RunDocumentExpiryChecks(ctx, cfg.DocumentExpiryInterval); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error().Err(err).Msg("document expiry checks stopped")
+		}
+	}()
+
 	err = server.Run(ctx, cfg.GRPCListenAddr, cfg.GRPCEndpoint, cfg.HTTPAddr,
 		func(grpcServer *grpc.Server) {
-			lastmilev1.RegisterUserServiceServer(grpcServer, user.NewServerWithStores(riderStore, driverStore))
+			lastmilev1.RegisterUserServiceServer(grpcServer, srv)
+			lastmilev1.RegisterVehicleServiceServer(grpcServer, vehicle.NewServerWithStores(vehicleStore, driverStore))
+		},
+		func(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error {
+			if err := lastmilev1.RegisterUserServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+				return err
+			}
+			return lastmilev1.RegisterVehicleServiceHandlerFromEndpoint(ctx, mux, endpoint, opts)
 		},
-		lastmilev1.RegisterUserServiceHandlerFromEndpoint,
 		ready.Checks...,
 	)
 	if err != nil {
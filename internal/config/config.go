@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+	"github.com/Dheeraj2209/Last_mile_go/internal/fare"
+	"github.com/Dheeraj2209/Last_mile_go/internal/phone"
+	"github.com/Dheeraj2209/Last_mile_go/internal/sequencing"
 	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 )
 
@@ -18,31 +23,169 @@ type Config struct {
 	OTelEndpoint   string
 	OTelInsecure   bool
 	LogLevel       string
+	// Replicas is how many instances of the service run side by side.
+	Replicas int
 
 	UserStoreBackend    string
 	StationStoreBackend string
+	RideStoreBackend    string
+	TripStoreBackend    string
+	ShiftStoreBackend   string
+	SeatStoreBackend    string
+	PaymentStoreBackend string
+	EventBusBackend     string
+
+	EventStreamMaxLen int64
+	EventConsumerName string
+	EventClaimMinIdle time.Duration
+
+	DefaultPhoneRegion     string
+	DocumentExpiryInterval time.Duration
+	InactivityTimeout      time.Duration
+	MinDriverRating        float64
+	MinDriverReliability   float64
+	MaxDetourMeters        float64
+	DropoffObjective       string
+	NoShowInterval         time.Duration
+	NoShowGeofenceMeters   float64
+	NoShowWait             time.Duration
+	NoShowLimit            int
+	PickupPinTTL           time.Duration
+	PickupPinMaxAttempts   int
+	PageTokenSecret        string
+	GTFSRealtimeURL        string
+	GTFSRealtimeInterval   time.Duration
+
+	PricingCurrency       string
+	PricingBaseFare       int64
+	PricingPerKm          int64
+	PricingSharedDiscount float64
+	PricingPeakWindows    string
+	PricingTimezone       string
+	QuoteTTL              time.Duration
+	QuoteTokenSecret      string
+	SurgeInterval         time.Duration
+	SurgeWindow           time.Duration
+	SurgeRadiusMeters     float64
+	SurgeSensitivity      float64
+	SurgeMax              float64
+	PaymentCommission     float64
+	CancelFreeWindow      time.Duration
+	CancelFee             int64
+	DriverCancelPenalty   float64
+	EtaSpeeds             string
+	EtaDefaultSpeed       float64
+	EtaSpeedWindows       string
+	EtaTimezone           string
+	EtaDetourFactor       float64
+	RoutingOSMPBF         string
+
+	OutboxRelayInterval time.Duration
+	OutboxRelayBatch    int
+	OutboxRetention     time.Duration
+
+	CloudEventsSink         string
+	CloudEventsSource       string
+	CloudEventsHTTPURL      string
+	CloudEventsHTTPMode     string
+	CloudEventsHTTPTimeout  time.Duration
+	CloudEventsFileDir      string
+	CloudEventsFileMaxBytes int64
+	CloudEventsFileMaxAge   time.Duration
 
 	Mongo storage.MongoConfig
 	Redis storage.RedisConfig
 
-	MongoDatabase          string
-	MongoRiderCollection   string
-	MongoDriverCollection  string
-	MongoStationCollection string
+	MongoDatabase              string
+	MongoRiderCollection       string
+	MongoDriverCollection      string
+	MongoPhoneCollection       string
+	MongoStationCollection     string
+	MongoScheduleCollection    string
+	MongoAreaCollection        string
+	MongoDestinationCollection string
+	MongoSurgeCollection       string
+	MongoSurgeChangeCollection string
+	MongoVehicleCollection     string
+	MongoRideCollection        string
+	MongoTripCollection        string
+	MongoOutboxCollection      string
+	MongoLedgerCollection      string
+	MongoAccountCollection     string
 }
 
 func Load(serviceName string) Config {
 	loadDotEnv()
 	return Config{
-		ServiceName:         serviceName,
-		GRPCListenAddr:      getEnv("GRPC_LISTEN_ADDR", ":9090"),
-		GRPCEndpoint:        getEnv("GRPC_ENDPOINT", "localhost:9090"),
-		HTTPAddr:            getEnv("HTTP_ADDR", ":8080"),
-		OTelEndpoint:        os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
-		OTelInsecure:        getEnvBool("OTEL_EXPORTER_OTLP_INSECURE", true),
-		LogLevel:            getEnv("LOG_LEVEL", "info"),
-		UserStoreBackend:    getEnv("USER_STORE_BACKEND", "memory"),
-		StationStoreBackend: getEnv("STATION_STORE_BACKEND", "memory"),
+		ServiceName:             serviceName,
+		GRPCListenAddr:          getEnv("GRPC_LISTEN_ADDR", ":9090"),
+		GRPCEndpoint:            getEnv("GRPC_ENDPOINT", "localhost:9090"),
+		HTTPAddr:                getEnv("HTTP_ADDR", ":8080"),
+		Replicas:                getEnvInt("SERVICE_REPLICAS", 1),
+		OTelEndpoint:            os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OTelInsecure:            getEnvBool("OTEL_EXPORTER_OTLP_INSECURE", true),
+		LogLevel:                getEnv("LOG_LEVEL", "info"),
+		UserStoreBackend:        getEnv("USER_STORE_BACKEND", "memory"),
+		StationStoreBackend:     getEnv("STATION_STORE_BACKEND", "memory"),
+		RideStoreBackend:        getEnv("RIDE_STORE_BACKEND", "memory"),
+		TripStoreBackend:        getEnv("TRIP_STORE_BACKEND", "memory"),
+		ShiftStoreBackend:       getEnv("SHIFT_STORE_BACKEND", "memory"),
+		SeatStoreBackend:        getEnv("SEAT_STORE_BACKEND", "memory"),
+		PaymentStoreBackend:     getEnv("PAYMENT_STORE_BACKEND", "memory"),
+		DefaultPhoneRegion:      strings.ToUpper(getEnv("DEFAULT_PHONE_REGION", "IN")),
+		DocumentExpiryInterval:  getEnvDuration("DRIVER_DOCUMENT_CHECK_INTERVAL", time.Hour),
+		InactivityTimeout:       getEnvDuration("DRIVER_INACTIVITY_TIMEOUT", 5*time.Minute),
+		MinDriverRating:         getEnvFloat("MATCHING_MIN_DRIVER_RATING", 4.0),
+		MinDriverReliability:    getEnvFloat("MATCHING_MIN_DRIVER_RELIABILITY", 60),
+		MaxDetourMeters:         getEnvFloat("MATCHING_MAX_DETOUR_METERS", 2000),
+		DropoffObjective:        getEnv("MATCHING_DROPOFF_OBJECTIVE", "total_ride_time"),
+		NoShowInterval:          getEnvDuration("NO_SHOW_CHECK_INTERVAL", 30*time.Second),
+		NoShowGeofenceMeters:    getEnvFloat("NO_SHOW_GEOFENCE_METERS", 150),
+		NoShowWait:              getEnvDuration("NO_SHOW_WAIT", 5*time.Minute),
+		NoShowLimit:             getEnvInt("MATCHING_NO_SHOW_LIMIT", 3),
+		PickupPinTTL:            getEnvDuration("PICKUP_PIN_TTL", 30*time.Minute),
+		PickupPinMaxAttempts:    getEnvInt("PICKUP_PIN_MAX_ATTEMPTS", 5),
+		PageTokenSecret:         os.Getenv("PAGE_TOKEN_SECRET"),
+		GTFSRealtimeURL:         os.Getenv("GTFS_RT_URL"),
+		GTFSRealtimeInterval:    getEnvDuration("GTFS_RT_INTERVAL", 30*time.Second),
+		PricingCurrency:         strings.ToUpper(getEnv("PRICING_CURRENCY", "INR")),
+		PricingBaseFare:         int64(getEnvInt("PRICING_BASE_FARE", 1500)),
+		PricingPerKm:            int64(getEnvInt("PRICING_PER_KM", 800)),
+		PricingSharedDiscount:   getEnvFloat("PRICING_SHARED_DISCOUNT", 0.25),
+		PricingPeakWindows:      os.Getenv("PRICING_PEAK_WINDOWS"),
+		PricingTimezone:         getEnv("PRICING_TIMEZONE", "UTC"),
+		QuoteTTL:                getEnvDuration("QUOTE_TTL", 5*time.Minute),
+		SurgeInterval:           getEnvDuration("SURGE_INTERVAL", 30*time.Second),
+		SurgeWindow:             getEnvDuration("SURGE_WINDOW", 10*time.Minute),
+		SurgeRadiusMeters:       getEnvFloat("SURGE_RADIUS_METERS", 2000),
+		SurgeSensitivity:        getEnvFloat("SURGE_SENSITIVITY", 0.5),
+		SurgeMax:                getEnvFloat("SURGE_MAX_MULTIPLIER", 2.5),
+		PaymentCommission:       getEnvFloat("PAYMENT_COMMISSION", 0.2),
+		CancelFreeWindow:        getEnvDuration("CANCEL_FREE_WINDOW", 2*time.Minute),
+		CancelFee:               int64(getEnvInt("CANCEL_FEE", 2000)),
+		DriverCancelPenalty:     getEnvFloat("DRIVER_CANCEL_PENALTY", 10),
+		EtaSpeeds:               getEnv("ETA_SPEEDS", "e_rickshaw=15,cab=25,shuttle=20"),
+		EtaDefaultSpeed:         getEnvFloat("ETA_DEFAULT_SPEED", 20),
+		EtaSpeedWindows:         os.Getenv("ETA_SPEED_WINDOWS"),
+		EtaTimezone:             getEnv("ETA_TIMEZONE", "UTC"),
+		EtaDetourFactor:         getEnvFloat("ETA_DETOUR_FACTOR", 1.3),
+		RoutingOSMPBF:           os.Getenv("ROUTING_OSM_PBF"),
+		QuoteTokenSecret:        os.Getenv("QUOTE_TOKEN_SECRET"),
+		EventBusBackend:         getEnv("EVENT_BUS_BACKEND", "memory"),
+		EventStreamMaxLen:       int64(getEnvInt("EVENT_STREAM_MAXLEN", 100000)),
+		EventConsumerName:       getEnv("EVENT_CONSUMER_NAME", hostname()),
+		EventClaimMinIdle:       getEnvDuration("EVENT_CLAIM_MIN_IDLE", 30*time.Second),
+		OutboxRelayInterval:     getEnvDuration("OUTBOX_RELAY_INTERVAL", time.Second),
+		OutboxRelayBatch:        getEnvInt("OUTBOX_RELAY_BATCH", 100),
+		OutboxRetention:         getEnvDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+		CloudEventsSink:         getEnv("CLOUDEVENTS_SINK", "file"),
+		CloudEventsSource:       getEnv("CLOUDEVENTS_SOURCE", "/lastmile"),
+		CloudEventsHTTPURL:      os.Getenv("CLOUDEVENTS_HTTP_URL"),
+		CloudEventsHTTPMode:     getEnv("CLOUDEVENTS_HTTP_MODE", "binary"),
+		CloudEventsHTTPTimeout:  getEnvDuration("CLOUDEVENTS_HTTP_TIMEOUT", 10*time.Second),
+		CloudEventsFileDir:      getEnv("CLOUDEVENTS_FILE_DIR", "./cloudevents"),
+		CloudEventsFileMaxBytes: int64(getEnvInt("CLOUDEVENTS_FILE_MAX_BYTES", 64<<20)),
+		CloudEventsFileMaxAge:   getEnvDuration("CLOUDEVENTS_FILE_MAX_AGE", time.Hour),
 		Mongo: storage.MongoConfig{
 			URI:     os.Getenv("MONGO_URI"),
 			Timeout: getEnvDuration("MONGO_TIMEOUT", 10*time.Second),
@@ -54,10 +197,22 @@ func Load(serviceName string) Config {
 			Timeout:   getEnvDuration("REDIS_TIMEOUT", 5*time.Second),
 			KeyPrefix: getEnv("REDIS_KEY_PREFIX", "lastmile"),
 		},
-		MongoDatabase:          getEnv("MONGO_DB", "lastmile"),
-		MongoRiderCollection:   getEnv("MONGO_RIDER_COLLECTION", "riders"),
-		MongoDriverCollection:  getEnv("MONGO_DRIVER_COLLECTION", "drivers"),
-		MongoStationCollection: getEnv("MONGO_STATION_COLLECTION", "stations"),
+		MongoDatabase:              getEnv("MONGO_DB", "lastmile"),
+		MongoRiderCollection:       getEnv("MONGO_RIDER_COLLECTION", "riders"),
+		MongoDriverCollection:      getEnv("MONGO_DRIVER_COLLECTION", "drivers"),
+		MongoPhoneCollection:       getEnv("MONGO_PHONE_COLLECTION", "phones"),
+		MongoStationCollection:     getEnv("MONGO_STATION_COLLECTION", "stations"),
+		MongoScheduleCollection:    getEnv("MONGO_SCHEDULE_COLLECTION", "station_schedules"),
+		MongoAreaCollection:        getEnv("MONGO_AREA_COLLECTION", "service_areas"),
+		MongoDestinationCollection: getEnv("MONGO_DESTINATION_COLLECTION", "destinations"),
+		MongoSurgeCollection:       getEnv("MONGO_SURGE_COLLECTION", "station_surges"),
+		MongoSurgeChangeCollection: getEnv("MONGO_SURGE_CHANGE_COLLECTION", "surge_changes"),
+		MongoVehicleCollection:     getEnv("MONGO_VEHICLE_COLLECTION", "vehicles"),
+		MongoRideCollection:        getEnv("MONGO_RIDE_COLLECTION", "ride_requests"),
+		MongoTripCollection:        getEnv("MONGO_TRIP_COLLECTION", "trips"),
+		MongoOutboxCollection:      getEnv("MONGO_OUTBOX_COLLECTION", "outbox"),
+		MongoLedgerCollection:      getEnv("MONGO_LEDGER_COLLECTION", "ledger_transactions"),
+		MongoAccountCollection:     getEnv("MONGO_ACCOUNT_COLLECTION", "ledger_accounts"),
 	}
 }
 
@@ -75,6 +230,75 @@ func Validate(cfg Config) error {
 	if cfg.HTTPAddr == "" {
 		errs = append(errs, errors.New("HTTP_ADDR is required"))
 	}
+	if !phone.SupportedRegion(cfg.DefaultPhoneRegion) {
+		errs = append(errs, fmt.Errorf("DEFAULT_PHONE_REGION %q is not supported", cfg.DefaultPhoneRegion))
+	}
+	if cfg.InactivityTimeout <= 0 {
+		errs = append(errs, errors.New("DRIVER_INACTIVITY_TIMEOUT must be positive"))
+	}
+	if cfg.MinDriverRating < 0 || cfg.MinDriverRating > 5 {
+		errs = append(errs, errors.New("MATCHING_MIN_DRIVER_RATING must be between 0 and 5"))
+	}
+	if cfg.MinDriverReliability < 0 || cfg.MinDriverReliability > 100 {
+		errs = append(errs, errors.New("MATCHING_MIN_DRIVER_RELIABILITY must be between 0 and 100"))
+	}
+	if cfg.NoShowInterval <= 0 || cfg.NoShowWait <= 0 || cfg.NoShowGeofenceMeters <= 0 {
+		errs = append(errs, errors.New("NO_SHOW_CHECK_INTERVAL, NO_SHOW_WAIT and NO_SHOW_GEOFENCE_METERS must be positive"))
+	}
+	if cfg.MaxDetourMeters < 0 {
+		errs = append(errs, errors.New("MATCHING_MAX_DETOUR_METERS must not be negative"))
+	}
+	if _, err := sequencing.ParseObjective(cfg.DropoffObjective); err != nil {
+		errs = append(errs, fmt.Errorf("MATCHING_DROPOFF_OBJECTIVE: %w", err))
+	}
+	if cfg.NoShowLimit < 0 {
+		errs = append(errs, errors.New("MATCHING_NO_SHOW_LIMIT must not be negative"))
+	}
+	if cfg.PickupPinTTL <= 0 || cfg.PickupPinMaxAttempts <= 0 {
+		errs = append(errs, errors.New("PICKUP_PIN_TTL and PICKUP_PIN_MAX_ATTEMPTS must be positive"))
+	}
+	if _, err := cfg.PricingRules(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.QuoteTTL <= 0 {
+		errs = append(errs, errors.New("QUOTE_TTL must be positive"))
+	}
+	if cfg.OutboxRetention < time.Second {
+		errs = append(errs, errors.New("OUTBOX_RETENTION must be at least 1s"))
+	}
+	// The station service signs quotes and the rider service verifies them,
+	// so a per-process key would reject every quote.
+	if (cfg.ServiceName == "station" || cfg.ServiceName == "rider") && cfg.QuoteTokenSecret == "" {
+		errs = append(errs, fmt.Errorf("QUOTE_TOKEN_SECRET is required for the %s service", cfg.ServiceName))
+	}
+	if cfg.Replicas < 1 {
+		errs = append(errs, errors.New("SERVICE_REPLICAS must be at least 1"))
+	}
+	// Page tokens from one replica must verify on the others.
+	if cfg.Replicas > 1 && cfg.PageTokenSecret == "" {
+		errs = append(errs, errors.New("PAGE_TOKEN_SECRET is required when SERVICE_REPLICAS is above 1"))
+	}
+	if cfg.SurgeInterval <= 0 || cfg.SurgeWindow <= 0 {
+		errs = append(errs, errors.New("SURGE_INTERVAL and SURGE_WINDOW must be positive"))
+	}
+	if cfg.SurgeRadiusMeters <= 0 || cfg.SurgeSensitivity <= 0 {
+		errs = append(errs, errors.New("SURGE_RADIUS_METERS and SURGE_SENSITIVITY must be positive"))
+	}
+	if cfg.SurgeMax < 1 {
+		errs = append(errs, errors.New("SURGE_MAX_MULTIPLIER must be at least 1"))
+	}
+	if cfg.PaymentCommission < 0 || cfg.PaymentCommission >= 1 {
+		errs = append(errs, errors.New("PAYMENT_COMMISSION must be in [0, 1)"))
+	}
+	if cfg.CancelFreeWindow < 0 || cfg.CancelFee < 0 {
+		errs = append(errs, errors.New("CANCEL_FREE_WINDOW and CANCEL_FEE must not be negative"))
+	}
+	if cfg.DriverCancelPenalty <= 0 || cfg.DriverCancelPenalty > 100 {
+		errs = append(errs, errors.New("DRIVER_CANCEL_PENALTY must be in (0, 100]"))
+	}
+	if _, err := cfg.EtaProfile(); err != nil {
+		errs = append(errs, err)
+	}
 	if cfg.Mongo.URI == "" {
 		// optional for now; no validation
 	}
@@ -87,6 +311,76 @@ func Validate(cfg Config) error {
 	return nil
 }
 
+// PricingRules builds the fare rules from the PRICING_* settings.
+func (cfg Config) PricingRules() (fare.Rules, error) {
+	if cfg.PricingBaseFare < 0 || cfg.PricingPerKm < 0 {
+		return fare.Rules{}, errors.New("PRICING_BASE_FARE and PRICING_PER_KM must not be negative")
+	}
+	if cfg.PricingSharedDiscount < 0 || cfg.PricingSharedDiscount >= 1 {
+		return fare.Rules{}, errors.New("PRICING_SHARED_DISCOUNT must be in [0, 1)")
+	}
+	peaks, err := fare.ParsePeakWindows(cfg.PricingPeakWindows)
+	if err != nil {
+		return fare.Rules{}, fmt.Errorf("PRICING_PEAK_WINDOWS: %w", err)
+	}
+	location, err := time.LoadLocation(cfg.PricingTimezone)
+	if err != nil {
+		return fare.Rules{}, fmt.Errorf("PRICING_TIMEZONE %q is not a known time zone", cfg.PricingTimezone)
+	}
+	return fare.Rules{
+		Currency:       cfg.PricingCurrency,
+		BaseFare:       cfg.PricingBaseFare,
+		PerKm:          cfg.PricingPerKm,
+		SharedDiscount: cfg.PricingSharedDiscount,
+		Peaks:          peaks,
+		Location:       location,
+	}, nil
+}
+
+// EtaProfile builds the ETA speed profile from the ETA_* settings. Speed
+// windows use the PRICING_PEAK_WINDOWS format with a speed factor, e.g.
+// 08:00-10:00=0.6 for rush hour.
+func (cfg Config) EtaProfile() (eta.Profile, error) {
+	speeds, err := eta.ParseSpeeds(cfg.EtaSpeeds)
+	if err != nil {
+		return eta.Profile{}, fmt.Errorf("ETA_SPEEDS: %w", err)
+	}
+	if cfg.EtaDefaultSpeed <= 0 {
+		return eta.Profile{}, errors.New("ETA_DEFAULT_SPEED must be positive")
+	}
+	if cfg.EtaDetourFactor < 1 {
+		return eta.Profile{}, errors.New("ETA_DETOUR_FACTOR must be at least 1")
+	}
+	// Rush hour slows traffic, so factors below 1 are allowed here.
+	peaks, err := fare.ParseWindows(cfg.EtaSpeedWindows)
+	if err != nil {
+		return eta.Profile{}, fmt.Errorf("ETA_SPEED_WINDOWS: %w", err)
+	}
+	windows := make([]eta.Window, 0, len(peaks))
+	for _, peak := range peaks {
+		windows = append(windows, eta.Window{Start: peak.Start, End: peak.End, Factor: peak.Multiplier})
+	}
+	location, err := time.LoadLocation(cfg.EtaTimezone)
+	if err != nil {
+		return eta.Profile{}, fmt.Errorf("ETA_TIMEZONE %q is not a known time zone", cfg.EtaTimezone)
+	}
+	return eta.Profile{
+		SpeedsKmh:    speeds,
+		DefaultKmh:   cfg.EtaDefaultSpeed,
+		Windows:      windows,
+		Location:     location,
+		DetourFactor: cfg.EtaDetourFactor,
+	}, nil
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "local"
+	}
+	return name
+}
+
 func getEnv(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -119,6 +413,18 @@ func getEnvInt(key string, fallback int) int {
 	return parsed
 }
 
+func getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
 func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	value := os.Getenv(key)
 	if value == "" {
@@ -132,7 +438,7 @@ func getEnvDuration(key string, fallback time.Duration) time.Duration {
 }
 
 func FormatConfig(cfg Config) string {
-	return fmt.Sprintf("grpc_listen=%s grpc_endpoint=%s http_addr=%s otel_endpoint=%s otel_insecure=%t log_level=%s user_store=%s station_store=%s mongo_uri_set=%t redis_addr_set=%t",
+	return fmt.Sprintf("grpc_listen=%s grpc_endpoint=%s http_addr=%s otel_endpoint=%s otel_insecure=%t log_level=%s user_store=%s station_store=%s ride_store=%s trip_store=%s shift_store=%s seat_store=%s payment_store=%s event_bus=%s mongo_uri_set=%t redis_addr_set=%t",
 		cfg.GRPCListenAddr,
 		cfg.GRPCEndpoint,
 		cfg.HTTPAddr,
@@ -141,6 +447,12 @@ func FormatConfig(cfg Config) string {
 		cfg.LogLevel,
 		cfg.UserStoreBackend,
 		cfg.StationStoreBackend,
+		cfg.RideStoreBackend,
+		cfg.TripStoreBackend,
+		cfg.ShiftStoreBackend,
+		cfg.SeatStoreBackend,
+		cfg.PaymentStoreBackend,
+		cfg.EventBusBackend,
 		cfg.Mongo.URI != "",
 		cfg.Redis.Addr != "",
 	)
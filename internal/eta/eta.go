@@ -0,0 +1,144 @@
+// Package eta estimates travel times between two points. The straight-line
+// estimator here is the fallback; a road-graph estimator can implement the
+// same interface.
+package eta
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+// Estimator estimates how far and how long a vehicle of the given type
+// travels from one point to another when leaving at departure.
+type Estimator interface {
+	Estimate(ctx context.Context, from, to *lastmilev1.LatLng, vehicle lastmilev1.VehicleType, departure time.Time) (Estimate, error)
+}
+
+type Estimate struct {
+	DistanceMeters float64
+	Duration       time.Duration
+	// Polyline is the route in the Google encoded polyline format, when the
+	// estimator follows roads.
+	Polyline string
+}
+
+// Profile holds the speeds estimates are based on.
+type Profile struct {
+	// SpeedsKmh is the average speed per vehicle type; types missing from it
+	// use DefaultKmh.
+	SpeedsKmh  map[lastmilev1.VehicleType]float64
+	DefaultKmh float64
+	// Windows scale speeds during parts of the day, e.g. 0.6 in rush hour.
+	Windows []Window
+	// Location is the time zone windows are read in; nil means UTC.
+	Location *time.Location
+	// DetourFactor stretches the straight-line distance towards the road
+	// distance; values below 1 are treated as 1.
+	DetourFactor float64
+}
+
+// Window scales speeds from Start to End, both offsets from local midnight.
+// End before Start wraps past midnight.
+type Window struct {
+	Start  time.Duration
+	End    time.Duration
+	Factor float64
+}
+
+// SpeedKmh returns the speed of vehicle at time at.
+func (p Profile) SpeedKmh(vehicle lastmilev1.VehicleType, at time.Time) float64 {
+	return p.BaseKmh(vehicle) * p.Factor(at)
+}
+
+// BaseKmh returns the vehicle's speed outside any window.
+func (p Profile) BaseKmh(vehicle lastmilev1.VehicleType) float64 {
+	if speed, ok := p.SpeedsKmh[vehicle]; ok && speed > 0 {
+		return speed
+	}
+	return p.DefaultKmh
+}
+
+// Factor returns the lowest factor of the windows covering at, or 1.
+func (p Profile) Factor(at time.Time) float64 {
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := at.In(loc)
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+	factor := math.Inf(1)
+	for _, window := range p.Windows {
+		in := offset >= window.Start && offset < window.End
+		if window.End < window.Start {
+			in = offset >= window.Start || offset < window.End
+		}
+		if in {
+			factor = min(factor, window.Factor)
+		}
+	}
+	if math.IsInf(factor, 1) {
+		return 1
+	}
+	return factor
+}
+
+// Haversine estimates over the great-circle distance, stretched by the
+// profile's detour factor, at the profile's speed for the departure time.
+type Haversine struct {
+	Profile Profile
+}
+
+func (h Haversine) Estimate(_ context.Context, from, to *lastmilev1.LatLng, vehicle lastmilev1.VehicleType, departure time.Time) (Estimate, error) {
+	if from == nil || to == nil {
+		return Estimate{}, fmt.Errorf("from and to are required")
+	}
+	distance := HaversineMeters(from, to) * max(h.Profile.DetourFactor, 1)
+	speed := h.Profile.SpeedKmh(vehicle, departure)
+	if speed <= 0 {
+		return Estimate{}, fmt.Errorf("no speed for %s", vehicle)
+	}
+	seconds := distance / (speed * 1000 / 3600)
+	return Estimate{DistanceMeters: distance, Duration: time.Duration(math.Round(seconds)) * time.Second}, nil
+}
+
+func HaversineMeters(a, b *lastmilev1.LatLng) float64 {
+	const earthRadiusMeters = 6371000
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// ParseSpeeds reads a comma separated list of type=km/h entries, where type
+// is a VehicleType name without its prefix, e.g. "e_rickshaw=15,cab=28".
+func ParseSpeeds(value string) (map[lastmilev1.VehicleType]float64, error) {
+	speeds := make(map[lastmilev1.VehicleType]float64)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, kmh, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("speed %q: expected type=km/h", entry)
+		}
+		vehicle, ok := lastmilev1.VehicleType_value["VEHICLE_TYPE_"+strings.ToUpper(strings.TrimSpace(name))]
+		if !ok || vehicle == 0 {
+			return nil, fmt.Errorf("speed %q: unknown vehicle type", entry)
+		}
+		speed, err := strconv.ParseFloat(strings.TrimSpace(kmh), 64)
+		if err != nil || speed <= 0 || math.IsInf(speed, 0) {
+			return nil, fmt.Errorf("speed %q: km/h must be a positive number", entry)
+		}
+		speeds[lastmilev1.VehicleType(vehicle)] = speed
+	}
+	return speeds, nil
+}
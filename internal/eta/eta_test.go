@@ -0,0 +1,53 @@
+package eta
+
+import (
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+func TestSpeedKmh(t *testing.T) {
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	profile := Profile{
+		SpeedsKmh:  map[lastmilev1.VehicleType]float64{lastmilev1.VehicleType_VEHICLE_TYPE_CAB: 30},
+		DefaultKmh: 20,
+		Windows: []Window{
+			{Start: 8 * time.Hour, End: 11 * time.Hour, Factor: 0.6},
+			{Start: 9 * time.Hour, End: 10 * time.Hour, Factor: 0.5},
+			{Start: 23 * time.Hour, End: 5 * time.Hour, Factor: 1.25},
+		},
+		Location: kolkata,
+	}
+	cases := []struct {
+		vehicle lastmilev1.VehicleType
+		local   time.Time
+		want    float64
+	}{
+		{lastmilev1.VehicleType_VEHICLE_TYPE_CAB, time.Date(2026, 3, 2, 7, 59, 0, 0, kolkata), 30},
+		{lastmilev1.VehicleType_VEHICLE_TYPE_CAB, time.Date(2026, 3, 2, 8, 0, 0, 0, kolkata), 18},
+		{lastmilev1.VehicleType_VEHICLE_TYPE_CAB, time.Date(2026, 3, 2, 9, 30, 0, 0, kolkata), 15},
+		{lastmilev1.VehicleType_VEHICLE_TYPE_E_RICKSHAW, time.Date(2026, 3, 2, 12, 0, 0, 0, kolkata), 20},
+		{lastmilev1.VehicleType_VEHICLE_TYPE_E_RICKSHAW, time.Date(2026, 3, 3, 1, 0, 0, 0, kolkata), 25},
+	}
+	for _, tc := range cases {
+		if got := profile.SpeedKmh(tc.vehicle, tc.local.UTC()); got != tc.want {
+			t.Errorf("SpeedKmh(%s, %s) = %v, want %v", tc.vehicle, tc.local.Format("15:04"), got, tc.want)
+		}
+	}
+}
+
+func TestParseSpeeds(t *testing.T) {
+	speeds, err := ParseSpeeds(" e_rickshaw=15, CAB=28.5 ,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(speeds) != 2 || speeds[lastmilev1.VehicleType_VEHICLE_TYPE_E_RICKSHAW] != 15 || speeds[lastmilev1.VehicleType_VEHICLE_TYPE_CAB] != 28.5 {
+		t.Fatalf("unexpected speeds: %v", speeds)
+	}
+	for _, bad := range []string{"cab", "bus=20", "unspecified=20", "cab=0", "cab=fast"} {
+		if _, err := ParseSpeeds(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	CloudEventsSpecVersion     = "1.0"
+	CloudEventsJSONContentType = "application/cloudevents+json"
+	CloudEventsDataContentType = "application/json"
+)
+
+var ErrInvalidCloudEvent = errors.New("invalid cloud event")
+
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+func ToCloudEvent(source string, event *lastmilev1.Event) (*CloudEvent, error) {
+	if source == "" || event.GetId() == "" || event.GetType() == "" || event.GetPayload() == nil {
+		return nil, ErrInvalidCloudEvent
+	}
+	payload, err := event.GetPayload().UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+	data, err := protojson.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	ce := &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              event.GetId(),
+		Source:          source,
+		Type:            event.GetType(),
+		Subject:         eventSubject(payload),
+		DataContentType: CloudEventsDataContentType,
+		Data:            data,
+	}
+	if event.GetOccurredAt() != nil {
+		ce.Time = event.GetOccurredAt().AsTime().UTC().Format(time.RFC3339Nano)
+	}
+	return ce, nil
+}
+
+func (ce *CloudEvent) Validate() error {
+	if ce == nil || ce.SpecVersion != CloudEventsSpecVersion || ce.ID == "" || ce.Source == "" || ce.Type == "" {
+		return ErrInvalidCloudEvent
+	}
+	return nil
+}
+
+func (ce *CloudEvent) MarshalStructured() ([]byte, error) {
+	if err := ce.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(ce)
+}
+
+func NewStructuredRequest(ctx context.Context, url string, ce *CloudEvent) (*http.Request, error) {
+	body, err := ce.MarshalStructured()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", CloudEventsJSONContentType)
+	return req, nil
+}
+
+func NewBinaryRequest(ctx context.Context, url string, ce *CloudEvent) (*http.Request, error) {
+	if err := ce.Validate(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(ce.Data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("ce-specversion", ce.SpecVersion)
+	req.Header.Set("ce-id", ce.ID)
+	req.Header.Set("ce-source", ce.Source)
+	req.Header.Set("ce-type", ce.Type)
+	if ce.Subject != "" {
+		req.Header.Set("ce-subject", ce.Subject)
+	}
+	if ce.Time != "" {
+		req.Header.Set("ce-time", ce.Time)
+	}
+	if ce.DataContentType != "" {
+		req.Header.Set("Content-Type", ce.DataContentType)
+	}
+	return req, nil
+}
+
+func eventSubject(payload any) string {
+	switch msg := payload.(type) {
+	case *lastmilev1.RideRequest:
+		return msg.GetRequestId()
+	case *lastmilev1.Trip:
+		return msg.GetTripId()
+	case *lastmilev1.MatchRun:
+		return msg.GetMatchId()
+	case *lastmilev1.LocationUpdate:
+		return msg.GetDriverId()
+	}
+	return ""
+}
+
+func cloudEventSource(base, stream string) string {
+	return strings.TrimRight(base, "/") + "/" + stream
+}
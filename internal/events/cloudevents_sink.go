@@ -0,0 +1,264 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+)
+
+const (
+	HTTPModeBinary     = "binary"
+	HTTPModeStructured = "structured"
+)
+
+type CloudEventSink interface {
+	Send(ctx context.Context, event *CloudEvent) error
+	Close() error
+}
+
+type HTTPSink struct {
+	client *http.Client
+	url    string
+	mode   string
+}
+
+func NewHTTPSink(url, mode string, timeout time.Duration) (*HTTPSink, error) {
+	if strings.TrimSpace(url) == "" {
+		return nil, errors.New("cloud events http url is required")
+	}
+	switch mode {
+	case "":
+		mode = HTTPModeBinary
+	case HTTPModeBinary, HTTPModeStructured:
+	default:
+		return nil, fmt.Errorf("unsupported cloud events http mode %q", mode)
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &HTTPSink{client: &http.Client{Timeout: timeout}, url: url, mode: mode}, nil
+}
+
+func (s *HTTPSink) Send(ctx context.Context, event *CloudEvent) error {
+	var req *http.Request
+	var err error
+	if s.mode == HTTPModeStructured {
+		req, err = NewStructuredRequest(ctx, s.url, event)
+	} else {
+		req, err = NewBinaryRequest(ctx, s.url, event)
+	}
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("cloud events sink returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *HTTPSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+const segmentTimeLayout = "20060102T150405.000000000Z"
+
+type FileSink struct {
+	mu       sync.Mutex
+	dir      string
+	prefix   string
+	maxBytes int64
+	maxAge   time.Duration
+	now      func() time.Time
+
+	file     *os.File
+	path     string
+	size     int64
+	openedAt time.Time
+	timer    *time.Timer
+}
+
+// NewFileSink writes segments named <prefix>-<utc timestamp>.ndjson. Sinks
+// sharing a directory must use distinct prefixes: on start a sink finalizes
+// any segment left open under its own prefix.
+func NewFileSink(dir, prefix string, maxBytes int64, maxAge time.Duration) (*FileSink, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, errors.New("cloud events file dir is required")
+	}
+	if prefix == "" {
+		prefix = "events"
+	}
+	if strings.ContainsAny(prefix, `/\`) || prefix == "." || prefix == ".." {
+		return nil, fmt.Errorf("invalid cloud events file prefix %q", prefix)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	if maxAge <= 0 {
+		maxAge = time.Hour
+	}
+	if err := recoverOpenSegments(dir, prefix); err != nil {
+		return nil, err
+	}
+	return &FileSink{dir: dir, prefix: prefix, maxBytes: maxBytes, maxAge: maxAge, now: time.Now}, nil
+}
+
+// recoverOpenSegments finalizes segments left open by a crash or a failed
+// roll so consumers that only read finished files still pick them up.
+func recoverOpenSegments(dir, prefix string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, prefix+"-*.ndjson.open"))
+	if err != nil {
+		return err
+	}
+	for _, open := range paths {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(open), prefix+"-"), ".ndjson.open")
+		if _, err := time.Parse(segmentTimeLayout, stamp); err != nil {
+			// Another sink whose prefix starts with ours.
+			continue
+		}
+		info, err := os.Stat(open)
+		if err != nil {
+			return err
+		}
+		if info.Size() == 0 {
+			err = os.Remove(open)
+		} else {
+			err = os.Rename(open, strings.TrimSuffix(open, ".open"))
+		}
+		if err != nil {
+			return fmt.Errorf("recover cloud events segment %s: %w", open, err)
+		}
+	}
+	return nil
+}
+
+// Send returns once the event is synced to disk, so acked events survive a
+// host crash.
+func (s *FileSink) Send(_ context.Context, event *CloudEvent) error {
+	line, err := event.MarshalStructured()
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil && (s.size+int64(len(line)) > s.maxBytes || s.now().Sub(s.openedAt) >= s.maxAge) {
+		if err := s.roll(); err != nil {
+			return err
+		}
+	}
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.roll()
+}
+
+func (s *FileSink) open() error {
+	now := s.now().UTC()
+	name := fmt.Sprintf("%s-%s.ndjson", s.prefix, now.Format(segmentTimeLayout))
+	path := filepath.Join(s.dir, name)
+	file, err := os.OpenFile(path+".open", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.path = path
+	s.size = 0
+	s.openedAt = now
+	// Quiet streams still get their segment finalized once it is maxAge old.
+	s.timer = time.AfterFunc(s.maxAge, func() { s.expire(file) })
+	return nil
+}
+
+func (s *FileSink) expire(file *os.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != file {
+		return
+	}
+	if err := s.roll(); err != nil {
+		logger := observability.Logger()
+		logger.Error().Err(err).Str("segment", s.path).Msg("cloud events segment roll failed")
+	}
+}
+
+func (s *FileSink) roll() error {
+	file, path := s.file, s.path
+	s.file = nil
+	s.timer.Stop()
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if s.size == 0 {
+		return os.Remove(path + ".open")
+	}
+	return os.Rename(path+".open", path)
+}
+
+type CloudEventExporter struct {
+	source string
+	sink   CloudEventSink
+}
+
+func NewCloudEventExporter(source string, sink CloudEventSink) *CloudEventExporter {
+	if source == "" {
+		source = "/lastmile"
+	}
+	return &CloudEventExporter{source: source, sink: sink}
+}
+
+func (e *CloudEventExporter) Handler(stream string) Handler {
+	source := cloudEventSource(e.source, stream)
+	return func(ctx context.Context, event *lastmilev1.Event) error {
+		ce, err := ToCloudEvent(source, event)
+		if err != nil {
+			if errors.Is(err, ErrInvalidCloudEvent) {
+				logger := observability.Logger()
+				logger.Warn().Str("event_id", event.GetId()).Str("stream", stream).Msg("skipping event that cannot be exported")
+				return nil
+			}
+			return err
+		}
+		return e.sink.Send(ctx, ce)
+	}
+}
@@ -0,0 +1,218 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+func TestToCloudEventStructured(t *testing.T) {
+	event, err := New(TypeTripCreated, &lastmilev1.Trip{TripId: "t1", RiderId: "r1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ce, err := ToCloudEvent("/lastmile/trips", event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err := ce.MarshalStructured()
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("unexpected decode error: %v", err)
+	}
+	for key, want := range map[string]string{
+		"specversion":     "1.0",
+		"id":              event.Id,
+		"source":          "/lastmile/trips",
+		"type":            TypeTripCreated,
+		"subject":         "t1",
+		"datacontenttype": "application/json",
+	} {
+		if decoded[key] != want {
+			t.Fatalf("expected %s=%q, got %v", key, want, decoded[key])
+		}
+	}
+	data, ok := decoded["data"].(map[string]any)
+	if !ok || data["tripId"] != "t1" {
+		t.Fatalf("expected trip payload as data, got %v", decoded["data"])
+	}
+}
+
+func TestHTTPSinkBinaryMode(t *testing.T) {
+	var headers http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink, err := NewHTTPSink(server.URL, HTTPModeBinary, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sink.Close()
+	event, _ := New(TypeRideRequestCreated, &lastmilev1.RideRequest{RequestId: "req-1"})
+	ce, err := ToCloudEvent("/lastmile/ride_requests", event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sink.Send(context.Background(), ce); err != nil {
+		t.Fatalf("unexpected send error: %v", err)
+	}
+
+	if headers.Get("ce-specversion") != "1.0" || headers.Get("ce-id") != event.Id || headers.Get("ce-type") != TypeRideRequestCreated {
+		t.Fatalf("missing ce headers: %v", headers)
+	}
+	if headers.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected json content type, got %q", headers.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), `"requestId":"req-1"`) {
+		t.Fatalf("expected payload as body, got %s", body)
+	}
+}
+
+func TestHTTPSinkRejectsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != CloudEventsJSONContentType {
+			t.Errorf("expected structured content type, got %q", r.Header.Get("Content-Type"))
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := NewHTTPSink(server.URL, HTTPModeStructured, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	event, _ := New(TypeTripCreated, &lastmilev1.Trip{TripId: "t1"})
+	ce, _ := ToCloudEvent("/lastmile/trips", event)
+	if err := sink.Send(context.Background(), ce); err == nil {
+		t.Fatalf("expected error for 503 response")
+	}
+}
+
+func TestFileSinkRollsBySize(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(dir, "trips", 400, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		event, _ := New(TypeTripCreated, &lastmilev1.Trip{TripId: "trip-with-a-long-enough-identifier"})
+		ce, _ := ToCloudEvent("/lastmile/trips", event)
+		if err := sink.Send(context.Background(), ce); err != nil {
+			t.Fatalf("unexpected send error: %v", err)
+		}
+	}
+
+	open, _ := filepath.Glob(filepath.Join(dir, "*.open"))
+	if len(open) != 1 {
+		t.Fatalf("expected one active file, got %v", open)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "trips-*.ndjson"))
+	if len(files) < 2 {
+		t.Fatalf("expected rolled files, got %v", files)
+	}
+	lines := 0
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("unexpected open error: %v", err)
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var ce CloudEvent
+			if err := json.Unmarshal(scanner.Bytes(), &ce); err != nil {
+				t.Fatalf("invalid ndjson line: %v", err)
+			}
+			lines++
+		}
+		file.Close()
+	}
+	if lines != 4 {
+		t.Fatalf("expected 4 events across files, got %d", lines)
+	}
+}
+
+func TestFileSinkFinalizesLeftoverOpenSegments(t *testing.T) {
+	dir := t.TempDir()
+	leftover := filepath.Join(dir, "trips-20240101T000000.000000000Z.ndjson")
+	if err := os.WriteFile(leftover+".open", []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+	empty := filepath.Join(dir, "trips-20240101T000001.000000000Z.ndjson")
+	if err := os.WriteFile(empty+".open", nil, 0o644); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	other := filepath.Join(dir, "trips-b-20240101T000002.000000000Z.ndjson.open")
+	if err := os.WriteFile(other, []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	sink, err := NewFileSink(dir, "trips", 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sink.Close()
+
+	if _, err := os.Stat(leftover); err != nil {
+		t.Fatalf("expected leftover segment to be finalized: %v", err)
+	}
+	open, _ := filepath.Glob(filepath.Join(dir, "*.open"))
+	if len(open) != 1 || open[0] != other {
+		t.Fatalf("expected only the other sink's segment to stay open, got %v", open)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "trips-*.ndjson"))
+	if len(files) != 1 {
+		t.Fatalf("expected empty segment to be removed, got %v", files)
+	}
+}
+
+func TestFileSinkRollsQuietSegmentsByAge(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(dir, "trips", 0, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sink.Close()
+	event, _ := New(TypeTripCreated, &lastmilev1.Trip{TripId: "t1"})
+	ce, _ := ToCloudEvent("/lastmile/trips", event)
+	if err := sink.Send(context.Background(), ce); err != nil {
+		t.Fatalf("unexpected send error: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		files, _ := filepath.Glob(filepath.Join(dir, "trips-*.ndjson"))
+		if len(files) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the idle segment to be finalized, got %v", files)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if open, _ := filepath.Glob(filepath.Join(dir, "*.open")); len(open) != 0 {
+		t.Fatalf("expected no open segments, got %v", open)
+	}
+}
@@ -0,0 +1,128 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	StreamRideRequests = "ride_requests"
+	StreamTrips        = "trips"
+	StreamMatching     = "matching"
+	StreamLocations    = "locations"
+	// StreamPickupPins carries rider-only pickup PINs to notification. It is
+	// never exported.
+	StreamPickupPins = "pickup_pins"
+)
+
+const (
+	TypeRideRequestCreated       = "lastmile.ride_request.created"
+	TypeRideRequestStatusChanged = "lastmile.ride_request.status_changed"
+	TypeRideRequestRescheduled   = "lastmile.ride_request.rescheduled"
+	TypeTripCreated              = "lastmile.trip.created"
+	TypeTripStatusChanged        = "lastmile.trip.status_changed"
+	TypeTripRated                = "lastmile.trip.rated"
+	TypeMatchCompleted           = "lastmile.match.completed"
+	TypeDriverLocationUpdated    = "lastmile.driver_location.updated"
+	TypePickupPinIssued          = "lastmile.trip.pickup_pin_issued"
+)
+
+var (
+	ErrClosed       = errors.New("event bus closed")
+	ErrInvalidEvent = errors.New("invalid event")
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, stream string, event *lastmilev1.Event) error
+}
+
+type Handler func(ctx context.Context, event *lastmilev1.Event) error
+
+type ConsumerConfig struct {
+	Group        string
+	Consumer     string
+	BatchSize    int
+	Block        time.Duration
+	ClaimMinIdle time.Duration
+}
+
+type Consumer interface {
+	Subscribe(ctx context.Context, stream string, cfg ConsumerConfig, handler Handler) error
+}
+
+type Bus interface {
+	Publisher
+	Consumer
+	Close() error
+}
+
+func New(eventType string, payload proto.Message) (*lastmilev1.Event, error) {
+	if eventType == "" || payload == nil {
+		return nil, ErrInvalidEvent
+	}
+	// Trip events are exported and kept in shared streams, so the pickup PIN
+	// only travels in pickup_pin_issued.
+	if trip, ok := payload.(*lastmilev1.Trip); ok && trip.GetPickup().GetPin() != "" && eventType != TypePickupPinIssued {
+		trip = proto.Clone(trip).(*lastmilev1.Trip)
+		trip.Pickup.Pin = ""
+		payload = trip
+	}
+	packed, err := anypb.New(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.Event{
+		Id:         uuid.NewString(),
+		Type:       eventType,
+		OccurredAt: timestamppb.Now(),
+		Payload:    packed,
+	}, nil
+}
+
+func Publish(ctx context.Context, publisher Publisher, stream, eventType string, payload proto.Message) error {
+	if publisher == nil {
+		return nil
+	}
+	event, err := New(eventType, payload)
+	if err != nil {
+		return err
+	}
+	return publisher.Publish(ctx, stream, event)
+}
+
+func (c ConsumerConfig) withDefaults() ConsumerConfig {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 16
+	}
+	if c.Block <= 0 {
+		c.Block = 2 * time.Second
+	}
+	if c.ClaimMinIdle <= 0 {
+		c.ClaimMinIdle = 30 * time.Second
+	}
+	return c
+}
+
+func (c ConsumerConfig) validate() error {
+	if c.Group == "" || c.Consumer == "" {
+		return errors.New("consumer group and name are required")
+	}
+	return nil
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(context.Context, string, *lastmilev1.Event) error {
+	return nil
+}
+
+func Discard() Publisher {
+	return discardPublisher{}
+}
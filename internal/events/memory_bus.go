@@ -0,0 +1,201 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"google.golang.org/protobuf/proto"
+)
+
+type MemoryBus struct {
+	mu      sync.Mutex
+	streams map[string]*memoryStream
+	notify  chan struct{}
+	closed  bool
+	now     func() time.Time
+}
+
+type memoryStream struct {
+	entries []memoryEntry
+	groups  map[string]*memoryGroup
+}
+
+type memoryEntry struct {
+	id    string
+	event *lastmilev1.Event
+}
+
+type memoryGroup struct {
+	next    int
+	pending map[int]*memoryPending
+}
+
+type memoryPending struct {
+	consumer    string
+	deliveredAt time.Time
+	deliveries  int
+}
+
+type memoryDelivery struct {
+	index int
+	id    string
+	event *lastmilev1.Event
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		streams: make(map[string]*memoryStream),
+		notify:  make(chan struct{}),
+		now:     time.Now,
+	}
+}
+
+func (b *MemoryBus) Publish(_ context.Context, stream string, event *lastmilev1.Event) error {
+	if stream == "" || event == nil {
+		return ErrInvalidEvent
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	s := b.stream(stream)
+	id := strconv.Itoa(len(s.entries) + 1)
+	s.entries = append(s.entries, memoryEntry{id: id, event: proto.Clone(event).(*lastmilev1.Event)})
+	close(b.notify)
+	b.notify = make(chan struct{})
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, stream string, cfg ConsumerConfig, handler Handler) error {
+	if stream == "" || handler == nil {
+		return ErrInvalidEvent
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	cfg = cfg.withDefaults()
+	logger := observability.Logger()
+
+	for {
+		batch, wait, err := b.fetch(stream, cfg)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range batch {
+			if err := handler(ctx, delivery.event); err != nil {
+				logger.Warn().Err(err).
+					Str("stream", stream).
+					Str("group", cfg.Group).
+					Str("event_id", delivery.event.GetId()).
+					Msg("event handler failed; leaving message pending")
+				continue
+			}
+			b.ack(stream, cfg.Group, delivery.index)
+		}
+		if len(batch) > 0 {
+			continue
+		}
+
+		timer := time.NewTimer(cfg.Block)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-wait:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (b *MemoryBus) Pending(stream, group string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.streams[stream]
+	if !ok {
+		return 0
+	}
+	g, ok := s.groups[group]
+	if !ok {
+		return 0
+	}
+	return len(g.pending)
+}
+
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.notify)
+	}
+	return nil
+}
+
+func (b *MemoryBus) fetch(stream string, cfg ConsumerConfig) ([]memoryDelivery, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, nil, ErrClosed
+	}
+	s := b.stream(stream)
+	g, ok := s.groups[cfg.Group]
+	if !ok {
+		g = &memoryGroup{pending: make(map[int]*memoryPending)}
+		s.groups[cfg.Group] = g
+	}
+
+	now := b.now()
+	batch := make([]memoryDelivery, 0, cfg.BatchSize)
+	for index, p := range g.pending {
+		if len(batch) >= cfg.BatchSize {
+			break
+		}
+		if now.Sub(p.deliveredAt) < cfg.ClaimMinIdle {
+			continue
+		}
+		p.consumer = cfg.Consumer
+		p.deliveredAt = now
+		p.deliveries++
+		batch = append(batch, s.delivery(index))
+	}
+	for len(batch) < cfg.BatchSize && g.next < len(s.entries) {
+		g.pending[g.next] = &memoryPending{consumer: cfg.Consumer, deliveredAt: now, deliveries: 1}
+		batch = append(batch, s.delivery(g.next))
+		g.next++
+	}
+	return batch, b.notify, nil
+}
+
+func (b *MemoryBus) ack(stream, group string, index int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s, ok := b.streams[stream]; ok {
+		if g, ok := s.groups[group]; ok {
+			delete(g.pending, index)
+		}
+	}
+}
+
+func (b *MemoryBus) stream(name string) *memoryStream {
+	s, ok := b.streams[name]
+	if !ok {
+		s = &memoryStream{groups: make(map[string]*memoryGroup)}
+		b.streams[name] = s
+	}
+	return s
+}
+
+func (s *memoryStream) delivery(index int) memoryDelivery {
+	entry := s.entries[index]
+	return memoryDelivery{
+		index: index,
+		id:    entry.id,
+		event: proto.Clone(entry.event).(*lastmilev1.Event),
+	}
+}
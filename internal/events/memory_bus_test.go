@@ -0,0 +1,149 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+func TestMemoryBusDeliversToEachGroup(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	for _, id := range []string{"t1", "t2"} {
+		if err := Publish(ctx, bus, StreamTrips, TypeTripCreated, &lastmilev1.Trip{TripId: id}); err != nil {
+			t.Fatalf("unexpected publish error: %v", err)
+		}
+	}
+
+	for _, group := range []string{"notification", "analytics"} {
+		got := collect(t, ctx, bus, ConsumerConfig{Group: group, Consumer: "c1"}, 2, nil)
+		if got[0] != "t1" || got[1] != "t2" {
+			t.Fatalf("group %s: unexpected order %v", group, got)
+		}
+		if pending := bus.Pending(StreamTrips, group); pending != 0 {
+			t.Fatalf("group %s: expected no pending messages, got %d", group, pending)
+		}
+	}
+}
+
+func TestMemoryBusRedeliversUnackedMessages(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := Publish(ctx, bus, StreamTrips, TypeTripCreated, &lastmilev1.Trip{TripId: "t1"}); err != nil {
+		t.Fatalf("unexpected publish error: %v", err)
+	}
+
+	cfg := ConsumerConfig{Group: "notification", Consumer: "c1", Block: 10 * time.Millisecond, ClaimMinIdle: 20 * time.Millisecond}
+	var mu sync.Mutex
+	attempts := 0
+	fail := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			return errors.New("transient")
+		}
+		return nil
+	}
+	got := collect(t, ctx, bus, cfg, 1, fail)
+	if got[0] != "t1" {
+		t.Fatalf("unexpected delivery %v", got)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected redelivery after failure, got %d attempts", attempts)
+	}
+	if pending := bus.Pending(StreamTrips, "notification"); pending != 0 {
+		t.Fatalf("expected no pending messages, got %d", pending)
+	}
+}
+
+func TestMemoryBusClaimsFromStalledConsumer(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := Publish(ctx, bus, StreamTrips, TypeTripCreated, &lastmilev1.Trip{TripId: "t1"}); err != nil {
+		t.Fatalf("unexpected publish error: %v", err)
+	}
+	stalled := ConsumerConfig{Group: "notification", Consumer: "stalled", ClaimMinIdle: 20 * time.Millisecond}
+	if _, _, err := bus.fetch(StreamTrips, stalled.withDefaults()); err != nil {
+		t.Fatalf("unexpected fetch error: %v", err)
+	}
+	if pending := bus.Pending(StreamTrips, "notification"); pending != 1 {
+		t.Fatalf("expected one pending message, got %d", pending)
+	}
+
+	healthy := ConsumerConfig{Group: "notification", Consumer: "healthy", Block: 10 * time.Millisecond, ClaimMinIdle: 20 * time.Millisecond}
+	got := collect(t, ctx, bus, healthy, 1, nil)
+	if got[0] != "t1" {
+		t.Fatalf("unexpected delivery %v", got)
+	}
+}
+
+func TestPublishValidation(t *testing.T) {
+	bus := NewMemoryBus()
+	if err := bus.Publish(context.Background(), "", &lastmilev1.Event{}); !errors.Is(err, ErrInvalidEvent) {
+		t.Fatalf("expected ErrInvalidEvent, got %v", err)
+	}
+	if _, err := New("", &lastmilev1.Trip{}); !errors.Is(err, ErrInvalidEvent) {
+		t.Fatalf("expected ErrInvalidEvent, got %v", err)
+	}
+	_ = bus.Close()
+	if err := Publish(context.Background(), bus, StreamTrips, TypeTripCreated, &lastmilev1.Trip{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func collect(t *testing.T, ctx context.Context, bus *MemoryBus, cfg ConsumerConfig, want int, hook func() error) []string {
+	t.Helper()
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var got []string
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		_ = bus.Subscribe(subCtx, StreamTrips, cfg, func(_ context.Context, event *lastmilev1.Event) error {
+			if hook != nil {
+				if err := hook(); err != nil {
+					return err
+				}
+			}
+			var trip lastmilev1.Trip
+			if err := event.GetPayload().UnmarshalTo(&trip); err != nil {
+				return err
+			}
+			mu.Lock()
+			got = append(got, trip.TripId)
+			if len(got) == want {
+				close(done)
+			}
+			mu.Unlock()
+			return nil
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatalf("timed out waiting for %d events", want)
+	}
+	cancel()
+	<-exited
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string(nil), got...)
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/protobuf/proto"
+)
+
+type OutboxRelay struct {
+	outbox    storage.Outbox
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+}
+
+func NewOutboxMessage(stream, eventType string, payload proto.Message) (storage.OutboxMessage, error) {
+	event, err := New(eventType, payload)
+	if err != nil {
+		return storage.OutboxMessage{}, err
+	}
+	return storage.OutboxMessage{Stream: stream, Event: event}, nil
+}
+
+func NewOutboxRelay(outbox storage.Outbox, publisher Publisher, interval time.Duration, batchSize int) *OutboxRelay {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &OutboxRelay{
+		outbox:    outbox,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	logger := observability.Logger()
+	for {
+		relayed, err := r.RelayOnce(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error().Err(err).Int("relayed", relayed).Msg("outbox relay failed")
+		}
+		if err == nil && relayed == r.batchSize {
+			continue
+		}
+		timer := time.NewTimer(r.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	entries, err := r.outbox.ListPending(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	var publishErr error
+	for _, entry := range entries {
+		if err := r.publisher.Publish(ctx, entry.Stream, entry.Event); err != nil {
+			publishErr = err
+			break
+		}
+		published++
+	}
+	if published > 0 {
+		if err := r.outbox.MarkPublished(ctx, entries[:published]); err != nil {
+			return 0, err
+		}
+	}
+	return published, publishErr
+}
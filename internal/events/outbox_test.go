@@ -0,0 +1,66 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+)
+
+type flakyPublisher struct {
+	failAfter int
+	published []string
+}
+
+func (p *flakyPublisher) Publish(_ context.Context, _ string, event *lastmilev1.Event) error {
+	if len(p.published) >= p.failAfter {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, event.Id)
+	return nil
+}
+
+func TestOutboxRelayPublishesInOrder(t *testing.T) {
+	ctx := context.Background()
+	outbox := storage.NewMemoryOutbox()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		message, err := NewOutboxMessage(StreamTrips, TypeTripCreated, &lastmilev1.Trip{TripId: "t"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, message.Event.Id)
+		if err := outbox.Enqueue(ctx, message); err != nil {
+			t.Fatalf("unexpected enqueue error: %v", err)
+		}
+	}
+
+	publisher := &flakyPublisher{failAfter: 2}
+	relay := NewOutboxRelay(outbox, publisher, 0, 10)
+	relayed, err := relay.RelayOnce(ctx)
+	if err == nil {
+		t.Fatalf("expected publish failure")
+	}
+	if relayed != 2 {
+		t.Fatalf("expected 2 relayed before failure, got %d", relayed)
+	}
+	pending, _ := outbox.ListPending(ctx, 10)
+	if len(pending) != 1 || pending[0].Event.Id != ids[2] {
+		t.Fatalf("expected only the failed event to stay pending, got %v", pending)
+	}
+
+	publisher.failAfter = 10
+	if relayed, err := relay.RelayOnce(ctx); err != nil || relayed != 1 {
+		t.Fatalf("expected retry to relay 1, got %d (%v)", relayed, err)
+	}
+	for i, id := range ids {
+		if publisher.published[i] != id {
+			t.Fatalf("expected event %d to be %q, got %q", i, id, publisher.published[i])
+		}
+	}
+	if pending, _ := outbox.ListPending(ctx, 10); len(pending) != 0 {
+		t.Fatalf("expected empty outbox, got %d entries", len(pending))
+	}
+}
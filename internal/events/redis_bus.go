@@ -0,0 +1,175 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	redisEventField = "event"
+	redisTypeField  = "type"
+)
+
+type RedisBus struct {
+	client *redis.Client
+	prefix string
+	maxLen int64
+}
+
+func NewRedisBus(client *redis.Client, prefix string, maxLen int64) *RedisBus {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	return &RedisBus{client: client, prefix: prefix, maxLen: maxLen}
+}
+
+func (b *RedisBus) Publish(ctx context.Context, stream string, event *lastmilev1.Event) error {
+	if stream == "" || event == nil {
+		return ErrInvalidEvent
+	}
+	payload, err := proto.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.streamKey(stream),
+		MaxLen: b.maxLen,
+		Approx: b.maxLen > 0,
+		Values: []any{redisTypeField, event.Type, redisEventField, payload},
+	}).Err()
+}
+
+func (b *RedisBus) Subscribe(ctx context.Context, stream string, cfg ConsumerConfig, handler Handler) error {
+	if stream == "" || handler == nil {
+		return ErrInvalidEvent
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	cfg = cfg.withDefaults()
+	key := b.streamKey(stream)
+	logger := observability.Logger()
+
+	err := b.client.XGroupCreateMkStream(ctx, key, cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create consumer group: %w", err)
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		claimed, _, err := b.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   key,
+			Group:    cfg.Group,
+			Consumer: cfg.Consumer,
+			MinIdle:  cfg.ClaimMinIdle,
+			Start:    "0-0",
+			Count:    int64(cfg.BatchSize),
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error().Err(err).Str("stream", key).Msg("event claim failed")
+			sleep(ctx, time.Second)
+			continue
+		}
+		b.handle(ctx, key, cfg, claimed, handler)
+
+		streams, err := b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    cfg.Group,
+			Consumer: cfg.Consumer,
+			Streams:  []string{key, ">"},
+			Count:    int64(cfg.BatchSize),
+			Block:    cfg.Block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error().Err(err).Str("stream", key).Msg("event read failed")
+			sleep(ctx, time.Second)
+			continue
+		}
+		for _, s := range streams {
+			b.handle(ctx, key, cfg, s.Messages, handler)
+		}
+	}
+}
+
+func (b *RedisBus) Close() error {
+	return nil
+}
+
+func (b *RedisBus) handle(ctx context.Context, key string, cfg ConsumerConfig, messages []redis.XMessage, handler Handler) {
+	logger := observability.Logger()
+	for _, msg := range messages {
+		event, err := decodeRedisEvent(msg)
+		if err != nil {
+			logger.Error().Err(err).Str("stream", key).Str("message_id", msg.ID).Msg("dropping undecodable event")
+			_ = b.client.XAck(ctx, key, cfg.Group, msg.ID).Err()
+			continue
+		}
+		if err := handler(ctx, event); err != nil {
+			logger.Warn().Err(err).
+				Str("stream", key).
+				Str("group", cfg.Group).
+				Str("event_id", event.Id).
+				Msg("event handler failed; leaving message pending")
+			continue
+		}
+		if err := b.client.XAck(ctx, key, cfg.Group, msg.ID).Err(); err != nil {
+			logger.Error().Err(err).Str("stream", key).Str("message_id", msg.ID).Msg("event ack failed")
+		}
+	}
+}
+
+func (b *RedisBus) streamKey(stream string) string {
+	return fmt.Sprintf("%s:events:%s", b.prefix, stream)
+}
+
+func decodeRedisEvent(msg redis.XMessage) (*lastmilev1.Event, error) {
+	raw, ok := msg.Values[redisEventField]
+	if !ok {
+		return nil, ErrInvalidEvent
+	}
+	var data []byte
+	switch v := raw.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return nil, ErrInvalidEvent
+	}
+	var event lastmilev1.Event
+	if err := proto.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
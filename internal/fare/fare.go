@@ -0,0 +1,160 @@
+// Package fare prices rides from configurable rules and signs the resulting
+// quotes so the rider service can lock a price without calling back.
+package fare
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rules are the pricing knobs. Amounts are in the currency's minor unit.
+type Rules struct {
+	Currency string
+	BaseFare int64
+	PerKm    int64
+	// SharedDiscount is the fraction taken off shared rides, in [0, 1).
+	SharedDiscount float64
+	Peaks          []PeakWindow
+	// Location is the time zone peak windows are read in; nil means UTC.
+	Location *time.Location
+}
+
+// PeakWindow multiplies fares for pickups from Start to End, both offsets
+// from local midnight. End before Start wraps past midnight.
+type PeakWindow struct {
+	Start      time.Duration
+	End        time.Duration
+	Multiplier float64
+}
+
+// Fare is a priced ride. BaseFare and DistanceFare cover all seats.
+type Fare struct {
+	BaseFare        int64
+	DistanceFare    int64
+	SharedDiscount  int64
+	PeakMultiplier  float64
+	SurgeMultiplier float64
+	Total           int64
+}
+
+// surgeStep is the granularity surge multipliers are rounded to, so small
+// swings in the ratio do not change the price.
+const surgeStep = 0.05
+
+// Price computes the fare for seats over distanceMeters at pickup time at.
+func (r Rules) Price(distanceMeters float64, seats int, shared bool, at time.Time) Fare {
+	seats = max(seats, 1)
+	f := Fare{
+		BaseFare:       r.BaseFare * int64(seats),
+		DistanceFare:   int64(math.Round(float64(r.PerKm)*distanceMeters/1000)) * int64(seats),
+		PeakMultiplier: r.Multiplier(at),
+	}
+	subtotal := f.BaseFare + f.DistanceFare
+	if shared {
+		f.SharedDiscount = int64(math.Round(float64(subtotal) * r.SharedDiscount))
+	}
+	return f.WithSurge(1)
+}
+
+// WithSurge returns f with the surge multiplier applied on top of the peak
+// multiplier and the total recomputed.
+func (f Fare) WithSurge(multiplier float64) Fare {
+	f.SurgeMultiplier = max(multiplier, 1)
+	f.Total = int64(math.Round(float64(f.BaseFare+f.DistanceFare-f.SharedDiscount) * f.PeakMultiplier * f.SurgeMultiplier))
+	return f
+}
+
+// Surge turns a demand/supply ratio into a multiplier: 1 while supply keeps
+// up, then rising by sensitivity per unit of ratio above 1, capped at
+// maxMultiplier and rounded to 0.05 steps.
+func Surge(ratio, sensitivity, maxMultiplier float64) float64 {
+	multiplier := 1 + sensitivity*(ratio-1)
+	multiplier = math.Round(multiplier/surgeStep) * surgeStep
+	multiplier = math.Round(multiplier*100) / 100
+	return min(max(multiplier, 1), max(maxMultiplier, 1))
+}
+
+// Multiplier returns the highest peak multiplier covering at, or 1.
+func (r Rules) Multiplier(at time.Time) float64 {
+	loc := r.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := at.In(loc)
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+	multiplier := 1.0
+	for _, peak := range r.Peaks {
+		in := offset >= peak.Start && offset < peak.End
+		if peak.End < peak.Start {
+			in = offset >= peak.Start || offset < peak.End
+		}
+		if in && peak.Multiplier > multiplier {
+			multiplier = peak.Multiplier
+		}
+	}
+	return multiplier
+}
+
+// ParsePeakWindows reads a comma separated list of HH:MM-HH:MM=multiplier
+// entries, e.g. "07:00-10:00=1.5,17:30-20:00=1.25". Multipliers must be
+// above 1, since Multiplier ignores the rest.
+func ParsePeakWindows(value string) ([]PeakWindow, error) {
+	peaks, err := ParseWindows(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, peak := range peaks {
+		if peak.Multiplier <= 1 {
+			return nil, fmt.Errorf("peak multiplier %g must be above 1", peak.Multiplier)
+		}
+	}
+	return peaks, nil
+}
+
+// ParseWindows reads windows in the ParsePeakWindows format with any
+// positive factor, for callers that scale other things than fares.
+func ParseWindows(value string) ([]PeakWindow, error) {
+	var peaks []PeakWindow
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		span, factor, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("window %q: missing =multiplier", entry)
+		}
+		from, to, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("window %q: expected HH:MM-HH:MM", entry)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("window %q: %w", entry, err)
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, fmt.Errorf("window %q: %w", entry, err)
+		}
+		multiplier, err := strconv.ParseFloat(strings.TrimSpace(factor), 64)
+		if err != nil || !(multiplier > 0) || math.IsInf(multiplier, 0) {
+			return nil, fmt.Errorf("window %q: multiplier must be a positive number", entry)
+		}
+		if start == end {
+			return nil, fmt.Errorf("window %q: window is empty", entry)
+		}
+		peaks = append(peaks, PeakWindow{Start: start, End: end, Multiplier: multiplier})
+	}
+	return peaks, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", strings.TrimSpace(value))
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,134 @@
+package fare
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrice(t *testing.T) {
+	rules := Rules{
+		Currency:       "INR",
+		BaseFare:       1500,
+		PerKm:          800,
+		SharedDiscount: 0.25,
+		Peaks:          []PeakWindow{{Start: 8 * time.Hour, End: 10 * time.Hour, Multiplier: 1.5}},
+	}
+	offPeak := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	solo := rules.Price(2500, 1, false, offPeak)
+	if solo.BaseFare != 1500 || solo.DistanceFare != 2000 || solo.SharedDiscount != 0 || solo.Total != 3500 {
+		t.Fatalf("unexpected solo fare: %+v", solo)
+	}
+	shared := rules.Price(2500, 2, true, offPeak)
+	if shared.BaseFare != 3000 || shared.DistanceFare != 4000 || shared.SharedDiscount != 1750 || shared.Total != 5250 {
+		t.Fatalf("unexpected shared fare: %+v", shared)
+	}
+	peak := rules.Price(2500, 0, false, time.Date(2026, 3, 2, 9, 15, 0, 0, time.UTC))
+	if peak.PeakMultiplier != 1.5 || peak.Total != 5250 {
+		t.Fatalf("unexpected peak fare: %+v", peak)
+	}
+}
+
+func TestSurge(t *testing.T) {
+	cases := []struct {
+		ratio float64
+		want  float64
+	}{
+		{0, 1},
+		{1, 1},
+		{1.5, 1.25},
+		{2.12, 1.55},
+		{10, 2.5},
+	}
+	for _, tc := range cases {
+		if got := Surge(tc.ratio, 0.5, 2.5); got != tc.want {
+			t.Errorf("Surge(%v) = %v, want %v", tc.ratio, got, tc.want)
+		}
+	}
+
+	fare := Rules{BaseFare: 1000, PerKm: 1000}.Price(1000, 1, false, time.Time{}).WithSurge(1.5)
+	if fare.SurgeMultiplier != 1.5 || fare.Total != 3000 {
+		t.Fatalf("unexpected surged fare: %+v", fare)
+	}
+}
+
+func TestMultiplierWindows(t *testing.T) {
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	rules := Rules{
+		Peaks: []PeakWindow{
+			{Start: 7 * time.Hour, End: 10 * time.Hour, Multiplier: 1.2},
+			{Start: 9 * time.Hour, End: 9*time.Hour + 30*time.Minute, Multiplier: 1.8},
+			{Start: 23 * time.Hour, End: time.Hour, Multiplier: 1.4},
+		},
+		Location: kolkata,
+	}
+	cases := []struct {
+		local time.Time
+		want  float64
+	}{
+		{time.Date(2026, 3, 2, 6, 59, 0, 0, kolkata), 1},
+		{time.Date(2026, 3, 2, 7, 0, 0, 0, kolkata), 1.2},
+		{time.Date(2026, 3, 2, 9, 10, 0, 0, kolkata), 1.8},
+		{time.Date(2026, 3, 2, 10, 0, 0, 0, kolkata), 1},
+		{time.Date(2026, 3, 2, 23, 30, 0, 0, kolkata), 1.4},
+		{time.Date(2026, 3, 3, 0, 30, 0, 0, kolkata), 1.4},
+	}
+	for _, tc := range cases {
+		if got := rules.Multiplier(tc.local.UTC()); got != tc.want {
+			t.Errorf("Multiplier(%s) = %v, want %v", tc.local.Format("15:04"), got, tc.want)
+		}
+	}
+}
+
+func TestParsePeakWindows(t *testing.T) {
+	peaks, err := ParsePeakWindows(" 07:00-10:00=1.5, 22:30-01:00=1.25 ,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(peaks) != 2 || peaks[1].Start != 22*time.Hour+30*time.Minute || peaks[1].End != time.Hour || peaks[1].Multiplier != 1.25 {
+		t.Fatalf("unexpected peaks: %+v", peaks)
+	}
+	if peaks, err := ParsePeakWindows(""); err != nil || len(peaks) != 0 {
+		t.Fatalf("expected no peaks, got %v, %v", peaks, err)
+	}
+	for _, bad := range []string{"07:00-10:00", "07:00=1.5", "7am-10:00=1.5", "07:00-10:00=0", "07:00-07:00=2", "07:00-10:00=1", "08:00-10:00=0.6"} {
+		if _, err := ParsePeakWindows(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+	windows, err := ParseWindows("08:00-10:00=0.6")
+	if err != nil || len(windows) != 1 || windows[0].Multiplier != 0.6 {
+		t.Fatalf("expected a slow window, got %v, %v", windows, err)
+	}
+	if _, err := ParseWindows("08:00-10:00=-1"); err == nil {
+		t.Fatalf("expected error for a negative factor")
+	}
+}
+
+func TestQuoteToken(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	claims := Claims{QuoteID: "quote_1", StationID: "s1", DestinationID: "d1", Seats: 2, Currency: "INR", Total: 5250, ExpiresAt: now.Add(time.Minute).Unix()}
+	token := Sign(claims)
+
+	got, err := Verify(token, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != claims {
+		t.Fatalf("expected %+v, got %+v", claims, got)
+	}
+	if _, err := Verify(token, now.Add(time.Minute)); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("expected expired token, got %v", err)
+	}
+
+	payload, mac, _ := strings.Cut(token, ".")
+	forged := Sign(Claims{QuoteID: "quote_1", StationID: "s1", DestinationID: "d1", Seats: 2, Currency: "INR", Total: 1, ExpiresAt: claims.ExpiresAt})
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	for _, bad := range []string{"", payload, forgedPayload + "." + mac, payload + ".AAAA"} {
+		if _, err := Verify(bad, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected invalid token for %q, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package fare
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid quote token")
+	ErrExpiredToken = errors.New("quote token expired")
+)
+
+// Claims is what a quote token vouches for.
+type Claims struct {
+	QuoteID       string `json:"q"`
+	StationID     string `json:"s"`
+	DestinationID string `json:"d"`
+	Seats         uint32 `json:"n"`
+	Shared        bool   `json:"sh,omitempty"`
+	Currency      string `json:"c"`
+	Total         int64  `json:"t"`
+	ExpiresAt     int64  `json:"e"`
+	// PickupFrom and PickupUntil bound the pickup times the fare was priced
+	// for, in Unix seconds.
+	PickupFrom  int64 `json:"pf"`
+	PickupUntil int64 `json:"pu"`
+}
+
+// CoversPickup reports whether the fare was priced for a pickup at t.
+func (c Claims) CoversPickup(t time.Time) bool {
+	return !t.Before(time.Unix(c.PickupFrom, 0)) && !t.After(time.Unix(c.PickupUntil, 0))
+}
+
+var signingKey atomic.Pointer[[]byte]
+
+func init() {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	signingKey.Store(&key)
+}
+
+// SetSecret sets the key shared by the pricing and rider services; their
+// config fails validation without one. Until it is called (or when secret is
+// empty) a random per-process key is used, so only the process that issued a
+// token can verify it.
+func SetSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	key := []byte(secret)
+	signingKey.Store(&key)
+}
+
+// Sign returns an opaque token for claims.
+func Sign(claims Claims) string {
+	payload, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sign(payload))
+}
+
+// Verify checks the token's signature and expiry at now.
+func Verify(token string, now time.Time) (Claims, error) {
+	encoded, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(mac)
+	if err != nil || !hmac.Equal(signature, sign(payload)) {
+		return Claims{}, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.QuoteID == "" {
+		return Claims{}, ErrInvalidToken
+	}
+	if !now.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return Claims{}, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, *signingKey.Load())
+	mac.Write([]byte("quote\x00"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,314 @@
+// Package gtfs reads the parts of a static GTFS feed the station service
+// needs: parent stations and the scheduled train arrivals at them. It also
+// decodes GTFS-Realtime TripUpdate feeds so delays can move ride requests.
+//
+// Only calendar.txt weekdays are honoured; start/end dates and
+// calendar_dates.txt exceptions are ignored, and services without a
+// calendar.txt entry are treated as running every day.
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+// AllWeekdays is the TrainArrival.weekdays mask of a service that runs daily.
+const AllWeekdays = 0x7f
+
+// maxParentDepth bounds the boarding area -> platform -> station walk.
+const maxParentDepth = 3
+
+// Feed is the station view of a GTFS feed.
+type Feed struct {
+	// Timezone is the agency_timezone of the first agency, if any.
+	Timezone string
+	// Stations holds one entry per parent station, ordered by stop id, with
+	// arrivals ordered by time.
+	Stations []*lastmilev1.GtfsStation
+}
+
+// Load reads a GTFS zip from disk.
+func Load(name string) (*Feed, error) {
+	reader, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return Read(&reader.Reader)
+}
+
+type stop struct {
+	parent  string
+	station bool
+}
+
+type trip struct {
+	routeID  string
+	service  string
+	headsign string
+}
+
+// Read parses stops.txt, routes.txt, trips.txt and stop_times.txt, plus
+// agency.txt and calendar.txt when present.
+func Read(archive *zip.Reader) (*Feed, error) {
+	feed := &Feed{}
+	err := readTable(archive, "agency.txt", false, func(r record) error {
+		if feed.Timezone == "" {
+			feed.Timezone = r.get("agency_timezone")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stops := make(map[string]stop)
+	stations := make(map[string]*lastmilev1.GtfsStation)
+	err = readTable(archive, "stops.txt", true, func(r record) error {
+		stopID := r.get("stop_id")
+		if stopID == "" {
+			return nil
+		}
+		isStation := r.get("location_type") == "1"
+		stops[stopID] = stop{parent: r.get("parent_station"), station: isStation}
+		if !isStation {
+			return nil
+		}
+		lat, err := strconv.ParseFloat(r.get("stop_lat"), 64)
+		if err != nil {
+			return r.errorf("invalid stop_lat")
+		}
+		lng, err := strconv.ParseFloat(r.get("stop_lon"), 64)
+		if err != nil {
+			return r.errorf("invalid stop_lon")
+		}
+		stations[stopID] = &lastmilev1.GtfsStation{
+			StopId:   stopID,
+			Name:     r.get("stop_name"),
+			Location: &lastmilev1.LatLng{Latitude: lat, Longitude: lng},
+			Timezone: r.get("stop_timezone"),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	routeNames := make(map[string]string)
+	err = readTable(archive, "routes.txt", true, func(r record) error {
+		name := r.get("route_short_name")
+		if name == "" {
+			name = r.get("route_long_name")
+		}
+		routeNames[r.get("route_id")] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	weekdays := make(map[string]int32)
+	err = readTable(archive, "calendar.txt", false, func(r record) error {
+		var mask int32
+		for bit, day := range []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"} {
+			if r.get(day) == "1" {
+				mask |= 1 << bit
+			}
+		}
+		weekdays[r.get("service_id")] = mask
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trips := make(map[string]trip)
+	err = readTable(archive, "trips.txt", true, func(r record) error {
+		trips[r.get("trip_id")] = trip{
+			routeID:  r.get("route_id"),
+			service:  r.get("service_id"),
+			headsign: r.get("trip_headsign"),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stationOf := func(stopID string) *lastmilev1.GtfsStation {
+		for range maxParentDepth + 1 {
+			current, ok := stops[stopID]
+			if !ok {
+				return nil
+			}
+			if current.station {
+				return stations[stopID]
+			}
+			stopID = current.parent
+		}
+		return nil
+	}
+	err = readTable(archive, "stop_times.txt", true, func(r record) error {
+		station := stationOf(r.get("stop_id"))
+		if station == nil {
+			return nil
+		}
+		t, ok := trips[r.get("trip_id")]
+		if !ok {
+			return nil
+		}
+		at := r.get("arrival_time")
+		if at == "" {
+			at = r.get("departure_time")
+		}
+		if at == "" {
+			// Non-timepoint stops have no time of their own.
+			return nil
+		}
+		seconds, err := ParseTime(at)
+		if err != nil {
+			return r.errorf("invalid arrival_time %q", at)
+		}
+		sequence, err := strconv.ParseUint(r.get("stop_sequence"), 10, 32)
+		if err != nil {
+			return r.errorf("invalid stop_sequence")
+		}
+		mask, ok := weekdays[t.service]
+		if !ok {
+			mask = AllWeekdays
+		}
+		if mask == 0 {
+			// Runs only on calendar_dates.txt exceptions, which are not read.
+			return nil
+		}
+		station.Arrivals = append(station.Arrivals, &lastmilev1.TrainArrival{
+			RouteId:        t.routeID,
+			RouteName:      routeNames[t.routeID],
+			TripId:         r.get("trip_id"),
+			Headsign:       t.headsign,
+			ArrivalSeconds: seconds,
+			Weekdays:       mask,
+			StopSequence:   uint32(sequence),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, station := range stations {
+		if station.Timezone == "" {
+			station.Timezone = feed.Timezone
+		}
+		slices.SortFunc(station.Arrivals, func(a, b *lastmilev1.TrainArrival) int {
+			if a.ArrivalSeconds != b.ArrivalSeconds {
+				return int(a.ArrivalSeconds - b.ArrivalSeconds)
+			}
+			return strings.Compare(a.TripId, b.TripId)
+		})
+		feed.Stations = append(feed.Stations, station)
+	}
+	slices.SortFunc(feed.Stations, func(a, b *lastmilev1.GtfsStation) int {
+		return strings.Compare(a.StopId, b.StopId)
+	})
+	return feed, nil
+}
+
+// ParseTime converts a GTFS H:MM:SS time, which may exceed 24:00:00, into
+// seconds after midnight.
+func ParseTime(value string) (int32, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 || len(parts[1]) != 2 || len(parts[2]) != 2 {
+		return 0, errors.New("time must be H:MM:SS")
+	}
+	hours, errH := strconv.Atoi(parts[0])
+	minutes, errM := strconv.Atoi(parts[1])
+	seconds, errS := strconv.Atoi(parts[2])
+	if errH != nil || errM != nil || errS != nil || hours < 0 || hours > 72 || minutes < 0 || minutes > 59 || seconds < 0 || seconds > 59 {
+		return 0, errors.New("time must be H:MM:SS")
+	}
+	return int32(hours*3600 + minutes*60 + seconds), nil
+}
+
+type record struct {
+	file   string
+	line   int
+	header map[string]int
+	fields []string
+}
+
+func (r record) get(column string) string {
+	i, ok := r.header[column]
+	if !ok || i >= len(r.fields) {
+		return ""
+	}
+	return strings.TrimSpace(r.fields[i])
+}
+
+func (r record) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s line %d: %s", r.file, r.line, fmt.Sprintf(format, args...))
+}
+
+// readTable calls row for every record of the named file, which may sit in a
+// folder inside the zip.
+func readTable(archive *zip.Reader, name string, required bool, row func(record) error) error {
+	var file *zip.File
+	for _, f := range archive.File {
+		if path.Base(f.Name) == name {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		if required {
+			return fmt.Errorf("gtfs feed has no %s", name)
+		}
+		return nil
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	reader := csv.NewReader(rc)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		columns[strings.TrimSpace(column)] = i
+	}
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if err := row(record{file: name, line: line, header: columns, fields: fields}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func TestReadFeed(t *testing.T) {
+	archive := buildFeed(t, map[string]string{
+		"feed/agency.txt": "\ufeffagency_id,agency_name,agency_timezone\nm,Metro,Asia/Kolkata\n",
+		"feed/stops.txt": "stop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+			"CEN,Central,12.97,77.59,1,\n" +
+			"CEN-1,Central Platform 1,12.97,77.59,0,CEN\n" +
+			"CEN-1A,Central Boarding A,12.97,77.59,4,CEN-1\n" +
+			"BUS,Bus Stop,12.9,77.5,0,\n",
+		"feed/routes.txt": "route_id,route_short_name,route_long_name\nR1,,Blue Line\nR2,G,Green Line\n",
+		"feed/calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday\n" +
+			"WK,1,1,1,1,1,0,0\nSPECIAL,0,0,0,0,0,0,0\n",
+		"feed/trips.txt": "route_id,service_id,trip_id,trip_headsign\n" +
+			"R1,WK,t1,Airport\nR2,DAILY,t2,Depot\nR2,SPECIAL,t3,Stadium\n",
+		"feed/stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"t1,25:10:00,25:11:00,CEN-1,1\n" +
+			"t2,,7:05:00,CEN-1A,1\n" +
+			"t3,08:00:00,08:00:00,CEN-1,1\n" +
+			"t2,07:30:00,07:30:00,BUS,2\n" +
+			"t1,25:20:00,25:20:00,BUS,2\n",
+	})
+
+	feed, err := Read(archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if feed.Timezone != "Asia/Kolkata" {
+		t.Fatalf("expected agency timezone, got %q", feed.Timezone)
+	}
+	if len(feed.Stations) != 1 {
+		t.Fatalf("expected only the parent station, got %v", feed.Stations)
+	}
+	station := feed.Stations[0]
+	if station.StopId != "CEN" || station.Name != "Central" || station.Timezone != "Asia/Kolkata" {
+		t.Fatalf("unexpected station: %v", station)
+	}
+	if len(station.Arrivals) != 2 {
+		t.Fatalf("expected 2 arrivals, got %v", station.Arrivals)
+	}
+	first, second := station.Arrivals[0], station.Arrivals[1]
+	if first.TripId != "t2" || first.ArrivalSeconds != 7*3600+5*60 || first.RouteName != "G" || first.Weekdays != AllWeekdays || first.StopSequence != 1 {
+		t.Fatalf("unexpected first arrival: %v", first)
+	}
+	if second.TripId != "t1" || second.ArrivalSeconds != 25*3600+10*60 || second.RouteName != "Blue Line" || second.Headsign != "Airport" || second.Weekdays != 0x1f {
+		t.Fatalf("unexpected second arrival: %v", second)
+	}
+}
+
+func TestReadFeedMissingFile(t *testing.T) {
+	archive := buildFeed(t, map[string]string{"stops.txt": "stop_id\n"})
+	if _, err := Read(archive); err == nil {
+		t.Fatalf("expected error for feed without routes.txt")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for value, want := range map[string]int32{"0:00:00": 0, "07:05:09": 25509, "25:10:00": 90600} {
+		got, err := ParseTime(value)
+		if err != nil || got != want {
+			t.Fatalf("ParseTime(%q) = %d, %v; want %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "7:5:00", "07:60:00", "abc", "99:00:00"} {
+		if _, err := ParseTime(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
+
+func buildFeed(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return archive
+}
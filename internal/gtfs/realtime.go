@@ -0,0 +1,237 @@
+package gtfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxRealtimeBytes bounds a GTFS-Realtime feed download.
+const maxRealtimeBytes = 64 << 20
+
+// GTFS-Realtime schedule_relationship values used here.
+const (
+	tripCanceled = 3
+	stopNoData   = 2
+)
+
+// TripUpdate is the part of a GTFS-Realtime TripUpdate entity used to move
+// arrival times.
+type TripUpdate struct {
+	TripID string
+	// StartDate is the service day (YYYYMMDD); empty when the feed omits it.
+	StartDate string
+	Canceled  bool
+	// Delay is the trip-level delay, used when no stop time update applies.
+	Delay     time.Duration
+	HasDelay  bool
+	StopTimes []StopTimeUpdate
+}
+
+// StopTimeUpdate is a predicted arrival at one stop of a trip.
+type StopTimeUpdate struct {
+	StopSequence uint32
+	StopID       string
+	NoData       bool
+	// Delay is the arrival delay, or the departure delay when the feed only
+	// has that.
+	Delay    time.Duration
+	HasDelay bool
+	// Time is the predicted absolute arrival, zero when not given.
+	Time time.Time
+}
+
+// DelayAt returns the delay to apply at the stop with the given sequence,
+// whose timetabled arrival is scheduled. Delays propagate from the closest
+// preceding stop time update, as the GTFS-Realtime spec describes; without
+// one the trip-level delay is used.
+func (u TripUpdate) DelayAt(stopSequence uint32, scheduled time.Time) (time.Duration, bool) {
+	if stopSequence > 0 {
+		var found *StopTimeUpdate
+		for i := range u.StopTimes {
+			stop := &u.StopTimes[i]
+			if stop.StopSequence == 0 || stop.StopSequence > stopSequence {
+				continue
+			}
+			if found == nil || stop.StopSequence > found.StopSequence {
+				found = stop
+			}
+		}
+		if found != nil && !found.NoData {
+			switch {
+			case found.StopSequence == stopSequence && !found.Time.IsZero() && !found.HasDelay:
+				return found.Time.Sub(scheduled), true
+			case found.HasDelay:
+				return found.Delay, true
+			}
+		}
+	}
+	return u.Delay, u.HasDelay
+}
+
+// FetchRealtime reads a feed from an http(s) URL or, for anything else, a
+// local file path (optionally prefixed with file://).
+func FetchRealtime(ctx context.Context, client *http.Client, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(source, "file://"))
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gtfs-rt feed returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRealtimeBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRealtimeBytes {
+		return nil, errors.New("gtfs-rt feed is too large")
+	}
+	return data, nil
+}
+
+// ParseTripUpdates decodes the TripUpdate entities of a binary GTFS-Realtime
+// FeedMessage. Other entities and unknown fields are skipped, so the generated
+// gtfs-realtime bindings are not needed.
+func ParseTripUpdates(data []byte) ([]TripUpdate, error) {
+	var updates []TripUpdate
+	err := walk(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		// FeedMessage.entity
+		if num != 2 || typ != protowire.BytesType {
+			return nil
+		}
+		return walk(value, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+			// FeedEntity.trip_update
+			if num != 3 || typ != protowire.BytesType {
+				return nil
+			}
+			update, err := parseTripUpdate(value)
+			if err != nil {
+				return err
+			}
+			if update.TripID != "" {
+				updates = append(updates, update)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gtfs-rt: %w", err)
+	}
+	return updates, nil
+}
+
+func parseTripUpdate(data []byte) (TripUpdate, error) {
+	var update TripUpdate
+	err := walk(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType: // trip
+			return walk(value, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					update.TripID = string(value)
+				case num == 3 && typ == protowire.BytesType:
+					update.StartDate = string(value)
+				case num == 4 && typ == protowire.VarintType:
+					update.Canceled = scalar == tripCanceled
+				}
+				return nil
+			})
+		case num == 2 && typ == protowire.BytesType: // stop_time_update
+			stop, err := parseStopTimeUpdate(value)
+			if err != nil {
+				return err
+			}
+			update.StopTimes = append(update.StopTimes, stop)
+		case num == 5 && typ == protowire.VarintType: // delay
+			update.Delay = time.Duration(int32(scalar)) * time.Second
+			update.HasDelay = true
+		}
+		return nil
+	})
+	return update, err
+}
+
+func parseStopTimeUpdate(data []byte) (StopTimeUpdate, error) {
+	var stop StopTimeUpdate
+	var departure StopTimeUpdate
+	err := walk(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			stop.StopSequence = uint32(scalar)
+		case num == 2 && typ == protowire.BytesType: // arrival
+			return parseStopTimeEvent(value, &stop)
+		case num == 3 && typ == protowire.BytesType: // departure
+			return parseStopTimeEvent(value, &departure)
+		case num == 4 && typ == protowire.BytesType:
+			stop.StopID = string(value)
+		case num == 5 && typ == protowire.VarintType:
+			stop.NoData = scalar == stopNoData
+		}
+		return nil
+	})
+	if !stop.HasDelay && stop.Time.IsZero() {
+		stop.Delay, stop.HasDelay, stop.Time = departure.Delay, departure.HasDelay, departure.Time
+	}
+	return stop, err
+}
+
+func parseStopTimeEvent(data []byte, stop *StopTimeUpdate) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, _ []byte, scalar uint64) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			stop.Delay = time.Duration(int32(scalar)) * time.Second
+			stop.HasDelay = true
+		case num == 2 && typ == protowire.VarintType:
+			stop.Time = time.Unix(int64(scalar), 0)
+		}
+		return nil
+	})
+}
+
+// walk calls field for every top-level field of a protobuf message. Value is
+// set for length-delimited fields and scalar for varints.
+func walk(data []byte, field func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		var scalar uint64
+		switch typ {
+		case protowire.VarintType:
+			scalar, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := field(num, typ, value, scalar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
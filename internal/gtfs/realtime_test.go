@@ -0,0 +1,111 @@
+package gtfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestParseTripUpdates(t *testing.T) {
+	predicted := time.Date(2026, time.October, 19, 8, 17, 0, 0, time.UTC)
+	tripDelay := int64(-120)
+	feed := message(
+		bytesField(1, message(bytesField(1, []byte("2.0")))),
+		bytesField(2, message(
+			bytesField(1, []byte("e1")),
+			bytesField(3, message(
+				bytesField(1, message(bytesField(1, []byte("t1")), bytesField(3, []byte("20261019")))),
+				bytesField(2, message(varintField(1, 3), bytesField(2, message(varintField(1, 300))))),
+				bytesField(2, message(varintField(1, 5), bytesField(4, []byte("P5")), bytesField(2, message(varintField(2, uint64(predicted.Unix())))))),
+				bytesField(2, message(varintField(1, 7), varintField(5, 2))),
+				varintField(5, uint64(tripDelay)),
+			)),
+		)),
+		bytesField(2, message(bytesField(1, []byte("vehicle")), bytesField(4, message(bytesField(1, []byte("ignored")))))),
+		bytesField(2, message(bytesField(3, message(
+			bytesField(1, message(bytesField(1, []byte("t2")), varintField(4, 3))),
+		)))),
+	)
+
+	updates, err := ParseTripUpdates(feed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 trip updates, got %d", len(updates))
+	}
+	first := updates[0]
+	if first.TripID != "t1" || first.StartDate != "20261019" || first.Canceled || first.Delay != -2*time.Minute || len(first.StopTimes) != 3 {
+		t.Fatalf("unexpected first update: %+v", first)
+	}
+	if stop := first.StopTimes[1]; stop.StopID != "P5" || !stop.Time.Equal(predicted) || stop.HasDelay {
+		t.Fatalf("unexpected stop time update: %+v", stop)
+	}
+	if !updates[1].Canceled || updates[1].TripID != "t2" {
+		t.Fatalf("expected canceled t2, got %+v", updates[1])
+	}
+
+	scheduled := time.Date(2026, time.October, 19, 8, 10, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		sequence uint32
+		want     time.Duration
+		ok       bool
+	}{
+		{sequence: 0, want: -2 * time.Minute, ok: true},
+		{sequence: 2, want: -2 * time.Minute, ok: true},
+		{sequence: 4, want: 5 * time.Minute, ok: true},
+		{sequence: 5, want: 7 * time.Minute, ok: true},
+		// The nearest earlier update has no data, so the trip delay applies.
+		{sequence: 9, want: -2 * time.Minute, ok: true},
+	} {
+		got, ok := first.DelayAt(tc.sequence, scheduled)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("DelayAt(%d) = %v, %t; want %v, %t", tc.sequence, got, ok, tc.want, tc.ok)
+		}
+	}
+	if _, ok := updates[1].DelayAt(1, scheduled); ok {
+		t.Fatalf("expected no delay for an update without delays")
+	}
+}
+
+func TestParseTripUpdatesRejectsGarbage(t *testing.T) {
+	if _, err := ParseTripUpdates([]byte{0x12, 0x05, 0x01}); err == nil {
+		t.Fatalf("expected error for truncated feed")
+	}
+}
+
+func TestFetchRealtimeFromFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "feed.pb")
+	want := message(bytesField(1, message(bytesField(1, []byte("2.0")))))
+	if err := os.WriteFile(name, want, 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, source := range []string{name, "file://" + name} {
+		got, err := FetchRealtime(context.Background(), nil, source)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("unexpected feed bytes from %s", source)
+		}
+	}
+}
+
+func message(fields ...[]byte) []byte {
+	return slices.Concat(fields...)
+}
+
+func bytesField(num protowire.Number, value []byte) []byte {
+	out := protowire.AppendTag(nil, num, protowire.BytesType)
+	return protowire.AppendBytes(out, value)
+}
+
+func varintField(num protowire.Number, value uint64) []byte {
+	out := protowire.AppendTag(nil, num, protowire.VarintType)
+	return protowire.AppendVarint(out, value)
+}
@@ -0,0 +1,59 @@
+package pagetoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	filter := FilterHash("riders", "ali")
+	token := Encode("rider_42", filter)
+	if strings.Contains(token, "rider_42") {
+		t.Fatalf("expected opaque token, got %q", token)
+	}
+	key, err := Decode(token, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key != "rider_42" {
+		t.Fatalf("expected rider_42, got %q", key)
+	}
+}
+
+func TestDecodeRejectsTamperedAndForeignTokens(t *testing.T) {
+	filter := FilterHash("stations")
+	token := Encode("s1", filter)
+	payload, mac, _ := strings.Cut(token, ".")
+	forged := Encode("s9", filter)
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	cases := map[string]struct {
+		token  string
+		filter string
+	}{
+		"garbage":         {token: "12", filter: filter},
+		"swapped payload": {token: forgedPayload + "." + mac, filter: filter},
+		"missing mac":     {token: payload, filter: filter},
+		"other filter":    {token: token, filter: FilterHash("vehicles")},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode(tc.token, tc.filter); !errors.Is(err, ErrInvalid) {
+				t.Fatalf("expected ErrInvalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSetSecretInvalidatesOldTokens(t *testing.T) {
+	filter := FilterHash("vehicles")
+	token := Encode("v1", filter)
+	SetSecret("rotated-secret")
+	if _, err := Decode(token, filter); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected token signed with the old key to be rejected, got %v", err)
+	}
+	if _, err := Decode(Encode("v1", filter), filter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalid           = errors.New("invalid phone number")
+	ErrUnsupportedRegion = errors.New("unsupported phone region")
+)
+
+type region struct {
+	code        string
+	trunk       string
+	minNational int
+	maxNational int
+}
+
+var regions = map[string]region{
+	"AE": {code: "971", trunk: "0", minNational: 8, maxNational: 9},
+	"AU": {code: "61", trunk: "0", minNational: 9, maxNational: 9},
+	"CA": {code: "1", trunk: "1", minNational: 10, maxNational: 10},
+	"DE": {code: "49", trunk: "0", minNational: 6, maxNational: 11},
+	"FR": {code: "33", trunk: "0", minNational: 9, maxNational: 9},
+	"GB": {code: "44", trunk: "0", minNational: 9, maxNational: 10},
+	"IN": {code: "91", trunk: "0", minNational: 10, maxNational: 10},
+	"SG": {code: "65", minNational: 8, maxNational: 8},
+	"US": {code: "1", trunk: "1", minNational: 10, maxNational: 10},
+}
+
+func SupportedRegion(code string) bool {
+	_, ok := regions[strings.ToUpper(strings.TrimSpace(code))]
+	return ok
+}
+
+// Normalize returns raw in E.164 form. Numbers without an international
+// prefix ("+" or "00") are read as national numbers of defaultRegion;
+// international numbers must have a supported region's country code.
+func Normalize(raw, defaultRegion string) (string, error) {
+	value := strings.TrimSpace(raw)
+	international := false
+	switch {
+	case strings.HasPrefix(value, "+"):
+		international = true
+		value = value[1:]
+	case strings.HasPrefix(value, "00"):
+		international = true
+		value = value[2:]
+	}
+	digits, ok := digitsOnly(value)
+	if !ok || digits == "" {
+		return "", ErrInvalid
+	}
+
+	if international {
+		return normalizeInternational(digits)
+	}
+	reg, ok := regions[strings.ToUpper(strings.TrimSpace(defaultRegion))]
+	if !ok {
+		return "", ErrUnsupportedRegion
+	}
+	if reg.trunk != "" && len(digits) > reg.maxNational && strings.HasPrefix(digits, reg.trunk) {
+		digits = strings.TrimPrefix(digits, reg.trunk)
+	}
+	if len(digits) > reg.maxNational && strings.HasPrefix(digits, reg.code) {
+		digits = strings.TrimPrefix(digits, reg.code)
+	}
+	if !reg.validNational(digits) {
+		return "", ErrInvalid
+	}
+	return "+" + reg.code + digits, nil
+}
+
+func normalizeInternational(digits string) (string, error) {
+	if digits[0] == '0' || len(digits) < 8 || len(digits) > 15 {
+		return "", ErrInvalid
+	}
+	for _, reg := range regions {
+		if !strings.HasPrefix(digits, reg.code) {
+			continue
+		}
+		if !reg.validNational(digits[len(reg.code):]) {
+			return "", ErrInvalid
+		}
+		return "+" + digits, nil
+	}
+	return "", ErrUnsupportedRegion
+}
+
+func (r region) validNational(digits string) bool {
+	if len(digits) < r.minNational || len(digits) > r.maxNational {
+		return false
+	}
+	return digits[0] != '0'
+}
+
+func digitsOnly(value string) (string, bool) {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
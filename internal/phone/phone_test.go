@@ -0,0 +1,48 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		raw    string
+		region string
+		want   string
+	}{
+		{raw: "+91 98765 43210", region: "IN", want: "+919876543210"},
+		{raw: "9876543210", region: "IN", want: "+919876543210"},
+		{raw: "098765-43210", region: "in", want: "+919876543210"},
+		{raw: "0091 9876543210", region: "US", want: "+919876543210"},
+		{raw: "(415) 555-2671", region: "US", want: "+14155552671"},
+		{raw: "1 415 555 2671", region: "US", want: "+14155552671"},
+		{raw: "+44 20 7946 0958", region: "IN", want: "+442079460958"},
+	}
+	for _, tc := range cases {
+		got, err := Normalize(tc.raw, tc.region)
+		if err != nil {
+			t.Fatalf("Normalize(%q, %q) unexpected error: %v", tc.raw, tc.region, err)
+		}
+		if got != tc.want {
+			t.Fatalf("Normalize(%q, %q) = %q, want %q", tc.raw, tc.region, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeRejectsInvalid(t *testing.T) {
+	for _, raw := range []string{"", "abc", "12345", "+0123456789", "+91 12345", "98765432101234", "+1234567890123456"} {
+		if _, err := Normalize(raw, "IN"); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("Normalize(%q) expected ErrInvalid, got %v", raw, err)
+		}
+	}
+	for _, tc := range []struct{ raw, region string }{
+		{raw: "9876543210", region: "XX"},
+		{raw: "+86 139 1234 5678", region: "IN"},
+		{raw: "+999 1234 5678 901", region: "IN"},
+	} {
+		if _, err := Normalize(tc.raw, tc.region); !errors.Is(err, ErrUnsupportedRegion) {
+			t.Fatalf("Normalize(%q, %q) expected ErrUnsupportedRegion, got %v", tc.raw, tc.region, err)
+		}
+	}
+}
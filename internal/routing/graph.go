@@ -0,0 +1,276 @@
+// Package routing finds road routes offline, over a graph built from an
+// OpenStreetMap PBF extract of the service area.
+package routing
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// highwaySpeeds are the free-flow speeds, in km/h, of the highway classes
+// vehicles can use. Ways with other highway tags are left out of the graph.
+var highwaySpeeds = map[string]float64{
+	"motorway":       80,
+	"motorway_link":  50,
+	"trunk":          65,
+	"trunk_link":     40,
+	"primary":        50,
+	"primary_link":   35,
+	"secondary":      40,
+	"secondary_link": 30,
+	"tertiary":       35,
+	"tertiary_link":  25,
+	"unclassified":   25,
+	"residential":    20,
+	"living_street":  10,
+	"service":        15,
+	"road":           20,
+}
+
+const (
+	// gridDegrees is the cell size of the index used to snap points to the
+	// nearest vertex, about 1.1 km of latitude.
+	gridDegrees = 0.01
+	// maxSnapMeters is how far from the nearest road a point may be.
+	maxSnapMeters = 1000
+	// accessKmh is the speed assumed between a point and its nearest vertex.
+	accessKmh = 15
+)
+
+// Graph is a directed road graph. Vertices are the OSM nodes of routable
+// ways; edges are stored in compressed sparse row form.
+type Graph struct {
+	lat, lng []float64
+	// first[v]..first[v+1] index the edges leaving v.
+	first  []int32
+	edges  []edge
+	maxKmh float64
+	grid   map[cell][]int32
+}
+
+type edge struct {
+	to     int32
+	meters float64
+	kmh    float64
+}
+
+type cell struct{ x, y int32 }
+
+// Load builds a graph from the OSM PBF extract at path.
+func Load(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read builds a graph from an OSM PBF extract. Only zlib-compressed or raw
+// blobs are supported.
+func Read(r io.Reader) (*Graph, error) {
+	type way struct {
+		refs    []int64
+		kmh     float64
+		forward bool
+		reverse bool
+	}
+	nodes := make(map[int64][2]float64)
+	var ways []way
+	err := readPBF(r, pbfHandler{
+		node: func(id int64, lat, lng float64) {
+			nodes[id] = [2]float64{lat, lng}
+		},
+		way: func(refs []int64, tags map[string]string) {
+			kmh, ok := wayKmh(tags)
+			if !ok || len(refs) < 2 {
+				return
+			}
+			forward, reverse := wayDirections(tags)
+			ways = append(ways, way{refs: refs, kmh: kmh, forward: forward, reverse: reverse})
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{grid: make(map[cell][]int32)}
+	vertex := make(map[int64]int32)
+	vertexOf := func(id int64) (int32, bool) {
+		if v, ok := vertex[id]; ok {
+			return v, true
+		}
+		point, ok := nodes[id]
+		if !ok {
+			return 0, false
+		}
+		v := int32(len(g.lat))
+		vertex[id] = v
+		g.lat = append(g.lat, point[0])
+		g.lng = append(g.lng, point[1])
+		c := cellOf(point[0], point[1])
+		g.grid[c] = append(g.grid[c], v)
+		return v, true
+	}
+	type arc struct {
+		from int32
+		edge
+	}
+	var arcs []arc
+	for _, w := range ways {
+		g.maxKmh = max(g.maxKmh, w.kmh)
+		for i := 1; i < len(w.refs); i++ {
+			from, ok := vertexOf(w.refs[i-1])
+			if !ok {
+				continue
+			}
+			to, ok := vertexOf(w.refs[i])
+			if !ok || from == to {
+				continue
+			}
+			meters := haversineMeters(g.lat[from], g.lng[from], g.lat[to], g.lng[to])
+			if w.forward {
+				arcs = append(arcs, arc{from: from, edge: edge{to: to, meters: meters, kmh: w.kmh}})
+			}
+			if w.reverse {
+				arcs = append(arcs, arc{from: to, edge: edge{to: from, meters: meters, kmh: w.kmh}})
+			}
+		}
+	}
+	if len(arcs) == 0 {
+		return nil, fmt.Errorf("extract has no routable roads")
+	}
+
+	g.first = make([]int32, len(g.lat)+1)
+	for _, a := range arcs {
+		g.first[a.from+1]++
+	}
+	for v := 1; v < len(g.first); v++ {
+		g.first[v] += g.first[v-1]
+	}
+	g.edges = make([]edge, len(arcs))
+	next := append([]int32(nil), g.first[:len(g.lat)]...)
+	for _, a := range arcs {
+		g.edges[next[a.from]] = a.edge
+		next[a.from]++
+	}
+	return g, nil
+}
+
+// Vertices returns the number of vertices in the graph.
+func (g *Graph) Vertices() int {
+	return len(g.lat)
+}
+
+// wayKmh returns the speed of a way vehicles may drive on.
+func wayKmh(tags map[string]string) (float64, bool) {
+	kmh, ok := highwaySpeeds[tags["highway"]]
+	if !ok {
+		return 0, false
+	}
+	switch tags["access"] {
+	case "no", "private":
+		return 0, false
+	}
+	switch tags["motor_vehicle"] {
+	case "no", "private":
+		return 0, false
+	}
+	if tags["area"] == "yes" {
+		return 0, false
+	}
+	if maxspeed, ok := parseMaxspeed(tags["maxspeed"]); ok {
+		kmh = maxspeed
+	}
+	return kmh, true
+}
+
+// parseMaxspeed reads km/h values and "mph" suffixed ones, ignoring symbolic
+// values such as "walk" or "RU:urban".
+func parseMaxspeed(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	factor := 1.0
+	if number, ok := strings.CutSuffix(value, "mph"); ok {
+		value = strings.TrimSpace(number)
+		factor = 1.609344
+	}
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil || speed <= 0 || math.IsInf(speed, 0) {
+		return 0, false
+	}
+	return speed * factor, true
+}
+
+// wayDirections reports whether a way can be driven along and against the
+// order of its nodes.
+func wayDirections(tags map[string]string) (forward, reverse bool) {
+	switch tags["oneway"] {
+	case "yes", "true", "1":
+		return true, false
+	case "-1", "reverse":
+		return false, true
+	case "no", "false", "0":
+		return true, true
+	}
+	if tags["junction"] == "roundabout" || tags["highway"] == "motorway" {
+		return true, false
+	}
+	return true, true
+}
+
+// nearest returns the vertex closest to a point within maxSnapMeters.
+func (g *Graph) nearest(lat, lng float64) (int32, float64, bool) {
+	center := cellOf(lat, lng)
+	best, bestMeters := int32(-1), math.Inf(1)
+	// Cells in ring r are at least r-1 cells away, and cells are narrowest
+	// along longitude, so stop once a ring cannot hold anything closer than
+	// the best match so far.
+	cellMeters := gridDegrees * math.Max(math.Cos(lat*math.Pi/180), 0.1) * 111195
+	for ring := int32(0); ; ring++ {
+		minMeters := float64(max(ring-1, 0)) * cellMeters
+		if minMeters > bestMeters || minMeters > maxSnapMeters {
+			break
+		}
+		for x := center.x - ring; x <= center.x+ring; x++ {
+			for y := center.y - ring; y <= center.y+ring; y++ {
+				if max(abs(x-center.x), abs(y-center.y)) != ring {
+					continue
+				}
+				for _, v := range g.grid[cell{x, y}] {
+					if meters := haversineMeters(lat, lng, g.lat[v], g.lng[v]); meters < bestMeters {
+						best, bestMeters = v, meters
+					}
+				}
+			}
+		}
+	}
+	if best < 0 || bestMeters > maxSnapMeters {
+		return 0, 0, false
+	}
+	return best, bestMeters, true
+}
+
+func cellOf(lat, lng float64) cell {
+	return cell{x: int32(math.Floor(lng / gridDegrees)), y: int32(math.Floor(lat / gridDegrees))}
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func haversineMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadiusMeters = 6371000
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dLat := phi2 - phi1
+	dLng := (lng2 - lng1) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,361 @@
+package routing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The OSM PBF format is a sequence of blobs, each a 4-byte big-endian header
+// length, a BlobHeader and a Blob. OSMHeader blobs list the features a reader
+// must support; OSMData blobs hold PrimitiveBlocks of nodes, ways and
+// relations. Field numbers follow fileformat.proto and osmformat.proto.
+const (
+	maxBlobHeaderSize = 64 * 1024
+	maxBlobSize       = 32 * 1024 * 1024
+)
+
+var supportedFeatures = map[string]bool{
+	"OsmSchema-V0.6": true,
+	"DenseNodes":     true,
+}
+
+// pbfHandler receives the nodes and ways of an extract. Tags are only
+// decoded for ways.
+type pbfHandler struct {
+	node func(id int64, lat, lng float64)
+	way  func(refs []int64, tags map[string]string)
+}
+
+func readPBF(r io.Reader, handler pbfHandler) error {
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("read blob header size: %w", err)
+		}
+		headerSize := binary.BigEndian.Uint32(size[:])
+		if headerSize > maxBlobHeaderSize {
+			return fmt.Errorf("blob header of %d bytes is too large", headerSize)
+		}
+		header := make([]byte, headerSize)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return fmt.Errorf("read blob header: %w", err)
+		}
+		blobType, dataSize, err := decodeBlobHeader(header)
+		if err != nil {
+			return err
+		}
+		if dataSize > maxBlobSize {
+			return fmt.Errorf("blob of %d bytes is too large", dataSize)
+		}
+		blob := make([]byte, dataSize)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return fmt.Errorf("read blob: %w", err)
+		}
+		data, err := decodeBlob(blob)
+		if err != nil {
+			return err
+		}
+		switch blobType {
+		case "OSMHeader":
+			if err := checkHeaderBlock(data); err != nil {
+				return err
+			}
+		case "OSMData":
+			if err := decodePrimitiveBlock(data, handler); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func decodeBlobHeader(b []byte) (string, int, error) {
+	var blobType string
+	dataSize := -1
+	err := eachField(b, func(num protowire.Number, typ protowire.Type, b []byte, v uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			blobType = string(b)
+		case num == 3 && typ == protowire.VarintType:
+			dataSize = int(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("decode blob header: %w", err)
+	}
+	if blobType == "" || dataSize < 0 {
+		return "", 0, errors.New("decode blob header: missing type or datasize")
+	}
+	return blobType, dataSize, nil
+}
+
+func decodeBlob(b []byte) ([]byte, error) {
+	var raw, compressed []byte
+	var rawSize int
+	var unsupported bool
+	err := eachField(b, func(num protowire.Number, typ protowire.Type, b []byte, v uint64) error {
+		switch num {
+		case 1:
+			raw = b
+		case 2:
+			rawSize = int(v)
+		case 3:
+			compressed = b
+		default:
+			unsupported = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decode blob: %w", err)
+	}
+	switch {
+	case raw != nil:
+		return raw, nil
+	case compressed != nil:
+		if rawSize < 0 || rawSize > maxBlobSize {
+			return nil, fmt.Errorf("blob raw size %d is out of range", rawSize)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("decompress blob: %w", err)
+		}
+		defer zr.Close()
+		data := bytes.NewBuffer(make([]byte, 0, rawSize))
+		if _, err := io.Copy(data, io.LimitReader(zr, maxBlobSize+1)); err != nil {
+			return nil, fmt.Errorf("decompress blob: %w", err)
+		}
+		if data.Len() > maxBlobSize {
+			return nil, errors.New("decompressed blob is too large")
+		}
+		return data.Bytes(), nil
+	case unsupported:
+		return nil, errors.New("blob compression is not supported; re-encode the extract with zlib")
+	default:
+		return nil, nil
+	}
+}
+
+func checkHeaderBlock(b []byte) error {
+	return eachField(b, func(num protowire.Number, typ protowire.Type, b []byte, _ uint64) error {
+		if num == 4 && typ == protowire.BytesType && !supportedFeatures[string(b)] {
+			return fmt.Errorf("extract requires unsupported feature %q", b)
+		}
+		return nil
+	})
+}
+
+type primitiveBlock struct {
+	strings   [][]byte
+	groups    [][]byte
+	granular  int64
+	latOffset int64
+	lngOffset int64
+}
+
+func decodePrimitiveBlock(b []byte, handler pbfHandler) error {
+	block := primitiveBlock{granular: 100}
+	err := eachField(b, func(num protowire.Number, _ protowire.Type, b []byte, v uint64) error {
+		switch num {
+		case 1:
+			return eachField(b, func(num protowire.Number, _ protowire.Type, b []byte, _ uint64) error {
+				if num == 1 {
+					block.strings = append(block.strings, b)
+				}
+				return nil
+			})
+		case 2:
+			block.groups = append(block.groups, b)
+		case 17:
+			block.granular = int64(v)
+		case 19:
+			block.latOffset = int64(v)
+		case 20:
+			block.lngOffset = int64(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("decode primitive block: %w", err)
+	}
+	for _, group := range block.groups {
+		err := eachField(group, func(num protowire.Number, _ protowire.Type, b []byte, _ uint64) error {
+			switch num {
+			case 1:
+				return block.node(b, handler)
+			case 2:
+				return block.denseNodes(b, handler)
+			case 3:
+				return block.way(b, handler)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("decode primitive group: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p primitiveBlock) coord(offset, value int64) float64 {
+	return 1e-9 * float64(offset+p.granular*value)
+}
+
+func (p primitiveBlock) node(b []byte, handler pbfHandler) error {
+	var id, lat, lng int64
+	err := eachField(b, func(num protowire.Number, _ protowire.Type, _ []byte, v uint64) error {
+		switch num {
+		case 1:
+			id = protowire.DecodeZigZag(v)
+		case 8:
+			lat = protowire.DecodeZigZag(v)
+		case 9:
+			lng = protowire.DecodeZigZag(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	handler.node(id, p.coord(p.latOffset, lat), p.coord(p.lngOffset, lng))
+	return nil
+}
+
+func (p primitiveBlock) denseNodes(b []byte, handler pbfHandler) error {
+	var ids, lats, lngs []int64
+	err := eachField(b, func(num protowire.Number, typ protowire.Type, b []byte, v uint64) error {
+		var err error
+		switch num {
+		case 1:
+			ids, err = appendSint64s(ids, typ, b, v)
+		case 8:
+			lats, err = appendSint64s(lats, typ, b, v)
+		case 9:
+			lngs, err = appendSint64s(lngs, typ, b, v)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(lats) != len(ids) || len(lngs) != len(ids) {
+		return errors.New("dense nodes have mismatched id, lat and lon counts")
+	}
+	var id, lat, lng int64
+	for i := range ids {
+		id += ids[i]
+		lat += lats[i]
+		lng += lngs[i]
+		handler.node(id, p.coord(p.latOffset, lat), p.coord(p.lngOffset, lng))
+	}
+	return nil
+}
+
+func (p primitiveBlock) way(b []byte, handler pbfHandler) error {
+	var keys, vals []uint64
+	var refs []int64
+	err := eachField(b, func(num protowire.Number, typ protowire.Type, b []byte, v uint64) error {
+		var err error
+		switch num {
+		case 2:
+			keys, err = appendUvarints(keys, typ, b, v)
+		case 3:
+			vals, err = appendUvarints(vals, typ, b, v)
+		case 8:
+			refs, err = appendSint64s(refs, typ, b, v)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(keys) != len(vals) {
+		return errors.New("way has mismatched key and value counts")
+	}
+	tags := make(map[string]string, len(keys))
+	for i := range keys {
+		if keys[i] >= uint64(len(p.strings)) || vals[i] >= uint64(len(p.strings)) {
+			return errors.New("way tag is outside the string table")
+		}
+		tags[string(p.strings[keys[i]])] = string(p.strings[vals[i]])
+	}
+	var ref int64
+	for i := range refs {
+		ref += refs[i]
+		refs[i] = ref
+	}
+	handler.way(refs, tags)
+	return nil
+}
+
+// eachField walks the fields of a protobuf message. Varint and fixed values
+// are passed as v, length-delimited ones as b.
+func eachField(b []byte, visit func(num protowire.Number, typ protowire.Type, b []byte, v uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var value []byte
+		var v uint64
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(b)
+			v = uint64(v32)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := visit(num, typ, value, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendUvarints reads a repeated varint field, packed or not.
+func appendUvarints(dst []uint64, typ protowire.Type, b []byte, v uint64) ([]uint64, error) {
+	if typ == protowire.VarintType {
+		return append(dst, v), nil
+	}
+	for len(b) > 0 {
+		value, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		dst = append(dst, value)
+		b = b[n:]
+	}
+	return dst, nil
+}
+
+func appendSint64s(dst []int64, typ protowire.Type, b []byte, v uint64) ([]int64, error) {
+	values, err := appendUvarints(nil, typ, b, v)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		dst = append(dst, protowire.DecodeZigZag(value))
+	}
+	return dst, nil
+}
@@ -0,0 +1,190 @@
+package routing
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+)
+
+var (
+	// ErrNoRoad is returned for points farther than 1 km from any road.
+	ErrNoRoad = errors.New("routing: no road near point")
+	// ErrNoRoute is returned when the roads near two points do not connect.
+	ErrNoRoute = errors.New("routing: no route between points")
+)
+
+// Route is the fastest road route between two points. Distance and duration
+// include the straight stretches from each point to its nearest road vertex.
+type Route struct {
+	DistanceMeters float64
+	Duration       time.Duration
+	Points         []*lastmilev1.LatLng
+}
+
+// Polyline encodes the route's points in the Google encoded polyline format
+// at 5 decimal places.
+func (r Route) Polyline() string {
+	return EncodePolyline(r.Points)
+}
+
+// Route finds the fastest route from one point to another with A*. Road speeds
+// are capped at maxKmh when it is positive, so slow vehicles prefer shorter
+// roads over fast ones.
+func (g *Graph) Route(from, to *lastmilev1.LatLng, maxKmh float64) (Route, error) {
+	if from == nil || to == nil {
+		return Route{}, errors.New("routing: from and to are required")
+	}
+	source, sourceMeters, ok := g.nearest(from.Latitude, from.Longitude)
+	if !ok {
+		return Route{}, ErrNoRoad
+	}
+	target, targetMeters, ok := g.nearest(to.Latitude, to.Longitude)
+	if !ok {
+		return Route{}, ErrNoRoad
+	}
+	speed := func(kmh float64) float64 {
+		if maxKmh > 0 {
+			kmh = min(kmh, maxKmh)
+		}
+		return kmh / 3.6
+	}
+	// The heuristic is the straight-line time at the top speed, which never
+	// overestimates.
+	topSpeed := speed(g.maxKmh)
+	estimate := func(v int32) float64 {
+		return haversineMeters(g.lat[v], g.lng[v], g.lat[target], g.lng[target]) / topSpeed
+	}
+
+	seconds := map[int32]float64{source: 0}
+	meters := map[int32]float64{source: 0}
+	previous := map[int32]int32{source: -1}
+	done := make(map[int32]bool)
+	open := &queue{{vertex: source, priority: estimate(source)}}
+	for open.Len() > 0 {
+		v := heap.Pop(open).(item).vertex
+		if done[v] {
+			continue
+		}
+		done[v] = true
+		if v == target {
+			break
+		}
+		for _, e := range g.edges[g.first[v]:g.first[v+1]] {
+			if done[e.to] {
+				continue
+			}
+			t := seconds[v] + e.meters/speed(e.kmh)
+			if known, ok := seconds[e.to]; ok && known <= t {
+				continue
+			}
+			seconds[e.to] = t
+			meters[e.to] = meters[v] + e.meters
+			previous[e.to] = v
+			heap.Push(open, item{vertex: e.to, priority: t + estimate(e.to)})
+		}
+	}
+	if !done[target] {
+		return Route{}, ErrNoRoute
+	}
+
+	path := []*lastmilev1.LatLng{to}
+	for v := target; v >= 0; v = previous[v] {
+		path = append(path, &lastmilev1.LatLng{Latitude: g.lat[v], Longitude: g.lng[v]})
+	}
+	path = append(path, from)
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	access := sourceMeters + targetMeters
+	total := seconds[target] + access/speed(accessKmh)
+	return Route{
+		DistanceMeters: meters[target] + access,
+		Duration:       time.Duration(math.Round(total)) * time.Second,
+		Points:         path,
+	}, nil
+}
+
+// RouteDistance returns the road distance of the fastest route, so a Graph
+// can stand in for straight-line distances in pricing and matching.
+func (g *Graph) RouteDistance(_ context.Context, from, to *lastmilev1.LatLng) (float64, error) {
+	route, err := g.Route(from, to, 0)
+	if err != nil {
+		return 0, err
+	}
+	return route.DistanceMeters, nil
+}
+
+// Estimator estimates ETAs over the road graph. Each vehicle type is capped
+// at its profile speed, and time-of-day windows scale the whole trip; the
+// profile's detour factor is not used since the distance is already by road.
+type Estimator struct {
+	Graph   *Graph
+	Profile eta.Profile
+}
+
+func (e Estimator) Estimate(_ context.Context, from, to *lastmilev1.LatLng, vehicle lastmilev1.VehicleType, departure time.Time) (eta.Estimate, error) {
+	route, err := e.Graph.Route(from, to, e.Profile.BaseKmh(vehicle))
+	if err != nil {
+		return eta.Estimate{}, err
+	}
+	factor := e.Profile.Factor(departure)
+	if factor <= 0 {
+		return eta.Estimate{}, errors.New("routing: speed factor must be positive")
+	}
+	return eta.Estimate{
+		DistanceMeters: route.DistanceMeters,
+		Duration:       time.Duration(math.Round(route.Duration.Seconds()/factor)) * time.Second,
+		Polyline:       route.Polyline(),
+	}, nil
+}
+
+// EncodePolyline encodes points in the Google encoded polyline format at 5
+// decimal places.
+func EncodePolyline(points []*lastmilev1.LatLng) string {
+	var b strings.Builder
+	var lastLat, lastLng int64
+	for _, point := range points {
+		lat := int64(math.Round(point.Latitude * 1e5))
+		lng := int64(math.Round(point.Longitude * 1e5))
+		encodeSigned(&b, lat-lastLat)
+		encodeSigned(&b, lng-lastLng)
+		lastLat, lastLng = lat, lng
+	}
+	return b.String()
+}
+
+func encodeSigned(b *strings.Builder, value int64) {
+	v := uint64(value) << 1
+	if value < 0 {
+		v = ^v
+	}
+	for v >= 0x20 {
+		b.WriteByte(byte((0x20 | (v & 0x1f)) + 63))
+		v >>= 5
+	}
+	b.WriteByte(byte(v + 63))
+}
+
+type item struct {
+	vertex   int32
+	priority float64
+}
+
+type queue []item
+
+func (q queue) Len() int           { return len(q) }
+func (q queue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q queue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x any)        { *q = append(*q, x.(item)) }
+func (q *queue) Pop() any {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,258 @@
+package routing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testNode struct {
+	id       int64
+	lat, lng float64
+}
+
+type testWay struct {
+	refs []int64
+	tags map[string]string
+}
+
+// encodePBF writes a minimal extract: a header blob and one zlib-compressed
+// data blob with dense nodes and ways.
+func encodePBF(t *testing.T, nodes []testNode, ways []testWay, features ...string) []byte {
+	t.Helper()
+	var header []byte
+	for _, feature := range append([]string{"OsmSchema-V0.6", "DenseNodes"}, features...) {
+		header = protowire.AppendTag(header, 4, protowire.BytesType)
+		header = protowire.AppendString(header, feature)
+	}
+
+	strs := []string{""}
+	index := map[string]uint64{}
+	str := func(s string) uint64 {
+		if i, ok := index[s]; ok {
+			return i
+		}
+		index[s] = uint64(len(strs))
+		strs = append(strs, s)
+		return index[s]
+	}
+	var ids, lats, lngs []byte
+	var lastID, lastLat, lastLng int64
+	for _, n := range nodes {
+		lat, lng := int64(n.lat*1e7), int64(n.lng*1e7)
+		ids = protowire.AppendVarint(ids, protowire.EncodeZigZag(n.id-lastID))
+		lats = protowire.AppendVarint(lats, protowire.EncodeZigZag(lat-lastLat))
+		lngs = protowire.AppendVarint(lngs, protowire.EncodeZigZag(lng-lastLng))
+		lastID, lastLat, lastLng = n.id, lat, lng
+	}
+	var dense []byte
+	for _, field := range []struct {
+		num    protowire.Number
+		packed []byte
+	}{{1, ids}, {8, lats}, {9, lngs}} {
+		dense = protowire.AppendTag(dense, field.num, protowire.BytesType)
+		dense = protowire.AppendBytes(dense, field.packed)
+	}
+	group := protowire.AppendTag(nil, 2, protowire.BytesType)
+	group = protowire.AppendBytes(group, dense)
+	for i, w := range ways {
+		var keys, vals, refs []byte
+		for k, v := range w.tags {
+			keys = protowire.AppendVarint(keys, str(k))
+			vals = protowire.AppendVarint(vals, str(v))
+		}
+		var last int64
+		for _, ref := range w.refs {
+			refs = protowire.AppendVarint(refs, protowire.EncodeZigZag(ref-last))
+			last = ref
+		}
+		way := protowire.AppendTag(nil, 1, protowire.VarintType)
+		way = protowire.AppendVarint(way, uint64(i+1))
+		for _, field := range []struct {
+			num    protowire.Number
+			packed []byte
+		}{{2, keys}, {3, vals}, {8, refs}} {
+			way = protowire.AppendTag(way, field.num, protowire.BytesType)
+			way = protowire.AppendBytes(way, field.packed)
+		}
+		group = protowire.AppendTag(group, 3, protowire.BytesType)
+		group = protowire.AppendBytes(group, way)
+	}
+	var table []byte
+	for _, s := range strs {
+		table = protowire.AppendTag(table, 1, protowire.BytesType)
+		table = protowire.AppendString(table, s)
+	}
+	block := protowire.AppendTag(nil, 1, protowire.BytesType)
+	block = protowire.AppendBytes(block, table)
+	block = protowire.AppendTag(block, 2, protowire.BytesType)
+	block = protowire.AppendBytes(block, group)
+
+	var out bytes.Buffer
+	writeBlob := func(blobType string, data []byte) {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(data); err != nil {
+			t.Fatalf("compress: %v", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("compress: %v", err)
+		}
+		blob := protowire.AppendTag(nil, 2, protowire.VarintType)
+		blob = protowire.AppendVarint(blob, uint64(len(data)))
+		blob = protowire.AppendTag(blob, 3, protowire.BytesType)
+		blob = protowire.AppendBytes(blob, compressed.Bytes())
+		blobHeader := protowire.AppendTag(nil, 1, protowire.BytesType)
+		blobHeader = protowire.AppendString(blobHeader, blobType)
+		blobHeader = protowire.AppendTag(blobHeader, 3, protowire.VarintType)
+		blobHeader = protowire.AppendVarint(blobHeader, uint64(len(blob)))
+		_ = binary.Write(&out, binary.BigEndian, uint32(len(blobHeader)))
+		out.Write(blobHeader)
+		out.Write(blob)
+	}
+	writeBlob("OSMHeader", header)
+	writeBlob("OSMData", block)
+	return out.Bytes()
+}
+
+// riverTown has two roads along either bank of a river running north, joined
+// only by a bridge 2 km north, plus a footbridge straight across that cars
+// cannot use and a one-way lane on the east bank.
+func riverTown(t *testing.T) *Graph {
+	t.Helper()
+	nodes := []testNode{
+		{1, 12.970, 77.590}, {2, 12.980, 77.590}, {3, 12.990, 77.590},
+		{4, 12.970, 77.600}, {5, 12.980, 77.600}, {6, 12.990, 77.600},
+		{7, 12.970, 77.605},
+	}
+	ways := []testWay{
+		{refs: []int64{1, 2, 3}, tags: map[string]string{"highway": "secondary"}},
+		{refs: []int64{4, 5, 6}, tags: map[string]string{"highway": "residential", "maxspeed": "30"}},
+		{refs: []int64{3, 6}, tags: map[string]string{"highway": "primary"}},
+		{refs: []int64{1, 4}, tags: map[string]string{"highway": "footway"}},
+		{refs: []int64{4, 7}, tags: map[string]string{"highway": "service", "oneway": "yes"}},
+	}
+	graph, err := Read(bytes.NewReader(encodePBF(t, nodes, ways)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return graph
+}
+
+func TestRouteAroundRiver(t *testing.T) {
+	graph := riverTown(t)
+	if graph.Vertices() != 7 {
+		t.Fatalf("expected 7 vertices, got %d", graph.Vertices())
+	}
+	west := &lastmilev1.LatLng{Latitude: 12.970, Longitude: 77.590}
+	east := &lastmilev1.LatLng{Latitude: 12.970, Longitude: 77.600}
+
+	route, err := graph.Route(west, east, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Up 2.2 km, across 1.1 km and back down 2.2 km, versus 1.1 km straight.
+	if route.DistanceMeters < 5450 || route.DistanceMeters > 5600 {
+		t.Fatalf("expected the route over the bridge (~5.5 km), got %.0f m", route.DistanceMeters)
+	}
+	if len(route.Points) != 8 {
+		t.Fatalf("expected both endpoints and 6 vertices, got %d points", len(route.Points))
+	}
+	// 2.2 km at 40 km/h, 1.1 km at 50 km/h and 2.2 km at 30 km/h.
+	seconds := 2224/(40/3.6) + 1085/(50/3.6) + 2224/(30/3.6)
+	want := time.Duration(seconds * float64(time.Second))
+	if diff := route.Duration - want; diff < -10*time.Second || diff > 10*time.Second {
+		t.Fatalf("expected about %s, got %s", want, route.Duration)
+	}
+	slow, err := graph.Route(west, east, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if slow.Duration <= route.Duration {
+		t.Fatalf("expected a 20 km/h cap to slow the route, got %s vs %s", slow.Duration, route.Duration)
+	}
+
+	lane := &lastmilev1.LatLng{Latitude: 12.970, Longitude: 77.605}
+	if _, err := graph.Route(east, lane, 0); err != nil {
+		t.Fatalf("expected the one-way lane to be drivable forwards: %v", err)
+	}
+	if _, err := graph.Route(lane, east, 0); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("expected no route against the one-way lane, got %v", err)
+	}
+	if _, err := graph.Route(west, &lastmilev1.LatLng{Latitude: 13.5, Longitude: 77.59}, 0); !errors.Is(err, ErrNoRoad) {
+		t.Fatalf("expected a point far from roads to be rejected, got %v", err)
+	}
+}
+
+func TestEstimatorScalesByProfile(t *testing.T) {
+	graph := riverTown(t)
+	estimator := Estimator{Graph: graph, Profile: eta.Profile{
+		DefaultKmh: 60,
+		Windows:    []eta.Window{{Start: 8 * time.Hour, End: 10 * time.Hour, Factor: 0.5}},
+	}}
+	west := &lastmilev1.LatLng{Latitude: 12.970, Longitude: 77.590}
+	east := &lastmilev1.LatLng{Latitude: 12.970, Longitude: 77.600}
+	ctx := context.Background()
+	offPeak, err := estimator.Estimate(ctx, west, east, lastmilev1.VehicleType_VEHICLE_TYPE_CAB, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	peak, err := estimator.Estimate(ctx, west, east, lastmilev1.VehicleType_VEHICLE_TYPE_CAB, time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if peak.Duration < 2*offPeak.Duration-time.Second || peak.Duration > 2*offPeak.Duration+time.Second {
+		t.Fatalf("expected rush hour to double the time, got %s vs %s", peak.Duration, offPeak.Duration)
+	}
+	if offPeak.Polyline == "" || offPeak.DistanceMeters != peak.DistanceMeters {
+		t.Fatalf("expected the same road route with a polyline, got %+v and %+v", offPeak, peak)
+	}
+	distance, err := graph.RouteDistance(ctx, west, east)
+	if err != nil || distance != offPeak.DistanceMeters {
+		t.Fatalf("expected RouteDistance %.0f, got %.0f, %v", offPeak.DistanceMeters, distance, err)
+	}
+}
+
+func TestReadRejectsUnsupportedFeatures(t *testing.T) {
+	data := encodePBF(t, []testNode{{1, 0, 0}, {2, 0, 0.001}}, []testWay{{refs: []int64{1, 2}, tags: map[string]string{"highway": "road"}}}, "HistoricalInformation")
+	if _, err := Read(bytes.NewReader(data)); err == nil {
+		t.Fatalf("expected an error for a history extract")
+	}
+	data = encodePBF(t, []testNode{{1, 0, 0}, {2, 0, 0.001}}, []testWay{{refs: []int64{1, 2}, tags: map[string]string{"highway": "footway"}}})
+	if _, err := Read(bytes.NewReader(data)); err == nil {
+		t.Fatalf("expected an error for an extract without roads")
+	}
+}
+
+func TestDecodeBlobRejectsNegativeRawSize(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte("data"))
+	zw.Close()
+	blob := protowire.AppendTag(nil, 2, protowire.VarintType)
+	blob = protowire.AppendVarint(blob, 1<<63)
+	blob = protowire.AppendTag(blob, 3, protowire.BytesType)
+	blob = protowire.AppendBytes(blob, compressed.Bytes())
+	if _, err := decodeBlob(blob); err == nil {
+		t.Fatalf("expected an error for a negative raw size")
+	}
+}
+
+func TestEncodePolyline(t *testing.T) {
+	got := EncodePolyline([]*lastmilev1.LatLng{
+		{Latitude: 38.5, Longitude: -120.2},
+		{Latitude: 40.7, Longitude: -120.95},
+		{Latitude: 43.252, Longitude: -126.453},
+	})
+	if want := "_p~iF~ps|U_ulLnnqC_mqNvxq`@"; got != want {
+		t.Fatalf("EncodePolyline = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+// Package sequencing orders the drop-offs of a pooled trip. Small pools are
+// solved exactly by searching every order; larger ones start from a nearest
+// neighbour tour and improve it by moving and reversing stops.
+package sequencing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+// ExactLimit is the largest number of stops ordered by exhaustive search,
+// at most 8! orders.
+const ExactLimit = 8
+
+// maxPasses bounds the local search for pools above ExactLimit.
+const maxPasses = 50
+
+// Order returns the order to visit the stops in. times[i][j] is the travel
+// time from point i to point j, where point 0 is the start and point k+1 is
+// stop k; riders[k] is how many riders get off at stop k. Unspecified
+// objectives minimize total ride time.
+func Order(times [][]time.Duration, riders []int, objective lastmilev1.DropoffObjective) []int {
+	n := len(riders)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	if n < 2 {
+		return order
+	}
+	p := problem{times: times, riders: riders, objective: objective}
+	if n <= ExactLimit {
+		return p.exact()
+	}
+	return p.improve(p.nearestNeighbour())
+}
+
+// Arrivals returns the time from the start until each stop in order is
+// reached.
+func Arrivals(times [][]time.Duration, order []int) []time.Duration {
+	arrivals := make([]time.Duration, len(order))
+	var elapsed time.Duration
+	prev := 0
+	for i, stop := range order {
+		elapsed += times[prev][stop+1]
+		arrivals[i] = elapsed
+		prev = stop + 1
+	}
+	return arrivals
+}
+
+// ParseObjective reads an objective name without its prefix, e.g.
+// "max_delay".
+func ParseObjective(value string) (lastmilev1.DropoffObjective, error) {
+	objective, ok := lastmilev1.DropoffObjective_value["DROPOFF_OBJECTIVE_"+strings.ToUpper(strings.TrimSpace(value))]
+	if !ok || objective == 0 {
+		return 0, fmt.Errorf("unknown drop-off objective %q", value)
+	}
+	return lastmilev1.DropoffObjective(objective), nil
+}
+
+type problem struct {
+	times     [][]time.Duration
+	riders    []int
+	objective lastmilev1.DropoffObjective
+}
+
+// cost scores a complete or partial order. Both parts only grow as stops are
+// appended, which lets the exact search prune. The second part breaks ties.
+type cost struct {
+	primary, secondary time.Duration
+}
+
+func (c cost) less(o cost) bool {
+	return c.primary < o.primary || c.primary == o.primary && c.secondary < o.secondary
+}
+
+func (p problem) cost(order []int) cost {
+	var c cost
+	for i, arrival := range Arrivals(p.times, order) {
+		stop := order[i]
+		rideTime := time.Duration(max(p.riders[stop], 1)) * arrival
+		if p.objective == lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_MAX_DELAY {
+			c.primary = max(c.primary, arrival-p.times[0][stop+1])
+			c.secondary += rideTime
+		} else {
+			c.primary += rideTime
+			c.secondary = arrival
+		}
+	}
+	return c
+}
+
+func (p problem) exact() []int {
+	n := len(p.riders)
+	var best []int
+	var bestCost cost
+	order := make([]int, 0, n)
+	used := make([]bool, n)
+	var search func()
+	search = func() {
+		c := p.cost(order)
+		if best != nil && !c.less(bestCost) {
+			return
+		}
+		if len(order) == n {
+			best, bestCost = append(best[:0], order...), c
+			return
+		}
+		for stop := range n {
+			if used[stop] {
+				continue
+			}
+			used[stop] = true
+			order = append(order, stop)
+			search()
+			order = order[:len(order)-1]
+			used[stop] = false
+		}
+	}
+	search()
+	return best
+}
+
+func (p problem) nearestNeighbour() []int {
+	n := len(p.riders)
+	order := make([]int, 0, n)
+	used := make([]bool, n)
+	prev := 0
+	for len(order) < n {
+		next := -1
+		for stop := range n {
+			if !used[stop] && (next < 0 || p.times[prev][stop+1] < p.times[prev][next+1]) {
+				next = stop
+			}
+		}
+		used[next] = true
+		order = append(order, next)
+		prev = next + 1
+	}
+	return order
+}
+
+// improve moves single stops and reverses runs of stops while that lowers
+// the cost.
+func (p problem) improve(order []int) []int {
+	n := len(order)
+	best := p.cost(order)
+	candidate := make([]int, n)
+	for range maxPasses {
+		improved := false
+		for i := range n {
+			for j := range n {
+				if i == j {
+					continue
+				}
+				// Move the stop at i to position j.
+				copy(candidate, order)
+				stop := candidate[i]
+				if i < j {
+					copy(candidate[i:j], candidate[i+1:j+1])
+				} else {
+					copy(candidate[j+1:i+1], candidate[j:i])
+				}
+				candidate[j] = stop
+				if c := p.cost(candidate); c.less(best) {
+					copy(order, candidate)
+					best, improved = c, true
+				}
+				if i < j {
+					// Reverse the stops from i to j.
+					copy(candidate, order)
+					for a, b := i, j; a < b; a, b = a+1, b-1 {
+						candidate[a], candidate[b] = candidate[b], candidate[a]
+					}
+					if c := p.cost(candidate); c.less(best) {
+						copy(order, candidate)
+						best, improved = c, true
+					}
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return order
+}
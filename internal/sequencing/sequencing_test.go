@@ -0,0 +1,115 @@
+package sequencing
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+// lineTimes places the start at 0 and stop k at positions[k] on a road,
+// one minute per unit.
+func lineTimes(positions []float64) [][]time.Duration {
+	points := append([]float64{0}, positions...)
+	return planeTimes(points, make([]float64, len(points)))
+}
+
+func planeTimes(xs, ys []float64) [][]time.Duration {
+	times := make([][]time.Duration, len(xs))
+	for i := range xs {
+		times[i] = make([]time.Duration, len(xs))
+		for j := range xs {
+			times[i][j] = time.Duration(math.Hypot(xs[i]-xs[j], ys[i]-ys[j]) * float64(time.Minute))
+		}
+	}
+	return times
+}
+
+func TestOrderObjectives(t *testing.T) {
+	// Three riders get off 5 minutes west, one 4 minutes east.
+	times := lineTimes([]float64{-5, 4})
+	riders := []int{3, 1}
+
+	// West first: 3*5 + 14 = 29 rider-minutes, against 4 + 3*13 = 43.
+	if got := Order(times, riders, lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_TOTAL_RIDE_TIME); !slices.Equal(got, []int{0, 1}) {
+		t.Fatalf("expected west first for total ride time, got %v", got)
+	}
+	// East first delays the west riders 8 minutes, against 10 for the east
+	// rider the other way round.
+	if got := Order(times, riders, lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_MAX_DELAY); !slices.Equal(got, []int{1, 0}) {
+		t.Fatalf("expected east first for max delay, got %v", got)
+	}
+	arrivals := Arrivals(times, []int{1, 0})
+	if arrivals[0] != 4*time.Minute || arrivals[1] != 13*time.Minute {
+		t.Fatalf("unexpected arrivals %v", arrivals)
+	}
+}
+
+func TestOrderHeuristicNearExact(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for round := range 20 {
+		xs, ys := []float64{0}, []float64{0}
+		riders := make([]int, ExactLimit)
+		for i := range riders {
+			xs = append(xs, rng.Float64()*20-10)
+			ys = append(ys, rng.Float64()*20-10)
+			riders[i] = 1 + rng.Intn(3)
+		}
+		for _, objective := range []lastmilev1.DropoffObjective{
+			lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_TOTAL_RIDE_TIME,
+			lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_MAX_DELAY,
+		} {
+			p := problem{times: planeTimes(xs, ys), riders: riders, objective: objective}
+			exact := p.cost(p.exact()).primary
+			heuristic := p.cost(p.improve(p.nearestNeighbour())).primary
+			if heuristic < exact {
+				t.Fatalf("round %d %s: heuristic %s beat the exact search %s", round, objective, heuristic, exact)
+			}
+			if float64(heuristic) > 1.25*float64(exact) {
+				t.Fatalf("round %d %s: heuristic %s is far from optimal %s", round, objective, heuristic, exact)
+			}
+		}
+	}
+}
+
+func TestOrderLargePool(t *testing.T) {
+	positions := []float64{7, -1, 3, 12, 5, -2, 9, 1, 11, 4, 8, 6}
+	riders := make([]int, len(positions))
+	for i := range riders {
+		riders[i] = 1
+	}
+	order := Order(lineTimes(positions), riders, lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_TOTAL_RIDE_TIME)
+	if len(order) != len(positions) {
+		t.Fatalf("expected every stop once, got %v", order)
+	}
+	seen := make(map[int]bool)
+	for _, stop := range order {
+		seen[stop] = true
+	}
+	if len(seen) != len(positions) {
+		t.Fatalf("expected every stop once, got %v", order)
+	}
+	// The two stops just behind the start go first, then the rest eastwards.
+	var got []float64
+	for _, stop := range order {
+		got = append(got, positions[stop])
+	}
+	want := []float64{-1, -2, 1, 3, 4, 5, 6, 7, 8, 9, 11, 12}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseObjective(t *testing.T) {
+	if got, err := ParseObjective(" max_delay "); err != nil || got != lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_MAX_DELAY {
+		t.Fatalf("unexpected result %v, %v", got, err)
+	}
+	for _, value := range []string{"", "unspecified", "fastest"} {
+		if _, err := ParseObjective(value); err == nil {
+			t.Fatalf("expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type AreaStore interface {
+	Upsert(ctx context.Context, area *lastmilev1.ServiceArea) error
+	Get(ctx context.Context, areaID string) (*lastmilev1.ServiceArea, error)
+	Delete(ctx context.Context, areaID string) error
+	// List pages areas by id like StationStore.List.
+	List(ctx context.Context, after string, limit int) ([]*lastmilev1.ServiceArea, string, error)
+	// Locate returns the areas whose boundary contains point, ordered by id.
+	Locate(ctx context.Context, point *lastmilev1.LatLng) ([]*lastmilev1.ServiceArea, error)
+}
+
+type DestinationStore interface {
+	Upsert(ctx context.Context, destination *lastmilev1.Destination) error
+	Get(ctx context.Context, destinationID string) (*lastmilev1.Destination, error)
+	Delete(ctx context.Context, destinationID string) error
+	List(ctx context.Context, after string, limit int) ([]*lastmilev1.Destination, string, error)
+}
+
+type MemoryAreaStore struct {
+	mu    sync.RWMutex
+	areas map[string]*lastmilev1.ServiceArea
+	ids   sortedIDs
+}
+
+func NewMemoryAreaStore() *MemoryAreaStore {
+	return &MemoryAreaStore{areas: make(map[string]*lastmilev1.ServiceArea)}
+}
+
+func (s *MemoryAreaStore) Upsert(_ context.Context, area *lastmilev1.ServiceArea) error {
+	if area == nil || area.AreaId == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	s.areas[area.AreaId] = cloneArea(area)
+	s.ids.add(area.AreaId)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryAreaStore) Get(_ context.Context, areaID string) (*lastmilev1.ServiceArea, error) {
+	if areaID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	area, ok := s.areas[areaID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneArea(area), nil
+}
+
+func (s *MemoryAreaStore) Delete(_ context.Context, areaID string) error {
+	if areaID == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.areas[areaID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.areas, areaID)
+	s.ids.remove(areaID)
+	return nil
+}
+
+func (s *MemoryAreaStore) List(_ context.Context, after string, limit int) ([]*lastmilev1.ServiceArea, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page := newKeysetPage[*lastmilev1.ServiceArea](limit)
+	for _, id := range s.ids.after(after) {
+		if !page.add(id, cloneArea(s.areas[id])) {
+			break
+		}
+	}
+	return page.items, page.next, nil
+}
+
+func (s *MemoryAreaStore) Locate(_ context.Context, point *lastmilev1.LatLng) ([]*lastmilev1.ServiceArea, error) {
+	if point == nil {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var areas []*lastmilev1.ServiceArea
+	for _, id := range s.ids {
+		if area := s.areas[id]; polygonContains(area.Boundary, point) {
+			areas = append(areas, cloneArea(area))
+		}
+	}
+	return areas, nil
+}
+
+type MemoryDestinationStore struct {
+	mu           sync.RWMutex
+	destinations map[string]*lastmilev1.Destination
+	ids          sortedIDs
+}
+
+func NewMemoryDestinationStore() *MemoryDestinationStore {
+	return &MemoryDestinationStore{destinations: make(map[string]*lastmilev1.Destination)}
+}
+
+func (s *MemoryDestinationStore) Upsert(_ context.Context, destination *lastmilev1.Destination) error {
+	if destination == nil || destination.DestinationId == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	s.destinations[destination.DestinationId] = cloneDestination(destination)
+	s.ids.add(destination.DestinationId)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryDestinationStore) Get(_ context.Context, destinationID string) (*lastmilev1.Destination, error) {
+	if destinationID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	destination, ok := s.destinations[destinationID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneDestination(destination), nil
+}
+
+func (s *MemoryDestinationStore) Delete(_ context.Context, destinationID string) error {
+	if destinationID == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.destinations[destinationID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.destinations, destinationID)
+	s.ids.remove(destinationID)
+	return nil
+}
+
+func (s *MemoryDestinationStore) List(_ context.Context, after string, limit int) ([]*lastmilev1.Destination, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page := newKeysetPage[*lastmilev1.Destination](limit)
+	for _, id := range s.ids.after(after) {
+		if !page.add(id, cloneDestination(s.destinations[id])) {
+			break
+		}
+	}
+	return page.items, page.next, nil
+}
+
+// polygonContains reports whether point lies inside the ring, treating
+// latitude and longitude as planar coordinates (even-odd rule). Service areas
+// are city sized, so the difference from geodesic edges is negligible.
+func polygonContains(ring []*lastmilev1.LatLng, point *lastmilev1.LatLng) bool {
+	if len(ring) < 3 || point == nil {
+		return false
+	}
+	inside := false
+	j := len(ring) - 1
+	for i := range ring {
+		a, b := ring[i], ring[j]
+		if (a.Latitude > point.Latitude) != (b.Latitude > point.Latitude) {
+			crossing := (b.Longitude-a.Longitude)*(point.Latitude-a.Latitude)/(b.Latitude-a.Latitude) + a.Longitude
+			if point.Longitude < crossing {
+				inside = !inside
+			}
+		}
+		j = i
+	}
+	return inside
+}
+
+func cloneArea(area *lastmilev1.ServiceArea) *lastmilev1.ServiceArea {
+	if area == nil {
+		return nil
+	}
+	return proto.Clone(area).(*lastmilev1.ServiceArea)
+}
+
+func cloneDestination(destination *lastmilev1.Destination) *lastmilev1.Destination {
+	if destination == nil {
+		return nil
+	}
+	return proto.Clone(destination).(*lastmilev1.Destination)
+}
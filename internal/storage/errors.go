@@ -6,4 +6,17 @@ var (
 	ErrAlreadyExists   = errors.New("already exists")
 	ErrNotFound        = errors.New("not found")
 	ErrInvalidArgument = errors.New("invalid argument")
+	ErrPhoneInUse      = errors.New("phone already in use")
+	ErrPlateInUse      = errors.New("plate already in use")
+	// ErrVehicleInUse means another active driver is assigned the vehicle.
+	ErrVehicleInUse = errors.New("vehicle already in use")
+	// ErrInsufficientFunds means a ledger posting would overdraw an account.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrLimitReached means a counter is already at its limit.
+	ErrLimitReached = errors.New("limit reached")
+	// ErrQuoteUsed means another ride request already locked the quote.
+	ErrQuoteUsed = errors.New("quote already used")
+	// ErrStatusChanged means a conditional write found a record no longer in
+	// the status it expected.
+	ErrStatusChanged = errors.New("status changed")
 )
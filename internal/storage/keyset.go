@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sortedIDs keeps ids in order so memory stores can page by key without
+// re-sorting on every List call.
+type sortedIDs []string
+
+func (ids *sortedIDs) add(id string) {
+	i, found := slices.BinarySearch(*ids, id)
+	if !found {
+		*ids = slices.Insert(*ids, i, id)
+	}
+}
+
+func (ids *sortedIDs) remove(id string) {
+	if i, found := slices.BinarySearch(*ids, id); found {
+		*ids = slices.Delete(*ids, i, i+1)
+	}
+}
+
+// after returns the ids strictly greater than key; an empty key means from
+// the start.
+func (ids sortedIDs) after(key string) []string {
+	if key == "" {
+		return ids
+	}
+	i, found := slices.BinarySearch(ids, key)
+	if found {
+		i++
+	}
+	return ids[i:]
+}
+
+// keysetPage collects up to limit items of a key-ordered scan. Next is the
+// key to resume after, set only once an item beyond the page has been seen.
+type keysetPage[T any] struct {
+	limit   int
+	items   []T
+	lastKey string
+	next    string
+}
+
+func newKeysetPage[T any](limit int) *keysetPage[T] {
+	return &keysetPage[T]{limit: limit}
+}
+
+// add appends item and reports whether the scan should continue.
+func (p *keysetPage[T]) add(key string, item T) bool {
+	if len(p.items) == p.limit {
+		p.next = p.lastKey
+		return false
+	}
+	p.items = append(p.items, item)
+	p.lastKey = key
+	return true
+}
+
+// scanLex walks a sorted set index whose members all share one score, in id
+// order after the given key, loading payloads in batches with ZRANGEBYLEX and
+// MGET. Ids whose payload is gone are skipped. visit returns false to stop.
+func scanLex(ctx context.Context, client *redis.Client, indexKey string, key func(string) string, after string, batch int, visit func(id string, data []byte) (bool, error)) error {
+	for {
+		start := "-"
+		if after != "" {
+			start = "(" + after
+		}
+		ids, err := client.ZRangeByLex(ctx, indexKey, &redis.ZRangeBy{Min: start, Max: "+", Count: int64(batch)}).Result()
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = key(id)
+		}
+		values, err := client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			data, ok := redisValueBytes(value)
+			if !ok {
+				continue
+			}
+			more, err := visit(ids[i], data)
+			if err != nil || !more {
+				return err
+			}
+		}
+		if len(ids) < batch {
+			return nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// findKeysetPage runs query ordered by _id, starting after the given id, and
+// converts each document of type D with convert, which returns the id too.
+func findKeysetPage[D any, T any](ctx context.Context, collection *mongo.Collection, query bson.M, after string, limit int, convert func(*D) (string, T)) ([]T, string, error) {
+	if after != "" {
+		query["_id"] = bson.M{"$gt": after}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit + 1))
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cursor.Close(ctx)
+
+	page := newKeysetPage[T](limit)
+	for cursor.Next(ctx) {
+		var doc D
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, "", err
+		}
+		if !page.add(convert(&doc)) {
+			break
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, "", err
+	}
+	return page.items, page.next, nil
+}
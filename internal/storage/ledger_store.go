@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// LedgerStore is a double-entry ledger: every transaction's entries sum to
+// zero per currency and an account's balance is the sum of its entries.
+type LedgerStore interface {
+	// Post records tx and applies its entries to the account balances
+	// atomically. An account keeps the currency of its first entry; the
+	// accounts listed in noOverdraft may not go below zero
+	// (ErrInsufficientFunds). If tx's idempotency key was posted before,
+	// nothing is applied and the stored transaction is returned with
+	// ErrAlreadyExists.
+	Post(ctx context.Context, tx *lastmilev1.LedgerTransaction, noOverdraft ...string) (*lastmilev1.LedgerTransaction, error)
+	GetTransactionByKey(ctx context.Context, idempotencyKey string) (*lastmilev1.LedgerTransaction, error)
+	GetAccount(ctx context.Context, accountID string) (*lastmilev1.LedgerAccount, error)
+	// ListTransactions pages the transactions touching an account by
+	// transaction id, which callers make time ordered.
+	ListTransactions(ctx context.Context, accountID, after string, limit int) ([]*lastmilev1.LedgerTransaction, string, error)
+	// Check recomputes every balance from the transactions.
+	Check(ctx context.Context) (LedgerCheck, error)
+}
+
+// LedgerCheck is what LedgerStore.Check found. The ledger is consistent when
+// Problems is empty.
+type LedgerCheck struct {
+	Transactions int64
+	Accounts     int64
+	Problems     []string
+}
+
+type MemoryLedgerStore struct {
+	mu           sync.RWMutex
+	transactions map[string]*lastmilev1.LedgerTransaction
+	keys         map[string]string
+	accounts     map[string]*lastmilev1.LedgerAccount
+	byAccount    map[string]*sortedIDs
+}
+
+func NewMemoryLedgerStore() *MemoryLedgerStore {
+	return &MemoryLedgerStore{
+		transactions: make(map[string]*lastmilev1.LedgerTransaction),
+		keys:         make(map[string]string),
+		accounts:     make(map[string]*lastmilev1.LedgerAccount),
+		byAccount:    make(map[string]*sortedIDs),
+	}
+}
+
+func (s *MemoryLedgerStore) Post(_ context.Context, tx *lastmilev1.LedgerTransaction, noOverdraft ...string) (*lastmilev1.LedgerTransaction, error) {
+	deltas, err := ledgerDeltas(tx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.keys[tx.IdempotencyKey]; ok {
+		return proto.Clone(s.transactions[id]).(*lastmilev1.LedgerTransaction), ErrAlreadyExists
+	}
+	if _, ok := s.transactions[tx.TransactionId]; ok {
+		return nil, ErrAlreadyExists
+	}
+	for _, delta := range deltas {
+		account, ok := s.accounts[delta.accountID]
+		if ok && account.Balance.CurrencyCode != delta.currency {
+			return nil, fmt.Errorf("%w: account %s holds %s", ErrInvalidArgument, delta.accountID, account.Balance.CurrencyCode)
+		}
+		if delta.amount < 0 && slices.Contains(noOverdraft, delta.accountID) && account.GetBalance().GetAmountMinor()+delta.amount < 0 {
+			return nil, ErrInsufficientFunds
+		}
+	}
+	for _, delta := range deltas {
+		account, ok := s.accounts[delta.accountID]
+		if !ok {
+			account = &lastmilev1.LedgerAccount{AccountId: delta.accountID, Balance: &lastmilev1.Money{CurrencyCode: delta.currency}}
+			s.accounts[delta.accountID] = account
+			s.byAccount[delta.accountID] = &sortedIDs{}
+		}
+		account.Balance.AmountMinor += delta.amount
+		s.byAccount[delta.accountID].add(tx.TransactionId)
+	}
+	s.transactions[tx.TransactionId] = proto.Clone(tx).(*lastmilev1.LedgerTransaction)
+	s.keys[tx.IdempotencyKey] = tx.TransactionId
+	return proto.Clone(tx).(*lastmilev1.LedgerTransaction), nil
+}
+
+func (s *MemoryLedgerStore) GetTransactionByKey(_ context.Context, idempotencyKey string) (*lastmilev1.LedgerTransaction, error) {
+	if idempotencyKey == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.keys[idempotencyKey]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(s.transactions[id]).(*lastmilev1.LedgerTransaction), nil
+}
+
+func (s *MemoryLedgerStore) GetAccount(_ context.Context, accountID string) (*lastmilev1.LedgerAccount, error) {
+	if accountID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	account, ok := s.accounts[accountID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(account).(*lastmilev1.LedgerAccount), nil
+}
+
+func (s *MemoryLedgerStore) ListTransactions(_ context.Context, accountID, after string, limit int) ([]*lastmilev1.LedgerTransaction, string, error) {
+	if accountID == "" || limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page := newKeysetPage[*lastmilev1.LedgerTransaction](limit)
+	if ids, ok := s.byAccount[accountID]; ok {
+		for _, id := range ids.after(after) {
+			if !page.add(id, proto.Clone(s.transactions[id]).(*lastmilev1.LedgerTransaction)) {
+				break
+			}
+		}
+	}
+	return page.items, page.next, nil
+}
+
+func (s *MemoryLedgerStore) Check(_ context.Context) (LedgerCheck, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	checker := newLedgerChecker()
+	for _, tx := range s.transactions {
+		checker.addTransaction(tx)
+	}
+	for _, account := range s.accounts {
+		checker.addAccount(account)
+	}
+	return checker.result(), nil
+}
+
+type ledgerDelta struct {
+	accountID string
+	currency  string
+	amount    int64
+}
+
+// ledgerDeltas validates tx and nets its entries per account, in account id
+// order.
+func ledgerDeltas(tx *lastmilev1.LedgerTransaction) ([]ledgerDelta, error) {
+	if tx == nil || tx.TransactionId == "" || tx.IdempotencyKey == "" || len(tx.Entries) < 2 {
+		return nil, ErrInvalidArgument
+	}
+	sums := make(map[string]int64)
+	byAccount := make(map[string]*ledgerDelta)
+	for _, entry := range tx.Entries {
+		if entry.GetAccountId() == "" || entry.GetAmount().GetCurrencyCode() == "" {
+			return nil, ErrInvalidArgument
+		}
+		currency := entry.Amount.CurrencyCode
+		sums[currency] += entry.Amount.AmountMinor
+		delta, ok := byAccount[entry.AccountId]
+		if !ok {
+			delta = &ledgerDelta{accountID: entry.AccountId, currency: currency}
+			byAccount[entry.AccountId] = delta
+		}
+		if delta.currency != currency {
+			return nil, fmt.Errorf("%w: account %s has entries in two currencies", ErrInvalidArgument, entry.AccountId)
+		}
+		delta.amount += entry.Amount.AmountMinor
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return nil, fmt.Errorf("%w: %s entries sum to %d", ErrInvalidArgument, currency, sum)
+		}
+	}
+	deltas := make([]ledgerDelta, 0, len(byAccount))
+	for _, delta := range byAccount {
+		deltas = append(deltas, *delta)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].accountID < deltas[j].accountID
+	})
+	return deltas, nil
+}
+
+// ledgerChecker replays transactions into balances and compares them with
+// the stored accounts.
+type ledgerChecker struct {
+	check    LedgerCheck
+	expected map[string]*lastmilev1.Money
+	stored   map[string]*lastmilev1.Money
+}
+
+func newLedgerChecker() *ledgerChecker {
+	return &ledgerChecker{expected: make(map[string]*lastmilev1.Money), stored: make(map[string]*lastmilev1.Money)}
+}
+
+func (c *ledgerChecker) addTransaction(tx *lastmilev1.LedgerTransaction) {
+	c.check.Transactions++
+	sums := make(map[string]int64)
+	for _, entry := range tx.Entries {
+		currency := entry.GetAmount().GetCurrencyCode()
+		sums[currency] += entry.GetAmount().GetAmountMinor()
+		balance, ok := c.expected[entry.GetAccountId()]
+		if !ok {
+			balance = &lastmilev1.Money{CurrencyCode: currency}
+			c.expected[entry.GetAccountId()] = balance
+		}
+		if balance.CurrencyCode != currency {
+			c.problemf("transaction %s: account %s mixes %s and %s", tx.TransactionId, entry.GetAccountId(), balance.CurrencyCode, currency)
+			continue
+		}
+		balance.AmountMinor += entry.GetAmount().GetAmountMinor()
+	}
+	for _, currency := range slices.Sorted(maps.Keys(sums)) {
+		if sums[currency] != 0 {
+			c.problemf("transaction %s: %s entries sum to %d", tx.TransactionId, currency, sums[currency])
+		}
+	}
+}
+
+func (c *ledgerChecker) addAccount(account *lastmilev1.LedgerAccount) {
+	c.check.Accounts++
+	c.stored[account.AccountId] = account.GetBalance()
+}
+
+func (c *ledgerChecker) result() LedgerCheck {
+	for _, accountID := range slices.Sorted(maps.Keys(c.stored)) {
+		stored := c.stored[accountID]
+		expected, ok := c.expected[accountID]
+		if !ok {
+			expected = &lastmilev1.Money{CurrencyCode: stored.GetCurrencyCode()}
+		}
+		if stored.GetCurrencyCode() != expected.CurrencyCode || stored.GetAmountMinor() != expected.AmountMinor {
+			c.problemf("account %s: balance %d %s, entries sum to %d %s", accountID, stored.GetAmountMinor(), stored.GetCurrencyCode(), expected.AmountMinor, expected.CurrencyCode)
+		}
+	}
+	for _, accountID := range slices.Sorted(maps.Keys(c.expected)) {
+		if _, ok := c.stored[accountID]; !ok {
+			c.problemf("account %s: has entries but no balance", accountID)
+		}
+	}
+	sort.Strings(c.check.Problems)
+	return c.check
+}
+
+func (c *ledgerChecker) problemf(format string, args ...any) {
+	c.check.Problems = append(c.check.Problems, fmt.Sprintf(format, args...))
+}
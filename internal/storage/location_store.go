@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type LocationStore interface {
+	UpsertLocation(ctx context.Context, update *lastmilev1.LocationUpdate) error
+	GetLocation(ctx context.Context, driverID string) (*lastmilev1.LocationUpdate, error)
+	ListLocations(ctx context.Context) ([]*lastmilev1.LocationUpdate, error)
+}
+
+type MemoryLocationStore struct {
+	mu        sync.RWMutex
+	locations map[string]*lastmilev1.LocationUpdate
+}
+
+func NewMemoryLocationStore() *MemoryLocationStore {
+	return &MemoryLocationStore{locations: make(map[string]*lastmilev1.LocationUpdate)}
+}
+
+func (s *MemoryLocationStore) UpsertLocation(_ context.Context, update *lastmilev1.LocationUpdate) error {
+	if update == nil || update.DriverId == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	s.locations[update.DriverId] = proto.Clone(update).(*lastmilev1.LocationUpdate)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryLocationStore) GetLocation(_ context.Context, driverID string) (*lastmilev1.LocationUpdate, error) {
+	if driverID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	update, ok := s.locations[driverID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(update).(*lastmilev1.LocationUpdate), nil
+}
+
+func (s *MemoryLocationStore) ListLocations(_ context.Context) ([]*lastmilev1.LocationUpdate, error) {
+	s.mu.RLock()
+	updates := make([]*lastmilev1.LocationUpdate, 0, len(s.locations))
+	for _, update := range s.locations {
+		updates = append(updates, proto.Clone(update).(*lastmilev1.LocationUpdate))
+	}
+	s.mu.RUnlock()
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].DriverId < updates[j].DriverId
+	})
+	return updates, nil
+}
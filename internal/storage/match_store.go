@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// MatchStore creates a matched trip and updates its ride request together, so
+// a failed match leaves neither behind and a request is matched once.
+type MatchStore interface {
+	// CreateMatch stores the new trip and request. It returns
+	// ErrAlreadyExists if the trip exists and ErrNotFound if the stored
+	// request is missing or no longer pending.
+	CreateMatch(ctx context.Context, trip *lastmilev1.Trip, request *lastmilev1.RideRequest, messages ...OutboxMessage) error
+	// CancelMatch cancels a SCHEDULED trip and moves its MATCHED request to
+	// requestStatus; a canceled request gets the cancellation too. Only those
+	// fields change. It returns ErrStatusChanged if either has left that
+	// status.
+	CancelMatch(ctx context.Context, tripID, requestID string, cancellation *lastmilev1.Cancellation, requestStatus lastmilev1.RideStatus, messages ...OutboxMessage) error
+}
+
+type MemoryMatchStore struct {
+	trips    *MemoryTripStore
+	requests *MemoryRideRequestStore
+}
+
+func NewMemoryMatchStore(trips *MemoryTripStore, requests *MemoryRideRequestStore) *MemoryMatchStore {
+	if trips == nil || requests == nil {
+		return nil
+	}
+	return &MemoryMatchStore{trips: trips, requests: requests}
+}
+
+func (s *MemoryMatchStore) CreateMatch(_ context.Context, trip *lastmilev1.Trip, request *lastmilev1.RideRequest, messages ...OutboxMessage) error {
+	if trip == nil || trip.TripId == "" || request == nil || request.RequestId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	s.trips.mu.Lock()
+	defer s.trips.mu.Unlock()
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	if _, ok := s.trips.trips[trip.TripId]; ok {
+		return ErrAlreadyExists
+	}
+	stored, ok := s.requests.requests[request.RequestId]
+	if !ok || stored.Status != lastmilev1.RideStatus_RIDE_STATUS_PENDING {
+		return ErrNotFound
+	}
+	s.trips.trips[trip.TripId] = cloneTrip(trip)
+	s.requests.requests[request.RequestId] = cloneRideRequest(request)
+	s.trips.outbox.append(messages)
+	return nil
+}
+
+func (s *MemoryMatchStore) CancelMatch(_ context.Context, tripID, requestID string, cancellation *lastmilev1.Cancellation, requestStatus lastmilev1.RideStatus, messages ...OutboxMessage) error {
+	if tripID == "" || requestID == "" || cancellation == nil {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	s.trips.mu.Lock()
+	defer s.trips.mu.Unlock()
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	trip, ok := s.trips.trips[tripID]
+	if !ok {
+		return ErrNotFound
+	}
+	request, ok := s.requests.requests[requestID]
+	if !ok {
+		return ErrNotFound
+	}
+	if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED || request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		return ErrStatusChanged
+	}
+	cancelMatch(trip, request, cancellation, requestStatus)
+	s.trips.outbox.append(messages)
+	return nil
+}
+
+func cancelMatch(trip *lastmilev1.Trip, request *lastmilev1.RideRequest, cancellation *lastmilev1.Cancellation, requestStatus lastmilev1.RideStatus) {
+	trip.Status = lastmilev1.TripStatus_TRIP_STATUS_CANCELED
+	trip.Cancellation = proto.Clone(cancellation).(*lastmilev1.Cancellation)
+	trip.DropoffPlan = nil
+	trip.UpdatedAt = cancellation.CanceledAt
+	request.Status = requestStatus
+	if requestStatus == lastmilev1.RideStatus_RIDE_STATUS_CANCELED {
+		request.Cancellation = proto.Clone(cancellation).(*lastmilev1.Cancellation)
+	}
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoAreaStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAreaStore(client *mongo.Client, dbName, collectionName string) *MongoAreaStore {
+	if client == nil {
+		return nil
+	}
+	if dbName == "" {
+		dbName = "lastmile"
+	}
+	if collectionName == "" {
+		collectionName = "service_areas"
+	}
+	return &MongoAreaStore{collection: client.Database(dbName).Collection(collectionName)}
+}
+
+// EnsureIndexes creates the 2dsphere index Locate ($geoIntersects) uses.
+func (s *MongoAreaStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "boundary", Value: "2dsphere"}},
+		Options: options.Index().SetName("boundary_2dsphere"),
+	})
+	return err
+}
+
+func (s *MongoAreaStore) Upsert(ctx context.Context, area *lastmilev1.ServiceArea) error {
+	if area == nil || area.AreaId == "" {
+		return ErrInvalidArgument
+	}
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": area.AreaId}, newAreaDoc(area), options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoAreaStore) Get(ctx context.Context, areaID string) (*lastmilev1.ServiceArea, error) {
+	if areaID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc areaDoc
+	err := s.collection.FindOne(ctx, bson.M{"_id": areaID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toArea(), nil
+}
+
+func (s *MongoAreaStore) Delete(ctx context.Context, areaID string) error {
+	if areaID == "" {
+		return ErrInvalidArgument
+	}
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": areaID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoAreaStore) List(ctx context.Context, after string, limit int) ([]*lastmilev1.ServiceArea, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	return findKeysetPage(ctx, s.collection, bson.M{}, after, limit, func(doc *areaDoc) (string, *lastmilev1.ServiceArea) {
+		return doc.ID, doc.toArea()
+	})
+}
+
+// Locate uses $geoIntersects, whose polygon edges are geodesics rather than
+// the straight lat/lng lines the memory and Redis stores test against.
+func (s *MongoAreaStore) Locate(ctx context.Context, point *lastmilev1.LatLng) ([]*lastmilev1.ServiceArea, error) {
+	if point == nil {
+		return nil, ErrInvalidArgument
+	}
+	query := bson.M{"boundary": bson.M{"$geoIntersects": bson.M{"$geometry": toGeoPointDoc(point)}}}
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var areas []*lastmilev1.ServiceArea
+	for cursor.Next(ctx) {
+		var doc areaDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		areas = append(areas, doc.toArea())
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return areas, nil
+}
+
+type areaDoc struct {
+	ID       string        `bson:"_id"`
+	Name     string        `bson:"name"`
+	Boundary geoPolygonDoc `bson:"boundary"`
+}
+
+// geoPolygonDoc is a GeoJSON polygon with a single, explicitly closed ring.
+type geoPolygonDoc struct {
+	Type        string        `bson:"type"`
+	Coordinates [][][]float64 `bson:"coordinates"`
+}
+
+func newAreaDoc(area *lastmilev1.ServiceArea) areaDoc {
+	ring := make([][]float64, 0, len(area.Boundary)+1)
+	for _, vertex := range area.Boundary {
+		ring = append(ring, []float64{vertex.Longitude, vertex.Latitude})
+	}
+	if len(ring) > 0 {
+		ring = append(ring, ring[0])
+	}
+	return areaDoc{
+		ID:       area.AreaId,
+		Name:     area.Name,
+		Boundary: geoPolygonDoc{Type: "Polygon", Coordinates: [][][]float64{ring}},
+	}
+}
+
+func (d areaDoc) toArea() *lastmilev1.ServiceArea {
+	area := &lastmilev1.ServiceArea{AreaId: d.ID, Name: d.Name}
+	if len(d.Boundary.Coordinates) == 0 {
+		return area
+	}
+	ring := d.Boundary.Coordinates[0]
+	if len(ring) > 1 {
+		ring = ring[:len(ring)-1]
+	}
+	for _, position := range ring {
+		if len(position) == 2 {
+			area.Boundary = append(area.Boundary, &lastmilev1.LatLng{Latitude: position[1], Longitude: position[0]})
+		}
+	}
+	return area
+}
+
+type MongoDestinationStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoDestinationStore(client *mongo.Client, dbName, collectionName string) *MongoDestinationStore {
+	if client == nil {
+		return nil
+	}
+	if dbName == "" {
+		dbName = "lastmile"
+	}
+	if collectionName == "" {
+		collectionName = "destinations"
+	}
+	return &MongoDestinationStore{collection: client.Database(dbName).Collection(collectionName)}
+}
+
+func (s *MongoDestinationStore) Upsert(ctx context.Context, destination *lastmilev1.Destination) error {
+	if destination == nil || destination.DestinationId == "" {
+		return ErrInvalidArgument
+	}
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": destination.DestinationId}, newDestinationDoc(destination), options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoDestinationStore) Get(ctx context.Context, destinationID string) (*lastmilev1.Destination, error) {
+	if destinationID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc destinationDoc
+	err := s.collection.FindOne(ctx, bson.M{"_id": destinationID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toDestination(), nil
+}
+
+func (s *MongoDestinationStore) Delete(ctx context.Context, destinationID string) error {
+	if destinationID == "" {
+		return ErrInvalidArgument
+	}
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": destinationID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoDestinationStore) List(ctx context.Context, after string, limit int) ([]*lastmilev1.Destination, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	return findKeysetPage(ctx, s.collection, bson.M{}, after, limit, func(doc *destinationDoc) (string, *lastmilev1.Destination) {
+		return doc.ID, doc.toDestination()
+	})
+}
+
+type destinationDoc struct {
+	ID       string      `bson:"_id"`
+	Name     string      `bson:"name"`
+	Location geoPointDoc `bson:"location"`
+	AreaID   string      `bson:"area_id,omitempty"`
+}
+
+func newDestinationDoc(destination *lastmilev1.Destination) destinationDoc {
+	return destinationDoc{
+		ID:       destination.DestinationId,
+		Name:     destination.Name,
+		Location: toGeoPointDoc(destination.Location),
+		AreaID:   destination.AreaId,
+	}
+}
+
+func (d destinationDoc) toDestination() *lastmilev1.Destination {
+	return &lastmilev1.Destination{
+		DestinationId: d.ID,
+		Name:          d.Name,
+		Location:      d.Location.toLatLng(),
+		AreaId:        d.AreaID,
+	}
+}
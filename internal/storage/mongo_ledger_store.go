@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MongoLedgerStore keeps transactions and account balances in two
+// collections, written together in one transaction, so it needs a replica
+// set.
+type MongoLedgerStore struct {
+	transactions *mongo.Collection
+	accounts     *mongo.Collection
+}
+
+func NewMongoLedgerStore(client *mongo.Client, dbName, transactionCollection, accountCollection string) *MongoLedgerStore {
+	if client == nil {
+		return nil
+	}
+	if dbName == "" {
+		dbName = "lastmile"
+	}
+	if transactionCollection == "" {
+		transactionCollection = "ledger_transactions"
+	}
+	if accountCollection == "" {
+		accountCollection = "ledger_accounts"
+	}
+	db := client.Database(dbName)
+	return &MongoLedgerStore{transactions: db.Collection(transactionCollection), accounts: db.Collection(accountCollection)}
+}
+
+// EnsureIndexes creates the unique idempotency key index and the index
+// ListTransactions pages an account's transactions with.
+func (s *MongoLedgerStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.transactions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "idempotency_key", Value: 1}},
+			Options: options.Index().SetName("idempotency_key_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "entries.account_id", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("entries_account_id_id"),
+		},
+	})
+	return err
+}
+
+func (s *MongoLedgerStore) Post(ctx context.Context, tx *lastmilev1.LedgerTransaction, noOverdraft ...string) (*lastmilev1.LedgerTransaction, error) {
+	deltas, err := ledgerDeltas(tx)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.transactions.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+	var existing *lastmilev1.LedgerTransaction
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		existing = nil
+		found, err := s.GetTransactionByKey(sc, tx.IdempotencyKey)
+		if err == nil {
+			existing = found
+			return nil, ErrAlreadyExists
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if _, err := s.transactions.InsertOne(sc, newLedgerTransactionDoc(tx)); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, ErrAlreadyExists
+			}
+			return nil, err
+		}
+		for _, delta := range deltas {
+			if err := s.apply(sc, delta, slices.Contains(noOverdraft, delta.accountID)); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if existing != nil {
+		return existing, ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (s *MongoLedgerStore) apply(ctx context.Context, delta ledgerDelta, guarded bool) error {
+	filter := bson.M{"_id": delta.accountID, "currency": delta.currency}
+	update := bson.M{"$inc": bson.M{"balance": delta.amount}}
+	if guarded && delta.amount < 0 {
+		filter["balance"] = bson.M{"$gte": -delta.amount}
+		result, err := s.accounts.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrInsufficientFunds
+		}
+		return nil
+	}
+	_, err := s.accounts.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The upsert only inserts when the account holds another currency.
+		return fmt.Errorf("%w: account %s holds another currency", ErrInvalidArgument, delta.accountID)
+	}
+	return err
+}
+
+func (s *MongoLedgerStore) GetTransactionByKey(ctx context.Context, idempotencyKey string) (*lastmilev1.LedgerTransaction, error) {
+	if idempotencyKey == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc ledgerTransactionDoc
+	err := s.transactions.FindOne(ctx, bson.M{"idempotency_key": idempotencyKey}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toTransaction(), nil
+}
+
+func (s *MongoLedgerStore) GetAccount(ctx context.Context, accountID string) (*lastmilev1.LedgerAccount, error) {
+	if accountID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc ledgerAccountDoc
+	err := s.accounts.FindOne(ctx, bson.M{"_id": accountID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toAccount(), nil
+}
+
+func (s *MongoLedgerStore) ListTransactions(ctx context.Context, accountID, after string, limit int) ([]*lastmilev1.LedgerTransaction, string, error) {
+	if accountID == "" || limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	return findKeysetPage(ctx, s.transactions, bson.M{"entries.account_id": accountID}, after, limit, func(doc *ledgerTransactionDoc) (string, *lastmilev1.LedgerTransaction) {
+		return doc.ID, doc.toTransaction()
+	})
+}
+
+// Check reads both collections in full; run it off peak on large ledgers.
+func (s *MongoLedgerStore) Check(ctx context.Context) (LedgerCheck, error) {
+	checker := newLedgerChecker()
+	cursor, err := s.transactions.Find(ctx, bson.M{})
+	if err != nil {
+		return LedgerCheck{}, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc ledgerTransactionDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return LedgerCheck{}, err
+		}
+		checker.addTransaction(doc.toTransaction())
+	}
+	if err := cursor.Err(); err != nil {
+		return LedgerCheck{}, err
+	}
+
+	accounts, err := s.accounts.Find(ctx, bson.M{})
+	if err != nil {
+		return LedgerCheck{}, err
+	}
+	defer accounts.Close(ctx)
+	for accounts.Next(ctx) {
+		var doc ledgerAccountDoc
+		if err := accounts.Decode(&doc); err != nil {
+			return LedgerCheck{}, err
+		}
+		checker.addAccount(doc.toAccount())
+	}
+	if err := accounts.Err(); err != nil {
+		return LedgerCheck{}, err
+	}
+	return checker.result(), nil
+}
+
+type ledgerTransactionDoc struct {
+	ID                string           `bson:"_id"`
+	IdempotencyKey    string           `bson:"idempotency_key"`
+	Kind              int32            `bson:"kind"`
+	Entries           []ledgerEntryDoc `bson:"entries"`
+	RiderID           string           `bson:"rider_id,omitempty"`
+	DriverID          string           `bson:"driver_id,omitempty"`
+	RequestID         string           `bson:"request_id,omitempty"`
+	ProviderReference string           `bson:"provider_reference,omitempty"`
+	CreatedAt         time.Time        `bson:"created_at"`
+}
+
+type ledgerEntryDoc struct {
+	AccountID   string `bson:"account_id"`
+	Currency    string `bson:"currency"`
+	AmountMinor int64  `bson:"amount_minor"`
+}
+
+func newLedgerTransactionDoc(tx *lastmilev1.LedgerTransaction) ledgerTransactionDoc {
+	doc := ledgerTransactionDoc{
+		ID:                tx.TransactionId,
+		IdempotencyKey:    tx.IdempotencyKey,
+		Kind:              int32(tx.Kind),
+		RiderID:           tx.RiderId,
+		DriverID:          tx.DriverId,
+		RequestID:         tx.RequestId,
+		ProviderReference: tx.ProviderReference,
+		CreatedAt:         tx.GetCreatedAt().AsTime(),
+	}
+	for _, entry := range tx.Entries {
+		doc.Entries = append(doc.Entries, ledgerEntryDoc{
+			AccountID:   entry.AccountId,
+			Currency:    entry.Amount.CurrencyCode,
+			AmountMinor: entry.Amount.AmountMinor,
+		})
+	}
+	return doc
+}
+
+func (d ledgerTransactionDoc) toTransaction() *lastmilev1.LedgerTransaction {
+	tx := &lastmilev1.LedgerTransaction{
+		TransactionId:     d.ID,
+		IdempotencyKey:    d.IdempotencyKey,
+		Kind:              lastmilev1.LedgerTransactionKind(d.Kind),
+		RiderId:           d.RiderID,
+		DriverId:          d.DriverID,
+		RequestId:         d.RequestID,
+		ProviderReference: d.ProviderReference,
+		CreatedAt:         timestamppb.New(d.CreatedAt),
+	}
+	for _, entry := range d.Entries {
+		tx.Entries = append(tx.Entries, &lastmilev1.LedgerEntry{
+			AccountId: entry.AccountID,
+			Amount:    &lastmilev1.Money{CurrencyCode: entry.Currency, AmountMinor: entry.AmountMinor},
+		})
+	}
+	return tx
+}
+
+type ledgerAccountDoc struct {
+	ID       string `bson:"_id"`
+	Currency string `bson:"currency"`
+	Balance  int64  `bson:"balance"`
+}
+
+func (d ledgerAccountDoc) toAccount() *lastmilev1.LedgerAccount {
+	return &lastmilev1.LedgerAccount{
+		AccountId: d.ID,
+		Balance:   &lastmilev1.Money{CurrencyCode: d.Currency, AmountMinor: d.Balance},
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoMatchStore writes through the trip and ride request stores' collections
+// in one transaction, so both must live on the same deployment.
+type MongoMatchStore struct {
+	trips    *MongoTripStore
+	requests *MongoRideRequestStore
+}
+
+func NewMongoMatchStore(trips *MongoTripStore, requests *MongoRideRequestStore) *MongoMatchStore {
+	if trips == nil || requests == nil {
+		return nil
+	}
+	return &MongoMatchStore{trips: trips, requests: requests}
+}
+
+func (s *MongoMatchStore) CreateMatch(ctx context.Context, trip *lastmilev1.Trip, request *lastmilev1.RideRequest, messages ...OutboxMessage) error {
+	if trip == nil || trip.TripId == "" || request == nil || request.RequestId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	session, err := s.trips.outbox.client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		if _, err := s.trips.trips.InsertOne(sc, toTripDoc(trip)); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, ErrAlreadyExists
+			}
+			return nil, err
+		}
+		pending := bson.M{"_id": request.RequestId, "status": lastmilev1.RideStatus_RIDE_STATUS_PENDING.String()}
+		result, err := s.requests.requests.ReplaceOne(sc, pending, toRideRequestDoc(request))
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrNotFound
+		}
+		if len(messages) == 0 {
+			return nil, nil
+		}
+		return nil, s.trips.outbox.insert(sc, messages)
+	})
+	return err
+}
+
+func (s *MongoMatchStore) CancelMatch(ctx context.Context, tripID, requestID string, cancellation *lastmilev1.Cancellation, requestStatus lastmilev1.RideStatus, messages ...OutboxMessage) error {
+	if tripID == "" || requestID == "" || cancellation == nil {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	session, err := s.trips.outbox.client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	doc := newCancellationDoc(cancellation)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		result, err := s.trips.trips.UpdateOne(sc,
+			bson.M{"_id": tripID, "status": lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED.String()},
+			bson.M{
+				"$set": bson.M{
+					"status":       lastmilev1.TripStatus_TRIP_STATUS_CANCELED.String(),
+					"cancellation": doc,
+					"updated_at":   cancellation.GetCanceledAt().AsTime().UTC(),
+				},
+				"$unset": bson.M{"dropoff_plan": ""},
+			})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrStatusChanged
+		}
+		set := bson.M{"status": requestStatus.String()}
+		if requestStatus == lastmilev1.RideStatus_RIDE_STATUS_CANCELED {
+			set["cancellation"] = doc
+		}
+		result, err = s.requests.requests.UpdateOne(sc,
+			bson.M{"_id": requestID, "status": lastmilev1.RideStatus_RIDE_STATUS_MATCHED.String()},
+			bson.M{"$set": set})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrStatusChanged
+		}
+		if len(messages) == 0 {
+			return nil, nil
+		}
+		return nil, s.trips.outbox.insert(sc, messages)
+	})
+	return err
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/proto"
+)
+
+type MongoOutbox struct {
+	collection *mongo.Collection
+	source     string
+}
+
+func NewMongoOutbox(client *mongo.Client, dbName, collectionName, source string) *MongoOutbox {
+	if client == nil {
+		return nil
+	}
+	if dbName == "" {
+		dbName = "lastmile"
+	}
+	if collectionName == "" {
+		collectionName = "outbox"
+	}
+	if source == "" {
+		source = "default"
+	}
+	return &MongoOutbox{collection: client.Database(dbName).Collection(collectionName), source: source}
+}
+
+// EnsureIndexes creates the relay's index and a TTL index that deletes
+// entries retention after they were published; unpublished entries are kept.
+func (o *MongoOutbox) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	if retention <= 0 {
+		return ErrInvalidArgument
+	}
+	_, err := o.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "source", Value: 1}, {Key: "published_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "published_at", Value: 1}},
+			Options: options.Index().SetName("published_ttl").SetExpireAfterSeconds(int32(retention / time.Second)),
+		},
+	})
+	return err
+}
+
+func (o *MongoOutbox) Enqueue(ctx context.Context, messages ...OutboxMessage) error {
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	return o.insert(ctx, messages)
+}
+
+func (o *MongoOutbox) ListPending(ctx context.Context, limit int) ([]OutboxEntry, error) {
+	if limit <= 0 {
+		return nil, ErrInvalidArgument
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := o.collection.Find(ctx, bson.M{"source": o.source, "published_at": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := make([]OutboxEntry, 0, limit)
+	for cursor.Next(ctx) {
+		var doc outboxDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		var event lastmilev1.Event
+		if err := proto.Unmarshal(doc.Event, &event); err != nil {
+			return nil, err
+		}
+		entries = append(entries, OutboxEntry{
+			ID:        doc.ID.Hex(),
+			Stream:    doc.Stream,
+			Event:     &event,
+			CreatedAt: doc.CreatedAt,
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (o *MongoOutbox) MarkPublished(ctx context.Context, entries []OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(entries))
+	for _, entry := range entries {
+		id, err := primitive.ObjectIDFromHex(entry.ID)
+		if err != nil {
+			return ErrInvalidArgument
+		}
+		ids = append(ids, id)
+	}
+	_, err := o.collection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"published_at": time.Now().UTC()}},
+	)
+	return err
+}
+
+func (o *MongoOutbox) insert(ctx context.Context, messages []OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	docs := make([]any, 0, len(messages))
+	for _, message := range messages {
+		payload, err := proto.Marshal(message.Event)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, outboxDoc{
+			ID:        primitive.NewObjectID(),
+			Source:    o.source,
+			Stream:    message.Stream,
+			EventID:   message.Event.Id,
+			EventType: message.Event.Type,
+			Event:     payload,
+			CreatedAt: now,
+		})
+	}
+	_, err := o.collection.InsertMany(ctx, docs)
+	return err
+}
+
+func (o *MongoOutbox) client() *mongo.Client {
+	return o.collection.Database().Client()
+}
+
+type outboxDoc struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Source      string             `bson:"source"`
+	Stream      string             `bson:"stream"`
+	EventID     string             `bson:"event_id"`
+	EventType   string             `bson:"event_type"`
+	Event       []byte             `bson:"event"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	PublishedAt *time.Time         `bson:"published_at"`
+}
+
+func withMongoOutbox(ctx context.Context, outbox *MongoOutbox, messages []OutboxMessage, write func(context.Context) error) error {
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return write(ctx)
+	}
+	session, err := outbox.client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		if err := write(sc); err != nil {
+			return nil, err
+		}
+		return nil, outbox.insert(sc, messages)
+	})
+	return err
+}
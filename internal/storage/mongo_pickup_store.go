@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoPickupStore writes through the trip and ride request stores' collections
+// in one transaction, so both must live on the same deployment.
+type MongoPickupStore struct {
+	trips    *MongoTripStore
+	requests *MongoRideRequestStore
+}
+
+func NewMongoPickupStore(trips *MongoTripStore, requests *MongoRideRequestStore) *MongoPickupStore {
+	if trips == nil || requests == nil {
+		return nil
+	}
+	return &MongoPickupStore{trips: trips, requests: requests}
+}
+
+func (s *MongoPickupStore) StartPickup(ctx context.Context, tripID, requestID string, verifiedAt time.Time, messages ...OutboxMessage) error {
+	if tripID == "" || requestID == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	session, err := s.trips.outbox.client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	verifiedAt = verifiedAt.UTC()
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		// The pipeline takes back the attempt counted for the correct PIN
+		// from the stored count, not the one the caller read.
+		result, err := s.trips.trips.UpdateOne(sc, bson.M{
+			"_id":    tripID,
+			"status": lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED.String(),
+			"pickup": bson.M{"$ne": nil},
+		}, bson.A{bson.M{"$set": bson.M{
+			"status":             lastmilev1.TripStatus_TRIP_STATUS_ACTIVE.String(),
+			"updated_at":         verifiedAt,
+			"pickup.verified_at": verifiedAt,
+			"pickup.failed_attempts": bson.M{"$max": bson.A{0,
+				bson.M{"$subtract": bson.A{bson.M{"$ifNull": bson.A{"$pickup.failed_attempts", 0}}, 1}}}},
+		}}})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrStatusChanged
+		}
+		result, err = s.requests.requests.UpdateOne(sc,
+			bson.M{"_id": requestID, "status": lastmilev1.RideStatus_RIDE_STATUS_MATCHED.String()},
+			bson.M{"$set": bson.M{"status": lastmilev1.RideStatus_RIDE_STATUS_PICKED_UP.String()}})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrStatusChanged
+		}
+		if len(messages) == 0 {
+			return nil, nil
+		}
+		return nil, s.trips.outbox.insert(sc, messages)
+	})
+	return err
+}
+
+func (s *MongoPickupStore) AddPickupAttempt(ctx context.Context, tripID string, limit int32) (int32, error) {
+	if tripID == "" {
+		return 0, ErrInvalidArgument
+	}
+	scheduled := bson.M{
+		"_id":    tripID,
+		"status": lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED.String(),
+		"pickup": bson.M{"$ne": nil},
+	}
+	// failed_attempts is left out of the document while it is zero.
+	filter := bson.M{"$and": bson.A{scheduled, bson.M{"$or": bson.A{
+		bson.M{"pickup.failed_attempts": bson.M{"$lt": limit}},
+		bson.M{"pickup.failed_attempts": bson.M{"$exists": false}},
+	}}}}
+	var doc tripDoc
+	err := s.trips.trips.FindOneAndUpdate(ctx, filter,
+		bson.M{"$inc": bson.M{"pickup.failed_attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err == nil {
+		return doc.Pickup.FailedAttempts, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+	count, err := s.trips.trips.CountDocuments(ctx, scheduled)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, ErrLimitReached
+	}
+	return 0, ErrNotFound
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type MongoRideRequestStore struct {
+	requests *mongo.Collection
+	outbox   *MongoOutbox
+}
+
+func NewMongoRideRequestStore(client *mongo.Client, dbName, collectionName string, outbox *MongoOutbox) *MongoRideRequestStore {
+	if client == nil {
+		return nil
+	}
+	if dbName == "" {
+		dbName = "lastmile"
+	}
+	if collectionName == "" {
+		collectionName = "ride_requests"
+	}
+	if outbox == nil {
+		outbox = NewMongoOutbox(client, dbName, "", "")
+	}
+	return &MongoRideRequestStore{requests: client.Database(dbName).Collection(collectionName), outbox: outbox}
+}
+
+// EnsureIndexes makes each quote usable by one ride request only.
+func (s *MongoRideRequestStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.requests.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "quote_id", Value: 1}},
+		Options: options.Index().SetName("quote_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"quote_id": bson.M{"$type": "string"}}),
+	})
+	return err
+}
+
+func (s *MongoRideRequestStore) CreateRideRequest(ctx context.Context, request *lastmilev1.RideRequest, messages ...OutboxMessage) error {
+	if request == nil || request.RequestId == "" {
+		return ErrInvalidArgument
+	}
+	err := withMongoOutbox(ctx, s.outbox, messages, func(ctx context.Context) error {
+		_, err := s.requests.InsertOne(ctx, toRideRequestDoc(request))
+		return err
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			if strings.Contains(err.Error(), "quote_unique") {
+				return ErrQuoteUsed
+			}
+			return ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *MongoRideRequestStore) GetRideRequest(ctx context.Context, requestID string) (*lastmilev1.RideRequest, error) {
+	if requestID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc rideRequestDoc
+	err := s.requests.FindOne(ctx, bson.M{"_id": requestID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toRideRequest(), nil
+}
+
+func (s *MongoRideRequestStore) UpdateRideRequest(ctx context.Context, request *lastmilev1.RideRequest, from lastmilev1.RideStatus, messages ...OutboxMessage) error {
+	if request == nil || request.RequestId == "" {
+		return ErrInvalidArgument
+	}
+	return withMongoOutbox(ctx, s.outbox, messages, func(ctx context.Context) error {
+		result, err := s.requests.ReplaceOne(ctx, bson.M{"_id": request.RequestId, "status": from.String()}, toRideRequestDoc(request))
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount > 0 {
+			return nil
+		}
+		count, err := s.requests.CountDocuments(ctx, bson.M{"_id": request.RequestId})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrStatusChanged
+	})
+}
+
+func (s *MongoRideRequestStore) ListRideRequests(ctx context.Context, filter RideRequestFilter) ([]*lastmilev1.RideRequest, error) {
+	query := bson.M{}
+	if filter.StationID != "" {
+		query["station_id"] = filter.StationID
+	}
+	if filter.RiderID != "" {
+		query["rider_id"] = filter.RiderID
+	}
+	if filter.Status != lastmilev1.RideStatus_RIDE_STATUS_UNSPECIFIED {
+		query["status"] = filter.Status.String()
+	}
+	if filter.TrainTripID != "" {
+		query["train.trip_id"] = filter.TrainTripID
+	}
+	cursor, err := s.requests.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var requests []*lastmilev1.RideRequest
+	for cursor.Next(ctx) {
+		var doc rideRequestDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		requests = append(requests, doc.toRideRequest())
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+type rideRequestDoc struct {
+	ID            string           `bson:"_id"`
+	RiderID       string           `bson:"rider_id"`
+	StationID     string           `bson:"station_id"`
+	DestinationID string           `bson:"destination_id"`
+	ArrivalTime   time.Time        `bson:"arrival_time"`
+	Status        string           `bson:"status"`
+	Train         *trainLinkDoc    `bson:"train,omitempty"`
+	Seats         uint32           `bson:"seats,omitempty"`
+	Fare          *moneyDoc        `bson:"fare,omitempty"`
+	QuoteID       string           `bson:"quote_id,omitempty"`
+	CreatedAt     *time.Time       `bson:"created_at,omitempty"`
+	Cancellation  *cancellationDoc `bson:"cancellation,omitempty"`
+	Shared        bool             `bson:"shared,omitempty"`
+}
+
+type moneyDoc struct {
+	Currency    string `bson:"currency"`
+	AmountMinor int64  `bson:"amount_minor"`
+}
+
+func newMoneyDoc(money *lastmilev1.Money) *moneyDoc {
+	if money == nil {
+		return nil
+	}
+	return &moneyDoc{Currency: money.CurrencyCode, AmountMinor: money.AmountMinor}
+}
+
+func (d *moneyDoc) toMoney() *lastmilev1.Money {
+	if d == nil {
+		return nil
+	}
+	return &lastmilev1.Money{CurrencyCode: d.Currency, AmountMinor: d.AmountMinor}
+}
+
+type cancellationDoc struct {
+	CanceledBy string    `bson:"canceled_by"`
+	Reason     string    `bson:"reason"`
+	Note       string    `bson:"note,omitempty"`
+	CanceledAt time.Time `bson:"canceled_at"`
+	Fee        *moneyDoc `bson:"fee,omitempty"`
+}
+
+func newCancellationDoc(cancellation *lastmilev1.Cancellation) *cancellationDoc {
+	if cancellation == nil {
+		return nil
+	}
+	return &cancellationDoc{
+		CanceledBy: cancellation.CanceledBy.String(),
+		Reason:     cancellation.Reason.String(),
+		Note:       cancellation.Note,
+		CanceledAt: cancellation.GetCanceledAt().AsTime(),
+		Fee:        newMoneyDoc(cancellation.Fee),
+	}
+}
+
+func (d *cancellationDoc) toCancellation() *lastmilev1.Cancellation {
+	if d == nil {
+		return nil
+	}
+	return &lastmilev1.Cancellation{
+		CanceledBy: lastmilev1.CancellationParty(lastmilev1.CancellationParty_value[d.CanceledBy]),
+		Reason:     lastmilev1.CancellationReason(lastmilev1.CancellationReason_value[d.Reason]),
+		Note:       d.Note,
+		CanceledAt: timestamppb.New(d.CanceledAt),
+		Fee:        d.Fee.toMoney(),
+	}
+}
+
+type trainLinkDoc struct {
+	TripID               string    `bson:"trip_id"`
+	StopSequence         uint32    `bson:"stop_sequence,omitempty"`
+	ServiceDate          string    `bson:"service_date,omitempty"`
+	ScheduledArrivalTime time.Time `bson:"scheduled_arrival_time"`
+	DelaySeconds         int32     `bson:"delay_seconds"`
+}
+
+func newTrainLinkDoc(train *lastmilev1.TrainLink) *trainLinkDoc {
+	if train == nil {
+		return nil
+	}
+	return &trainLinkDoc{
+		TripID:               train.TripId,
+		StopSequence:         train.StopSequence,
+		ServiceDate:          train.ServiceDate,
+		ScheduledArrivalTime: train.GetScheduledArrivalTime().AsTime(),
+		DelaySeconds:         train.DelaySeconds,
+	}
+}
+
+func (d *trainLinkDoc) toTrainLink() *lastmilev1.TrainLink {
+	if d == nil {
+		return nil
+	}
+	return &lastmilev1.TrainLink{
+		TripId:               d.TripID,
+		StopSequence:         d.StopSequence,
+		ServiceDate:          d.ServiceDate,
+		ScheduledArrivalTime: timestamppb.New(d.ScheduledArrivalTime),
+		DelaySeconds:         d.DelaySeconds,
+	}
+}
+
+func toRideRequestDoc(request *lastmilev1.RideRequest) rideRequestDoc {
+	return rideRequestDoc{
+		ID:            request.RequestId,
+		RiderID:       request.RiderId,
+		StationID:     request.StationId,
+		DestinationID: request.DestinationId,
+		ArrivalTime:   request.ArrivalTime.AsTime(),
+		Status:        request.Status.String(),
+		Train:         newTrainLinkDoc(request.Train),
+		Seats:         request.Seats,
+		Fare:          newMoneyDoc(request.Fare),
+		QuoteID:       request.QuoteId,
+		CreatedAt:     timePtr(request.CreatedAt),
+		Cancellation:  newCancellationDoc(request.Cancellation),
+		Shared:        request.Shared,
+	}
+}
+
+func (d rideRequestDoc) toRideRequest() *lastmilev1.RideRequest {
+	return &lastmilev1.RideRequest{
+		RequestId:     d.ID,
+		RiderId:       d.RiderID,
+		StationId:     d.StationID,
+		DestinationId: d.DestinationID,
+		ArrivalTime:   timestamppb.New(d.ArrivalTime),
+		Status:        lastmilev1.RideStatus(lastmilev1.RideStatus_value[d.Status]),
+		Train:         d.Train.toTrainLink(),
+		Seats:         d.Seats,
+		Fare:          d.Fare.toMoney(),
+		QuoteId:       d.QuoteID,
+		CreatedAt:     timestampPtr(d.CreatedAt),
+		Cancellation:  d.Cancellation.toCancellation(),
+		Shared:        d.Shared,
+	}
+}
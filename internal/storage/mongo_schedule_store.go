@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type MongoScheduleStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoScheduleStore(client *mongo.Client, dbName, collectionName string) *MongoScheduleStore {
+	if client == nil {
+		return nil
+	}
+	if dbName == "" {
+		dbName = "lastmile"
+	}
+	if collectionName == "" {
+		collectionName = "station_schedules"
+	}
+	return &MongoScheduleStore{collection: client.Database(dbName).Collection(collectionName)}
+}
+
+func (s *MongoScheduleStore) PutSchedule(ctx context.Context, schedule *lastmilev1.StationSchedule) error {
+	if schedule == nil || schedule.StationId == "" {
+		return ErrInvalidArgument
+	}
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": schedule.StationId}, newScheduleDoc(schedule), options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoScheduleStore) GetSchedule(ctx context.Context, stationID string) (*lastmilev1.StationSchedule, error) {
+	if stationID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc scheduleDoc
+	err := s.collection.FindOne(ctx, bson.M{"_id": stationID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toSchedule(), nil
+}
+
+type scheduleDoc struct {
+	ID         string       `bson:"_id"`
+	Timezone   string       `bson:"timezone"`
+	Arrivals   []arrivalDoc `bson:"arrivals"`
+	ImportedAt time.Time    `bson:"imported_at"`
+}
+
+type arrivalDoc struct {
+	RouteID        string `bson:"route_id"`
+	RouteName      string `bson:"route_name,omitempty"`
+	TripID         string `bson:"trip_id"`
+	Headsign       string `bson:"headsign,omitempty"`
+	ArrivalSeconds int32  `bson:"arrival_seconds"`
+	Weekdays       int32  `bson:"weekdays"`
+	StopSequence   uint32 `bson:"stop_sequence,omitempty"`
+}
+
+func newScheduleDoc(schedule *lastmilev1.StationSchedule) scheduleDoc {
+	doc := scheduleDoc{
+		ID:         schedule.StationId,
+		Timezone:   schedule.Timezone,
+		Arrivals:   make([]arrivalDoc, 0, len(schedule.Arrivals)),
+		ImportedAt: schedule.GetImportedAt().AsTime(),
+	}
+	for _, arrival := range schedule.Arrivals {
+		doc.Arrivals = append(doc.Arrivals, arrivalDoc{
+			RouteID:        arrival.RouteId,
+			RouteName:      arrival.RouteName,
+			TripID:         arrival.TripId,
+			Headsign:       arrival.Headsign,
+			ArrivalSeconds: arrival.ArrivalSeconds,
+			Weekdays:       arrival.Weekdays,
+			StopSequence:   arrival.StopSequence,
+		})
+	}
+	return doc
+}
+
+func (d scheduleDoc) toSchedule() *lastmilev1.StationSchedule {
+	schedule := &lastmilev1.StationSchedule{
+		StationId:  d.ID,
+		Timezone:   d.Timezone,
+		Arrivals:   make([]*lastmilev1.TrainArrival, 0, len(d.Arrivals)),
+		ImportedAt: timestamppb.New(d.ImportedAt),
+	}
+	for _, arrival := range d.Arrivals {
+		schedule.Arrivals = append(schedule.Arrivals, &lastmilev1.TrainArrival{
+			RouteId:        arrival.RouteID,
+			RouteName:      arrival.RouteName,
+			TripId:         arrival.TripID,
+			Headsign:       arrival.Headsign,
+			ArrivalSeconds: arrival.ArrivalSeconds,
+			Weekdays:       arrival.Weekdays,
+			StopSequence:   arrival.StopSequence,
+		})
+	}
+	return schedule
+}
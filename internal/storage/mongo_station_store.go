@@ -27,20 +27,37 @@ func NewMongoStationStore(client *mongo.Client, dbName, collectionName string) *
 	return &MongoStationStore{collection: client.Database(dbName).Collection(collectionName)}
 }
 
+// EnsureIndexes rewrites stations stored with the old {latitude, longitude}
+// location as GeoJSON points and creates the 2dsphere index used by
+// SearchNear.
+func (s *MongoStationStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.UpdateMany(ctx,
+		bson.M{"location.type": bson.M{"$exists": false}, "location.latitude": bson.M{"$exists": true}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"location": bson.M{
+				"type":        "Point",
+				"coordinates": bson.A{"$location.longitude", "$location.latitude"},
+			},
+		}}}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "location", Value: "2dsphere"}},
+		Options: options.Index().SetName("location_2dsphere"),
+	})
+	return err
+}
+
 func (s *MongoStationStore) Upsert(ctx context.Context, station *lastmilev1.Station) error {
 	if station == nil || station.StationId == "" {
 		return ErrInvalidArgument
 	}
-	doc := stationDoc{
-		ID:            station.StationId,
-		Name:          station.Name,
-		Location:      toLatLngDoc(station.Location),
-		NearbyAreaIDs: append([]string(nil), station.NearbyAreaIds...),
-	}
 	_, err := s.collection.UpdateOne(
 		ctx,
 		bson.M{"_id": station.StationId},
-		bson.M{"$set": doc},
+		bson.M{"$set": newStationDoc(station)},
 		options.Update().SetUpsert(true),
 	)
 	if err != nil {
@@ -49,6 +66,34 @@ func (s *MongoStationStore) Upsert(ctx context.Context, station *lastmilev1.Stat
 	return nil
 }
 
+func (s *MongoStationStore) Update(ctx context.Context, station *lastmilev1.Station) error {
+	if station == nil || station.StationId == "" {
+		return ErrInvalidArgument
+	}
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": station.StationId}, newStationDoc(station))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStationStore) Delete(ctx context.Context, stationID string) error {
+	if stationID == "" {
+		return ErrInvalidArgument
+	}
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": stationID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (s *MongoStationStore) Get(ctx context.Context, stationID string) (*lastmilev1.Station, error) {
 	if stationID == "" {
 		return nil, ErrInvalidArgument
@@ -64,78 +109,125 @@ func (s *MongoStationStore) Get(ctx context.Context, stationID string) (*lastmil
 	return doc.toStation(), nil
 }
 
-func (s *MongoStationStore) List(ctx context.Context, offset, limit int) ([]*lastmilev1.Station, int, error) {
-	if offset < 0 || limit <= 0 {
-		return nil, 0, ErrInvalidArgument
+func (s *MongoStationStore) List(ctx context.Context, after string, limit int) ([]*lastmilev1.Station, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
 	}
-	total, err := s.collection.CountDocuments(ctx, bson.M{})
-	if err != nil {
-		return nil, 0, err
+	return findKeysetPage(ctx, s.collection, bson.M{}, after, limit, func(doc *stationDoc) (string, *lastmilev1.Station) {
+		return doc.ID, doc.toStation()
+	})
+}
+
+func (s *MongoStationStore) SearchNear(ctx context.Context, center *lastmilev1.LatLng, radiusMeters float64, limit int) ([]*lastmilev1.NearbyStation, error) {
+	if center == nil || radiusMeters <= 0 || limit <= 0 {
+		return nil, ErrInvalidArgument
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: bson.M{
+			"near":          toGeoPointDoc(center),
+			"distanceField": "distance_meters",
+			"maxDistance":   radiusMeters,
+			"spherical":     true,
+		}}},
+		{{Key: "$limit", Value: limit}},
 	}
-	if offset >= int(total) {
-		return nil, -1, nil
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	opts := options.Find().
-		SetSort(bson.D{{Key: "_id", Value: 1}}).
-		SetSkip(int64(offset)).
-		SetLimit(int64(limit))
+	results := make([]*lastmilev1.NearbyStation, 0, limit)
+	for cursor.Next(ctx) {
+		var doc struct {
+			stationDoc `bson:",inline"`
+			Distance   float64 `bson:"distance_meters"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		results = append(results, &lastmilev1.NearbyStation{Station: doc.toStation(), DistanceMeters: doc.Distance})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
 
-	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+func (s *MongoStationStore) ListByArea(ctx context.Context, areaID string) ([]*lastmilev1.Station, error) {
+	if areaID == "" {
+		return nil, ErrInvalidArgument
+	}
+	cursor, err := s.collection.Find(ctx, bson.M{"nearby_area_ids": areaID}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	stations := make([]*lastmilev1.Station, 0, limit)
+	var stations []*lastmilev1.Station
 	for cursor.Next(ctx) {
 		var doc stationDoc
 		if err := cursor.Decode(&doc); err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 		stations = append(stations, doc.toStation())
 	}
 	if err := cursor.Err(); err != nil {
-		return nil, 0, err
-	}
-
-	next := -1
-	if offset+len(stations) < int(total) {
-		next = offset + len(stations)
+		return nil, err
 	}
-	return stations, next, nil
+	return stations, nil
 }
 
 type stationDoc struct {
-	ID            string    `bson:"_id"`
-	Name          string    `bson:"name"`
-	Location      latLngDoc `bson:"location"`
-	NearbyAreaIDs []string  `bson:"nearby_area_ids,omitempty"`
+	ID            string      `bson:"_id"`
+	Name          string      `bson:"name"`
+	Location      geoPointDoc `bson:"location"`
+	NearbyAreaIDs []string    `bson:"nearby_area_ids,omitempty"`
+	GTFSStopID    string      `bson:"gtfs_stop_id,omitempty"`
 }
 
-type latLngDoc struct {
-	Latitude  float64 `bson:"latitude"`
-	Longitude float64 `bson:"longitude"`
+// geoPointDoc is a GeoJSON point. Latitude and Longitude are only set on
+// documents written before EnsureIndexes migrated them.
+type geoPointDoc struct {
+	Type        string    `bson:"type,omitempty"`
+	Coordinates []float64 `bson:"coordinates,omitempty"`
+	Latitude    float64   `bson:"latitude,omitempty"`
+	Longitude   float64   `bson:"longitude,omitempty"`
 }
 
-func toLatLngDoc(latlng *lastmilev1.LatLng) latLngDoc {
+func newStationDoc(station *lastmilev1.Station) stationDoc {
+	return stationDoc{
+		ID:            station.StationId,
+		Name:          station.Name,
+		Location:      toGeoPointDoc(station.Location),
+		NearbyAreaIDs: append([]string(nil), station.NearbyAreaIds...),
+		GTFSStopID:    station.GtfsStopId,
+	}
+}
+
+func toGeoPointDoc(latlng *lastmilev1.LatLng) geoPointDoc {
 	if latlng == nil {
-		return latLngDoc{}
+		return geoPointDoc{}
 	}
-	return latLngDoc{
-		Latitude:  latlng.Latitude,
-		Longitude: latlng.Longitude,
+	return geoPointDoc{
+		Type:        "Point",
+		Coordinates: []float64{latlng.Longitude, latlng.Latitude},
+	}
+}
+
+func (d geoPointDoc) toLatLng() *lastmilev1.LatLng {
+	if len(d.Coordinates) == 2 {
+		return &lastmilev1.LatLng{Latitude: d.Coordinates[1], Longitude: d.Coordinates[0]}
 	}
+	return &lastmilev1.LatLng{Latitude: d.Latitude, Longitude: d.Longitude}
 }
 
 func (d stationDoc) toStation() *lastmilev1.Station {
 	return &lastmilev1.Station{
-		StationId: d.ID,
-		Name:      d.Name,
-		Location: &lastmilev1.LatLng{
-			Latitude:  d.Location.Latitude,
-			Longitude: d.Location.Longitude,
-		},
+		StationId:     d.ID,
+		Name:          d.Name,
+		Location:      d.Location.toLatLng(),
 		NearbyAreaIds: append([]string(nil), d.NearbyAreaIDs...),
+		GtfsStopId:    d.GTFSStopID,
 	}
 }
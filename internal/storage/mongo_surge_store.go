@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type MongoSurgeStore struct {
+	surges  *mongo.Collection
+	changes *mongo.Collection
+}
+
+func NewMongoSurgeStore(client *mongo.Client, dbName, surgeCollection, changeCollection string) *MongoSurgeStore {
+	if client == nil {
+		return nil
+	}
+	if dbName == "" {
+		dbName = "lastmile"
+	}
+	if surgeCollection == "" {
+		surgeCollection = "station_surges"
+	}
+	if changeCollection == "" {
+		changeCollection = "surge_changes"
+	}
+	db := client.Database(dbName)
+	return &MongoSurgeStore{surges: db.Collection(surgeCollection), changes: db.Collection(changeCollection)}
+}
+
+// EnsureIndexes creates the index ListChanges pages a station's trail with.
+func (s *MongoSurgeStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.changes.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "station_id", Value: 1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("station_id_id"),
+	})
+	return err
+}
+
+func (s *MongoSurgeStore) Get(ctx context.Context, stationID string) (*lastmilev1.StationSurge, error) {
+	if stationID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc surgeDoc
+	err := s.surges.FindOne(ctx, bson.M{"_id": stationID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toSurge(), nil
+}
+
+// Set appends the change before replacing the current value, so a failure in
+// between leaves an audit entry rather than an unaudited multiplier.
+func (s *MongoSurgeStore) Set(ctx context.Context, surge *lastmilev1.StationSurge, change *lastmilev1.SurgeChange) error {
+	if !validSurge(surge, change) {
+		return ErrInvalidArgument
+	}
+	if change != nil {
+		if _, err := s.changes.InsertOne(ctx, newSurgeChangeDoc(change)); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	_, err := s.surges.ReplaceOne(ctx, bson.M{"_id": surge.StationId}, newSurgeDoc(surge), options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoSurgeStore) ListChanges(ctx context.Context, stationID, after string, limit int) ([]*lastmilev1.SurgeChange, string, error) {
+	if stationID == "" || limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	return findKeysetPage(ctx, s.changes, bson.M{"station_id": stationID}, after, limit, func(doc *surgeChangeDoc) (string, *lastmilev1.SurgeChange) {
+		return doc.ID, doc.toChange()
+	})
+}
+
+type surgeDoc struct {
+	ID         string    `bson:"_id"`
+	Multiplier float64   `bson:"multiplier"`
+	Demand     float64   `bson:"demand"`
+	Supply     float64   `bson:"supply"`
+	Ratio      float64   `bson:"ratio"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+}
+
+func newSurgeDoc(surge *lastmilev1.StationSurge) surgeDoc {
+	return surgeDoc{
+		ID:         surge.StationId,
+		Multiplier: surge.Multiplier,
+		Demand:     surge.Demand,
+		Supply:     surge.Supply,
+		Ratio:      surge.Ratio,
+		UpdatedAt:  surge.GetUpdatedAt().AsTime(),
+	}
+}
+
+func (d surgeDoc) toSurge() *lastmilev1.StationSurge {
+	return &lastmilev1.StationSurge{
+		StationId:  d.ID,
+		Multiplier: d.Multiplier,
+		Demand:     d.Demand,
+		Supply:     d.Supply,
+		Ratio:      d.Ratio,
+		UpdatedAt:  timestamppb.New(d.UpdatedAt),
+	}
+}
+
+type surgeChangeDoc struct {
+	ID                 string    `bson:"_id"`
+	StationID          string    `bson:"station_id"`
+	PreviousMultiplier float64   `bson:"previous_multiplier"`
+	Multiplier         float64   `bson:"multiplier"`
+	Demand             float64   `bson:"demand"`
+	Supply             float64   `bson:"supply"`
+	Ratio              float64   `bson:"ratio"`
+	ChangedAt          time.Time `bson:"changed_at"`
+}
+
+func newSurgeChangeDoc(change *lastmilev1.SurgeChange) surgeChangeDoc {
+	return surgeChangeDoc{
+		ID:                 change.ChangeId,
+		StationID:          change.StationId,
+		PreviousMultiplier: change.PreviousMultiplier,
+		Multiplier:         change.Multiplier,
+		Demand:             change.Demand,
+		Supply:             change.Supply,
+		Ratio:              change.Ratio,
+		ChangedAt:          change.GetChangedAt().AsTime(),
+	}
+}
+
+func (d surgeChangeDoc) toChange() *lastmilev1.SurgeChange {
+	return &lastmilev1.SurgeChange{
+		ChangeId:           d.ID,
+		StationId:          d.StationID,
+		PreviousMultiplier: d.PreviousMultiplier,
+		Multiplier:         d.Multiplier,
+		Demand:             d.Demand,
+		Supply:             d.Supply,
+		Ratio:              d.Ratio,
+		ChangedAt:          timestamppb.New(d.ChangedAt),
+	}
+}
@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type MongoTripStore struct {
+	trips  *mongo.Collection
+	outbox *MongoOutbox
+}
+
+func NewMongoTripStore(client *mongo.Client, dbName, collectionName string, outbox *MongoOutbox) *MongoTripStore {
+	if client == nil {
+		return nil
+	}
+	if dbName == "" {
+		dbName = "lastmile"
+	}
+	if collectionName == "" {
+		collectionName = "trips"
+	}
+	if outbox == nil {
+		outbox = NewMongoOutbox(client, dbName, "", "")
+	}
+	return &MongoTripStore{trips: client.Database(dbName).Collection(collectionName), outbox: outbox}
+}
+
+func (s *MongoTripStore) CreateTrip(ctx context.Context, trip *lastmilev1.Trip, messages ...OutboxMessage) error {
+	if trip == nil || trip.TripId == "" {
+		return ErrInvalidArgument
+	}
+	err := withMongoOutbox(ctx, s.outbox, messages, func(ctx context.Context) error {
+		_, err := s.trips.InsertOne(ctx, toTripDoc(trip))
+		return err
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *MongoTripStore) GetTrip(ctx context.Context, tripID string) (*lastmilev1.Trip, error) {
+	if tripID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc tripDoc
+	err := s.trips.FindOne(ctx, bson.M{"_id": tripID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toTrip(), nil
+}
+
+func (s *MongoTripStore) UpdateTrip(ctx context.Context, trip *lastmilev1.Trip, messages ...OutboxMessage) error {
+	if trip == nil || trip.TripId == "" {
+		return ErrInvalidArgument
+	}
+	return withMongoOutbox(ctx, s.outbox, messages, func(ctx context.Context) error {
+		result, err := s.trips.ReplaceOne(ctx, bson.M{"_id": trip.TripId}, toTripDoc(trip))
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *MongoTripStore) SetDropoffPlan(ctx context.Context, tripID string, plan *lastmilev1.DropoffPlan) error {
+	if tripID == "" {
+		return ErrInvalidArgument
+	}
+	result, err := s.trips.UpdateOne(ctx,
+		bson.M{"_id": tripID, "status": lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED.String()},
+		bson.M{"$set": bson.M{"dropoff_plan": newDropoffPlanDoc(plan)}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoTripStore) RateTrip(ctx context.Context, tripID string, byRider bool, rating *lastmilev1.TripRating, messages ...OutboxMessage) error {
+	if tripID == "" || rating == nil {
+		return ErrInvalidArgument
+	}
+	field := "rating_by_driver"
+	if byRider {
+		field = "rating_by_rider"
+	}
+	completed := lastmilev1.TripStatus_TRIP_STATUS_COMPLETED.String()
+	return withMongoOutbox(ctx, s.outbox, messages, func(ctx context.Context) error {
+		result, err := s.trips.UpdateOne(ctx,
+			bson.M{"_id": tripID, "status": completed, field: nil},
+			bson.M{"$set": bson.M{field: newTripRatingDoc(rating), "updated_at": rating.RatedAt.AsTime()}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount > 0 {
+			return nil
+		}
+		count, err := s.trips.CountDocuments(ctx, bson.M{"_id": tripID, "status": completed})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyExists
+		}
+		return ErrNotFound
+	})
+}
+
+func (s *MongoTripStore) ListTrips(ctx context.Context, filter TripFilter) ([]*lastmilev1.Trip, error) {
+	query := bson.M{}
+	if filter.DriverID != "" {
+		query["driver_id"] = filter.DriverID
+	}
+	if filter.StationID != "" {
+		query["station_id"] = filter.StationID
+	}
+	if filter.Status != lastmilev1.TripStatus_TRIP_STATUS_UNSPECIFIED {
+		query["status"] = filter.Status.String()
+	}
+	if filter.RequestID != "" {
+		query["request_id"] = filter.RequestID
+	}
+	cursor, err := s.trips.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var trips []*lastmilev1.Trip
+	for cursor.Next(ctx) {
+		var doc tripDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		trips = append(trips, doc.toTrip())
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return trips, nil
+}
+
+type tripDoc struct {
+	ID            string           `bson:"_id"`
+	RiderID       string           `bson:"rider_id"`
+	DriverID      string           `bson:"driver_id"`
+	StationID     string           `bson:"station_id"`
+	DestinationID string           `bson:"destination_id"`
+	Status        string           `bson:"status"`
+	CreatedAt     time.Time        `bson:"created_at"`
+	UpdatedAt     time.Time        `bson:"updated_at"`
+	RiderRating   *tripRatingDoc   `bson:"rating_by_rider,omitempty"`
+	DriverRating  *tripRatingDoc   `bson:"rating_by_driver,omitempty"`
+	RequestID     string           `bson:"request_id,omitempty"`
+	Cancellation  *cancellationDoc `bson:"cancellation,omitempty"`
+	ArrivedAt     *time.Time       `bson:"driver_arrived_at,omitempty"`
+	Pickup        *pickupDoc       `bson:"pickup,omitempty"`
+	DropoffPlan   *dropoffPlanDoc  `bson:"dropoff_plan,omitempty"`
+}
+
+type dropoffPlanDoc struct {
+	Objective     string           `bson:"objective"`
+	DepartureTime time.Time        `bson:"departure_time"`
+	PlannedAt     time.Time        `bson:"planned_at"`
+	Stops         []dropoffStopDoc `bson:"stops"`
+}
+
+type dropoffStopDoc struct {
+	DestinationID  string    `bson:"destination_id"`
+	Riders         int32     `bson:"riders"`
+	ETA            time.Time `bson:"eta"`
+	DistanceMeters float64   `bson:"distance_meters"`
+}
+
+func newDropoffPlanDoc(plan *lastmilev1.DropoffPlan) *dropoffPlanDoc {
+	if plan == nil {
+		return nil
+	}
+	doc := &dropoffPlanDoc{
+		Objective:     plan.Objective.String(),
+		DepartureTime: plan.GetDepartureTime().AsTime(),
+		PlannedAt:     plan.GetPlannedAt().AsTime(),
+		Stops:         make([]dropoffStopDoc, 0, len(plan.Stops)),
+	}
+	for _, stop := range plan.Stops {
+		doc.Stops = append(doc.Stops, dropoffStopDoc{
+			DestinationID:  stop.DestinationId,
+			Riders:         stop.Riders,
+			ETA:            stop.GetEta().AsTime(),
+			DistanceMeters: stop.DistanceMeters,
+		})
+	}
+	return doc
+}
+
+func (d *dropoffPlanDoc) toDropoffPlan() *lastmilev1.DropoffPlan {
+	if d == nil {
+		return nil
+	}
+	plan := &lastmilev1.DropoffPlan{
+		Objective:     lastmilev1.DropoffObjective(lastmilev1.DropoffObjective_value[d.Objective]),
+		DepartureTime: timestamppb.New(d.DepartureTime),
+		PlannedAt:     timestamppb.New(d.PlannedAt),
+	}
+	for _, stop := range d.Stops {
+		plan.Stops = append(plan.Stops, &lastmilev1.DropoffStop{
+			DestinationId:  stop.DestinationID,
+			Riders:         stop.Riders,
+			Eta:            timestamppb.New(stop.ETA),
+			DistanceMeters: stop.DistanceMeters,
+		})
+	}
+	return plan
+}
+
+type pickupDoc struct {
+	PIN            string     `bson:"pin"`
+	ExpiresAt      time.Time  `bson:"expires_at"`
+	FailedAttempts int32      `bson:"failed_attempts,omitempty"`
+	VerifiedAt     *time.Time `bson:"verified_at,omitempty"`
+}
+
+func newPickupDoc(pickup *lastmilev1.PickupVerification) *pickupDoc {
+	if pickup == nil {
+		return nil
+	}
+	return &pickupDoc{
+		PIN:            pickup.Pin,
+		ExpiresAt:      pickup.GetExpiresAt().AsTime(),
+		FailedAttempts: pickup.FailedAttempts,
+		VerifiedAt:     timePtr(pickup.VerifiedAt),
+	}
+}
+
+func (d *pickupDoc) toPickup() *lastmilev1.PickupVerification {
+	if d == nil {
+		return nil
+	}
+	return &lastmilev1.PickupVerification{
+		Pin:            d.PIN,
+		ExpiresAt:      timestamppb.New(d.ExpiresAt),
+		FailedAttempts: d.FailedAttempts,
+		VerifiedAt:     timestampPtr(d.VerifiedAt),
+	}
+}
+
+type tripRatingDoc struct {
+	Stars   int32     `bson:"stars"`
+	Tags    []string  `bson:"tags,omitempty"`
+	RatedAt time.Time `bson:"rated_at"`
+}
+
+func newTripRatingDoc(rating *lastmilev1.TripRating) *tripRatingDoc {
+	if rating == nil {
+		return nil
+	}
+	return &tripRatingDoc{Stars: rating.Stars, Tags: rating.Tags, RatedAt: rating.RatedAt.AsTime()}
+}
+
+func (d *tripRatingDoc) toRating() *lastmilev1.TripRating {
+	if d == nil {
+		return nil
+	}
+	return &lastmilev1.TripRating{Stars: d.Stars, Tags: d.Tags, RatedAt: timestamppb.New(d.RatedAt)}
+}
+
+func toTripDoc(trip *lastmilev1.Trip) tripDoc {
+	return tripDoc{
+		ID:            trip.TripId,
+		RiderID:       trip.RiderId,
+		DriverID:      trip.DriverId,
+		StationID:     trip.StationId,
+		DestinationID: trip.DestinationId,
+		Status:        trip.Status.String(),
+		CreatedAt:     trip.CreatedAt.AsTime(),
+		UpdatedAt:     trip.UpdatedAt.AsTime(),
+		RiderRating:   newTripRatingDoc(trip.RatingByRider),
+		DriverRating:  newTripRatingDoc(trip.RatingByDriver),
+		RequestID:     trip.RequestId,
+		Cancellation:  newCancellationDoc(trip.Cancellation),
+		ArrivedAt:     timePtr(trip.DriverArrivedAt),
+		Pickup:        newPickupDoc(trip.Pickup),
+		DropoffPlan:   newDropoffPlanDoc(trip.DropoffPlan),
+	}
+}
+
+func (d tripDoc) toTrip() *lastmilev1.Trip {
+	return &lastmilev1.Trip{
+		TripId:          d.ID,
+		RiderId:         d.RiderID,
+		DriverId:        d.DriverID,
+		StationId:       d.StationID,
+		DestinationId:   d.DestinationID,
+		Status:          lastmilev1.TripStatus(lastmilev1.TripStatus_value[d.Status]),
+		CreatedAt:       timestamppb.New(d.CreatedAt),
+		UpdatedAt:       timestamppb.New(d.UpdatedAt),
+		RatingByRider:   d.RiderRating.toRating(),
+		RatingByDriver:  d.DriverRating.toRating(),
+		RequestId:       d.RequestID,
+		Cancellation:    d.Cancellation.toCancellation(),
+		DriverArrivedAt: timestampPtr(d.ArrivedAt),
+		Pickup:          d.Pickup.toPickup(),
+		DropoffPlan:     d.DropoffPlan.toDropoffPlan(),
+	}
+}
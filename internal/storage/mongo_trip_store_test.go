@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TestTripDocRoundTrip checks that every trip field survives the Mongo
+// document. The fixture must set every field, so a new one fails here until
+// the document stores it.
+func TestTripDocRoundTrip(t *testing.T) {
+	at := func(minute int) *timestamppb.Timestamp {
+		return timestamppb.New(time.Date(2026, 3, 2, 9, minute, 0, 0, time.UTC))
+	}
+	trip := &lastmilev1.Trip{
+		TripId:         "t1",
+		RiderId:        "r1",
+		DriverId:       "d1",
+		StationId:      "s1",
+		DestinationId:  "x",
+		Status:         lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+		CreatedAt:      at(0),
+		UpdatedAt:      at(1),
+		RatingByRider:  &lastmilev1.TripRating{Stars: 5, Tags: []string{"friendly"}, RatedAt: at(30)},
+		RatingByDriver: &lastmilev1.TripRating{Stars: 4, RatedAt: at(31)},
+		RequestId:      "req1",
+		Cancellation: &lastmilev1.Cancellation{
+			CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_RIDER,
+			Reason:     lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_CHANGED_PLANS,
+			CanceledAt: at(2),
+		},
+		DriverArrivedAt: at(3),
+		Pickup:          &lastmilev1.PickupVerification{Pin: "0420", ExpiresAt: at(40), FailedAttempts: 1, VerifiedAt: at(5)},
+		DropoffPlan: &lastmilev1.DropoffPlan{
+			Objective:     lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_MAX_DELAY,
+			DepartureTime: at(10),
+			PlannedAt:     at(4),
+			Stops: []*lastmilev1.DropoffStop{
+				{DestinationId: "y", Riders: 2, Eta: at(14), DistanceMeters: 1000},
+				{DestinationId: "x", Riders: 1, Eta: at(22), DistanceMeters: 3500},
+			},
+		},
+	}
+	message := trip.ProtoReflect()
+	fields := message.Descriptor().Fields()
+	for i := range fields.Len() {
+		if field := fields.Get(i); !message.Has(field) {
+			t.Fatalf("fixture leaves %s unset", field.Name())
+		}
+	}
+
+	data, err := bson.Marshal(toTripDoc(trip))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var doc tripDoc
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	got := doc.toTrip()
+	if !proto.Equal(got, trip) {
+		got.ProtoReflect().Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+			if !value.Equal(message.Get(field)) {
+				t.Errorf("%s: got %v, want %v", field.Name(), value, message.Get(field))
+			}
+			return true
+		})
+		t.Fatalf("trip did not survive the document")
+	}
+}
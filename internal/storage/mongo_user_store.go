@@ -3,18 +3,26 @@ package storage
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
+	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type MongoUserStore struct {
 	riders  *mongo.Collection
 	drivers *mongo.Collection
+	// phones holds one document per active phone number, keyed by it, so a
+	// number belongs to one rider or driver at a time.
+	phones *mongo.Collection
 }
 
-func NewMongoUserStore(client *mongo.Client, dbName, riderCollection, driverCollection string) *MongoUserStore {
+func NewMongoUserStore(client *mongo.Client, dbName, riderCollection, driverCollection, phoneCollection string) *MongoUserStore {
 	if client == nil {
 		return nil
 	}
@@ -27,100 +35,659 @@ func NewMongoUserStore(client *mongo.Client, dbName, riderCollection, driverColl
 	if driverCollection == "" {
 		driverCollection = "drivers"
 	}
+	if phoneCollection == "" {
+		phoneCollection = "phones"
+	}
 	db := client.Database(dbName)
 	return &MongoUserStore{
 		riders:  db.Collection(riderCollection),
 		drivers: db.Collection(driverCollection),
+		phones:  db.Collection(phoneCollection),
 	}
 }
 
-func (s *MongoUserStore) CreateRider(ctx context.Context, profile *lastmilev1.RiderProfile) error {
-	if profile == nil || profile.RiderId == "" {
-		return ErrInvalidArgument
+func (s *MongoUserStore) EnsureIndexes(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "active_phone", Value: 1}},
+		Options: options.Index().
+			SetName("active_phone_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"active_phone": bson.M{"$exists": true}}),
 	}
-	doc := riderDoc{
-		ID:    profile.RiderId,
-		Name:  profile.Name,
-		Phone: profile.Phone,
+	for _, collection := range []*mongo.Collection{s.riders, s.drivers} {
+		if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+			return err
+		}
+	}
+	if _, err := s.drivers.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "vehicle_id", Value: 1}},
+		Options: options.Index().SetName("vehicle_id"),
+	}); err != nil {
+		return err
+	}
+	if _, err := s.drivers.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "active_vehicle", Value: 1}},
+		Options: options.Index().
+			SetName("active_vehicle_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"active_vehicle": bson.M{"$exists": true}}),
+	}); err != nil {
+		return err
 	}
-	_, err := s.riders.InsertOne(ctx, doc)
+	if err := s.claimExistingVehicles(ctx); err != nil {
+		return err
+	}
+	return s.claimExistingPhones(ctx)
+}
+
+// claimExistingVehicles sets active_vehicle on drivers written before it
+// existed. A vehicle already claimed keeps its driver.
+func (s *MongoUserStore) claimExistingVehicles(ctx context.Context) error {
+	cursor, err := s.drivers.Find(ctx, bson.M{
+		"active_vehicle": bson.M{"$exists": false},
+		"vehicle_id":     bson.M{"$nin": bson.A{"", nil}},
+		"deleted_at":     nil,
+		"status":         bson.M{"$ne": int32(lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED)},
+	}, options.Find().SetProjection(bson.M{"vehicle_id": 1}))
 	if err != nil {
-		if mongo.IsDuplicateKeyError(err) {
-			return ErrAlreadyExists
-		}
 		return err
 	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID        string `bson:"_id"`
+			VehicleID string `bson:"vehicle_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if _, err := s.drivers.UpdateOne(ctx,
+			bson.M{"_id": doc.ID, "active_vehicle": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"active_vehicle": doc.VehicleID}},
+		); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// claimExistingPhones adds the phones of profiles written before the phones
+// collection existed. A number already claimed keeps its owner.
+func (s *MongoUserStore) claimExistingPhones(ctx context.Context) error {
+	for _, profiles := range []struct {
+		collection *mongo.Collection
+		owner      func(string) string
+	}{{s.riders, riderOwner}, {s.drivers, driverOwner}} {
+		owner := profiles.owner
+		cursor, err := profiles.collection.Find(ctx, bson.M{"active_phone": bson.M{"$exists": true}},
+			options.Find().SetProjection(bson.M{"active_phone": 1}))
+		if err != nil {
+			return err
+		}
+		for cursor.Next(ctx) {
+			var doc struct {
+				ID          string `bson:"_id"`
+				ActivePhone string `bson:"active_phone"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				_ = cursor.Close(ctx)
+				return err
+			}
+			if _, err := s.phones.UpdateOne(ctx,
+				bson.M{"_id": doc.ActivePhone},
+				bson.M{"$setOnInsert": bson.M{"owner": owner(doc.ID)}},
+				options.Update().SetUpsert(true),
+			); err != nil && !mongo.IsDuplicateKeyError(err) {
+				_ = cursor.Close(ctx)
+				return err
+			}
+		}
+		err = cursor.Err()
+		_ = cursor.Close(ctx)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (s *MongoUserStore) CreateRider(ctx context.Context, profile *lastmilev1.RiderProfile) error {
+	if profile == nil || profile.RiderId == "" {
+		return ErrInvalidArgument
+	}
+	return s.writeProfile(ctx, s.riders, profile.RiderId, riderOwner(profile.RiderId), profile.Phone, true, func(ctx context.Context) error {
+		_, err := s.riders.InsertOne(ctx, newRiderDoc(profile))
+		return userWriteError(err)
+	})
+}
+
 func (s *MongoUserStore) GetRider(ctx context.Context, riderID string) (*lastmilev1.RiderProfile, error) {
 	if riderID == "" {
 		return nil, ErrInvalidArgument
 	}
 	var doc riderDoc
-	err := s.riders.FindOne(ctx, bson.M{"_id": riderID}).Decode(&doc)
+	err := s.riders.FindOne(ctx, bson.M{"_id": riderID, "deleted_at": nil}).Decode(&doc)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	return &lastmilev1.RiderProfile{
-		RiderId: doc.ID,
-		Name:    doc.Name,
-		Phone:   doc.Phone,
-	}, nil
+	return doc.toProfile(), nil
+}
+
+func (s *MongoUserStore) GetRiderByPhone(ctx context.Context, phone string) (*lastmilev1.RiderProfile, error) {
+	if phone == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc riderDoc
+	err := s.riders.FindOne(ctx, bson.M{"active_phone": phone}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toProfile(), nil
+}
+
+func (s *MongoUserStore) UpdateRider(ctx context.Context, profile *lastmilev1.RiderProfile) error {
+	if profile == nil || profile.RiderId == "" {
+		return ErrInvalidArgument
+	}
+	return s.writeProfile(ctx, s.riders, profile.RiderId, riderOwner(profile.RiderId), profile.Phone, false, func(ctx context.Context) error {
+		return updateProfile(ctx, s.riders, profile.RiderId, profileUpdate(bson.M{
+			"name":  profile.Name,
+			"phone": profile.Phone,
+		}, profile.Phone))
+	})
+}
+
+func (s *MongoUserStore) AddRiderRating(ctx context.Context, riderID string, stars int32) error {
+	if riderID == "" {
+		return ErrInvalidArgument
+	}
+	return updateProfile(ctx, s.riders, riderID, ratingUpdate(stars))
+}
+
+func (s *MongoUserStore) AddRiderNoShow(ctx context.Context, riderID, requestID string) error {
+	if riderID == "" || requestID == "" {
+		return ErrInvalidArgument
+	}
+	return updateProfileOnce(ctx, s.riders, riderID, "no_show_requests", requestID, bson.M{
+		"$inc":  bson.M{"no_show_count": int32(1)},
+		"$push": bson.M{"no_show_requests": requestID},
+	})
+}
+
+func (s *MongoUserStore) DeleteRider(ctx context.Context, riderID string, deletedAt time.Time) error {
+	if riderID == "" {
+		return ErrInvalidArgument
+	}
+	return s.writeProfile(ctx, s.riders, riderID, riderOwner(riderID), "", false, func(ctx context.Context) error {
+		return softDelete(ctx, s.riders, riderID, deletedAt)
+	})
+}
+
+func (s *MongoUserStore) ListRiders(ctx context.Context, filter UserFilter, after string, limit int) ([]*lastmilev1.RiderProfile, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	return findKeysetPage(ctx, s.riders, userQuery(filter), after, limit, func(doc *riderDoc) (string, *lastmilev1.RiderProfile) {
+		return doc.ID, doc.toProfile()
+	})
 }
 
 func (s *MongoUserStore) CreateDriver(ctx context.Context, profile *lastmilev1.DriverProfile) error {
 	if profile == nil || profile.DriverId == "" {
 		return ErrInvalidArgument
 	}
-	doc := driverDoc{
-		ID:        profile.DriverId,
-		Name:      profile.Name,
-		Phone:     profile.Phone,
-		VehicleID: profile.VehicleId,
+	return s.writeProfile(ctx, s.drivers, profile.DriverId, driverOwner(profile.DriverId), profile.Phone, true, func(ctx context.Context) error {
+		_, err := s.drivers.InsertOne(ctx, newDriverDoc(profile))
+		return userWriteError(err)
+	})
+}
+
+func (s *MongoUserStore) GetDriver(ctx context.Context, driverID string) (*lastmilev1.DriverProfile, error) {
+	if driverID == "" {
+		return nil, ErrInvalidArgument
 	}
-	_, err := s.drivers.InsertOne(ctx, doc)
+	var doc driverDoc
+	err := s.drivers.FindOne(ctx, bson.M{"_id": driverID, "deleted_at": nil}).Decode(&doc)
 	if err != nil {
-		if mongo.IsDuplicateKeyError(err) {
-			return ErrAlreadyExists
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
 		}
-		return err
+		return nil, err
 	}
-	return nil
+	return doc.toProfile(), nil
 }
 
-func (s *MongoUserStore) GetDriver(ctx context.Context, driverID string) (*lastmilev1.DriverProfile, error) {
-	if driverID == "" {
+func (s *MongoUserStore) GetDriverByPhone(ctx context.Context, phone string) (*lastmilev1.DriverProfile, error) {
+	if phone == "" {
 		return nil, ErrInvalidArgument
 	}
 	var doc driverDoc
-	err := s.drivers.FindOne(ctx, bson.M{"_id": driverID}).Decode(&doc)
+	err := s.drivers.FindOne(ctx, bson.M{"active_phone": phone}).Decode(&doc)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	return &lastmilev1.DriverProfile{
-		DriverId:  doc.ID,
-		Name:      doc.Name,
-		Phone:     doc.Phone,
-		VehicleId: doc.VehicleID,
-	}, nil
+	return doc.toProfile(), nil
+}
+
+func (s *MongoUserStore) GetDriverByVehicle(ctx context.Context, vehicleID string) (*lastmilev1.DriverProfile, error) {
+	if vehicleID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc driverDoc
+	err := s.drivers.FindOne(ctx, bson.M{"active_vehicle": vehicleID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toProfile(), nil
+}
+
+func (s *MongoUserStore) UpdateDriver(ctx context.Context, profile *lastmilev1.DriverProfile) error {
+	if profile == nil || profile.DriverId == "" {
+		return ErrInvalidArgument
+	}
+	doc := newDriverDoc(profile)
+	// A pipeline, so the vehicle claim follows the stored status rather than
+	// the one the caller read.
+	activeVehicle := any("$$REMOVE")
+	if doc.VehicleID != "" {
+		activeVehicle = bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$status", int32(lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED)}},
+			"$$REMOVE",
+			bson.M{"$literal": doc.VehicleID},
+		}}
+	}
+	activePhone := any("$$REMOVE")
+	if doc.Phone != "" {
+		activePhone = bson.M{"$literal": doc.Phone}
+	}
+	return s.writeProfile(ctx, s.drivers, profile.DriverId, driverOwner(profile.DriverId), doc.Phone, false, func(ctx context.Context) error {
+		return updateProfile(ctx, s.drivers, profile.DriverId, bson.A{bson.M{"$set": bson.M{
+			"name":           bson.M{"$literal": doc.Name},
+			"phone":          bson.M{"$literal": doc.Phone},
+			"vehicle_id":     bson.M{"$literal": doc.VehicleID},
+			"active_phone":   activePhone,
+			"active_vehicle": activeVehicle,
+		}}})
+	})
+}
+
+func (s *MongoUserStore) UpdateDriverVerification(ctx context.Context, profile *lastmilev1.DriverProfile, from lastmilev1.DriverStatus) error {
+	if profile == nil || profile.DriverId == "" {
+		return ErrInvalidArgument
+	}
+	doc := newDriverDoc(profile)
+	update := bson.M{"$set": bson.M{
+		"status":            doc.Status,
+		"status_reason":     doc.StatusReason,
+		"status_updated_at": doc.StatusUpdatedAt,
+		"documents":         doc.Documents,
+	}}
+	if profile.Status == lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED {
+		update["$unset"] = bson.M{"active_vehicle": ""}
+	}
+	// Profiles written before the status field existed have none.
+	status := any(int32(from))
+	if from == lastmilev1.DriverStatus_DRIVER_STATUS_UNSPECIFIED {
+		status = bson.M{"$in": bson.A{int32(from), nil}}
+	}
+	result, err := s.drivers.UpdateOne(ctx, bson.M{"_id": profile.DriverId, "deleted_at": nil, "status": status}, update)
+	if err != nil {
+		return userWriteError(err)
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	count, err := s.drivers.CountDocuments(ctx, bson.M{"_id": profile.DriverId, "deleted_at": nil})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrStatusChanged
+}
+
+func (s *MongoUserStore) AddDriverRating(ctx context.Context, driverID string, stars int32) error {
+	if driverID == "" {
+		return ErrInvalidArgument
+	}
+	return updateProfile(ctx, s.drivers, driverID, ratingUpdate(stars))
+}
+
+func (s *MongoUserStore) AddDriverCancellation(ctx context.Context, driverID, tripID string, penalty float64) error {
+	if driverID == "" || tripID == "" {
+		return ErrInvalidArgument
+	}
+	count := bson.M{"$ifNull": bson.A{"$cancellation_count", int32(0)}}
+	score := bson.M{"$cond": bson.A{
+		bson.M{"$gt": bson.A{count, 0}},
+		bson.M{"$ifNull": bson.A{"$reliability_score", 0.0}},
+		float64(MaxReliability),
+	}}
+	return updateProfileOnce(ctx, s.drivers, driverID, "canceled_trips", tripID, bson.A{bson.M{"$set": bson.M{
+		"cancellation_count": bson.M{"$add": bson.A{count, int32(1)}},
+		"reliability_score":  bson.M{"$max": bson.A{bson.M{"$subtract": bson.A{score, penalty}}, 0.0}},
+		"canceled_trips":     bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$canceled_trips", bson.A{}}}, bson.A{tripID}}},
+	}}})
+}
+
+func (s *MongoUserStore) DeleteDriver(ctx context.Context, driverID string, deletedAt time.Time) error {
+	if driverID == "" {
+		return ErrInvalidArgument
+	}
+	return s.writeProfile(ctx, s.drivers, driverID, driverOwner(driverID), "", false, func(ctx context.Context) error {
+		return softDelete(ctx, s.drivers, driverID, deletedAt)
+	})
+}
+
+func (s *MongoUserStore) ListDrivers(ctx context.Context, filter UserFilter, after string, limit int) ([]*lastmilev1.DriverProfile, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	return findKeysetPage(ctx, s.drivers, userQuery(filter), after, limit, func(doc *driverDoc) (string, *lastmilev1.DriverProfile) {
+		return doc.ID, doc.toProfile()
+	})
+}
+
+// writeProfile runs write in a transaction that also moves the profile's
+// claim in the phones collection to phone; an empty phone releases it.
+// Creating the profile (create) has no claim to release. This needs a
+// replica set.
+func (s *MongoUserStore) writeProfile(ctx context.Context, collection *mongo.Collection, id, owner, phone string, create bool, write func(context.Context) error) error {
+	session, err := s.phones.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		var current struct {
+			ActivePhone string `bson:"active_phone"`
+		}
+		if !create {
+			err := collection.FindOne(sc, bson.M{"_id": id, "deleted_at": nil}).Decode(&current)
+			if err != nil {
+				if errors.Is(err, mongo.ErrNoDocuments) {
+					return nil, ErrNotFound
+				}
+				return nil, err
+			}
+		}
+		if err := write(sc); err != nil {
+			return nil, err
+		}
+		if current.ActivePhone == phone {
+			return nil, nil
+		}
+		if current.ActivePhone != "" {
+			if _, err := s.phones.DeleteOne(sc, bson.M{"_id": current.ActivePhone, "owner": owner}); err != nil {
+				return nil, err
+			}
+		}
+		if phone != "" {
+			if _, err := s.phones.InsertOne(sc, bson.M{"_id": phone, "owner": owner}); err != nil {
+				if mongo.IsDuplicateKeyError(err) {
+					return nil, ErrPhoneInUse
+				}
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func userWriteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		if strings.Contains(err.Error(), "active_phone") {
+			return ErrPhoneInUse
+		}
+		if strings.Contains(err.Error(), "active_vehicle") {
+			return ErrVehicleInUse
+		}
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+// updateProfile applies update to a profile that is not deleted.
+func updateProfile(ctx context.Context, collection *mongo.Collection, id string, update any) error {
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id, "deleted_at": nil}, update)
+	if err != nil {
+		return userWriteError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// updateProfileOnce applies update unless key is already in the profile's
+// list field. The update must add key to that field in the same write.
+func updateProfileOnce(ctx context.Context, collection *mongo.Collection, id, field, key string, update any) error {
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id, "deleted_at": nil, field: bson.M{"$ne": key}}, update)
+	if err != nil {
+		return userWriteError(err)
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": id, "deleted_at": nil})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// profileUpdate sets the editable fields of a profile, leaving the counters
+// to their own atomic updates.
+func profileUpdate(fields bson.M, phone string) bson.M {
+	update := bson.M{"$set": fields}
+	if phone == "" {
+		update["$unset"] = bson.M{"active_phone": ""}
+	} else {
+		fields["active_phone"] = phone
+	}
+	return update
+}
+
+// ratingUpdate counts a rating of stars. The stored sum keeps the average
+// exact however many ratings land at once; profiles rated before it existed
+// start from average times count.
+func ratingUpdate(stars int32) bson.A {
+	count := bson.M{"$ifNull": bson.A{"$rating_count", int32(0)}}
+	sum := bson.M{"$ifNull": bson.A{"$rating_sum", bson.M{"$multiply": bson.A{
+		bson.M{"$ifNull": bson.A{"$rating_average", 0.0}}, count,
+	}}}}
+	return bson.A{
+		bson.M{"$set": bson.M{
+			"rating_count": bson.M{"$add": bson.A{count, int32(1)}},
+			"rating_sum":   bson.M{"$add": bson.A{sum, stars}},
+		}},
+		bson.M{"$set": bson.M{"rating_average": bson.M{"$divide": bson.A{"$rating_sum", "$rating_count"}}}},
+	}
+}
+
+func softDelete(ctx context.Context, collection *mongo.Collection, id string, deletedAt time.Time) error {
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": id, "deleted_at": nil},
+		bson.M{
+			"$set":   bson.M{"deleted_at": deletedAt.UTC()},
+			"$unset": bson.M{"active_phone": "", "active_vehicle": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func userQuery(filter UserFilter) bson.M {
+	query := bson.M{"deleted_at": nil}
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		pattern := regexp.QuoteMeta(q)
+		query["$or"] = bson.A{
+			bson.M{"name": bson.M{"$regex": pattern, "$options": "i"}},
+			bson.M{"phone": bson.M{"$regex": pattern}},
+		}
+	}
+	return query
 }
 
 type riderDoc struct {
-	ID    string `bson:"_id"`
-	Name  string `bson:"name"`
-	Phone string `bson:"phone"`
+	ID          string     `bson:"_id"`
+	Name        string     `bson:"name"`
+	Phone       string     `bson:"phone"`
+	ActivePhone string     `bson:"active_phone,omitempty"`
+	DeletedAt   *time.Time `bson:"deleted_at,omitempty"`
+	RatingAvg   float64    `bson:"rating_average,omitempty"`
+	RatingCount int32      `bson:"rating_count,omitempty"`
+	NoShows     int32      `bson:"no_show_count,omitempty"`
+}
+
+func newRiderDoc(profile *lastmilev1.RiderProfile) riderDoc {
+	doc := riderDoc{
+		ID:          profile.RiderId,
+		Name:        profile.Name,
+		Phone:       profile.Phone,
+		DeletedAt:   timePtr(profile.DeletedAt),
+		RatingAvg:   profile.RatingAverage,
+		RatingCount: profile.RatingCount,
+		NoShows:     profile.NoShowCount,
+	}
+	if doc.DeletedAt == nil {
+		doc.ActivePhone = doc.Phone
+	}
+	return doc
+}
+
+func (d riderDoc) toProfile() *lastmilev1.RiderProfile {
+	return &lastmilev1.RiderProfile{
+		RiderId:       d.ID,
+		Name:          d.Name,
+		Phone:         d.Phone,
+		DeletedAt:     timestampPtr(d.DeletedAt),
+		RatingAverage: d.RatingAvg,
+		RatingCount:   d.RatingCount,
+		NoShowCount:   d.NoShows,
+	}
 }
 
 type driverDoc struct {
-	ID        string `bson:"_id"`
-	Name      string `bson:"name"`
-	Phone     string `bson:"phone"`
-	VehicleID string `bson:"vehicle_id"`
+	ID              string              `bson:"_id"`
+	Name            string              `bson:"name"`
+	Phone           string              `bson:"phone"`
+	ActivePhone     string              `bson:"active_phone,omitempty"`
+	VehicleID       string              `bson:"vehicle_id"`
+	ActiveVehicle   string              `bson:"active_vehicle,omitempty"`
+	Status          int32               `bson:"status"`
+	StatusReason    string              `bson:"status_reason,omitempty"`
+	StatusUpdatedAt *time.Time          `bson:"status_updated_at,omitempty"`
+	Documents       []driverDocumentDoc `bson:"documents,omitempty"`
+	DeletedAt       *time.Time          `bson:"deleted_at,omitempty"`
+	RatingAvg       float64             `bson:"rating_average,omitempty"`
+	RatingCount     int32               `bson:"rating_count,omitempty"`
+	Cancellations   int32               `bson:"cancellation_count,omitempty"`
+	Reliability     float64             `bson:"reliability_score,omitempty"`
+}
+
+type driverDocumentDoc struct {
+	Type       int32      `bson:"type"`
+	Number     string     `bson:"number"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty"`
+	UploadedAt *time.Time `bson:"uploaded_at,omitempty"`
+	Expired    bool       `bson:"expired"`
+}
+
+func newDriverDoc(profile *lastmilev1.DriverProfile) driverDoc {
+	doc := driverDoc{
+		ID:              profile.DriverId,
+		Name:            profile.Name,
+		Phone:           profile.Phone,
+		VehicleID:       profile.VehicleId,
+		Status:          int32(profile.Status),
+		StatusReason:    profile.StatusReason,
+		StatusUpdatedAt: timePtr(profile.StatusUpdatedAt),
+		DeletedAt:       timePtr(profile.DeletedAt),
+		RatingAvg:       profile.RatingAverage,
+		RatingCount:     profile.RatingCount,
+		Cancellations:   profile.CancellationCount,
+		Reliability:     profile.ReliabilityScore,
+	}
+	for _, document := range profile.Documents {
+		doc.Documents = append(doc.Documents, driverDocumentDoc{
+			Type:       int32(document.Type),
+			Number:     document.Number,
+			ExpiresAt:  timePtr(document.ExpiresAt),
+			UploadedAt: timePtr(document.UploadedAt),
+			Expired:    document.Expired,
+		})
+	}
+	if doc.DeletedAt == nil {
+		doc.ActivePhone = doc.Phone
+	}
+	doc.ActiveVehicle = heldVehicle(profile)
+	return doc
+}
+
+func (d driverDoc) toProfile() *lastmilev1.DriverProfile {
+	profile := &lastmilev1.DriverProfile{
+		DriverId:          d.ID,
+		Name:              d.Name,
+		Phone:             d.Phone,
+		VehicleId:         d.VehicleID,
+		Status:            lastmilev1.DriverStatus(d.Status),
+		StatusReason:      d.StatusReason,
+		StatusUpdatedAt:   timestampPtr(d.StatusUpdatedAt),
+		DeletedAt:         timestampPtr(d.DeletedAt),
+		RatingAverage:     d.RatingAvg,
+		RatingCount:       d.RatingCount,
+		CancellationCount: d.Cancellations,
+		ReliabilityScore:  d.Reliability,
+	}
+	for _, document := range d.Documents {
+		profile.Documents = append(profile.Documents, &lastmilev1.DriverDocument{
+			Type:       lastmilev1.DriverDocumentType(document.Type),
+			Number:     document.Number,
+			ExpiresAt:  timestampPtr(document.ExpiresAt),
+			UploadedAt: timestampPtr(document.UploadedAt),
+			Expired:    document.Expired,
+		})
+	}
+	return profile
+}
+
+func timePtr(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+func timestampPtr(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
 }
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoVehicleStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoVehicleStore(client *mongo.Client, dbName, collectionName string) *MongoVehicleStore {
+	if client == nil {
+		return nil
+	}
+	if dbName == "" {
+		dbName = "lastmile"
+	}
+	if collectionName == "" {
+		collectionName = "vehicles"
+	}
+	return &MongoVehicleStore{collection: client.Database(dbName).Collection(collectionName)}
+}
+
+func (s *MongoVehicleStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "plate", Value: 1}},
+		Options: options.Index().SetName("plate_unique").SetUnique(true),
+	})
+	return err
+}
+
+func (s *MongoVehicleStore) CreateVehicle(ctx context.Context, vehicle *lastmilev1.Vehicle) error {
+	if vehicle == nil || vehicle.VehicleId == "" || vehicle.Plate == "" {
+		return ErrInvalidArgument
+	}
+	_, err := s.collection.InsertOne(ctx, newVehicleDoc(vehicle))
+	return vehicleWriteError(err)
+}
+
+func (s *MongoVehicleStore) GetVehicle(ctx context.Context, vehicleID string) (*lastmilev1.Vehicle, error) {
+	if vehicleID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var doc vehicleDoc
+	err := s.collection.FindOne(ctx, bson.M{"_id": vehicleID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.toVehicle(), nil
+}
+
+func (s *MongoVehicleStore) UpdateVehicle(ctx context.Context, vehicle *lastmilev1.Vehicle) error {
+	if vehicle == nil || vehicle.VehicleId == "" || vehicle.Plate == "" {
+		return ErrInvalidArgument
+	}
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": vehicle.VehicleId}, newVehicleDoc(vehicle))
+	if err != nil {
+		return vehicleWriteError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoVehicleStore) DeleteVehicle(ctx context.Context, vehicleID string) error {
+	if vehicleID == "" {
+		return ErrInvalidArgument
+	}
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": vehicleID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoVehicleStore) ListVehicles(ctx context.Context, after string, limit int) ([]*lastmilev1.Vehicle, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	return findKeysetPage(ctx, s.collection, bson.M{}, after, limit, func(doc *vehicleDoc) (string, *lastmilev1.Vehicle) {
+		return doc.ID, doc.toVehicle()
+	})
+}
+
+func vehicleWriteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		if strings.Contains(err.Error(), "plate_unique") {
+			return ErrPlateInUse
+		}
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+type vehicleDoc struct {
+	ID                    string  `bson:"_id"`
+	Plate                 string  `bson:"plate"`
+	Type                  int32   `bson:"type"`
+	SeatCapacity          int32   `bson:"seat_capacity"`
+	AccessibilityFeatures []int32 `bson:"accessibility_features,omitempty"`
+}
+
+func newVehicleDoc(vehicle *lastmilev1.Vehicle) vehicleDoc {
+	doc := vehicleDoc{
+		ID:           vehicle.VehicleId,
+		Plate:        vehicle.Plate,
+		Type:         int32(vehicle.Type),
+		SeatCapacity: vehicle.SeatCapacity,
+	}
+	for _, feature := range vehicle.AccessibilityFeatures {
+		doc.AccessibilityFeatures = append(doc.AccessibilityFeatures, int32(feature))
+	}
+	return doc
+}
+
+func (d vehicleDoc) toVehicle() *lastmilev1.Vehicle {
+	vehicle := &lastmilev1.Vehicle{
+		VehicleId:    d.ID,
+		Plate:        d.Plate,
+		Type:         lastmilev1.VehicleType(d.Type),
+		SeatCapacity: d.SeatCapacity,
+	}
+	for _, feature := range d.AccessibilityFeatures {
+		vehicle.AccessibilityFeatures = append(vehicle.AccessibilityFeatures, lastmilev1.AccessibilityFeature(feature))
+	}
+	return vehicle
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type NotificationStore interface {
+	CreateNotification(ctx context.Context, notification *lastmilev1.Notification) error
+	ListNotifications(ctx context.Context, riderID, driverID string) ([]*lastmilev1.Notification, error)
+}
+
+type MemoryNotificationStore struct {
+	mu            sync.RWMutex
+	notifications []*lastmilev1.Notification
+}
+
+func NewMemoryNotificationStore() *MemoryNotificationStore {
+	return &MemoryNotificationStore{}
+}
+
+func (s *MemoryNotificationStore) CreateNotification(_ context.Context, notification *lastmilev1.Notification) error {
+	if notification == nil || notification.NotificationId == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	s.notifications = append(s.notifications, proto.Clone(notification).(*lastmilev1.Notification))
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryNotificationStore) ListNotifications(_ context.Context, riderID, driverID string) ([]*lastmilev1.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var notifications []*lastmilev1.Notification
+	for _, notification := range s.notifications {
+		if riderID != "" && notification.RiderId != riderID {
+			continue
+		}
+		if driverID != "" && notification.DriverId != driverID {
+			continue
+		}
+		notifications = append(notifications, proto.Clone(notification).(*lastmilev1.Notification))
+	}
+	return notifications, nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type OutboxMessage struct {
+	Stream string
+	Event  *lastmilev1.Event
+}
+
+type OutboxEntry struct {
+	ID        string
+	Stream    string
+	Event     *lastmilev1.Event
+	CreatedAt time.Time
+}
+
+type Outbox interface {
+	Enqueue(ctx context.Context, messages ...OutboxMessage) error
+	ListPending(ctx context.Context, limit int) ([]OutboxEntry, error)
+	MarkPublished(ctx context.Context, entries []OutboxEntry) error
+}
+
+type MemoryOutbox struct {
+	mu      sync.Mutex
+	entries []OutboxEntry
+	nextID  int
+}
+
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+func (o *MemoryOutbox) Enqueue(_ context.Context, messages ...OutboxMessage) error {
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	o.append(messages)
+	return nil
+}
+
+func (o *MemoryOutbox) ListPending(_ context.Context, limit int) ([]OutboxEntry, error) {
+	if limit <= 0 {
+		return nil, ErrInvalidArgument
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	end := limit
+	if end > len(o.entries) {
+		end = len(o.entries)
+	}
+	pending := make([]OutboxEntry, 0, end)
+	for _, entry := range o.entries[:end] {
+		entry.Event = proto.Clone(entry.Event).(*lastmilev1.Event)
+		pending = append(pending, entry)
+	}
+	return pending, nil
+}
+
+func (o *MemoryOutbox) MarkPublished(_ context.Context, entries []OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	last, err := strconv.Atoi(entries[len(entries)-1].ID)
+	if err != nil {
+		return ErrInvalidArgument
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	drop := 0
+	for drop < len(o.entries) {
+		id, _ := strconv.Atoi(o.entries[drop].ID)
+		if id > last {
+			break
+		}
+		drop++
+	}
+	o.entries = append(o.entries[:0], o.entries[drop:]...)
+	return nil
+}
+
+func (o *MemoryOutbox) append(messages []OutboxMessage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	for _, message := range messages {
+		o.nextID++
+		o.entries = append(o.entries, OutboxEntry{
+			ID:        strconv.Itoa(o.nextID),
+			Stream:    message.Stream,
+			Event:     proto.Clone(message.Event).(*lastmilev1.Event),
+			CreatedAt: now,
+		})
+	}
+}
+
+func validateOutboxMessages(messages []OutboxMessage) error {
+	for _, message := range messages {
+		if message.Stream == "" || message.Event == nil {
+			return ErrInvalidArgument
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// PickupStore writes a trip and its ride request together, so a verified
+// pickup never moves one without the other.
+type PickupStore interface {
+	// StartPickup moves a SCHEDULED trip to ACTIVE with its pickup verified
+	// at verifiedAt, and its MATCHED ride request to PICKED_UP, in one
+	// write. The attempt counted for the correct PIN is taken back and
+	// nothing else changes, so concurrent attempts and updates survive. It
+	// returns ErrStatusChanged if either has left that status.
+	StartPickup(ctx context.Context, tripID, requestID string, verifiedAt time.Time, messages ...OutboxMessage) error
+	// AddPickupAttempt atomically counts an attempt at the PIN of a scheduled
+	// trip and returns the new count. It returns ErrLimitReached once limit
+	// attempts are counted, and ErrNotFound for a missing or unscheduled trip
+	// or one without a PIN.
+	AddPickupAttempt(ctx context.Context, tripID string, limit int32) (int32, error)
+}
+
+type MemoryPickupStore struct {
+	trips    *MemoryTripStore
+	requests *MemoryRideRequestStore
+}
+
+func NewMemoryPickupStore(trips *MemoryTripStore, requests *MemoryRideRequestStore) *MemoryPickupStore {
+	if trips == nil || requests == nil {
+		return nil
+	}
+	return &MemoryPickupStore{trips: trips, requests: requests}
+}
+
+func (s *MemoryPickupStore) StartPickup(_ context.Context, tripID, requestID string, verifiedAt time.Time, messages ...OutboxMessage) error {
+	if tripID == "" || requestID == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	s.trips.mu.Lock()
+	defer s.trips.mu.Unlock()
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	trip, ok := s.trips.trips[tripID]
+	if !ok {
+		return ErrNotFound
+	}
+	request, ok := s.requests.requests[requestID]
+	if !ok {
+		return ErrNotFound
+	}
+	if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED || trip.Pickup == nil ||
+		request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		return ErrStatusChanged
+	}
+	startPickup(trip, request, verifiedAt)
+	s.trips.outbox.append(messages)
+	return nil
+}
+
+func (s *MemoryPickupStore) AddPickupAttempt(_ context.Context, tripID string, limit int32) (int32, error) {
+	if tripID == "" {
+		return 0, ErrInvalidArgument
+	}
+	s.trips.mu.Lock()
+	defer s.trips.mu.Unlock()
+	trip, ok := s.trips.trips[tripID]
+	if !ok || trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED || trip.Pickup == nil {
+		return 0, ErrNotFound
+	}
+	if trip.Pickup.FailedAttempts >= limit {
+		return 0, ErrLimitReached
+	}
+	trip.Pickup.FailedAttempts++
+	return trip.Pickup.FailedAttempts, nil
+}
+
+func startPickup(trip *lastmilev1.Trip, request *lastmilev1.RideRequest, verifiedAt time.Time) {
+	trip.Status = lastmilev1.TripStatus_TRIP_STATUS_ACTIVE
+	trip.UpdatedAt = timestamppb.New(verifiedAt)
+	trip.Pickup.VerifiedAt = trip.UpdatedAt
+	if trip.Pickup.FailedAttempts > 0 {
+		trip.Pickup.FailedAttempts--
+	}
+	request.Status = lastmilev1.RideStatus_RIDE_STATUS_PICKED_UP
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 type RedisConfig struct {
@@ -39,3 +41,16 @@ func NewRedisClient(ctx context.Context, cfg RedisConfig) (*redis.Client, error)
 
 	return client, nil
 }
+
+// getJSON reads a protojson value inside a WATCH, returning ErrNotFound for a
+// missing key.
+func getJSON(ctx context.Context, tx *redis.Tx, key string, message proto.Message) error {
+	data, err := tx.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return protojson.Unmarshal(data, message)
+}
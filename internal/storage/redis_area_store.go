@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// fullScanBatch is how many records unindexed lookups load per round trip.
+const fullScanBatch = 200
+
+type RedisAreaStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisAreaStore(client *redis.Client, prefix string) *RedisAreaStore {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	return &RedisAreaStore{client: client, prefix: prefix}
+}
+
+func (s *RedisAreaStore) Upsert(ctx context.Context, area *lastmilev1.ServiceArea) error {
+	if area == nil || area.AreaId == "" {
+		return ErrInvalidArgument
+	}
+	payload, err := protojson.Marshal(area)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.areaKey(area.AreaId), payload, 0)
+		pipe.ZAdd(ctx, s.indexKey(), redis.Z{Score: 0, Member: area.AreaId})
+		return nil
+	})
+	return err
+}
+
+func (s *RedisAreaStore) Get(ctx context.Context, areaID string) (*lastmilev1.ServiceArea, error) {
+	if areaID == "" {
+		return nil, ErrInvalidArgument
+	}
+	data, err := s.client.Get(ctx, s.areaKey(areaID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var area lastmilev1.ServiceArea
+	if err := protojson.Unmarshal(data, &area); err != nil {
+		return nil, err
+	}
+	return &area, nil
+}
+
+func (s *RedisAreaStore) Delete(ctx context.Context, areaID string) error {
+	if areaID == "" {
+		return ErrInvalidArgument
+	}
+	return redisDelete(ctx, s.client, s.areaKey(areaID), s.indexKey(), areaID)
+}
+
+func (s *RedisAreaStore) List(ctx context.Context, after string, limit int) ([]*lastmilev1.ServiceArea, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	page := newKeysetPage[*lastmilev1.ServiceArea](limit)
+	err := scanLex(ctx, s.client, s.indexKey(), s.areaKey, after, limit+1, func(id string, data []byte) (bool, error) {
+		var area lastmilev1.ServiceArea
+		if err := protojson.Unmarshal(data, &area); err != nil {
+			return false, err
+		}
+		return page.add(id, &area), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return page.items, page.next, nil
+}
+
+// Locate scans every area; there is no polygon index in Redis.
+func (s *RedisAreaStore) Locate(ctx context.Context, point *lastmilev1.LatLng) ([]*lastmilev1.ServiceArea, error) {
+	if point == nil {
+		return nil, ErrInvalidArgument
+	}
+	var areas []*lastmilev1.ServiceArea
+	err := scanLex(ctx, s.client, s.indexKey(), s.areaKey, "", fullScanBatch, func(_ string, data []byte) (bool, error) {
+		var area lastmilev1.ServiceArea
+		if err := protojson.Unmarshal(data, &area); err != nil {
+			return false, err
+		}
+		if polygonContains(area.Boundary, point) {
+			areas = append(areas, &area)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return areas, nil
+}
+
+func (s *RedisAreaStore) areaKey(areaID string) string {
+	return fmt.Sprintf("%s:area:%s", s.prefix, areaID)
+}
+
+func (s *RedisAreaStore) indexKey() string {
+	return fmt.Sprintf("%s:areas", s.prefix)
+}
+
+type RedisDestinationStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisDestinationStore(client *redis.Client, prefix string) *RedisDestinationStore {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	return &RedisDestinationStore{client: client, prefix: prefix}
+}
+
+func (s *RedisDestinationStore) Upsert(ctx context.Context, destination *lastmilev1.Destination) error {
+	if destination == nil || destination.DestinationId == "" {
+		return ErrInvalidArgument
+	}
+	payload, err := protojson.Marshal(destination)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.destinationKey(destination.DestinationId), payload, 0)
+		pipe.ZAdd(ctx, s.indexKey(), redis.Z{Score: 0, Member: destination.DestinationId})
+		return nil
+	})
+	return err
+}
+
+func (s *RedisDestinationStore) Get(ctx context.Context, destinationID string) (*lastmilev1.Destination, error) {
+	if destinationID == "" {
+		return nil, ErrInvalidArgument
+	}
+	data, err := s.client.Get(ctx, s.destinationKey(destinationID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var destination lastmilev1.Destination
+	if err := protojson.Unmarshal(data, &destination); err != nil {
+		return nil, err
+	}
+	return &destination, nil
+}
+
+func (s *RedisDestinationStore) Delete(ctx context.Context, destinationID string) error {
+	if destinationID == "" {
+		return ErrInvalidArgument
+	}
+	return redisDelete(ctx, s.client, s.destinationKey(destinationID), s.indexKey(), destinationID)
+}
+
+func (s *RedisDestinationStore) List(ctx context.Context, after string, limit int) ([]*lastmilev1.Destination, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	page := newKeysetPage[*lastmilev1.Destination](limit)
+	err := scanLex(ctx, s.client, s.indexKey(), s.destinationKey, after, limit+1, func(id string, data []byte) (bool, error) {
+		var destination lastmilev1.Destination
+		if err := protojson.Unmarshal(data, &destination); err != nil {
+			return false, err
+		}
+		return page.add(id, &destination), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return page.items, page.next, nil
+}
+
+func (s *RedisDestinationStore) destinationKey(destinationID string) string {
+	return fmt.Sprintf("%s:destination:%s", s.prefix, destinationID)
+}
+
+func (s *RedisDestinationStore) indexKey() string {
+	return fmt.Sprintf("%s:destinations", s.prefix)
+}
+
+// redisDelete removes a payload key and its id from a sorted set index in one
+// transaction, returning ErrNotFound when the payload is already gone.
+func redisDelete(ctx context.Context, client *redis.Client, key, indexKey, id string) error {
+	return client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return ErrNotFound
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.ZRem(ctx, indexKey, id)
+			return nil
+		})
+		return err
+	}, key)
+}
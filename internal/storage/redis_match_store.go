@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// RedisMatchStore writes through the trip and ride request stores in one
+// MULTI block, so both must use the same client.
+type RedisMatchStore struct {
+	trips    *RedisTripStore
+	requests *RedisRideRequestStore
+}
+
+func NewRedisMatchStore(trips *RedisTripStore, requests *RedisRideRequestStore) *RedisMatchStore {
+	if trips == nil || requests == nil {
+		return nil
+	}
+	return &RedisMatchStore{trips: trips, requests: requests}
+}
+
+func (s *RedisMatchStore) CreateMatch(ctx context.Context, trip *lastmilev1.Trip, request *lastmilev1.RideRequest, messages ...OutboxMessage) error {
+	if trip == nil || trip.TripId == "" || request == nil || request.RequestId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	tripPayload, err := protojson.Marshal(trip)
+	if err != nil {
+		return err
+	}
+	requestPayload, err := protojson.Marshal(request)
+	if err != nil {
+		return err
+	}
+	tripKey := s.trips.tripKey(trip.TripId)
+	requestKey := s.requests.requestKey(request.RequestId)
+	return s.trips.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, tripKey).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrAlreadyExists
+		}
+		data, err := tx.Get(ctx, requestKey).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				return ErrNotFound
+			}
+			return err
+		}
+		var stored lastmilev1.RideRequest
+		if err := protojson.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		if stored.Status != lastmilev1.RideStatus_RIDE_STATUS_PENDING {
+			return ErrNotFound
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.trips.set(ctx, pipe, trip, tripPayload)
+			s.requests.set(ctx, pipe, request, requestPayload, stored.Status)
+			return s.trips.outbox.add(ctx, pipe, messages)
+		})
+		return err
+	}, tripKey, requestKey)
+}
+
+func (s *RedisMatchStore) CancelMatch(ctx context.Context, tripID, requestID string, cancellation *lastmilev1.Cancellation, requestStatus lastmilev1.RideStatus, messages ...OutboxMessage) error {
+	if tripID == "" || requestID == "" || cancellation == nil {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	tripKey := s.trips.tripKey(tripID)
+	requestKey := s.requests.requestKey(requestID)
+	return s.trips.client.Watch(ctx, func(tx *redis.Tx) error {
+		var trip lastmilev1.Trip
+		if err := getJSON(ctx, tx, tripKey, &trip); err != nil {
+			return err
+		}
+		var request lastmilev1.RideRequest
+		if err := getJSON(ctx, tx, requestKey, &request); err != nil {
+			return err
+		}
+		if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED || request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+			return ErrStatusChanged
+		}
+		from := request.Status
+		cancelMatch(&trip, &request, cancellation, requestStatus)
+		tripPayload, err := protojson.Marshal(&trip)
+		if err != nil {
+			return err
+		}
+		requestPayload, err := protojson.Marshal(&request)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.trips.set(ctx, pipe, &trip, tripPayload)
+			s.requests.set(ctx, pipe, &request, requestPayload, from)
+			return s.trips.outbox.add(ctx, pipe, messages)
+		})
+		return err
+	}, tripKey, requestKey)
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+)
+
+type RedisOutbox struct {
+	client    *redis.Client
+	key       string
+	cursorKey string
+}
+
+func NewRedisOutbox(client *redis.Client, prefix, source string) *RedisOutbox {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	if source == "" {
+		source = "default"
+	}
+	return &RedisOutbox{
+		client:    client,
+		key:       fmt.Sprintf("%s:outbox:%s", prefix, source),
+		cursorKey: fmt.Sprintf("%s:outbox:%s:cursor", prefix, source),
+	}
+}
+
+func (o *RedisOutbox) Enqueue(ctx context.Context, messages ...OutboxMessage) error {
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	pipe := o.client.TxPipeline()
+	if err := o.add(ctx, pipe, messages); err != nil {
+		return err
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (o *RedisOutbox) ListPending(ctx context.Context, limit int) ([]OutboxEntry, error) {
+	if limit <= 0 {
+		return nil, ErrInvalidArgument
+	}
+	cursor, err := o.client.Get(ctx, o.cursorKey).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		cursor = "0-0"
+	}
+	messages, err := o.client.XRangeN(ctx, o.key, "("+cursor, "+", int64(limit)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]OutboxEntry, 0, len(messages))
+	for _, msg := range messages {
+		stream, _ := msg.Values["stream"].(string)
+		raw, _ := msg.Values["event"].(string)
+		var event lastmilev1.Event
+		if err := proto.Unmarshal([]byte(raw), &event); err != nil {
+			return nil, err
+		}
+		entries = append(entries, OutboxEntry{
+			ID:        msg.ID,
+			Stream:    stream,
+			Event:     &event,
+			CreatedAt: streamIDTime(msg.ID),
+		})
+	}
+	return entries, nil
+}
+
+func (o *RedisOutbox) MarkPublished(ctx context.Context, entries []OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	last := entries[len(entries)-1].ID
+	pipe := o.client.TxPipeline()
+	pipe.Set(ctx, o.cursorKey, last, 0)
+	pipe.XTrimMinID(ctx, o.key, last)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (o *RedisOutbox) add(ctx context.Context, pipe redis.Pipeliner, messages []OutboxMessage) error {
+	for _, message := range messages {
+		payload, err := proto.Marshal(message.Event)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: o.key,
+			Values: []any{"stream", message.Stream, "event", payload},
+		})
+	}
+	return nil
+}
+
+func streamIDTime(id string) time.Time {
+	millis, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis)
+}
+
+func redisValueBytes(value any) ([]byte, bool) {
+	switch v := value.(type) {
+	case string:
+		return []byte(v), true
+	case []byte:
+		return v, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// RedisPickupStore writes through the trip and ride request stores in one
+// MULTI block, so both must use the same client.
+type RedisPickupStore struct {
+	trips    *RedisTripStore
+	requests *RedisRideRequestStore
+}
+
+func NewRedisPickupStore(trips *RedisTripStore, requests *RedisRideRequestStore) *RedisPickupStore {
+	if trips == nil || requests == nil {
+		return nil
+	}
+	return &RedisPickupStore{trips: trips, requests: requests}
+}
+
+func (s *RedisPickupStore) StartPickup(ctx context.Context, tripID, requestID string, verifiedAt time.Time, messages ...OutboxMessage) error {
+	if tripID == "" || requestID == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	tripKey := s.trips.tripKey(tripID)
+	requestKey := s.requests.requestKey(requestID)
+	return s.trips.client.Watch(ctx, func(tx *redis.Tx) error {
+		var trip lastmilev1.Trip
+		if err := getJSON(ctx, tx, tripKey, &trip); err != nil {
+			return err
+		}
+		var request lastmilev1.RideRequest
+		if err := getJSON(ctx, tx, requestKey, &request); err != nil {
+			return err
+		}
+		if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED || trip.Pickup == nil ||
+			request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+			return ErrStatusChanged
+		}
+		from := request.Status
+		startPickup(&trip, &request, verifiedAt)
+		tripPayload, err := protojson.Marshal(&trip)
+		if err != nil {
+			return err
+		}
+		requestPayload, err := protojson.Marshal(&request)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.trips.set(ctx, pipe, &trip, tripPayload)
+			s.requests.set(ctx, pipe, &request, requestPayload, from)
+			return s.trips.outbox.add(ctx, pipe, messages)
+		})
+		return err
+	}, tripKey, requestKey)
+}
+
+func (s *RedisPickupStore) AddPickupAttempt(ctx context.Context, tripID string, limit int32) (int32, error) {
+	var attempts int32
+	err := s.trips.modify(ctx, tripID, func(trip *lastmilev1.Trip) error {
+		if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED || trip.Pickup == nil {
+			return ErrNotFound
+		}
+		if trip.Pickup.FailedAttempts >= limit {
+			return ErrLimitReached
+		}
+		trip.Pickup.FailedAttempts++
+		attempts = trip.Pickup.FailedAttempts
+		return nil
+	})
+	return attempts, err
+}
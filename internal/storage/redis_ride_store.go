@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type RedisRideRequestStore struct {
+	client *redis.Client
+	prefix string
+	outbox *RedisOutbox
+}
+
+func NewRedisRideRequestStore(client *redis.Client, prefix string, outbox *RedisOutbox) *RedisRideRequestStore {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	if outbox == nil {
+		outbox = NewRedisOutbox(client, prefix, "")
+	}
+	return &RedisRideRequestStore{client: client, prefix: prefix, outbox: outbox}
+}
+
+func (s *RedisRideRequestStore) CreateRideRequest(ctx context.Context, request *lastmilev1.RideRequest, messages ...OutboxMessage) error {
+	return s.create(ctx, request, messages)
+}
+
+func (s *RedisRideRequestStore) GetRideRequest(ctx context.Context, requestID string) (*lastmilev1.RideRequest, error) {
+	if requestID == "" {
+		return nil, ErrInvalidArgument
+	}
+	data, err := s.client.Get(ctx, s.requestKey(requestID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var request lastmilev1.RideRequest
+	if err := protojson.Unmarshal(data, &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (s *RedisRideRequestStore) UpdateRideRequest(ctx context.Context, request *lastmilev1.RideRequest, from lastmilev1.RideStatus, messages ...OutboxMessage) error {
+	if request == nil || request.RequestId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	payload, err := protojson.Marshal(request)
+	if err != nil {
+		return err
+	}
+	key := s.requestKey(request.RequestId)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		var stored lastmilev1.RideRequest
+		if err := getJSON(ctx, tx, key, &stored); err != nil {
+			return err
+		}
+		if stored.Status != from {
+			return ErrStatusChanged
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.set(ctx, pipe, request, payload, from)
+			return s.outbox.add(ctx, pipe, messages)
+		})
+		return err
+	}, key)
+}
+
+func (s *RedisRideRequestStore) ListRideRequests(ctx context.Context, filter RideRequestFilter) ([]*lastmilev1.RideRequest, error) {
+	var sets []string
+	if filter.RiderID != "" {
+		sets = append(sets, s.riderIndexKey(filter.RiderID))
+	}
+	if filter.StationID != "" {
+		sets = append(sets, s.stationIndexKey(filter.StationID))
+	}
+	if filter.Status != lastmilev1.RideStatus_RIDE_STATUS_UNSPECIFIED {
+		sets = append(sets, s.statusIndexKey(filter.Status))
+	}
+	var ids []string
+	var err error
+	switch len(sets) {
+	case 0:
+		ids, err = s.client.ZRange(ctx, s.indexKey(), 0, -1).Result()
+	case 1:
+		ids, err = s.client.SMembers(ctx, sets[0]).Result()
+	default:
+		ids, err = s.client.SInter(ctx, sets...).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	sort.Strings(ids)
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.requestKey(id)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]*lastmilev1.RideRequest, 0, len(values))
+	for _, value := range values {
+		data, ok := redisValueBytes(value)
+		if !ok {
+			continue
+		}
+		var request lastmilev1.RideRequest
+		if err := protojson.Unmarshal(data, &request); err != nil {
+			return nil, err
+		}
+		if filter.matches(&request) {
+			requests = append(requests, &request)
+		}
+	}
+	return requests, nil
+}
+
+func (s *RedisRideRequestStore) create(ctx context.Context, request *lastmilev1.RideRequest, messages []OutboxMessage) error {
+	if request == nil || request.RequestId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	payload, err := protojson.Marshal(request)
+	if err != nil {
+		return err
+	}
+	key := s.requestKey(request.RequestId)
+	keys := []string{key}
+	// A new request claims its quote so no other request can lock it.
+	quoteKey := ""
+	if request.QuoteId != "" {
+		quoteKey = s.quoteKey(request.QuoteId)
+		keys = append(keys, quoteKey)
+	}
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrAlreadyExists
+		}
+		if quoteKey != "" {
+			used, err := tx.Exists(ctx, quoteKey).Result()
+			if err != nil {
+				return err
+			}
+			if used > 0 {
+				return ErrQuoteUsed
+			}
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.set(ctx, pipe, request, payload, lastmilev1.RideStatus_RIDE_STATUS_UNSPECIFIED)
+			if quoteKey != "" {
+				pipe.Set(ctx, quoteKey, request.RequestId, 0)
+			}
+			return s.outbox.add(ctx, pipe, messages)
+		})
+		return err
+	}, keys...)
+}
+
+// set writes the request and its indexes; from is the status it is moving
+// out of, whose index no longer lists it.
+func (s *RedisRideRequestStore) set(ctx context.Context, pipe redis.Pipeliner, request *lastmilev1.RideRequest, payload []byte, from lastmilev1.RideStatus) {
+	pipe.Set(ctx, s.requestKey(request.RequestId), payload, 0)
+	pipe.ZAdd(ctx, s.indexKey(), redis.Z{Score: 0, Member: request.RequestId})
+	pipe.SAdd(ctx, s.riderIndexKey(request.RiderId), request.RequestId)
+	pipe.SAdd(ctx, s.stationIndexKey(request.StationId), request.RequestId)
+	if from != request.Status {
+		pipe.SRem(ctx, s.statusIndexKey(from), request.RequestId)
+	}
+	pipe.SAdd(ctx, s.statusIndexKey(request.Status), request.RequestId)
+}
+
+// EnsureIndexes adds requests written before the status index existed to it.
+func (s *RedisRideRequestStore) EnsureIndexes(ctx context.Context) error {
+	const batch = 500
+	for start := int64(0); ; start += batch {
+		ids, err := s.client.ZRange(ctx, s.indexKey(), start, start+batch-1).Result()
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = s.requestKey(id)
+		}
+		values, err := s.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+		pipe := s.client.Pipeline()
+		for _, value := range values {
+			data, ok := redisValueBytes(value)
+			if !ok {
+				continue
+			}
+			var request lastmilev1.RideRequest
+			if err := protojson.Unmarshal(data, &request); err != nil {
+				return err
+			}
+			pipe.SAdd(ctx, s.statusIndexKey(request.Status), request.RequestId)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *RedisRideRequestStore) requestKey(requestID string) string {
+	return fmt.Sprintf("%s:ride_request:%s", s.prefix, requestID)
+}
+
+func (s *RedisRideRequestStore) quoteKey(quoteID string) string {
+	return fmt.Sprintf("%s:ride_quote:%s", s.prefix, quoteID)
+}
+
+func (s *RedisRideRequestStore) indexKey() string {
+	return fmt.Sprintf("%s:ride_requests", s.prefix)
+}
+
+func (s *RedisRideRequestStore) riderIndexKey(riderID string) string {
+	return fmt.Sprintf("%s:ride_requests:rider:%s", s.prefix, riderID)
+}
+
+func (s *RedisRideRequestStore) stationIndexKey(stationID string) string {
+	return fmt.Sprintf("%s:ride_requests:station:%s", s.prefix, stationID)
+}
+
+func (s *RedisRideRequestStore) statusIndexKey(status lastmilev1.RideStatus) string {
+	return fmt.Sprintf("%s:ride_requests:status:%s", s.prefix, status)
+}
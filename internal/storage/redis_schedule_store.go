@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type RedisScheduleStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisScheduleStore(client *redis.Client, prefix string) *RedisScheduleStore {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	return &RedisScheduleStore{client: client, prefix: prefix}
+}
+
+func (s *RedisScheduleStore) PutSchedule(ctx context.Context, schedule *lastmilev1.StationSchedule) error {
+	if schedule == nil || schedule.StationId == "" {
+		return ErrInvalidArgument
+	}
+	payload, err := protojson.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.scheduleKey(schedule.StationId), payload, 0).Err()
+}
+
+func (s *RedisScheduleStore) GetSchedule(ctx context.Context, stationID string) (*lastmilev1.StationSchedule, error) {
+	if stationID == "" {
+		return nil, ErrInvalidArgument
+	}
+	data, err := s.client.Get(ctx, s.scheduleKey(stationID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var schedule lastmilev1.StationSchedule
+	if err := protojson.Unmarshal(data, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (s *RedisScheduleStore) scheduleKey(stationID string) string {
+	return fmt.Sprintf("%s:schedule:%s", s.prefix, stationID)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type RedisSeatStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisSeatStore(client *redis.Client, prefix string) *RedisSeatStore {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	return &RedisSeatStore{client: client, prefix: prefix}
+}
+
+func (s *RedisSeatStore) UpsertSeats(ctx context.Context, availability *lastmilev1.SeatAvailability) error {
+	if availability == nil || availability.DriverId == "" {
+		return ErrInvalidArgument
+	}
+	payload, err := protojson.Marshal(availability)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.seatKey(availability.DriverId), payload, 0)
+		pipe.SAdd(ctx, s.indexKey(), availability.DriverId)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisSeatStore) GetSeats(ctx context.Context, driverID string) (*lastmilev1.SeatAvailability, error) {
+	if driverID == "" {
+		return nil, ErrInvalidArgument
+	}
+	data, err := s.client.Get(ctx, s.seatKey(driverID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var availability lastmilev1.SeatAvailability
+	if err := protojson.Unmarshal(data, &availability); err != nil {
+		return nil, err
+	}
+	return &availability, nil
+}
+
+func (s *RedisSeatStore) ListSeats(ctx context.Context) ([]*lastmilev1.SeatAvailability, error) {
+	ids, err := s.client.SMembers(ctx, s.indexKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	sort.Strings(ids)
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.seatKey(id)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	seats := make([]*lastmilev1.SeatAvailability, 0, len(values))
+	for _, value := range values {
+		data, ok := redisValueBytes(value)
+		if !ok {
+			continue
+		}
+		var availability lastmilev1.SeatAvailability
+		if err := protojson.Unmarshal(data, &availability); err != nil {
+			return nil, err
+		}
+		seats = append(seats, &availability)
+	}
+	return seats, nil
+}
+
+func (s *RedisSeatStore) seatKey(driverID string) string {
+	return fmt.Sprintf("%s:seats:%s", s.prefix, driverID)
+}
+
+func (s *RedisSeatStore) indexKey() string {
+	return fmt.Sprintf("%s:seats", s.prefix)
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type RedisShiftStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisShiftStore(client *redis.Client, prefix string) *RedisShiftStore {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	return &RedisShiftStore{client: client, prefix: prefix}
+}
+
+func (s *RedisShiftStore) StartShift(ctx context.Context, shift *lastmilev1.DriverShift) error {
+	if shift == nil || shift.ShiftId == "" || shift.DriverId == "" || shift.StartedAt == nil {
+		return ErrInvalidArgument
+	}
+	payload, err := protojson.Marshal(shift)
+	if err != nil {
+		return err
+	}
+	openKey := s.openKey(shift.DriverId)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, openKey).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrAlreadyExists
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, s.shiftKey(shift.ShiftId), payload, 0)
+			pipe.Set(ctx, openKey, shift.ShiftId, 0)
+			pipe.SAdd(ctx, s.openIndexKey(), shift.DriverId)
+			pipe.ZAdd(ctx, s.historyKey(shift.DriverId), redis.Z{
+				Score:  float64(shift.StartedAt.AsTime().UnixMilli()),
+				Member: shift.ShiftId,
+			})
+			return nil
+		})
+		return err
+	}, openKey)
+}
+
+func (s *RedisShiftStore) EndShift(ctx context.Context, driverID string, endedAt time.Time, reason lastmilev1.ShiftEndReason) (*lastmilev1.DriverShift, error) {
+	if driverID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var ended *lastmilev1.DriverShift
+	openKey := s.openKey(driverID)
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		shift, err := s.open(ctx, tx, openKey)
+		if err != nil {
+			return err
+		}
+		endShift(shift, endedAt, reason)
+		payload, err := protojson.Marshal(shift)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, s.shiftKey(shift.ShiftId), payload, 0)
+			pipe.Del(ctx, openKey)
+			pipe.SRem(ctx, s.openIndexKey(), driverID)
+			return nil
+		})
+		ended = shift
+		return err
+	}, openKey)
+	if err != nil {
+		return nil, err
+	}
+	return ended, nil
+}
+
+func (s *RedisShiftStore) TouchShift(ctx context.Context, driverID string, pingAt time.Time) error {
+	if driverID == "" {
+		return ErrInvalidArgument
+	}
+	openKey := s.openKey(driverID)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		shift, err := s.open(ctx, tx, openKey)
+		if err != nil {
+			return err
+		}
+		touchShift(shift, pingAt)
+		payload, err := protojson.Marshal(shift)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, s.shiftKey(shift.ShiftId), payload, 0)
+			return nil
+		})
+		return err
+	}, openKey)
+}
+
+func (s *RedisShiftStore) GetOpenShift(ctx context.Context, driverID string) (*lastmilev1.DriverShift, error) {
+	if driverID == "" {
+		return nil, ErrInvalidArgument
+	}
+	return s.open(ctx, s.client, s.openKey(driverID))
+}
+
+func (s *RedisShiftStore) ListOpenShifts(ctx context.Context) ([]*lastmilev1.DriverShift, error) {
+	driverIDs, err := s.client.SMembers(ctx, s.openIndexKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	shifts := make([]*lastmilev1.DriverShift, 0, len(driverIDs))
+	for _, driverID := range driverIDs {
+		shift, err := s.open(ctx, s.client, s.openKey(driverID))
+		if err != nil {
+			if err == ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+		shifts = append(shifts, shift)
+	}
+	return shifts, nil
+}
+
+func (s *RedisShiftStore) ListShifts(ctx context.Context, filter ShiftFilter, after string, limit int) ([]*lastmilev1.DriverShift, string, error) {
+	if filter.DriverID == "" || limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	historyKey := s.historyKey(filter.DriverID)
+	upper := "+inf"
+	if !filter.StartedBefore.IsZero() {
+		upper = strconv.FormatInt(filter.StartedBefore.UnixMilli(), 10)
+	}
+	var ids []string
+	if after != "" {
+		cursor, err := parseShiftCursor(after)
+		if err != nil {
+			return nil, "", err
+		}
+		// Shifts started in the cursor's millisecond come after it by id.
+		score := strconv.FormatInt(cursor.startedAt, 10)
+		ties, err := s.client.ZRevRangeByScore(ctx, historyKey, &redis.ZRangeBy{Min: score, Max: score}).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		for _, id := range ties {
+			if id < cursor.shiftID {
+				ids = append(ids, id)
+			}
+		}
+		upper = "(" + score
+	}
+	// One extra shift tells whether there is a next page.
+	if missing := limit + 1 - len(ids); missing > 0 {
+		older, err := s.client.ZRevRangeByScore(ctx, historyKey, &redis.ZRangeBy{Min: "-inf", Max: upper, Count: int64(missing)}).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, older...)
+	}
+	if len(ids) == 0 {
+		return nil, "", nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.shiftKey(id)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	page := newKeysetPage[*lastmilev1.DriverShift](limit)
+	for _, value := range values {
+		data, ok := redisValueBytes(value)
+		if !ok {
+			continue
+		}
+		var shift lastmilev1.DriverShift
+		if err := protojson.Unmarshal(data, &shift); err != nil {
+			return nil, "", err
+		}
+		if !filter.StartedBefore.IsZero() && !shift.StartedAt.AsTime().Before(filter.StartedBefore) {
+			continue
+		}
+		if !page.add(newShiftCursor(&shift).String(), &shift) {
+			break
+		}
+	}
+	if page.next == "" && len(ids) > limit {
+		// Skipped shifts left the page short, but older ones remain.
+		page.next = page.lastKey
+	}
+	return page.items, page.next, nil
+}
+
+func (s *RedisShiftStore) open(ctx context.Context, client redis.Cmdable, openKey string) (*lastmilev1.DriverShift, error) {
+	shiftID, err := client.Get(ctx, openKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	data, err := client.Get(ctx, s.shiftKey(shiftID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var shift lastmilev1.DriverShift
+	if err := protojson.Unmarshal(data, &shift); err != nil {
+		return nil, err
+	}
+	return &shift, nil
+}
+
+func (s *RedisShiftStore) shiftKey(shiftID string) string {
+	return fmt.Sprintf("%s:shift:%s", s.prefix, shiftID)
+}
+
+func (s *RedisShiftStore) openKey(driverID string) string {
+	return fmt.Sprintf("%s:shift_open:%s", s.prefix, driverID)
+}
+
+func (s *RedisShiftStore) openIndexKey() string {
+	return fmt.Sprintf("%s:shifts_open", s.prefix)
+}
+
+func (s *RedisShiftStore) historyKey(driverID string) string {
+	return fmt.Sprintf("%s:driver_shifts:%s", s.prefix, driverID)
+}
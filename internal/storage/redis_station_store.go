@@ -3,6 +3,8 @@ package storage
 import (
 	"context"
 	"fmt"
+	"math"
+	"slices"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/redis/go-redis/v9"
@@ -33,12 +35,147 @@ func (s *RedisStationStore) Upsert(ctx context.Context, station *lastmilev1.Stat
 		return err
 	}
 	pipe := s.client.TxPipeline()
-	pipe.Set(ctx, s.stationKey(station.StationId), payload, 0)
-	pipe.ZAdd(ctx, s.indexKey(), redis.Z{Score: 0, Member: station.StationId})
+	s.write(ctx, pipe, station, payload)
 	_, err = pipe.Exec(ctx)
 	return err
 }
 
+func (s *RedisStationStore) Update(ctx context.Context, station *lastmilev1.Station) error {
+	if station == nil || station.StationId == "" {
+		return ErrInvalidArgument
+	}
+	payload, err := protojson.Marshal(station)
+	if err != nil {
+		return err
+	}
+	key := s.stationKey(station.StationId)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return ErrNotFound
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.write(ctx, pipe, station, payload)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+func (s *RedisStationStore) Delete(ctx context.Context, stationID string) error {
+	if stationID == "" {
+		return ErrInvalidArgument
+	}
+	key := s.stationKey(stationID)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return ErrNotFound
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.ZRem(ctx, s.indexKey(), stationID)
+			pipe.ZRem(ctx, s.geoKey(), stationID)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+func (s *RedisStationStore) write(ctx context.Context, pipe redis.Pipeliner, station *lastmilev1.Station, payload []byte) {
+	pipe.Set(ctx, s.stationKey(station.StationId), payload, 0)
+	pipe.ZAdd(ctx, s.indexKey(), redis.Z{Score: 0, Member: station.StationId})
+	if geoIndexable(station.Location) {
+		pipe.GeoAdd(ctx, s.geoKey(), &redis.GeoLocation{
+			Name:      station.StationId,
+			Longitude: station.Location.Longitude,
+			Latitude:  station.Location.Latitude,
+		})
+	} else {
+		pipe.ZRem(ctx, s.geoKey(), station.StationId)
+	}
+}
+
+// EnsureIndexes adds stations written before the GEO index existed to it.
+func (s *RedisStationStore) EnsureIndexes(ctx context.Context) error {
+	for after := ""; ; {
+		stations, next, err := s.List(ctx, after, 500)
+		if err != nil {
+			return err
+		}
+		locations := make([]*redis.GeoLocation, 0, len(stations))
+		for _, station := range stations {
+			if geoIndexable(station.Location) {
+				locations = append(locations, &redis.GeoLocation{
+					Name:      station.StationId,
+					Longitude: station.Location.Longitude,
+					Latitude:  station.Location.Latitude,
+				})
+			}
+		}
+		if len(locations) > 0 {
+			if err := s.client.GeoAdd(ctx, s.geoKey(), locations...).Err(); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		after = next
+	}
+}
+
+func (s *RedisStationStore) SearchNear(ctx context.Context, center *lastmilev1.LatLng, radiusMeters float64, limit int) ([]*lastmilev1.NearbyStation, error) {
+	if center == nil || radiusMeters <= 0 || limit <= 0 {
+		return nil, ErrInvalidArgument
+	}
+	matches, err := s.client.GeoSearchLocation(ctx, s.geoKey(), &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude:  center.Longitude,
+			Latitude:   center.Latitude,
+			Radius:     radiusMeters,
+			RadiusUnit: "m",
+			Sort:       "ASC",
+			Count:      limit,
+		},
+		WithDist: true,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(matches))
+	for i, match := range matches {
+		keys[i] = s.stationKey(match.Name)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*lastmilev1.NearbyStation, 0, len(matches))
+	for i, value := range values {
+		data, ok := redisValueBytes(value)
+		if !ok {
+			continue
+		}
+		var station lastmilev1.Station
+		if err := protojson.Unmarshal(data, &station); err != nil {
+			return nil, err
+		}
+		results = append(results, &lastmilev1.NearbyStation{Station: &station, DistanceMeters: matches[i].Dist})
+	}
+	return results, nil
+}
+
 func (s *RedisStationStore) Get(ctx context.Context, stationID string) (*lastmilev1.Station, error) {
 	if stationID == "" {
 		return nil, ErrInvalidArgument
@@ -57,62 +194,44 @@ func (s *RedisStationStore) Get(ctx context.Context, stationID string) (*lastmil
 	return &station, nil
 }
 
-func (s *RedisStationStore) List(ctx context.Context, offset, limit int) ([]*lastmilev1.Station, int, error) {
-	if offset < 0 || limit <= 0 {
-		return nil, 0, ErrInvalidArgument
-	}
-	total, err := s.client.ZCard(ctx, s.indexKey()).Result()
-	if err != nil {
-		return nil, 0, err
+func (s *RedisStationStore) List(ctx context.Context, after string, limit int) ([]*lastmilev1.Station, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
 	}
-	if offset >= int(total) {
-		return nil, -1, nil
-	}
-
-	stop := int64(offset + limit - 1)
-	ids, err := s.client.ZRange(ctx, s.indexKey(), int64(offset), stop).Result()
+	page := newKeysetPage[*lastmilev1.Station](limit)
+	err := scanLex(ctx, s.client, s.indexKey(), s.stationKey, after, limit+1, func(id string, data []byte) (bool, error) {
+		var station lastmilev1.Station
+		if err := protojson.Unmarshal(data, &station); err != nil {
+			return false, err
+		}
+		return page.add(id, &station), nil
+	})
 	if err != nil {
-		return nil, 0, err
-	}
-	if len(ids) == 0 {
-		return nil, -1, nil
+		return nil, "", err
 	}
+	return page.items, page.next, nil
+}
 
-	keys := make([]string, len(ids))
-	for i, id := range ids {
-		keys[i] = s.stationKey(id)
-	}
-	values, err := s.client.MGet(ctx, keys...).Result()
-	if err != nil {
-		return nil, 0, err
+// ListByArea scans every station; area membership is not indexed in Redis.
+func (s *RedisStationStore) ListByArea(ctx context.Context, areaID string) ([]*lastmilev1.Station, error) {
+	if areaID == "" {
+		return nil, ErrInvalidArgument
 	}
-
-	stations := make([]*lastmilev1.Station, 0, len(values))
-	for _, value := range values {
-		if value == nil {
-			continue
-		}
-		var data []byte
-		switch v := value.(type) {
-		case string:
-			data = []byte(v)
-		case []byte:
-			data = v
-		default:
-			continue
-		}
+	var stations []*lastmilev1.Station
+	err := scanLex(ctx, s.client, s.indexKey(), s.stationKey, "", fullScanBatch, func(_ string, data []byte) (bool, error) {
 		var station lastmilev1.Station
 		if err := protojson.Unmarshal(data, &station); err != nil {
-			return nil, 0, err
+			return false, err
 		}
-		stations = append(stations, &station)
-	}
-
-	next := -1
-	if offset+len(ids) < int(total) {
-		next = offset + len(ids)
+		if slices.Contains(station.NearbyAreaIds, areaID) {
+			stations = append(stations, &station)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return stations, next, nil
+	return stations, nil
 }
 
 func (s *RedisStationStore) stationKey(stationID string) string {
@@ -122,3 +241,13 @@ func (s *RedisStationStore) stationKey(stationID string) string {
 func (s *RedisStationStore) indexKey() string {
 	return fmt.Sprintf("%s:stations", s.prefix)
 }
+
+func (s *RedisStationStore) geoKey() string {
+	return fmt.Sprintf("%s:stations:geo", s.prefix)
+}
+
+// geoIndexable reports whether Redis GEO can hold the point; it rejects
+// latitudes beyond the Web Mercator limit.
+func geoIndexable(latlng *lastmilev1.LatLng) bool {
+	return latlng != nil && math.Abs(latlng.Latitude) <= 85.05112878
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type RedisSurgeStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisSurgeStore(client *redis.Client, prefix string) *RedisSurgeStore {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	return &RedisSurgeStore{client: client, prefix: prefix}
+}
+
+func (s *RedisSurgeStore) Get(ctx context.Context, stationID string) (*lastmilev1.StationSurge, error) {
+	if stationID == "" {
+		return nil, ErrInvalidArgument
+	}
+	data, err := s.client.Get(ctx, s.surgeKey(stationID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var surge lastmilev1.StationSurge
+	if err := protojson.Unmarshal(data, &surge); err != nil {
+		return nil, err
+	}
+	return &surge, nil
+}
+
+func (s *RedisSurgeStore) Set(ctx context.Context, surge *lastmilev1.StationSurge, change *lastmilev1.SurgeChange) error {
+	if !validSurge(surge, change) {
+		return ErrInvalidArgument
+	}
+	payload, err := protojson.Marshal(surge)
+	if err != nil {
+		return err
+	}
+	var changePayload []byte
+	if change != nil {
+		if changePayload, err = protojson.Marshal(change); err != nil {
+			return err
+		}
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.surgeKey(surge.StationId), payload, 0)
+		if change != nil {
+			pipe.Set(ctx, s.changeKey(change.ChangeId), changePayload, 0)
+			pipe.ZAdd(ctx, s.changeIndexKey(change.StationId), redis.Z{Score: 0, Member: change.ChangeId})
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisSurgeStore) ListChanges(ctx context.Context, stationID, after string, limit int) ([]*lastmilev1.SurgeChange, string, error) {
+	if stationID == "" || limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	page := newKeysetPage[*lastmilev1.SurgeChange](limit)
+	err := scanLex(ctx, s.client, s.changeIndexKey(stationID), s.changeKey, after, limit+1, func(id string, data []byte) (bool, error) {
+		var change lastmilev1.SurgeChange
+		if err := protojson.Unmarshal(data, &change); err != nil {
+			return false, err
+		}
+		return page.add(id, &change), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return page.items, page.next, nil
+}
+
+func (s *RedisSurgeStore) surgeKey(stationID string) string {
+	return fmt.Sprintf("%s:surge:%s", s.prefix, stationID)
+}
+
+func (s *RedisSurgeStore) changeKey(changeID string) string {
+	return fmt.Sprintf("%s:surge_change:%s", s.prefix, changeID)
+}
+
+func (s *RedisSurgeStore) changeIndexKey(stationID string) string {
+	return fmt.Sprintf("%s:surge_changes:%s", s.prefix, stationID)
+}
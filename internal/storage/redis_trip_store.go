@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type RedisTripStore struct {
+	client *redis.Client
+	prefix string
+	outbox *RedisOutbox
+}
+
+func NewRedisTripStore(client *redis.Client, prefix string, outbox *RedisOutbox) *RedisTripStore {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	if outbox == nil {
+		outbox = NewRedisOutbox(client, prefix, "")
+	}
+	return &RedisTripStore{client: client, prefix: prefix, outbox: outbox}
+}
+
+func (s *RedisTripStore) CreateTrip(ctx context.Context, trip *lastmilev1.Trip, messages ...OutboxMessage) error {
+	return s.write(ctx, trip, false, messages)
+}
+
+func (s *RedisTripStore) GetTrip(ctx context.Context, tripID string) (*lastmilev1.Trip, error) {
+	if tripID == "" {
+		return nil, ErrInvalidArgument
+	}
+	data, err := s.client.Get(ctx, s.tripKey(tripID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var trip lastmilev1.Trip
+	if err := protojson.Unmarshal(data, &trip); err != nil {
+		return nil, err
+	}
+	return &trip, nil
+}
+
+func (s *RedisTripStore) UpdateTrip(ctx context.Context, trip *lastmilev1.Trip, messages ...OutboxMessage) error {
+	return s.write(ctx, trip, true, messages)
+}
+
+func (s *RedisTripStore) ListTrips(ctx context.Context, filter TripFilter) ([]*lastmilev1.Trip, error) {
+	var ids []string
+	var err error
+	switch {
+	case filter.DriverID != "":
+		ids, err = s.client.SMembers(ctx, s.driverIndexKey(filter.DriverID)).Result()
+	case filter.StationID != "":
+		ids, err = s.client.SMembers(ctx, s.stationIndexKey(filter.StationID)).Result()
+	default:
+		ids, err = s.client.ZRange(ctx, s.indexKey(), 0, -1).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	sort.Strings(ids)
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.tripKey(id)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	trips := make([]*lastmilev1.Trip, 0, len(values))
+	for _, value := range values {
+		data, ok := redisValueBytes(value)
+		if !ok {
+			continue
+		}
+		var trip lastmilev1.Trip
+		if err := protojson.Unmarshal(data, &trip); err != nil {
+			return nil, err
+		}
+		if filter.matches(&trip) {
+			trips = append(trips, &trip)
+		}
+	}
+	return trips, nil
+}
+
+func (s *RedisTripStore) SetDropoffPlan(ctx context.Context, tripID string, plan *lastmilev1.DropoffPlan) error {
+	return s.modify(ctx, tripID, func(trip *lastmilev1.Trip) error {
+		if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED {
+			return ErrNotFound
+		}
+		trip.DropoffPlan = plan
+		return nil
+	})
+}
+
+func (s *RedisTripStore) RateTrip(ctx context.Context, tripID string, byRider bool, rating *lastmilev1.TripRating, messages ...OutboxMessage) error {
+	if rating == nil {
+		return ErrInvalidArgument
+	}
+	return s.modify(ctx, tripID, func(trip *lastmilev1.Trip) error {
+		if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_COMPLETED {
+			return ErrNotFound
+		}
+		return setTripRating(trip, byRider, rating)
+	}, messages...)
+}
+
+// modify applies change to the stored trip together with messages. The
+// write fails if the trip changes concurrently; change returning an error
+// aborts it.
+func (s *RedisTripStore) modify(ctx context.Context, tripID string, change func(trip *lastmilev1.Trip) error, messages ...OutboxMessage) error {
+	if tripID == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	key := s.tripKey(tripID)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				return ErrNotFound
+			}
+			return err
+		}
+		var trip lastmilev1.Trip
+		if err := protojson.Unmarshal(data, &trip); err != nil {
+			return err
+		}
+		if err := change(&trip); err != nil {
+			return err
+		}
+		payload, err := protojson.Marshal(&trip)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, payload, 0)
+			return s.outbox.add(ctx, pipe, messages)
+		})
+		return err
+	}, key)
+}
+
+func (s *RedisTripStore) write(ctx context.Context, trip *lastmilev1.Trip, update bool, messages []OutboxMessage) error {
+	if trip == nil || trip.TripId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	payload, err := protojson.Marshal(trip)
+	if err != nil {
+		return err
+	}
+	key := s.tripKey(trip.TripId)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if update && exists == 0 {
+			return ErrNotFound
+		}
+		if !update && exists > 0 {
+			return ErrAlreadyExists
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.set(ctx, pipe, trip, payload)
+			return s.outbox.add(ctx, pipe, messages)
+		})
+		return err
+	}, key)
+}
+
+func (s *RedisTripStore) set(ctx context.Context, pipe redis.Pipeliner, trip *lastmilev1.Trip, payload []byte) {
+	pipe.Set(ctx, s.tripKey(trip.TripId), payload, 0)
+	pipe.ZAdd(ctx, s.indexKey(), redis.Z{Score: 0, Member: trip.TripId})
+	pipe.SAdd(ctx, s.driverIndexKey(trip.DriverId), trip.TripId)
+	pipe.SAdd(ctx, s.stationIndexKey(trip.StationId), trip.TripId)
+}
+
+func (s *RedisTripStore) tripKey(tripID string) string {
+	return fmt.Sprintf("%s:trip:%s", s.prefix, tripID)
+}
+
+func (s *RedisTripStore) indexKey() string {
+	return fmt.Sprintf("%s:trips", s.prefix)
+}
+
+func (s *RedisTripStore) driverIndexKey(driverID string) string {
+	return fmt.Sprintf("%s:trips:driver:%s", s.prefix, driverID)
+}
+
+func (s *RedisTripStore) stationIndexKey(stationID string) string {
+	return fmt.Sprintf("%s:trips:station:%s", s.prefix, stationID)
+}
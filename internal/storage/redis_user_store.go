@@ -3,12 +3,26 @@ package storage
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
 	"github.com/redis/go-redis/v9"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+type userProfile interface {
+	proto.Message
+	GetPhone() string
+	GetDeletedAt() *timestamppb.Timestamp
+}
+
+// userScanBatch is how many profiles a filtered scan loads per round trip.
+const userScanBatch = 200
+
 type RedisUserStore struct {
 	client *redis.Client
 	prefix string
@@ -28,74 +42,437 @@ func (s *RedisUserStore) CreateRider(ctx context.Context, profile *lastmilev1.Ri
 	if profile == nil || profile.RiderId == "" {
 		return ErrInvalidArgument
 	}
-	key := s.riderKey(profile.RiderId)
-	payload, err := protojson.Marshal(profile)
-	if err != nil {
-		return err
+	return s.create(ctx, s.riderKey(profile.RiderId), s.riderIndexKey(), profile.RiderId, riderOwner(profile.RiderId), profile)
+}
+
+func (s *RedisUserStore) GetRider(ctx context.Context, riderID string) (*lastmilev1.RiderProfile, error) {
+	if riderID == "" {
+		return nil, ErrInvalidArgument
 	}
-	ok, err := s.client.SetNX(ctx, key, payload, 0).Result()
+	var profile lastmilev1.RiderProfile
+	if err := s.get(ctx, s.riderKey(riderID), &profile); err != nil {
+		return nil, err
+	}
+	if profile.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return &profile, nil
+}
+
+func (s *RedisUserStore) GetRiderByPhone(ctx context.Context, phone string) (*lastmilev1.RiderProfile, error) {
+	riderID, err := s.getByPhone(ctx, phone, riderOwnerPrefix)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if !ok {
-		return ErrAlreadyExists
+	return s.GetRider(ctx, riderID)
+}
+
+func (s *RedisUserStore) UpdateRider(ctx context.Context, profile *lastmilev1.RiderProfile) error {
+	if profile == nil || profile.RiderId == "" {
+		return ErrInvalidArgument
 	}
-	return nil
+	updated := cloneRiderProfile(profile)
+	updated.DeletedAt = nil
+	return s.modify(ctx, s.riderKey(profile.RiderId), "", riderOwner(profile.RiderId), &lastmilev1.RiderProfile{}, func(current userProfile) (userProfile, error) {
+		if current.GetDeletedAt() != nil {
+			return nil, ErrNotFound
+		}
+		keepRiderCounters(updated, current.(*lastmilev1.RiderProfile))
+		return updated, nil
+	})
 }
 
-func (s *RedisUserStore) GetRider(ctx context.Context, riderID string) (*lastmilev1.RiderProfile, error) {
+func (s *RedisUserStore) AddRiderRating(ctx context.Context, riderID string, stars int32) error {
+	return s.changeRider(ctx, riderID, "", func(profile *lastmilev1.RiderProfile) {
+		addRating(&profile.RatingAverage, &profile.RatingCount, stars)
+	})
+}
+
+func (s *RedisUserStore) AddRiderNoShow(ctx context.Context, riderID, requestID string) error {
+	if requestID == "" {
+		return ErrInvalidArgument
+	}
+	return s.changeRider(ctx, riderID, s.countedKey("no_show", requestID), func(profile *lastmilev1.RiderProfile) {
+		profile.NoShowCount++
+	})
+}
+
+func (s *RedisUserStore) changeRider(ctx context.Context, riderID, once string, change func(*lastmilev1.RiderProfile)) error {
 	if riderID == "" {
+		return ErrInvalidArgument
+	}
+	return s.modify(ctx, s.riderKey(riderID), once, riderOwner(riderID), &lastmilev1.RiderProfile{}, func(current userProfile) (userProfile, error) {
+		profile := current.(*lastmilev1.RiderProfile)
+		if profile.DeletedAt != nil {
+			return nil, ErrNotFound
+		}
+		change(profile)
+		return profile, nil
+	})
+}
+
+func (s *RedisUserStore) DeleteRider(ctx context.Context, riderID string, deletedAt time.Time) error {
+	if riderID == "" {
+		return ErrInvalidArgument
+	}
+	return s.modify(ctx, s.riderKey(riderID), "", riderOwner(riderID), &lastmilev1.RiderProfile{}, func(current userProfile) (userProfile, error) {
+		profile := current.(*lastmilev1.RiderProfile)
+		if profile.DeletedAt != nil {
+			return nil, ErrNotFound
+		}
+		profile.DeletedAt = timestamppb.New(deletedAt)
+		return profile, nil
+	})
+}
+
+func (s *RedisUserStore) ListRiders(ctx context.Context, filter UserFilter, after string, limit int) ([]*lastmilev1.RiderProfile, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	page := newKeysetPage[*lastmilev1.RiderProfile](limit)
+	err := scanLex(ctx, s.client, s.riderIndexKey(), s.riderKey, after, userScanBatch, func(id string, data []byte) (bool, error) {
+		var profile lastmilev1.RiderProfile
+		if err := protojson.Unmarshal(data, &profile); err != nil {
+			return false, err
+		}
+		if profile.DeletedAt != nil || !matchesUserQuery(filter.Query, profile.Name, profile.Phone) {
+			return true, nil
+		}
+		return page.add(id, &profile), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return page.items, page.next, nil
+}
+
+func (s *RedisUserStore) CreateDriver(ctx context.Context, profile *lastmilev1.DriverProfile) error {
+	if profile == nil || profile.DriverId == "" {
+		return ErrInvalidArgument
+	}
+	return s.create(ctx, s.driverKey(profile.DriverId), s.driverIndexKey(), profile.DriverId, driverOwner(profile.DriverId), profile)
+}
+
+func (s *RedisUserStore) GetDriver(ctx context.Context, driverID string) (*lastmilev1.DriverProfile, error) {
+	if driverID == "" {
+		return nil, ErrInvalidArgument
+	}
+	var profile lastmilev1.DriverProfile
+	if err := s.get(ctx, s.driverKey(driverID), &profile); err != nil {
+		return nil, err
+	}
+	if profile.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return &profile, nil
+}
+
+func (s *RedisUserStore) GetDriverByPhone(ctx context.Context, phone string) (*lastmilev1.DriverProfile, error) {
+	driverID, err := s.getByPhone(ctx, phone, driverOwnerPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetDriver(ctx, driverID)
+}
+
+func (s *RedisUserStore) GetDriverByVehicle(ctx context.Context, vehicleID string) (*lastmilev1.DriverProfile, error) {
+	if vehicleID == "" {
 		return nil, ErrInvalidArgument
 	}
-	data, err := s.client.Get(ctx, s.riderKey(riderID)).Bytes()
+	owner, err := s.client.Get(ctx, s.vehicleClaimKey(vehicleID)).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	var profile lastmilev1.RiderProfile
-	if err := protojson.Unmarshal(data, &profile); err != nil {
-		return nil, err
+	driverID, ok := strings.CutPrefix(owner, driverOwnerPrefix)
+	if !ok {
+		return nil, ErrNotFound
 	}
-	return &profile, nil
+	return s.GetDriver(ctx, driverID)
 }
 
-func (s *RedisUserStore) CreateDriver(ctx context.Context, profile *lastmilev1.DriverProfile) error {
+func (s *RedisUserStore) UpdateDriver(ctx context.Context, profile *lastmilev1.DriverProfile) error {
 	if profile == nil || profile.DriverId == "" {
 		return ErrInvalidArgument
 	}
-	key := s.driverKey(profile.DriverId)
+	return s.modify(ctx, s.driverKey(profile.DriverId), "", driverOwner(profile.DriverId), &lastmilev1.DriverProfile{}, func(current userProfile) (userProfile, error) {
+		if current.GetDeletedAt() != nil {
+			return nil, ErrNotFound
+		}
+		return editDriver(current.(*lastmilev1.DriverProfile), profile), nil
+	})
+}
+
+func (s *RedisUserStore) UpdateDriverVerification(ctx context.Context, profile *lastmilev1.DriverProfile, from lastmilev1.DriverStatus) error {
+	if profile == nil || profile.DriverId == "" {
+		return ErrInvalidArgument
+	}
+	return s.modify(ctx, s.driverKey(profile.DriverId), "", driverOwner(profile.DriverId), &lastmilev1.DriverProfile{}, func(current userProfile) (userProfile, error) {
+		driver := current.(*lastmilev1.DriverProfile)
+		if driver.DeletedAt != nil {
+			return nil, ErrNotFound
+		}
+		if driver.Status != from {
+			return nil, ErrStatusChanged
+		}
+		return verifyDriver(driver, profile), nil
+	})
+}
+
+func (s *RedisUserStore) AddDriverRating(ctx context.Context, driverID string, stars int32) error {
+	return s.changeDriver(ctx, driverID, "", func(profile *lastmilev1.DriverProfile) {
+		addRating(&profile.RatingAverage, &profile.RatingCount, stars)
+	})
+}
+
+func (s *RedisUserStore) AddDriverCancellation(ctx context.Context, driverID, tripID string, penalty float64) error {
+	if tripID == "" {
+		return ErrInvalidArgument
+	}
+	return s.changeDriver(ctx, driverID, s.countedKey("driver_cancellation", tripID), func(profile *lastmilev1.DriverProfile) {
+		addCancellation(profile, penalty)
+	})
+}
+
+func (s *RedisUserStore) changeDriver(ctx context.Context, driverID, once string, change func(*lastmilev1.DriverProfile)) error {
+	if driverID == "" {
+		return ErrInvalidArgument
+	}
+	return s.modify(ctx, s.driverKey(driverID), once, driverOwner(driverID), &lastmilev1.DriverProfile{}, func(current userProfile) (userProfile, error) {
+		profile := current.(*lastmilev1.DriverProfile)
+		if profile.DeletedAt != nil {
+			return nil, ErrNotFound
+		}
+		change(profile)
+		return profile, nil
+	})
+}
+
+func (s *RedisUserStore) DeleteDriver(ctx context.Context, driverID string, deletedAt time.Time) error {
+	if driverID == "" {
+		return ErrInvalidArgument
+	}
+	return s.modify(ctx, s.driverKey(driverID), "", driverOwner(driverID), &lastmilev1.DriverProfile{}, func(current userProfile) (userProfile, error) {
+		profile := current.(*lastmilev1.DriverProfile)
+		if profile.DeletedAt != nil {
+			return nil, ErrNotFound
+		}
+		profile.DeletedAt = timestamppb.New(deletedAt)
+		return profile, nil
+	})
+}
+
+func (s *RedisUserStore) ListDrivers(ctx context.Context, filter UserFilter, after string, limit int) ([]*lastmilev1.DriverProfile, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	page := newKeysetPage[*lastmilev1.DriverProfile](limit)
+	err := scanLex(ctx, s.client, s.driverIndexKey(), s.driverKey, after, userScanBatch, func(id string, data []byte) (bool, error) {
+		var profile lastmilev1.DriverProfile
+		if err := protojson.Unmarshal(data, &profile); err != nil {
+			return false, err
+		}
+		if profile.DeletedAt != nil || !matchesUserQuery(filter.Query, profile.Name, profile.Phone) {
+			return true, nil
+		}
+		return page.add(id, &profile), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return page.items, page.next, nil
+}
+
+func (s *RedisUserStore) create(ctx context.Context, key, indexKey, id, owner string, profile userProfile) error {
 	payload, err := protojson.Marshal(profile)
 	if err != nil {
 		return err
 	}
-	ok, err := s.client.SetNX(ctx, key, payload, 0).Result()
+	claims := s.claims(profile)
+	watched := []string{key}
+	for _, claim := range claims {
+		watched = append(watched, claim.key)
+	}
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrAlreadyExists
+		}
+		for _, claim := range claims {
+			if err := checkClaimOwner(ctx, tx, claim, owner); err != nil {
+				return err
+			}
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, payload, 0)
+			pipe.ZAdd(ctx, indexKey, redis.Z{Score: 0, Member: id})
+			for _, claim := range claims {
+				pipe.Set(ctx, claim.key, owner, 0)
+			}
+			return nil
+		})
+		return err
+	}, watched...)
+}
+
+func (s *RedisUserStore) get(ctx context.Context, key string, profile proto.Message) error {
+	data, err := s.client.Get(ctx, key).Bytes()
 	if err != nil {
+		if err == redis.Nil {
+			return ErrNotFound
+		}
 		return err
 	}
-	if !ok {
-		return ErrAlreadyExists
+	return protojson.Unmarshal(data, profile)
+}
+
+// modify applies a change to a stored profile. A non-empty once key makes it
+// apply at most once: the key is set with the change and, once set, later
+// calls with it do nothing.
+func (s *RedisUserStore) modify(ctx context.Context, key, once, owner string, current userProfile, apply func(userProfile) (userProfile, error)) error {
+	watched := []string{key}
+	if once != "" {
+		watched = append(watched, once)
 	}
-	return nil
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		if once != "" {
+			done, err := tx.Exists(ctx, once).Result()
+			if err != nil || done > 0 {
+				return err
+			}
+		}
+		data, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				return ErrNotFound
+			}
+			return err
+		}
+		if err := protojson.Unmarshal(data, current); err != nil {
+			return err
+		}
+		held := s.claims(current)
+		updated, err := apply(current)
+		if err != nil {
+			return err
+		}
+		claims := s.claims(updated)
+		for _, claim := range claims {
+			if slices.Contains(held, claim) {
+				continue
+			}
+			if err := tx.Watch(ctx, claim.key).Err(); err != nil {
+				return err
+			}
+			if err := checkClaimOwner(ctx, tx, claim, owner); err != nil {
+				return err
+			}
+		}
+		payload, err := protojson.Marshal(updated)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, payload, 0)
+			for _, claim := range held {
+				if !slices.Contains(claims, claim) {
+					pipe.Del(ctx, claim.key)
+				}
+			}
+			for _, claim := range claims {
+				pipe.Set(ctx, claim.key, owner, 0)
+			}
+			if once != "" {
+				pipe.Set(ctx, once, 1, 0)
+			}
+			return nil
+		})
+		return err
+	}, watched...)
 }
 
-func (s *RedisUserStore) GetDriver(ctx context.Context, driverID string) (*lastmilev1.DriverProfile, error) {
-	if driverID == "" {
-		return nil, ErrInvalidArgument
+func (s *RedisUserStore) getByPhone(ctx context.Context, phone, ownerPrefix string) (string, error) {
+	if phone == "" {
+		return "", ErrInvalidArgument
 	}
-	data, err := s.client.Get(ctx, s.driverKey(driverID)).Bytes()
+	owner, err := s.client.Get(ctx, s.phoneKey(phone)).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, ErrNotFound
+			return "", ErrNotFound
 		}
-		return nil, err
+		return "", err
 	}
-	var profile lastmilev1.DriverProfile
-	if err := protojson.Unmarshal(data, &profile); err != nil {
-		return nil, err
+	id, ok := strings.CutPrefix(owner, ownerPrefix)
+	if !ok {
+		return "", ErrNotFound
 	}
-	return &profile, nil
+	return id, nil
+}
+
+// userClaim is a key a profile owns exclusively: its phone number and, for
+// drivers, the vehicle it holds. inUse is returned when another profile owns
+// the key.
+type userClaim struct {
+	key   string
+	inUse error
+}
+
+func (s *RedisUserStore) claims(profile userProfile) []userClaim {
+	if profile.GetDeletedAt() != nil {
+		return nil
+	}
+	var claims []userClaim
+	if phone := profile.GetPhone(); phone != "" {
+		claims = append(claims, userClaim{key: s.phoneKey(phone), inUse: ErrPhoneInUse})
+	}
+	if driver, ok := profile.(*lastmilev1.DriverProfile); ok {
+		if vehicleID := heldVehicle(driver); vehicleID != "" {
+			claims = append(claims, userClaim{key: s.vehicleClaimKey(vehicleID), inUse: ErrVehicleInUse})
+		}
+	}
+	return claims
+}
+
+func checkClaimOwner(ctx context.Context, tx *redis.Tx, claim userClaim, owner string) error {
+	current, err := tx.Get(ctx, claim.key).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current != owner {
+		return claim.inUse
+	}
+	return nil
+}
+
+// EnsureIndexes claims the vehicles of drivers written before vehicle claims
+// existed. A vehicle already claimed keeps its driver.
+func (s *RedisUserStore) EnsureIndexes(ctx context.Context) error {
+	return scanLex(ctx, s.client, s.driverIndexKey(), s.driverKey, "", userScanBatch, func(id string, data []byte) (bool, error) {
+		var profile lastmilev1.DriverProfile
+		if err := protojson.Unmarshal(data, &profile); err != nil {
+			return false, err
+		}
+		if vehicleID := heldVehicle(&profile); vehicleID != "" {
+			if err := s.client.SetNX(ctx, s.vehicleClaimKey(vehicleID), driverOwner(id), 0).Err(); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// countedKey marks a counter change keyed by the trip or request it came
+// from as applied.
+func (s *RedisUserStore) countedKey(kind, id string) string {
+	return fmt.Sprintf("%s:user_counted:%s:%s", s.prefix, kind, id)
 }
 
 func (s *RedisUserStore) riderKey(riderID string) string {
@@ -105,3 +482,22 @@ func (s *RedisUserStore) riderKey(riderID string) string {
 func (s *RedisUserStore) driverKey(driverID string) string {
 	return fmt.Sprintf("%s:driver:%s", s.prefix, driverID)
 }
+
+func (s *RedisUserStore) phoneKey(phone string) string {
+	if phone == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:phone:%s", s.prefix, phone)
+}
+
+func (s *RedisUserStore) vehicleClaimKey(vehicleID string) string {
+	return fmt.Sprintf("%s:vehicle_driver:%s", s.prefix, vehicleID)
+}
+
+func (s *RedisUserStore) riderIndexKey() string {
+	return fmt.Sprintf("%s:riders", s.prefix)
+}
+
+func (s *RedisUserStore) driverIndexKey() string {
+	return fmt.Sprintf("%s:drivers", s.prefix)
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type RedisVehicleStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisVehicleStore(client *redis.Client, prefix string) *RedisVehicleStore {
+	if client == nil {
+		return nil
+	}
+	if prefix == "" {
+		prefix = "lastmile"
+	}
+	return &RedisVehicleStore{client: client, prefix: prefix}
+}
+
+func (s *RedisVehicleStore) CreateVehicle(ctx context.Context, vehicle *lastmilev1.Vehicle) error {
+	if vehicle == nil || vehicle.VehicleId == "" || vehicle.Plate == "" {
+		return ErrInvalidArgument
+	}
+	payload, err := protojson.Marshal(vehicle)
+	if err != nil {
+		return err
+	}
+	key := s.vehicleKey(vehicle.VehicleId)
+	plateKey := s.plateKey(vehicle.Plate)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrAlreadyExists
+		}
+		if err := s.checkPlateOwner(ctx, tx, plateKey, vehicle.VehicleId); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, payload, 0)
+			pipe.Set(ctx, plateKey, vehicle.VehicleId, 0)
+			pipe.ZAdd(ctx, s.indexKey(), redis.Z{Score: 0, Member: vehicle.VehicleId})
+			return nil
+		})
+		return err
+	}, key, plateKey)
+}
+
+func (s *RedisVehicleStore) GetVehicle(ctx context.Context, vehicleID string) (*lastmilev1.Vehicle, error) {
+	if vehicleID == "" {
+		return nil, ErrInvalidArgument
+	}
+	return s.get(ctx, s.client, s.vehicleKey(vehicleID))
+}
+
+func (s *RedisVehicleStore) UpdateVehicle(ctx context.Context, vehicle *lastmilev1.Vehicle) error {
+	if vehicle == nil || vehicle.VehicleId == "" || vehicle.Plate == "" {
+		return ErrInvalidArgument
+	}
+	payload, err := protojson.Marshal(vehicle)
+	if err != nil {
+		return err
+	}
+	key := s.vehicleKey(vehicle.VehicleId)
+	plateKey := s.plateKey(vehicle.Plate)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		existing, err := s.get(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if err := s.checkPlateOwner(ctx, tx, plateKey, vehicle.VehicleId); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, payload, 0)
+			if existing.Plate != vehicle.Plate {
+				pipe.Del(ctx, s.plateKey(existing.Plate))
+			}
+			pipe.Set(ctx, plateKey, vehicle.VehicleId, 0)
+			return nil
+		})
+		return err
+	}, key, plateKey)
+}
+
+func (s *RedisVehicleStore) DeleteVehicle(ctx context.Context, vehicleID string) error {
+	if vehicleID == "" {
+		return ErrInvalidArgument
+	}
+	key := s.vehicleKey(vehicleID)
+	return s.client.Watch(ctx, func(tx *redis.Tx) error {
+		existing, err := s.get(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key, s.plateKey(existing.Plate))
+			pipe.ZRem(ctx, s.indexKey(), vehicleID)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+func (s *RedisVehicleStore) ListVehicles(ctx context.Context, after string, limit int) ([]*lastmilev1.Vehicle, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	page := newKeysetPage[*lastmilev1.Vehicle](limit)
+	err := scanLex(ctx, s.client, s.indexKey(), s.vehicleKey, after, limit+1, func(id string, data []byte) (bool, error) {
+		var vehicle lastmilev1.Vehicle
+		if err := protojson.Unmarshal(data, &vehicle); err != nil {
+			return false, err
+		}
+		return page.add(id, &vehicle), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return page.items, page.next, nil
+}
+
+func (s *RedisVehicleStore) get(ctx context.Context, client redis.Cmdable, key string) (*lastmilev1.Vehicle, error) {
+	data, err := client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var vehicle lastmilev1.Vehicle
+	if err := protojson.Unmarshal(data, &vehicle); err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+func (s *RedisVehicleStore) checkPlateOwner(ctx context.Context, tx *redis.Tx, plateKey, vehicleID string) error {
+	current, err := tx.Get(ctx, plateKey).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current != vehicleID {
+		return ErrPlateInUse
+	}
+	return nil
+}
+
+func (s *RedisVehicleStore) vehicleKey(vehicleID string) string {
+	return fmt.Sprintf("%s:vehicle:%s", s.prefix, vehicleID)
+}
+
+func (s *RedisVehicleStore) plateKey(plate string) string {
+	return fmt.Sprintf("%s:plate:%s", s.prefix, plate)
+}
+
+func (s *RedisVehicleStore) indexKey() string {
+	return fmt.Sprintf("%s:vehicles", s.prefix)
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type RideRequestFilter struct {
+	StationID string
+	RiderID   string
+	Status    lastmilev1.RideStatus
+	// TrainTripID selects requests linked to a GTFS trip.
+	TrainTripID string
+}
+
+type RideRequestStore interface {
+	CreateRideRequest(ctx context.Context, request *lastmilev1.RideRequest, messages ...OutboxMessage) error
+	GetRideRequest(ctx context.Context, requestID string) (*lastmilev1.RideRequest, error)
+	// UpdateRideRequest replaces a request that is still in status from, so
+	// a write based on a stale read cannot undo another one. It returns
+	// ErrStatusChanged if the stored request has moved on.
+	UpdateRideRequest(ctx context.Context, request *lastmilev1.RideRequest, from lastmilev1.RideStatus, messages ...OutboxMessage) error
+	ListRideRequests(ctx context.Context, filter RideRequestFilter) ([]*lastmilev1.RideRequest, error)
+}
+
+type MemoryRideRequestStore struct {
+	mu       sync.RWMutex
+	outbox   *MemoryOutbox
+	requests map[string]*lastmilev1.RideRequest
+}
+
+func NewMemoryRideRequestStore(outbox *MemoryOutbox) *MemoryRideRequestStore {
+	if outbox == nil {
+		outbox = NewMemoryOutbox()
+	}
+	return &MemoryRideRequestStore{outbox: outbox, requests: make(map[string]*lastmilev1.RideRequest)}
+}
+
+func (s *MemoryRideRequestStore) Outbox() *MemoryOutbox {
+	return s.outbox
+}
+
+func (s *MemoryRideRequestStore) CreateRideRequest(_ context.Context, request *lastmilev1.RideRequest, messages ...OutboxMessage) error {
+	if request == nil || request.RequestId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.requests[request.RequestId]; exists {
+		return ErrAlreadyExists
+	}
+	if request.QuoteId != "" {
+		for _, existing := range s.requests {
+			if existing.QuoteId == request.QuoteId {
+				return ErrQuoteUsed
+			}
+		}
+	}
+	s.requests[request.RequestId] = cloneRideRequest(request)
+	s.outbox.append(messages)
+	return nil
+}
+
+func (s *MemoryRideRequestStore) GetRideRequest(_ context.Context, requestID string) (*lastmilev1.RideRequest, error) {
+	if requestID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	request, ok := s.requests[requestID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneRideRequest(request), nil
+}
+
+func (s *MemoryRideRequestStore) UpdateRideRequest(_ context.Context, request *lastmilev1.RideRequest, from lastmilev1.RideStatus, messages ...OutboxMessage) error {
+	if request == nil || request.RequestId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, exists := s.requests[request.RequestId]
+	if !exists {
+		return ErrNotFound
+	}
+	if stored.Status != from {
+		return ErrStatusChanged
+	}
+	s.requests[request.RequestId] = cloneRideRequest(request)
+	s.outbox.append(messages)
+	return nil
+}
+
+func (s *MemoryRideRequestStore) ListRideRequests(_ context.Context, filter RideRequestFilter) ([]*lastmilev1.RideRequest, error) {
+	s.mu.RLock()
+	requests := make([]*lastmilev1.RideRequest, 0, len(s.requests))
+	for _, request := range s.requests {
+		if filter.matches(request) {
+			requests = append(requests, cloneRideRequest(request))
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].RequestId < requests[j].RequestId
+	})
+	return requests, nil
+}
+
+func (f RideRequestFilter) matches(request *lastmilev1.RideRequest) bool {
+	if f.StationID != "" && request.StationId != f.StationID {
+		return false
+	}
+	if f.RiderID != "" && request.RiderId != f.RiderID {
+		return false
+	}
+	if f.Status != lastmilev1.RideStatus_RIDE_STATUS_UNSPECIFIED && request.Status != f.Status {
+		return false
+	}
+	if f.TrainTripID != "" && request.GetTrain().GetTripId() != f.TrainTripID {
+		return false
+	}
+	return true
+}
+
+func cloneRideRequest(request *lastmilev1.RideRequest) *lastmilev1.RideRequest {
+	if request == nil {
+		return nil
+	}
+	return proto.Clone(request).(*lastmilev1.RideRequest)
+}
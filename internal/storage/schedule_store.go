@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// ScheduleStore keeps the train arrival schedule of each station.
+type ScheduleStore interface {
+	// PutSchedule replaces the schedule of schedule.StationId.
+	PutSchedule(ctx context.Context, schedule *lastmilev1.StationSchedule) error
+	GetSchedule(ctx context.Context, stationID string) (*lastmilev1.StationSchedule, error)
+}
+
+type MemoryScheduleStore struct {
+	mu        sync.RWMutex
+	schedules map[string]*lastmilev1.StationSchedule
+}
+
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{schedules: make(map[string]*lastmilev1.StationSchedule)}
+}
+
+func (s *MemoryScheduleStore) PutSchedule(_ context.Context, schedule *lastmilev1.StationSchedule) error {
+	if schedule == nil || schedule.StationId == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	s.schedules[schedule.StationId] = proto.Clone(schedule).(*lastmilev1.StationSchedule)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryScheduleStore) GetSchedule(_ context.Context, stationID string) (*lastmilev1.StationSchedule, error) {
+	if stationID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	schedule, ok := s.schedules[stationID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(schedule).(*lastmilev1.StationSchedule), nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type SeatStore interface {
+	UpsertSeats(ctx context.Context, availability *lastmilev1.SeatAvailability) error
+	GetSeats(ctx context.Context, driverID string) (*lastmilev1.SeatAvailability, error)
+	ListSeats(ctx context.Context) ([]*lastmilev1.SeatAvailability, error)
+}
+
+type MemorySeatStore struct {
+	mu    sync.RWMutex
+	seats map[string]*lastmilev1.SeatAvailability
+}
+
+func NewMemorySeatStore() *MemorySeatStore {
+	return &MemorySeatStore{seats: make(map[string]*lastmilev1.SeatAvailability)}
+}
+
+func (s *MemorySeatStore) UpsertSeats(_ context.Context, availability *lastmilev1.SeatAvailability) error {
+	if availability == nil || availability.DriverId == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	s.seats[availability.DriverId] = proto.Clone(availability).(*lastmilev1.SeatAvailability)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemorySeatStore) GetSeats(_ context.Context, driverID string) (*lastmilev1.SeatAvailability, error) {
+	if driverID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	availability, ok := s.seats[driverID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(availability).(*lastmilev1.SeatAvailability), nil
+}
+
+func (s *MemorySeatStore) ListSeats(_ context.Context) ([]*lastmilev1.SeatAvailability, error) {
+	s.mu.RLock()
+	seats := make([]*lastmilev1.SeatAvailability, 0, len(s.seats))
+	for _, availability := range s.seats {
+		seats = append(seats, proto.Clone(availability).(*lastmilev1.SeatAvailability))
+	}
+	s.mu.RUnlock()
+	sort.Slice(seats, func(i, j int) bool {
+		return seats[i].DriverId < seats[j].DriverId
+	})
+	return seats, nil
+}
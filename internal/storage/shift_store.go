@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ShiftStore records driver online sessions. A driver has at most one open
+// shift (no ended_at) at a time.
+type ShiftStore interface {
+	StartShift(ctx context.Context, shift *lastmilev1.DriverShift) error
+	EndShift(ctx context.Context, driverID string, endedAt time.Time, reason lastmilev1.ShiftEndReason) (*lastmilev1.DriverShift, error)
+	TouchShift(ctx context.Context, driverID string, pingAt time.Time) error
+	GetOpenShift(ctx context.Context, driverID string) (*lastmilev1.DriverShift, error)
+	ListOpenShifts(ctx context.Context) ([]*lastmilev1.DriverShift, error)
+	// ListShifts pages a driver's shifts newest first. It takes the cursor
+	// to resume after and returns the cursor to resume after next ("" when
+	// done).
+	ListShifts(ctx context.Context, filter ShiftFilter, after string, limit int) ([]*lastmilev1.DriverShift, string, error)
+}
+
+type ShiftFilter struct {
+	DriverID string
+	// StartedBefore, when set, skips shifts started at or after it.
+	StartedBefore time.Time
+}
+
+type MemoryShiftStore struct {
+	mu     sync.RWMutex
+	shifts map[string][]*lastmilev1.DriverShift
+}
+
+func NewMemoryShiftStore() *MemoryShiftStore {
+	return &MemoryShiftStore{shifts: make(map[string][]*lastmilev1.DriverShift)}
+}
+
+func (s *MemoryShiftStore) StartShift(_ context.Context, shift *lastmilev1.DriverShift) error {
+	if shift == nil || shift.ShiftId == "" || shift.DriverId == "" || shift.StartedAt == nil {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.openShift(shift.DriverId) != nil {
+		return ErrAlreadyExists
+	}
+	s.shifts[shift.DriverId] = append(s.shifts[shift.DriverId], proto.Clone(shift).(*lastmilev1.DriverShift))
+	return nil
+}
+
+func (s *MemoryShiftStore) EndShift(_ context.Context, driverID string, endedAt time.Time, reason lastmilev1.ShiftEndReason) (*lastmilev1.DriverShift, error) {
+	if driverID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shift := s.openShift(driverID)
+	if shift == nil {
+		return nil, ErrNotFound
+	}
+	endShift(shift, endedAt, reason)
+	return proto.Clone(shift).(*lastmilev1.DriverShift), nil
+}
+
+func (s *MemoryShiftStore) TouchShift(_ context.Context, driverID string, pingAt time.Time) error {
+	if driverID == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shift := s.openShift(driverID)
+	if shift == nil {
+		return ErrNotFound
+	}
+	touchShift(shift, pingAt)
+	return nil
+}
+
+func (s *MemoryShiftStore) GetOpenShift(_ context.Context, driverID string) (*lastmilev1.DriverShift, error) {
+	if driverID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	shift := s.openShift(driverID)
+	if shift == nil {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(shift).(*lastmilev1.DriverShift), nil
+}
+
+func (s *MemoryShiftStore) ListOpenShifts(_ context.Context) ([]*lastmilev1.DriverShift, error) {
+	s.mu.RLock()
+	open := make([]*lastmilev1.DriverShift, 0, len(s.shifts))
+	for driverID := range s.shifts {
+		if shift := s.openShift(driverID); shift != nil {
+			open = append(open, proto.Clone(shift).(*lastmilev1.DriverShift))
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].DriverId < open[j].DriverId
+	})
+	return open, nil
+}
+
+func (s *MemoryShiftStore) ListShifts(_ context.Context, filter ShiftFilter, after string, limit int) ([]*lastmilev1.DriverShift, string, error) {
+	if filter.DriverID == "" || limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	var from *shiftCursor
+	if after != "" {
+		cursor, err := parseShiftCursor(after)
+		if err != nil {
+			return nil, "", err
+		}
+		from = &cursor
+	}
+	s.mu.RLock()
+	history := slices.Clone(s.shifts[filter.DriverID])
+	s.mu.RUnlock()
+	slices.SortFunc(history, func(a, b *lastmilev1.DriverShift) int {
+		return newShiftCursor(b).compare(newShiftCursor(a))
+	})
+	page := newKeysetPage[*lastmilev1.DriverShift](limit)
+	for _, shift := range history {
+		cursor := newShiftCursor(shift)
+		if from != nil && cursor.compare(*from) >= 0 {
+			continue
+		}
+		if !filter.StartedBefore.IsZero() && !shift.StartedAt.AsTime().Before(filter.StartedBefore) {
+			continue
+		}
+		if !page.add(cursor.String(), proto.Clone(shift).(*lastmilev1.DriverShift)) {
+			break
+		}
+	}
+	return page.items, page.next, nil
+}
+
+func (s *MemoryShiftStore) openShift(driverID string) *lastmilev1.DriverShift {
+	history := s.shifts[driverID]
+	if len(history) == 0 {
+		return nil
+	}
+	if last := history[len(history)-1]; last.EndedAt == nil {
+		return last
+	}
+	return nil
+}
+
+// shiftCursor orders a driver's shifts by start time, to the millisecond
+// Redis scores them with, then by id.
+type shiftCursor struct {
+	startedAt int64
+	shiftID   string
+}
+
+func newShiftCursor(shift *lastmilev1.DriverShift) shiftCursor {
+	return shiftCursor{startedAt: shift.StartedAt.AsTime().UnixMilli(), shiftID: shift.ShiftId}
+}
+
+func parseShiftCursor(raw string) (shiftCursor, error) {
+	millis, id, ok := strings.Cut(raw, "/")
+	startedAt, err := strconv.ParseInt(millis, 10, 64)
+	if !ok || err != nil || id == "" {
+		return shiftCursor{}, ErrInvalidArgument
+	}
+	return shiftCursor{startedAt: startedAt, shiftID: id}, nil
+}
+
+func (c shiftCursor) String() string {
+	return fmt.Sprintf("%d/%s", c.startedAt, c.shiftID)
+}
+
+func (c shiftCursor) compare(other shiftCursor) int {
+	if c.startedAt != other.startedAt {
+		if c.startedAt < other.startedAt {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(c.shiftID, other.shiftID)
+}
+
+func endShift(shift *lastmilev1.DriverShift, endedAt time.Time, reason lastmilev1.ShiftEndReason) {
+	if endedAt.Before(shift.StartedAt.AsTime()) {
+		endedAt = shift.StartedAt.AsTime()
+	}
+	shift.EndedAt = timestamppb.New(endedAt)
+	shift.EndReason = reason
+}
+
+func touchShift(shift *lastmilev1.DriverShift, pingAt time.Time) {
+	if shift.LastPingAt == nil || pingAt.After(shift.LastPingAt.AsTime()) {
+		shift.LastPingAt = timestamppb.New(pingAt)
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMemoryListShiftsKeysetSurvivesNewShifts(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryShiftStore()
+	base := time.Now().Add(-10 * time.Hour)
+	for i, id := range []string{"s1", "s2", "s3"} {
+		started := base.Add(time.Duration(i) * time.Hour)
+		if err := store.StartShift(ctx, &lastmilev1.DriverShift{ShiftId: id, DriverId: "d1", StartedAt: timestamppb.New(started)}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := store.EndShift(ctx, "d1", started.Add(30*time.Minute), lastmilev1.ShiftEndReason_SHIFT_END_REASON_DRIVER); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	page, next, err := store.ListShifts(ctx, ShiftFilter{DriverID: "d1"}, "", 2)
+	if err != nil || len(page) != 2 || page[0].ShiftId != "s3" || page[1].ShiftId != "s2" || next == "" {
+		t.Fatalf("unexpected first page: %v, %q, %v", page, next, err)
+	}
+	// A shift started between pages must not shift the next page.
+	if err := store.StartShift(ctx, &lastmilev1.DriverShift{ShiftId: "s4", DriverId: "d1", StartedAt: timestamppb.Now()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	page, next, err = store.ListShifts(ctx, ShiftFilter{DriverID: "d1"}, next, 2)
+	if err != nil || len(page) != 1 || page[0].ShiftId != "s1" || next != "" {
+		t.Fatalf("unexpected second page: %v, %q, %v", page, next, err)
+	}
+
+	page, _, err = store.ListShifts(ctx, ShiftFilter{DriverID: "d1", StartedBefore: base.Add(90 * time.Minute)}, "", 10)
+	if err != nil || len(page) != 2 || page[0].ShiftId != "s2" {
+		t.Fatalf("unexpected bounded page: %v, %v", page, err)
+	}
+	if _, _, err := store.ListShifts(ctx, ShiftFilter{DriverID: "d1"}, "bogus", 10); err != ErrInvalidArgument {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+}
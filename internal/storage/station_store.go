@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"math"
+	"slices"
 	"sort"
 	"sync"
 
@@ -11,12 +13,25 @@ import (
 type StationStore interface {
 	Upsert(ctx context.Context, station *lastmilev1.Station) error
 	Get(ctx context.Context, stationID string) (*lastmilev1.Station, error)
-	List(ctx context.Context, offset, limit int) ([]*lastmilev1.Station, int, error)
+	// Update replaces an existing station and returns ErrNotFound if it is gone.
+	Update(ctx context.Context, station *lastmilev1.Station) error
+	Delete(ctx context.Context, stationID string) error
+	// List returns up to limit stations ordered by id, starting after the
+	// given id, plus the id to resume after ("" once the list is exhausted).
+	List(ctx context.Context, after string, limit int) ([]*lastmilev1.Station, string, error)
+	// SearchNear returns up to limit stations within radiusMeters of center,
+	// closest first.
+	SearchNear(ctx context.Context, center *lastmilev1.LatLng, radiusMeters float64, limit int) ([]*lastmilev1.NearbyStation, error)
+	// ListByArea returns the stations serving areaID, ordered by id.
+	ListByArea(ctx context.Context, areaID string) ([]*lastmilev1.Station, error)
 }
 
+const earthRadiusMeters = 6371000
+
 type MemoryStationStore struct {
 	mu       sync.RWMutex
 	stations map[string]*lastmilev1.Station
+	ids      sortedIDs
 }
 
 func NewMemoryStationStore() *MemoryStationStore {
@@ -29,6 +44,7 @@ func (s *MemoryStationStore) Upsert(_ context.Context, station *lastmilev1.Stati
 	}
 	s.mu.Lock()
 	s.stations[station.StationId] = cloneStation(station)
+	s.ids.add(station.StationId)
 	s.mu.Unlock()
 	return nil
 }
@@ -46,39 +62,99 @@ func (s *MemoryStationStore) Get(_ context.Context, stationID string) (*lastmile
 	return cloneStation(station), nil
 }
 
-func (s *MemoryStationStore) List(_ context.Context, offset, limit int) ([]*lastmilev1.Station, int, error) {
-	if offset < 0 || limit <= 0 {
-		return nil, 0, ErrInvalidArgument
+func (s *MemoryStationStore) Update(_ context.Context, station *lastmilev1.Station) error {
+	if station == nil || station.StationId == "" {
+		return ErrInvalidArgument
 	}
-	s.mu.RLock()
-	ids := make([]string, 0, len(s.stations))
-	for id := range s.stations {
-		ids = append(ids, id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.stations[station.StationId]; !ok {
+		return ErrNotFound
 	}
-	s.mu.RUnlock()
+	s.stations[station.StationId] = cloneStation(station)
+	return nil
+}
 
-	sort.Strings(ids)
-	if offset >= len(ids) {
-		return nil, -1, nil
+func (s *MemoryStationStore) Delete(_ context.Context, stationID string) error {
+	if stationID == "" {
+		return ErrInvalidArgument
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.stations[stationID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.stations, stationID)
+	s.ids.remove(stationID)
+	return nil
+}
 
-	end := offset + limit
-	if end > len(ids) {
-		end = len(ids)
+func (s *MemoryStationStore) List(_ context.Context, after string, limit int) ([]*lastmilev1.Station, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page := newKeysetPage[*lastmilev1.Station](limit)
+	for _, id := range s.ids.after(after) {
+		if !page.add(id, cloneStation(s.stations[id])) {
+			break
+		}
 	}
+	return page.items, page.next, nil
+}
 
-	stations := make([]*lastmilev1.Station, 0, end-offset)
+func (s *MemoryStationStore) SearchNear(_ context.Context, center *lastmilev1.LatLng, radiusMeters float64, limit int) ([]*lastmilev1.NearbyStation, error) {
+	if center == nil || radiusMeters <= 0 || limit <= 0 {
+		return nil, ErrInvalidArgument
+	}
 	s.mu.RLock()
-	for _, id := range ids[offset:end] {
-		stations = append(stations, cloneStation(s.stations[id]))
+	results := make([]*lastmilev1.NearbyStation, 0)
+	for _, station := range s.stations {
+		if station.Location == nil {
+			continue
+		}
+		distance := haversineMeters(center, station.Location)
+		if distance > radiusMeters {
+			continue
+		}
+		results = append(results, &lastmilev1.NearbyStation{Station: cloneStation(station), DistanceMeters: distance})
 	}
 	s.mu.RUnlock()
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].DistanceMeters != results[j].DistanceMeters {
+			return results[i].DistanceMeters < results[j].DistanceMeters
+		}
+		return results[i].Station.StationId < results[j].Station.StationId
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
 
-	next := -1
-	if end < len(ids) {
-		next = end
+func (s *MemoryStationStore) ListByArea(_ context.Context, areaID string) ([]*lastmilev1.Station, error) {
+	if areaID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var stations []*lastmilev1.Station
+	for _, id := range s.ids {
+		if station := s.stations[id]; slices.Contains(station.NearbyAreaIds, areaID) {
+			stations = append(stations, cloneStation(station))
+		}
 	}
-	return stations, next, nil
+	return stations, nil
+}
+
+func haversineMeters(a, b *lastmilev1.LatLng) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
 }
 
 func cloneStation(station *lastmilev1.Station) *lastmilev1.Station {
@@ -90,6 +166,7 @@ func cloneStation(station *lastmilev1.Station) *lastmilev1.Station {
 		Name:          station.Name,
 		Location:      cloneLatLng(station.Location),
 		NearbyAreaIds: append([]string(nil), station.NearbyAreaIds...),
+		GtfsStopId:    station.GtfsStopId,
 	}
 }
 
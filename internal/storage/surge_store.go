@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// SurgeStore keeps each station's current surge multiplier and the audit
+// trail of its changes.
+type SurgeStore interface {
+	Get(ctx context.Context, stationID string) (*lastmilev1.StationSurge, error)
+	// Set stores surge as the station's current value and, when change is
+	// not nil, appends it to the station's audit trail.
+	Set(ctx context.Context, surge *lastmilev1.StationSurge, change *lastmilev1.SurgeChange) error
+	// ListChanges pages a station's changes by change id, which callers make
+	// time ordered.
+	ListChanges(ctx context.Context, stationID, after string, limit int) ([]*lastmilev1.SurgeChange, string, error)
+}
+
+type MemorySurgeStore struct {
+	mu       sync.RWMutex
+	surges   map[string]*lastmilev1.StationSurge
+	changes  map[string]*lastmilev1.SurgeChange
+	stations map[string]*sortedIDs
+}
+
+func NewMemorySurgeStore() *MemorySurgeStore {
+	return &MemorySurgeStore{
+		surges:   make(map[string]*lastmilev1.StationSurge),
+		changes:  make(map[string]*lastmilev1.SurgeChange),
+		stations: make(map[string]*sortedIDs),
+	}
+}
+
+func (s *MemorySurgeStore) Get(_ context.Context, stationID string) (*lastmilev1.StationSurge, error) {
+	if stationID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	surge, ok := s.surges[stationID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(surge).(*lastmilev1.StationSurge), nil
+}
+
+func (s *MemorySurgeStore) Set(_ context.Context, surge *lastmilev1.StationSurge, change *lastmilev1.SurgeChange) error {
+	if !validSurge(surge, change) {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.surges[surge.StationId] = proto.Clone(surge).(*lastmilev1.StationSurge)
+	if change != nil {
+		ids, ok := s.stations[change.StationId]
+		if !ok {
+			ids = &sortedIDs{}
+			s.stations[change.StationId] = ids
+		}
+		s.changes[change.ChangeId] = proto.Clone(change).(*lastmilev1.SurgeChange)
+		ids.add(change.ChangeId)
+	}
+	return nil
+}
+
+func (s *MemorySurgeStore) ListChanges(_ context.Context, stationID, after string, limit int) ([]*lastmilev1.SurgeChange, string, error) {
+	if stationID == "" || limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page := newKeysetPage[*lastmilev1.SurgeChange](limit)
+	if ids, ok := s.stations[stationID]; ok {
+		for _, id := range ids.after(after) {
+			if !page.add(id, proto.Clone(s.changes[id]).(*lastmilev1.SurgeChange)) {
+				break
+			}
+		}
+	}
+	return page.items, page.next, nil
+}
+
+func validSurge(surge *lastmilev1.StationSurge, change *lastmilev1.SurgeChange) bool {
+	if surge == nil || surge.StationId == "" {
+		return false
+	}
+	return change == nil || (change.ChangeId != "" && change.StationId == surge.StationId)
+}
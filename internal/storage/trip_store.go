@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type TripFilter struct {
+	DriverID  string
+	StationID string
+	Status    lastmilev1.TripStatus
+	RequestID string
+}
+
+type TripStore interface {
+	CreateTrip(ctx context.Context, trip *lastmilev1.Trip, messages ...OutboxMessage) error
+	GetTrip(ctx context.Context, tripID string) (*lastmilev1.Trip, error)
+	UpdateTrip(ctx context.Context, trip *lastmilev1.Trip, messages ...OutboxMessage) error
+	ListTrips(ctx context.Context, filter TripFilter) ([]*lastmilev1.Trip, error)
+	// SetDropoffPlan replaces only the drop-off plan of a trip that is still
+	// scheduled, and returns ErrNotFound for any other trip.
+	SetDropoffPlan(ctx context.Context, tripID string, plan *lastmilev1.DropoffPlan) error
+	// RateTrip stores rating as the rider's (byRider) or the driver's rating
+	// of a completed trip and leaves the rest of the trip alone. It returns
+	// ErrAlreadyExists if that party already rated the trip and ErrNotFound
+	// if the trip is missing or not completed.
+	RateTrip(ctx context.Context, tripID string, byRider bool, rating *lastmilev1.TripRating, messages ...OutboxMessage) error
+}
+
+type MemoryTripStore struct {
+	mu     sync.RWMutex
+	outbox *MemoryOutbox
+	trips  map[string]*lastmilev1.Trip
+}
+
+func NewMemoryTripStore(outbox *MemoryOutbox) *MemoryTripStore {
+	if outbox == nil {
+		outbox = NewMemoryOutbox()
+	}
+	return &MemoryTripStore{outbox: outbox, trips: make(map[string]*lastmilev1.Trip)}
+}
+
+func (s *MemoryTripStore) Outbox() *MemoryOutbox {
+	return s.outbox
+}
+
+func (s *MemoryTripStore) CreateTrip(_ context.Context, trip *lastmilev1.Trip, messages ...OutboxMessage) error {
+	if trip == nil || trip.TripId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.trips[trip.TripId]; exists {
+		return ErrAlreadyExists
+	}
+	s.trips[trip.TripId] = cloneTrip(trip)
+	s.outbox.append(messages)
+	return nil
+}
+
+func (s *MemoryTripStore) GetTrip(_ context.Context, tripID string) (*lastmilev1.Trip, error) {
+	if tripID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	trip, ok := s.trips[tripID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneTrip(trip), nil
+}
+
+func (s *MemoryTripStore) UpdateTrip(_ context.Context, trip *lastmilev1.Trip, messages ...OutboxMessage) error {
+	if trip == nil || trip.TripId == "" {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.trips[trip.TripId]; !exists {
+		return ErrNotFound
+	}
+	s.trips[trip.TripId] = cloneTrip(trip)
+	s.outbox.append(messages)
+	return nil
+}
+
+func (s *MemoryTripStore) ListTrips(_ context.Context, filter TripFilter) ([]*lastmilev1.Trip, error) {
+	s.mu.RLock()
+	trips := make([]*lastmilev1.Trip, 0, len(s.trips))
+	for _, trip := range s.trips {
+		if filter.matches(trip) {
+			trips = append(trips, cloneTrip(trip))
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].TripId < trips[j].TripId
+	})
+	return trips, nil
+}
+
+func (s *MemoryTripStore) SetDropoffPlan(_ context.Context, tripID string, plan *lastmilev1.DropoffPlan) error {
+	if tripID == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trip, ok := s.trips[tripID]
+	if !ok || trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED {
+		return ErrNotFound
+	}
+	trip.DropoffPlan = proto.Clone(plan).(*lastmilev1.DropoffPlan)
+	return nil
+}
+
+func (s *MemoryTripStore) RateTrip(_ context.Context, tripID string, byRider bool, rating *lastmilev1.TripRating, messages ...OutboxMessage) error {
+	if tripID == "" || rating == nil {
+		return ErrInvalidArgument
+	}
+	if err := validateOutboxMessages(messages); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trip, ok := s.trips[tripID]
+	if !ok || trip.Status != lastmilev1.TripStatus_TRIP_STATUS_COMPLETED {
+		return ErrNotFound
+	}
+	if err := setTripRating(trip, byRider, rating); err != nil {
+		return err
+	}
+	s.outbox.append(messages)
+	return nil
+}
+
+func setTripRating(trip *lastmilev1.Trip, byRider bool, rating *lastmilev1.TripRating) error {
+	field := &trip.RatingByDriver
+	if byRider {
+		field = &trip.RatingByRider
+	}
+	if *field != nil {
+		return ErrAlreadyExists
+	}
+	*field = proto.Clone(rating).(*lastmilev1.TripRating)
+	trip.UpdatedAt = rating.RatedAt
+	return nil
+}
+
+func (f TripFilter) matches(trip *lastmilev1.Trip) bool {
+	if f.DriverID != "" && trip.DriverId != f.DriverID {
+		return false
+	}
+	if f.StationID != "" && trip.StationId != f.StationID {
+		return false
+	}
+	if f.Status != lastmilev1.TripStatus_TRIP_STATUS_UNSPECIFIED && trip.Status != f.Status {
+		return false
+	}
+	if f.RequestID != "" && trip.RequestId != f.RequestID {
+		return false
+	}
+	return true
+}
+
+func cloneTrip(trip *lastmilev1.Trip) *lastmilev1.Trip {
+	if trip == nil {
+		return nil
+	}
+	return proto.Clone(trip).(*lastmilev1.Trip)
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+func TestMemorySetDropoffPlanOnlyTouchesScheduledTrips(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTripStore(nil)
+	for _, trip := range []*lastmilev1.Trip{
+		{TripId: "scheduled", Status: lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED, Pickup: &lastmilev1.PickupVerification{FailedAttempts: 2}},
+		{TripId: "active", Status: lastmilev1.TripStatus_TRIP_STATUS_ACTIVE},
+	} {
+		if err := store.CreateTrip(ctx, trip); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	plan := &lastmilev1.DropoffPlan{Stops: []*lastmilev1.DropoffStop{{DestinationId: "x", Riders: 1}}}
+	if err := store.SetDropoffPlan(ctx, "scheduled", plan); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plan.Stops[0].DestinationId = "changed"
+	trip, _ := store.GetTrip(ctx, "scheduled")
+	if trip.GetDropoffPlan().GetStops()[0].DestinationId != "x" || trip.Pickup.GetFailedAttempts() != 2 {
+		t.Fatalf("expected only a copy of the plan to be set, got %v", trip)
+	}
+	if err := store.SetDropoffPlan(ctx, "active", plan); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an active trip, got %v", err)
+	}
+	if err := store.SetDropoffPlan(ctx, "missing", plan); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing trip, got %v", err)
+	}
+}
+
+func TestMemoryCreateMatchOnlyMatchesPendingRequests(t *testing.T) {
+	ctx := context.Background()
+	outbox := NewMemoryOutbox()
+	trips := NewMemoryTripStore(outbox)
+	requests := NewMemoryRideRequestStore(outbox)
+	store := NewMemoryMatchStore(trips, requests)
+	if err := requests.CreateRideRequest(ctx, &lastmilev1.RideRequest{RequestId: "req1", Status: lastmilev1.RideStatus_RIDE_STATUS_PENDING}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matched := &lastmilev1.RideRequest{RequestId: "req1", Status: lastmilev1.RideStatus_RIDE_STATUS_MATCHED}
+	if err := store.CreateMatch(ctx, &lastmilev1.Trip{TripId: "t1", RequestId: "req1"}, matched); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A second run that listed the request before it was matched writes nothing.
+	if err := store.CreateMatch(ctx, &lastmilev1.Trip{TripId: "t2", RequestId: "req1"}, matched); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a matched request, got %v", err)
+	}
+	if _, err := trips.GetTrip(ctx, "t2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected no second trip, got %v", err)
+	}
+	if err := store.CreateMatch(ctx, &lastmilev1.Trip{TripId: "t1"}, matched); !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists for an existing trip, got %v", err)
+	}
+	request, _ := requests.GetRideRequest(ctx, "req1")
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		t.Fatalf("expected the request matched, got %v", request.Status)
+	}
+}
+
+func TestMemoryStartPickupKeepsConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	outbox := NewMemoryOutbox()
+	trips := NewMemoryTripStore(outbox)
+	requests := NewMemoryRideRequestStore(outbox)
+	store := NewMemoryPickupStore(trips, requests)
+	for _, id := range []string{"t1", "t2"} {
+		if err := requests.CreateRideRequest(ctx, &lastmilev1.RideRequest{RequestId: "req_" + id, Status: lastmilev1.RideStatus_RIDE_STATUS_MATCHED}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := trips.CreateTrip(ctx, &lastmilev1.Trip{
+			TripId: id, RequestId: "req_" + id, Status: lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+			Pickup: &lastmilev1.PickupVerification{Pin: "1234"},
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// The correct attempt and a concurrent wrong one are both counted.
+	for range 2 {
+		if _, err := store.AddPickupAttempt(ctx, "t1", 5); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := store.StartPickup(ctx, "t1", "req_t1", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	trip, _ := trips.GetTrip(ctx, "t1")
+	if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_ACTIVE || trip.Pickup.VerifiedAt == nil || trip.Pickup.FailedAttempts != 1 {
+		t.Fatalf("expected an active trip with one failed attempt, got %v", trip)
+	}
+
+	// A no-show cancellation that lands first is not undone.
+	canceled, _ := trips.GetTrip(ctx, "t2")
+	canceled.Status = lastmilev1.TripStatus_TRIP_STATUS_CANCELED
+	if err := trips.UpdateTrip(ctx, canceled); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.StartPickup(ctx, "t2", "req_t2", time.Now()); !errors.Is(err, ErrStatusChanged) {
+		t.Fatalf("expected ErrStatusChanged, got %v", err)
+	}
+	request, _ := requests.GetRideRequest(ctx, "req_t2")
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		t.Fatalf("expected the request untouched, got %s", request.Status)
+	}
+}
+
+func TestMemoryCancelMatchSkipsStartedPickups(t *testing.T) {
+	ctx := context.Background()
+	outbox := NewMemoryOutbox()
+	trips := NewMemoryTripStore(outbox)
+	requests := NewMemoryRideRequestStore(outbox)
+	store := NewMemoryMatchStore(trips, requests)
+	pickups := NewMemoryPickupStore(trips, requests)
+	if err := requests.CreateRideRequest(ctx, &lastmilev1.RideRequest{RequestId: "req1", Status: lastmilev1.RideStatus_RIDE_STATUS_MATCHED}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := trips.CreateTrip(ctx, &lastmilev1.Trip{
+		TripId: "t1", RequestId: "req1", Status: lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+		Pickup: &lastmilev1.PickupVerification{Pin: "1234"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pickups.StartPickup(ctx, "t1", "req1", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cancellation := &lastmilev1.Cancellation{Reason: lastmilev1.CancellationReason_CANCELLATION_REASON_SYSTEM_RIDER_NO_SHOW}
+	err := store.CancelMatch(ctx, "t1", "req1", cancellation, lastmilev1.RideStatus_RIDE_STATUS_CANCELED)
+	if !errors.Is(err, ErrStatusChanged) {
+		t.Fatalf("expected ErrStatusChanged, got %v", err)
+	}
+	request, _ := requests.GetRideRequest(ctx, "req1")
+	trip, _ := trips.GetTrip(ctx, "t1")
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_PICKED_UP || trip.Status != lastmilev1.TripStatus_TRIP_STATUS_ACTIVE {
+		t.Fatalf("expected the pickup to stand, got %s and %s", request.Status, trip.Status)
+	}
+}
+
+func TestMemoryUpdateRideRequestRejectsStaleStatus(t *testing.T) {
+	ctx := context.Background()
+	outbox := NewMemoryOutbox()
+	requests := NewMemoryRideRequestStore(outbox)
+	store := NewMemoryMatchStore(NewMemoryTripStore(outbox), requests)
+	if err := requests.CreateRideRequest(ctx, &lastmilev1.RideRequest{RequestId: "req1", Status: lastmilev1.RideStatus_RIDE_STATUS_PENDING}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stale, _ := requests.GetRideRequest(ctx, "req1")
+	matched := &lastmilev1.RideRequest{RequestId: "req1", Status: lastmilev1.RideStatus_RIDE_STATUS_MATCHED}
+	if err := store.CreateMatch(ctx, &lastmilev1.Trip{TripId: "t1", RequestId: "req1"}, matched); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A cancel built from the read before the match must not overwrite it.
+	stale.Status = lastmilev1.RideStatus_RIDE_STATUS_CANCELED
+	if err := requests.UpdateRideRequest(ctx, stale, lastmilev1.RideStatus_RIDE_STATUS_PENDING); !errors.Is(err, ErrStatusChanged) {
+		t.Fatalf("expected ErrStatusChanged, got %v", err)
+	}
+	request, _ := requests.GetRideRequest(ctx, "req1")
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		t.Fatalf("expected the request to stay matched, got %s", request.Status)
+	}
+	if err := requests.UpdateRideRequest(ctx, &lastmilev1.RideRequest{RequestId: "missing"}, lastmilev1.RideStatus_RIDE_STATUS_PENDING); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -2,31 +2,82 @@ package storage
 
 import (
 	"context"
+	"strings"
 	"sync"
+	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+type UserFilter struct {
+	Query string
+}
+
 type RiderStore interface {
 	CreateRider(ctx context.Context, profile *lastmilev1.RiderProfile) error
 	GetRider(ctx context.Context, riderID string) (*lastmilev1.RiderProfile, error)
+	GetRiderByPhone(ctx context.Context, phone string) (*lastmilev1.RiderProfile, error)
+	// UpdateRider replaces the profile but keeps its rating and no-show
+	// counters, which only the Add methods change.
+	UpdateRider(ctx context.Context, profile *lastmilev1.RiderProfile) error
+	// AddRiderRating counts a trip rating of stars in the rider's average.
+	AddRiderRating(ctx context.Context, riderID string, stars int32) error
+	// AddRiderNoShow counts the missed pickup of a ride request against the
+	// rider, once per request.
+	AddRiderNoShow(ctx context.Context, riderID, requestID string) error
+	DeleteRider(ctx context.Context, riderID string, deletedAt time.Time) error
+	ListRiders(ctx context.Context, filter UserFilter, after string, limit int) ([]*lastmilev1.RiderProfile, string, error)
 }
 
 type DriverStore interface {
 	CreateDriver(ctx context.Context, profile *lastmilev1.DriverProfile) error
 	GetDriver(ctx context.Context, driverID string) (*lastmilev1.DriverProfile, error)
+	GetDriverByPhone(ctx context.Context, phone string) (*lastmilev1.DriverProfile, error)
+	GetDriverByVehicle(ctx context.Context, vehicleID string) (*lastmilev1.DriverProfile, error)
+	// UpdateDriver writes the profile's name, phone and vehicle; verification
+	// state and counters are left to their own methods. Like CreateDriver it
+	// returns ErrVehicleInUse if another active driver holds the vehicle.
+	UpdateDriver(ctx context.Context, profile *lastmilev1.DriverProfile) error
+	// UpdateDriverVerification writes the profile's status, status reason
+	// and documents if the stored status is still from, and returns
+	// ErrStatusChanged otherwise.
+	UpdateDriverVerification(ctx context.Context, profile *lastmilev1.DriverProfile, from lastmilev1.DriverStatus) error
+	// AddDriverRating counts a trip rating of stars in the driver's average.
+	AddDriverRating(ctx context.Context, driverID string, stars int32) error
+	// AddDriverCancellation counts a driver-initiated cancellation of a trip
+	// and takes penalty off the reliability score, which starts at
+	// MaxReliability. It counts each trip once.
+	AddDriverCancellation(ctx context.Context, driverID, tripID string, penalty float64) error
+	DeleteDriver(ctx context.Context, driverID string, deletedAt time.Time) error
+	ListDrivers(ctx context.Context, filter UserFilter, after string, limit int) ([]*lastmilev1.DriverProfile, string, error)
 }
 
+// MaxReliability is a driver's reliability score before their first
+// cancellation.
+const MaxReliability = 100
+
 type MemoryUserStore struct {
 	mu      sync.RWMutex
 	riders  map[string]*lastmilev1.RiderProfile
 	drivers map[string]*lastmilev1.DriverProfile
+	phones  map[string]string
+	// vehicles maps each vehicle held by an active driver to the driver.
+	vehicles  map[string]string
+	riderIDs  sortedIDs
+	driverIDs sortedIDs
+	// counted holds the keys of counter changes that apply once.
+	counted map[string]bool
 }
 
 func NewMemoryUserStore() *MemoryUserStore {
 	return &MemoryUserStore{
-		riders:  make(map[string]*lastmilev1.RiderProfile),
-		drivers: make(map[string]*lastmilev1.DriverProfile),
+		riders:   make(map[string]*lastmilev1.RiderProfile),
+		drivers:  make(map[string]*lastmilev1.DriverProfile),
+		phones:   make(map[string]string),
+		vehicles: make(map[string]string),
+		counted:  make(map[string]bool),
 	}
 }
 
@@ -39,7 +90,12 @@ func (s *MemoryUserStore) CreateRider(_ context.Context, profile *lastmilev1.Rid
 	if _, exists := s.riders[profile.RiderId]; exists {
 		return ErrAlreadyExists
 	}
+	owner := riderOwner(profile.RiderId)
+	if err := s.claimPhone(owner, "", profile.Phone); err != nil {
+		return err
+	}
 	s.riders[profile.RiderId] = cloneRiderProfile(profile)
+	s.riderIDs.add(profile.RiderId)
 	return nil
 }
 
@@ -50,12 +106,111 @@ func (s *MemoryUserStore) GetRider(_ context.Context, riderID string) (*lastmile
 	s.mu.RLock()
 	profile, ok := s.riders[riderID]
 	s.mu.RUnlock()
-	if !ok {
+	if !ok || profile.DeletedAt != nil {
 		return nil, ErrNotFound
 	}
 	return cloneRiderProfile(profile), nil
 }
 
+func (s *MemoryUserStore) GetRiderByPhone(_ context.Context, phone string) (*lastmilev1.RiderProfile, error) {
+	if phone == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	riderID, ok := strings.CutPrefix(s.phones[phone], riderOwnerPrefix)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneRiderProfile(s.riders[riderID]), nil
+}
+
+func (s *MemoryUserStore) UpdateRider(_ context.Context, profile *lastmilev1.RiderProfile) error {
+	if profile == nil || profile.RiderId == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.riders[profile.RiderId]
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := s.claimPhone(riderOwner(profile.RiderId), existing.Phone, profile.Phone); err != nil {
+		return err
+	}
+	updated := cloneRiderProfile(profile)
+	updated.DeletedAt = nil
+	keepRiderCounters(updated, existing)
+	s.riders[profile.RiderId] = updated
+	return nil
+}
+
+func (s *MemoryUserStore) AddRiderRating(_ context.Context, riderID string, stars int32) error {
+	return s.changeRider(riderID, func(profile *lastmilev1.RiderProfile) {
+		addRating(&profile.RatingAverage, &profile.RatingCount, stars)
+	})
+}
+
+func (s *MemoryUserStore) AddRiderNoShow(_ context.Context, riderID, requestID string) error {
+	if requestID == "" {
+		return ErrInvalidArgument
+	}
+	return s.changeRider(riderID, func(profile *lastmilev1.RiderProfile) {
+		if key := "no_show:" + requestID; !s.counted[key] {
+			s.counted[key] = true
+			profile.NoShowCount++
+		}
+	})
+}
+
+func (s *MemoryUserStore) changeRider(riderID string, change func(*lastmilev1.RiderProfile)) error {
+	if riderID == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profile, ok := s.riders[riderID]
+	if !ok || profile.DeletedAt != nil {
+		return ErrNotFound
+	}
+	change(profile)
+	return nil
+}
+
+func (s *MemoryUserStore) DeleteRider(_ context.Context, riderID string, deletedAt time.Time) error {
+	if riderID == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.riders[riderID]
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	s.releasePhone(riderOwner(riderID), existing.Phone)
+	existing.DeletedAt = timestamppb.New(deletedAt)
+	return nil
+}
+
+func (s *MemoryUserStore) ListRiders(_ context.Context, filter UserFilter, after string, limit int) ([]*lastmilev1.RiderProfile, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page := newKeysetPage[*lastmilev1.RiderProfile](limit)
+	for _, id := range s.riderIDs.after(after) {
+		profile := s.riders[id]
+		if profile.DeletedAt != nil || !matchesUserQuery(filter.Query, profile.Name, profile.Phone) {
+			continue
+		}
+		if !page.add(id, cloneRiderProfile(profile)) {
+			break
+		}
+	}
+	return page.items, page.next, nil
+}
+
 func (s *MemoryUserStore) CreateDriver(_ context.Context, profile *lastmilev1.DriverProfile) error {
 	if profile == nil || profile.DriverId == "" {
 		return ErrInvalidArgument
@@ -65,7 +220,16 @@ func (s *MemoryUserStore) CreateDriver(_ context.Context, profile *lastmilev1.Dr
 	if _, exists := s.drivers[profile.DriverId]; exists {
 		return ErrAlreadyExists
 	}
+	if err := s.checkVehicle(profile.DriverId, heldVehicle(profile)); err != nil {
+		return err
+	}
+	owner := driverOwner(profile.DriverId)
+	if err := s.claimPhone(owner, "", profile.Phone); err != nil {
+		return err
+	}
+	s.claimVehicle(profile.DriverId, "", heldVehicle(profile))
 	s.drivers[profile.DriverId] = cloneDriverProfile(profile)
+	s.driverIDs.add(profile.DriverId)
 	return nil
 }
 
@@ -76,31 +240,266 @@ func (s *MemoryUserStore) GetDriver(_ context.Context, driverID string) (*lastmi
 	s.mu.RLock()
 	profile, ok := s.drivers[driverID]
 	s.mu.RUnlock()
-	if !ok {
+	if !ok || profile.DeletedAt != nil {
 		return nil, ErrNotFound
 	}
 	return cloneDriverProfile(profile), nil
 }
 
+func (s *MemoryUserStore) GetDriverByPhone(_ context.Context, phone string) (*lastmilev1.DriverProfile, error) {
+	if phone == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	driverID, ok := strings.CutPrefix(s.phones[phone], driverOwnerPrefix)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneDriverProfile(s.drivers[driverID]), nil
+}
+
+func (s *MemoryUserStore) GetDriverByVehicle(_ context.Context, vehicleID string) (*lastmilev1.DriverProfile, error) {
+	if vehicleID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	driverID, ok := s.vehicles[vehicleID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneDriverProfile(s.drivers[driverID]), nil
+}
+
+func (s *MemoryUserStore) UpdateDriver(_ context.Context, profile *lastmilev1.DriverProfile) error {
+	if profile == nil || profile.DriverId == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.drivers[profile.DriverId]
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	updated := editDriver(existing, profile)
+	if err := s.checkVehicle(profile.DriverId, heldVehicle(updated)); err != nil {
+		return err
+	}
+	if err := s.claimPhone(driverOwner(profile.DriverId), existing.Phone, profile.Phone); err != nil {
+		return err
+	}
+	s.claimVehicle(profile.DriverId, heldVehicle(existing), heldVehicle(updated))
+	s.drivers[profile.DriverId] = updated
+	return nil
+}
+
+func (s *MemoryUserStore) UpdateDriverVerification(_ context.Context, profile *lastmilev1.DriverProfile, from lastmilev1.DriverStatus) error {
+	if profile == nil || profile.DriverId == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.drivers[profile.DriverId]
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if existing.Status != from {
+		return ErrStatusChanged
+	}
+	updated := verifyDriver(existing, profile)
+	if err := s.checkVehicle(profile.DriverId, heldVehicle(updated)); err != nil {
+		return err
+	}
+	s.claimVehicle(profile.DriverId, heldVehicle(existing), heldVehicle(updated))
+	s.drivers[profile.DriverId] = updated
+	return nil
+}
+
+func (s *MemoryUserStore) AddDriverRating(_ context.Context, driverID string, stars int32) error {
+	return s.changeDriver(driverID, func(profile *lastmilev1.DriverProfile) {
+		addRating(&profile.RatingAverage, &profile.RatingCount, stars)
+	})
+}
+
+func (s *MemoryUserStore) AddDriverCancellation(_ context.Context, driverID, tripID string, penalty float64) error {
+	if tripID == "" {
+		return ErrInvalidArgument
+	}
+	return s.changeDriver(driverID, func(profile *lastmilev1.DriverProfile) {
+		if key := "driver_cancellation:" + tripID; !s.counted[key] {
+			s.counted[key] = true
+			addCancellation(profile, penalty)
+		}
+	})
+}
+
+func (s *MemoryUserStore) changeDriver(driverID string, change func(*lastmilev1.DriverProfile)) error {
+	if driverID == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profile, ok := s.drivers[driverID]
+	if !ok || profile.DeletedAt != nil {
+		return ErrNotFound
+	}
+	change(profile)
+	return nil
+}
+
+func (s *MemoryUserStore) DeleteDriver(_ context.Context, driverID string, deletedAt time.Time) error {
+	if driverID == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.drivers[driverID]
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	s.releasePhone(driverOwner(driverID), existing.Phone)
+	s.claimVehicle(driverID, heldVehicle(existing), "")
+	existing.DeletedAt = timestamppb.New(deletedAt)
+	return nil
+}
+
+func (s *MemoryUserStore) ListDrivers(_ context.Context, filter UserFilter, after string, limit int) ([]*lastmilev1.DriverProfile, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page := newKeysetPage[*lastmilev1.DriverProfile](limit)
+	for _, id := range s.driverIDs.after(after) {
+		profile := s.drivers[id]
+		if profile.DeletedAt != nil || !matchesUserQuery(filter.Query, profile.Name, profile.Phone) {
+			continue
+		}
+		if !page.add(id, cloneDriverProfile(profile)) {
+			break
+		}
+	}
+	return page.items, page.next, nil
+}
+
+func (s *MemoryUserStore) claimPhone(owner, oldPhone, newPhone string) error {
+	if newPhone == oldPhone {
+		return nil
+	}
+	if current, taken := s.phones[newPhone]; taken && current != owner {
+		return ErrPhoneInUse
+	}
+	s.releasePhone(owner, oldPhone)
+	if newPhone != "" {
+		s.phones[newPhone] = owner
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) releasePhone(owner, phone string) {
+	if phone != "" && s.phones[phone] == owner {
+		delete(s.phones, phone)
+	}
+}
+
+func (s *MemoryUserStore) checkVehicle(driverID, vehicleID string) error {
+	if current, taken := s.vehicles[vehicleID]; vehicleID != "" && taken && current != driverID {
+		return ErrVehicleInUse
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) claimVehicle(driverID, oldVehicle, newVehicle string) {
+	if oldVehicle != "" && s.vehicles[oldVehicle] == driverID {
+		delete(s.vehicles, oldVehicle)
+	}
+	if newVehicle != "" {
+		s.vehicles[newVehicle] = driverID
+	}
+}
+
+// heldVehicle is the vehicle a driver keeps from other drivers: deleted and
+// deactivated drivers hold none.
+func heldVehicle(profile *lastmilev1.DriverProfile) string {
+	if profile.DeletedAt != nil || profile.Status == lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED {
+		return ""
+	}
+	return profile.VehicleId
+}
+
+const (
+	riderOwnerPrefix  = "rider:"
+	driverOwnerPrefix = "driver:"
+)
+
+func riderOwner(riderID string) string {
+	return riderOwnerPrefix + riderID
+}
+
+func driverOwner(driverID string) string {
+	return driverOwnerPrefix + driverID
+}
+
+func keepRiderCounters(profile, current *lastmilev1.RiderProfile) {
+	profile.RatingAverage = current.RatingAverage
+	profile.RatingCount = current.RatingCount
+	profile.NoShowCount = current.NoShowCount
+}
+
+// editDriver returns current with the fields a profile edit may change taken
+// from profile.
+func editDriver(current, profile *lastmilev1.DriverProfile) *lastmilev1.DriverProfile {
+	updated := cloneDriverProfile(current)
+	updated.Name = profile.Name
+	updated.Phone = profile.Phone
+	updated.VehicleId = profile.VehicleId
+	return updated
+}
+
+// verifyDriver returns current with its verification state taken from
+// profile.
+func verifyDriver(current, profile *lastmilev1.DriverProfile) *lastmilev1.DriverProfile {
+	updated := cloneDriverProfile(current)
+	verified := cloneDriverProfile(profile)
+	updated.Status = verified.Status
+	updated.StatusReason = verified.StatusReason
+	updated.StatusUpdatedAt = verified.StatusUpdatedAt
+	updated.Documents = verified.Documents
+	return updated
+}
+
+func addRating(average *float64, count *int32, stars int32) {
+	*count++
+	*average += (float64(stars) - *average) / float64(*count)
+}
+
+func addCancellation(profile *lastmilev1.DriverProfile, penalty float64) {
+	if profile.CancellationCount == 0 {
+		profile.ReliabilityScore = MaxReliability
+	}
+	profile.CancellationCount++
+	profile.ReliabilityScore = max(profile.ReliabilityScore-penalty, 0)
+}
+
+func matchesUserQuery(query, name, phone string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(name), query) || strings.Contains(phone, query)
+}
+
 func cloneRiderProfile(profile *lastmilev1.RiderProfile) *lastmilev1.RiderProfile {
 	if profile == nil {
 		return nil
 	}
-	return &lastmilev1.RiderProfile{
-		RiderId: profile.RiderId,
-		Name:    profile.Name,
-		Phone:   profile.Phone,
-	}
+	return proto.Clone(profile).(*lastmilev1.RiderProfile)
 }
 
 func cloneDriverProfile(profile *lastmilev1.DriverProfile) *lastmilev1.DriverProfile {
 	if profile == nil {
 		return nil
 	}
-	return &lastmilev1.DriverProfile{
-		DriverId:  profile.DriverId,
-		Name:      profile.Name,
-		Phone:     profile.Phone,
-		VehicleId: profile.VehicleId,
-	}
+	return proto.Clone(profile).(*lastmilev1.DriverProfile)
 }
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+func TestMemoryDriverVehicleHeldByOneActiveDriver(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryUserStore()
+	if err := store.CreateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d1", VehicleId: "v1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.CreateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d2", VehicleId: "v1"}); !errors.Is(err, ErrVehicleInUse) {
+		t.Fatalf("expected ErrVehicleInUse, got %v", err)
+	}
+	if err := store.CreateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d2", VehicleId: "v2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.UpdateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d2", VehicleId: "v1"}); !errors.Is(err, ErrVehicleInUse) {
+		t.Fatalf("expected ErrVehicleInUse, got %v", err)
+	}
+
+	// Deactivating d1 frees v1 for d2, which gives up v2.
+	deactivated := &lastmilev1.DriverProfile{DriverId: "d1", Status: lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED}
+	if err := store.UpdateDriverVerification(ctx, deactivated, lastmilev1.DriverStatus_DRIVER_STATUS_UNSPECIFIED); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.UpdateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d2", VehicleId: "v1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if driver, err := store.GetDriverByVehicle(ctx, "v1"); err != nil || driver.DriverId != "d2" {
+		t.Fatalf("expected d2 to hold v1, got %v, %v", driver, err)
+	}
+	if err := store.DeleteDriver(ctx, "d2", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, vehicleID := range []string{"v1", "v2"} {
+		if _, err := store.GetDriverByVehicle(ctx, vehicleID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected %s to be free, got %v", vehicleID, err)
+		}
+	}
+}
+
+func TestMemoryDriverEditsAndVerificationDoNotOverwriteEachOther(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryUserStore()
+	if err := store.CreateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d1", Name: "Dev", Status: lastmilev1.DriverStatus_DRIVER_STATUS_PENDING_VERIFICATION}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	edit, _ := store.GetDriver(ctx, "d1")
+	review, _ := store.GetDriver(ctx, "d1")
+
+	review.Status = lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE
+	review.Documents = []*lastmilev1.DriverDocument{{Type: lastmilev1.DriverDocumentType_DRIVER_DOCUMENT_TYPE_LICENSE, Number: "L1"}}
+	if err := store.UpdateDriverVerification(ctx, review, lastmilev1.DriverStatus_DRIVER_STATUS_PENDING_VERIFICATION); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// An edit based on the earlier read keeps the approval.
+	edit.Name = "Dev K"
+	if err := store.UpdateDriver(ctx, edit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	driver, _ := store.GetDriver(ctx, "d1")
+	if driver.Name != "Dev K" || driver.Status != lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE || len(driver.Documents) != 1 {
+		t.Fatalf("expected the edit and the approval to both apply, got %v", driver)
+	}
+
+	// A second reviewer acting on the pending status is refused.
+	stale := &lastmilev1.DriverProfile{DriverId: "d1", Status: lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED}
+	if err := store.UpdateDriverVerification(ctx, stale, lastmilev1.DriverStatus_DRIVER_STATUS_PENDING_VERIFICATION); !errors.Is(err, ErrStatusChanged) {
+		t.Fatalf("expected ErrStatusChanged, got %v", err)
+	}
+}
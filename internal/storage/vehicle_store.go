@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type VehicleStore interface {
+	CreateVehicle(ctx context.Context, vehicle *lastmilev1.Vehicle) error
+	GetVehicle(ctx context.Context, vehicleID string) (*lastmilev1.Vehicle, error)
+	UpdateVehicle(ctx context.Context, vehicle *lastmilev1.Vehicle) error
+	DeleteVehicle(ctx context.Context, vehicleID string) error
+	ListVehicles(ctx context.Context, after string, limit int) ([]*lastmilev1.Vehicle, string, error)
+}
+
+type MemoryVehicleStore struct {
+	mu       sync.RWMutex
+	vehicles map[string]*lastmilev1.Vehicle
+	plates   map[string]string
+	ids      sortedIDs
+}
+
+func NewMemoryVehicleStore() *MemoryVehicleStore {
+	return &MemoryVehicleStore{
+		vehicles: make(map[string]*lastmilev1.Vehicle),
+		plates:   make(map[string]string),
+	}
+}
+
+func (s *MemoryVehicleStore) CreateVehicle(_ context.Context, vehicle *lastmilev1.Vehicle) error {
+	if vehicle == nil || vehicle.VehicleId == "" || vehicle.Plate == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.vehicles[vehicle.VehicleId]; exists {
+		return ErrAlreadyExists
+	}
+	if _, taken := s.plates[vehicle.Plate]; taken {
+		return ErrPlateInUse
+	}
+	s.vehicles[vehicle.VehicleId] = cloneVehicle(vehicle)
+	s.plates[vehicle.Plate] = vehicle.VehicleId
+	s.ids.add(vehicle.VehicleId)
+	return nil
+}
+
+func (s *MemoryVehicleStore) GetVehicle(_ context.Context, vehicleID string) (*lastmilev1.Vehicle, error) {
+	if vehicleID == "" {
+		return nil, ErrInvalidArgument
+	}
+	s.mu.RLock()
+	vehicle, ok := s.vehicles[vehicleID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneVehicle(vehicle), nil
+}
+
+func (s *MemoryVehicleStore) UpdateVehicle(_ context.Context, vehicle *lastmilev1.Vehicle) error {
+	if vehicle == nil || vehicle.VehicleId == "" || vehicle.Plate == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.vehicles[vehicle.VehicleId]
+	if !ok {
+		return ErrNotFound
+	}
+	if owner, taken := s.plates[vehicle.Plate]; taken && owner != vehicle.VehicleId {
+		return ErrPlateInUse
+	}
+	delete(s.plates, existing.Plate)
+	s.vehicles[vehicle.VehicleId] = cloneVehicle(vehicle)
+	s.plates[vehicle.Plate] = vehicle.VehicleId
+	return nil
+}
+
+func (s *MemoryVehicleStore) DeleteVehicle(_ context.Context, vehicleID string) error {
+	if vehicleID == "" {
+		return ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.vehicles[vehicleID]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.plates, existing.Plate)
+	delete(s.vehicles, vehicleID)
+	s.ids.remove(vehicleID)
+	return nil
+}
+
+func (s *MemoryVehicleStore) ListVehicles(_ context.Context, after string, limit int) ([]*lastmilev1.Vehicle, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidArgument
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page := newKeysetPage[*lastmilev1.Vehicle](limit)
+	for _, id := range s.ids.after(after) {
+		if !page.add(id, cloneVehicle(s.vehicles[id])) {
+			break
+		}
+	}
+	return page.items, page.next, nil
+}
+
+func cloneVehicle(vehicle *lastmilev1.Vehicle) *lastmilev1.Vehicle {
+	if vehicle == nil {
+		return nil
+	}
+	return proto.Clone(vehicle).(*lastmilev1.Vehicle)
+}
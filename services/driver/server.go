@@ -1,11 +1,110 @@
 package driver
 
-import lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
 
 type Server struct {
 	lastmilev1.UnimplementedDriverServiceServer
+	drivers  storage.DriverStore
+	vehicles storage.VehicleStore
+	seats    storage.SeatStore
+	shifts   storage.ShiftStore
+
+	inactivityTimeout time.Duration
+}
+
+type Stores struct {
+	Drivers  storage.DriverStore
+	Vehicles storage.VehicleStore
+	Seats    storage.SeatStore
+	Shifts   storage.ShiftStore
+
+	// InactivityTimeout is how long a driver may go without a location ping
+	// before being taken offline. Defaults to five minutes.
+	InactivityTimeout time.Duration
 }
 
 func NewServer() *Server {
-	return &Server{}
+	return NewServerWithStores(Stores{})
+}
+
+func NewServerWithStores(stores Stores) *Server {
+	if stores.Drivers == nil {
+		stores.Drivers = storage.NewMemoryUserStore()
+	}
+	if stores.Vehicles == nil {
+		stores.Vehicles = storage.NewMemoryVehicleStore()
+	}
+	if stores.Seats == nil {
+		stores.Seats = storage.NewMemorySeatStore()
+	}
+	if stores.Shifts == nil {
+		stores.Shifts = storage.NewMemoryShiftStore()
+	}
+	if stores.InactivityTimeout <= 0 {
+		stores.InactivityTimeout = defaultInactivityTimeout
+	}
+	return &Server{
+		drivers:           stores.Drivers,
+		vehicles:          stores.Vehicles,
+		seats:             stores.Seats,
+		shifts:            stores.Shifts,
+		inactivityTimeout: stores.InactivityTimeout,
+	}
+}
+
+func (s *Server) UpdateSeatAvailability(ctx context.Context, req *lastmilev1.UpdateSeatAvailabilityRequest) (*lastmilev1.UpdateSeatAvailabilityResponse, error) {
+	if req == nil || strings.TrimSpace(req.DriverId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	if req.Availability == nil {
+		return nil, status.Error(codes.InvalidArgument, "availability is required")
+	}
+	driverID := strings.TrimSpace(req.DriverId)
+	if id := strings.TrimSpace(req.Availability.DriverId); id != "" && id != driverID {
+		return nil, status.Error(codes.InvalidArgument, "availability.driver_id does not match driver_id")
+	}
+	if req.Availability.AvailableSeats < 0 {
+		return nil, status.Error(codes.InvalidArgument, "available_seats must not be negative")
+	}
+
+	driver, err := s.drivers.GetDriver(ctx, driverID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "driver not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	if driver.Status != lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE {
+		return nil, status.Error(codes.FailedPrecondition, "driver is not active")
+	}
+	vehicle, err := s.vehicles.GetVehicle(ctx, driver.VehicleId)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.FailedPrecondition, "driver vehicle is not registered")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+
+	availability := proto.Clone(req.Availability).(*lastmilev1.SeatAvailability)
+	availability.DriverId = driverID
+	availability.AvailableSeats = min(availability.AvailableSeats, vehicle.SeatCapacity)
+	if availability.UpdatedAt == nil {
+		availability.UpdatedAt = timestamppb.Now()
+	}
+	if err := s.seats.UpsertSeats(ctx, availability); err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.UpdateSeatAvailabilityResponse{Availability: availability}, nil
 }
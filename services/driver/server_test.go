@@ -0,0 +1,240 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestUpdateSeatAvailabilityCappedAtCapacity(t *testing.T) {
+	ctx := context.Background()
+	users := storage.NewMemoryUserStore()
+	vehicles := storage.NewMemoryVehicleStore()
+	seats := storage.NewMemorySeatStore()
+	server := NewServerWithStores(Stores{Drivers: users, Vehicles: vehicles, Seats: seats})
+
+	if err := vehicles.CreateVehicle(ctx, &lastmilev1.Vehicle{
+		VehicleId:    "v1",
+		Plate:        "KA01AB1234",
+		Type:         lastmilev1.VehicleType_VEHICLE_TYPE_E_RICKSHAW,
+		SeatCapacity: 3,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := vehicles.CreateVehicle(ctx, &lastmilev1.Vehicle{
+		VehicleId:    "v3",
+		Plate:        "KA01AB1235",
+		Type:         lastmilev1.VehicleType_VEHICLE_TYPE_E_RICKSHAW,
+		SeatCapacity: 3,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := users.CreateDriver(ctx, &lastmilev1.DriverProfile{
+		DriverId:  "d1",
+		Name:      "Dev",
+		VehicleId: "v1",
+		Status:    lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := users.CreateDriver(ctx, &lastmilev1.DriverProfile{
+		DriverId:  "d3",
+		Name:      "Dara",
+		VehicleId: "v3",
+		Status:    lastmilev1.DriverStatus_DRIVER_STATUS_PENDING_VERIFICATION,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := users.CreateDriver(ctx, &lastmilev1.DriverProfile{
+		DriverId:  "d2",
+		Name:      "Devi",
+		VehicleId: "unregistered",
+		Status:    lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := server.UpdateSeatAvailability(ctx, &lastmilev1.UpdateSeatAvailabilityRequest{
+		DriverId:     "d1",
+		Availability: &lastmilev1.SeatAvailability{AvailableSeats: 8},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Availability.AvailableSeats != 3 || resp.Availability.DriverId != "d1" {
+		t.Fatalf("expected seats capped at 3 for d1, got %v", resp.Availability)
+	}
+	stored, err := seats.GetSeats(ctx, "d1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored.AvailableSeats != 3 {
+		t.Fatalf("expected stored seats 3, got %d", stored.AvailableSeats)
+	}
+
+	_, err = server.UpdateSeatAvailability(ctx, &lastmilev1.UpdateSeatAvailabilityRequest{
+		DriverId:     "d1",
+		Availability: &lastmilev1.SeatAvailability{AvailableSeats: -1},
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	_, err = server.UpdateSeatAvailability(ctx, &lastmilev1.UpdateSeatAvailabilityRequest{
+		DriverId:     "d2",
+		Availability: &lastmilev1.SeatAvailability{AvailableSeats: 1},
+	})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	_, err = server.UpdateSeatAvailability(ctx, &lastmilev1.UpdateSeatAvailabilityRequest{
+		DriverId:     "d3",
+		Availability: &lastmilev1.SeatAvailability{AvailableSeats: 1},
+	})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	_, err = server.UpdateSeatAvailability(ctx, &lastmilev1.UpdateSeatAvailabilityRequest{
+		DriverId:     "missing",
+		Availability: &lastmilev1.SeatAvailability{AvailableSeats: 1},
+	})
+	assertStatusCode(t, err, codes.NotFound)
+}
+
+func assertStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error with code %s", code.String())
+	}
+	statusErr, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if statusErr.Code() != code {
+		t.Fatalf("expected code %s, got %s", code.String(), statusErr.Code().String())
+	}
+}
+
+func TestShiftLifecycleAndReport(t *testing.T) {
+	ctx := context.Background()
+	users := storage.NewMemoryUserStore()
+	shifts := storage.NewMemoryShiftStore()
+	server := NewServerWithStores(Stores{Drivers: users, Shifts: shifts, InactivityTimeout: 5 * time.Minute})
+	for _, profile := range []*lastmilev1.DriverProfile{
+		{DriverId: "d1", Name: "Dev", Status: lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE},
+		{DriverId: "d2", Name: "Devi", Status: lastmilev1.DriverStatus_DRIVER_STATUS_SUSPENDED},
+	} {
+		if err := users.CreateDriver(ctx, profile); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	_, err := server.GoOnline(ctx, &lastmilev1.GoOnlineRequest{DriverId: "d2"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	_, err = server.GoOffline(ctx, &lastmilev1.GoOfflineRequest{DriverId: "d1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	online, err := server.GoOnline(ctx, &lastmilev1.GoOnlineRequest{DriverId: "d1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.GoOnline(ctx, &lastmilev1.GoOnlineRequest{DriverId: "d1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	offline, err := server.GoOffline(ctx, &lastmilev1.GoOfflineRequest{DriverId: "d1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if offline.Shift.ShiftId != online.Shift.ShiftId || offline.Shift.EndReason != lastmilev1.ShiftEndReason_SHIFT_END_REASON_DRIVER {
+		t.Fatalf("unexpected ended shift: %v", offline.Shift)
+	}
+
+	start := time.Now().Add(-3 * time.Hour)
+	if err := shifts.StartShift(ctx, &lastmilev1.DriverShift{ShiftId: "old", DriverId: "d1", StartedAt: timestamppb.New(start)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := shifts.EndShift(ctx, "d1", start.Add(2*time.Hour), lastmilev1.ShiftEndReason_SHIFT_END_REASON_DRIVER); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report, err := server.GetShiftReport(ctx, &lastmilev1.GetShiftReportRequest{
+		DriverId:  "d1",
+		StartTime: timestamppb.New(start.Add(time.Hour)),
+		EndTime:   timestamppb.New(start.Add(90 * time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Shifts) != 1 || report.Shifts[0].ShiftId != "old" {
+		t.Fatalf("expected only the overlapping shift, got %v", report.Shifts)
+	}
+	if got := report.TotalOnlineDuration.AsDuration(); got != 30*time.Minute {
+		t.Fatalf("expected 30m clipped to window, got %s", got)
+	}
+	if report.Online {
+		t.Fatalf("expected driver to be offline")
+	}
+
+	report, err = server.GetShiftReport(ctx, &lastmilev1.GetShiftReportRequest{DriverId: "d1", PageSize: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Shifts) != 1 || report.NextPageToken == "" {
+		t.Fatalf("expected a paged report, got %v", report)
+	}
+	if got := report.TotalOnlineDuration.AsDuration(); got < 2*time.Hour {
+		t.Fatalf("expected total to cover all shifts, got %s", got)
+	}
+}
+
+func TestCloseInactiveShifts(t *testing.T) {
+	ctx := context.Background()
+	shifts := storage.NewMemoryShiftStore()
+	server := NewServerWithStores(Stores{Shifts: shifts, InactivityTimeout: 5 * time.Minute})
+	now := time.Now()
+	for _, driverID := range []string{"d1", "d2"} {
+		if err := shifts.StartShift(ctx, &lastmilev1.DriverShift{
+			ShiftId:   "shift-" + driverID,
+			DriverId:  driverID,
+			StartedAt: timestamppb.New(now.Add(-time.Hour)),
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	lastPing := now.Add(-10 * time.Minute)
+	for driverID, observedAt := range map[string]time.Time{"d1": lastPing, "d2": now.Add(-time.Minute)} {
+		event, err := events.New(events.TypeDriverLocationUpdated, &lastmilev1.LocationUpdate{
+			DriverId:   driverID,
+			Location:   &lastmilev1.LatLng{Latitude: 12.97, Longitude: 77.59},
+			ObservedAt: timestamppb.New(observedAt),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := server.HandleEvent(ctx, event); err != nil {
+			t.Fatalf("unexpected handler error: %v", err)
+		}
+	}
+
+	closed, err := server.CloseInactiveShifts(ctx, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if closed != 1 {
+		t.Fatalf("expected one shift closed, got %d", closed)
+	}
+	history, _, err := shifts.ListShifts(ctx, storage.ShiftFilter{DriverID: "d1"}, "", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ended := history[0]
+	if ended.EndReason != lastmilev1.ShiftEndReason_SHIFT_END_REASON_INACTIVITY || !ended.EndedAt.AsTime().Equal(lastPing) {
+		t.Fatalf("expected shift ended at last ping for inactivity, got %v", ended)
+	}
+	if _, err := shifts.GetOpenShift(ctx, "d2"); err != nil {
+		t.Fatalf("expected d2 to stay online: %v", err)
+	}
+}
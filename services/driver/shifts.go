@@ -0,0 +1,301 @@
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const defaultInactivityTimeout = 5 * time.Minute
+
+func (s *Server) GoOnline(ctx context.Context, req *lastmilev1.GoOnlineRequest) (*lastmilev1.GoOnlineResponse, error) {
+	if req == nil || strings.TrimSpace(req.DriverId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	driverID := strings.TrimSpace(req.DriverId)
+	driver, err := s.drivers.GetDriver(ctx, driverID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "driver not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	if driver.Status != lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE {
+		return nil, status.Error(codes.FailedPrecondition, "driver is not active")
+	}
+
+	now := timestamppb.Now()
+	shift := &lastmilev1.DriverShift{
+		ShiftId:    newID("shift"),
+		DriverId:   driverID,
+		StartedAt:  now,
+		LastPingAt: now,
+	}
+	if err := s.shifts.StartShift(ctx, shift); err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			return nil, status.Error(codes.FailedPrecondition, "driver is already online")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.GoOnlineResponse{Shift: shift}, nil
+}
+
+func (s *Server) GoOffline(ctx context.Context, req *lastmilev1.GoOfflineRequest) (*lastmilev1.GoOfflineResponse, error) {
+	if req == nil || strings.TrimSpace(req.DriverId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	shift, err := s.shifts.EndShift(ctx, strings.TrimSpace(req.DriverId), time.Now(), lastmilev1.ShiftEndReason_SHIFT_END_REASON_DRIVER)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.FailedPrecondition, "driver is not online")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.GoOfflineResponse{Shift: shift}, nil
+}
+
+// GetShiftReport lists the driver's shifts that overlap the requested window,
+// newest first, and totals their online time clipped to that window. An open
+// shift counts up to now.
+func (s *Server) GetShiftReport(ctx context.Context, req *lastmilev1.GetShiftReportRequest) (*lastmilev1.GetShiftReportResponse, error) {
+	if req == nil || strings.TrimSpace(req.DriverId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	driverID := strings.TrimSpace(req.DriverId)
+	filter := pagetoken.FilterHash("shifts", driverID, timestampKey(req.StartTime), timestampKey(req.EndTime))
+	after, limit, err := pageParams(req.PageSize, req.PageToken, filter)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var windowStart time.Time
+	windowEnd := now
+	if req.StartTime != nil {
+		if !req.StartTime.IsValid() {
+			return nil, status.Error(codes.InvalidArgument, "start_time is invalid")
+		}
+		windowStart = req.StartTime.AsTime()
+	}
+	if req.EndTime != nil {
+		if !req.EndTime.IsValid() {
+			return nil, status.Error(codes.InvalidArgument, "end_time is invalid")
+		}
+		windowEnd = req.EndTime.AsTime()
+	}
+	if !windowEnd.After(windowStart) {
+		return nil, status.Error(codes.InvalidArgument, "end_time must be after start_time")
+	}
+
+	if _, err := s.drivers.GetDriver(ctx, driverID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "driver not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+
+	// A driver's shifts do not overlap, so walking back from the end of the
+	// window stops at the first shift that ended before it began.
+	var matched []*lastmilev1.DriverShift
+	var total time.Duration
+	query := storage.ShiftFilter{DriverID: driverID, StartedBefore: windowEnd}
+	for cursor, done := "", false; !done; {
+		shifts, next, err := s.shifts.ListShifts(ctx, query, cursor, 100)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "storage error")
+		}
+		for _, shift := range shifts {
+			start := shift.StartedAt.AsTime()
+			end := now
+			if shift.EndedAt != nil {
+				end = shift.EndedAt.AsTime()
+			}
+			if !end.After(windowStart) {
+				done = true
+				break
+			}
+			start = maxTime(start, windowStart)
+			end = minTime(end, windowEnd)
+			if !end.After(start) {
+				continue
+			}
+			total += end.Sub(start)
+			matched = append(matched, shift)
+		}
+		cursor = next
+		done = done || next == ""
+	}
+	_, err = s.shifts.GetOpenShift(ctx, driverID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	online := err == nil
+
+	resp := &lastmilev1.GetShiftReportResponse{
+		DriverId:            driverID,
+		Online:              online,
+		TotalOnlineDuration: durationpb.New(total),
+	}
+	// Shifts page newest first; the cursor is the start time and id of the
+	// last shift returned, so shifts started in the meantime do not shift
+	// later pages.
+	slices.SortFunc(matched, func(a, b *lastmilev1.DriverShift) int {
+		return strings.Compare(shiftCursorKey(b), shiftCursorKey(a))
+	})
+	first := 0
+	if after != "" {
+		first = len(matched)
+		for i, shift := range matched {
+			if shiftCursorKey(shift) < after {
+				first = i
+				break
+			}
+		}
+	}
+	end := min(first+limit, len(matched))
+	resp.Shifts = matched[first:end]
+	if end < len(matched) {
+		resp.NextPageToken = pagetoken.Encode(shiftCursorKey(matched[end-1]), filter)
+	}
+	return resp, nil
+}
+
+// HandleEvent keeps the open shift alive while the driver keeps sending
+// location pings.
+func (s *Server) HandleEvent(ctx context.Context, event *lastmilev1.Event) error {
+	if event.GetType() != events.TypeDriverLocationUpdated {
+		return nil
+	}
+	var update lastmilev1.LocationUpdate
+	if err := event.GetPayload().UnmarshalTo(&update); err != nil {
+		return err
+	}
+	pingAt := time.Now()
+	if update.ObservedAt != nil && update.ObservedAt.AsTime().Before(pingAt) {
+		pingAt = update.ObservedAt.AsTime()
+	}
+	err := s.shifts.TouchShift(ctx, update.DriverId, pingAt)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidArgument) {
+		return nil
+	}
+	return err
+}
+
+// CloseInactiveShifts takes drivers offline whose last location ping (or shift
+// start) is older than the inactivity timeout. The shift ends at the last
+// activity so the report does not count the silent period.
+func (s *Server) CloseInactiveShifts(ctx context.Context, now time.Time) (int, error) {
+	open, err := s.shifts.ListOpenShifts(ctx)
+	if err != nil {
+		return 0, err
+	}
+	closed := 0
+	for _, shift := range open {
+		lastActive := shift.StartedAt.AsTime()
+		if shift.LastPingAt != nil {
+			lastActive = maxTime(lastActive, shift.LastPingAt.AsTime())
+		}
+		if now.Sub(lastActive) < s.inactivityTimeout {
+			continue
+		}
+		_, err := s.shifts.EndShift(ctx, shift.DriverId, lastActive, lastmilev1.ShiftEndReason_SHIFT_END_REASON_INACTIVITY)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			return closed, err
+		}
+		closed++
+	}
+	return closed, nil
+}
+
+func (s *Server) RunInactivityChecks(ctx context.Context) error {
+	interval := min(s.inactivityTimeout/2, time.Minute)
+	logger := observability.Logger()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		closed, err := s.CloseInactiveShifts(ctx, time.Now())
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error().Err(err).Int("closed", closed).Msg("inactivity check failed")
+		} else if closed > 0 {
+			logger.Info().Int("closed", closed).Msg("took inactive drivers offline")
+		}
+	}
+}
+
+func pageParams(pageSize int32, pageToken, filter string) (string, int, error) {
+	if pageSize < 0 {
+		return "", 0, status.Error(codes.InvalidArgument, "page_size must be positive")
+	}
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	after := ""
+	if pageToken != "" {
+		key, err := pagetoken.Decode(pageToken, filter)
+		if err != nil {
+			return "", 0, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = key
+	}
+	return after, int(pageSize), nil
+}
+
+// shiftCursorKey orders shifts by start time, then id, as a sortable string.
+func shiftCursorKey(shift *lastmilev1.DriverShift) string {
+	return fmt.Sprintf("%020d/%s", shift.StartedAt.AsTime().UnixNano(), shift.ShiftId)
+}
+
+func timestampKey(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.AsTime().Format(time.RFC3339Nano)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func newID(prefix string) string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return prefix + "_" + hex.EncodeToString(buf)
+}
@@ -0,0 +1,182 @@
+package eta
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultSpeedKmh is used when the server is built without an estimator.
+const defaultSpeedKmh = 20
+
+type Server struct {
+	lastmilev1.UnimplementedEtaServiceServer
+	locations    storage.LocationStore
+	stations     storage.StationStore
+	destinations storage.DestinationStore
+	drivers      storage.DriverStore
+	vehicles     storage.VehicleStore
+	estimator    eta.Estimator
+	now          func() time.Time
+}
+
+type Stores struct {
+	Locations    storage.LocationStore
+	Stations     storage.StationStore
+	Destinations storage.DestinationStore
+	// Drivers and Vehicles give the driver's vehicle type when the request
+	// does not name one.
+	Drivers  storage.DriverStore
+	Vehicles storage.VehicleStore
+	// Estimator defaults to straight-line estimates at 20 km/h.
+	Estimator eta.Estimator
+}
+
+func NewServer() *Server {
+	return NewServerWithStores(Stores{})
+}
+
+func NewServerWithStores(stores Stores) *Server {
+	if stores.Locations == nil {
+		stores.Locations = storage.NewMemoryLocationStore()
+	}
+	if stores.Stations == nil {
+		stores.Stations = storage.NewMemoryStationStore()
+	}
+	if stores.Destinations == nil {
+		stores.Destinations = storage.NewMemoryDestinationStore()
+	}
+	if stores.Drivers == nil {
+		stores.Drivers = storage.NewMemoryUserStore()
+	}
+	if stores.Vehicles == nil {
+		stores.Vehicles = storage.NewMemoryVehicleStore()
+	}
+	if stores.Estimator == nil {
+		stores.Estimator = eta.Haversine{Profile: eta.Profile{DefaultKmh: defaultSpeedKmh}}
+	}
+	return &Server{
+		locations:    stores.Locations,
+		stations:     stores.Stations,
+		destinations: stores.Destinations,
+		drivers:      stores.Drivers,
+		vehicles:     stores.Vehicles,
+		estimator:    stores.Estimator,
+		now:          time.Now,
+	}
+}
+
+func (s *Server) GetEta(ctx context.Context, req *lastmilev1.GetEtaRequest) (*lastmilev1.GetEtaResponse, error) {
+	if req == nil || strings.TrimSpace(req.StationId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	driverID := strings.TrimSpace(req.DriverId)
+	destinationID := strings.TrimSpace(req.DestinationId)
+	if driverID == "" && destinationID == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id or destination_id is required")
+	}
+	if req.DepartureTime != nil && !req.DepartureTime.IsValid() {
+		return nil, status.Error(codes.InvalidArgument, "departure_time is invalid")
+	}
+
+	station, err := s.stations.Get(ctx, strings.TrimSpace(req.StationId))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "station not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	if station.Location == nil {
+		return nil, status.Error(codes.FailedPrecondition, "station has no location")
+	}
+	vehicle := req.VehicleType
+	if vehicle == lastmilev1.VehicleType_VEHICLE_TYPE_UNSPECIFIED && driverID != "" {
+		if vehicle, err = s.vehicleType(ctx, driverID); err != nil {
+			return nil, err
+		}
+	}
+	resp := &lastmilev1.GetEtaResponse{VehicleType: vehicle}
+
+	now := s.now()
+	departure := now
+	if driverID != "" {
+		location, err := s.locations.GetLocation(ctx, driverID)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, status.Error(codes.NotFound, "driver location not found")
+			}
+			return nil, status.Error(codes.Internal, "storage error")
+		}
+		if location.Location == nil {
+			return nil, status.Error(codes.NotFound, "driver location not found")
+		}
+		estimate, err := s.estimator.Estimate(ctx, location.Location, station.Location, vehicle, now)
+		if err != nil {
+			return nil, s.unavailable(err)
+		}
+		resp.DriverLocation = location
+		resp.ToStation = newEta(estimate, now)
+		departure = now.Add(estimate.Duration)
+	}
+	if destinationID != "" {
+		destination, err := s.destinations.Get(ctx, destinationID)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, status.Error(codes.NotFound, "destination not found")
+			}
+			return nil, status.Error(codes.Internal, "storage error")
+		}
+		if destination.Location == nil {
+			return nil, status.Error(codes.FailedPrecondition, "destination has no location")
+		}
+		if req.DepartureTime != nil {
+			departure = req.DepartureTime.AsTime()
+		}
+		estimate, err := s.estimator.Estimate(ctx, station.Location, destination.Location, vehicle, departure)
+		if err != nil {
+			return nil, s.unavailable(err)
+		}
+		resp.ToDestination = newEta(estimate, departure)
+	}
+	return resp, nil
+}
+
+// vehicleType looks up the type of the driver's vehicle. Drivers without a
+// vehicle on file get the default speed.
+func (s *Server) vehicleType(ctx context.Context, driverID string) (lastmilev1.VehicleType, error) {
+	driver, err := s.drivers.GetDriver(ctx, driverID)
+	if err == nil && driver.VehicleId != "" {
+		var vehicle *lastmilev1.Vehicle
+		if vehicle, err = s.vehicles.GetVehicle(ctx, driver.VehicleId); err == nil {
+			return vehicle.Type, nil
+		}
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return 0, status.Error(codes.Internal, "storage error")
+	}
+	return lastmilev1.VehicleType_VEHICLE_TYPE_UNSPECIFIED, nil
+}
+
+func (s *Server) unavailable(err error) error {
+	logger := observability.Logger()
+	logger.Error().Err(err).Msg("eta estimate failed")
+	return status.Error(codes.Unavailable, "eta unavailable")
+}
+
+func newEta(estimate eta.Estimate, departure time.Time) *lastmilev1.Eta {
+	return &lastmilev1.Eta{
+		DistanceMeters:  estimate.DistanceMeters,
+		DurationSeconds: int32(estimate.Duration / time.Second),
+		ArrivalTime:     timestamppb.New(departure.Add(estimate.Duration)),
+		Polyline:        estimate.Polyline,
+	}
+}
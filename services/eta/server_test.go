@@ -0,0 +1,95 @@
+package eta
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetEta(t *testing.T) {
+	ctx := context.Background()
+	locations := storage.NewMemoryLocationStore()
+	stations := storage.NewMemoryStationStore()
+	destinations := storage.NewMemoryDestinationStore()
+	users := storage.NewMemoryUserStore()
+	vehicles := storage.NewMemoryVehicleStore()
+	server := NewServerWithStores(Stores{
+		Locations:    locations,
+		Stations:     stations,
+		Destinations: destinations,
+		Drivers:      users,
+		Vehicles:     vehicles,
+		Estimator: eta.Haversine{Profile: eta.Profile{
+			SpeedsKmh:  map[lastmilev1.VehicleType]float64{lastmilev1.VehicleType_VEHICLE_TYPE_CAB: 36},
+			DefaultKmh: 18,
+		}},
+	})
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+
+	// 0.01 degrees of latitude is about 1112 m.
+	mustOK(t, stations.Upsert(ctx, &lastmilev1.Station{StationId: "s", Location: &lastmilev1.LatLng{Latitude: 12.97, Longitude: 77.59}}))
+	mustOK(t, destinations.Upsert(ctx, &lastmilev1.Destination{DestinationId: "x", Location: &lastmilev1.LatLng{Latitude: 12.99, Longitude: 77.59}}))
+	mustOK(t, vehicles.CreateVehicle(ctx, &lastmilev1.Vehicle{VehicleId: "v", Plate: "KA01", Type: lastmilev1.VehicleType_VEHICLE_TYPE_CAB}))
+	mustOK(t, users.CreateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d", Name: "Dev", VehicleId: "v"}))
+	mustOK(t, locations.UpsertLocation(ctx, &lastmilev1.LocationUpdate{DriverId: "d", Location: &lastmilev1.LatLng{Latitude: 12.96, Longitude: 77.59}}))
+
+	_, err := server.GetEta(ctx, &lastmilev1.GetEtaRequest{StationId: "s"})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = server.GetEta(ctx, &lastmilev1.GetEtaRequest{StationId: "s", DriverId: "unknown"})
+	assertStatusCode(t, err, codes.NotFound)
+
+	resp, err := server.GetEta(ctx, &lastmilev1.GetEtaRequest{StationId: "s", DriverId: "d", DestinationId: "x"})
+	mustOK(t, err)
+	if resp.VehicleType != lastmilev1.VehicleType_VEHICLE_TYPE_CAB {
+		t.Fatalf("expected the driver's cab profile, got %s", resp.VehicleType)
+	}
+	// 1112 m at 36 km/h (10 m/s) is about 111 s.
+	if got := resp.ToStation.DurationSeconds; got < 105 || got > 117 {
+		t.Fatalf("expected about 111s to the station, got %ds", got)
+	}
+	arrived := now.Add(time.Duration(resp.ToStation.DurationSeconds) * time.Second)
+	if !resp.ToStation.ArrivalTime.AsTime().Equal(arrived) {
+		t.Fatalf("expected arrival at %s, got %s", arrived, resp.ToStation.ArrivalTime.AsTime())
+	}
+	if got := resp.ToDestination.DurationSeconds; got < 210 || got > 234 {
+		t.Fatalf("expected about 222s to the destination, got %ds", got)
+	}
+	if !resp.ToDestination.ArrivalTime.AsTime().After(arrived) {
+		t.Fatalf("expected the ride to start once the driver arrives, got %s", resp.ToDestination.ArrivalTime.AsTime())
+	}
+
+	resp, err = server.GetEta(ctx, &lastmilev1.GetEtaRequest{
+		StationId:     "s",
+		DestinationId: "x",
+		VehicleType:   lastmilev1.VehicleType_VEHICLE_TYPE_E_RICKSHAW,
+	})
+	mustOK(t, err)
+	if resp.ToStation != nil {
+		t.Fatalf("expected no driver leg, got %v", resp.ToStation)
+	}
+	// Types without a speed use the default, half the cab speed.
+	if got := resp.ToDestination.DurationSeconds; got < 420 || got > 468 {
+		t.Fatalf("expected about 444s at the default speed, got %ds", got)
+	}
+}
+
+func mustOK(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func assertStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Fatalf("expected %s, got %v", code, err)
+	}
+}
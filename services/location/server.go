@@ -1,11 +1,188 @@
 package location
 
-import lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
 
 type Server struct {
 	lastmilev1.UnimplementedLocationServiceServer
+	locations storage.LocationStore
+	shifts    storage.ShiftStore
+	publisher events.Publisher
 }
 
+const (
+	earthRadiusMeters    = 6371000
+	defaultNearbyRadius  = 2000
+	maxNearbyRadius      = 50000
+	defaultNearbyDrivers = 20
+	maxNearbyDrivers     = 100
+)
+
 func NewServer() *Server {
-	return &Server{}
+	return NewServerWithStores(storage.NewMemoryLocationStore(), storage.NewMemoryShiftStore(), nil)
+}
+
+func NewServerWithStores(locations storage.LocationStore, shifts storage.ShiftStore, publisher events.Publisher) *Server {
+	if locations == nil {
+		locations = storage.NewMemoryLocationStore()
+	}
+	if shifts == nil {
+		shifts = storage.NewMemoryShiftStore()
+	}
+	if publisher == nil {
+		publisher = events.Discard()
+	}
+	return &Server{locations: locations, shifts: shifts, publisher: publisher}
+}
+
+func (s *Server) UpdateDriverLocation(ctx context.Context, req *lastmilev1.UpdateDriverLocationRequest) (*lastmilev1.UpdateDriverLocationResponse, error) {
+	if req == nil || strings.TrimSpace(req.DriverId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	if req.LocationUpdate == nil {
+		return nil, status.Error(codes.InvalidArgument, "location_update is required")
+	}
+	update := proto.Clone(req.LocationUpdate).(*lastmilev1.LocationUpdate)
+	update.DriverId = strings.TrimSpace(req.DriverId)
+	if err := validateLatLng(update.Location); err != nil {
+		return nil, err
+	}
+	if update.ObservedAt == nil {
+		update.ObservedAt = timestamppb.Now()
+	} else if !update.ObservedAt.IsValid() {
+		return nil, status.Error(codes.InvalidArgument, "observed_at is invalid")
+	}
+
+	if err := s.locations.UpsertLocation(ctx, update); err != nil {
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	if err := events.Publish(ctx, s.publisher, events.StreamLocations, events.TypeDriverLocationUpdated, update); err != nil {
+		logger := observability.Logger()
+		logger.Error().Err(err).Str("driver_id", update.DriverId).Msg("publish event failed")
+	}
+
+	return &lastmilev1.UpdateDriverLocationResponse{LocationUpdate: update}, nil
+}
+
+func (s *Server) GetDriverLocation(ctx context.Context, req *lastmilev1.GetDriverLocationRequest) (*lastmilev1.GetDriverLocationResponse, error) {
+	if req == nil || strings.TrimSpace(req.DriverId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+
+	update, err := s.locations.GetLocation(ctx, strings.TrimSpace(req.DriverId))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "driver location not found")
+		}
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+
+	return &lastmilev1.GetDriverLocationResponse{LocationUpdate: update}, nil
+}
+
+// SearchNearbyDrivers returns the last known location of online drivers within
+// radius_meters of the given point, closest first.
+func (s *Server) SearchNearbyDrivers(ctx context.Context, req *lastmilev1.SearchNearbyDriversRequest) (*lastmilev1.SearchNearbyDriversResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request is required")
+	}
+	if err := validateLatLng(req.Location); err != nil {
+		return nil, err
+	}
+	radius := req.RadiusMeters
+	if radius < 0 || math.IsNaN(radius) {
+		return nil, status.Error(codes.InvalidArgument, "radius_meters must not be negative")
+	}
+	if radius == 0 {
+		radius = defaultNearbyRadius
+	}
+	radius = math.Min(radius, maxNearbyRadius)
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultNearbyDrivers
+	}
+	limit = min(limit, maxNearbyDrivers)
+
+	open, err := s.shifts.ListOpenShifts(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	online := make(map[string]bool, len(open))
+	for _, shift := range open {
+		online[shift.DriverId] = true
+	}
+	updates, err := s.locations.ListLocations(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+
+	drivers := make([]*lastmilev1.NearbyDriver, 0)
+	for _, update := range updates {
+		if !online[update.DriverId] || update.Location == nil {
+			continue
+		}
+		distance := haversineMeters(req.Location, update.Location)
+		if distance > radius {
+			continue
+		}
+		drivers = append(drivers, &lastmilev1.NearbyDriver{LocationUpdate: update, DistanceMeters: distance})
+	}
+	sort.SliceStable(drivers, func(i, j int) bool {
+		return drivers[i].DistanceMeters < drivers[j].DistanceMeters
+	})
+	if len(drivers) > limit {
+		drivers = drivers[:limit]
+	}
+	return &lastmilev1.SearchNearbyDriversResponse{Drivers: drivers}, nil
+}
+
+func haversineMeters(a, b *lastmilev1.LatLng) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func validateLatLng(latlng *lastmilev1.LatLng) error {
+	if latlng == nil {
+		return status.Error(codes.InvalidArgument, "location is required")
+	}
+	if math.IsNaN(latlng.Latitude) || math.IsNaN(latlng.Longitude) {
+		return status.Error(codes.InvalidArgument, "location has invalid coordinates")
+	}
+	if math.IsInf(latlng.Latitude, 0) || math.IsInf(latlng.Longitude, 0) {
+		return status.Error(codes.InvalidArgument, "location has invalid coordinates")
+	}
+	if latlng.Latitude < -90 || latlng.Latitude > 90 {
+		return status.Error(codes.InvalidArgument, "latitude out of range")
+	}
+	if latlng.Longitude < -180 || latlng.Longitude > 180 {
+		return status.Error(codes.InvalidArgument, "longitude out of range")
+	}
+	return nil
 }
@@ -0,0 +1,79 @@
+package location
+
+import (
+	"context"
+	"testing"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestSearchNearbyDriversSkipsOfflineDrivers(t *testing.T) {
+	ctx := context.Background()
+	shifts := storage.NewMemoryShiftStore()
+	server := NewServerWithStores(storage.NewMemoryLocationStore(), shifts, nil)
+
+	for driverID, location := range map[string]*lastmilev1.LatLng{
+		"near":    {Latitude: 12.9716, Longitude: 77.5946},
+		"far":     {Latitude: 12.9900, Longitude: 77.5946},
+		"offline": {Latitude: 12.9717, Longitude: 77.5946},
+		"distant": {Latitude: 13.2000, Longitude: 77.7000},
+	} {
+		if _, err := server.UpdateDriverLocation(ctx, &lastmilev1.UpdateDriverLocationRequest{
+			DriverId:       driverID,
+			LocationUpdate: &lastmilev1.LocationUpdate{Location: location},
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if driverID == "offline" {
+			continue
+		}
+		if err := shifts.StartShift(ctx, &lastmilev1.DriverShift{
+			ShiftId:   "shift-" + driverID,
+			DriverId:  driverID,
+			StartedAt: timestamppb.Now(),
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	resp, err := server.SearchNearbyDrivers(ctx, &lastmilev1.SearchNearbyDriversRequest{
+		Location:     &lastmilev1.LatLng{Latitude: 12.9716, Longitude: 77.5946},
+		RadiusMeters: 5000,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Drivers) != 2 {
+		t.Fatalf("expected 2 nearby drivers, got %v", resp.Drivers)
+	}
+	if resp.Drivers[0].LocationUpdate.DriverId != "near" || resp.Drivers[1].LocationUpdate.DriverId != "far" {
+		t.Fatalf("expected drivers sorted by distance, got %v", resp.Drivers)
+	}
+	if got := resp.Drivers[1].DistanceMeters; got < 2000 || got > 2100 {
+		t.Fatalf("expected roughly 2km to far driver, got %f", got)
+	}
+
+	_, err = server.SearchNearbyDrivers(ctx, &lastmilev1.SearchNearbyDriversRequest{
+		Location:     &lastmilev1.LatLng{Latitude: 12.9716, Longitude: 77.5946},
+		RadiusMeters: -1,
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+}
+
+func assertStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error with code %s", code.String())
+	}
+	statusErr, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if statusErr.Code() != code {
+		t.Fatalf("expected code %s, got %s", code.String(), statusErr.Code().String())
+	}
+}
@@ -0,0 +1,138 @@
+package matching
+
+import (
+	"context"
+	"errors"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// releaseCanceled cancels the scheduled trip of a request the rider canceled
+// and gives its seats back to the driver.
+func (s *Server) releaseCanceled(ctx context.Context, request *lastmilev1.RideRequest) error {
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_CANCELED {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trips, err := s.trips.ListTrips(ctx, storage.TripFilter{
+		RequestID: request.RequestId,
+		Status:    lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+	})
+	if err != nil || len(trips) == 0 {
+		return err
+	}
+	cancellation := request.Cancellation
+	if cancellation == nil {
+		cancellation = &lastmilev1.Cancellation{
+			CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_RIDER,
+			CanceledAt: timestamppb.Now(),
+		}
+	}
+	return s.cancelTrips(ctx, trips, request.Seats, cancellation)
+}
+
+// requeue puts a request back in the queue after its driver canceled the
+// trip. The trip service has already canceled the trip, so only the seats
+// and the request are reset. It reports false when there is nothing to
+// requeue, e.g. on redelivery after the request was matched again.
+func (s *Server) requeue(ctx context.Context, trip *lastmilev1.Trip) (bool, error) {
+	if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_CANCELED || trip.RequestId == "" ||
+		trip.GetCancellation().GetCanceledBy() != lastmilev1.CancellationParty_CANCELLATION_PARTY_DRIVER {
+		return false, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := s.requests.GetRideRequest(ctx, trip.RequestId)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		return false, nil
+	}
+	scheduled, err := s.trips.ListTrips(ctx, storage.TripFilter{
+		RequestID: request.RequestId,
+		Status:    lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+	})
+	if err != nil || len(scheduled) > 0 {
+		return false, err
+	}
+	if err := s.releaseSeats(ctx, trip.DriverId, request.Seats); err != nil {
+		return false, err
+	}
+	request.Status = lastmilev1.RideStatus_RIDE_STATUS_PENDING
+	statusChanged, err := events.NewOutboxMessage(events.StreamRideRequests, events.TypeRideRequestStatusChanged, request)
+	if err != nil {
+		return false, err
+	}
+	err = s.requests.UpdateRideRequest(ctx, request, lastmilev1.RideStatus_RIDE_STATUS_MATCHED, statusChanged)
+	if errors.Is(err, storage.ErrStatusChanged) {
+		// The rider canceled meanwhile; there is nothing to requeue.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// declinedDrivers lists the drivers who canceled a trip for the request, so
+// it is not matched to them again.
+func (s *Server) declinedDrivers(ctx context.Context, requestID string) (map[string]bool, error) {
+	canceled, err := s.trips.ListTrips(ctx, storage.TripFilter{
+		RequestID: requestID,
+		Status:    lastmilev1.TripStatus_TRIP_STATUS_CANCELED,
+	})
+	if err != nil {
+		return nil, err
+	}
+	declined := make(map[string]bool)
+	for _, trip := range canceled {
+		if trip.GetCancellation().GetCanceledBy() == lastmilev1.CancellationParty_CANCELLATION_PARTY_DRIVER {
+			declined[trip.DriverId] = true
+		}
+	}
+	return declined, nil
+}
+
+func (s *Server) cancelTrips(ctx context.Context, trips []*lastmilev1.Trip, seats uint32, cancellation *lastmilev1.Cancellation) error {
+	now := timestamppb.Now()
+	for _, trip := range trips {
+		trip.Status = lastmilev1.TripStatus_TRIP_STATUS_CANCELED
+		trip.Cancellation = cancellation
+		trip.DropoffPlan = nil
+		trip.UpdatedAt = now
+		canceled, err := events.NewOutboxMessage(events.StreamTrips, events.TypeTripStatusChanged, trip)
+		if err != nil {
+			return err
+		}
+		if err := s.trips.UpdateTrip(ctx, trip, canceled); err != nil {
+			return err
+		}
+		if err := s.releaseSeats(ctx, trip.DriverId, seats); err != nil {
+			return err
+		}
+	}
+	return s.replan(ctx, trips)
+}
+
+func (s *Server) releaseSeats(ctx context.Context, driverID string, seats uint32) error {
+	availability, err := s.seats.GetSeats(ctx, driverID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	availability.AvailableSeats += int32(max(seats, 1))
+	availability.UpdatedAt = timestamppb.Now()
+	return s.seats.UpsertSeats(ctx, availability)
+}
@@ -0,0 +1,121 @@
+package matching
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+)
+
+// Router measures the driving distance between two points. Without one
+// detours are measured along straight lines.
+type Router interface {
+	RouteDistance(ctx context.Context, from, to *lastmilev1.LatLng) (float64, error)
+}
+
+// withinDetour reports whether adding a drop-off at destinationID to the
+// driver's scheduled trips from the station lengthens their route by no more
+// than the detour limit, compared with driving the new rider there directly.
+// Stops whose location is unknown are left out.
+func (s *Server) withinDetour(ctx context.Context, stationID, driverID, destinationID string) (bool, error) {
+	if s.maxDetourMeters <= 0 {
+		return true, nil
+	}
+	station, err := s.stations.Get(ctx, stationID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+	added, err := s.destinationLocation(ctx, destinationID)
+	if err != nil || station.Location == nil || added == nil {
+		return err == nil, err
+	}
+	trips, err := s.trips.ListTrips(ctx, storage.TripFilter{
+		DriverID:  driverID,
+		StationID: stationID,
+		Status:    lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+	})
+	if err != nil {
+		return false, err
+	}
+	var stops []*lastmilev1.LatLng
+	seen := make(map[string]bool)
+	for _, trip := range trips {
+		if seen[trip.DestinationId] {
+			continue
+		}
+		seen[trip.DestinationId] = true
+		location, err := s.destinationLocation(ctx, trip.DestinationId)
+		if err != nil {
+			return false, err
+		}
+		if location != nil {
+			stops = append(stops, location)
+		}
+	}
+	if len(stops) == 0 {
+		return true, nil
+	}
+
+	// Existing drop-offs are visited nearest first; the new one goes where
+	// it adds the least distance.
+	fromStation := make([]float64, len(stops))
+	for i, stop := range stops {
+		fromStation[i] = s.distance(ctx, station.Location, stop)
+	}
+	order := make([]int, len(stops))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return fromStation[order[i]] < fromStation[order[j]] })
+
+	prev := station.Location
+	best := -1.0
+	for i := 0; i <= len(order); i++ {
+		extra := s.distance(ctx, prev, added)
+		if i < len(order) {
+			next := stops[order[i]]
+			extra += s.distance(ctx, added, next) - s.distance(ctx, prev, next)
+			prev = next
+		}
+		if best < 0 || extra < best {
+			best = extra
+		}
+	}
+	detour := max(best-s.distance(ctx, station.Location, added), 0)
+	return detour <= s.maxDetourMeters, nil
+}
+
+func (s *Server) destinationLocation(ctx context.Context, destinationID string) (*lastmilev1.LatLng, error) {
+	if destinationID == "" {
+		return nil, nil
+	}
+	destination, err := s.destinations.Get(ctx, destinationID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return destination.Location, nil
+}
+
+// distance falls back to the straight line when the router cannot route
+// between the points.
+func (s *Server) distance(ctx context.Context, from, to *lastmilev1.LatLng) float64 {
+	if s.router != nil {
+		meters, err := s.router.RouteDistance(ctx, from, to)
+		if err == nil {
+			return meters
+		}
+		logger := observability.Logger()
+		logger.Warn().Err(err).Msg("route distance failed, using straight line")
+	}
+	return eta.HaversineMeters(from, to)
+}
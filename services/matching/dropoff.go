@@ -0,0 +1,173 @@
+package matching
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/sequencing"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultSpeedKmh is used for drop-off ETAs when the server is built without
+// an estimator.
+const defaultSpeedKmh = 20
+
+type pool struct {
+	driverID, stationID string
+}
+
+// planDropoffs orders the drop-offs of the driver's scheduled trips from the
+// station and stores the plan on each of them. Trips whose destination has no
+// location are left out of the plan. Estimation failures are logged and
+// leave the previous plan in place.
+func (s *Server) planDropoffs(ctx context.Context, driverID, stationID string) error {
+	trips, err := s.trips.ListTrips(ctx, storage.TripFilter{
+		DriverID:  driverID,
+		StationID: stationID,
+		Status:    lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+	})
+	if err != nil || len(trips) == 0 {
+		return err
+	}
+	station, err := s.stations.Get(ctx, stationID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if station.Location == nil {
+		return nil
+	}
+
+	now := time.Now()
+	departure := now
+	var stops []*lastmilev1.DropoffStop
+	var points []*lastmilev1.LatLng
+	var riders []int
+	index := make(map[string]int)
+	for _, trip := range trips {
+		seats := 1
+		if trip.RequestId != "" {
+			request, err := s.requests.GetRideRequest(ctx, trip.RequestId)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+			if arrival := request.GetArrivalTime(); arrival != nil && arrival.AsTime().After(departure) {
+				departure = arrival.AsTime()
+			}
+			seats = int(max(request.GetSeats(), 1))
+		}
+		if i, ok := index[trip.DestinationId]; ok {
+			riders[i] += seats
+			continue
+		}
+		location, err := s.destinationLocation(ctx, trip.DestinationId)
+		if err != nil {
+			return err
+		}
+		if location == nil {
+			continue
+		}
+		index[trip.DestinationId] = len(stops)
+		stops = append(stops, &lastmilev1.DropoffStop{DestinationId: trip.DestinationId})
+		points = append(points, location)
+		riders = append(riders, seats)
+	}
+
+	vehicle, err := s.vehicleType(ctx, driverID)
+	if err != nil {
+		return err
+	}
+	points = append([]*lastmilev1.LatLng{station.Location}, points...)
+	times := make([][]time.Duration, len(points))
+	meters := make([][]float64, len(points))
+	for i, from := range points {
+		times[i] = make([]time.Duration, len(points))
+		meters[i] = make([]float64, len(points))
+		for j, to := range points {
+			if i == j {
+				continue
+			}
+			estimate, err := s.estimator.Estimate(ctx, from, to, vehicle, departure)
+			if err != nil {
+				logger := observability.Logger()
+				logger.Error().Err(err).Str("driver_id", driverID).Str("station_id", stationID).Msg("drop-off estimate failed")
+				return nil
+			}
+			times[i][j] = estimate.Duration
+			meters[i][j] = estimate.DistanceMeters
+		}
+	}
+
+	for i := range stops {
+		stops[i].Riders = int32(riders[i])
+	}
+	order := sequencing.Order(times, riders, s.dropoffObjective)
+	plan := &lastmilev1.DropoffPlan{
+		Objective:     s.dropoffObjective,
+		DepartureTime: timestamppb.New(departure),
+		PlannedAt:     timestamppb.New(now),
+	}
+	var distance float64
+	prev := 0
+	for i, arrival := range sequencing.Arrivals(times, order) {
+		stop := stops[order[i]]
+		distance += meters[prev][order[i]+1]
+		prev = order[i] + 1
+		stop.Eta = timestamppb.New(departure.Add(arrival))
+		stop.DistanceMeters = distance
+		plan.Stops = append(plan.Stops, stop)
+	}
+	// Only the plan is written, so pickups, cancellations and ratings made
+	// while planning are kept; trips that left SCHEDULED are skipped.
+	for _, trip := range trips {
+		if err := s.trips.SetDropoffPlan(ctx, trip.TripId, plan); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// replan refreshes the drop-off plans of every pool the trips belong to.
+func (s *Server) replan(ctx context.Context, trips []*lastmilev1.Trip) error {
+	var pools []pool
+	for _, trip := range trips {
+		p := pool{driverID: trip.DriverId, stationID: trip.StationId}
+		if trip.DriverId != "" && !slices.Contains(pools, p) {
+			pools = append(pools, p)
+		}
+	}
+	for _, p := range pools {
+		if err := s.planDropoffs(ctx, p.driverID, p.stationID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vehicleType looks up the type of the driver's vehicle; drivers without one
+// on file get the default speed.
+func (s *Server) vehicleType(ctx context.Context, driverID string) (lastmilev1.VehicleType, error) {
+	driver, err := s.drivers.GetDriver(ctx, driverID)
+	if err == nil && driver.VehicleId != "" {
+		var vehicle *lastmilev1.Vehicle
+		if vehicle, err = s.vehicles.GetVehicle(ctx, driver.VehicleId); err == nil {
+			return vehicle.Type, nil
+		}
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return 0, err
+	}
+	return lastmilev1.VehicleType_VEHICLE_TYPE_UNSPECIFIED, nil
+}
+
+func defaultEstimator() eta.Estimator {
+	return eta.Haversine{Profile: eta.Profile{DefaultKmh: defaultSpeedKmh}}
+}
@@ -0,0 +1,226 @@
+package matching
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// NoShowConfig controls how long drivers wait at the station for riders.
+type NoShowConfig struct {
+	// Interval between checks; zero means 30 seconds.
+	Interval time.Duration
+	// GeofenceMeters around the station counts a driver as arrived; zero
+	// means 150.
+	GeofenceMeters float64
+	// Wait is how long the rider has to board once both the driver and the
+	// rider's planned arrival time are at the station; zero means 5 minutes.
+	Wait time.Duration
+	// Limit deprioritizes riders with at least this many no-shows; zero
+	// disables it.
+	Limit int32
+}
+
+func (c NoShowConfig) withDefaults() NoShowConfig {
+	if c.Interval <= 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.GeofenceMeters <= 0 {
+		c.GeofenceMeters = 150
+	}
+	if c.Wait <= 0 {
+		c.Wait = 5 * time.Minute
+	}
+	return c
+}
+
+// RunNoShowChecks looks for no-shows every interval until ctx is done.
+func (s *Server) RunNoShowChecks(ctx context.Context) error {
+	logger := observability.Logger()
+	ticker := time.NewTicker(s.noShow.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			noShows, err := s.CheckNoShows(ctx, now)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				logger.Error().Err(err).Msg("no-show check failed")
+			} else if noShows > 0 {
+				logger.Info().Int("no_shows", noShows).Msg("released no-show riders")
+			}
+		}
+	}
+}
+
+// CheckNoShows records drivers arriving at the station of their scheduled
+// trips, then releases riders who have not been picked up within the wait.
+// The rider's leg is canceled and its seats freed; the driver's other trips
+// go ahead.
+func (s *Server) CheckNoShows(ctx context.Context, now time.Time) (int, error) {
+	if s.matches == nil {
+		return 0, errors.New("matching: no match store configured")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trips, err := s.trips.ListTrips(ctx, storage.TripFilter{Status: lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED})
+	if err != nil {
+		return 0, fmt.Errorf("list scheduled trips: %w", err)
+	}
+	stations := make(map[string]*lastmilev1.Station)
+	noShows := 0
+	for _, trip := range trips {
+		if trip.RequestId == "" {
+			continue
+		}
+		if trip.DriverArrivedAt == nil {
+			arrived, err := s.arrival(ctx, trip, stations)
+			if err != nil {
+				return noShows, err
+			}
+			if arrived == nil {
+				continue
+			}
+			trip.DriverArrivedAt = arrived
+			if err := s.trips.UpdateTrip(ctx, trip); err != nil {
+				return noShows, fmt.Errorf("record arrival for trip %s: %w", trip.TripId, err)
+			}
+		}
+
+		request, err := s.requests.GetRideRequest(ctx, trip.RequestId)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			return noShows, err
+		}
+		if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+			continue
+		}
+		waitFrom := trip.DriverArrivedAt.AsTime()
+		if arrival := request.GetArrivalTime().AsTime(); arrival.After(waitFrom) {
+			waitFrom = arrival
+		}
+		if now.Before(waitFrom.Add(s.noShow.Wait)) {
+			continue
+		}
+		released, err := s.markNoShow(ctx, trip, request, now)
+		if released {
+			noShows++
+		}
+		if err != nil {
+			return noShows, fmt.Errorf("mark no-show for trip %s: %w", trip.TripId, err)
+		}
+	}
+	return noShows, nil
+}
+
+// arrival returns when the trip's driver was seen within the geofence of the
+// station after the trip was matched, or nil.
+func (s *Server) arrival(ctx context.Context, trip *lastmilev1.Trip, stations map[string]*lastmilev1.Station) (*timestamppb.Timestamp, error) {
+	location, err := s.locations.GetLocation(ctx, trip.DriverId)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if location.Location == nil || location.ObservedAt == nil || location.ObservedAt.AsTime().Before(trip.GetCreatedAt().AsTime()) {
+		return nil, nil
+	}
+	station, ok := stations[trip.StationId]
+	if !ok {
+		station, err = s.stations.Get(ctx, trip.StationId)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+		stations[trip.StationId] = station
+	}
+	if station.GetLocation() == nil || haversineMeters(station.Location, location.Location) > s.noShow.GeofenceMeters {
+		return nil, nil
+	}
+	return location.ObservedAt, nil
+}
+
+// markNoShow cancels the trip and the rider's request together, unless a
+// pickup or cancellation got in first, then frees the seats and counts the
+// no-show once for the request. It reports whether the rider was released.
+func (s *Server) markNoShow(ctx context.Context, trip *lastmilev1.Trip, request *lastmilev1.RideRequest, now time.Time) (bool, error) {
+	cancellation := &lastmilev1.Cancellation{
+		CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_SYSTEM,
+		Reason:     lastmilev1.CancellationReason_CANCELLATION_REASON_SYSTEM_RIDER_NO_SHOW,
+		CanceledAt: timestamppb.New(now),
+	}
+	trip.Status = lastmilev1.TripStatus_TRIP_STATUS_CANCELED
+	trip.Cancellation = cancellation
+	trip.DropoffPlan = nil
+	trip.UpdatedAt = cancellation.CanceledAt
+	tripChanged, err := events.NewOutboxMessage(events.StreamTrips, events.TypeTripStatusChanged, trip)
+	if err != nil {
+		return false, err
+	}
+	request.Status = lastmilev1.RideStatus_RIDE_STATUS_CANCELED
+	request.Cancellation = cancellation
+	requestChanged, err := events.NewOutboxMessage(events.StreamRideRequests, events.TypeRideRequestStatusChanged, request)
+	if err != nil {
+		return false, err
+	}
+	err = s.matches.CancelMatch(ctx, trip.TripId, request.RequestId, cancellation, request.Status, tripChanged, requestChanged)
+	if errors.Is(err, storage.ErrStatusChanged) || errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := s.releaseSeats(ctx, trip.DriverId, request.Seats); err != nil {
+		return true, err
+	}
+	if err := s.replan(ctx, []*lastmilev1.Trip{trip}); err != nil {
+		return true, err
+	}
+
+	err = s.riders.AddRiderNoShow(ctx, request.RiderId, request.RequestId)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return true, fmt.Errorf("count no-show for rider %s: %w", request.RiderId, err)
+	}
+	return true, nil
+}
+
+// recordLocation keeps each driver's latest ping for arrival checks.
+func (s *Server) recordLocation(ctx context.Context, event *lastmilev1.Event) error {
+	var update lastmilev1.LocationUpdate
+	if err := event.GetPayload().UnmarshalTo(&update); err != nil {
+		return err
+	}
+	if update.ObservedAt == nil {
+		update.ObservedAt = event.GetOccurredAt()
+	}
+	err := s.locations.UpsertLocation(ctx, &update)
+	if errors.Is(err, storage.ErrInvalidArgument) {
+		return nil
+	}
+	return err
+}
+
+func haversineMeters(a, b *lastmilev1.LatLng) float64 {
+	const earthRadiusMeters = 6371000
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,31 @@
+package matching
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const defaultPickupPinTTL = 30 * time.Minute
+
+// newPickup issues the one-time PIN the rider shows the driver when boarding.
+// It stays valid for the TTL from the later of now and the rider's planned
+// arrival at the station.
+func newPickup(request *lastmilev1.RideRequest, now time.Time, ttl time.Duration) (*lastmilev1.PickupVerification, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(10000))
+	if err != nil {
+		return nil, err
+	}
+	from := now
+	if arrival := request.GetArrivalTime(); arrival != nil && arrival.AsTime().After(from) {
+		from = arrival.AsTime()
+	}
+	return &lastmilev1.PickupVerification{
+		Pin:       fmt.Sprintf("%04d", n.Int64()),
+		ExpiresAt: timestamppb.New(from.Add(ttl)),
+	}, nil
+}
@@ -1,11 +1,486 @@
 package matching
 
-import lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/eta"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
 
 type Server struct {
 	lastmilev1.UnimplementedMatchingServiceServer
+	mu       sync.Mutex
+	requests storage.RideRequestStore
+	trips    storage.TripStore
+	matches  storage.MatchStore
+	seats    storage.SeatStore
+	drivers  storage.DriverStore
+	shifts   storage.ShiftStore
+	outbox   storage.Outbox
+	// Riders, stations and locations back no-show detection.
+	riders    storage.RiderStore
+	stations  storage.StationStore
+	locations storage.LocationStore
+	// Destinations and router measure the detour a new rider adds to a
+	// driver's drop-offs.
+	destinations storage.DestinationStore
+	router       Router
+	// Vehicles and estimator time the drop-off plans of pooled trips.
+	vehicles         storage.VehicleStore
+	estimator        eta.Estimator
+	dropoffObjective lastmilev1.DropoffObjective
+
+	minDriverRating      float64
+	minDriverReliability float64
+	noShow               NoShowConfig
+	pickupPinTTL         time.Duration
+	maxDetourMeters      float64
+}
+
+type Stores struct {
+	Requests storage.RideRequestStore
+	Trips    storage.TripStore
+	// Matches writes a new trip with its request; it defaults to one over
+	// memory Trips and Requests.
+	Matches storage.MatchStore
+	Seats   storage.SeatStore
+	Drivers storage.DriverStore
+	Shifts  storage.ShiftStore
+	Outbox  storage.Outbox
+	// Riders, Stations and Locations back no-show detection; Locations is
+	// fed from driver location events.
+	Riders    storage.RiderStore
+	Stations  storage.StationStore
+	Locations storage.LocationStore
+	// Destinations locate drop-offs for detour checks; Router measures them
+	// along roads and defaults to straight lines.
+	Destinations storage.DestinationStore
+	Router       Router
+	// Vehicles give drivers' vehicle types for drop-off ETAs; Estimator
+	// defaults to straight-line estimates at 20 km/h.
+	Vehicles  storage.VehicleStore
+	Estimator eta.Estimator
+	// DropoffObjective is what drop-off orders minimize; unspecified means
+	// total ride time.
+	DropoffObjective lastmilev1.DropoffObjective
+
+	// MinDriverRating deprioritizes drivers whose average rating is below it.
+	// Drivers without ratings are not affected; zero disables the check.
+	MinDriverRating float64
+	// MinDriverReliability does the same for drivers whose reliability score,
+	// lowered by each trip they cancel, is below it.
+	MinDriverReliability float64
+	NoShow               NoShowConfig
+	// PickupPinTTL is how long a rider's pickup PIN stays valid after their
+	// planned arrival; zero means 30 minutes.
+	PickupPinTTL time.Duration
+	// MaxDetourMeters skips drivers whose drop-off route would grow by more
+	// than this to take the rider; zero disables the check.
+	MaxDetourMeters float64
 }
 
 func NewServer() *Server {
-	return &Server{}
+	return NewServerWithStores(Stores{})
+}
+
+func NewServerWithStores(stores Stores) *Server {
+	if stores.Outbox == nil {
+		stores.Outbox = storage.NewMemoryOutbox()
+	}
+	memoryOutbox, _ := stores.Outbox.(*storage.MemoryOutbox)
+	if stores.Requests == nil {
+		stores.Requests = storage.NewMemoryRideRequestStore(memoryOutbox)
+	}
+	if stores.Trips == nil {
+		stores.Trips = storage.NewMemoryTripStore(memoryOutbox)
+	}
+	if stores.Matches == nil {
+		trips, tripsOK := stores.Trips.(*storage.MemoryTripStore)
+		requests, requestsOK := stores.Requests.(*storage.MemoryRideRequestStore)
+		if tripsOK && requestsOK {
+			stores.Matches = storage.NewMemoryMatchStore(trips, requests)
+		}
+	}
+	if stores.Seats == nil {
+		stores.Seats = storage.NewMemorySeatStore()
+	}
+	if stores.Drivers == nil {
+		stores.Drivers = storage.NewMemoryUserStore()
+	}
+	if stores.Shifts == nil {
+		stores.Shifts = storage.NewMemoryShiftStore()
+	}
+	if stores.Riders == nil {
+		stores.Riders = storage.NewMemoryUserStore()
+	}
+	if stores.Stations == nil {
+		stores.Stations = storage.NewMemoryStationStore()
+	}
+	if stores.Locations == nil {
+		stores.Locations = storage.NewMemoryLocationStore()
+	}
+	if stores.Destinations == nil {
+		stores.Destinations = storage.NewMemoryDestinationStore()
+	}
+	if stores.Vehicles == nil {
+		stores.Vehicles = storage.NewMemoryVehicleStore()
+	}
+	if stores.Estimator == nil {
+		stores.Estimator = defaultEstimator()
+	}
+	if stores.DropoffObjective == lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_UNSPECIFIED {
+		stores.DropoffObjective = lastmilev1.DropoffObjective_DROPOFF_OBJECTIVE_TOTAL_RIDE_TIME
+	}
+	if stores.PickupPinTTL <= 0 {
+		stores.PickupPinTTL = defaultPickupPinTTL
+	}
+	return &Server{
+		requests: stores.Requests,
+		trips:    stores.Trips,
+		matches:  stores.Matches,
+		seats:    stores.Seats,
+		drivers:  stores.Drivers,
+		shifts:   stores.Shifts,
+		outbox:   stores.Outbox,
+
+		riders:    stores.Riders,
+		stations:  stores.Stations,
+		locations: stores.Locations,
+
+		destinations: stores.Destinations,
+		router:       stores.Router,
+
+		vehicles:         stores.Vehicles,
+		estimator:        stores.Estimator,
+		dropoffObjective: stores.DropoffObjective,
+
+		minDriverRating:      stores.MinDriverRating,
+		minDriverReliability: stores.MinDriverReliability,
+		noShow:               stores.NoShow.withDefaults(),
+		pickupPinTTL:         stores.PickupPinTTL,
+		maxDetourMeters:      stores.MaxDetourMeters,
+	}
+}
+
+func (s *Server) RunMatching(ctx context.Context, req *lastmilev1.RunMatchingRequest) (*lastmilev1.RunMatchingResponse, error) {
+	if req == nil || strings.TrimSpace(req.StationId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	matchTime := req.MatchTime
+	if matchTime == nil {
+		matchTime = timestamppb.Now()
+	} else if !matchTime.IsValid() {
+		return nil, status.Error(codes.InvalidArgument, "match_time is invalid")
+	}
+
+	run, err := s.match(ctx, strings.TrimSpace(req.StationId), matchTime)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.RunMatchingResponse{Match: run}, nil
+}
+
+func (s *Server) HandleEvent(ctx context.Context, event *lastmilev1.Event) error {
+	switch event.GetType() {
+	case events.TypeRideRequestCreated, events.TypeRideRequestRescheduled:
+	case events.TypeDriverLocationUpdated:
+		return s.recordLocation(ctx, event)
+	case events.TypeRideRequestStatusChanged:
+		var request lastmilev1.RideRequest
+		if err := event.GetPayload().UnmarshalTo(&request); err != nil {
+			return err
+		}
+		return s.releaseCanceled(ctx, &request)
+	case events.TypeTripStatusChanged:
+		var trip lastmilev1.Trip
+		if err := event.GetPayload().UnmarshalTo(&trip); err != nil {
+			return err
+		}
+		if trip.Status == lastmilev1.TripStatus_TRIP_STATUS_CANCELED {
+			s.mu.Lock()
+			err := s.planDropoffs(ctx, trip.DriverId, trip.StationId)
+			s.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		requeued, err := s.requeue(ctx, &trip)
+		if err != nil || !requeued {
+			return err
+		}
+		_, err = s.match(ctx, trip.StationId, timestamppb.Now())
+		return err
+	default:
+		return nil
+	}
+	var request lastmilev1.RideRequest
+	if err := event.GetPayload().UnmarshalTo(&request); err != nil {
+		return err
+	}
+	if event.GetType() == events.TypeRideRequestRescheduled {
+		if err := s.unmatch(ctx, request.RequestId, event.GetOccurredAt().AsTime()); err != nil {
+			return err
+		}
+	}
+	_, err := s.match(ctx, request.StationId, timestamppb.Now())
+	return err
+}
+
+// unmatch puts a matched request back in the queue after its arrival time
+// moved: the scheduled trip is canceled and its seats released. Trips that
+// already started, or were matched after the move, are left alone, so
+// redelivered events do not cancel the new match.
+func (s *Server) unmatch(ctx context.Context, requestID string, movedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := s.requests.GetRideRequest(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		return nil
+	}
+	trips, err := s.trips.ListTrips(ctx, storage.TripFilter{
+		RequestID: requestID,
+		Status:    lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+	})
+	if err != nil {
+		return err
+	}
+	trips = slices.DeleteFunc(trips, func(trip *lastmilev1.Trip) bool {
+		return !trip.GetCreatedAt().AsTime().Before(movedAt)
+	})
+	if len(trips) == 0 {
+		return nil
+	}
+	if err := s.cancelTrips(ctx, trips, request.Seats, &lastmilev1.Cancellation{
+		CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_SYSTEM,
+		Reason:     lastmilev1.CancellationReason_CANCELLATION_REASON_SYSTEM_RESCHEDULED,
+		CanceledAt: timestamppb.New(movedAt),
+	}); err != nil {
+		return err
+	}
+	request.Status = lastmilev1.RideStatus_RIDE_STATUS_PENDING
+	statusChanged, err := events.NewOutboxMessage(events.StreamRideRequests, events.TypeRideRequestStatusChanged, request)
+	if err != nil {
+		return err
+	}
+	err = s.requests.UpdateRideRequest(ctx, request, lastmilev1.RideStatus_RIDE_STATUS_MATCHED, statusChanged)
+	if errors.Is(err, storage.ErrStatusChanged) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) match(ctx context.Context, stationID string, matchTime *timestamppb.Timestamp) (*lastmilev1.MatchRun, error) {
+	if s.matches == nil {
+		return nil, errors.New("matching: no match store configured")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, err := s.requests.ListRideRequests(ctx, storage.RideRequestFilter{
+		StationID: stationID,
+		Status:    lastmilev1.RideStatus_RIDE_STATUS_PENDING,
+	})
+	if err != nil {
+		return nil, err
+	}
+	unreliable, err := s.unreliableRiders(ctx, pending)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		if last := unreliable[pending[i].RiderId]; last != unreliable[pending[j].RiderId] {
+			return !last
+		}
+		return pending[i].GetArrivalTime().AsTime().Before(pending[j].GetArrivalTime().AsTime())
+	})
+
+	available, err := s.availableDrivers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &lastmilev1.MatchRun{
+		MatchId:   newID("match"),
+		StationId: stationID,
+		MatchTime: matchTime,
+	}
+	var matched []*lastmilev1.Trip
+	for _, request := range pending {
+		if len(available) == 0 {
+			break
+		}
+		declined, err := s.declinedDrivers(ctx, request.RequestId)
+		if err != nil {
+			return nil, err
+		}
+		needed := max(request.Seats, 1)
+		i := -1
+		for j, seats := range available {
+			if seats.AvailableSeats < int32(needed) || declined[seats.DriverId] {
+				continue
+			}
+			ok, err := s.withinDetour(ctx, stationID, seats.DriverId, request.DestinationId)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			continue
+		}
+		seats := available[i]
+		now := timestamppb.Now()
+		trip := &lastmilev1.Trip{
+			TripId:        newID("trip"),
+			RiderId:       request.RiderId,
+			DriverId:      seats.DriverId,
+			StationId:     stationID,
+			DestinationId: request.DestinationId,
+			RequestId:     request.RequestId,
+			Status:        lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if trip.Pickup, err = newPickup(request, now.AsTime(), s.pickupPinTTL); err != nil {
+			return nil, err
+		}
+		tripCreated, err := events.NewOutboxMessage(events.StreamTrips, events.TypeTripCreated, trip)
+		if err != nil {
+			return nil, err
+		}
+		pinIssued, err := events.NewOutboxMessage(events.StreamPickupPins, events.TypePickupPinIssued, trip)
+		if err != nil {
+			return nil, err
+		}
+		request.Status = lastmilev1.RideStatus_RIDE_STATUS_MATCHED
+		statusChanged, err := events.NewOutboxMessage(events.StreamRideRequests, events.TypeRideRequestStatusChanged, request)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.matches.CreateMatch(ctx, trip, request, tripCreated, pinIssued, statusChanged); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				// Canceled, or matched by another run, since it was listed.
+				continue
+			}
+			return nil, err
+		}
+		seats.AvailableSeats -= int32(needed)
+		seats.UpdatedAt = now
+		if err := s.seats.UpsertSeats(ctx, seats); err != nil {
+			return nil, err
+		}
+		if seats.AvailableSeats <= 0 {
+			available = slices.Delete(available, i, i+1)
+		}
+
+		run.Assignments = append(run.Assignments, &lastmilev1.MatchAssignment{
+			RiderId:  request.RiderId,
+			DriverId: trip.DriverId,
+			TripId:   trip.TripId,
+		})
+		matched = append(matched, trip)
+	}
+	if err := s.replan(ctx, matched); err != nil {
+		return nil, err
+	}
+	completed, err := events.NewOutboxMessage(events.StreamMatching, events.TypeMatchCompleted, run)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.outbox.Enqueue(ctx, completed); err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func (s *Server) availableDrivers(ctx context.Context) ([]*lastmilev1.SeatAvailability, error) {
+	all, err := s.seats.ListSeats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	available := make([]*lastmilev1.SeatAvailability, 0, len(all))
+	lowRated := make(map[string]bool)
+	for _, seats := range all {
+		if seats.AvailableSeats <= 0 {
+			continue
+		}
+		driver, err := s.drivers.GetDriver(ctx, seats.DriverId)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if driver.Status != lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE {
+			continue
+		}
+		if _, err := s.shifts.GetOpenShift(ctx, seats.DriverId); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if driver.RatingCount > 0 && driver.RatingAverage < s.minDriverRating ||
+			driver.CancellationCount > 0 && driver.ReliabilityScore < s.minDriverReliability {
+			lowRated[seats.DriverId] = true
+		}
+		available = append(available, seats)
+	}
+	sort.SliceStable(available, func(i, j int) bool {
+		if low := lowRated[available[i].DriverId]; low != lowRated[available[j].DriverId] {
+			return !low
+		}
+		return available[i].AvailableSeats > available[j].AvailableSeats
+	})
+	return available, nil
+}
+
+// unreliableRiders finds riders with too many no-shows, who are matched
+// after everyone else.
+func (s *Server) unreliableRiders(ctx context.Context, pending []*lastmilev1.RideRequest) (map[string]bool, error) {
+	unreliable := make(map[string]bool)
+	if s.noShow.Limit <= 0 {
+		return unreliable, nil
+	}
+	for _, request := range pending {
+		if _, seen := unreliable[request.RiderId]; seen {
+			continue
+		}
+		profile, err := s.riders.GetRider(ctx, request.RiderId)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+		unreliable[request.RiderId] = profile.GetNoShowCount() >= s.noShow.Limit
+	}
+	return unreliable, nil
+}
+
+func newID(prefix string) string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return prefix + "_" + hex.EncodeToString(buf)
 }
@@ -0,0 +1,633 @@
+package matching
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestRunMatchingValidation(t *testing.T) {
+	server := NewServer()
+	_, err := server.RunMatching(context.Background(), nil)
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	_, err = server.RunMatching(context.Background(), &lastmilev1.RunMatchingRequest{StationId: " "})
+	assertStatusCode(t, err, codes.InvalidArgument)
+}
+
+func TestRunMatchingAssignsSeats(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	server := NewServerWithStores(stores)
+
+	resp, err := server.RunMatching(ctx, &lastmilev1.RunMatchingRequest{StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := len(resp.Match.Assignments); got != 2 {
+		t.Fatalf("expected 2 assignments, got %d", got)
+	}
+	if resp.Match.Assignments[0].RiderId != "early" {
+		t.Fatalf("expected earliest arrival first, got %q", resp.Match.Assignments[0].RiderId)
+	}
+
+	pending, _ := stores.Requests.ListRideRequests(ctx, storage.RideRequestFilter{Status: lastmilev1.RideStatus_RIDE_STATUS_PENDING})
+	if len(pending) != 1 || pending[0].RiderId != "other-station" {
+		t.Fatalf("expected only the other station request to stay pending, got %v", pending)
+	}
+	seats, _ := stores.Seats.GetSeats(ctx, "d1")
+	if seats.AvailableSeats != 0 {
+		t.Fatalf("expected seats to be consumed, got %d", seats.AvailableSeats)
+	}
+	suspended, _ := stores.Seats.GetSeats(ctx, "d2")
+	if suspended.AvailableSeats != 4 {
+		t.Fatalf("expected suspended driver to be skipped, got %d seats", suspended.AvailableSeats)
+	}
+	offline, _ := stores.Seats.GetSeats(ctx, "d3")
+	if offline.AvailableSeats != 6 {
+		t.Fatalf("expected offline driver to be skipped, got %d seats", offline.AvailableSeats)
+	}
+	trip, err := stores.Trips.GetTrip(ctx, resp.Match.Assignments[0].TripId)
+	if err != nil {
+		t.Fatalf("expected trip to be stored: %v", err)
+	}
+	if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED {
+		t.Fatalf("expected scheduled trip, got %s", trip.Status)
+	}
+	if len(trip.GetPickup().GetPin()) != 4 || trip.Pickup.ExpiresAt == nil {
+		t.Fatalf("expected a 4-digit pickup pin with expiry, got %v", trip.Pickup)
+	}
+
+	entries, err := stores.Outbox.ListPending(ctx, 100)
+	if err != nil {
+		t.Fatalf("unexpected outbox error: %v", err)
+	}
+	pins := 0
+	for _, entry := range entries {
+		if entry.Stream == events.StreamPickupPins {
+			var issued lastmilev1.Trip
+			if err := entry.Event.GetPayload().UnmarshalTo(&issued); err != nil {
+				t.Fatalf("unexpected payload error: %v", err)
+			}
+			stored, err := stores.Trips.GetTrip(ctx, issued.TripId)
+			if err != nil || issued.GetPickup().GetPin() != stored.GetPickup().GetPin() {
+				t.Fatalf("expected the pin on the rider-only stream, got %v, %v", issued.GetPickup(), err)
+			}
+			pins++
+			continue
+		}
+		ce, err := events.ToCloudEvent("/lastmile/"+entry.Stream, entry.Event)
+		if err != nil {
+			t.Fatalf("unexpected cloud event error: %v", err)
+		}
+		if strings.Contains(string(ce.Data), `"pin"`) {
+			t.Fatalf("expected exported %s event without the pin, got %s", ce.Type, ce.Data)
+		}
+	}
+	if pins != len(resp.Match.Assignments) {
+		t.Fatalf("expected one pickup pin event per trip, got %d", pins)
+	}
+}
+
+func TestRunMatchingReservesRequestedSeats(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	if err := stores.Shifts.StartShift(ctx, &lastmilev1.DriverShift{ShiftId: "shift-d3", DriverId: "d3", StartedAt: timestamppb.Now()}); err != nil {
+		t.Fatalf("seed shift: %v", err)
+	}
+	group := &lastmilev1.RideRequest{
+		RequestId:     "group",
+		RiderId:       "group",
+		StationId:     "s1",
+		DestinationId: "x",
+		ArrivalTime:   timestamppb.New(time.Now()),
+		Status:        lastmilev1.RideStatus_RIDE_STATUS_PENDING,
+		Seats:         5,
+	}
+	if err := stores.Requests.CreateRideRequest(ctx, group); err != nil {
+		t.Fatalf("seed request: %v", err)
+	}
+	server := NewServerWithStores(stores)
+
+	resp, err := server.RunMatching(ctx, &lastmilev1.RunMatchingRequest{StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := len(resp.Match.Assignments); got != 3 {
+		t.Fatalf("expected 3 assignments, got %d", got)
+	}
+	if resp.Match.Assignments[0].RiderId != "group" || resp.Match.Assignments[0].DriverId != "d3" {
+		t.Fatalf("expected the group on the only driver with 5 seats, got %v", resp.Match.Assignments[0])
+	}
+	d3, _ := stores.Seats.GetSeats(ctx, "d3")
+	d1, _ := stores.Seats.GetSeats(ctx, "d1")
+	if d3.AvailableSeats != 0 || d1.AvailableSeats != 1 {
+		t.Fatalf("unexpected seats left: d3=%d d1=%d", d3.AvailableSeats, d1.AvailableSeats)
+	}
+}
+
+func TestHandleEventTriggersMatching(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	server := NewServerWithStores(stores)
+
+	event, err := events.New(events.TypeRideRequestCreated, &lastmilev1.RideRequest{RequestId: "late", StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := server.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("unexpected handler error: %v", err)
+	}
+
+	request, _ := stores.Requests.GetRideRequest(ctx, "late")
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		t.Fatalf("expected matched request, got %s", request.Status)
+	}
+	if got := countEvents(t, stores.Outbox, events.StreamMatching); got != 1 {
+		t.Fatalf("expected one match event, got %d", got)
+	}
+	if got := countEvents(t, stores.Outbox, events.StreamTrips); got != 2 {
+		t.Fatalf("expected two trip events, got %d", got)
+	}
+}
+
+func TestHandleRescheduledRequeuesMatchedRequest(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	server := NewServerWithStores(stores)
+	if _, err := server.RunMatching(ctx, &lastmilev1.RunMatchingRequest{StationId: "s1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first, err := stores.Trips.ListTrips(ctx, storage.TripFilter{RequestID: "late"})
+	if err != nil || len(first) != 1 {
+		t.Fatalf("expected one trip for the request, got %v, %v", first, err)
+	}
+
+	request, _ := stores.Requests.GetRideRequest(ctx, "late")
+	request.ArrivalTime = timestamppb.New(request.ArrivalTime.AsTime().Add(7 * time.Minute))
+	event, err := events.New(events.TypeRideRequestRescheduled, request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := server.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("unexpected handler error: %v", err)
+	}
+
+	old, _ := stores.Trips.GetTrip(ctx, first[0].TripId)
+	if old.Status != lastmilev1.TripStatus_TRIP_STATUS_CANCELED {
+		t.Fatalf("expected the old trip to be canceled, got %s", old.Status)
+	}
+	scheduled, _ := stores.Trips.ListTrips(ctx, storage.TripFilter{
+		RequestID: "late",
+		Status:    lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+	})
+	if len(scheduled) != 1 || scheduled[0].TripId == old.TripId {
+		t.Fatalf("expected a new scheduled trip, got %v", scheduled)
+	}
+	request, _ = stores.Requests.GetRideRequest(ctx, "late")
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		t.Fatalf("expected the request to be matched again, got %s", request.Status)
+	}
+	seats, _ := stores.Seats.GetSeats(ctx, "d1")
+	if seats.AvailableSeats != 0 {
+		t.Fatalf("expected the released seat to be reused, got %d free", seats.AvailableSeats)
+	}
+
+	// Redelivery must not release the trip matched after the move.
+	if err := server.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("unexpected handler error: %v", err)
+	}
+	again, _ := stores.Trips.GetTrip(ctx, scheduled[0].TripId)
+	if again.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED {
+		t.Fatalf("expected the new trip to survive redelivery, got %s", again.Status)
+	}
+}
+
+func TestRunMatchingDeprioritizesLowRatedDrivers(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	stores.MinDriverRating = 4
+	server := NewServerWithStores(stores)
+	if err := stores.Drivers.CreateDriver(ctx, &lastmilev1.DriverProfile{
+		DriverId:      "d4",
+		Name:          "Dina",
+		Status:        lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE,
+		RatingAverage: 3.2,
+		RatingCount:   10,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stores.Shifts.StartShift(ctx, &lastmilev1.DriverShift{ShiftId: "shift-d4", DriverId: "d4", StartedAt: timestamppb.Now()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stores.Seats.UpsertSeats(ctx, &lastmilev1.SeatAvailability{DriverId: "d4", AvailableSeats: 5}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := server.RunMatching(ctx, &lastmilev1.RunMatchingRequest{StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, assignment := range resp.Match.Assignments {
+		if assignment.DriverId != "d1" {
+			t.Fatalf("expected well-rated d1 to be used first, got %s", assignment.DriverId)
+		}
+	}
+	low, _ := stores.Seats.GetSeats(ctx, "d4")
+	if low.AvailableSeats != 5 {
+		t.Fatalf("expected low-rated driver to keep seats, got %d", low.AvailableSeats)
+	}
+}
+
+func TestRunMatchingSkipsDriversWithLongDetours(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	stores.Stations = storage.NewMemoryStationStore()
+	stores.Destinations = storage.NewMemoryDestinationStore()
+	stores.MaxDetourMeters = 1000
+	if err := stores.Stations.Upsert(ctx, &lastmilev1.Station{StationId: "s1", Location: &lastmilev1.LatLng{Latitude: 12.97, Longitude: 77.59}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// x is 2 km north of the station and y 2 km south.
+	for _, destination := range []*lastmilev1.Destination{
+		{DestinationId: "x", Location: &lastmilev1.LatLng{Latitude: 12.988, Longitude: 77.59}},
+		{DestinationId: "y", Location: &lastmilev1.LatLng{Latitude: 12.952, Longitude: 77.59}},
+	} {
+		if err := stores.Destinations.Upsert(ctx, destination); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// d3 has the most seats but is already heading south.
+	if err := stores.Shifts.StartShift(ctx, &lastmilev1.DriverShift{ShiftId: "shift-d3", DriverId: "d3", StartedAt: timestamppb.Now()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stores.Trips.CreateTrip(ctx, &lastmilev1.Trip{
+		TripId:        "south",
+		DriverId:      "d3",
+		StationId:     "s1",
+		DestinationId: "y",
+		Status:        lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := NewServerWithStores(stores)
+
+	resp, err := server.RunMatching(ctx, &lastmilev1.RunMatchingRequest{StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Match.Assignments) != 2 {
+		t.Fatalf("expected both riders to be matched, got %v", resp.Match.Assignments)
+	}
+	for _, assignment := range resp.Match.Assignments {
+		if assignment.DriverId != "d1" {
+			t.Fatalf("expected d1 to avoid d3's 4 km detour, got %s", assignment.DriverId)
+		}
+	}
+}
+
+func TestRunMatchingPlansDropoffs(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	stores.Stations = storage.NewMemoryStationStore()
+	stores.Destinations = storage.NewMemoryDestinationStore()
+	if err := stores.Stations.Upsert(ctx, &lastmilev1.Station{StationId: "s1", Location: &lastmilev1.LatLng{Latitude: 12.97, Longitude: 77.59}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// x is 2 km north of the station and y 1 km south.
+	for _, destination := range []*lastmilev1.Destination{
+		{DestinationId: "x", Location: &lastmilev1.LatLng{Latitude: 12.988, Longitude: 77.59}},
+		{DestinationId: "y", Location: &lastmilev1.LatLng{Latitude: 12.961, Longitude: 77.59}},
+	} {
+		if err := stores.Destinations.Upsert(ctx, destination); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	early, err := stores.Requests.GetRideRequest(ctx, "early")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	departure := early.ArrivalTime.AsTime().Add(5 * time.Minute)
+	if err := stores.Requests.CreateRideRequest(ctx, &lastmilev1.RideRequest{
+		RequestId:     "south",
+		RiderId:       "south",
+		StationId:     "s1",
+		DestinationId: "y",
+		ArrivalTime:   timestamppb.New(departure),
+		Status:        lastmilev1.RideStatus_RIDE_STATUS_PENDING,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := NewServerWithStores(stores)
+
+	// d1's two seats go to early (x) and south (y); dropping y off first
+	// keeps the riders in the vehicle for 1 + 4 km instead of 2 + 5 km.
+	if _, err := server.RunMatching(ctx, &lastmilev1.RunMatchingRequest{StationId: "s1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	planFor := func(requestID string) *lastmilev1.DropoffPlan {
+		t.Helper()
+		trips, err := stores.Trips.ListTrips(ctx, storage.TripFilter{RequestID: requestID, Status: lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED})
+		if err != nil || len(trips) != 1 {
+			t.Fatalf("expected one scheduled trip for %s, got %v, %v", requestID, trips, err)
+		}
+		return trips[0].DropoffPlan
+	}
+	plan := planFor("early")
+	if len(plan.GetStops()) != 2 || plan.Stops[0].DestinationId != "y" || plan.Stops[1].DestinationId != "x" {
+		t.Fatalf("expected y then x, got %v", plan.GetStops())
+	}
+	if !plan.DepartureTime.AsTime().Equal(departure) {
+		t.Fatalf("expected departure when the last rider arrives, got %s", plan.DepartureTime.AsTime())
+	}
+	if !plan.Stops[0].Eta.AsTime().After(departure) || !plan.Stops[1].Eta.AsTime().After(plan.Stops[0].Eta.AsTime()) {
+		t.Fatalf("expected increasing ETAs after departure, got %v", plan.Stops)
+	}
+	if plan.Stops[1].DistanceMeters < 3900 || plan.Stops[1].DistanceMeters > 4100 {
+		t.Fatalf("expected about 4 km to the last stop, got %.0f", plan.Stops[1].DistanceMeters)
+	}
+	if other := planFor("south"); len(other.GetStops()) != 2 || other.Stops[0].DestinationId != "y" {
+		t.Fatalf("expected the pooled trip to share the plan, got %v", other.GetStops())
+	}
+
+	// The south rider cancels; early now goes straight to x.
+	south, err := stores.Requests.GetRideRequest(ctx, "south")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	south.Status = lastmilev1.RideStatus_RIDE_STATUS_CANCELED
+	event, err := events.New(events.TypeRideRequestStatusChanged, south)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := server.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("unexpected handler error: %v", err)
+	}
+	plan = planFor("early")
+	if len(plan.GetStops()) != 1 || plan.Stops[0].DestinationId != "x" {
+		t.Fatalf("expected only x after the cancellation, got %v", plan.GetStops())
+	}
+	if plan.Stops[0].DistanceMeters < 1900 || plan.Stops[0].DistanceMeters > 2100 {
+		t.Fatalf("expected about 2 km to x, got %.0f", plan.Stops[0].DistanceMeters)
+	}
+}
+
+func TestHandleCancellations(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	server := NewServerWithStores(stores)
+	if err := stores.Drivers.CreateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d4", Name: "Dina", Status: lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stores.Shifts.StartShift(ctx, &lastmilev1.DriverShift{ShiftId: "shift-d4", DriverId: "d4", StartedAt: timestamppb.Now()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stores.Seats.UpsertSeats(ctx, &lastmilev1.SeatAvailability{DriverId: "d4", AvailableSeats: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := server.RunMatching(ctx, &lastmilev1.RunMatchingRequest{StationId: "s1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tripFor := func(requestID string) *lastmilev1.Trip {
+		t.Helper()
+		trips, err := stores.Trips.ListTrips(ctx, storage.TripFilter{RequestID: requestID, Status: lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED})
+		if err != nil || len(trips) != 1 {
+			t.Fatalf("expected one scheduled trip for %s, got %v, %v", requestID, trips, err)
+		}
+		return trips[0]
+	}
+	deliver := func(eventType string, payload proto.Message) {
+		t.Helper()
+		event, err := events.New(eventType, payload)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := server.HandleEvent(ctx, event); err != nil {
+			t.Fatalf("unexpected handler error: %v", err)
+		}
+	}
+
+	// The trip service cancels the trip for the driver; matching requeues the
+	// rider and matches them with someone else.
+	canceled := tripFor("late")
+	if canceled.DriverId != "d1" {
+		t.Fatalf("expected late to ride with d1, got %s", canceled.DriverId)
+	}
+	canceled.Status = lastmilev1.TripStatus_TRIP_STATUS_CANCELED
+	canceled.Cancellation = &lastmilev1.Cancellation{
+		CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_DRIVER,
+		Reason:     lastmilev1.CancellationReason_CANCELLATION_REASON_DRIVER_VEHICLE_ISSUE,
+	}
+	if err := stores.Trips.UpdateTrip(ctx, canceled); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deliver(events.TypeTripStatusChanged, canceled)
+	deliver(events.TypeTripStatusChanged, canceled)
+	if rematched := tripFor("late"); rematched.DriverId != "d4" {
+		t.Fatalf("expected late to be rematched away from d1, got %s", rematched.DriverId)
+	}
+	request, _ := stores.Requests.GetRideRequest(ctx, "late")
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		t.Fatalf("expected late to be matched again, got %s", request.Status)
+	}
+	if seats, _ := stores.Seats.GetSeats(ctx, "d1"); seats.AvailableSeats != 1 {
+		t.Fatalf("expected d1 to get its seat back once, got %d free", seats.AvailableSeats)
+	}
+
+	// A rider cancellation frees the scheduled trip and its seat.
+	request, _ = stores.Requests.GetRideRequest(ctx, "early")
+	request.Status = lastmilev1.RideStatus_RIDE_STATUS_CANCELED
+	request.Cancellation = &lastmilev1.Cancellation{
+		CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_RIDER,
+		Reason:     lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_CHANGED_PLANS,
+	}
+	if err := stores.Requests.UpdateRideRequest(ctx, request, lastmilev1.RideStatus_RIDE_STATUS_MATCHED); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	released := tripFor("early")
+	deliver(events.TypeRideRequestStatusChanged, request)
+	released, _ = stores.Trips.GetTrip(ctx, released.TripId)
+	if released.Status != lastmilev1.TripStatus_TRIP_STATUS_CANCELED || released.Cancellation.GetReason() != request.Cancellation.Reason {
+		t.Fatalf("expected the rider's trip to be canceled with their reason, got %v", released)
+	}
+	if seats, _ := stores.Seats.GetSeats(ctx, "d1"); seats.AvailableSeats != 2 {
+		t.Fatalf("expected d1 to get the rider's seat back, got %d free", seats.AvailableSeats)
+	}
+}
+
+func TestCheckNoShowsReleasesRider(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	users := stores.Drivers.(*storage.MemoryUserStore)
+	stores.Riders = users
+	stores.Stations = storage.NewMemoryStationStore()
+	stores.NoShow = NoShowConfig{GeofenceMeters: 150, Wait: 5 * time.Minute, Limit: 1}
+	server := NewServerWithStores(stores)
+	if err := stores.Stations.Upsert(ctx, &lastmilev1.Station{StationId: "s1", Location: &lastmilev1.LatLng{Latitude: 12.9716, Longitude: 77.5946}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := users.CreateRider(ctx, &lastmilev1.RiderProfile{RiderId: "early", Name: "Esha"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := server.RunMatching(ctx, &lastmilev1.RunMatchingRequest{StationId: "s1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now := time.Now()
+	event, err := events.New(events.TypeDriverLocationUpdated, &lastmilev1.LocationUpdate{
+		DriverId:   "d1",
+		Location:   &lastmilev1.LatLng{Latitude: 12.9720, Longitude: 77.5946},
+		ObservedAt: timestamppb.New(now),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := server.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("unexpected handler error: %v", err)
+	}
+	// The driver is early; nobody is a no-show before their train is in.
+	if noShows, err := server.CheckNoShows(ctx, now); err != nil || noShows != 0 {
+		t.Fatalf("expected no no-shows yet, got %d, %v", noShows, err)
+	}
+	trips, _ := stores.Trips.ListTrips(ctx, storage.TripFilter{RequestID: "early"})
+	if len(trips) != 1 || trips[0].DriverArrivedAt == nil {
+		t.Fatalf("expected the driver's arrival to be recorded, got %v", trips)
+	}
+
+	early, _ := stores.Requests.GetRideRequest(ctx, "early")
+	noShows, err := server.CheckNoShows(ctx, early.ArrivalTime.AsTime().Add(6*time.Minute))
+	if err != nil || noShows != 1 {
+		t.Fatalf("expected one no-show, got %d, %v", noShows, err)
+	}
+	early, _ = stores.Requests.GetRideRequest(ctx, "early")
+	if early.Status != lastmilev1.RideStatus_RIDE_STATUS_CANCELED || early.Cancellation.GetReason() != lastmilev1.CancellationReason_CANCELLATION_REASON_SYSTEM_RIDER_NO_SHOW {
+		t.Fatalf("expected early to be a no-show, got %v", early)
+	}
+	if trip, _ := stores.Trips.GetTrip(ctx, trips[0].TripId); trip.Status != lastmilev1.TripStatus_TRIP_STATUS_CANCELED {
+		t.Fatalf("expected the no-show leg to be canceled, got %s", trip.Status)
+	}
+	if late, _ := stores.Requests.GetRideRequest(ctx, "late"); late.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		t.Fatalf("expected late to keep its ride, got %s", late.Status)
+	}
+	if seats, _ := stores.Seats.GetSeats(ctx, "d1"); seats.AvailableSeats != 1 {
+		t.Fatalf("expected the no-show seat to be released, got %d free", seats.AvailableSeats)
+	}
+	// A repeated count for the same request is ignored.
+	if err := users.AddRiderNoShow(ctx, "early", "early"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if profile, _ := users.GetRider(ctx, "early"); profile.NoShowCount != 1 {
+		t.Fatalf("expected one no-show on the rider, got %d", profile.NoShowCount)
+	}
+
+	// The released seat goes to a reliable rider first, even one arriving
+	// later.
+	base := early.ArrivalTime.AsTime()
+	for _, request := range []*lastmilev1.RideRequest{
+		{RequestId: "again", RiderId: "early", StationId: "s1", DestinationId: "x", ArrivalTime: timestamppb.New(base)},
+		{RequestId: "new", RiderId: "new", StationId: "s1", DestinationId: "x", ArrivalTime: timestamppb.New(base.Add(time.Hour))},
+	} {
+		request.Status = lastmilev1.RideStatus_RIDE_STATUS_PENDING
+		if err := stores.Requests.CreateRideRequest(ctx, request); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	resp, err := server.RunMatching(ctx, &lastmilev1.RunMatchingRequest{StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Match.Assignments) != 1 || resp.Match.Assignments[0].RiderId != "new" {
+		t.Fatalf("expected the rider without no-shows to be matched, got %v", resp.Match.Assignments)
+	}
+}
+
+func newStores(t *testing.T) Stores {
+	t.Helper()
+	ctx := context.Background()
+	outbox := storage.NewMemoryOutbox()
+	stores := Stores{
+		Requests: storage.NewMemoryRideRequestStore(outbox),
+		Trips:    storage.NewMemoryTripStore(outbox),
+		Seats:    storage.NewMemorySeatStore(),
+		Drivers:  storage.NewMemoryUserStore(),
+		Shifts:   storage.NewMemoryShiftStore(),
+		Outbox:   outbox,
+	}
+	base := time.Now().Add(time.Hour)
+	for i, request := range []*lastmilev1.RideRequest{
+		{RequestId: "late", RiderId: "late", StationId: "s1", DestinationId: "x", ArrivalTime: timestamppb.New(base.Add(10 * time.Minute))},
+		{RequestId: "early", RiderId: "early", StationId: "s1", DestinationId: "x", ArrivalTime: timestamppb.New(base)},
+		{RequestId: "other", RiderId: "other-station", StationId: "s2", DestinationId: "x", ArrivalTime: timestamppb.New(base)},
+	} {
+		request.Status = lastmilev1.RideStatus_RIDE_STATUS_PENDING
+		if err := stores.Requests.CreateRideRequest(ctx, request); err != nil {
+			t.Fatalf("seed request %d: %v", i, err)
+		}
+	}
+	for _, driver := range []*lastmilev1.DriverProfile{
+		{DriverId: "d1", Name: "Dev", Status: lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE},
+		{DriverId: "d2", Name: "Devi", Status: lastmilev1.DriverStatus_DRIVER_STATUS_SUSPENDED},
+		{DriverId: "d3", Name: "Dara", Status: lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE},
+	} {
+		if err := stores.Drivers.CreateDriver(ctx, driver); err != nil {
+			t.Fatalf("seed driver %s: %v", driver.DriverId, err)
+		}
+	}
+	for _, driverID := range []string{"d1", "d2"} {
+		if err := stores.Shifts.StartShift(ctx, &lastmilev1.DriverShift{
+			ShiftId:   "shift-" + driverID,
+			DriverId:  driverID,
+			StartedAt: timestamppb.Now(),
+		}); err != nil {
+			t.Fatalf("seed shift %s: %v", driverID, err)
+		}
+	}
+	for _, seats := range []*lastmilev1.SeatAvailability{
+		{DriverId: "d1", AvailableSeats: 2},
+		{DriverId: "d2", AvailableSeats: 4},
+		{DriverId: "d3", AvailableSeats: 6},
+	} {
+		if err := stores.Seats.UpsertSeats(ctx, seats); err != nil {
+			t.Fatalf("seed seats: %v", err)
+		}
+	}
+	return stores
+}
+
+func countEvents(t *testing.T, outbox storage.Outbox, stream string) int {
+	t.Helper()
+	entries, err := outbox.ListPending(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("unexpected outbox error: %v", err)
+	}
+	count := 0
+	for _, entry := range entries {
+		if entry.Stream == stream {
+			count++
+		}
+	}
+	return count
+}
+
+func assertStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error with code %s", code.String())
+	}
+	statusErr, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if statusErr.Code() != code {
+		t.Fatalf("expected code %s, got %s", code.String(), statusErr.Code().String())
+	}
+}
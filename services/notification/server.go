@@ -1,11 +1,173 @@
 package notification
 
-import lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
 
 type Server struct {
 	lastmilev1.UnimplementedNotificationServiceServer
+	store storage.NotificationStore
 }
 
 func NewServer() *Server {
-	return &Server{}
+	return NewServerWithStore(storage.NewMemoryNotificationStore())
+}
+
+func NewServerWithStore(store storage.NotificationStore) *Server {
+	if store == nil {
+		store = storage.NewMemoryNotificationStore()
+	}
+	return &Server{store: store}
+}
+
+func (s *Server) SendNotification(ctx context.Context, req *lastmilev1.SendNotificationRequest) (*lastmilev1.SendNotificationResponse, error) {
+	if req == nil || req.Notification == nil {
+		return nil, status.Error(codes.InvalidArgument, "notification is required")
+	}
+	notification := proto.Clone(req.Notification).(*lastmilev1.Notification)
+	notification.RiderId = strings.TrimSpace(notification.RiderId)
+	notification.DriverId = strings.TrimSpace(notification.DriverId)
+	if notification.RiderId == "" && notification.DriverId == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id or driver_id is required")
+	}
+	notification.Title = strings.TrimSpace(notification.Title)
+	if notification.Title == "" {
+		return nil, status.Error(codes.InvalidArgument, "title is required")
+	}
+
+	if err := s.send(ctx, notification); err != nil {
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.SendNotificationResponse{Notification: notification}, nil
+}
+
+func (s *Server) HandleEvent(ctx context.Context, event *lastmilev1.Event) error {
+	switch event.GetType() {
+	case events.TypeTripCreated, events.TypeTripStatusChanged:
+	case events.TypePickupPinIssued:
+		var trip lastmilev1.Trip
+		if err := event.GetPayload().UnmarshalTo(&trip); err != nil {
+			return err
+		}
+		if trip.GetPickup().GetPin() == "" {
+			return nil
+		}
+		return s.send(ctx, &lastmilev1.Notification{
+			RiderId: trip.RiderId,
+			Title:   tripTitle(trip.Status),
+			Body: fmt.Sprintf("Trip %s from station %s is %s. Your pickup PIN is %s; tell it to your driver when you board.",
+				trip.TripId, trip.StationId, tripStatusText(trip.Status), trip.Pickup.Pin),
+		})
+	case events.TypeRideRequestRescheduled:
+		var request lastmilev1.RideRequest
+		if err := event.GetPayload().UnmarshalTo(&request); err != nil {
+			return err
+		}
+		return s.send(ctx, rescheduledNotification(&request))
+	default:
+		return nil
+	}
+	var trip lastmilev1.Trip
+	if err := event.GetPayload().UnmarshalTo(&trip); err != nil {
+		return err
+	}
+	if trip.GetCancellation().GetReason() == lastmilev1.CancellationReason_CANCELLATION_REASON_SYSTEM_RIDER_NO_SHOW {
+		if err := s.send(ctx, &lastmilev1.Notification{
+			RiderId: trip.RiderId,
+			Title:   "You missed your ride",
+			Body:    fmt.Sprintf("Your driver waited at station %s but you did not board, so trip %s left without you. Book again when you are ready.", trip.StationId, trip.TripId),
+		}); err != nil {
+			return err
+		}
+		return s.send(ctx, &lastmilev1.Notification{
+			DriverId: trip.DriverId,
+			Title:    "Rider did not show up",
+			Body:     fmt.Sprintf("The rider for trip %s did not board at station %s. The trip is canceled and the seat is free again.", trip.TripId, trip.StationId),
+		})
+	}
+	if event.GetType() == events.TypeTripCreated && trip.GetPickup() != nil {
+		// The rider gets the booking with their PIN from pickup_pin_issued.
+		return s.send(ctx, &lastmilev1.Notification{
+			DriverId: trip.DriverId,
+			Title:    "New rider assigned",
+			Body:     fmt.Sprintf("Trip %s from station %s is %s. Ask the rider for their pickup PIN when they board.", trip.TripId, trip.StationId, tripStatusText(trip.Status)),
+		})
+	}
+	return s.send(ctx, &lastmilev1.Notification{
+		RiderId:  trip.RiderId,
+		DriverId: trip.DriverId,
+		Title:    tripTitle(trip.Status),
+		Body:     fmt.Sprintf("Trip %s from station %s is %s.", trip.TripId, trip.StationId, tripStatusText(trip.Status)),
+	})
+}
+
+func (s *Server) send(ctx context.Context, notification *lastmilev1.Notification) error {
+	if strings.TrimSpace(notification.NotificationId) == "" {
+		notification.NotificationId = newID("notification")
+	}
+	if notification.CreatedAt == nil {
+		notification.CreatedAt = timestamppb.Now()
+	}
+	return s.store.CreateNotification(ctx, notification)
+}
+
+func tripTitle(tripStatus lastmilev1.TripStatus) string {
+	switch tripStatus {
+	case lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED:
+		return "Your ride is booked"
+	case lastmilev1.TripStatus_TRIP_STATUS_ACTIVE:
+		return "Your ride has started"
+	case lastmilev1.TripStatus_TRIP_STATUS_COMPLETED:
+		return "You have arrived"
+	case lastmilev1.TripStatus_TRIP_STATUS_CANCELED:
+		return "Your ride was canceled"
+	default:
+		return "Trip update"
+	}
+}
+
+func rescheduledNotification(request *lastmilev1.RideRequest) *lastmilev1.Notification {
+	minutes := (time.Duration(request.GetTrain().GetDelaySeconds()) * time.Second).Round(time.Minute) / time.Minute
+	title := "Your train is running late"
+	body := fmt.Sprintf("Your train is %d min late.", minutes)
+	if minutes < 0 {
+		title = "Your train is running early"
+		body = fmt.Sprintf("Your train is %d min early.", -minutes)
+	} else if minutes == 0 {
+		title = "Your train is back on time"
+		body = "Your train is on time again."
+	}
+	return &lastmilev1.Notification{
+		RiderId: request.RiderId,
+		Title:   title,
+		Body: fmt.Sprintf("%s Pickup at station %s is now planned for %s UTC.",
+			body, request.StationId, request.GetArrivalTime().AsTime().UTC().Format("15:04")),
+	}
+}
+
+func tripStatusText(tripStatus lastmilev1.TripStatus) string {
+	return strings.ToLower(strings.TrimPrefix(tripStatus.String(), "TRIP_STATUS_"))
+}
+
+func newID(prefix string) string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return prefix + "_" + hex.EncodeToString(buf)
 }
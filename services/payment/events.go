@@ -0,0 +1,75 @@
+package payment
+
+import (
+	"context"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HandleEvent holds a ride request's locked fare when it is created, refunds
+// it less any cancellation fee when the request is canceled and captures it
+// when the trip completes.
+// Requests booked without a quote carry no fare and are not charged.
+func (s *Server) HandleEvent(ctx context.Context, event *lastmilev1.Event) error {
+	var err error
+	switch event.GetType() {
+	case events.TypeRideRequestCreated:
+		var request lastmilev1.RideRequest
+		if err := event.GetPayload().UnmarshalTo(&request); err != nil {
+			return err
+		}
+		if request.GetFare().GetAmountMinor() <= 0 {
+			return nil
+		}
+		amount, amountErr := s.amount(request.Fare)
+		if amountErr != nil {
+			return s.dropped(event, amountErr)
+		}
+		_, err = s.hold(ctx, request.RequestId, request.RiderId, amount)
+	case events.TypeRideRequestStatusChanged:
+		var request lastmilev1.RideRequest
+		if err := event.GetPayload().UnmarshalTo(&request); err != nil {
+			return err
+		}
+		if request.Status != lastmilev1.RideStatus_RIDE_STATUS_CANCELED {
+			return nil
+		}
+		_, err = s.RefundFare(ctx, &lastmilev1.RefundFareRequest{
+			RequestId:       request.RequestId,
+			CancellationFee: request.GetCancellation().GetFee(),
+		})
+	case events.TypeTripStatusChanged:
+		var trip lastmilev1.Trip
+		if err := event.GetPayload().UnmarshalTo(&trip); err != nil {
+			return err
+		}
+		if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_COMPLETED || trip.RequestId == "" {
+			return nil
+		}
+		_, err = s.CaptureFare(ctx, &lastmilev1.CaptureFareRequest{RequestId: trip.RequestId, DriverId: trip.DriverId})
+	default:
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	switch status.Code(err) {
+	case codes.NotFound:
+		// Nothing was held, e.g. the request had no locked fare.
+		return nil
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		return s.dropped(event, err)
+	}
+	return err
+}
+
+// dropped logs an event that retrying cannot settle and acknowledges it.
+func (s *Server) dropped(event *lastmilev1.Event, err error) error {
+	logger := observability.Logger()
+	logger.Warn().Err(err).Str("event_id", event.GetId()).Str("event_type", event.GetType()).Msg("payment not recorded")
+	return nil
+}
@@ -0,0 +1,55 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+)
+
+// ErrDeclined is returned by a PaymentProvider that refuses a charge or
+// payout; retrying will not help.
+var ErrDeclined = errors.New("payment declined")
+
+// PaymentProvider moves money between the platform and riders' and drivers'
+// own payment methods. Both calls must be idempotent on key and return the
+// provider's reference for the movement.
+type PaymentProvider interface {
+	Charge(ctx context.Context, riderID string, amount *lastmilev1.Money, key string) (string, error)
+	Payout(ctx context.Context, driverID string, amount *lastmilev1.Money, key string) (string, error)
+}
+
+// FakeProvider accepts every charge and payout without moving real money,
+// until a payment provider is integrated.
+type FakeProvider struct {
+	mu   sync.Mutex
+	refs map[string]string
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{refs: make(map[string]string)}
+}
+
+func (p *FakeProvider) Charge(_ context.Context, riderID string, amount *lastmilev1.Money, key string) (string, error) {
+	return p.reference("ch", riderID, amount, key)
+}
+
+func (p *FakeProvider) Payout(_ context.Context, driverID string, amount *lastmilev1.Money, key string) (string, error) {
+	return p.reference("po", driverID, amount, key)
+}
+
+func (p *FakeProvider) reference(kind, party string, amount *lastmilev1.Money, key string) (string, error) {
+	if party == "" || key == "" || amount.GetAmountMinor() <= 0 {
+		return "", ErrDeclined
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ref, ok := p.refs[kind+key]; ok {
+		return ref, nil
+	}
+	ref := fmt.Sprintf("fake_%s_%d", kind, len(p.refs)+1)
+	p.refs[kind+key] = ref
+	return ref, nil
+}
@@ -0,0 +1,602 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	escrowAccount   = "escrow"
+	platformAccount = "platform"
+	providerAccount = "provider"
+	// Charges and payouts are reserved in these accounts before the provider
+	// is called and move to providerAccount once it confirms.
+	pendingChargesAccount = "provider:pending_charges"
+	pendingPayoutsAccount = "provider:pending_payouts"
+)
+
+type Server struct {
+	lastmilev1.UnimplementedPaymentServiceServer
+	ledger     storage.LedgerStore
+	provider   PaymentProvider
+	currency   string
+	commission float64
+	now        func() time.Time
+}
+
+type Stores struct {
+	Ledger   storage.LedgerStore
+	Provider PaymentProvider
+	// Currency is the only currency the ledger accepts; empty means INR.
+	Currency string
+	// Commission is the platform's share of each captured fare, in [0, 1).
+	Commission float64
+}
+
+func NewServer() *Server {
+	return NewServerWithStores(Stores{})
+}
+
+func NewServerWithStores(stores Stores) *Server {
+	if stores.Ledger == nil {
+		stores.Ledger = storage.NewMemoryLedgerStore()
+	}
+	if stores.Provider == nil {
+		stores.Provider = NewFakeProvider()
+	}
+	if stores.Currency == "" {
+		stores.Currency = "INR"
+	}
+	return &Server{
+		ledger:     stores.Ledger,
+		provider:   stores.Provider,
+		currency:   stores.Currency,
+		commission: stores.Commission,
+		now:        time.Now,
+	}
+}
+
+func (s *Server) TopUpWallet(ctx context.Context, req *lastmilev1.TopUpWalletRequest) (*lastmilev1.TopUpWalletResponse, error) {
+	riderID := strings.TrimSpace(req.GetRiderId())
+	if riderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id is required")
+	}
+	amount, err := s.amount(req.GetAmount())
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.GetIdempotencyKey()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "idempotency_key is required")
+	}
+	key := "topup:" + riderID + ":" + strings.TrimSpace(req.IdempotencyKey)
+	tx, err := s.replay(ctx, key, riderAccount(riderID), amount)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		ref, err := s.provider.Charge(ctx, riderID, s.money(amount), key)
+		if err != nil {
+			return nil, providerStatus(err)
+		}
+		tx, err = s.post(ctx, &lastmilev1.LedgerTransaction{
+			IdempotencyKey:    key,
+			Kind:              lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_TOP_UP,
+			Entries:           []*lastmilev1.LedgerEntry{s.entry(providerAccount, -amount), s.entry(riderAccount(riderID), amount)},
+			RiderId:           riderID,
+			ProviderReference: ref,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	wallet, err := s.account(ctx, riderAccount(riderID))
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.TopUpWalletResponse{Transaction: tx, Wallet: wallet}, nil
+}
+
+func (s *Server) HoldFare(ctx context.Context, req *lastmilev1.HoldFareRequest) (*lastmilev1.HoldFareResponse, error) {
+	requestID := strings.TrimSpace(req.GetRequestId())
+	riderID := strings.TrimSpace(req.GetRiderId())
+	if requestID == "" || riderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "request_id and rider_id are required")
+	}
+	amount, err := s.amount(req.GetAmount())
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.hold(ctx, requestID, riderID, amount)
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.HoldFareResponse{Transaction: tx}, nil
+}
+
+// hold moves amount from the rider's wallet to escrow. The part the wallet
+// does not cover is booked against pendingChargesAccount in the same
+// transaction, so concurrent holds cannot spend the wallet twice, and then
+// charged through the provider.
+func (s *Server) hold(ctx context.Context, requestID, riderID string, amount int64) (*lastmilev1.LedgerTransaction, error) {
+	key := "hold:" + requestID
+	wallet := riderAccount(riderID)
+	existing, err := s.replay(ctx, key, escrowAccount, amount)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if err := s.collect(ctx, existing); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+	balance, err := s.account(ctx, wallet)
+	if err != nil {
+		return nil, err
+	}
+	tx := &lastmilev1.LedgerTransaction{
+		IdempotencyKey: key,
+		Kind:           lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_HOLD,
+		RiderId:        riderID,
+		RequestId:      requestID,
+	}
+	if shortfall := amount - max(balance.Balance.AmountMinor, 0); shortfall > 0 {
+		tx.Entries = append(tx.Entries, s.entry(pendingChargesAccount, -shortfall), s.entry(wallet, shortfall))
+	}
+	tx.Entries = append(tx.Entries, s.entry(wallet, -amount), s.entry(escrowAccount, amount))
+	if tx, err = s.post(ctx, tx, wallet); err != nil {
+		return nil, err
+	}
+	if err := s.collect(ctx, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// collect charges the part of a hold its wallet did not cover. Unavailable
+// providers leave the charge pending for a retry; a declined charge refunds
+// the hold under the settle key, so the fare cannot be captured.
+func (s *Server) collect(ctx context.Context, held *lastmilev1.LedgerTransaction) error {
+	shortfall := -amountFor(held, pendingChargesAccount)
+	if shortfall <= 0 {
+		return nil
+	}
+	key := held.IdempotencyKey + ":charge"
+	charged, err := s.transaction(ctx, key)
+	if err != nil || charged != nil {
+		return err
+	}
+	settledTx, err := s.transaction(ctx, "settle:"+held.RequestId)
+	if err != nil {
+		return err
+	}
+	if settledTx != nil {
+		return status.Error(codes.FailedPrecondition, "payment declined")
+	}
+	ref, err := s.provider.Charge(ctx, held.RiderId, s.money(shortfall), held.IdempotencyKey)
+	if errors.Is(err, ErrDeclined) {
+		fare := amountFor(held, escrowAccount)
+		refund := &lastmilev1.LedgerTransaction{
+			IdempotencyKey: "settle:" + held.RequestId,
+			Kind:           lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_REFUND,
+			Entries:        []*lastmilev1.LedgerEntry{s.entry(escrowAccount, -fare), s.entry(pendingChargesAccount, shortfall)},
+			RiderId:        held.RiderId,
+			RequestId:      held.RequestId,
+		}
+		if covered := fare - shortfall; covered > 0 {
+			refund.Entries = append(refund.Entries, s.entry(riderAccount(held.RiderId), covered))
+		}
+		if _, err := s.post(ctx, refund); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return providerStatus(err)
+	}
+	_, err = s.post(ctx, &lastmilev1.LedgerTransaction{
+		IdempotencyKey:    key,
+		Kind:              lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_HOLD,
+		Entries:           []*lastmilev1.LedgerEntry{s.entry(providerAccount, -shortfall), s.entry(pendingChargesAccount, shortfall)},
+		RiderId:           held.RiderId,
+		RequestId:         held.RequestId,
+		ProviderReference: ref,
+	})
+	return err
+}
+
+func (s *Server) CaptureFare(ctx context.Context, req *lastmilev1.CaptureFareRequest) (*lastmilev1.CaptureFareResponse, error) {
+	requestID := strings.TrimSpace(req.GetRequestId())
+	driverID := strings.TrimSpace(req.GetDriverId())
+	if requestID == "" || driverID == "" {
+		return nil, status.Error(codes.InvalidArgument, "request_id and driver_id are required")
+	}
+	tx, err := s.settle(ctx, requestID, lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_CAPTURE, func(held *lastmilev1.LedgerTransaction, fare int64) *lastmilev1.LedgerTransaction {
+		commission := int64(math.Round(float64(fare) * s.commission))
+		return &lastmilev1.LedgerTransaction{
+			Entries: []*lastmilev1.LedgerEntry{
+				s.entry(escrowAccount, -fare),
+				s.entry(driverAccount(driverID), fare-commission),
+				s.entry(platformAccount, commission),
+			},
+			DriverId: driverID,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.CaptureFareResponse{Transaction: tx}, nil
+}
+
+func (s *Server) RefundFare(ctx context.Context, req *lastmilev1.RefundFareRequest) (*lastmilev1.RefundFareResponse, error) {
+	requestID := strings.TrimSpace(req.GetRequestId())
+	if requestID == "" {
+		return nil, status.Error(codes.InvalidArgument, "request_id is required")
+	}
+	var fee int64
+	if req.CancellationFee != nil {
+		var err error
+		if fee, err = s.amount(req.CancellationFee); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := s.settle(ctx, requestID, lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_REFUND, func(held *lastmilev1.LedgerTransaction, fare int64) *lastmilev1.LedgerTransaction {
+		fee := min(fee, fare)
+		tx := &lastmilev1.LedgerTransaction{
+			Entries: []*lastmilev1.LedgerEntry{s.entry(escrowAccount, -fare)},
+		}
+		if fee < fare {
+			tx.Entries = append(tx.Entries, s.entry(riderAccount(held.RiderId), fare-fee))
+		}
+		if fee > 0 {
+			tx.Entries = append(tx.Entries, s.entry(platformAccount, fee))
+		}
+		return tx
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.RefundFareResponse{Transaction: tx}, nil
+}
+
+// settle releases a ride request's held fare with the entries build returns.
+// Capture and refund share one idempotency key, so a fare is settled once.
+func (s *Server) settle(ctx context.Context, requestID string, kind lastmilev1.LedgerTransactionKind, build func(held *lastmilev1.LedgerTransaction, fare int64) *lastmilev1.LedgerTransaction) (*lastmilev1.LedgerTransaction, error) {
+	held, err := s.ledger.GetTransactionByKey(ctx, "hold:"+requestID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "no fare held for ride request")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	key := "settle:" + requestID
+	existing, err := s.transaction(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		// The fare is only settled once the provider collected it; a
+		// declined charge refunds it instead.
+		if err := s.collect(ctx, held); err != nil {
+			if status.Code(err) != codes.FailedPrecondition {
+				return nil, err
+			}
+			if existing, err = s.transaction(ctx, key); err != nil || existing == nil {
+				return nil, status.Error(codes.Internal, "storage error")
+			}
+		}
+	}
+	if existing != nil {
+		return settled(existing, kind)
+	}
+	tx := build(held, amountFor(held, escrowAccount))
+	tx.IdempotencyKey = key
+	tx.Kind = kind
+	tx.RiderId = held.RiderId
+	tx.RequestId = requestID
+	tx, err = s.post(ctx, tx, escrowAccount)
+	if status.Code(err) == codes.AlreadyExists {
+		existing, err := s.ledger.GetTransactionByKey(ctx, key)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "storage error")
+		}
+		return settled(existing, kind)
+	}
+	return tx, err
+}
+
+func settled(tx *lastmilev1.LedgerTransaction, kind lastmilev1.LedgerTransactionKind) (*lastmilev1.LedgerTransaction, error) {
+	switch {
+	case tx.Kind == kind:
+		return tx, nil
+	case tx.Kind == lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_CAPTURE:
+		return nil, status.Error(codes.FailedPrecondition, "fare already captured")
+	default:
+		return nil, status.Error(codes.FailedPrecondition, "fare already refunded")
+	}
+}
+
+func (s *Server) PayoutDriver(ctx context.Context, req *lastmilev1.PayoutDriverRequest) (*lastmilev1.PayoutDriverResponse, error) {
+	driverID := strings.TrimSpace(req.GetDriverId())
+	if driverID == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	if strings.TrimSpace(req.GetIdempotencyKey()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "idempotency_key is required")
+	}
+	earnings := driverAccount(driverID)
+	balance, err := s.account(ctx, earnings)
+	if err != nil {
+		return nil, err
+	}
+	amount := balance.Balance.AmountMinor
+	if req.Amount != nil {
+		if amount, err = s.amount(req.Amount); err != nil {
+			return nil, err
+		}
+	}
+	key := "payout:" + driverID + ":" + strings.TrimSpace(req.IdempotencyKey)
+	reserved, err := s.transaction(ctx, key)
+	switch {
+	case err != nil:
+		return nil, err
+	case reserved != nil:
+		// A replay may not know the original amount when it paid out the
+		// whole balance, so only an explicit amount is compared.
+		if req.Amount != nil && -amountFor(reserved, earnings) != amount {
+			return nil, status.Error(codes.FailedPrecondition, "idempotency_key was used for a different request")
+		}
+	default:
+		if amount <= 0 {
+			return nil, status.Error(codes.FailedPrecondition, "nothing to pay out")
+		}
+		if amount > balance.Balance.AmountMinor {
+			return nil, status.Error(codes.FailedPrecondition, "insufficient balance")
+		}
+		// The earnings are reserved before the provider is called, so
+		// concurrent payouts cannot both be sent for the same balance.
+		reserved, err = s.post(ctx, &lastmilev1.LedgerTransaction{
+			IdempotencyKey: key,
+			Kind:           lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_PAYOUT,
+			Entries:        []*lastmilev1.LedgerEntry{s.entry(earnings, -amount), s.entry(pendingPayoutsAccount, amount)},
+			DriverId:       driverID,
+		}, earnings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tx, err := s.payout(ctx, reserved)
+	if err != nil {
+		return nil, err
+	}
+	balance, err = s.account(ctx, earnings)
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.PayoutDriverResponse{Transaction: tx, Earnings: balance}, nil
+}
+
+// payout sends a reserved payout through the provider and returns the
+// transaction confirming it. Unavailable providers leave it reserved for a
+// retry with the same key; a declined payout returns the earnings.
+func (s *Server) payout(ctx context.Context, reserved *lastmilev1.LedgerTransaction) (*lastmilev1.LedgerTransaction, error) {
+	paidKey := reserved.IdempotencyKey + ":paid"
+	reversedKey := reserved.IdempotencyKey + ":reversed"
+	paid, err := s.transaction(ctx, paidKey)
+	if err != nil || paid != nil {
+		return paid, err
+	}
+	reversed, err := s.transaction(ctx, reversedKey)
+	if err != nil {
+		return nil, err
+	}
+	if reversed != nil {
+		return nil, status.Error(codes.FailedPrecondition, "payment declined")
+	}
+	amount := amountFor(reserved, pendingPayoutsAccount)
+	earnings := driverAccount(reserved.DriverId)
+	ref, err := s.provider.Payout(ctx, reserved.DriverId, s.money(amount), reserved.IdempotencyKey)
+	if errors.Is(err, ErrDeclined) {
+		if _, err := s.post(ctx, &lastmilev1.LedgerTransaction{
+			IdempotencyKey: reversedKey,
+			Kind:           lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_REVERSAL,
+			Entries:        []*lastmilev1.LedgerEntry{s.entry(pendingPayoutsAccount, -amount), s.entry(earnings, amount)},
+			DriverId:       reserved.DriverId,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, providerStatus(err)
+	}
+	return s.post(ctx, &lastmilev1.LedgerTransaction{
+		IdempotencyKey:    paidKey,
+		Kind:              lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_PAYOUT,
+		Entries:           []*lastmilev1.LedgerEntry{s.entry(pendingPayoutsAccount, -amount), s.entry(providerAccount, amount)},
+		DriverId:          reserved.DriverId,
+		ProviderReference: ref,
+	})
+}
+
+func (s *Server) GetAccount(ctx context.Context, req *lastmilev1.GetAccountRequest) (*lastmilev1.GetAccountResponse, error) {
+	accountID := strings.TrimSpace(req.GetAccountId())
+	if accountID == "" {
+		return nil, status.Error(codes.InvalidArgument, "account_id is required")
+	}
+	account, err := s.account(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.GetAccountResponse{Account: account}, nil
+}
+
+func (s *Server) ListTransactions(ctx context.Context, req *lastmilev1.ListTransactionsRequest) (*lastmilev1.ListTransactionsResponse, error) {
+	accountID := strings.TrimSpace(req.GetAccountId())
+	if accountID == "" {
+		return nil, status.Error(codes.InvalidArgument, "account_id is required")
+	}
+	pageSize := req.GetPageSize()
+	if pageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must be positive")
+	}
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	pageSize = min(pageSize, 100)
+	filter := pagetoken.FilterHash("ledger_transactions", accountID)
+	after := ""
+	if req.GetPageToken() != "" {
+		key, err := pagetoken.Decode(req.GetPageToken(), filter)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = key
+	}
+
+	transactions, next, err := s.ledger.ListTransactions(ctx, accountID, after, int(pageSize))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	resp := &lastmilev1.ListTransactionsResponse{Transactions: transactions}
+	if next != "" {
+		resp.NextPageToken = pagetoken.Encode(next, filter)
+	}
+	return resp, nil
+}
+
+func (s *Server) CheckLedger(ctx context.Context, _ *lastmilev1.CheckLedgerRequest) (*lastmilev1.CheckLedgerResponse, error) {
+	check, err := s.ledger.Check(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.CheckLedgerResponse{
+		Consistent:          len(check.Problems) == 0,
+		TransactionsChecked: check.Transactions,
+		AccountsChecked:     check.Accounts,
+		Problems:            check.Problems,
+	}, nil
+}
+
+// replay returns the transaction already posted under key, or nil. A key
+// reused with a different amount for account is rejected.
+func (s *Server) replay(ctx context.Context, key, accountID string, amount int64) (*lastmilev1.LedgerTransaction, error) {
+	tx, err := s.transaction(ctx, key)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	if amountFor(tx, accountID) != amount {
+		return nil, status.Error(codes.FailedPrecondition, "idempotency_key was used for a different request")
+	}
+	return tx, nil
+}
+
+// transaction returns the transaction posted under key, or nil.
+func (s *Server) transaction(ctx context.Context, key string) (*lastmilev1.LedgerTransaction, error) {
+	tx, err := s.ledger.GetTransactionByKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return tx, nil
+}
+
+// post stamps and records tx. A concurrent post of the same key returns the
+// stored transaction.
+func (s *Server) post(ctx context.Context, tx *lastmilev1.LedgerTransaction, noOverdraft ...string) (*lastmilev1.LedgerTransaction, error) {
+	now := s.now()
+	tx.TransactionId = newTransactionID(now)
+	tx.CreatedAt = timestamppb.New(now)
+	stored, err := s.ledger.Post(ctx, tx, noOverdraft...)
+	switch {
+	case err == nil:
+		return stored, nil
+	case errors.Is(err, storage.ErrAlreadyExists) && stored != nil:
+		if stored.Kind != tx.Kind {
+			return nil, status.Error(codes.AlreadyExists, "idempotency_key was used for a different request")
+		}
+		return stored, nil
+	case errors.Is(err, storage.ErrInsufficientFunds):
+		return nil, status.Error(codes.FailedPrecondition, "insufficient balance")
+	case errors.Is(err, storage.ErrInvalidArgument):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+}
+
+// account returns the account's balance, zero for accounts never posted to.
+func (s *Server) account(ctx context.Context, accountID string) (*lastmilev1.LedgerAccount, error) {
+	account, err := s.ledger.GetAccount(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return &lastmilev1.LedgerAccount{AccountId: accountID, Balance: s.money(0)}, nil
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return account, nil
+}
+
+func (s *Server) amount(money *lastmilev1.Money) (int64, error) {
+	if money.GetAmountMinor() <= 0 {
+		return 0, status.Error(codes.InvalidArgument, "amount must be positive")
+	}
+	if money.CurrencyCode != "" && !strings.EqualFold(money.CurrencyCode, s.currency) {
+		return 0, status.Errorf(codes.InvalidArgument, "currency must be %s", s.currency)
+	}
+	return money.AmountMinor, nil
+}
+
+func (s *Server) money(amount int64) *lastmilev1.Money {
+	return &lastmilev1.Money{CurrencyCode: s.currency, AmountMinor: amount}
+}
+
+func (s *Server) entry(accountID string, amount int64) *lastmilev1.LedgerEntry {
+	return &lastmilev1.LedgerEntry{AccountId: accountID, Amount: s.money(amount)}
+}
+
+// amountFor nets tx's entries for one account.
+func amountFor(tx *lastmilev1.LedgerTransaction, accountID string) int64 {
+	var amount int64
+	for _, entry := range tx.GetEntries() {
+		if entry.AccountId == accountID {
+			amount += entry.GetAmount().GetAmountMinor()
+		}
+	}
+	return amount
+}
+
+func providerStatus(err error) error {
+	if errors.Is(err, ErrDeclined) {
+		return status.Error(codes.FailedPrecondition, "payment declined")
+	}
+	return status.Error(codes.Unavailable, "payment provider unavailable")
+}
+
+func riderAccount(riderID string) string {
+	return "rider:" + riderID
+}
+
+func driverAccount(driverID string) string {
+	return "driver:" + driverID
+}
+
+// newTransactionID sorts by time so an account's transactions page in order.
+func newTransactionID(at time.Time) string {
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+	return fmt.Sprintf("txn_%020d_%s", at.UnixNano(), hex.EncodeToString(buf))
+}
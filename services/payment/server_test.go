@@ -0,0 +1,313 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTopUpWalletIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	server := NewServerWithStores(Stores{Currency: "INR"})
+	req := &lastmilev1.TopUpWalletRequest{RiderId: "r1", Amount: &lastmilev1.Money{CurrencyCode: "INR", AmountMinor: 5000}, IdempotencyKey: "k1"}
+
+	first, err := server.TopUpWallet(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.Wallet.Balance.AmountMinor != 5000 || first.Transaction.ProviderReference == "" {
+		t.Fatalf("unexpected top-up: %v", first)
+	}
+	again, err := server.TopUpWallet(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again.Transaction.TransactionId != first.Transaction.TransactionId || again.Wallet.Balance.AmountMinor != 5000 {
+		t.Fatalf("expected replay of the first top-up, got %v", again)
+	}
+
+	_, err = server.TopUpWallet(ctx, &lastmilev1.TopUpWalletRequest{RiderId: "r1", Amount: &lastmilev1.Money{AmountMinor: 100}, IdempotencyKey: "k1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	_, err = server.TopUpWallet(ctx, &lastmilev1.TopUpWalletRequest{RiderId: "r1", Amount: &lastmilev1.Money{CurrencyCode: "USD", AmountMinor: 100}, IdempotencyKey: "k2"})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = server.TopUpWallet(ctx, &lastmilev1.TopUpWalletRequest{RiderId: "r1", Amount: &lastmilev1.Money{AmountMinor: 100}})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	declining := NewServerWithStores(Stores{Provider: providerFunc(func() (string, error) { return "", ErrDeclined })})
+	_, err = declining.TopUpWallet(ctx, &lastmilev1.TopUpWalletRequest{RiderId: "r1", Amount: &lastmilev1.Money{AmountMinor: 100}, IdempotencyKey: "k1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+}
+
+func TestCancellationFeeKeptFromRefund(t *testing.T) {
+	server := NewServerWithStores(Stores{})
+	fare := &lastmilev1.Money{CurrencyCode: "INR", AmountMinor: 2500}
+	deliver(t, server, events.TypeRideRequestCreated, &lastmilev1.RideRequest{RequestId: "req1", RiderId: "r1", Fare: fare})
+	deliver(t, server, events.TypeRideRequestCreated, &lastmilev1.RideRequest{RequestId: "req2", RiderId: "r1", Fare: fare})
+
+	for requestID, fee := range map[string]int64{"req1": 800, "req2": 9999} {
+		deliver(t, server, events.TypeRideRequestStatusChanged, &lastmilev1.RideRequest{
+			RequestId:    requestID,
+			Status:       lastmilev1.RideStatus_RIDE_STATUS_CANCELED,
+			Cancellation: &lastmilev1.Cancellation{Fee: &lastmilev1.Money{CurrencyCode: "INR", AmountMinor: fee}},
+		})
+	}
+	assertBalance(t, server, escrowAccount, 0)
+	assertBalance(t, server, "rider:r1", 1700)
+	assertBalance(t, server, platformAccount, 3300)
+}
+
+func TestFareLifecycleFromEvents(t *testing.T) {
+	ctx := context.Background()
+	server := NewServerWithStores(Stores{Commission: 0.2})
+	if _, err := server.TopUpWallet(ctx, &lastmilev1.TopUpWalletRequest{RiderId: "r1", Amount: &lastmilev1.Money{AmountMinor: 1000}, IdempotencyKey: "k1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fare := &lastmilev1.Money{CurrencyCode: "INR", AmountMinor: 2500}
+	deliver(t, server, events.TypeRideRequestCreated, &lastmilev1.RideRequest{RequestId: "req1", RiderId: "r1", Fare: fare})
+	deliver(t, server, events.TypeRideRequestCreated, &lastmilev1.RideRequest{RequestId: "req1", RiderId: "r1", Fare: fare})
+	deliver(t, server, events.TypeRideRequestCreated, &lastmilev1.RideRequest{RequestId: "req2", RiderId: "r1", Fare: fare})
+	deliver(t, server, events.TypeRideRequestCreated, &lastmilev1.RideRequest{RequestId: "no-quote", RiderId: "r1"})
+	// The wallet covered 1000 of the first hold; the rest was charged.
+	assertBalance(t, server, "rider:r1", 0)
+	assertBalance(t, server, escrowAccount, 5000)
+	assertBalance(t, server, providerAccount, -5000)
+
+	completed := &lastmilev1.Trip{TripId: "t1", DriverId: "d1", RequestId: "req1", Status: lastmilev1.TripStatus_TRIP_STATUS_COMPLETED}
+	deliver(t, server, events.TypeTripStatusChanged, completed)
+	deliver(t, server, events.TypeTripStatusChanged, completed)
+	deliver(t, server, events.TypeRideRequestStatusChanged, &lastmilev1.RideRequest{RequestId: "req1", Status: lastmilev1.RideStatus_RIDE_STATUS_CANCELED})
+	deliver(t, server, events.TypeRideRequestStatusChanged, &lastmilev1.RideRequest{RequestId: "req2", Status: lastmilev1.RideStatus_RIDE_STATUS_CANCELED})
+	deliver(t, server, events.TypeRideRequestStatusChanged, &lastmilev1.RideRequest{RequestId: "no-quote", Status: lastmilev1.RideStatus_RIDE_STATUS_CANCELED})
+	assertBalance(t, server, escrowAccount, 0)
+	assertBalance(t, server, "driver:d1", 2000)
+	assertBalance(t, server, platformAccount, 500)
+	assertBalance(t, server, "rider:r1", 2500)
+
+	_, err := server.RefundFare(ctx, &lastmilev1.RefundFareRequest{RequestId: "req1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	_, err = server.CaptureFare(ctx, &lastmilev1.CaptureFareRequest{RequestId: "req2", DriverId: "d1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	_, err = server.CaptureFare(ctx, &lastmilev1.CaptureFareRequest{RequestId: "unknown", DriverId: "d1"})
+	assertStatusCode(t, err, codes.NotFound)
+
+	transactions, err := server.ListTransactions(ctx, &lastmilev1.ListTransactionsRequest{AccountId: "rider:r1", PageSize: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(transactions.Transactions) != 2 || transactions.Transactions[0].Kind != lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_TOP_UP || transactions.NextPageToken == "" {
+		t.Fatalf("unexpected first page: %v", transactions)
+	}
+	rest, err := server.ListTransactions(ctx, &lastmilev1.ListTransactionsRequest{AccountId: "rider:r1", PageSize: 2, PageToken: transactions.NextPageToken})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rest.Transactions) != 2 || rest.Transactions[1].Kind != lastmilev1.LedgerTransactionKind_LEDGER_TRANSACTION_KIND_REFUND || rest.NextPageToken != "" {
+		t.Fatalf("unexpected second page: %v", rest)
+	}
+
+	check, err := server.CheckLedger(ctx, &lastmilev1.CheckLedgerRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !check.Consistent || check.TransactionsChecked != 7 || check.AccountsChecked != 6 {
+		t.Fatalf("unexpected ledger check: %v", check)
+	}
+}
+
+func TestPayoutDriver(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	if _, err := server.HoldFare(ctx, &lastmilev1.HoldFareRequest{RequestId: "req1", RiderId: "r1", Amount: &lastmilev1.Money{AmountMinor: 3000}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := server.CaptureFare(ctx, &lastmilev1.CaptureFareRequest{RequestId: "req1", DriverId: "d1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := server.PayoutDriver(ctx, &lastmilev1.PayoutDriverRequest{DriverId: "d1", Amount: &lastmilev1.Money{AmountMinor: 5000}, IdempotencyKey: "p1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	partial, err := server.PayoutDriver(ctx, &lastmilev1.PayoutDriverRequest{DriverId: "d1", Amount: &lastmilev1.Money{AmountMinor: 1000}, IdempotencyKey: "p1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if partial.Earnings.Balance.AmountMinor != 2000 {
+		t.Fatalf("unexpected earnings after payout: %v", partial.Earnings)
+	}
+	rest, err := server.PayoutDriver(ctx, &lastmilev1.PayoutDriverRequest{DriverId: "d1", IdempotencyKey: "p2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rest.Earnings.Balance.AmountMinor != 0 || rest.Transaction.Entries[0].Amount.AmountMinor != -2000 {
+		t.Fatalf("expected the whole balance paid out, got %v", rest)
+	}
+	replay, err := server.PayoutDriver(ctx, &lastmilev1.PayoutDriverRequest{DriverId: "d1", IdempotencyKey: "p2"})
+	if err != nil || replay.Transaction.TransactionId != rest.Transaction.TransactionId {
+		t.Fatalf("expected replayed payout, got %v, %v", replay, err)
+	}
+	_, err = server.PayoutDriver(ctx, &lastmilev1.PayoutDriverRequest{DriverId: "d1", IdempotencyKey: "p3"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+}
+
+func TestConcurrentPayoutsReserveBeforeProvider(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	server := NewServerWithStores(Stores{Provider: providerFunc(func() (string, error) {
+		calls.Add(1)
+		return "ref", nil
+	})})
+	if _, err := server.ledger.Post(ctx, &lastmilev1.LedgerTransaction{
+		TransactionId:  "t1",
+		IdempotencyKey: "seed",
+		Entries:        []*lastmilev1.LedgerEntry{server.entry(escrowAccount, -3000), server.entry("driver:d1", 3000)},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var paid atomic.Int32
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := server.PayoutDriver(ctx, &lastmilev1.PayoutDriverRequest{DriverId: "d1", IdempotencyKey: fmt.Sprint(i)})
+			if err == nil {
+				paid.Add(1)
+			} else if status.Code(err) != codes.FailedPrecondition {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if paid.Load() != 1 || calls.Load() != 1 {
+		t.Fatalf("expected one payout sent, got %d paid and %d provider calls", paid.Load(), calls.Load())
+	}
+	assertBalance(t, server, "driver:d1", 0)
+	assertBalance(t, server, pendingPayoutsAccount, 0)
+	assertBalance(t, server, providerAccount, 3000)
+}
+
+func TestDeclinedProviderReleasesReservation(t *testing.T) {
+	ctx := context.Background()
+	var providerErr error
+	server := NewServerWithStores(Stores{Provider: providerFunc(func() (string, error) { return "", providerErr })})
+	if _, err := server.ledger.Post(ctx, &lastmilev1.LedgerTransaction{
+		TransactionId:  "t1",
+		IdempotencyKey: "seed",
+		Entries:        []*lastmilev1.LedgerEntry{server.entry(escrowAccount, -1000), server.entry("driver:d1", 1000)},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An unavailable provider leaves the payout reserved until it is retried.
+	providerErr = errors.New("timeout")
+	_, err := server.PayoutDriver(ctx, &lastmilev1.PayoutDriverRequest{DriverId: "d1", IdempotencyKey: "p1"})
+	assertStatusCode(t, err, codes.Unavailable)
+	assertBalance(t, server, "driver:d1", 0)
+	assertBalance(t, server, pendingPayoutsAccount, 1000)
+
+	providerErr = ErrDeclined
+	_, err = server.PayoutDriver(ctx, &lastmilev1.PayoutDriverRequest{DriverId: "d1", IdempotencyKey: "p1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	assertBalance(t, server, "driver:d1", 1000)
+	assertBalance(t, server, pendingPayoutsAccount, 0)
+
+	// A declined shortfall charge refunds the hold, so it cannot be captured.
+	_, err = server.HoldFare(ctx, &lastmilev1.HoldFareRequest{RequestId: "req1", RiderId: "r1", Amount: &lastmilev1.Money{AmountMinor: 500}})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	assertBalance(t, server, escrowAccount, -1000)
+	assertBalance(t, server, pendingChargesAccount, 0)
+	_, err = server.CaptureFare(ctx, &lastmilev1.CaptureFareRequest{RequestId: "req1", DriverId: "d1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	check, err := server.CheckLedger(ctx, &lastmilev1.CheckLedgerRequest{})
+	if err != nil || !check.Consistent {
+		t.Fatalf("unexpected ledger check: %v, %v", check, err)
+	}
+}
+
+func TestLedgerRejectsUnbalancedTransactions(t *testing.T) {
+	ctx := context.Background()
+	ledger := storage.NewMemoryLedgerStore()
+	unbalanced := &lastmilev1.LedgerTransaction{
+		TransactionId:  "t1",
+		IdempotencyKey: "k1",
+		Entries: []*lastmilev1.LedgerEntry{
+			{AccountId: "a", Amount: &lastmilev1.Money{CurrencyCode: "INR", AmountMinor: -100}},
+			{AccountId: "b", Amount: &lastmilev1.Money{CurrencyCode: "INR", AmountMinor: 90}},
+		},
+	}
+	if _, err := ledger.Post(ctx, unbalanced); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	unbalanced.Entries[1].Amount.AmountMinor = 100
+	if _, err := ledger.Post(ctx, unbalanced, "a"); !errors.Is(err, storage.ErrInsufficientFunds) {
+		t.Fatalf("expected insufficient funds, got %v", err)
+	}
+	if _, err := ledger.Post(ctx, unbalanced); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ledger.Post(ctx, proto.Clone(unbalanced).(*lastmilev1.LedgerTransaction)); !errors.Is(err, storage.ErrAlreadyExists) {
+		t.Fatalf("expected duplicate key to be rejected, got %v", err)
+	}
+	check, err := ledger.Check(ctx)
+	if err != nil || len(check.Problems) != 0 || check.Transactions != 1 || check.Accounts != 2 {
+		t.Fatalf("unexpected check: %+v, %v", check, err)
+	}
+}
+
+type providerFunc func() (string, error)
+
+func (f providerFunc) Charge(context.Context, string, *lastmilev1.Money, string) (string, error) {
+	return f()
+}
+
+func (f providerFunc) Payout(context.Context, string, *lastmilev1.Money, string) (string, error) {
+	return f()
+}
+
+func deliver(t *testing.T, server *Server, eventType string, payload proto.Message) {
+	t.Helper()
+	event, err := events.New(eventType, payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := server.HandleEvent(context.Background(), event); err != nil {
+		t.Fatalf("unexpected handler error: %v", err)
+	}
+}
+
+func assertBalance(t *testing.T, server *Server, accountID string, want int64) {
+	t.Helper()
+	resp, err := server.GetAccount(context.Background(), &lastmilev1.GetAccountRequest{AccountId: accountID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Account.Balance.AmountMinor != want {
+		t.Fatalf("expected %s balance %d, got %d", accountID, want, resp.Account.Balance.AmountMinor)
+	}
+}
+
+func assertStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error with code %s", code.String())
+	}
+	statusErr, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if statusErr.Code() != code {
+		t.Fatalf("expected code %s, got %s", code.String(), statusErr.Code().String())
+	}
+}
@@ -0,0 +1,230 @@
+package pricing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/fare"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultQuoteTTL = 5 * time.Minute
+	maxSeats        = 8
+	// quotePickupSlack is how far the booked arrival time may be from the
+	// quoted pickup time.
+	quotePickupSlack = 15 * time.Minute
+)
+
+// Router measures the driving distance between two points. Without one the
+// service prices the straight-line (haversine) distance.
+type Router interface {
+	RouteDistance(ctx context.Context, from, to *lastmilev1.LatLng) (float64, error)
+}
+
+type Server struct {
+	lastmilev1.UnimplementedPricingServiceServer
+	stations     storage.StationStore
+	destinations storage.DestinationStore
+	requests     storage.RideRequestStore
+	locations    storage.LocationStore
+	shifts       storage.ShiftStore
+	surges       storage.SurgeStore
+	router       Router
+	rules        fare.Rules
+	quoteTTL     time.Duration
+	surge        SurgeConfig
+	now          func() time.Time
+
+	// samples holds each station's surge window in process memory: a
+	// restart starts the window over, and replicas each smooth their own.
+	mu      sync.Mutex
+	samples map[string][]surgeSample
+}
+
+type Stores struct {
+	Stations     storage.StationStore
+	Destinations storage.DestinationStore
+	Router       Router
+	// Requests, Locations and Shifts feed surge pricing: pending ride
+	// requests are demand, recent locations of drivers on shift are supply.
+	Requests  storage.RideRequestStore
+	Locations storage.LocationStore
+	Shifts    storage.ShiftStore
+	Surges    storage.SurgeStore
+
+	Rules fare.Rules
+	// QuoteTTL is how long a quote token stays valid; zero means 5 minutes.
+	QuoteTTL time.Duration
+	Surge    SurgeConfig
+}
+
+func NewServer() *Server {
+	return NewServerWithStores(Stores{})
+}
+
+func NewServerWithStores(stores Stores) *Server {
+	if stores.Stations == nil {
+		stores.Stations = storage.NewMemoryStationStore()
+	}
+	if stores.Destinations == nil {
+		stores.Destinations = storage.NewMemoryDestinationStore()
+	}
+	if stores.Requests == nil {
+		stores.Requests = storage.NewMemoryRideRequestStore(nil)
+	}
+	if stores.Locations == nil {
+		stores.Locations = storage.NewMemoryLocationStore()
+	}
+	if stores.Shifts == nil {
+		stores.Shifts = storage.NewMemoryShiftStore()
+	}
+	if stores.Surges == nil {
+		stores.Surges = storage.NewMemorySurgeStore()
+	}
+	if stores.QuoteTTL <= 0 {
+		stores.QuoteTTL = defaultQuoteTTL
+	}
+	if stores.Surge.Interval <= 0 {
+		stores.Surge.Interval = defaultSurgeInterval
+	}
+	if stores.Surge.Window <= 0 {
+		stores.Surge.Window = defaultSurgeWindow
+	}
+	if stores.Surge.RadiusMeters <= 0 {
+		stores.Surge.RadiusMeters = defaultSurgeRadius
+	}
+	if stores.Surge.Sensitivity <= 0 {
+		stores.Surge.Sensitivity = defaultSurgeSensitivity
+	}
+	if stores.Surge.Max <= 0 {
+		stores.Surge.Max = defaultSurgeMax
+	}
+	return &Server{
+		stations:     stores.Stations,
+		destinations: stores.Destinations,
+		requests:     stores.Requests,
+		locations:    stores.Locations,
+		shifts:       stores.Shifts,
+		surges:       stores.Surges,
+		router:       stores.Router,
+		rules:        stores.Rules,
+		quoteTTL:     stores.QuoteTTL,
+		surge:        stores.Surge,
+		now:          time.Now,
+		samples:      make(map[string][]surgeSample),
+	}
+}
+
+func (s *Server) GetQuote(ctx context.Context, req *lastmilev1.GetQuoteRequest) (*lastmilev1.GetQuoteResponse, error) {
+	if req == nil || strings.TrimSpace(req.StationId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	if strings.TrimSpace(req.DestinationId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "destination_id is required")
+	}
+	seats := max(req.Seats, 1)
+	if seats > maxSeats {
+		return nil, status.Errorf(codes.InvalidArgument, "seats must be at most %d", maxSeats)
+	}
+	now := s.now()
+	pickup := now
+	if req.PickupTime != nil {
+		if !req.PickupTime.IsValid() {
+			return nil, status.Error(codes.InvalidArgument, "pickup_time is invalid")
+		}
+		pickup = req.PickupTime.AsTime()
+	}
+
+	station, err := s.stations.Get(ctx, strings.TrimSpace(req.StationId))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "station not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	destination, err := s.destinations.Get(ctx, strings.TrimSpace(req.DestinationId))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "destination not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	if station.Location == nil || destination.Location == nil {
+		return nil, status.Error(codes.FailedPrecondition, "station or destination has no location")
+	}
+
+	distance := haversineMeters(station.Location, destination.Location)
+	if s.router != nil {
+		distance, err = s.router.RouteDistance(ctx, station.Location, destination.Location)
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, "route distance unavailable")
+		}
+	}
+
+	surge, err := s.surgeMultiplier(ctx, station.StationId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	price := s.rules.Price(distance, int(seats), req.Shared, pickup).WithSurge(surge)
+	expiresAt := now.Add(s.quoteTTL)
+	quote := &lastmilev1.Quote{
+		QuoteId:         newID("quote"),
+		StationId:       station.StationId,
+		DestinationId:   destination.DestinationId,
+		Seats:           seats,
+		Shared:          req.Shared,
+		PickupTime:      timestamppb.New(pickup),
+		DistanceMeters:  distance,
+		BaseFare:        s.money(price.BaseFare),
+		DistanceFare:    s.money(price.DistanceFare),
+		SharedDiscount:  s.money(price.SharedDiscount),
+		PeakMultiplier:  price.PeakMultiplier,
+		Total:           s.money(price.Total),
+		ExpiresAt:       timestamppb.New(expiresAt),
+		SurgeMultiplier: price.SurgeMultiplier,
+	}
+	quote.Token = fare.Sign(fare.Claims{
+		QuoteID:       quote.QuoteId,
+		StationID:     quote.StationId,
+		DestinationID: quote.DestinationId,
+		Seats:         seats,
+		Shared:        req.Shared,
+		Currency:      s.rules.Currency,
+		Total:         price.Total,
+		ExpiresAt:     expiresAt.Unix(),
+		PickupFrom:    pickup.Add(-quotePickupSlack).Unix(),
+		PickupUntil:   pickup.Add(quotePickupSlack).Unix(),
+	})
+	return &lastmilev1.GetQuoteResponse{Quote: quote}, nil
+}
+
+func (s *Server) money(amount int64) *lastmilev1.Money {
+	return &lastmilev1.Money{CurrencyCode: s.rules.Currency, AmountMinor: amount}
+}
+
+func haversineMeters(a, b *lastmilev1.LatLng) float64 {
+	const earthRadiusMeters = 6371000
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func newID(prefix string) string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return prefix + "_" + hex.EncodeToString(buf)
+}
@@ -0,0 +1,148 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/fare"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGetQuote(t *testing.T) {
+	ctx := context.Background()
+	server := newServer(t, nil)
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+
+	resp, err := server.GetQuote(ctx, &lastmilev1.GetQuoteRequest{StationId: "s1", DestinationId: "d1", Seats: 2, Shared: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	quote := resp.Quote
+	// 0.01 degrees of latitude is about 1112 m.
+	if quote.DistanceMeters < 1100 || quote.DistanceMeters > 1125 {
+		t.Fatalf("unexpected distance %v", quote.DistanceMeters)
+	}
+	if quote.BaseFare.AmountMinor != 2000 || quote.DistanceFare.AmountMinor != 2*1112 || quote.PeakMultiplier != 1 {
+		t.Fatalf("unexpected breakdown: %v", quote)
+	}
+	if quote.SharedDiscount.AmountMinor != 422 || quote.Total.AmountMinor != 3802 || quote.Total.CurrencyCode != "INR" {
+		t.Fatalf("unexpected total: %v", quote)
+	}
+	if !quote.ExpiresAt.AsTime().Equal(now.Add(defaultQuoteTTL)) {
+		t.Fatalf("unexpected expiry %v", quote.ExpiresAt.AsTime())
+	}
+	claims, err := fare.Verify(quote.Token, now)
+	if err != nil {
+		t.Fatalf("unexpected token error: %v", err)
+	}
+	if claims.QuoteID != quote.QuoteId || claims.Seats != 2 || !claims.Shared || claims.Total != quote.Total.AmountMinor {
+		t.Fatalf("token does not match quote: %+v", claims)
+	}
+	if !claims.CoversPickup(now.Add(quotePickupSlack)) || claims.CoversPickup(now.Add(quotePickupSlack+time.Second)) {
+		t.Fatalf("unexpected pickup window %+v", claims)
+	}
+
+	peak, err := server.GetQuote(ctx, &lastmilev1.GetQuoteRequest{
+		StationId:     "s1",
+		DestinationId: "d1",
+		PickupTime:    timestamppb.New(time.Date(2026, 3, 2, 8, 30, 0, 0, time.UTC)),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if peak.Quote.Seats != 1 || peak.Quote.PeakMultiplier != 2 || peak.Quote.Total.AmountMinor != 2*(1000+1112) {
+		t.Fatalf("unexpected peak quote: %v", peak.Quote)
+	}
+}
+
+func TestGetQuoteUsesRouter(t *testing.T) {
+	server := newServer(t, routerFunc(func(context.Context, *lastmilev1.LatLng, *lastmilev1.LatLng) (float64, error) {
+		return 5000, nil
+	}))
+	resp, err := server.GetQuote(context.Background(), &lastmilev1.GetQuoteRequest{StationId: "s1", DestinationId: "d1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Quote.DistanceMeters != 5000 || resp.Quote.DistanceFare.AmountMinor != 5000 {
+		t.Fatalf("expected route distance to be priced, got %v", resp.Quote)
+	}
+
+	server.router = routerFunc(func(context.Context, *lastmilev1.LatLng, *lastmilev1.LatLng) (float64, error) {
+		return 0, errors.New("no route")
+	})
+	_, err = server.GetQuote(context.Background(), &lastmilev1.GetQuoteRequest{StationId: "s1", DestinationId: "d1"})
+	assertStatusCode(t, err, codes.Unavailable)
+}
+
+func TestGetQuoteValidation(t *testing.T) {
+	server := newServer(t, nil)
+	cases := []struct {
+		name string
+		req  *lastmilev1.GetQuoteRequest
+		code codes.Code
+	}{
+		{name: "nil request", req: nil, code: codes.InvalidArgument},
+		{name: "missing destination", req: &lastmilev1.GetQuoteRequest{StationId: "s1"}, code: codes.InvalidArgument},
+		{name: "too many seats", req: &lastmilev1.GetQuoteRequest{StationId: "s1", DestinationId: "d1", Seats: 9}, code: codes.InvalidArgument},
+		{name: "unknown station", req: &lastmilev1.GetQuoteRequest{StationId: "nope", DestinationId: "d1"}, code: codes.NotFound},
+		{name: "unknown destination", req: &lastmilev1.GetQuoteRequest{StationId: "s1", DestinationId: "nope"}, code: codes.NotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := server.GetQuote(context.Background(), tc.req)
+			assertStatusCode(t, err, tc.code)
+		})
+	}
+}
+
+type routerFunc func(ctx context.Context, from, to *lastmilev1.LatLng) (float64, error)
+
+func (f routerFunc) RouteDistance(ctx context.Context, from, to *lastmilev1.LatLng) (float64, error) {
+	return f(ctx, from, to)
+}
+
+func newServer(t *testing.T, router Router) *Server {
+	t.Helper()
+	ctx := context.Background()
+	stations := storage.NewMemoryStationStore()
+	destinations := storage.NewMemoryDestinationStore()
+	if err := stations.Upsert(ctx, &lastmilev1.Station{StationId: "s1", Name: "Central", Location: &lastmilev1.LatLng{Latitude: 12.97, Longitude: 77.59}}); err != nil {
+		t.Fatalf("seed station: %v", err)
+	}
+	if err := destinations.Upsert(ctx, &lastmilev1.Destination{DestinationId: "d1", Name: "Office", Location: &lastmilev1.LatLng{Latitude: 12.98, Longitude: 77.59}}); err != nil {
+		t.Fatalf("seed destination: %v", err)
+	}
+	return NewServerWithStores(Stores{
+		Stations:     stations,
+		Destinations: destinations,
+		Router:       router,
+		Rules: fare.Rules{
+			Currency:       "INR",
+			BaseFare:       1000,
+			PerKm:          1000,
+			SharedDiscount: 0.1,
+			Peaks:          []fare.PeakWindow{{Start: 8 * time.Hour, End: 9 * time.Hour, Multiplier: 2}},
+		},
+	})
+}
+
+func assertStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error with code %s", code.String())
+	}
+	statusErr, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if statusErr.Code() != code {
+		t.Fatalf("expected code %s, got %s", code.String(), statusErr.Code().String())
+	}
+}
@@ -0,0 +1,289 @@
+package pricing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/fare"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultSurgeInterval    = 30 * time.Second
+	defaultSurgeWindow      = 10 * time.Minute
+	defaultSurgeRadius      = 2000
+	defaultSurgeSensitivity = 0.5
+	defaultSurgeMax         = 2.5
+	stationPageSize         = 100
+)
+
+// SurgeConfig tunes demand-based surge pricing. Zero values pick defaults.
+type SurgeConfig struct {
+	// Interval is how often UpdateSurge runs under RunSurge.
+	Interval time.Duration
+	// Window is the sliding window demand and supply are averaged over. A
+	// driver on shift counts as online while their last location ping is
+	// this recent. Each process keeps its own window, so run RunSurge on a
+	// single replica.
+	Window time.Duration
+	// RadiusMeters is how close to a station a driver counts as supply.
+	RadiusMeters float64
+	// Sensitivity is how much the multiplier rises per unit of demand/supply
+	// ratio above 1.
+	Sensitivity float64
+	Max         float64
+}
+
+type surgeSample struct {
+	at     time.Time
+	demand float64
+	supply float64
+}
+
+// HandleEvent records driver location pings so UpdateSurge can count the
+// online drivers near each station.
+func (s *Server) HandleEvent(ctx context.Context, event *lastmilev1.Event) error {
+	if event.GetType() != events.TypeDriverLocationUpdated {
+		return nil
+	}
+	var update lastmilev1.LocationUpdate
+	if err := event.GetPayload().UnmarshalTo(&update); err != nil {
+		return err
+	}
+	if update.ObservedAt == nil {
+		update.ObservedAt = event.GetOccurredAt()
+	}
+	err := s.locations.UpsertLocation(ctx, &update)
+	if errors.Is(err, storage.ErrInvalidArgument) {
+		return nil
+	}
+	return err
+}
+
+// RunSurge recomputes surge multipliers every interval until ctx is done.
+func (s *Server) RunSurge(ctx context.Context) error {
+	logger := observability.Logger()
+	ticker := time.NewTicker(s.surge.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := s.UpdateSurge(ctx, s.now()); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error().Err(err).Msg("surge update failed")
+		}
+	}
+}
+
+// UpdateSurge samples pending ride requests and nearby online drivers on
+// shift at every station, averages them over the sliding window and stores the
+// resulting multiplier, recording an audit entry whenever it changes.
+func (s *Server) UpdateSurge(ctx context.Context, now time.Time) error {
+	pending, err := s.requests.ListRideRequests(ctx, storage.RideRequestFilter{Status: lastmilev1.RideStatus_RIDE_STATUS_PENDING})
+	if err != nil {
+		return fmt.Errorf("list pending ride requests: %w", err)
+	}
+	demand := make(map[string]int, len(pending))
+	for _, request := range pending {
+		demand[request.StationId]++
+	}
+	locations, err := s.locations.ListLocations(ctx)
+	if err != nil {
+		return fmt.Errorf("list driver locations: %w", err)
+	}
+	shifts, err := s.shifts.ListOpenShifts(ctx)
+	if err != nil {
+		return fmt.Errorf("list open shifts: %w", err)
+	}
+	onShift := make(map[string]bool, len(shifts))
+	for _, shift := range shifts {
+		onShift[shift.DriverId] = true
+	}
+	online := locations[:0]
+	for _, update := range locations {
+		if !onShift[update.DriverId] {
+			continue
+		}
+		if update.Location != nil && update.ObservedAt != nil && now.Sub(update.ObservedAt.AsTime()) <= s.surge.Window {
+			online = append(online, update)
+		}
+	}
+
+	after := ""
+	for {
+		stations, next, err := s.stations.List(ctx, after, stationPageSize)
+		if err != nil {
+			return fmt.Errorf("list stations: %w", err)
+		}
+		for _, station := range stations {
+			if station.Location == nil {
+				continue
+			}
+			supply := 0
+			for _, update := range online {
+				if haversineMeters(station.Location, update.Location) <= s.surge.RadiusMeters {
+					supply++
+				}
+			}
+			if err := s.updateStationSurge(ctx, station.StationId, float64(demand[station.StationId]), float64(supply), now); err != nil {
+				return fmt.Errorf("update surge for station %s: %w", station.StationId, err)
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		after = next
+	}
+}
+
+func (s *Server) updateStationSurge(ctx context.Context, stationID string, demand, supply float64, now time.Time) error {
+	demand, supply = s.smooth(stationID, surgeSample{at: now, demand: demand, supply: supply})
+	ratio := demand / math.Max(supply, 1)
+	surge := &lastmilev1.StationSurge{
+		StationId:  stationID,
+		Multiplier: fare.Surge(ratio, s.surge.Sensitivity, s.surge.Max),
+		Demand:     demand,
+		Supply:     supply,
+		Ratio:      ratio,
+		UpdatedAt:  timestamppb.New(now),
+	}
+
+	previous := 1.0
+	current, err := s.surges.Get(ctx, stationID)
+	switch {
+	case err == nil:
+		previous = current.Multiplier
+	case !errors.Is(err, storage.ErrNotFound):
+		return err
+	}
+	var change *lastmilev1.SurgeChange
+	if surge.Multiplier != previous {
+		change = &lastmilev1.SurgeChange{
+			ChangeId:           newChangeID(now),
+			StationId:          stationID,
+			PreviousMultiplier: previous,
+			Multiplier:         surge.Multiplier,
+			Demand:             demand,
+			Supply:             supply,
+			Ratio:              ratio,
+			ChangedAt:          surge.UpdatedAt,
+		}
+	}
+	return s.surges.Set(ctx, surge, change)
+}
+
+// smooth adds sample to the station's window and returns the averages. The
+// window is not persisted.
+func (s *Server) smooth(stationID string, sample surgeSample) (float64, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := sample.at.Add(-s.surge.Window)
+	samples := s.samples[stationID][:0]
+	for _, kept := range s.samples[stationID] {
+		if kept.at.After(cutoff) {
+			samples = append(samples, kept)
+		}
+	}
+	samples = append(samples, sample)
+	s.samples[stationID] = samples
+
+	var demand, supply float64
+	for _, kept := range samples {
+		demand += kept.demand
+		supply += kept.supply
+	}
+	return demand / float64(len(samples)), supply / float64(len(samples))
+}
+
+// surgeMultiplier is the station's current multiplier, 1 until one has been
+// computed.
+func (s *Server) surgeMultiplier(ctx context.Context, stationID string) (float64, error) {
+	surge, err := s.surges.Get(ctx, stationID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return 1, nil
+		}
+		return 0, err
+	}
+	return max(surge.Multiplier, 1), nil
+}
+
+func (s *Server) GetSurge(ctx context.Context, req *lastmilev1.GetSurgeRequest) (*lastmilev1.GetSurgeResponse, error) {
+	stationID := strings.TrimSpace(req.GetStationId())
+	if stationID == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	if _, err := s.stations.Get(ctx, stationID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "station not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	surge, err := s.surges.Get(ctx, stationID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.Internal, "storage error")
+		}
+		surge = &lastmilev1.StationSurge{StationId: stationID, Multiplier: 1}
+	}
+	return &lastmilev1.GetSurgeResponse{Surge: surge}, nil
+}
+
+func (s *Server) ListSurgeChanges(ctx context.Context, req *lastmilev1.ListSurgeChangesRequest) (*lastmilev1.ListSurgeChangesResponse, error) {
+	stationID := strings.TrimSpace(req.GetStationId())
+	if stationID == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	pageSize := req.GetPageSize()
+	if pageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must be positive")
+	}
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	pageSize = min(pageSize, 100)
+	filter := pagetoken.FilterHash("surge_changes", stationID)
+	after := ""
+	if req.GetPageToken() != "" {
+		key, err := pagetoken.Decode(req.GetPageToken(), filter)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = key
+	}
+
+	changes, next, err := s.surges.ListChanges(ctx, stationID, after, int(pageSize))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	resp := &lastmilev1.ListSurgeChangesResponse{Changes: changes}
+	if next != "" {
+		resp.NextPageToken = pagetoken.Encode(next, filter)
+	}
+	return resp, nil
+}
+
+// newChangeID sorts by time so a station's audit trail pages in order.
+func newChangeID(at time.Time) string {
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+	return fmt.Sprintf("surge_%020d_%s", at.UnixNano(), hex.EncodeToString(buf))
+}
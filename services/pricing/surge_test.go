@@ -0,0 +1,128 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestUpdateSurge(t *testing.T) {
+	ctx := context.Background()
+	server := newServer(t, nil)
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+
+	for i := range 4 {
+		request := &lastmilev1.RideRequest{RequestId: fmt.Sprintf("r%d", i), StationId: "s1", Status: lastmilev1.RideStatus_RIDE_STATUS_PENDING}
+		if err := server.requests.CreateRideRequest(ctx, request); err != nil {
+			t.Fatalf("seed request: %v", err)
+		}
+	}
+	for _, driverID := range []string{"near", "far", "stale", "d2", "d3", "d4"} {
+		startShift(t, server, driverID, now.Add(-2*time.Hour))
+	}
+	ping(t, server, "near", 12.975, 77.59, now)
+	ping(t, server, "far", 13.2, 77.59, now)
+	ping(t, server, "stale", 12.97, 77.59, now.Add(-time.Hour))
+	ping(t, server, "off-shift", 12.97, 77.59, now)
+
+	// Demand 4 against one nearby online driver maxes out the multiplier.
+	if err := server.UpdateSurge(ctx, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := server.GetSurge(ctx, &lastmilev1.GetSurgeRequest{StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Surge.Multiplier != 2.5 || resp.Surge.Demand != 4 || resp.Surge.Supply != 1 {
+		t.Fatalf("unexpected surge: %v", resp.Surge)
+	}
+	if err := server.UpdateSurge(ctx, now.Add(time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Three more drivers show up; the window still remembers the shortage.
+	later := now.Add(2 * time.Minute)
+	for _, driverID := range []string{"d2", "d3", "d4"} {
+		ping(t, server, driverID, 12.97, 77.591, later)
+	}
+	ping(t, server, "near", 12.975, 77.59, later)
+	if err := server.UpdateSurge(ctx, later); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err = server.GetSurge(ctx, &lastmilev1.GetSurgeRequest{StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Surge.Supply != 2 || resp.Surge.Ratio != 2 || resp.Surge.Multiplier != 1.5 {
+		t.Fatalf("expected smoothed surge, got %v", resp.Surge)
+	}
+
+	first, err := server.ListSurgeChanges(ctx, &lastmilev1.ListSurgeChangesRequest{StationId: "s1", PageSize: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first.Changes) != 1 || first.Changes[0].PreviousMultiplier != 1 || first.Changes[0].Multiplier != 2.5 || first.NextPageToken == "" {
+		t.Fatalf("unexpected first change page: %v", first)
+	}
+	second, err := server.ListSurgeChanges(ctx, &lastmilev1.ListSurgeChangesRequest{StationId: "s1", PageSize: 1, PageToken: first.NextPageToken})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(second.Changes) != 1 || second.Changes[0].PreviousMultiplier != 2.5 || second.Changes[0].Multiplier != 1.5 || second.NextPageToken != "" {
+		t.Fatalf("unexpected second change page: %v", second)
+	}
+	_, err = server.ListSurgeChanges(ctx, &lastmilev1.ListSurgeChangesRequest{StationId: "other", PageToken: first.NextPageToken})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	quote, err := server.GetQuote(ctx, &lastmilev1.GetQuoteRequest{StationId: "s1", DestinationId: "d1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if quote.Quote.SurgeMultiplier != 1.5 || quote.Quote.Total.AmountMinor != 3168 {
+		t.Fatalf("expected surge in quote, got %v", quote.Quote)
+	}
+}
+
+func TestGetSurgeDefaults(t *testing.T) {
+	server := newServer(t, nil)
+	resp, err := server.GetSurge(context.Background(), &lastmilev1.GetSurgeRequest{StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Surge.Multiplier != 1 {
+		t.Fatalf("expected no surge, got %v", resp.Surge)
+	}
+	_, err = server.GetSurge(context.Background(), &lastmilev1.GetSurgeRequest{StationId: "nope"})
+	assertStatusCode(t, err, codes.NotFound)
+	_, err = server.ListSurgeChanges(context.Background(), &lastmilev1.ListSurgeChangesRequest{})
+	assertStatusCode(t, err, codes.InvalidArgument)
+}
+
+func startShift(t *testing.T, server *Server, driverID string, at time.Time) {
+	t.Helper()
+	if err := server.shifts.StartShift(context.Background(), &lastmilev1.DriverShift{ShiftId: "shift-" + driverID, DriverId: driverID, StartedAt: timestamppb.New(at)}); err != nil {
+		t.Fatalf("start shift: %v", err)
+	}
+}
+
+func ping(t *testing.T, server *Server, driverID string, lat, lng float64, at time.Time) {
+	t.Helper()
+	event, err := events.New(events.TypeDriverLocationUpdated, &lastmilev1.LocationUpdate{
+		DriverId:   driverID,
+		Location:   &lastmilev1.LatLng{Latitude: lat, Longitude: lng},
+		ObservedAt: timestamppb.New(at),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := server.HandleEvent(context.Background(), event); err != nil {
+		t.Fatalf("unexpected handler error: %v", err)
+	}
+}
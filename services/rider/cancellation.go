@@ -0,0 +1,66 @@
+package rider
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const maxCancellationNoteLen = 280
+
+// CancellationPolicy decides what a rider pays to cancel a ride request.
+type CancellationPolicy struct {
+	// FreeWindow is how long after booking the rider can cancel for free,
+	// even once a driver is assigned.
+	FreeWindow time.Duration
+	// Fee, in minor units of the fare's currency, is charged when the rider
+	// cancels after a driver was assigned and the free window has passed. It
+	// comes out of the held fare, so it is capped at the fare and requests
+	// booked without a quote always cancel free.
+	Fee int64
+}
+
+func (p CancellationPolicy) fee(request *lastmilev1.RideRequest, now time.Time) *lastmilev1.Money {
+	if p.Fee <= 0 || request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED || request.GetFare().GetAmountMinor() <= 0 {
+		return nil
+	}
+	if request.CreatedAt != nil && now.Sub(request.CreatedAt.AsTime()) < p.FreeWindow {
+		return nil
+	}
+	return &lastmilev1.Money{CurrencyCode: request.Fare.CurrencyCode, AmountMinor: min(p.Fee, request.Fare.AmountMinor)}
+}
+
+var riderReasons = []lastmilev1.CancellationReason{
+	lastmilev1.CancellationReason_CANCELLATION_REASON_OTHER,
+	lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_CHANGED_PLANS,
+	lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_WAIT_TOO_LONG,
+	lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_BOOKED_BY_MISTAKE,
+}
+
+// newCancellation checks the reason a rider gave for canceling.
+func newCancellation(input *lastmilev1.Cancellation, now time.Time) (*lastmilev1.Cancellation, error) {
+	if input.GetReason() == lastmilev1.CancellationReason_CANCELLATION_REASON_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "cancellation.reason is required")
+	}
+	if !slices.Contains(riderReasons, input.Reason) {
+		return nil, status.Errorf(codes.InvalidArgument, "riders cannot cancel with reason %s", input.Reason)
+	}
+	note := strings.TrimSpace(input.Note)
+	if input.Reason == lastmilev1.CancellationReason_CANCELLATION_REASON_OTHER && note == "" {
+		return nil, status.Error(codes.InvalidArgument, "cancellation.note is required for reason OTHER")
+	}
+	if len(note) > maxCancellationNoteLen {
+		return nil, status.Errorf(codes.InvalidArgument, "cancellation.note must be at most %d bytes", maxCancellationNoteLen)
+	}
+	return &lastmilev1.Cancellation{
+		CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_RIDER,
+		Reason:     input.Reason,
+		Note:       note,
+		CanceledAt: timestamppb.New(now),
+	}, nil
+}
@@ -0,0 +1,120 @@
+package rider
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/gtfs"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// minArrivalShift ignores delay changes too small to re-plan a pickup for.
+	minArrivalShift = time.Minute
+	// serviceWindow limits updates without service dates to requests whose
+	// train is due within this long of now, so today's delay does not move
+	// tomorrow's ride on the same trip id.
+	serviceWindow = 12 * time.Hour
+)
+
+// RunTripUpdates polls a GTFS-Realtime TripUpdate feed every interval and
+// applies it until ctx is done. Failed polls are logged and retried.
+func (s *Server) RunTripUpdates(ctx context.Context, source string, interval time.Duration) error {
+	logger := observability.Logger()
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	for {
+		shifted, err := s.pollTripUpdates(ctx, source)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error().Err(err).Str("source", source).Msg("gtfs-rt poll failed")
+		} else if shifted > 0 {
+			logger.Info().Int("shifted", shifted).Msg("applied gtfs-rt trip updates")
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Server) pollTripUpdates(ctx context.Context, source string) (int, error) {
+	data, err := gtfs.FetchRealtime(ctx, nil, source)
+	if err != nil {
+		return 0, err
+	}
+	updates, err := gtfs.ParseTripUpdates(data)
+	if err != nil {
+		return 0, err
+	}
+	return s.ApplyTripUpdates(ctx, updates, time.Now())
+}
+
+// ApplyTripUpdates moves the arrival_time of pending and matched requests
+// linked to a delayed train and records a rescheduled event for each, which
+// matching and notification consume. It returns how many requests moved.
+// Canceled trips are left alone; the rider still has to get to the station.
+func (s *Server) ApplyTripUpdates(ctx context.Context, updates []gtfs.TripUpdate, now time.Time) (int, error) {
+	shifted := 0
+	for _, update := range updates {
+		if update.Canceled {
+			continue
+		}
+		requests, err := s.requests.ListRideRequests(ctx, storage.RideRequestFilter{TrainTripID: update.TripID})
+		if err != nil {
+			return shifted, err
+		}
+		for _, request := range requests {
+			if request.Status != lastmilev1.RideStatus_RIDE_STATUS_PENDING && request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+				continue
+			}
+			train := request.Train
+			scheduled := train.GetScheduledArrivalTime().AsTime()
+			if !sameService(train, update, scheduled, now) {
+				continue
+			}
+			delay, ok := update.DelayAt(train.StopSequence, scheduled)
+			if !ok {
+				continue
+			}
+			arrival := scheduled.Add(delay)
+			if arrival.Sub(request.ArrivalTime.AsTime()).Abs() < minArrivalShift {
+				continue
+			}
+			request.ArrivalTime = timestamppb.New(arrival)
+			train.DelaySeconds = int32(delay / time.Second)
+
+			message, err := events.NewOutboxMessage(events.StreamRideRequests, events.TypeRideRequestRescheduled, request)
+			if err != nil {
+				return shifted, err
+			}
+			if err := s.requests.UpdateRideRequest(ctx, request, request.Status, message); err != nil {
+				if errors.Is(err, storage.ErrStatusChanged) {
+					// Matched or canceled meanwhile; the next poll sees it.
+					continue
+				}
+				return shifted, err
+			}
+			shifted++
+		}
+	}
+	return shifted, nil
+}
+
+func sameService(train *lastmilev1.TrainLink, update gtfs.TripUpdate, scheduled, now time.Time) bool {
+	if train.ServiceDate != "" && update.StartDate != "" {
+		return train.ServiceDate == update.StartDate
+	}
+	return scheduled.Sub(now).Abs() <= serviceWindow
+}
@@ -0,0 +1,127 @@
+package rider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/gtfs"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestApplyTripUpdatesShiftsLinkedRequests(t *testing.T) {
+	ctx := context.Background()
+	outbox := storage.NewMemoryOutbox()
+	server := NewServerWithStore(storage.NewMemoryRideRequestStore(outbox))
+	now := time.Date(2026, time.October, 19, 7, 0, 0, 0, time.UTC)
+	scheduled := time.Date(2026, time.October, 19, 8, 10, 0, 0, time.UTC)
+
+	create := func(riderID string, train *lastmilev1.TrainLink) string {
+		t.Helper()
+		resp, err := server.CreateRideRequest(ctx, &lastmilev1.CreateRideRequestRequest{
+			RiderId: riderID,
+			Request: &lastmilev1.RideRequest{
+				StationId:     "s1",
+				DestinationId: "d1",
+				ArrivalTime:   timestamppb.New(scheduled),
+				Train:         train,
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp.Request.RequestId
+	}
+	linked := create("r1", &lastmilev1.TrainLink{TripId: " t1 ", StopSequence: 4, ServiceDate: "20261019", DelaySeconds: 99})
+	tomorrow := create("r2", &lastmilev1.TrainLink{TripId: "t1", StopSequence: 4, ServiceDate: "20261020"})
+	undated := create("r3", &lastmilev1.TrainLink{TripId: "t1", StopSequence: 4})
+	unlinked := create("r4", nil)
+	canceled := create("r5", &lastmilev1.TrainLink{TripId: "t1", StopSequence: 4, ServiceDate: "20261019"})
+	if _, err := server.UpdateRideStatus(ctx, &lastmilev1.UpdateRideStatusRequest{
+		RiderId:   "r5",
+		RequestId: canceled,
+		Request:   &lastmilev1.RideRequest{Status: lastmilev1.RideStatus_RIDE_STATUS_CANCELED, Cancellation: changedPlans},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	before := countRideEvents(t, outbox, events.TypeRideRequestRescheduled)
+
+	update := gtfs.TripUpdate{
+		TripID:    "t1",
+		StartDate: "20261019",
+		StopTimes: []gtfs.StopTimeUpdate{{StopSequence: 2, Delay: 7 * time.Minute, HasDelay: true}},
+	}
+	shifted, err := server.ApplyTripUpdates(ctx, []gtfs.TripUpdate{update}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shifted != 2 {
+		t.Fatalf("expected the dated and undated requests to move, got %d", shifted)
+	}
+	for requestID, want := range map[string]time.Time{
+		linked:   scheduled.Add(7 * time.Minute),
+		undated:  scheduled.Add(7 * time.Minute),
+		tomorrow: scheduled,
+		unlinked: scheduled,
+		canceled: scheduled,
+	} {
+		request, err := server.requests.GetRideRequest(ctx, requestID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !request.ArrivalTime.AsTime().Equal(want) {
+			t.Fatalf("request of %s: expected arrival %v, got %v", request.RiderId, want, request.ArrivalTime.AsTime())
+		}
+	}
+	request, _ := server.requests.GetRideRequest(ctx, linked)
+	if request.Train.TripId != "t1" || request.Train.DelaySeconds != 420 || !request.Train.ScheduledArrivalTime.AsTime().Equal(scheduled) {
+		t.Fatalf("unexpected train link: %v", request.Train)
+	}
+	if got := countRideEvents(t, outbox, events.TypeRideRequestRescheduled) - before; got != 2 {
+		t.Fatalf("expected 2 rescheduled events, got %d", got)
+	}
+
+	// A delay change under a minute is not worth re-planning for.
+	update.StopTimes[0].Delay = 7*time.Minute + 30*time.Second
+	if shifted, err := server.ApplyTripUpdates(ctx, []gtfs.TripUpdate{update}, now); err != nil || shifted != 0 {
+		t.Fatalf("expected no shift, got %d, %v", shifted, err)
+	}
+	update.Canceled = true
+	update.StopTimes[0].Delay = 20 * time.Minute
+	if shifted, err := server.ApplyTripUpdates(ctx, []gtfs.TripUpdate{update}, now); err != nil || shifted != 0 {
+		t.Fatalf("expected canceled trip to be skipped, got %d, %v", shifted, err)
+	}
+}
+
+func TestCreateRideRequestTrainValidation(t *testing.T) {
+	server := NewServer()
+	_, err := server.CreateRideRequest(context.Background(), &lastmilev1.CreateRideRequestRequest{
+		RiderId: "r1",
+		Request: &lastmilev1.RideRequest{
+			StationId:     "s1",
+			DestinationId: "d1",
+			ArrivalTime:   timestamppb.Now(),
+			Train:         &lastmilev1.TrainLink{StopSequence: 3},
+		},
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+}
+
+func countRideEvents(t *testing.T, outbox *storage.MemoryOutbox, eventType string) int {
+	t.Helper()
+	entries, err := outbox.ListPending(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("unexpected outbox error: %v", err)
+	}
+	count := 0
+	for _, entry := range entries {
+		if entry.Event.Type == eventType {
+			count++
+		}
+	}
+	return count
+}
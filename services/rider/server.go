@@ -1,11 +1,264 @@
 package rider
 
-import lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/fare"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
 
 type Server struct {
 	lastmilev1.UnimplementedRiderServiceServer
+	requests     storage.RideRequestStore
+	cancellation CancellationPolicy
+}
+
+type Stores struct {
+	Requests     storage.RideRequestStore
+	Cancellation CancellationPolicy
 }
 
 func NewServer() *Server {
-	return &Server{}
+	return NewServerWithStores(Stores{})
+}
+
+func NewServerWithStore(requests storage.RideRequestStore) *Server {
+	return NewServerWithStores(Stores{Requests: requests})
+}
+
+func NewServerWithStores(stores Stores) *Server {
+	if stores.Requests == nil {
+		stores.Requests = storage.NewMemoryRideRequestStore(nil)
+	}
+	return &Server{requests: stores.Requests, cancellation: stores.Cancellation}
+}
+
+func (s *Server) CreateRideRequest(ctx context.Context, req *lastmilev1.CreateRideRequestRequest) (*lastmilev1.CreateRideRequestResponse, error) {
+	if req == nil || req.Request == nil {
+		return nil, status.Error(codes.InvalidArgument, "request is required")
+	}
+	riderID := strings.TrimSpace(req.RiderId)
+	if riderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id is required")
+	}
+	request := cloneRideRequest(req.Request)
+	request.StationId = strings.TrimSpace(request.StationId)
+	if request.StationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	request.DestinationId = strings.TrimSpace(request.DestinationId)
+	if request.DestinationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "destination_id is required")
+	}
+	if request.ArrivalTime == nil || !request.ArrivalTime.IsValid() {
+		return nil, status.Error(codes.InvalidArgument, "arrival_time is required")
+	}
+	if train := request.Train; train != nil {
+		train.TripId = strings.TrimSpace(train.TripId)
+		if train.TripId == "" {
+			return nil, status.Error(codes.InvalidArgument, "train.trip_id is required")
+		}
+		if train.ScheduledArrivalTime == nil {
+			train.ScheduledArrivalTime = request.ArrivalTime
+		} else if !train.ScheduledArrivalTime.IsValid() {
+			return nil, status.Error(codes.InvalidArgument, "train.scheduled_arrival_time is invalid")
+		}
+		train.DelaySeconds = 0
+	}
+	request.Seats = max(request.Seats, 1)
+	request.Fare = nil
+	request.QuoteId = ""
+	if token := strings.TrimSpace(req.QuoteToken); token != "" {
+		if err := lockQuote(request, token, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	request.RiderId = riderID
+	request.Status = lastmilev1.RideStatus_RIDE_STATUS_PENDING
+	request.CreatedAt = timestamppb.Now()
+	request.Cancellation = nil
+
+	requestID := strings.TrimSpace(request.RequestId)
+	if requestID == "" {
+		request.RequestId = newID("ride")
+	} else {
+		request.RequestId = requestID
+	}
+
+	message, err := events.NewOutboxMessage(events.StreamRideRequests, events.TypeRideRequestCreated, request)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "event error")
+	}
+	if err := s.requests.CreateRideRequest(ctx, request, message); err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			return nil, status.Error(codes.AlreadyExists, "ride request already exists")
+		}
+		if errors.Is(err, storage.ErrQuoteUsed) {
+			return nil, status.Error(codes.FailedPrecondition, "quote already used")
+		}
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+
+	return &lastmilev1.CreateRideRequestResponse{Request: cloneRideRequest(request)}, nil
+}
+
+func (s *Server) GetRideRequest(ctx context.Context, req *lastmilev1.GetRideRequestRequest) (*lastmilev1.GetRideRequestResponse, error) {
+	if req == nil || strings.TrimSpace(req.RiderId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id is required")
+	}
+	if strings.TrimSpace(req.RequestId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "request_id is required")
+	}
+
+	request, err := s.getOwnedRequest(ctx, strings.TrimSpace(req.RiderId), strings.TrimSpace(req.RequestId))
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.GetRideRequestResponse{Request: request}, nil
+}
+
+func (s *Server) UpdateRideStatus(ctx context.Context, req *lastmilev1.UpdateRideStatusRequest) (*lastmilev1.UpdateRideStatusResponse, error) {
+	if req == nil || strings.TrimSpace(req.RiderId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id is required")
+	}
+	if strings.TrimSpace(req.RequestId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "request_id is required")
+	}
+	if req.Request == nil || req.Request.Status == lastmilev1.RideStatus_RIDE_STATUS_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+	now := time.Now()
+	var cancellation *lastmilev1.Cancellation
+	if req.Request.Status == lastmilev1.RideStatus_RIDE_STATUS_CANCELED {
+		var err error
+		if cancellation, err = newCancellation(req.Request.Cancellation, now); err != nil {
+			return nil, err
+		}
+	}
+
+	request, err := s.getOwnedRequest(ctx, strings.TrimSpace(req.RiderId), strings.TrimSpace(req.RequestId))
+	if err != nil {
+		return nil, err
+	}
+	if request.Status == req.Request.Status {
+		return &lastmilev1.UpdateRideStatusResponse{Request: request}, nil
+	}
+	if !canTransition(request.Status, req.Request.Status) {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot move ride request from %s to %s", request.Status, req.Request.Status)
+	}
+	if cancellation != nil {
+		cancellation.Fee = s.cancellation.fee(request, now)
+		request.Cancellation = cancellation
+	}
+	from := request.Status
+	request.Status = req.Request.Status
+
+	message, err := events.NewOutboxMessage(events.StreamRideRequests, events.TypeRideRequestStatusChanged, request)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "event error")
+	}
+	if err := s.requests.UpdateRideRequest(ctx, request, from, message); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "ride request not found")
+		}
+		if errors.Is(err, storage.ErrStatusChanged) {
+			return nil, status.Error(codes.FailedPrecondition, "ride request status changed; fetch it and try again")
+		}
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+
+	return &lastmilev1.UpdateRideStatusResponse{Request: cloneRideRequest(request)}, nil
+}
+
+func (s *Server) getOwnedRequest(ctx context.Context, riderID, requestID string) (*lastmilev1.RideRequest, error) {
+	request, err := s.requests.GetRideRequest(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "ride request not found")
+		}
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	if request.RiderId != riderID {
+		return nil, status.Error(codes.NotFound, "ride request not found")
+	}
+	return request, nil
+}
+
+// rideTransitions are the moves riders may make themselves. Matching and
+// unmatching belong to the matching service and boarding to VerifyPickup, so
+// a rider cannot mark themselves picked up without the PIN.
+var rideTransitions = map[lastmilev1.RideStatus][]lastmilev1.RideStatus{
+	lastmilev1.RideStatus_RIDE_STATUS_PENDING: {
+		lastmilev1.RideStatus_RIDE_STATUS_CANCELED,
+	},
+	lastmilev1.RideStatus_RIDE_STATUS_MATCHED: {
+		lastmilev1.RideStatus_RIDE_STATUS_CANCELED,
+	},
+	lastmilev1.RideStatus_RIDE_STATUS_PICKED_UP: {
+		lastmilev1.RideStatus_RIDE_STATUS_DROPPED_OFF,
+	},
+}
+
+func canTransition(from, to lastmilev1.RideStatus) bool {
+	for _, next := range rideTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// lockQuote copies the quoted fare onto request once the token checks out
+// for the same station, destination, seat count, shared choice and pickup
+// window. The store rejects a quote that another request already used.
+func lockQuote(request *lastmilev1.RideRequest, token string, now time.Time) error {
+	claims, err := fare.Verify(token, now)
+	if errors.Is(err, fare.ErrExpiredToken) {
+		return status.Error(codes.FailedPrecondition, "quote expired")
+	}
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid quote_token")
+	}
+	if claims.StationID != request.StationId || claims.DestinationID != request.DestinationId || claims.Seats != request.Seats || claims.Shared != request.Shared {
+		return status.Error(codes.InvalidArgument, "quote does not match the request")
+	}
+	if !claims.CoversPickup(request.ArrivalTime.AsTime()) {
+		return status.Error(codes.InvalidArgument, "quote was for a different pickup time")
+	}
+	request.Fare = &lastmilev1.Money{CurrencyCode: claims.Currency, AmountMinor: claims.Total}
+	request.QuoteId = claims.QuoteID
+	return nil
+}
+
+func cloneRideRequest(request *lastmilev1.RideRequest) *lastmilev1.RideRequest {
+	if request == nil {
+		return nil
+	}
+	return proto.Clone(request).(*lastmilev1.RideRequest)
+}
+
+func newID(prefix string) string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return prefix + "_" + hex.EncodeToString(buf)
 }
@@ -0,0 +1,294 @@
+package rider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/fare"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var changedPlans = &lastmilev1.Cancellation{Reason: lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_CHANGED_PLANS}
+
+func TestCreateRideRequestValidation(t *testing.T) {
+	server := NewServer()
+	arrival := timestamppb.New(time.Now().Add(time.Hour))
+	cases := []struct {
+		name string
+		req  *lastmilev1.CreateRideRequestRequest
+	}{
+		{name: "nil request", req: nil},
+		{name: "nil ride request", req: &lastmilev1.CreateRideRequestRequest{RiderId: "r1"}},
+		{name: "missing rider", req: &lastmilev1.CreateRideRequestRequest{Request: &lastmilev1.RideRequest{StationId: "s1", DestinationId: "d1", ArrivalTime: arrival}}},
+		{name: "missing station", req: &lastmilev1.CreateRideRequestRequest{RiderId: "r1", Request: &lastmilev1.RideRequest{DestinationId: "d1", ArrivalTime: arrival}}},
+		{name: "missing destination", req: &lastmilev1.CreateRideRequestRequest{RiderId: "r1", Request: &lastmilev1.RideRequest{StationId: "s1", ArrivalTime: arrival}}},
+		{name: "missing arrival", req: &lastmilev1.CreateRideRequestRequest{RiderId: "r1", Request: &lastmilev1.RideRequest{StationId: "s1", DestinationId: "d1"}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := server.CreateRideRequest(context.Background(), tc.req)
+			assertStatusCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestCreateRideRequestEnqueuesEvent(t *testing.T) {
+	outbox := storage.NewMemoryOutbox()
+	server := NewServerWithStore(storage.NewMemoryRideRequestStore(outbox))
+
+	resp, err := server.CreateRideRequest(context.Background(), &lastmilev1.CreateRideRequestRequest{
+		RiderId: " r1 ",
+		Request: &lastmilev1.RideRequest{
+			StationId:     " s1 ",
+			DestinationId: "d1",
+			ArrivalTime:   timestamppb.New(time.Now().Add(time.Hour)),
+			Status:        lastmilev1.RideStatus_RIDE_STATUS_DROPPED_OFF,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Request.RequestId == "" {
+		t.Fatalf("expected generated request_id")
+	}
+	if resp.Request.Status != lastmilev1.RideStatus_RIDE_STATUS_PENDING {
+		t.Fatalf("expected pending status, got %s", resp.Request.Status)
+	}
+	if resp.Request.RiderId != "r1" || resp.Request.StationId != "s1" {
+		t.Fatalf("expected trimmed ids, got %q/%q", resp.Request.RiderId, resp.Request.StationId)
+	}
+
+	entries, err := outbox.ListPending(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("unexpected outbox error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Stream != events.StreamRideRequests {
+		t.Fatalf("expected one ride request event in the outbox, got %v", entries)
+	}
+	event := entries[0].Event
+	if event.Type != events.TypeRideRequestCreated {
+		t.Fatalf("unexpected event type %q", event.Type)
+	}
+	var published lastmilev1.RideRequest
+	if err := event.Payload.UnmarshalTo(&published); err != nil {
+		t.Fatalf("unexpected payload error: %v", err)
+	}
+	if published.RequestId != resp.Request.RequestId {
+		t.Fatalf("expected event for %q, got %q", resp.Request.RequestId, published.RequestId)
+	}
+}
+
+func TestCreateRideRequestLocksQuote(t *testing.T) {
+	server := NewServer()
+	pickup := time.Now().Add(time.Hour)
+	arrival := timestamppb.New(pickup)
+	claims := fare.Claims{
+		QuoteID:       "quote_1",
+		StationID:     "s1",
+		DestinationID: "d1",
+		Seats:         2,
+		Currency:      "INR",
+		Total:         5250,
+		ExpiresAt:     time.Now().Add(time.Minute).Unix(),
+		PickupFrom:    pickup.Add(-time.Minute).Unix(),
+		PickupUntil:   pickup.Add(time.Minute).Unix(),
+	}
+	shared := false
+	create := func(requestID string, seats uint32, token string) (*lastmilev1.CreateRideRequestResponse, error) {
+		return server.CreateRideRequest(context.Background(), &lastmilev1.CreateRideRequestRequest{
+			RiderId:    "r1",
+			QuoteToken: token,
+			Request: &lastmilev1.RideRequest{
+				RequestId:     requestID,
+				StationId:     "s1",
+				DestinationId: "d1",
+				ArrivalTime:   arrival,
+				Seats:         seats,
+				Shared:        shared,
+				Fare:          &lastmilev1.Money{CurrencyCode: "INR", AmountMinor: 1},
+			},
+		})
+	}
+
+	resp, err := create("r-quoted", 2, fare.Sign(claims))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Request.QuoteId != "quote_1" || resp.Request.Fare.GetAmountMinor() != 5250 || resp.Request.Fare.GetCurrencyCode() != "INR" {
+		t.Fatalf("expected quoted fare to be locked, got %v", resp.Request)
+	}
+
+	resp, err = create("r-unquoted", 0, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Request.Fare != nil || resp.Request.Seats != 1 {
+		t.Fatalf("expected client fare dropped and one seat, got %v", resp.Request)
+	}
+
+	_, err = create("r-reused", 2, fare.Sign(claims))
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	claims.QuoteID = "quote_2"
+	_, err = create("r-mismatch", 1, fare.Sign(claims))
+	assertStatusCode(t, err, codes.InvalidArgument)
+	// A shared-ride quote does not lock a fare for a ride alone.
+	claims.Shared = true
+	_, err = create("r-not-shared", 2, fare.Sign(claims))
+	assertStatusCode(t, err, codes.InvalidArgument)
+	shared = true
+	claims.PickupFrom = pickup.Add(time.Minute).Unix()
+	claims.PickupUntil = pickup.Add(time.Hour).Unix()
+	_, err = create("r-other-time", 2, fare.Sign(claims))
+	assertStatusCode(t, err, codes.InvalidArgument)
+	claims.PickupFrom = pickup.Add(-time.Minute).Unix()
+	if _, err := create("r-shared", 2, fare.Sign(claims)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims.QuoteID = "quote_3"
+	_, err = create("r-forged", 2, "bogus")
+	assertStatusCode(t, err, codes.InvalidArgument)
+	claims.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	_, err = create("r-expired", 2, fare.Sign(claims))
+	assertStatusCode(t, err, codes.FailedPrecondition)
+}
+
+func TestUpdateRideStatusTransitions(t *testing.T) {
+	server := NewServer()
+	resp, err := server.CreateRideRequest(context.Background(), &lastmilev1.CreateRideRequestRequest{
+		RiderId: "r1",
+		Request: &lastmilev1.RideRequest{
+			StationId:     "s1",
+			DestinationId: "d1",
+			ArrivalTime:   timestamppb.Now(),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	requestID := resp.Request.RequestId
+
+	_, err = server.UpdateRideStatus(context.Background(), &lastmilev1.UpdateRideStatusRequest{
+		RiderId:   "r1",
+		RequestId: requestID,
+		Request:   &lastmilev1.RideRequest{Status: lastmilev1.RideStatus_RIDE_STATUS_DROPPED_OFF},
+	})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	// Matching and boarding are not the rider's to set.
+	for _, next := range []lastmilev1.RideStatus{lastmilev1.RideStatus_RIDE_STATUS_MATCHED, lastmilev1.RideStatus_RIDE_STATUS_PICKED_UP} {
+		_, err = server.UpdateRideStatus(context.Background(), &lastmilev1.UpdateRideStatusRequest{
+			RiderId:   "r1",
+			RequestId: requestID,
+			Request:   &lastmilev1.RideRequest{Status: next},
+		})
+		assertStatusCode(t, err, codes.FailedPrecondition)
+	}
+
+	_, err = server.UpdateRideStatus(context.Background(), &lastmilev1.UpdateRideStatusRequest{
+		RiderId:   "other",
+		RequestId: requestID,
+		Request:   &lastmilev1.RideRequest{Status: lastmilev1.RideStatus_RIDE_STATUS_CANCELED, Cancellation: changedPlans},
+	})
+	assertStatusCode(t, err, codes.NotFound)
+
+	updated, err := server.UpdateRideStatus(context.Background(), &lastmilev1.UpdateRideStatusRequest{
+		RiderId:   "r1",
+		RequestId: requestID,
+		Request:   &lastmilev1.RideRequest{Status: lastmilev1.RideStatus_RIDE_STATUS_CANCELED, Cancellation: changedPlans},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Request.Status != lastmilev1.RideStatus_RIDE_STATUS_CANCELED {
+		t.Fatalf("expected canceled, got %s", updated.Request.Status)
+	}
+}
+
+func TestCancelRideRequestPolicy(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryRideRequestStore(nil)
+	server := NewServerWithStores(Stores{
+		Requests:     store,
+		Cancellation: CancellationPolicy{FreeWindow: 5 * time.Minute, Fee: 3000},
+	})
+	now := time.Now()
+	seed := func(requestID string, status lastmilev1.RideStatus, booked time.Duration, fare int64) {
+		request := &lastmilev1.RideRequest{
+			RequestId:     requestID,
+			RiderId:       "r1",
+			StationId:     "s1",
+			DestinationId: "d1",
+			ArrivalTime:   timestamppb.New(now.Add(time.Hour)),
+			Status:        status,
+			CreatedAt:     timestamppb.New(now.Add(-booked)),
+		}
+		if fare > 0 {
+			request.Fare = &lastmilev1.Money{CurrencyCode: "INR", AmountMinor: fare}
+		}
+		if err := store.CreateRideRequest(ctx, request); err != nil {
+			t.Fatalf("seed %s: %v", requestID, err)
+		}
+	}
+	seed("fresh", lastmilev1.RideStatus_RIDE_STATUS_MATCHED, time.Minute, 5000)
+	seed("assigned", lastmilev1.RideStatus_RIDE_STATUS_MATCHED, 10*time.Minute, 5000)
+	seed("cheap", lastmilev1.RideStatus_RIDE_STATUS_MATCHED, 10*time.Minute, 2000)
+	seed("unquoted", lastmilev1.RideStatus_RIDE_STATUS_MATCHED, 10*time.Minute, 0)
+	seed("waiting", lastmilev1.RideStatus_RIDE_STATUS_PENDING, 10*time.Minute, 5000)
+
+	cancel := func(requestID string, cancellation *lastmilev1.Cancellation) (*lastmilev1.RideRequest, error) {
+		resp, err := server.UpdateRideStatus(ctx, &lastmilev1.UpdateRideStatusRequest{
+			RiderId:   "r1",
+			RequestId: requestID,
+			Request:   &lastmilev1.RideRequest{Status: lastmilev1.RideStatus_RIDE_STATUS_CANCELED, Cancellation: cancellation},
+		})
+		return resp.GetRequest(), err
+	}
+
+	_, err := cancel("assigned", nil)
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = cancel("assigned", &lastmilev1.Cancellation{Reason: lastmilev1.CancellationReason_CANCELLATION_REASON_DRIVER_VEHICLE_ISSUE})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = cancel("assigned", &lastmilev1.Cancellation{Reason: lastmilev1.CancellationReason_CANCELLATION_REASON_OTHER, Note: "  "})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	wantFees := map[string]int64{"fresh": 0, "assigned": 3000, "cheap": 2000, "unquoted": 0, "waiting": 0}
+	for requestID, want := range wantFees {
+		request, err := cancel(requestID, &lastmilev1.Cancellation{
+			CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_SYSTEM,
+			Reason:     lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_WAIT_TOO_LONG,
+			Fee:        &lastmilev1.Money{CurrencyCode: "INR", AmountMinor: 1},
+		})
+		if err != nil {
+			t.Fatalf("cancel %s: %v", requestID, err)
+		}
+		cancellation := request.Cancellation
+		if cancellation.GetCanceledBy() != lastmilev1.CancellationParty_CANCELLATION_PARTY_RIDER || cancellation.GetReason() != lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_WAIT_TOO_LONG || cancellation.GetCanceledAt() == nil {
+			t.Fatalf("%s: expected rider cancellation to be recorded, got %v", requestID, cancellation)
+		}
+		if got := cancellation.GetFee().GetAmountMinor(); got != want {
+			t.Fatalf("%s: expected fee %d, got %d", requestID, want, got)
+		}
+	}
+}
+
+func assertStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error with code %s", code.String())
+	}
+	statusErr, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if statusErr.Code() != code {
+		t.Fatalf("expected code %s, got %s", code.String(), statusErr.Code().String())
+	}
+}
@@ -0,0 +1,268 @@
+package station
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func (s *Server) UpsertServiceArea(ctx context.Context, req *lastmilev1.UpsertServiceAreaRequest) (*lastmilev1.UpsertServiceAreaResponse, error) {
+	if req == nil || req.Area == nil {
+		return nil, status.Error(codes.InvalidArgument, "area is required")
+	}
+	area := proto.Clone(req.Area).(*lastmilev1.ServiceArea)
+	area.AreaId = strings.TrimSpace(area.AreaId)
+	area.Name = strings.TrimSpace(area.Name)
+	if area.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	for _, vertex := range area.Boundary {
+		if err := validateLatLng(vertex); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "boundary: %s", status.Convert(err).Message())
+		}
+	}
+	if n := len(area.Boundary); n > 1 && proto.Equal(area.Boundary[0], area.Boundary[n-1]) {
+		area.Boundary = area.Boundary[:n-1]
+	}
+	if len(area.Boundary) < 3 {
+		return nil, status.Error(codes.InvalidArgument, "boundary needs at least 3 vertices")
+	}
+	if area.AreaId == "" {
+		area.AreaId = newID("area")
+	}
+
+	if err := s.areas.Upsert(ctx, area); err != nil {
+		return nil, storageStatus(err, "area")
+	}
+	return &lastmilev1.UpsertServiceAreaResponse{Area: area}, nil
+}
+
+func (s *Server) GetServiceArea(ctx context.Context, req *lastmilev1.GetServiceAreaRequest) (*lastmilev1.GetServiceAreaResponse, error) {
+	if req == nil || strings.TrimSpace(req.AreaId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "area_id is required")
+	}
+	area, err := s.areas.Get(ctx, strings.TrimSpace(req.AreaId))
+	if err != nil {
+		return nil, storageStatus(err, "area")
+	}
+	return &lastmilev1.GetServiceAreaResponse{Area: area}, nil
+}
+
+func (s *Server) DeleteServiceArea(ctx context.Context, req *lastmilev1.DeleteServiceAreaRequest) (*lastmilev1.DeleteServiceAreaResponse, error) {
+	if req == nil || strings.TrimSpace(req.AreaId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "area_id is required")
+	}
+	areaID := strings.TrimSpace(req.AreaId)
+
+	stations, err := s.store.ListByArea(ctx, areaID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	if len(stations) > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "area is served by %d stations", len(stations))
+	}
+	if err := s.areas.Delete(ctx, areaID); err != nil {
+		return nil, storageStatus(err, "area")
+	}
+	return &lastmilev1.DeleteServiceAreaResponse{}, nil
+}
+
+func (s *Server) ListServiceAreas(ctx context.Context, req *lastmilev1.ListServiceAreasRequest) (*lastmilev1.ListServiceAreasResponse, error) {
+	filter := pagetoken.FilterHash("areas")
+	after, limit, err := pageParams(req.GetPageSize(), req.GetPageToken(), filter)
+	if err != nil {
+		return nil, err
+	}
+	areas, next, err := s.areas.List(ctx, after, limit)
+	if err != nil {
+		return nil, storageStatus(err, "area")
+	}
+	return &lastmilev1.ListServiceAreasResponse{Areas: areas, NextPageToken: nextPageToken(next, filter)}, nil
+}
+
+func (s *Server) ResolveDropOff(ctx context.Context, req *lastmilev1.ResolveDropOffRequest) (*lastmilev1.ResolveDropOffResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "location is required")
+	}
+	if err := validateLatLng(req.Location); err != nil {
+		return nil, err
+	}
+	area, err := s.locate(ctx, req.Location)
+	if err != nil {
+		return nil, err
+	}
+	if area == nil {
+		return nil, status.Error(codes.NotFound, "location is outside every service area")
+	}
+
+	stations, err := s.store.ListByArea(ctx, area.AreaId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	resp := &lastmilev1.ResolveDropOffResponse{Area: area}
+	best := math.Inf(1)
+	for _, station := range stations {
+		if station.Location == nil {
+			continue
+		}
+		if distance := haversineMeters(req.Location, station.Location); distance < best {
+			best = distance
+			resp.Station = station
+			resp.DistanceMeters = distance
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) UpsertDestination(ctx context.Context, req *lastmilev1.UpsertDestinationRequest) (*lastmilev1.UpsertDestinationResponse, error) {
+	if req == nil || req.Destination == nil {
+		return nil, status.Error(codes.InvalidArgument, "destination is required")
+	}
+	destination := proto.Clone(req.Destination).(*lastmilev1.Destination)
+	destination.DestinationId = strings.TrimSpace(destination.DestinationId)
+	destination.Name = strings.TrimSpace(destination.Name)
+	if destination.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if err := validateLatLng(destination.Location); err != nil {
+		return nil, err
+	}
+	area, err := s.locate(ctx, destination.Location)
+	if err != nil {
+		return nil, err
+	}
+	destination.AreaId = area.GetAreaId()
+	if destination.DestinationId == "" {
+		destination.DestinationId = newID("destination")
+	}
+
+	if err := s.destinations.Upsert(ctx, destination); err != nil {
+		return nil, storageStatus(err, "destination")
+	}
+	return &lastmilev1.UpsertDestinationResponse{Destination: destination}, nil
+}
+
+func (s *Server) GetDestination(ctx context.Context, req *lastmilev1.GetDestinationRequest) (*lastmilev1.GetDestinationResponse, error) {
+	if req == nil || strings.TrimSpace(req.DestinationId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "destination_id is required")
+	}
+	destination, err := s.destinations.Get(ctx, strings.TrimSpace(req.DestinationId))
+	if err != nil {
+		return nil, storageStatus(err, "destination")
+	}
+	return &lastmilev1.GetDestinationResponse{Destination: destination}, nil
+}
+
+func (s *Server) DeleteDestination(ctx context.Context, req *lastmilev1.DeleteDestinationRequest) (*lastmilev1.DeleteDestinationResponse, error) {
+	if req == nil || strings.TrimSpace(req.DestinationId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "destination_id is required")
+	}
+	if err := s.destinations.Delete(ctx, strings.TrimSpace(req.DestinationId)); err != nil {
+		return nil, storageStatus(err, "destination")
+	}
+	return &lastmilev1.DeleteDestinationResponse{}, nil
+}
+
+func (s *Server) ListDestinations(ctx context.Context, req *lastmilev1.ListDestinationsRequest) (*lastmilev1.ListDestinationsResponse, error) {
+	filter := pagetoken.FilterHash("destinations")
+	after, limit, err := pageParams(req.GetPageSize(), req.GetPageToken(), filter)
+	if err != nil {
+		return nil, err
+	}
+	destinations, next, err := s.destinations.List(ctx, after, limit)
+	if err != nil {
+		return nil, storageStatus(err, "destination")
+	}
+	return &lastmilev1.ListDestinationsResponse{Destinations: destinations, NextPageToken: nextPageToken(next, filter)}, nil
+}
+
+// locate returns the first area, by id, containing point, or nil when the
+// point is outside every area.
+func (s *Server) locate(ctx context.Context, point *lastmilev1.LatLng) (*lastmilev1.ServiceArea, error) {
+	areas, err := s.areas.Locate(ctx, point)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	if len(areas) == 0 {
+		return nil, nil
+	}
+	return areas[0], nil
+}
+
+// checkAreas trims and dedupes the station's nearby_area_ids and rejects ids
+// that are not managed service areas.
+func (s *Server) checkAreas(ctx context.Context, station *lastmilev1.Station) error {
+	ids := make([]string, 0, len(station.NearbyAreaIds))
+	for _, id := range station.NearbyAreaIds {
+		id = strings.TrimSpace(id)
+		if id == "" || slices.Contains(ids, id) {
+			continue
+		}
+		if _, err := s.areas.Get(ctx, id); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return status.Errorf(codes.InvalidArgument, "unknown nearby area %s", id)
+			}
+			return status.Error(codes.Internal, "storage error")
+		}
+		ids = append(ids, id)
+	}
+	station.NearbyAreaIds = ids
+	return nil
+}
+
+func haversineMeters(a, b *lastmilev1.LatLng) float64 {
+	const earthRadiusMeters = 6371000
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func pageParams(pageSize int32, pageToken, filter string) (string, int, error) {
+	if pageSize < 0 {
+		return "", 0, status.Error(codes.InvalidArgument, "page_size must be positive")
+	}
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	after := ""
+	if pageToken != "" {
+		key, err := pagetoken.Decode(pageToken, filter)
+		if err != nil {
+			return "", 0, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = key
+	}
+	return after, int(pageSize), nil
+}
+
+func nextPageToken(next, filter string) string {
+	if next == "" {
+		return ""
+	}
+	return pagetoken.Encode(next, filter)
+}
+
+func storageStatus(err error, entity string) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return status.Errorf(codes.NotFound, "%s not found", entity)
+	}
+	if errors.Is(err, storage.ErrInvalidArgument) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, "storage error")
+}
@@ -0,0 +1,207 @@
+package station
+
+import (
+	"context"
+	"testing"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/grpc/codes"
+)
+
+// square returns a closed ring around (lat, lng) with the given half side.
+func square(lat, lng, half float64) []*lastmilev1.LatLng {
+	return []*lastmilev1.LatLng{
+		{Latitude: lat - half, Longitude: lng - half},
+		{Latitude: lat - half, Longitude: lng + half},
+		{Latitude: lat + half, Longitude: lng + half},
+		{Latitude: lat + half, Longitude: lng - half},
+		{Latitude: lat - half, Longitude: lng - half},
+	}
+}
+
+func seedAreas(t *testing.T, server *Server, ids ...string) {
+	t.Helper()
+	for i, id := range ids {
+		_, err := server.UpsertServiceArea(context.Background(), &lastmilev1.UpsertServiceAreaRequest{Area: &lastmilev1.ServiceArea{
+			AreaId:   id,
+			Name:     id,
+			Boundary: square(float64(i), 100, 0.1),
+		}})
+		if err != nil {
+			t.Fatalf("unexpected error seeding area %s: %v", id, err)
+		}
+	}
+}
+
+func TestUpsertServiceAreaValidation(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+
+	_, err := server.UpsertServiceArea(ctx, &lastmilev1.UpsertServiceAreaRequest{})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = server.UpsertServiceArea(ctx, &lastmilev1.UpsertServiceAreaRequest{Area: &lastmilev1.ServiceArea{Boundary: square(0, 0, 1)}})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	if _, err := server.UpsertServiceArea(ctx, &lastmilev1.UpsertServiceAreaRequest{Area: &lastmilev1.ServiceArea{
+		Name:     "Triangle",
+		Boundary: square(0, 0, 1)[:3],
+	}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.UpsertServiceArea(ctx, &lastmilev1.UpsertServiceAreaRequest{Area: &lastmilev1.ServiceArea{
+		Name:     "Closed pair",
+		Boundary: []*lastmilev1.LatLng{{Latitude: 1, Longitude: 1}, {Latitude: 2, Longitude: 2}, {Latitude: 1, Longitude: 1}},
+	}})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = server.UpsertServiceArea(ctx, &lastmilev1.UpsertServiceAreaRequest{Area: &lastmilev1.ServiceArea{
+		Name:     "Bad vertex",
+		Boundary: append(square(0, 0, 1), &lastmilev1.LatLng{Latitude: 91}),
+	}})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	resp, err := server.UpsertServiceArea(ctx, &lastmilev1.UpsertServiceAreaRequest{Area: &lastmilev1.ServiceArea{
+		Name:     " Koramangala ",
+		Boundary: square(12.93, 77.62, 0.02),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Area.AreaId == "" || resp.Area.Name != "Koramangala" || len(resp.Area.Boundary) != 4 {
+		t.Fatalf("expected generated id, trimmed name and open ring, got %v", resp.Area)
+	}
+	got, err := server.GetServiceArea(ctx, &lastmilev1.GetServiceAreaRequest{AreaId: resp.Area.AreaId})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Area.Name != "Koramangala" {
+		t.Fatalf("unexpected area: %v", got.Area)
+	}
+	_, err = server.GetServiceArea(ctx, &lastmilev1.GetServiceAreaRequest{AreaId: "missing"})
+	assertStatusCode(t, err, codes.NotFound)
+}
+
+func TestServiceAreasGuardStations(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	seedAreas(t, server, "a1", "a2", "a3")
+
+	_, err := server.UpsertStation(ctx, &lastmilev1.UpsertStationRequest{Station: &lastmilev1.Station{
+		Name:          "Central",
+		Location:      &lastmilev1.LatLng{Latitude: 1, Longitude: 2},
+		NearbyAreaIds: []string{"a1", "nope"},
+	}})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	created, err := server.UpsertStation(ctx, &lastmilev1.UpsertStationRequest{Station: &lastmilev1.Station{
+		Name:          "Central",
+		Location:      &lastmilev1.LatLng{Latitude: 1, Longitude: 2},
+		NearbyAreaIds: []string{"a1", " a1", ""},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(created.Station.NearbyAreaIds) != 1 {
+		t.Fatalf("expected duplicate and blank area ids dropped, got %v", created.Station.NearbyAreaIds)
+	}
+
+	_, err = server.DeleteServiceArea(ctx, &lastmilev1.DeleteServiceAreaRequest{AreaId: "a1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	if _, err := server.DeleteServiceArea(ctx, &lastmilev1.DeleteServiceAreaRequest{AreaId: "a2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.DeleteServiceArea(ctx, &lastmilev1.DeleteServiceAreaRequest{AreaId: "a2"})
+	assertStatusCode(t, err, codes.NotFound)
+
+	page, err := server.ListServiceAreas(ctx, &lastmilev1.ListServiceAreasRequest{PageSize: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Areas) != 1 || page.Areas[0].AreaId != "a1" || page.NextPageToken == "" {
+		t.Fatalf("unexpected first page: %v", page)
+	}
+	page, err = server.ListServiceAreas(ctx, &lastmilev1.ListServiceAreasRequest{PageSize: 1, PageToken: page.NextPageToken})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Areas) != 1 || page.Areas[0].AreaId != "a3" || page.NextPageToken != "" {
+		t.Fatalf("unexpected second page: %v", page)
+	}
+}
+
+func TestResolveDropOff(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	if _, err := server.UpsertServiceArea(ctx, &lastmilev1.UpsertServiceAreaRequest{Area: &lastmilev1.ServiceArea{
+		AreaId:   "indiranagar",
+		Name:     "Indiranagar",
+		Boundary: square(12.97, 77.64, 0.02),
+	}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, station := range []*lastmilev1.Station{
+		{StationId: "far", Name: "Far", Location: &lastmilev1.LatLng{Latitude: 12.99, Longitude: 77.66}, NearbyAreaIds: []string{"indiranagar"}},
+		{StationId: "near", Name: "Near", Location: &lastmilev1.LatLng{Latitude: 12.975, Longitude: 77.64}, NearbyAreaIds: []string{"indiranagar"}},
+		{StationId: "other", Name: "Other", Location: &lastmilev1.LatLng{Latitude: 12.97, Longitude: 77.64}},
+	} {
+		if _, err := server.UpsertStation(ctx, &lastmilev1.UpsertStationRequest{Station: station}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	resp, err := server.ResolveDropOff(ctx, &lastmilev1.ResolveDropOffRequest{Location: &lastmilev1.LatLng{Latitude: 12.97, Longitude: 77.64}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Area.AreaId != "indiranagar" || resp.Station.GetStationId() != "near" || resp.DistanceMeters < 500 || resp.DistanceMeters > 600 {
+		t.Fatalf("unexpected resolution: %v", resp)
+	}
+
+	_, err = server.ResolveDropOff(ctx, &lastmilev1.ResolveDropOffRequest{Location: &lastmilev1.LatLng{Latitude: 13.1, Longitude: 77.64}})
+	assertStatusCode(t, err, codes.NotFound)
+	_, err = server.ResolveDropOff(ctx, &lastmilev1.ResolveDropOffRequest{})
+	assertStatusCode(t, err, codes.InvalidArgument)
+}
+
+func TestDestinationsResolveArea(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	seedAreas(t, server, "a1")
+
+	_, err := server.UpsertDestination(ctx, &lastmilev1.UpsertDestinationRequest{Destination: &lastmilev1.Destination{Name: "Nowhere"}})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	inside, err := server.UpsertDestination(ctx, &lastmilev1.UpsertDestinationRequest{Destination: &lastmilev1.Destination{
+		Name:     "Tech Park",
+		Location: &lastmilev1.LatLng{Latitude: 0.05, Longitude: 100.05},
+		AreaId:   "ignored",
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inside.Destination.DestinationId == "" || inside.Destination.AreaId != "a1" {
+		t.Fatalf("expected generated id inside a1, got %v", inside.Destination)
+	}
+	outside, err := server.UpsertDestination(ctx, &lastmilev1.UpsertDestinationRequest{Destination: &lastmilev1.Destination{
+		DestinationId: "d-out",
+		Name:          "Lake",
+		Location:      &lastmilev1.LatLng{Latitude: 5, Longitude: 5},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if outside.Destination.AreaId != "" {
+		t.Fatalf("expected no area outside every polygon, got %q", outside.Destination.AreaId)
+	}
+
+	list, err := server.ListDestinations(ctx, &lastmilev1.ListDestinationsRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.Destinations) != 2 {
+		t.Fatalf("expected 2 destinations, got %d", len(list.Destinations))
+	}
+	if _, err := server.DeleteDestination(ctx, &lastmilev1.DeleteDestinationRequest{DestinationId: "d-out"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.GetDestination(ctx, &lastmilev1.GetDestinationRequest{DestinationId: "d-out"})
+	assertStatusCode(t, err, codes.NotFound)
+}
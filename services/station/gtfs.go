@@ -0,0 +1,188 @@
+package station
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	gtfsStationPrefix   = "gtfs_"
+	allWeekdays         = 0x7f
+	defaultSuggestLimit = 5
+	maxSuggestLimit     = 50
+	// suggestHorizonDays is how many service days ahead suggestions look.
+	suggestHorizonDays = 7
+)
+
+// ImportGtfsStations writes each streamed parent station as station
+// gtfs_<stop_id>. Names and locations come from the feed; nearby areas set by
+// operators are kept. Stations already received stay written if a later one
+// is rejected, and re-running the import is safe.
+func (s *Server) ImportGtfsStations(stream grpc.ClientStreamingServer[lastmilev1.GtfsStation, lastmilev1.ImportGtfsStationsResponse]) error {
+	ctx := stream.Context()
+	importedAt := timestamppb.Now()
+	resp := &lastmilev1.ImportGtfsStationsResponse{}
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		stopID := strings.TrimSpace(in.StopId)
+		if stopID == "" {
+			return status.Error(codes.InvalidArgument, "stop_id is required")
+		}
+		if err := validateSchedule(in); err != nil {
+			return status.Errorf(codes.InvalidArgument, "gtfs stop %s: %s", stopID, err.Error())
+		}
+
+		stationID := gtfsStationPrefix + stopID
+		station, err := s.store.Get(ctx, stationID)
+		created := errors.Is(err, storage.ErrNotFound)
+		if created {
+			station = &lastmilev1.Station{StationId: stationID}
+		} else if err != nil {
+			return status.Error(codes.Internal, "storage error")
+		}
+		station.Name = in.Name
+		station.Location = cloneLatLng(in.Location)
+		station.GtfsStopId = stopID
+		if err := normalizeStation(station); err != nil {
+			return status.Errorf(codes.InvalidArgument, "gtfs stop %s: %s", stopID, status.Convert(err).Message())
+		}
+		if err := s.store.Upsert(ctx, station); err != nil {
+			return status.Error(codes.Internal, "storage error")
+		}
+		if err := s.schedules.PutSchedule(ctx, &lastmilev1.StationSchedule{
+			StationId:  stationID,
+			Timezone:   in.Timezone,
+			Arrivals:   in.Arrivals,
+			ImportedAt: importedAt,
+		}); err != nil {
+			return status.Error(codes.Internal, "storage error")
+		}
+
+		if created {
+			resp.Created++
+		} else {
+			resp.Updated++
+		}
+		resp.Arrivals += int32(len(in.Arrivals))
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (s *Server) SuggestArrivalTimes(ctx context.Context, req *lastmilev1.SuggestArrivalTimesRequest) (*lastmilev1.SuggestArrivalTimesResponse, error) {
+	if req == nil || strings.TrimSpace(req.StationId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultSuggestLimit
+	}
+	limit = min(limit, maxSuggestLimit)
+	after := time.Now()
+	if req.After != nil {
+		if !req.After.IsValid() {
+			return nil, status.Error(codes.InvalidArgument, "after is invalid")
+		}
+		after = req.After.AsTime()
+	}
+
+	schedule, err := s.schedules.GetSchedule(ctx, strings.TrimSpace(req.StationId))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "station has no schedule")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	location := time.UTC
+	if schedule.Timezone != "" {
+		if loaded, err := time.LoadLocation(schedule.Timezone); err == nil {
+			location = loaded
+		}
+	}
+	return &lastmilev1.SuggestArrivalTimesResponse{Arrivals: upcomingArrivals(schedule, location, after, limit)}, nil
+}
+
+// upcomingArrivals returns the first limit arrivals at or after the given
+// time. Service days start one day back because GTFS times past 24:00 belong
+// to the previous day's service.
+func upcomingArrivals(schedule *lastmilev1.StationSchedule, location *time.Location, after time.Time, limit int) []*lastmilev1.SuggestedArrival {
+	local := after.In(location)
+	var out []*lastmilev1.SuggestedArrival
+	for day := -1; day <= suggestHorizonDays; day++ {
+		noon := time.Date(local.Year(), local.Month(), local.Day()+day, 12, 0, 0, 0, location)
+		// GTFS measures times from noon minus 12h, which differs from
+		// midnight on daylight saving changes.
+		base := noon.Add(-12 * time.Hour)
+		bit := int32(1) << ((int(noon.Weekday()) + 6) % 7)
+		first := sort.Search(len(schedule.Arrivals), func(i int) bool {
+			return !base.Add(time.Duration(schedule.Arrivals[i].ArrivalSeconds) * time.Second).Before(after)
+		})
+		taken := 0
+		for _, arrival := range schedule.Arrivals[first:] {
+			if taken == limit {
+				break
+			}
+			if arrival.Weekdays&bit == 0 {
+				continue
+			}
+			out = append(out, &lastmilev1.SuggestedArrival{
+				ArrivalTime:  timestamppb.New(base.Add(time.Duration(arrival.ArrivalSeconds) * time.Second)),
+				RouteName:    arrival.RouteName,
+				Headsign:     arrival.Headsign,
+				TripId:       arrival.TripId,
+				StopSequence: arrival.StopSequence,
+				ServiceDate:  noon.Format("20060102"),
+			})
+			taken++
+		}
+	}
+	slices.SortStableFunc(out, func(a, b *lastmilev1.SuggestedArrival) int {
+		return a.ArrivalTime.AsTime().Compare(b.ArrivalTime.AsTime())
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func validateSchedule(in *lastmilev1.GtfsStation) error {
+	if in.Timezone != "" {
+		if _, err := time.LoadLocation(in.Timezone); err != nil {
+			return errors.New("unknown timezone " + in.Timezone)
+		}
+	}
+	if !slices.IsSortedFunc(in.Arrivals, func(a, b *lastmilev1.TrainArrival) int {
+		return int(a.ArrivalSeconds - b.ArrivalSeconds)
+	}) {
+		return errors.New("arrivals must be sorted by arrival_seconds")
+	}
+	for _, arrival := range in.Arrivals {
+		if arrival.ArrivalSeconds < 0 {
+			return errors.New("arrival_seconds must not be negative")
+		}
+		if arrival.Weekdays <= 0 || arrival.Weekdays > allWeekdays {
+			return errors.New("weekdays must be a non-empty Monday..Sunday mask")
+		}
+	}
+	return nil
+}
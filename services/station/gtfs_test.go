@@ -0,0 +1,145 @@
+package station
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestImportGtfsStationsAndSuggestArrivals(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	feed := []*lastmilev1.GtfsStation{{
+		StopId:   "100",
+		Name:     "Central",
+		Location: &lastmilev1.LatLng{Latitude: 12.97, Longitude: 77.59},
+		Timezone: "Asia/Kolkata",
+		Arrivals: []*lastmilev1.TrainArrival{
+			{TripId: "weekday", RouteName: "Blue", ArrivalSeconds: 7*3600 + 30*60, Weekdays: 0x1f},
+			{TripId: "daily", RouteName: "Blue", ArrivalSeconds: 8 * 3600, Weekdays: allWeekdays},
+			{TripId: "night", RouteName: "Red", Headsign: "Airport", ArrivalSeconds: 25*3600 + 10*60, Weekdays: allWeekdays},
+		},
+	}}
+
+	seedAreas(t, server, "a1")
+	resp := importGtfs(t, server, feed)
+	if resp.Created != 1 || resp.Updated != 0 || resp.Arrivals != 3 {
+		t.Fatalf("unexpected import summary: %v", resp)
+	}
+	_, err := server.UpdateStation(ctx, &lastmilev1.UpdateStationRequest{
+		Station:    &lastmilev1.Station{StationId: "gtfs_100", NearbyAreaIds: []string{"a1"}},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"nearby_area_ids"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	feed[0].Name = "Central Station"
+	resp = importGtfs(t, server, feed)
+	if resp.Created != 0 || resp.Updated != 1 {
+		t.Fatalf("expected re-import to update, got %v", resp)
+	}
+	got, err := server.GetStation(ctx, &lastmilev1.GetStationRequest{StationId: "gtfs_100"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Station.Name != "Central Station" || got.Station.GtfsStopId != "100" || len(got.Station.NearbyAreaIds) != 1 {
+		t.Fatalf("unexpected station after re-import: %v", got.Station)
+	}
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	// Saturday 00:30: Friday's 25:10 trip is still ahead, the weekday-only
+	// trip is not.
+	after := time.Date(2026, time.October, 17, 0, 30, 0, 0, kolkata)
+	suggested, err := server.SuggestArrivalTimes(ctx, &lastmilev1.SuggestArrivalTimesRequest{
+		StationId: "gtfs_100",
+		After:     timestamppb.New(after),
+		Limit:     3,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []time.Time{
+		time.Date(2026, time.October, 17, 1, 10, 0, 0, kolkata),
+		time.Date(2026, time.October, 17, 8, 0, 0, 0, kolkata),
+		time.Date(2026, time.October, 18, 1, 10, 0, 0, kolkata),
+	}
+	if len(suggested.Arrivals) != len(want) {
+		t.Fatalf("expected %d arrivals, got %v", len(want), suggested.Arrivals)
+	}
+	for i, arrival := range suggested.Arrivals {
+		if !arrival.ArrivalTime.AsTime().Equal(want[i]) {
+			t.Fatalf("arrival %d: expected %v, got %v", i, want[i], arrival.ArrivalTime.AsTime().In(kolkata))
+		}
+	}
+	if suggested.Arrivals[0].Headsign != "Airport" || suggested.Arrivals[0].TripId != "night" || suggested.Arrivals[0].ServiceDate != "20261016" {
+		t.Fatalf("unexpected first arrival: %v", suggested.Arrivals[0])
+	}
+
+	_, err = server.SuggestArrivalTimes(ctx, &lastmilev1.SuggestArrivalTimesRequest{StationId: "missing"})
+	assertStatusCode(t, err, codes.NotFound)
+}
+
+func TestImportGtfsStationsValidation(t *testing.T) {
+	server := NewServer()
+	location := &lastmilev1.LatLng{Latitude: 1, Longitude: 1}
+	for name, station := range map[string]*lastmilev1.GtfsStation{
+		"no weekdays": {StopId: "1", Name: "A", Location: location, Arrivals: []*lastmilev1.TrainArrival{{ArrivalSeconds: 60}}},
+		"unsorted": {StopId: "1", Name: "A", Location: location, Arrivals: []*lastmilev1.TrainArrival{
+			{ArrivalSeconds: 120, Weekdays: allWeekdays},
+			{ArrivalSeconds: 60, Weekdays: allWeekdays},
+		}},
+		"bad timezone": {StopId: "1", Name: "A", Location: location, Timezone: "Mars/Olympus"},
+		"no name":      {StopId: "1", Location: location},
+	} {
+		t.Run(name, func(t *testing.T) {
+			stream := &gtfsStream{ctx: context.Background(), stations: []*lastmilev1.GtfsStation{station}}
+			assertStatusCode(t, server.ImportGtfsStations(stream), codes.InvalidArgument)
+		})
+	}
+}
+
+func importGtfs(t *testing.T, server *Server, stations []*lastmilev1.GtfsStation) *lastmilev1.ImportGtfsStationsResponse {
+	t.Helper()
+	stream := &gtfsStream{ctx: context.Background(), stations: stations}
+	if err := server.ImportGtfsStations(stream); err != nil {
+		t.Fatalf("unexpected import error: %v", err)
+	}
+	return stream.resp
+}
+
+type gtfsStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	stations []*lastmilev1.GtfsStation
+	resp     *lastmilev1.ImportGtfsStationsResponse
+}
+
+func (s *gtfsStream) Context() context.Context { return s.ctx }
+
+func (s *gtfsStream) Recv() (*lastmilev1.GtfsStation, error) {
+	if len(s.stations) == 0 {
+		return nil, io.EOF
+	}
+	station := s.stations[0]
+	s.stations = s.stations[1:]
+	return station, nil
+}
+
+func (s *gtfsStream) SendAndClose(resp *lastmilev1.ImportGtfsStationsResponse) error {
+	if s.resp != nil {
+		return errors.New("response already sent")
+	}
+	s.resp = resp
+	return nil
+}
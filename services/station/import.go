@@ -0,0 +1,133 @@
+package station
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxImportBytes  = 32 << 20
+	exportChunkSize = 32 << 10
+	exportPageSize  = 500
+)
+
+func (s *Server) ImportStations(stream grpc.ClientStreamingServer[lastmilev1.ImportStationsRequest, lastmilev1.ImportStationsResponse]) error {
+	ctx := stream.Context()
+	var data bytes.Buffer
+	var format lastmilev1.StationFileFormat
+	dryRun := false
+	first := true
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			format = req.Format
+			dryRun = req.DryRun
+			first = false
+		}
+		if data.Len()+len(req.Chunk) > maxImportBytes {
+			return status.Errorf(codes.InvalidArgument, "import is larger than %d bytes", maxImportBytes)
+		}
+		data.Write(req.Chunk)
+	}
+
+	rows, err := parseStationFile(format, data.Bytes())
+	if err != nil {
+		return err
+	}
+
+	resp := &lastmilev1.ImportStationsResponse{TotalRows: int32(len(rows)), DryRun: dryRun}
+	rowByID := make(map[string]int, len(rows))
+	for _, row := range rows {
+		if row.err != "" {
+			resp.Errors = append(resp.Errors, &lastmilev1.StationImportError{Row: int32(row.row), Message: row.err})
+			continue
+		}
+		station := row.station
+		err := normalizeStation(station)
+		if err == nil {
+			err = s.checkAreas(ctx, station)
+		}
+		if err != nil {
+			resp.Errors = append(resp.Errors, &lastmilev1.StationImportError{
+				Row:       int32(row.row),
+				StationId: station.StationId,
+				Message:   status.Convert(err).Message(),
+			})
+			continue
+		}
+		if station.StationId == "" {
+			station.StationId = newID("station")
+		} else if previous, ok := rowByID[station.StationId]; ok {
+			resp.Errors = append(resp.Errors, &lastmilev1.StationImportError{
+				Row:       int32(row.row),
+				StationId: station.StationId,
+				Message:   fmt.Sprintf("duplicate of row %d", previous),
+			})
+			continue
+		}
+		rowByID[station.StationId] = row.row
+
+		if !dryRun {
+			if err := s.store.Upsert(ctx, station); err != nil {
+				return status.Errorf(codes.Internal, "storage error after importing %d rows", resp.Imported)
+			}
+		}
+		resp.Imported++
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (s *Server) ExportStations(req *lastmilev1.ExportStationsRequest, stream grpc.ServerStreamingServer[lastmilev1.ExportStationsResponse]) error {
+	ctx := stream.Context()
+	out := bufio.NewWriterSize(chunkWriter{stream: stream}, exportChunkSize)
+	encoder, err := newStationEncoder(req.GetFormat(), out)
+	if err != nil {
+		return err
+	}
+	for after := ""; ; {
+		stations, next, err := s.store.List(ctx, after, exportPageSize)
+		if err != nil {
+			return status.Error(codes.Internal, "storage error")
+		}
+		for _, station := range stations {
+			if err := encoder.Encode(station); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// chunkWriter sends each write as one ExportStationsResponse chunk.
+type chunkWriter struct {
+	stream grpc.ServerStreamingServer[lastmilev1.ExportStationsResponse]
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	chunk := append([]byte(nil), p...)
+	if err := w.stream.Send(&lastmilev1.ExportStationsResponse{Chunk: chunk}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
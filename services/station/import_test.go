@@ -0,0 +1,160 @@
+package station
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestImportStationsCSV(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	seedAreas(t, server, "a1", "a2")
+	file := "id,name,lat,lng,areas\n" +
+		"s1,Central,12.97,77.59,a1;a2\n" +
+		"s2,North,95,77.6,\n" +
+		"s1,Again,12.9,77.5\n" +
+		",Unnamed Id,12.8,77.4\n" +
+		"s3,,12.7,77.3\n" +
+		"s4,West,abc,77.2\n" +
+		"s5,East,12.6,77.7,a9\n"
+
+	dry := importFile(t, server, lastmilev1.StationFileFormat_STATION_FILE_FORMAT_CSV, true, file)
+	if dry.TotalRows != 7 || dry.Imported != 2 || !dry.DryRun {
+		t.Fatalf("unexpected dry run summary: %v", dry)
+	}
+	if got := rowsWithErrors(dry); got != "3,4,6,7,8" {
+		t.Fatalf("expected errors on lines 3,4,6,7,8, got %s", got)
+	}
+	list, _ := server.ListStations(ctx, &lastmilev1.ListStationsRequest{})
+	if len(list.Stations) != 0 {
+		t.Fatalf("expected dry run to write nothing, got %d stations", len(list.Stations))
+	}
+
+	resp := importFile(t, server, lastmilev1.StationFileFormat_STATION_FILE_FORMAT_CSV, false, file)
+	if resp.Imported != 2 {
+		t.Fatalf("expected 2 imported rows, got %d", resp.Imported)
+	}
+	got, err := server.GetStation(ctx, &lastmilev1.GetStationRequest{StationId: "s1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Station.Name != "Central" || len(got.Station.NearbyAreaIds) != 2 {
+		t.Fatalf("unexpected station: %v", got.Station)
+	}
+
+	stream := &importStream{ctx: ctx}
+	assertStatusCode(t, server.ImportStations(stream), codes.InvalidArgument)
+}
+
+func TestExportStationsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := NewServer()
+	seedAreas(t, source, "a1", "a2")
+	for _, station := range []*lastmilev1.Station{
+		{StationId: "s1", Name: "Central, Main", Location: &lastmilev1.LatLng{Latitude: 12.97, Longitude: 77.59}, NearbyAreaIds: []string{"a1", "a2"}},
+		{StationId: "s2", Name: "North", Location: &lastmilev1.LatLng{Latitude: -1.5, Longitude: 36.8}},
+	} {
+		if _, err := source.UpsertStation(ctx, &lastmilev1.UpsertStationRequest{Station: station}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for _, format := range []lastmilev1.StationFileFormat{
+		lastmilev1.StationFileFormat_STATION_FILE_FORMAT_CSV,
+		lastmilev1.StationFileFormat_STATION_FILE_FORMAT_GEOJSON,
+	} {
+		t.Run(format.String(), func(t *testing.T) {
+			out := &exportStream{ctx: ctx}
+			if err := source.ExportStations(&lastmilev1.ExportStationsRequest{Format: format}, out); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			target := NewServer()
+			seedAreas(t, target, "a1", "a2")
+			resp := importFile(t, target, format, false, out.buf.String())
+			if resp.Imported != 2 || len(resp.Errors) != 0 {
+				t.Fatalf("expected clean re-import, got %v", resp)
+			}
+			got, err := target.GetStation(ctx, &lastmilev1.GetStationRequest{StationId: "s1"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Station.Name != "Central, Main" || got.Station.Location.Longitude != 77.59 || len(got.Station.NearbyAreaIds) != 2 {
+				t.Fatalf("station did not round-trip: %v", got.Station)
+			}
+		})
+	}
+}
+
+func importFile(t *testing.T, server *Server, format lastmilev1.StationFileFormat, dryRun bool, file string) *lastmilev1.ImportStationsResponse {
+	t.Helper()
+	stream := &importStream{ctx: context.Background()}
+	// Split the file so rows straddle chunk boundaries.
+	for i := 0; i < len(file); i += 16 {
+		req := &lastmilev1.ImportStationsRequest{Chunk: []byte(file[i:min(i+16, len(file))])}
+		if i == 0 {
+			req.Format = format
+			req.DryRun = dryRun
+		}
+		stream.requests = append(stream.requests, req)
+	}
+	if err := server.ImportStations(stream); err != nil {
+		t.Fatalf("unexpected import error: %v", err)
+	}
+	return stream.resp
+}
+
+func rowsWithErrors(resp *lastmilev1.ImportStationsResponse) string {
+	rows := make([]string, 0, len(resp.Errors))
+	for _, rowErr := range resp.Errors {
+		rows = append(rows, strconv.Itoa(int(rowErr.Row)))
+	}
+	return strings.Join(rows, ",")
+}
+
+type importStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	requests []*lastmilev1.ImportStationsRequest
+	resp     *lastmilev1.ImportStationsResponse
+}
+
+func (s *importStream) Context() context.Context { return s.ctx }
+
+func (s *importStream) Recv() (*lastmilev1.ImportStationsRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *importStream) SendAndClose(resp *lastmilev1.ImportStationsResponse) error {
+	if s.resp != nil {
+		return errors.New("response already sent")
+	}
+	s.resp = resp
+	return nil
+}
+
+type exportStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	buf bytes.Buffer
+}
+
+func (s *exportStream) Context() context.Context { return s.ctx }
+
+func (s *exportStream) Send(resp *lastmilev1.ExportStationsResponse) error {
+	s.buf.Write(resp.Chunk)
+	return nil
+}
@@ -6,29 +6,85 @@ import (
 	"encoding/hex"
 	"errors"
 	"math"
-	"strconv"
+	"slices"
 	"strings"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
 	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
+const (
+	defaultSearchRadius = 1000
+	maxSearchRadius     = 50000
+	defaultSearchLimit  = 10
+	maxSearchLimit      = 100
+)
+
+var stationUpdatableFields = []string{"name", "location", "nearby_area_ids"}
+
 type Server struct {
 	lastmilev1.UnimplementedStationServiceServer
-	store storage.StationStore
+	store     storage.StationStore
+	schedules storage.ScheduleStore
+	requests  storage.RideRequestStore
+	trips     storage.TripStore
+
+	areas        storage.AreaStore
+	destinations storage.DestinationStore
+}
+
+// Stores holds the station and schedule stores plus the ride request and trip
+// stores that DeleteStation checks for references.
+type Stores struct {
+	Stations  storage.StationStore
+	Schedules storage.ScheduleStore
+	Requests  storage.RideRequestStore
+	Trips     storage.TripStore
+
+	Areas        storage.AreaStore
+	Destinations storage.DestinationStore
 }
 
 func NewServer() *Server {
-	return NewServerWithStore(storage.NewMemoryStationStore())
+	return NewServerWithStores(Stores{})
 }
 
 func NewServerWithStore(store storage.StationStore) *Server {
-	if store == nil {
-		store = storage.NewMemoryStationStore()
+	return NewServerWithStores(Stores{Stations: store})
+}
+
+func NewServerWithStores(stores Stores) *Server {
+	if stores.Stations == nil {
+		stores.Stations = storage.NewMemoryStationStore()
+	}
+	if stores.Schedules == nil {
+		stores.Schedules = storage.NewMemoryScheduleStore()
+	}
+	if stores.Requests == nil {
+		stores.Requests = storage.NewMemoryRideRequestStore(nil)
+	}
+	if stores.Trips == nil {
+		stores.Trips = storage.NewMemoryTripStore(nil)
+	}
+	if stores.Areas == nil {
+		stores.Areas = storage.NewMemoryAreaStore()
+	}
+	if stores.Destinations == nil {
+		stores.Destinations = storage.NewMemoryDestinationStore()
+	}
+	return &Server{
+		store:     stores.Stations,
+		schedules: stores.Schedules,
+		requests:  stores.Requests,
+		trips:     stores.Trips,
+
+		areas:        stores.Areas,
+		destinations: stores.Destinations,
 	}
-	return &Server{store: store}
 }
 
 func (s *Server) UpsertStation(ctx context.Context, req *lastmilev1.UpsertStationRequest) (*lastmilev1.UpsertStationResponse, error) {
@@ -36,19 +92,14 @@ func (s *Server) UpsertStation(ctx context.Context, req *lastmilev1.UpsertStatio
 		return nil, status.Error(codes.InvalidArgument, "station is required")
 	}
 	station := cloneStation(req.Station)
-	station.Name = strings.TrimSpace(station.Name)
-	if station.Name == "" {
-		return nil, status.Error(codes.InvalidArgument, "name is required")
+	if err := normalizeStation(station); err != nil {
+		return nil, err
 	}
-	if err := validateLatLng(station.Location); err != nil {
+	if err := s.checkAreas(ctx, station); err != nil {
 		return nil, err
 	}
-
-	stationID := strings.TrimSpace(station.StationId)
-	if stationID == "" {
+	if station.StationId == "" {
 		station.StationId = newID("station")
-	} else {
-		station.StationId = stationID
 	}
 
 	if err := s.store.Upsert(ctx, station); err != nil {
@@ -80,33 +131,121 @@ func (s *Server) GetStation(ctx context.Context, req *lastmilev1.GetStationReque
 	return &lastmilev1.GetStationResponse{Station: cloneStation(station)}, nil
 }
 
-func (s *Server) ListStations(ctx context.Context, req *lastmilev1.ListStationsRequest) (*lastmilev1.ListStationsResponse, error) {
-	pageSize := int32(50)
-	pageToken := "0"
-	if req != nil {
-		if req.PageSize < 0 {
-			return nil, status.Error(codes.InvalidArgument, "page_size must be positive")
+func (s *Server) UpdateStation(ctx context.Context, req *lastmilev1.UpdateStationRequest) (*lastmilev1.UpdateStationResponse, error) {
+	if req == nil || req.Station == nil {
+		return nil, status.Error(codes.InvalidArgument, "station is required")
+	}
+	stationID := strings.TrimSpace(req.Station.StationId)
+	if stationID == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	paths, err := updatePaths(req.UpdateMask)
+	if err != nil {
+		return nil, err
+	}
+
+	station, err := s.store.Get(ctx, stationID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "station not found")
 		}
-		if req.PageSize > 0 {
-			pageSize = req.PageSize
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			station.Name = strings.TrimSpace(req.Station.Name)
+		case "location":
+			station.Location = cloneLatLng(req.Station.Location)
+		case "nearby_area_ids":
+			station.NearbyAreaIds = append([]string(nil), req.Station.NearbyAreaIds...)
 		}
-		if req.PageToken != "" {
-			pageToken = req.PageToken
+	}
+	if station.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if err := validateLatLng(station.Location); err != nil {
+		return nil, err
+	}
+	if err := s.checkAreas(ctx, station); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Update(ctx, station); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "station not found")
 		}
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.UpdateStationResponse{Station: cloneStation(station)}, nil
+}
+
+func (s *Server) DeleteStation(ctx context.Context, req *lastmilev1.DeleteStationRequest) (*lastmilev1.DeleteStationResponse, error) {
+	if req == nil || strings.TrimSpace(req.StationId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	stationID := strings.TrimSpace(req.StationId)
+
+	if !req.Force {
+		if _, err := s.store.Get(ctx, stationID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, status.Error(codes.NotFound, "station not found")
+			}
+			return nil, status.Error(codes.Internal, "storage error")
+		}
+		if err := s.checkUnreferenced(ctx, stationID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.store.Delete(ctx, stationID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "station not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
 	}
-	if pageSize > 100 {
-		pageSize = 100
+	return &lastmilev1.DeleteStationResponse{}, nil
+}
+
+// checkUnreferenced refuses deletion while riders are waiting at the station
+// or a scheduled or active trip still serves it.
+func (s *Server) checkUnreferenced(ctx context.Context, stationID string) error {
+	requests, err := s.requests.ListRideRequests(ctx, storage.RideRequestFilter{
+		StationID: stationID,
+		Status:    lastmilev1.RideStatus_RIDE_STATUS_PENDING,
+	})
+	if err != nil {
+		return status.Error(codes.Internal, "storage error")
 	}
-	if pageSize <= 0 {
-		return nil, status.Error(codes.InvalidArgument, "page_size must be positive")
+	if len(requests) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "station has %d pending ride requests", len(requests))
 	}
+	for _, tripStatus := range []lastmilev1.TripStatus{
+		lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+		lastmilev1.TripStatus_TRIP_STATUS_ACTIVE,
+	} {
+		trips, err := s.trips.ListTrips(ctx, storage.TripFilter{StationID: stationID, Status: tripStatus})
+		if err != nil {
+			return status.Error(codes.Internal, "storage error")
+		}
+		if len(trips) > 0 {
+			return status.Error(codes.FailedPrecondition, "station is served by an open trip")
+		}
+	}
+	return nil
+}
 
-	offset, err := strconv.Atoi(pageToken)
-	if err != nil || offset < 0 {
-		return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+func (s *Server) ListStations(ctx context.Context, req *lastmilev1.ListStationsRequest) (*lastmilev1.ListStationsResponse, error) {
+	filter := pagetoken.FilterHash("stations")
+	after, limit, err := pageParams(req.GetPageSize(), req.GetPageToken(), filter)
+	if err != nil {
+		return nil, err
 	}
 
-	stations, nextOffset, err := s.store.List(ctx, offset, int(pageSize))
+	stations, next, err := s.store.List(ctx, after, limit)
 	if err != nil {
 		if errors.Is(err, storage.ErrInvalidArgument) {
 			return nil, status.Error(codes.InvalidArgument, err.Error())
@@ -114,12 +253,53 @@ func (s *Server) ListStations(ctx context.Context, req *lastmilev1.ListStationsR
 		return nil, status.Error(codes.Internal, "storage error")
 	}
 
-	nextToken := ""
-	if nextOffset >= 0 {
-		nextToken = strconv.Itoa(nextOffset)
+	return &lastmilev1.ListStationsResponse{Stations: stations, NextPageToken: nextPageToken(next, filter)}, nil
+}
+
+func (s *Server) SearchStationsNear(ctx context.Context, req *lastmilev1.SearchStationsNearRequest) (*lastmilev1.SearchStationsNearResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "location is required")
+	}
+	if err := validateLatLng(req.Location); err != nil {
+		return nil, err
+	}
+	radius := req.RadiusMeters
+	if radius < 0 || math.IsNaN(radius) {
+		return nil, status.Error(codes.InvalidArgument, "radius_meters must not be negative")
+	}
+	if radius == 0 {
+		radius = defaultSearchRadius
+	}
+	radius = math.Min(radius, maxSearchRadius)
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	stations, err := s.store.SearchNear(ctx, req.Location, radius, limit)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
 	}
+	return &lastmilev1.SearchStationsNearResponse{Stations: stations}, nil
+}
 
-	return &lastmilev1.ListStationsResponse{Stations: stations, NextPageToken: nextToken}, nil
+func updatePaths(mask *fieldmaskpb.FieldMask) ([]string, error) {
+	if len(mask.GetPaths()) == 0 {
+		return stationUpdatableFields, nil
+	}
+	for _, path := range mask.GetPaths() {
+		if !slices.Contains(stationUpdatableFields, path) {
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q is not supported", path)
+		}
+	}
+	return mask.GetPaths(), nil
 }
 
 func cloneStation(station *lastmilev1.Station) *lastmilev1.Station {
@@ -131,6 +311,7 @@ func cloneStation(station *lastmilev1.Station) *lastmilev1.Station {
 		Name:          station.Name,
 		Location:      cloneLatLng(station.Location),
 		NearbyAreaIds: append([]string(nil), station.NearbyAreaIds...),
+		GtfsStopId:    station.GtfsStopId,
 	}
 	return clone
 }
@@ -151,6 +332,17 @@ func newID(prefix string) string {
 	return prefix + "_" + hex.EncodeToString(buf)
 }
 
+// normalizeStation trims the id and name in place and applies the rules every
+// station write shares; imports report its errors per row.
+func normalizeStation(station *lastmilev1.Station) error {
+	station.StationId = strings.TrimSpace(station.StationId)
+	station.Name = strings.TrimSpace(station.Name)
+	if station.Name == "" {
+		return status.Error(codes.InvalidArgument, "name is required")
+	}
+	return validateLatLng(station.Location)
+}
+
 func validateLatLng(latlng *lastmilev1.LatLng) error {
 	if latlng == nil {
 		return status.Error(codes.InvalidArgument, "location is required")
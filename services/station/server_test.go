@@ -5,8 +5,11 @@ import (
 	"testing"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 func TestUpsertStationValidation(t *testing.T) {
@@ -91,7 +94,7 @@ func TestListStationsPagination(t *testing.T) {
 		}
 	}
 
-	resp, err := server.ListStations(context.Background(), &lastmilev1.ListStationsRequest{PageSize: 2, PageToken: "0"})
+	resp, err := server.ListStations(context.Background(), &lastmilev1.ListStationsRequest{PageSize: 2})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -101,23 +104,165 @@ func TestListStationsPagination(t *testing.T) {
 	if resp.Stations[0].StationId != "a" || resp.Stations[1].StationId != "b" {
 		t.Fatalf("unexpected order: %q, %q", resp.Stations[0].StationId, resp.Stations[1].StationId)
 	}
-	if resp.NextPageToken != "2" {
-		t.Fatalf("expected next token 2, got %q", resp.NextPageToken)
+	if resp.NextPageToken == "" || resp.NextPageToken == "2" {
+		t.Fatalf("expected an opaque next token, got %q", resp.NextPageToken)
+	}
+
+	// Stations added between pages must not cause skips or duplicates.
+	for _, id := range []string{"0", "bb"} {
+		if _, err := server.UpsertStation(context.Background(), &lastmilev1.UpsertStationRequest{Station: &lastmilev1.Station{
+			StationId: id,
+			Name:      id,
+			Location:  &lastmilev1.LatLng{Latitude: 1, Longitude: 1},
+		}}); err != nil {
+			t.Fatalf("unexpected upsert error: %v", err)
+		}
 	}
 
 	resp, err = server.ListStations(context.Background(), &lastmilev1.ListStationsRequest{PageSize: 2, PageToken: resp.NextPageToken})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(resp.Stations) != 1 {
-		t.Fatalf("expected 1 station, got %d", len(resp.Stations))
+	if len(resp.Stations) != 2 {
+		t.Fatalf("expected 2 stations, got %d", len(resp.Stations))
 	}
-	if resp.Stations[0].StationId != "c" {
-		t.Fatalf("expected station c, got %q", resp.Stations[0].StationId)
+	if resp.Stations[0].StationId != "bb" || resp.Stations[1].StationId != "c" {
+		t.Fatalf("unexpected second page: %q, %q", resp.Stations[0].StationId, resp.Stations[1].StationId)
 	}
 	if resp.NextPageToken != "" {
 		t.Fatalf("expected empty next token, got %q", resp.NextPageToken)
 	}
+
+	foreign := pagetoken.Encode("a", pagetoken.FilterHash("vehicles"))
+	_, err = server.ListStations(context.Background(), &lastmilev1.ListStationsRequest{PageToken: foreign})
+	assertStatusCode(t, err, codes.InvalidArgument)
+}
+
+func TestSearchStationsNear(t *testing.T) {
+	server := NewServer()
+	ctx := context.Background()
+	for _, st := range []*lastmilev1.Station{
+		{StationId: "mg-road", Name: "MG Road", Location: &lastmilev1.LatLng{Latitude: 12.9756, Longitude: 77.6066}},
+		{StationId: "trinity", Name: "Trinity", Location: &lastmilev1.LatLng{Latitude: 12.9730, Longitude: 77.6170}},
+		{StationId: "majestic", Name: "Majestic", Location: &lastmilev1.LatLng{Latitude: 12.9757, Longitude: 77.5729}},
+	} {
+		if _, err := server.UpsertStation(ctx, &lastmilev1.UpsertStationRequest{Station: st}); err != nil {
+			t.Fatalf("unexpected upsert error: %v", err)
+		}
+	}
+
+	resp, err := server.SearchStationsNear(ctx, &lastmilev1.SearchStationsNearRequest{
+		Location:     &lastmilev1.LatLng{Latitude: 12.9750, Longitude: 77.6080},
+		RadiusMeters: 1500,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Stations) != 2 {
+		t.Fatalf("expected 2 stations in range, got %d", len(resp.Stations))
+	}
+	if resp.Stations[0].Station.StationId != "mg-road" || resp.Stations[1].Station.StationId != "trinity" {
+		t.Fatalf("expected closest first, got %q, %q", resp.Stations[0].Station.StationId, resp.Stations[1].Station.StationId)
+	}
+	if d := resp.Stations[0].DistanceMeters; d <= 0 || d > 200 {
+		t.Fatalf("expected MG Road within 200m, got %f", d)
+	}
+
+	resp, err = server.SearchStationsNear(ctx, &lastmilev1.SearchStationsNearRequest{
+		Location:     &lastmilev1.LatLng{Latitude: 12.9750, Longitude: 77.6080},
+		RadiusMeters: 10000,
+		Limit:        1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Stations) != 1 {
+		t.Fatalf("expected limit to apply, got %d", len(resp.Stations))
+	}
+
+	_, err = server.SearchStationsNear(ctx, &lastmilev1.SearchStationsNearRequest{})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = server.SearchStationsNear(ctx, &lastmilev1.SearchStationsNearRequest{
+		Location: &lastmilev1.LatLng{Latitude: 12.9750, Longitude: 77.6080},
+		Limit:    -1,
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+}
+
+func TestUpdateStationAppliesMask(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	seedAreas(t, server, "area-1")
+	created, err := server.UpsertStation(ctx, &lastmilev1.UpsertStationRequest{Station: &lastmilev1.Station{
+		StationId: "s1",
+		Name:      "Main",
+		Location:  &lastmilev1.LatLng{Latitude: 1, Longitude: 2},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := server.UpdateStation(ctx, &lastmilev1.UpdateStationRequest{
+		Station:    &lastmilev1.Station{StationId: "s1", NearbyAreaIds: []string{"area-1"}},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"nearby_area_ids"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Station.Name != created.Station.Name || resp.Station.Location.Latitude != 1 {
+		t.Fatalf("expected name and location to be kept, got %v", resp.Station)
+	}
+	if len(resp.Station.NearbyAreaIds) != 1 || resp.Station.NearbyAreaIds[0] != "area-1" {
+		t.Fatalf("expected nearby area to be set, got %v", resp.Station.NearbyAreaIds)
+	}
+
+	_, err = server.UpdateStation(ctx, &lastmilev1.UpdateStationRequest{
+		Station:    &lastmilev1.Station{StationId: "s1"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"station_id"}},
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = server.UpdateStation(ctx, &lastmilev1.UpdateStationRequest{
+		Station:    &lastmilev1.Station{StationId: "s1"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = server.UpdateStation(ctx, &lastmilev1.UpdateStationRequest{Station: &lastmilev1.Station{StationId: "missing", Name: "x"}})
+	assertStatusCode(t, err, codes.NotFound)
+}
+
+func TestDeleteStationChecksReferences(t *testing.T) {
+	ctx := context.Background()
+	requests := storage.NewMemoryRideRequestStore(nil)
+	trips := storage.NewMemoryTripStore(nil)
+	server := NewServerWithStores(Stores{Requests: requests, Trips: trips})
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := server.UpsertStation(ctx, &lastmilev1.UpsertStationRequest{Station: &lastmilev1.Station{
+			StationId: id,
+			Name:      id,
+			Location:  &lastmilev1.LatLng{Latitude: 1, Longitude: 2},
+		}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := requests.CreateRideRequest(ctx, &lastmilev1.RideRequest{RequestId: "r1", StationId: "s1", Status: lastmilev1.RideStatus_RIDE_STATUS_PENDING}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := trips.CreateTrip(ctx, &lastmilev1.Trip{TripId: "t1", StationId: "s2", Status: lastmilev1.TripStatus_TRIP_STATUS_ACTIVE}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := server.DeleteStation(ctx, &lastmilev1.DeleteStationRequest{StationId: "s1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	_, err = server.DeleteStation(ctx, &lastmilev1.DeleteStationRequest{StationId: "s2"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	_, err = server.DeleteStation(ctx, &lastmilev1.DeleteStationRequest{StationId: "missing"})
+	assertStatusCode(t, err, codes.NotFound)
+
+	if _, err := server.DeleteStation(ctx, &lastmilev1.DeleteStationRequest{StationId: "s1", Force: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.GetStation(ctx, &lastmilev1.GetStationRequest{StationId: "s1"})
+	assertStatusCode(t, err, codes.NotFound)
 }
 
 func assertStatusCode(t *testing.T, err error, code codes.Code) {
@@ -0,0 +1,264 @@
+package station
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// csvHeader is written on export and recognised (and skipped) on import.
+var csvHeader = []string{"id", "name", "lat", "lng", "areas"}
+
+// csvAreaSeparator splits the areas column into nearby area ids.
+const csvAreaSeparator = ";"
+
+// stationRow is one record of an import file. Err is set when the record
+// could not be turned into a station at all.
+type stationRow struct {
+	row     int
+	station *lastmilev1.Station
+	err     string
+}
+
+// parseStationFile splits an import file into rows. It only fails when the
+// file as a whole is unreadable; bad records come back as rows with err set.
+func parseStationFile(format lastmilev1.StationFileFormat, data []byte) ([]stationRow, error) {
+	switch format {
+	case lastmilev1.StationFileFormat_STATION_FILE_FORMAT_CSV:
+		return parseStationCSV(data)
+	case lastmilev1.StationFileFormat_STATION_FILE_FORMAT_GEOJSON:
+		return parseStationGeoJSON(data)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "format is required")
+	}
+}
+
+func parseStationCSV(data []byte) ([]stationRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows []stationRow
+	first := true
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, stationRow{row: parseErr.Line, err: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "unreadable csv")
+		}
+		line, _ := reader.FieldPos(0)
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), csvHeader[0]) {
+			first = false
+			continue
+		}
+		first = false
+		rows = append(rows, csvStationRow(line, record))
+	}
+}
+
+func csvStationRow(line int, record []string) stationRow {
+	row := stationRow{row: line}
+	if len(record) < 4 || len(record) > len(csvHeader) {
+		row.err = fmt.Sprintf("expected %d or %d columns, got %d", len(csvHeader)-1, len(csvHeader), len(record))
+		return row
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+	if err != nil {
+		row.err = "lat is not a number"
+		return row
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+	if err != nil {
+		row.err = "lng is not a number"
+		return row
+	}
+	row.station = &lastmilev1.Station{
+		StationId: record[0],
+		Name:      record[1],
+		Location:  &lastmilev1.LatLng{Latitude: lat, Longitude: lng},
+	}
+	if len(record) == len(csvHeader) {
+		row.station.NearbyAreaIds = splitAreas(strings.Split(record[4], csvAreaSeparator))
+	}
+	return row
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string            `json:"type"`
+	Features []json.RawMessage `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string            `json:"type"`
+	ID         json.RawMessage   `json:"id,omitempty"`
+	Geometry   *geoJSONPoint     `json:"geometry"`
+	Properties geoJSONProperties `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type geoJSONProperties struct {
+	ID    string   `json:"id,omitempty"`
+	Name  string   `json:"name"`
+	Areas []string `json:"areas,omitempty"`
+}
+
+func parseStationGeoJSON(data []byte) ([]stationRow, error) {
+	var collection geoJSONFeatureCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "geojson is not valid json")
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, status.Error(codes.InvalidArgument, "geojson must be a FeatureCollection")
+	}
+	rows := make([]stationRow, 0, len(collection.Features))
+	for i, raw := range collection.Features {
+		rows = append(rows, geoJSONStationRow(i+1, raw))
+	}
+	return rows, nil
+}
+
+func geoJSONStationRow(number int, raw json.RawMessage) stationRow {
+	row := stationRow{row: number}
+	var feature geoJSONFeature
+	if err := json.Unmarshal(raw, &feature); err != nil {
+		row.err = "feature is malformed"
+		return row
+	}
+	if feature.Type != "Feature" {
+		row.err = "type must be Feature"
+		return row
+	}
+	if feature.Geometry == nil || feature.Geometry.Type != "Point" || len(feature.Geometry.Coordinates) < 2 {
+		row.err = "geometry must be a Point"
+		return row
+	}
+	stationID := feature.Properties.ID
+	if stationID == "" && len(feature.ID) > 0 {
+		// Feature ids may be strings or numbers.
+		var text string
+		if err := json.Unmarshal(feature.ID, &text); err != nil {
+			text = string(feature.ID)
+		}
+		stationID = text
+	}
+	row.station = &lastmilev1.Station{
+		StationId: stationID,
+		Name:      feature.Properties.Name,
+		Location: &lastmilev1.LatLng{
+			Latitude:  feature.Geometry.Coordinates[1],
+			Longitude: feature.Geometry.Coordinates[0],
+		},
+		NearbyAreaIds: splitAreas(feature.Properties.Areas),
+	}
+	return row
+}
+
+func splitAreas(areas []string) []string {
+	out := make([]string, 0, len(areas))
+	for _, area := range areas {
+		if area = strings.TrimSpace(area); area != "" {
+			out = append(out, area)
+		}
+	}
+	return out
+}
+
+// stationEncoder writes stations in an export format one at a time.
+type stationEncoder interface {
+	Encode(station *lastmilev1.Station) error
+	Close() error
+}
+
+func newStationEncoder(format lastmilev1.StationFileFormat, w io.Writer) (stationEncoder, error) {
+	switch format {
+	case lastmilev1.StationFileFormat_STATION_FILE_FORMAT_UNSPECIFIED, lastmilev1.StationFileFormat_STATION_FILE_FORMAT_CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return &csvStationEncoder{writer: writer}, nil
+	case lastmilev1.StationFileFormat_STATION_FILE_FORMAT_GEOJSON:
+		if _, err := io.WriteString(w, `{"type":"FeatureCollection","features":[`); err != nil {
+			return nil, err
+		}
+		return &geoJSONStationEncoder{w: w}, nil
+	default:
+		return nil, status.Error(codes.InvalidArgument, "unsupported format")
+	}
+}
+
+type csvStationEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvStationEncoder) Encode(station *lastmilev1.Station) error {
+	return e.writer.Write([]string{
+		station.StationId,
+		station.Name,
+		strconv.FormatFloat(station.GetLocation().GetLatitude(), 'f', -1, 64),
+		strconv.FormatFloat(station.GetLocation().GetLongitude(), 'f', -1, 64),
+		strings.Join(station.NearbyAreaIds, csvAreaSeparator),
+	})
+}
+
+func (e *csvStationEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type geoJSONStationEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *geoJSONStationEncoder) Encode(station *lastmilev1.Station) error {
+	id, err := json.Marshal(station.StationId)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(geoJSONFeature{
+		Type: "Feature",
+		ID:   id,
+		Geometry: &geoJSONPoint{
+			Type:        "Point",
+			Coordinates: []float64{station.GetLocation().GetLongitude(), station.GetLocation().GetLatitude()},
+		},
+		Properties: geoJSONProperties{Name: station.Name, Areas: station.NearbyAreaIds},
+	})
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *geoJSONStationEncoder) Close() error {
+	_, err := io.WriteString(e.w, "]}\n")
+	return err
+}
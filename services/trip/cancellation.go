@@ -0,0 +1,92 @@
+package trip
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxCancellationNoteLen = 280
+	// defaultCancelPenalty is taken off the score per cancellation when the
+	// server is not configured otherwise.
+	defaultCancelPenalty = 10
+)
+
+var cancellationReasons = map[lastmilev1.CancellationParty][]lastmilev1.CancellationReason{
+	lastmilev1.CancellationParty_CANCELLATION_PARTY_RIDER: {
+		lastmilev1.CancellationReason_CANCELLATION_REASON_OTHER,
+		lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_CHANGED_PLANS,
+		lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_WAIT_TOO_LONG,
+		lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_BOOKED_BY_MISTAKE,
+	},
+	lastmilev1.CancellationParty_CANCELLATION_PARTY_DRIVER: {
+		lastmilev1.CancellationReason_CANCELLATION_REASON_OTHER,
+		lastmilev1.CancellationReason_CANCELLATION_REASON_DRIVER_VEHICLE_ISSUE,
+		lastmilev1.CancellationReason_CANCELLATION_REASON_DRIVER_RUNNING_LATE,
+		lastmilev1.CancellationReason_CANCELLATION_REASON_DRIVER_SAFETY_CONCERN,
+	},
+}
+
+// newCancellation checks who canceled a trip and why. System cancellations
+// come from the matching service and are not accepted over the API.
+func newCancellation(input *lastmilev1.Cancellation, now time.Time) (*lastmilev1.Cancellation, error) {
+	reasons, ok := cancellationReasons[input.GetCanceledBy()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "cancellation.canceled_by must be rider or driver")
+	}
+	if input.Reason == lastmilev1.CancellationReason_CANCELLATION_REASON_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "cancellation.reason is required")
+	}
+	if !slices.Contains(reasons, input.Reason) {
+		return nil, status.Errorf(codes.InvalidArgument, "%s cannot cancel with reason %s", input.CanceledBy, input.Reason)
+	}
+	note := strings.TrimSpace(input.Note)
+	if input.Reason == lastmilev1.CancellationReason_CANCELLATION_REASON_OTHER && note == "" {
+		return nil, status.Error(codes.InvalidArgument, "cancellation.note is required for reason OTHER")
+	}
+	if len(note) > maxCancellationNoteLen {
+		return nil, status.Errorf(codes.InvalidArgument, "cancellation.note must be at most %d bytes", maxCancellationNoteLen)
+	}
+	return &lastmilev1.Cancellation{
+		CanceledBy: input.CanceledBy,
+		Reason:     input.Reason,
+		Note:       note,
+		CanceledAt: timestamppb.New(now),
+	}, nil
+}
+
+// HandleEvent counts driver-initiated cancellations against the driver's
+// reliability score. The trip's own status_changed event carries the
+// cancellation, so the penalty cannot be lost once the trip is canceled, and
+// the store counts it once per trip however often the event is delivered.
+func (s *Server) HandleEvent(ctx context.Context, event *lastmilev1.Event) error {
+	if event.GetType() != events.TypeTripStatusChanged {
+		return nil
+	}
+	var trip lastmilev1.Trip
+	if err := event.GetPayload().UnmarshalTo(&trip); err != nil {
+		return err
+	}
+	if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_CANCELED ||
+		trip.GetCancellation().GetCanceledBy() != lastmilev1.CancellationParty_CANCELLATION_PARTY_DRIVER {
+		return nil
+	}
+	err := s.drivers.AddDriverCancellation(ctx, trip.DriverId, trip.TripId, s.cancelPenalty)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger := observability.Logger()
+		logger.Error().Err(err).Str("driver_id", trip.DriverId).Str("trip_id", trip.TripId).Msg("update driver reliability failed")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package trip
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const defaultPickupMaxAttempts = 5
+
+// VerifyPickup checks the PIN the rider reads out to the driver. A match
+// starts the trip and marks the rider picked up in one write; each miss
+// counts towards the attempt limit.
+func (s *Server) VerifyPickup(ctx context.Context, req *lastmilev1.VerifyPickupRequest) (*lastmilev1.VerifyPickupResponse, error) {
+	if req == nil || strings.TrimSpace(req.TripId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "trip_id is required")
+	}
+	riderID := strings.TrimSpace(req.RiderId)
+	if riderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id is required")
+	}
+	pin := strings.TrimSpace(req.Pin)
+	if pin == "" {
+		return nil, status.Error(codes.InvalidArgument, "pin is required")
+	}
+	if s.pickups == nil {
+		return nil, status.Error(codes.Unimplemented, "pickup verification is not configured")
+	}
+
+	trip, err := s.getTrip(ctx, strings.TrimSpace(req.TripId))
+	if err != nil {
+		return nil, err
+	}
+	if trip.RiderId != riderID {
+		return nil, status.Error(codes.PermissionDenied, "rider is not on this trip")
+	}
+	pickup := trip.GetPickup()
+	if pickup.GetPin() == "" || trip.RequestId == "" {
+		return nil, status.Error(codes.FailedPrecondition, "trip has no pickup pin")
+	}
+	if pickup.VerifiedAt != nil && trip.Status == lastmilev1.TripStatus_TRIP_STATUS_ACTIVE {
+		request, err := s.getRequest(ctx, trip.RequestId)
+		if err != nil {
+			return nil, err
+		}
+		return &lastmilev1.VerifyPickupResponse{Trip: publicTrip(trip), Request: request}, nil
+	}
+	if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot pick up a %s trip", trip.Status)
+	}
+	if pickup.FailedAttempts >= s.pickupMaxAttempts {
+		return nil, status.Error(codes.ResourceExhausted, "too many incorrect pins")
+	}
+	now := time.Now()
+	if pickup.ExpiresAt != nil && now.After(pickup.ExpiresAt.AsTime()) {
+		return nil, status.Error(codes.FailedPrecondition, "pin has expired")
+	}
+	// The attempt is counted before the PIN is compared, so guesses made in
+	// parallel cannot get past the limit.
+	attempts, err := s.pickups.AddPickupAttempt(ctx, trip.TripId, s.pickupMaxAttempts)
+	if err != nil {
+		if errors.Is(err, storage.ErrLimitReached) {
+			return nil, status.Error(codes.ResourceExhausted, "too many incorrect pins")
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.FailedPrecondition, "trip is no longer awaiting pickup")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	if subtle.ConstantTimeCompare([]byte(pin), []byte(pickup.Pin)) != 1 {
+		return nil, status.Error(codes.PermissionDenied, "incorrect pin")
+	}
+
+	request, err := s.getRequest(ctx, trip.RequestId)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != lastmilev1.RideStatus_RIDE_STATUS_MATCHED {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot pick up a %s ride request", request.Status)
+	}
+	// This attempt succeeded, so it does not count as a failure.
+	pickup.FailedAttempts = attempts - 1
+	pickup.VerifiedAt = timestamppb.New(now)
+	trip.Status = lastmilev1.TripStatus_TRIP_STATUS_ACTIVE
+	trip.UpdatedAt = pickup.VerifiedAt
+	request.Status = lastmilev1.RideStatus_RIDE_STATUS_PICKED_UP
+
+	tripChanged, err := events.NewOutboxMessage(events.StreamTrips, events.TypeTripStatusChanged, trip)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "event error")
+	}
+	requestChanged, err := events.NewOutboxMessage(events.StreamRideRequests, events.TypeRideRequestStatusChanged, request)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "event error")
+	}
+	// The store re-checks both statuses, so a no-show cancellation that got
+	// in first is not undone.
+	if err := s.pickups.StartPickup(ctx, trip.TripId, request.RequestId, now, tripChanged, requestChanged); err != nil {
+		if errors.Is(err, storage.ErrStatusChanged) {
+			return nil, status.Error(codes.FailedPrecondition, "trip is no longer awaiting pickup")
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "trip or ride request not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.VerifyPickupResponse{Trip: publicTrip(trip), Request: request}, nil
+}
+
+func (s *Server) getRequest(ctx context.Context, requestID string) (*lastmilev1.RideRequest, error) {
+	request, err := s.requests.GetRideRequest(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "ride request not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return request, nil
+}
@@ -0,0 +1,146 @@
+package trip
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxRatingTags   = 5
+	maxRatingTagLen = 32
+)
+
+func (s *Server) RateDriver(ctx context.Context, req *lastmilev1.RateDriverRequest) (*lastmilev1.RateDriverResponse, error) {
+	if req == nil || strings.TrimSpace(req.TripId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "trip_id is required")
+	}
+	riderID := strings.TrimSpace(req.RiderId)
+	if riderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id is required")
+	}
+	rating, err := newRating(req.Stars, req.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	trip, err := s.rateTrip(ctx, strings.TrimSpace(req.TripId), true, rating, func(trip *lastmilev1.Trip) error {
+		if trip.RiderId != riderID {
+			return status.Error(codes.PermissionDenied, "rider is not part of this trip")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.drivers.AddDriverRating(ctx, trip.DriverId, rating.Stars)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger := observability.Logger()
+		logger.Error().Err(err).Str("driver_id", trip.DriverId).Msg("update driver rating failed")
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.RateDriverResponse{Trip: trip}, nil
+}
+
+func (s *Server) RateRider(ctx context.Context, req *lastmilev1.RateRiderRequest) (*lastmilev1.RateRiderResponse, error) {
+	if req == nil || strings.TrimSpace(req.TripId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "trip_id is required")
+	}
+	driverID := strings.TrimSpace(req.DriverId)
+	if driverID == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	rating, err := newRating(req.Stars, req.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	trip, err := s.rateTrip(ctx, strings.TrimSpace(req.TripId), false, rating, func(trip *lastmilev1.Trip) error {
+		if trip.DriverId != driverID {
+			return status.Error(codes.PermissionDenied, "driver is not part of this trip")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.riders.AddRiderRating(ctx, trip.RiderId, rating.Stars)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger := observability.Logger()
+		logger.Error().Err(err).Str("rider_id", trip.RiderId).Msg("update rider rating failed")
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.RateRiderResponse{Trip: trip}, nil
+}
+
+// rateTrip records a rating on a completed trip once check allows the
+// caller. The store only writes it while that party's rating is unset, so
+// concurrent calls cannot both count. The trip write happens first so a party
+// cannot rate twice even if the profile update fails afterwards.
+func (s *Server) rateTrip(ctx context.Context, tripID string, byRider bool, rating *lastmilev1.TripRating, check func(*lastmilev1.Trip) error) (*lastmilev1.Trip, error) {
+	trip, err := s.getTrip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if trip.Status != lastmilev1.TripStatus_TRIP_STATUS_COMPLETED {
+		return nil, status.Error(codes.FailedPrecondition, "only completed trips can be rated")
+	}
+	if err := check(trip); err != nil {
+		return nil, err
+	}
+	party := "driver"
+	if byRider {
+		party = "rider"
+		trip.RatingByRider = rating
+	} else {
+		trip.RatingByDriver = rating
+	}
+	trip.UpdatedAt = rating.RatedAt
+
+	message, err := events.NewOutboxMessage(events.StreamTrips, events.TypeTripRated, trip)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "event error")
+	}
+	if err := s.trips.RateTrip(ctx, trip.TripId, byRider, rating, message); err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			return nil, status.Errorf(codes.AlreadyExists, "%s already rated this trip", party)
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "trip not found")
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return publicTrip(trip), nil
+}
+
+func newRating(stars int32, tags []string) (*lastmilev1.TripRating, error) {
+	if stars < 1 || stars > 5 {
+		return nil, status.Error(codes.InvalidArgument, "stars must be between 1 and 5")
+	}
+	rating := &lastmilev1.TripRating{Stars: stars, RatedAt: timestamppb.Now()}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(rating.Tags, tag) {
+			continue
+		}
+		if len(tag) > maxRatingTagLen {
+			return nil, status.Errorf(codes.InvalidArgument, "tags must be at most %d characters", maxRatingTagLen)
+		}
+		rating.Tags = append(rating.Tags, tag)
+	}
+	if len(rating.Tags) > maxRatingTags {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d tags are allowed", maxRatingTags)
+	}
+	return rating, nil
+}
@@ -1,11 +1,275 @@
 package trip
 
-import lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/events"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
 
 type Server struct {
 	lastmilev1.UnimplementedTripServiceServer
+	trips    storage.TripStore
+	requests storage.RideRequestStore
+	pickups  storage.PickupStore
+	riders   storage.RiderStore
+	drivers  storage.DriverStore
+
+	cancelPenalty     float64
+	pickupMaxAttempts int32
+}
+
+type Stores struct {
+	Trips   storage.TripStore
+	Riders  storage.RiderStore
+	Drivers storage.DriverStore
+	// Requests and Pickups must share a backend with Trips so a verified
+	// pickup moves the trip and the ride request together.
+	Requests storage.RideRequestStore
+	Pickups  storage.PickupStore
+
+	// DriverCancelPenalty is taken off a driver's reliability score for each
+	// trip they cancel; zero means 10.
+	DriverCancelPenalty float64
+	// PickupMaxAttempts is how many wrong PINs lock a pickup; zero means 5.
+	PickupMaxAttempts int32
 }
 
 func NewServer() *Server {
-	return &Server{}
+	return NewServerWithStores(Stores{})
+}
+
+func NewServerWithStore(trips storage.TripStore) *Server {
+	return NewServerWithStores(Stores{Trips: trips})
+}
+
+func NewServerWithStores(stores Stores) *Server {
+	if stores.Trips == nil {
+		stores.Trips = storage.NewMemoryTripStore(nil)
+	}
+	if stores.Riders == nil || stores.Drivers == nil {
+		users := storage.NewMemoryUserStore()
+		if stores.Riders == nil {
+			stores.Riders = users
+		}
+		if stores.Drivers == nil {
+			stores.Drivers = users
+		}
+	}
+	if stores.Requests == nil {
+		stores.Requests = storage.NewMemoryRideRequestStore(nil)
+	}
+	if stores.Pickups == nil {
+		trips, tripsOK := stores.Trips.(*storage.MemoryTripStore)
+		requests, requestsOK := stores.Requests.(*storage.MemoryRideRequestStore)
+		if tripsOK && requestsOK {
+			stores.Pickups = storage.NewMemoryPickupStore(trips, requests)
+		}
+	}
+	if stores.DriverCancelPenalty <= 0 {
+		stores.DriverCancelPenalty = defaultCancelPenalty
+	}
+	if stores.PickupMaxAttempts <= 0 {
+		stores.PickupMaxAttempts = defaultPickupMaxAttempts
+	}
+	return &Server{
+		trips:    stores.Trips,
+		requests: stores.Requests,
+		pickups:  stores.Pickups,
+		riders:   stores.Riders,
+		drivers:  stores.Drivers,
+
+		cancelPenalty:     stores.DriverCancelPenalty,
+		pickupMaxAttempts: stores.PickupMaxAttempts,
+	}
+}
+
+func (s *Server) CreateTrip(ctx context.Context, req *lastmilev1.CreateTripRequest) (*lastmilev1.CreateTripResponse, error) {
+	if req == nil || req.Trip == nil {
+		return nil, status.Error(codes.InvalidArgument, "trip is required")
+	}
+	trip := cloneTrip(req.Trip)
+	trip.RiderId = strings.TrimSpace(trip.RiderId)
+	if trip.RiderId == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id is required")
+	}
+	trip.DriverId = strings.TrimSpace(trip.DriverId)
+	if trip.DriverId == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	trip.StationId = strings.TrimSpace(trip.StationId)
+	if trip.StationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "station_id is required")
+	}
+	trip.DestinationId = strings.TrimSpace(trip.DestinationId)
+	if trip.DestinationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "destination_id is required")
+	}
+	switch trip.Status {
+	case lastmilev1.TripStatus_TRIP_STATUS_UNSPECIFIED:
+		trip.Status = lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED
+	case lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED, lastmilev1.TripStatus_TRIP_STATUS_ACTIVE:
+	default:
+		return nil, status.Error(codes.InvalidArgument, "trip must start scheduled or active")
+	}
+
+	tripID := strings.TrimSpace(trip.TripId)
+	if tripID == "" {
+		trip.TripId = newID("trip")
+	} else {
+		trip.TripId = tripID
+	}
+	now := timestamppb.Now()
+	trip.CreatedAt = now
+	trip.UpdatedAt = now
+	trip.RatingByRider = nil
+	trip.RatingByDriver = nil
+	trip.Cancellation = nil
+	trip.DriverArrivedAt = nil
+	trip.Pickup = nil
+	trip.DropoffPlan = nil
+
+	message, err := events.NewOutboxMessage(events.StreamTrips, events.TypeTripCreated, trip)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "event error")
+	}
+	if err := s.trips.CreateTrip(ctx, trip, message); err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			return nil, status.Error(codes.AlreadyExists, "trip already exists")
+		}
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+
+	return &lastmilev1.CreateTripResponse{Trip: publicTrip(trip)}, nil
+}
+
+func (s *Server) GetTrip(ctx context.Context, req *lastmilev1.GetTripRequest) (*lastmilev1.GetTripResponse, error) {
+	if req == nil || strings.TrimSpace(req.TripId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "trip_id is required")
+	}
+
+	trip, err := s.getTrip(ctx, strings.TrimSpace(req.TripId))
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.GetTripResponse{Trip: publicTrip(trip)}, nil
+}
+
+func (s *Server) UpdateTripStatus(ctx context.Context, req *lastmilev1.UpdateTripStatusRequest) (*lastmilev1.UpdateTripStatusResponse, error) {
+	if req == nil || strings.TrimSpace(req.TripId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "trip_id is required")
+	}
+	if req.Trip == nil || req.Trip.Status == lastmilev1.TripStatus_TRIP_STATUS_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+	now := time.Now()
+	var cancellation *lastmilev1.Cancellation
+	if req.Trip.Status == lastmilev1.TripStatus_TRIP_STATUS_CANCELED {
+		var err error
+		if cancellation, err = newCancellation(req.Trip.Cancellation, now); err != nil {
+			return nil, err
+		}
+	}
+
+	trip, err := s.getTrip(ctx, strings.TrimSpace(req.TripId))
+	if err != nil {
+		return nil, err
+	}
+	if trip.Status == req.Trip.Status {
+		return &lastmilev1.UpdateTripStatusResponse{Trip: publicTrip(trip)}, nil
+	}
+	if !canTransition(trip.Status, req.Trip.Status) {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot move trip from %s to %s", trip.Status, req.Trip.Status)
+	}
+	if req.Trip.Status == lastmilev1.TripStatus_TRIP_STATUS_ACTIVE && trip.GetPickup().GetPin() != "" {
+		return nil, status.Error(codes.FailedPrecondition, "pickup must be verified with the rider's pin")
+	}
+	trip.Status = req.Trip.Status
+	trip.Cancellation = cancellation
+	trip.UpdatedAt = timestamppb.New(now)
+
+	message, err := events.NewOutboxMessage(events.StreamTrips, events.TypeTripStatusChanged, trip)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "event error")
+	}
+	if err := s.trips.UpdateTrip(ctx, trip, message); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "trip not found")
+		}
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return &lastmilev1.UpdateTripStatusResponse{Trip: publicTrip(trip)}, nil
+}
+
+func (s *Server) getTrip(ctx context.Context, tripID string) (*lastmilev1.Trip, error) {
+	trip, err := s.trips.GetTrip(ctx, tripID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "trip not found")
+		}
+		if errors.Is(err, storage.ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "storage error")
+	}
+	return trip, nil
+}
+
+var tripTransitions = map[lastmilev1.TripStatus][]lastmilev1.TripStatus{
+	lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED: {
+		lastmilev1.TripStatus_TRIP_STATUS_ACTIVE,
+		lastmilev1.TripStatus_TRIP_STATUS_CANCELED,
+	},
+	lastmilev1.TripStatus_TRIP_STATUS_ACTIVE: {
+		lastmilev1.TripStatus_TRIP_STATUS_COMPLETED,
+		lastmilev1.TripStatus_TRIP_STATUS_CANCELED,
+	},
+}
+
+func canTransition(from, to lastmilev1.TripStatus) bool {
+	for _, next := range tripTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneTrip(trip *lastmilev1.Trip) *lastmilev1.Trip {
+	if trip == nil {
+		return nil
+	}
+	return proto.Clone(trip).(*lastmilev1.Trip)
+}
+
+// publicTrip copies a trip for a TripService response, without the pickup PIN
+// only the rider should know.
+func publicTrip(trip *lastmilev1.Trip) *lastmilev1.Trip {
+	trip = cloneTrip(trip)
+	if trip.GetPickup() != nil {
+		trip.Pickup.Pin = ""
+	}
+	return trip
+}
+
+func newID(prefix string) string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return prefix + "_" + hex.EncodeToString(buf)
 }
@@ -0,0 +1,347 @@
+package trip
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCreateTripValidation(t *testing.T) {
+	server := NewServer()
+	cases := []struct {
+		name string
+		req  *lastmilev1.CreateTripRequest
+	}{
+		{name: "nil request", req: nil},
+		{name: "nil trip", req: &lastmilev1.CreateTripRequest{}},
+		{name: "missing rider", req: &lastmilev1.CreateTripRequest{Trip: &lastmilev1.Trip{DriverId: "d", StationId: "s", DestinationId: "x"}}},
+		{name: "missing driver", req: &lastmilev1.CreateTripRequest{Trip: &lastmilev1.Trip{RiderId: "r", StationId: "s", DestinationId: "x"}}},
+		{name: "missing station", req: &lastmilev1.CreateTripRequest{Trip: &lastmilev1.Trip{RiderId: "r", DriverId: "d", DestinationId: "x"}}},
+		{name: "missing destination", req: &lastmilev1.CreateTripRequest{Trip: &lastmilev1.Trip{RiderId: "r", DriverId: "d", StationId: "s"}}},
+		{name: "completed", req: &lastmilev1.CreateTripRequest{Trip: &lastmilev1.Trip{RiderId: "r", DriverId: "d", StationId: "s", DestinationId: "x", Status: lastmilev1.TripStatus_TRIP_STATUS_COMPLETED}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := server.CreateTrip(context.Background(), tc.req)
+			assertStatusCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestTripLifecycle(t *testing.T) {
+	server := NewServer()
+	created, err := server.CreateTrip(context.Background(), &lastmilev1.CreateTripRequest{
+		Trip: &lastmilev1.Trip{RiderId: "r", DriverId: "d", StationId: "s", DestinationId: "x"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.Trip.TripId == "" || created.Trip.CreatedAt == nil {
+		t.Fatalf("expected generated id and timestamps")
+	}
+	if created.Trip.Status != lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED {
+		t.Fatalf("expected scheduled, got %s", created.Trip.Status)
+	}
+
+	_, err = server.UpdateTripStatus(context.Background(), &lastmilev1.UpdateTripStatusRequest{
+		TripId: created.Trip.TripId,
+		Trip:   &lastmilev1.Trip{Status: lastmilev1.TripStatus_TRIP_STATUS_COMPLETED},
+	})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	for _, next := range []lastmilev1.TripStatus{lastmilev1.TripStatus_TRIP_STATUS_ACTIVE, lastmilev1.TripStatus_TRIP_STATUS_COMPLETED} {
+		resp, err := server.UpdateTripStatus(context.Background(), &lastmilev1.UpdateTripStatusRequest{
+			TripId: created.Trip.TripId,
+			Trip:   &lastmilev1.Trip{Status: next},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error moving to %s: %v", next, err)
+		}
+		if resp.Trip.Status != next {
+			t.Fatalf("expected %s, got %s", next, resp.Trip.Status)
+		}
+	}
+
+	_, err = server.GetTrip(context.Background(), &lastmilev1.GetTripRequest{TripId: "missing"})
+	assertStatusCode(t, err, codes.NotFound)
+}
+
+func assertStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error with code %s", code.String())
+	}
+	statusErr, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if statusErr.Code() != code {
+		t.Fatalf("expected code %s, got %s", code.String(), statusErr.Code().String())
+	}
+}
+
+func TestRateTripOncePerPartyAfterCompletion(t *testing.T) {
+	ctx := context.Background()
+	users := storage.NewMemoryUserStore()
+	server := NewServerWithStores(Stores{Riders: users, Drivers: users})
+	if err := users.CreateRider(ctx, &lastmilev1.RiderProfile{RiderId: "r", Name: "Riya"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := users.CreateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d", Name: "Dev", RatingAverage: 4, RatingCount: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created, err := server.CreateTrip(ctx, &lastmilev1.CreateTripRequest{
+		Trip: &lastmilev1.Trip{RiderId: "r", DriverId: "d", StationId: "s", DestinationId: "x", Status: lastmilev1.TripStatus_TRIP_STATUS_ACTIVE},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tripID := created.Trip.TripId
+
+	_, err = server.RateDriver(ctx, &lastmilev1.RateDriverRequest{TripId: tripID, RiderId: "r", Stars: 5})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	if _, err := server.UpdateTripStatus(ctx, &lastmilev1.UpdateTripStatusRequest{
+		TripId: tripID,
+		Trip:   &lastmilev1.Trip{Status: lastmilev1.TripStatus_TRIP_STATUS_COMPLETED},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = server.RateDriver(ctx, &lastmilev1.RateDriverRequest{TripId: tripID, RiderId: "r", Stars: 6})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = server.RateDriver(ctx, &lastmilev1.RateDriverRequest{TripId: tripID, RiderId: "someone-else", Stars: 5})
+	assertStatusCode(t, err, codes.PermissionDenied)
+
+	rated, err := server.RateDriver(ctx, &lastmilev1.RateDriverRequest{TripId: tripID, RiderId: "r", Stars: 5, Tags: []string{" Polite ", "polite", "clean"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := rated.Trip.RatingByRider.GetTags(); len(got) != 2 || got[0] != "polite" {
+		t.Fatalf("expected normalized tags, got %v", got)
+	}
+	_, err = server.RateDriver(ctx, &lastmilev1.RateDriverRequest{TripId: tripID, RiderId: "r", Stars: 1})
+	assertStatusCode(t, err, codes.AlreadyExists)
+
+	// Only one of several concurrent ratings by the same party counts.
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := server.RateRider(ctx, &lastmilev1.RateRiderRequest{TripId: tripID, DriverId: "d", Stars: 3})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	counted := 0
+	for err := range errs {
+		if err == nil {
+			counted++
+			continue
+		}
+		assertStatusCode(t, err, codes.AlreadyExists)
+	}
+	if counted != 1 {
+		t.Fatalf("expected one rating to count, got %d", counted)
+	}
+	// Profile edits do not overwrite the counters.
+	profile, _ := users.GetDriver(ctx, "d")
+	profile.Name, profile.RatingCount = "Dev K", 0
+	if err := users.UpdateDriver(ctx, profile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	driver, _ := users.GetDriver(ctx, "d")
+	if driver.RatingCount != 2 || driver.RatingAverage != 4.5 {
+		t.Fatalf("expected driver average 4.5 over 2 ratings, got %v over %d", driver.RatingAverage, driver.RatingCount)
+	}
+	rider, _ := users.GetRider(ctx, "r")
+	if rider.RatingCount != 1 || rider.RatingAverage != 3 {
+		t.Fatalf("expected rider average 3 over 1 rating, got %v over %d", rider.RatingAverage, rider.RatingCount)
+	}
+}
+
+func TestDriverCancellationLowersReliability(t *testing.T) {
+	ctx := context.Background()
+	users := storage.NewMemoryUserStore()
+	trips := storage.NewMemoryTripStore(nil)
+	server := NewServerWithStores(Stores{Trips: trips, Riders: users, Drivers: users, DriverCancelPenalty: 15})
+	if err := users.CreateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d", Name: "Dev"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cancel := func(cancellation *lastmilev1.Cancellation) (*lastmilev1.Trip, error) {
+		created, err := server.CreateTrip(ctx, &lastmilev1.CreateTripRequest{
+			Trip: &lastmilev1.Trip{RiderId: "r", DriverId: "d", StationId: "s", DestinationId: "x"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp, err := server.UpdateTripStatus(ctx, &lastmilev1.UpdateTripStatusRequest{
+			TripId: created.Trip.TripId,
+			Trip:   &lastmilev1.Trip{Status: lastmilev1.TripStatus_TRIP_STATUS_CANCELED, Cancellation: cancellation},
+		})
+		return resp.GetTrip(), err
+	}
+	driverLate := &lastmilev1.Cancellation{
+		CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_DRIVER,
+		Reason:     lastmilev1.CancellationReason_CANCELLATION_REASON_DRIVER_RUNNING_LATE,
+	}
+
+	_, err := cancel(nil)
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = cancel(&lastmilev1.Cancellation{CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_SYSTEM, Reason: lastmilev1.CancellationReason_CANCELLATION_REASON_SYSTEM_RESCHEDULED})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = cancel(&lastmilev1.Cancellation{CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_DRIVER, Reason: lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_CHANGED_PLANS})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	if _, err := cancel(&lastmilev1.Cancellation{CanceledBy: lastmilev1.CancellationParty_CANCELLATION_PARTY_RIDER, Reason: lastmilev1.CancellationReason_CANCELLATION_REASON_RIDER_CHANGED_PLANS}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range 2 {
+		trip, err := cancel(driverLate)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if trip.Cancellation.GetReason() != driverLate.Reason || trip.Cancellation.GetCanceledAt() == nil {
+			t.Fatalf("expected cancellation to be recorded, got %v", trip.Cancellation)
+		}
+	}
+	// The penalty follows the trip events; redelivery counts each trip once.
+	pending, err := trips.Outbox().ListPending(ctx, 100)
+	if err != nil {
+		t.Fatalf("unexpected outbox error: %v", err)
+	}
+	for range 2 {
+		for _, entry := range pending {
+			if err := server.HandleEvent(ctx, entry.Event); err != nil {
+				t.Fatalf("unexpected handler error: %v", err)
+			}
+		}
+	}
+	driver, err := users.GetDriver(ctx, "d")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if driver.CancellationCount != 2 || driver.ReliabilityScore != 70 {
+		t.Fatalf("expected 2 cancellations and score 70, got %d and %v", driver.CancellationCount, driver.ReliabilityScore)
+	}
+}
+
+func TestVerifyPickup(t *testing.T) {
+	ctx := context.Background()
+	trips := storage.NewMemoryTripStore(nil)
+	requests := storage.NewMemoryRideRequestStore(trips.Outbox())
+	server := NewServerWithStores(Stores{Trips: trips, Requests: requests, PickupMaxAttempts: 2})
+	expires := timestamppb.New(time.Now().Add(time.Hour))
+	seed := func(tripID string, expiresAt *timestamppb.Timestamp) {
+		t.Helper()
+		request := &lastmilev1.RideRequest{RequestId: "req_" + tripID, RiderId: "r", StationId: "s", DestinationId: "x", Status: lastmilev1.RideStatus_RIDE_STATUS_MATCHED}
+		if err := requests.CreateRideRequest(ctx, request); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := trips.CreateTrip(ctx, &lastmilev1.Trip{
+			TripId: tripID, RiderId: "r", DriverId: "d", StationId: "s", DestinationId: "x", RequestId: request.RequestId,
+			Status: lastmilev1.TripStatus_TRIP_STATUS_SCHEDULED,
+			Pickup: &lastmilev1.PickupVerification{Pin: "1234", ExpiresAt: expiresAt},
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	verify := func(tripID, riderID, pin string) (*lastmilev1.VerifyPickupResponse, error) {
+		return server.VerifyPickup(ctx, &lastmilev1.VerifyPickupRequest{TripId: tripID, RiderId: riderID, Pin: pin})
+	}
+
+	seed("trip_ok", expires)
+	_, err := verify("trip_ok", "", "1234")
+	assertStatusCode(t, err, codes.InvalidArgument)
+	_, err = verify("trip_ok", "other", "1234")
+	assertStatusCode(t, err, codes.PermissionDenied)
+	got, err := server.GetTrip(ctx, &lastmilev1.GetTripRequest{TripId: "trip_ok"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Trip.GetPickup().GetPin() != "" {
+		t.Fatalf("expected pin to be redacted, got %q", got.Trip.Pickup.Pin)
+	}
+	_, err = server.UpdateTripStatus(ctx, &lastmilev1.UpdateTripStatusRequest{
+		TripId: "trip_ok",
+		Trip:   &lastmilev1.Trip{Status: lastmilev1.TripStatus_TRIP_STATUS_ACTIVE},
+	})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	_, err = verify("trip_ok", "r", "0000")
+	assertStatusCode(t, err, codes.PermissionDenied)
+	resp, err := verify("trip_ok", "r", "1234")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Trip.Status != lastmilev1.TripStatus_TRIP_STATUS_ACTIVE || resp.Trip.Pickup.GetVerifiedAt() == nil || resp.Trip.Pickup.Pin != "" {
+		t.Fatalf("expected active verified trip without pin, got %v", resp.Trip)
+	}
+	if resp.Request.Status != lastmilev1.RideStatus_RIDE_STATUS_PICKED_UP {
+		t.Fatalf("expected request picked up, got %s", resp.Request.Status)
+	}
+	stored, err := requests.GetRideRequest(ctx, "req_trip_ok")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored.Status != lastmilev1.RideStatus_RIDE_STATUS_PICKED_UP {
+		t.Fatalf("expected stored request picked up, got %s", stored.Status)
+	}
+	if _, err := verify("trip_ok", "r", "1234"); err != nil {
+		t.Fatalf("expected repeated verification to succeed, got %v", err)
+	}
+
+	seed("trip_locked", expires)
+	for range 2 {
+		_, err = verify("trip_locked", "r", "9999")
+		assertStatusCode(t, err, codes.PermissionDenied)
+	}
+	_, err = verify("trip_locked", "r", "1234")
+	assertStatusCode(t, err, codes.ResourceExhausted)
+
+	// Guesses made in parallel all count against the same limit, and none
+	// gets to compare once it is used up.
+	seed("trip_parallel", expires)
+	results := make(chan codes.Code, 20)
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := verify("trip_parallel", "r", fmt.Sprintf("%04d", 5000+i))
+			results <- status.Code(err)
+		}()
+	}
+	wg.Wait()
+	close(results)
+	compared := 0
+	for code := range results {
+		if code == codes.PermissionDenied {
+			compared++
+		} else if code != codes.ResourceExhausted {
+			t.Fatalf("unexpected code %s", code)
+		}
+	}
+	if compared != 2 {
+		t.Fatalf("expected exactly 2 guesses to be compared, got %d", compared)
+	}
+	_, err = verify("trip_parallel", "r", "1234")
+	assertStatusCode(t, err, codes.ResourceExhausted)
+
+	seed("trip_expired", timestamppb.New(time.Now().Add(-time.Minute)))
+	_, err = verify("trip_expired", "r", "1234")
+	assertStatusCode(t, err, codes.FailedPrecondition)
+}
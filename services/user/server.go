@@ -5,34 +5,50 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"slices"
 	"strings"
+	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
+	"github.com/Dheeraj2209/Last_mile_go/internal/phone"
 	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 type Server struct {
 	lastmilev1.UnimplementedUserServiceServer
-	riders  storage.RiderStore
-	drivers storage.DriverStore
+	riders      storage.RiderStore
+	drivers     storage.DriverStore
+	vehicles    storage.VehicleStore
+	phoneRegion string
 }
 
 func NewServer() *Server {
 	mem := storage.NewMemoryUserStore()
-	return NewServerWithStores(mem, mem)
+	return NewServerWithStores(mem, mem, storage.NewMemoryVehicleStore(), "")
 }
 
-func NewServerWithStores(riders storage.RiderStore, drivers storage.DriverStore) *Server {
+func NewServerWithStores(riders storage.RiderStore, drivers storage.DriverStore, vehicles storage.VehicleStore, phoneRegion string) *Server {
 	if riders == nil || drivers == nil {
 		mem := storage.NewMemoryUserStore()
 		riders = mem
 		drivers = mem
 	}
+	if vehicles == nil {
+		vehicles = storage.NewMemoryVehicleStore()
+	}
+	if phoneRegion == "" {
+		phoneRegion = "IN"
+	}
 	return &Server{
-		riders:  riders,
-		drivers: drivers,
+		riders:      riders,
+		drivers:     drivers,
+		vehicles:    vehicles,
+		phoneRegion: phoneRegion,
 	}
 }
 
@@ -45,12 +61,15 @@ func (s *Server) CreateRiderProfile(ctx context.Context, req *lastmilev1.CreateR
 	if name == "" {
 		return nil, status.Error(codes.InvalidArgument, "name is required")
 	}
-	phone := strings.TrimSpace(profile.Phone)
-	if phone == "" {
-		return nil, status.Error(codes.InvalidArgument, "phone is required")
+	phone, err := s.normalizePhone(profile.Phone)
+	if err != nil {
+		return nil, err
 	}
 	profile.Name = name
 	profile.Phone = phone
+	profile.RatingAverage = 0
+	profile.RatingCount = 0
+	profile.NoShowCount = 0
 
 	riderID := strings.TrimSpace(profile.RiderId)
 	if riderID == "" {
@@ -60,6 +79,9 @@ func (s *Server) CreateRiderProfile(ctx context.Context, req *lastmilev1.CreateR
 	}
 
 	if err := s.riders.CreateRider(ctx, profile); err != nil {
+		if errors.Is(err, storage.ErrPhoneInUse) {
+			return nil, status.Error(codes.AlreadyExists, "phone already registered")
+		}
 		if errors.Is(err, storage.ErrAlreadyExists) {
 			return nil, status.Error(codes.AlreadyExists, "rider already exists")
 		}
@@ -81,9 +103,9 @@ func (s *Server) CreateDriverProfile(ctx context.Context, req *lastmilev1.Create
 	if name == "" {
 		return nil, status.Error(codes.InvalidArgument, "name is required")
 	}
-	phone := strings.TrimSpace(profile.Phone)
-	if phone == "" {
-		return nil, status.Error(codes.InvalidArgument, "phone is required")
+	phone, err := s.normalizePhone(profile.Phone)
+	if err != nil {
+		return nil, err
 	}
 	vehicleID := strings.TrimSpace(profile.VehicleId)
 	if vehicleID == "" {
@@ -92,6 +114,12 @@ func (s *Server) CreateDriverProfile(ctx context.Context, req *lastmilev1.Create
 	profile.Name = name
 	profile.Phone = phone
 	profile.VehicleId = vehicleID
+	profile.Documents = nil
+	profile.RatingAverage = 0
+	profile.RatingCount = 0
+	profile.CancellationCount = 0
+	profile.ReliabilityScore = 0
+	setDriverStatus(profile, lastmilev1.DriverStatus_DRIVER_STATUS_PENDING_VERIFICATION, "", time.Now())
 
 	driverID := strings.TrimSpace(profile.DriverId)
 	if driverID == "" {
@@ -99,8 +127,17 @@ func (s *Server) CreateDriverProfile(ctx context.Context, req *lastmilev1.Create
 	} else {
 		profile.DriverId = driverID
 	}
+	if err := s.checkVehicle(ctx, profile.VehicleId); err != nil {
+		return nil, err
+	}
 
 	if err := s.drivers.CreateDriver(ctx, profile); err != nil {
+		if errors.Is(err, storage.ErrPhoneInUse) {
+			return nil, status.Error(codes.AlreadyExists, "phone already registered")
+		}
+		if errors.Is(err, storage.ErrVehicleInUse) {
+			return nil, status.Error(codes.FailedPrecondition, "vehicle is assigned to another driver")
+		}
 		if errors.Is(err, storage.ErrAlreadyExists) {
 			return nil, status.Error(codes.AlreadyExists, "driver already exists")
 		}
@@ -151,27 +188,269 @@ func (s *Server) GetDriverProfile(ctx context.Context, req *lastmilev1.GetDriver
 	return &lastmilev1.GetDriverProfileResponse{Profile: cloneDriverProfile(profile)}, nil
 }
 
+func (s *Server) UpdateRiderProfile(ctx context.Context, req *lastmilev1.UpdateRiderProfileRequest) (*lastmilev1.UpdateRiderProfileResponse, error) {
+	if req == nil || req.Profile == nil {
+		return nil, status.Error(codes.InvalidArgument, "profile is required")
+	}
+	riderID := strings.TrimSpace(req.Profile.RiderId)
+	if riderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id is required")
+	}
+	paths, err := updatePaths(req.UpdateMask, riderUpdatableFields)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.riders.GetRider(ctx, riderID)
+	if err != nil {
+		return nil, storageStatus(err, "rider")
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			profile.Name = strings.TrimSpace(req.Profile.Name)
+		case "phone":
+			phone, err := s.normalizePhone(req.Profile.Phone)
+			if err != nil {
+				return nil, err
+			}
+			profile.Phone = phone
+		}
+	}
+	if profile.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if err := s.riders.UpdateRider(ctx, profile); err != nil {
+		return nil, storageStatus(err, "rider")
+	}
+	return &lastmilev1.UpdateRiderProfileResponse{Profile: cloneRiderProfile(profile)}, nil
+}
+
+func (s *Server) UpdateDriverProfile(ctx context.Context, req *lastmilev1.UpdateDriverProfileRequest) (*lastmilev1.UpdateDriverProfileResponse, error) {
+	if req == nil || req.Profile == nil {
+		return nil, status.Error(codes.InvalidArgument, "profile is required")
+	}
+	driverID := strings.TrimSpace(req.Profile.DriverId)
+	if driverID == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	paths, err := updatePaths(req.UpdateMask, driverUpdatableFields)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.drivers.GetDriver(ctx, driverID)
+	if err != nil {
+		return nil, storageStatus(err, "driver")
+	}
+	currentVehicleID := profile.VehicleId
+	for _, path := range paths {
+		switch path {
+		case "name":
+			profile.Name = strings.TrimSpace(req.Profile.Name)
+		case "phone":
+			phone, err := s.normalizePhone(req.Profile.Phone)
+			if err != nil {
+				return nil, err
+			}
+			profile.Phone = phone
+		case "vehicle_id":
+			profile.VehicleId = strings.TrimSpace(req.Profile.VehicleId)
+		}
+	}
+	if profile.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if profile.VehicleId == "" {
+		return nil, status.Error(codes.InvalidArgument, "vehicle_id is required")
+	}
+	if profile.VehicleId != currentVehicleID {
+		if err := s.checkVehicle(ctx, profile.VehicleId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.drivers.UpdateDriver(ctx, profile); err != nil {
+		return nil, storageStatus(err, "driver")
+	}
+	return &lastmilev1.UpdateDriverProfileResponse{Profile: cloneDriverProfile(profile)}, nil
+}
+
+func (s *Server) DeleteRiderProfile(ctx context.Context, req *lastmilev1.DeleteRiderProfileRequest) (*lastmilev1.DeleteRiderProfileResponse, error) {
+	if req == nil || strings.TrimSpace(req.RiderId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "rider_id is required")
+	}
+	if err := s.riders.DeleteRider(ctx, strings.TrimSpace(req.RiderId), time.Now()); err != nil {
+		return nil, storageStatus(err, "rider")
+	}
+	return &lastmilev1.DeleteRiderProfileResponse{}, nil
+}
+
+func (s *Server) DeleteDriverProfile(ctx context.Context, req *lastmilev1.DeleteDriverProfileRequest) (*lastmilev1.DeleteDriverProfileResponse, error) {
+	if req == nil || strings.TrimSpace(req.DriverId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	if err := s.drivers.DeleteDriver(ctx, strings.TrimSpace(req.DriverId), time.Now()); err != nil {
+		return nil, storageStatus(err, "driver")
+	}
+	return &lastmilev1.DeleteDriverProfileResponse{}, nil
+}
+
+func (s *Server) ListRiders(ctx context.Context, req *lastmilev1.ListRidersRequest) (*lastmilev1.ListRidersResponse, error) {
+	filter := pagetoken.FilterHash("riders", strings.ToLower(strings.TrimSpace(req.GetQuery())))
+	after, limit, err := pageParams(req.GetPageSize(), req.GetPageToken(), filter)
+	if err != nil {
+		return nil, err
+	}
+	profiles, next, err := s.riders.ListRiders(ctx, storage.UserFilter{Query: req.GetQuery()}, after, limit)
+	if err != nil {
+		return nil, storageStatus(err, "rider")
+	}
+	return &lastmilev1.ListRidersResponse{Profiles: profiles, NextPageToken: nextPageToken(next, filter)}, nil
+}
+
+func (s *Server) ListDrivers(ctx context.Context, req *lastmilev1.ListDriversRequest) (*lastmilev1.ListDriversResponse, error) {
+	filter := pagetoken.FilterHash("drivers", strings.ToLower(strings.TrimSpace(req.GetQuery())))
+	after, limit, err := pageParams(req.GetPageSize(), req.GetPageToken(), filter)
+	if err != nil {
+		return nil, err
+	}
+	profiles, next, err := s.drivers.ListDrivers(ctx, storage.UserFilter{Query: req.GetQuery()}, after, limit)
+	if err != nil {
+		return nil, storageStatus(err, "driver")
+	}
+	return &lastmilev1.ListDriversResponse{Profiles: profiles, NextPageToken: nextPageToken(next, filter)}, nil
+}
+
+func (s *Server) LookupUserByPhone(ctx context.Context, req *lastmilev1.LookupUserByPhoneRequest) (*lastmilev1.LookupUserByPhoneResponse, error) {
+	phone, err := s.normalizePhone(req.GetPhone())
+	if err != nil {
+		return nil, err
+	}
+
+	rider, err := s.riders.GetRiderByPhone(ctx, phone)
+	if err == nil {
+		return &lastmilev1.LookupUserByPhoneResponse{User: &lastmilev1.LookupUserByPhoneResponse_Rider{Rider: rider}}, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return nil, storageStatus(err, "user")
+	}
+	driver, err := s.drivers.GetDriverByPhone(ctx, phone)
+	if err != nil {
+		return nil, storageStatus(err, "user")
+	}
+	return &lastmilev1.LookupUserByPhoneResponse{User: &lastmilev1.LookupUserByPhoneResponse_Driver{Driver: driver}}, nil
+}
+
+// checkVehicle requires the vehicle to be registered. The driver store
+// refuses a vehicle another active driver holds (ErrVehicleInUse) in the
+// same write as the profile.
+func (s *Server) checkVehicle(ctx context.Context, vehicleID string) error {
+	if _, err := s.vehicles.GetVehicle(ctx, vehicleID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return status.Error(codes.FailedPrecondition, "vehicle is not registered")
+		}
+		return storageStatus(err, "vehicle")
+	}
+	return nil
+}
+
+func (s *Server) normalizePhone(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", status.Error(codes.InvalidArgument, "phone is required")
+	}
+	normalized, err := phone.Normalize(raw, s.phoneRegion)
+	if errors.Is(err, phone.ErrUnsupportedRegion) {
+		return "", status.Error(codes.InvalidArgument, "phone country is not supported")
+	}
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, "phone is invalid")
+	}
+	return normalized, nil
+}
+
+var (
+	riderUpdatableFields  = []string{"name", "phone"}
+	driverUpdatableFields = []string{"name", "phone", "vehicle_id"}
+)
+
+func updatePaths(mask *fieldmaskpb.FieldMask, allowed []string) ([]string, error) {
+	if len(mask.GetPaths()) == 0 {
+		return allowed, nil
+	}
+	for _, path := range mask.GetPaths() {
+		if !slices.Contains(allowed, path) {
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q is not supported", path)
+		}
+	}
+	return mask.GetPaths(), nil
+}
+
+// pageParams returns the key to list after and the page size. Tokens are
+// bound to filter, the pagetoken.FilterHash of the request.
+func pageParams(pageSize int32, pageToken, filter string) (string, int, error) {
+	if pageSize < 0 {
+		return "", 0, status.Error(codes.InvalidArgument, "page_size must be positive")
+	}
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	after := ""
+	if pageToken != "" {
+		key, err := pagetoken.Decode(pageToken, filter)
+		if err != nil {
+			return "", 0, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = key
+	}
+	return after, int(pageSize), nil
+}
+
+func nextPageToken(next, filter string) string {
+	if next == "" {
+		return ""
+	}
+	return pagetoken.Encode(next, filter)
+}
+
+func storageStatus(err error, entity string) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return status.Errorf(codes.NotFound, "%s not found", entity)
+	}
+	if errors.Is(err, storage.ErrPhoneInUse) {
+		return status.Error(codes.AlreadyExists, "phone already registered")
+	}
+	if errors.Is(err, storage.ErrVehicleInUse) {
+		return status.Error(codes.FailedPrecondition, "vehicle is assigned to another driver")
+	}
+	if errors.Is(err, storage.ErrStatusChanged) {
+		return status.Errorf(codes.FailedPrecondition, "%s status changed; fetch it and try again", entity)
+	}
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return status.Errorf(codes.AlreadyExists, "%s already exists", entity)
+	}
+	if errors.Is(err, storage.ErrInvalidArgument) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, "storage error")
+}
+
 func cloneRiderProfile(profile *lastmilev1.RiderProfile) *lastmilev1.RiderProfile {
 	if profile == nil {
 		return nil
 	}
-	return &lastmilev1.RiderProfile{
-		RiderId: profile.RiderId,
-		Name:    profile.Name,
-		Phone:   profile.Phone,
-	}
+	return proto.Clone(profile).(*lastmilev1.RiderProfile)
 }
 
 func cloneDriverProfile(profile *lastmilev1.DriverProfile) *lastmilev1.DriverProfile {
 	if profile == nil {
 		return nil
 	}
-	return &lastmilev1.DriverProfile{
-		DriverId:  profile.DriverId,
-		Name:      profile.Name,
-		Phone:     profile.Phone,
-		VehicleId: profile.VehicleId,
-	}
+	return proto.Clone(profile).(*lastmilev1.DriverProfile)
 }
 
 func newID(prefix string) string {
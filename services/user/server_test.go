@@ -3,10 +3,14 @@ package user
 import (
 	"context"
 	"testing"
+	"time"
 
 	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestCreateRiderProfileValidation(t *testing.T) {
@@ -34,7 +38,7 @@ func TestCreateRiderProfileSuccess(t *testing.T) {
 	resp, err := server.CreateRiderProfile(context.Background(), &lastmilev1.CreateRiderProfileRequest{
 		Profile: &lastmilev1.RiderProfile{
 			Name:    "  Alice  ",
-			Phone:   " 555 ",
+			Phone:   " +91 98765 43210 ",
 			RiderId: " ",
 		},
 	})
@@ -50,8 +54,8 @@ func TestCreateRiderProfileSuccess(t *testing.T) {
 	if resp.Profile.Name != "Alice" {
 		t.Fatalf("expected trimmed name, got %q", resp.Profile.Name)
 	}
-	if resp.Profile.Phone != "555" {
-		t.Fatalf("expected trimmed phone, got %q", resp.Profile.Phone)
+	if resp.Profile.Phone != "+919876543210" {
+		t.Fatalf("expected normalized phone, got %q", resp.Profile.Phone)
 	}
 }
 
@@ -61,7 +65,7 @@ func TestCreateRiderProfileDuplicate(t *testing.T) {
 		Profile: &lastmilev1.RiderProfile{
 			RiderId: "r1",
 			Name:    "Rita",
-			Phone:   "123",
+			Phone:   "9876500001",
 		},
 	}
 	if _, err := server.CreateRiderProfile(context.Background(), req); err != nil {
@@ -105,11 +109,11 @@ func TestCreateDriverProfileValidation(t *testing.T) {
 }
 
 func TestCreateDriverProfileSuccess(t *testing.T) {
-	server := NewServer()
+	server := newServerWithVehicles(t, "van-1")
 	resp, err := server.CreateDriverProfile(context.Background(), &lastmilev1.CreateDriverProfileRequest{
 		Profile: &lastmilev1.DriverProfile{
 			Name:      "  Dana ",
-			Phone:     " 999 ",
+			Phone:     " 98765 00002 ",
 			VehicleId: " van-1 ",
 		},
 	})
@@ -125,12 +129,15 @@ func TestCreateDriverProfileSuccess(t *testing.T) {
 	if resp.Profile.Name != "Dana" {
 		t.Fatalf("expected trimmed name, got %q", resp.Profile.Name)
 	}
-	if resp.Profile.Phone != "999" {
-		t.Fatalf("expected trimmed phone, got %q", resp.Profile.Phone)
+	if resp.Profile.Phone != "+919876500002" {
+		t.Fatalf("expected normalized phone, got %q", resp.Profile.Phone)
 	}
 	if resp.Profile.VehicleId != "van-1" {
 		t.Fatalf("expected trimmed vehicle_id, got %q", resp.Profile.VehicleId)
 	}
+	if resp.Profile.Status != lastmilev1.DriverStatus_DRIVER_STATUS_PENDING_VERIFICATION {
+		t.Fatalf("expected new driver pending verification, got %s", resp.Profile.Status)
+	}
 }
 
 func TestGetDriverProfileErrors(t *testing.T) {
@@ -145,6 +152,370 @@ func TestGetDriverProfileErrors(t *testing.T) {
 	assertStatusCode(t, err, codes.NotFound)
 }
 
+func TestUpdateRiderProfileFieldMask(t *testing.T) {
+	server := NewServer()
+	ctx := context.Background()
+	created, err := server.CreateRiderProfile(ctx, &lastmilev1.CreateRiderProfileRequest{
+		Profile: &lastmilev1.RiderProfile{RiderId: "r1", Name: "Alice", Phone: "9876500003"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := server.UpdateRiderProfile(ctx, &lastmilev1.UpdateRiderProfileRequest{
+		Profile:    &lastmilev1.RiderProfile{RiderId: created.Profile.RiderId, Name: " Alicia ", Phone: "9876500099"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Profile.Name != "Alicia" || resp.Profile.Phone != "+919876500003" {
+		t.Fatalf("expected only name to change, got %v", resp.Profile)
+	}
+
+	_, err = server.UpdateRiderProfile(ctx, &lastmilev1.UpdateRiderProfileRequest{
+		Profile:    &lastmilev1.RiderProfile{RiderId: "r1"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"rider_id"}},
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	_, err = server.UpdateRiderProfile(ctx, &lastmilev1.UpdateRiderProfileRequest{
+		Profile:    &lastmilev1.RiderProfile{RiderId: "r1"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"phone"}},
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	_, err = server.UpdateRiderProfile(ctx, &lastmilev1.UpdateRiderProfileRequest{
+		Profile: &lastmilev1.RiderProfile{RiderId: "missing", Name: "x", Phone: "9876500004"},
+	})
+	assertStatusCode(t, err, codes.NotFound)
+}
+
+func TestDeleteDriverProfileIsSoft(t *testing.T) {
+	ctx := context.Background()
+	server := newServerWithVehicles(t, "v1")
+	_, err := server.CreateDriverProfile(ctx, &lastmilev1.CreateDriverProfileRequest{
+		Profile: &lastmilev1.DriverProfile{DriverId: "d1", Name: "Dan", Phone: "9876500005", VehicleId: "v1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := server.DeleteDriverProfile(ctx, &lastmilev1.DeleteDriverProfileRequest{DriverId: "d1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.GetDriverProfile(ctx, &lastmilev1.GetDriverProfileRequest{DriverId: "d1"})
+	assertStatusCode(t, err, codes.NotFound)
+	_, err = server.DeleteDriverProfile(ctx, &lastmilev1.DeleteDriverProfileRequest{DriverId: "d1"})
+	assertStatusCode(t, err, codes.NotFound)
+	_, err = server.CreateDriverProfile(ctx, &lastmilev1.CreateDriverProfileRequest{
+		Profile: &lastmilev1.DriverProfile{DriverId: "d1", Name: "Dan", Phone: "9876500005", VehicleId: "v1"},
+	})
+	assertStatusCode(t, err, codes.AlreadyExists)
+
+	list, err := server.ListDrivers(ctx, &lastmilev1.ListDriversRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list.Profiles) != 0 {
+		t.Fatalf("expected deleted driver to be hidden, got %v", list.Profiles)
+	}
+}
+
+func TestListRidersSearchAndPaging(t *testing.T) {
+	server := NewServer()
+	ctx := context.Background()
+	for _, profile := range []*lastmilev1.RiderProfile{
+		{RiderId: "r1", Name: "Alice Smith", Phone: "+14155550001"},
+		{RiderId: "r2", Name: "Bob", Phone: "+14155550002"},
+		{RiderId: "r3", Name: "alina", Phone: "+14155559999"},
+		{RiderId: "r4", Name: "Carol", Phone: "+14155550004"},
+	} {
+		if _, err := server.CreateRiderProfile(ctx, &lastmilev1.CreateRiderProfileRequest{Profile: profile}); err != nil {
+			t.Fatalf("seed %s: %v", profile.RiderId, err)
+		}
+	}
+
+	byName, err := server.ListRiders(ctx, &lastmilev1.ListRidersRequest{Query: "ALI"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(byName.Profiles) != 2 || byName.Profiles[0].RiderId != "r1" || byName.Profiles[1].RiderId != "r3" {
+		t.Fatalf("expected r1 and r3 by name, got %v", byName.Profiles)
+	}
+	byPhone, err := server.ListRiders(ctx, &lastmilev1.ListRidersRequest{Query: "0002"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(byPhone.Profiles) != 1 || byPhone.Profiles[0].RiderId != "r2" {
+		t.Fatalf("expected r2 by phone, got %v", byPhone.Profiles)
+	}
+
+	var ids []string
+	token := ""
+	for {
+		page, err := server.ListRiders(ctx, &lastmilev1.ListRidersRequest{PageSize: 3, PageToken: token})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, profile := range page.Profiles {
+			ids = append(ids, profile.RiderId)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		token = page.NextPageToken
+	}
+	if len(ids) != 4 || ids[0] != "r1" || ids[3] != "r4" {
+		t.Fatalf("expected all riders across pages, got %v", ids)
+	}
+
+	_, err = server.ListRiders(ctx, &lastmilev1.ListRidersRequest{PageToken: "bogus"})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	first, err := server.ListRiders(ctx, &lastmilev1.ListRidersRequest{PageSize: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.ListRiders(ctx, &lastmilev1.ListRidersRequest{PageSize: 1, PageToken: first.NextPageToken, Query: "ali"})
+	assertStatusCode(t, err, codes.InvalidArgument)
+}
+
+func TestPhoneNormalizationAndUniqueness(t *testing.T) {
+	server := newServerWithVehicles(t, "v1")
+	ctx := context.Background()
+
+	_, err := server.CreateRiderProfile(ctx, &lastmilev1.CreateRiderProfileRequest{
+		Profile: &lastmilev1.RiderProfile{Name: "Ravi", Phone: "12345"},
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	if _, err := server.CreateRiderProfile(ctx, &lastmilev1.CreateRiderProfileRequest{
+		Profile: &lastmilev1.RiderProfile{RiderId: "r1", Name: "Ravi", Phone: "+91 98765 43210"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.CreateRiderProfile(ctx, &lastmilev1.CreateRiderProfileRequest{
+		Profile: &lastmilev1.RiderProfile{RiderId: "r2", Name: "Ravi Two", Phone: "9876543210"},
+	})
+	assertStatusCode(t, err, codes.AlreadyExists)
+	_, err = server.CreateDriverProfile(ctx, &lastmilev1.CreateDriverProfileRequest{
+		Profile: &lastmilev1.DriverProfile{DriverId: "d1", Name: "Dev", Phone: "09876543210", VehicleId: "v1"},
+	})
+	assertStatusCode(t, err, codes.AlreadyExists)
+
+	if _, err := server.CreateDriverProfile(ctx, &lastmilev1.CreateDriverProfileRequest{
+		Profile: &lastmilev1.DriverProfile{DriverId: "d1", Name: "Dev", Phone: "9876500010", VehicleId: "v1"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.UpdateDriverProfile(ctx, &lastmilev1.UpdateDriverProfileRequest{
+		Profile:    &lastmilev1.DriverProfile{DriverId: "d1", Phone: "+919876543210"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"phone"}},
+	})
+	assertStatusCode(t, err, codes.AlreadyExists)
+
+	lookup, err := server.LookupUserByPhone(ctx, &lastmilev1.LookupUserByPhoneRequest{Phone: "98765 00010"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lookup.GetDriver().GetDriverId() != "d1" {
+		t.Fatalf("expected driver d1, got %v", lookup)
+	}
+	lookup, err = server.LookupUserByPhone(ctx, &lastmilev1.LookupUserByPhoneRequest{Phone: "+919876543210"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lookup.GetRider().GetRiderId() != "r1" {
+		t.Fatalf("expected rider r1, got %v", lookup)
+	}
+
+	if _, err := server.DeleteRiderProfile(ctx, &lastmilev1.DeleteRiderProfileRequest{RiderId: "r1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.LookupUserByPhone(ctx, &lastmilev1.LookupUserByPhoneRequest{Phone: "+919876543210"})
+	assertStatusCode(t, err, codes.NotFound)
+	if _, err := server.CreateRiderProfile(ctx, &lastmilev1.CreateRiderProfileRequest{
+		Profile: &lastmilev1.RiderProfile{RiderId: "r2", Name: "Ravi Two", Phone: "9876543210"},
+	}); err != nil {
+		t.Fatalf("expected phone to be free after delete: %v", err)
+	}
+}
+
+func TestDriverVehicleMustBeRegisteredAndFree(t *testing.T) {
+	server := newServerWithVehicles(t, "v1", "v2")
+	ctx := context.Background()
+
+	_, err := server.CreateDriverProfile(ctx, &lastmilev1.CreateDriverProfileRequest{
+		Profile: &lastmilev1.DriverProfile{DriverId: "d1", Name: "Dev", Phone: "9876500011", VehicleId: "missing"},
+	})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	if _, err := server.CreateDriverProfile(ctx, &lastmilev1.CreateDriverProfileRequest{
+		Profile: &lastmilev1.DriverProfile{DriverId: "d1", Name: "Dev", Phone: "9876500011", VehicleId: "v1"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.CreateDriverProfile(ctx, &lastmilev1.CreateDriverProfileRequest{
+		Profile: &lastmilev1.DriverProfile{DriverId: "d2", Name: "Devi", Phone: "9876500012", VehicleId: "v1"},
+	})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	if _, err := server.CreateDriverProfile(ctx, &lastmilev1.CreateDriverProfileRequest{
+		Profile: &lastmilev1.DriverProfile{DriverId: "d2", Name: "Devi", Phone: "9876500012", VehicleId: "v2"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.UpdateDriverProfile(ctx, &lastmilev1.UpdateDriverProfileRequest{
+		Profile:    &lastmilev1.DriverProfile{DriverId: "d2", VehicleId: "v1"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"vehicle_id"}},
+	})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	if _, err := server.DeleteDriverProfile(ctx, &lastmilev1.DeleteDriverProfileRequest{DriverId: "d1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := server.UpdateDriverProfile(ctx, &lastmilev1.UpdateDriverProfileRequest{
+		Profile:    &lastmilev1.DriverProfile{DriverId: "d2", VehicleId: "v1"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"vehicle_id"}},
+	})
+	if err != nil {
+		t.Fatalf("expected vehicle to be free after driver delete: %v", err)
+	}
+	if resp.Profile.VehicleId != "v1" {
+		t.Fatalf("expected vehicle v1, got %q", resp.Profile.VehicleId)
+	}
+}
+
+func TestDriverVerificationWorkflow(t *testing.T) {
+	server := newServerWithVehicles(t, "v1")
+	ctx := context.Background()
+	if _, err := server.CreateDriverProfile(ctx, &lastmilev1.CreateDriverProfileRequest{
+		Profile: &lastmilev1.DriverProfile{
+			DriverId:  "d1",
+			Name:      "Dev",
+			Phone:     "9876500020",
+			VehicleId: "v1",
+			Status:    lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE,
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := server.ApproveDriver(ctx, &lastmilev1.ApproveDriverRequest{DriverId: "d1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+	_, err = server.SuspendDriver(ctx, &lastmilev1.SuspendDriverRequest{DriverId: "d1", Reason: "complaints"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	_, err = server.UploadDriverDocument(ctx, &lastmilev1.UploadDriverDocumentRequest{
+		DriverId: "d1",
+		Document: &lastmilev1.DriverDocument{
+			Type:      lastmilev1.DriverDocumentType_DRIVER_DOCUMENT_TYPE_LICENSE,
+			Number:    "DL-1",
+			ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour)),
+		},
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	if _, err := server.UploadDriverDocument(ctx, &lastmilev1.UploadDriverDocumentRequest{
+		DriverId: "d1",
+		Document: &lastmilev1.DriverDocument{
+			Type:      lastmilev1.DriverDocumentType_DRIVER_DOCUMENT_TYPE_LICENSE,
+			Number:    " DL-1 ",
+			ExpiresAt: timestamppb.New(time.Now().Add(365 * 24 * time.Hour)),
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	approved, err := server.ApproveDriver(ctx, &lastmilev1.ApproveDriverRequest{DriverId: "d1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if approved.Profile.Status != lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE {
+		t.Fatalf("expected active driver, got %s", approved.Profile.Status)
+	}
+	_, err = server.RejectDriver(ctx, &lastmilev1.RejectDriverRequest{DriverId: "d1", Reason: "late"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	_, err = server.SuspendDriver(ctx, &lastmilev1.SuspendDriverRequest{DriverId: "d1"})
+	assertStatusCode(t, err, codes.InvalidArgument)
+	suspended, err := server.SuspendDriver(ctx, &lastmilev1.SuspendDriverRequest{DriverId: "d1", Reason: " complaints "})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if suspended.Profile.Status != lastmilev1.DriverStatus_DRIVER_STATUS_SUSPENDED || suspended.Profile.StatusReason != "complaints" {
+		t.Fatalf("expected suspension with reason, got %v", suspended.Profile)
+	}
+
+	if _, err := server.DeactivateDriver(ctx, &lastmilev1.DeactivateDriverRequest{DriverId: "d1", Reason: "left"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.ApproveDriver(ctx, &lastmilev1.ApproveDriverRequest{DriverId: "d1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+}
+
+func TestFlagExpiredDocuments(t *testing.T) {
+	ctx := context.Background()
+	users := storage.NewMemoryUserStore()
+	server := NewServerWithStores(users, users, storage.NewMemoryVehicleStore(), "IN")
+	now := time.Now()
+	if err := users.CreateDriver(ctx, &lastmilev1.DriverProfile{
+		DriverId: "d1",
+		Name:     "Dev",
+		Status:   lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE,
+		Documents: []*lastmilev1.DriverDocument{
+			{Type: lastmilev1.DriverDocumentType_DRIVER_DOCUMENT_TYPE_LICENSE, Number: "DL-1", ExpiresAt: timestamppb.New(now.Add(-time.Minute))},
+			{Type: lastmilev1.DriverDocumentType_DRIVER_DOCUMENT_TYPE_INSURANCE, Number: "IN-1", ExpiresAt: timestamppb.New(now.Add(time.Hour))},
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	flagged, err := server.FlagExpiredDocuments(ctx, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flagged != 1 {
+		t.Fatalf("expected one flagged driver, got %d", flagged)
+	}
+	profile, err := users.GetDriver(ctx, "d1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !profile.Documents[0].Expired || profile.Documents[1].Expired {
+		t.Fatalf("expected only the license to be flagged, got %v", profile.Documents)
+	}
+	if profile.Status != lastmilev1.DriverStatus_DRIVER_STATUS_SUSPENDED || profile.StatusReason != "license expired" {
+		t.Fatalf("expected driver suspended for expired license, got %s %q", profile.Status, profile.StatusReason)
+	}
+
+	flagged, err = server.FlagExpiredDocuments(ctx, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flagged != 0 {
+		t.Fatalf("expected second pass to be a no-op, got %d", flagged)
+	}
+}
+
+func newServerWithVehicles(t *testing.T, vehicleIDs ...string) *Server {
+	t.Helper()
+	users := storage.NewMemoryUserStore()
+	vehicles := storage.NewMemoryVehicleStore()
+	for _, id := range vehicleIDs {
+		err := vehicles.CreateVehicle(context.Background(), &lastmilev1.Vehicle{
+			VehicleId:    id,
+			Plate:        "KA01" + id,
+			Type:         lastmilev1.VehicleType_VEHICLE_TYPE_CAB,
+			SeatCapacity: 4,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return NewServerWithStores(users, users, vehicles, "IN")
+}
+
 func assertStatusCode(t *testing.T, err error, code codes.Code) {
 	t.Helper()
 	if err == nil {
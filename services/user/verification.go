@@ -0,0 +1,261 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/observability"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const licenseExpiredReason = "license expired"
+
+var driverTransitions = map[lastmilev1.DriverStatus][]lastmilev1.DriverStatus{
+	lastmilev1.DriverStatus_DRIVER_STATUS_PENDING_VERIFICATION: {
+		lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE,
+		lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED,
+	},
+	lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE: {
+		lastmilev1.DriverStatus_DRIVER_STATUS_SUSPENDED,
+		lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED,
+	},
+	lastmilev1.DriverStatus_DRIVER_STATUS_SUSPENDED: {
+		lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE,
+		lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED,
+	},
+}
+
+func (s *Server) UploadDriverDocument(ctx context.Context, req *lastmilev1.UploadDriverDocumentRequest) (*lastmilev1.UploadDriverDocumentResponse, error) {
+	if req == nil || strings.TrimSpace(req.DriverId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	document := req.Document
+	if document == nil {
+		return nil, status.Error(codes.InvalidArgument, "document is required")
+	}
+	if _, ok := lastmilev1.DriverDocumentType_name[int32(document.Type)]; !ok || document.Type == lastmilev1.DriverDocumentType_DRIVER_DOCUMENT_TYPE_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "document type is required")
+	}
+	number := strings.TrimSpace(document.Number)
+	if number == "" {
+		return nil, status.Error(codes.InvalidArgument, "document number is required")
+	}
+	if document.ExpiresAt == nil || !document.ExpiresAt.IsValid() {
+		return nil, status.Error(codes.InvalidArgument, "document expires_at is required")
+	}
+	now := time.Now()
+	if !document.ExpiresAt.AsTime().After(now) {
+		return nil, status.Error(codes.InvalidArgument, "document is already expired")
+	}
+
+	profile, err := s.drivers.GetDriver(ctx, strings.TrimSpace(req.DriverId))
+	if err != nil {
+		return nil, storageStatus(err, "driver")
+	}
+	if driverStatus(profile) == lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED {
+		return nil, status.Error(codes.FailedPrecondition, "driver is deactivated")
+	}
+	uploaded := &lastmilev1.DriverDocument{
+		Type:       document.Type,
+		Number:     number,
+		ExpiresAt:  document.ExpiresAt,
+		UploadedAt: timestamppb.New(now),
+	}
+	profile.Documents = slices.DeleteFunc(profile.Documents, func(existing *lastmilev1.DriverDocument) bool {
+		return existing.Type == uploaded.Type
+	})
+	profile.Documents = append(profile.Documents, uploaded)
+
+	if err := s.drivers.UpdateDriverVerification(ctx, profile, profile.Status); err != nil {
+		return nil, storageStatus(err, "driver")
+	}
+	return &lastmilev1.UploadDriverDocumentResponse{Profile: cloneDriverProfile(profile)}, nil
+}
+
+func (s *Server) ApproveDriver(ctx context.Context, req *lastmilev1.ApproveDriverRequest) (*lastmilev1.ApproveDriverResponse, error) {
+	profile, err := s.transitionDriver(ctx, req.GetDriverId(), lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE, "", func(profile *lastmilev1.DriverProfile) error {
+		if !hasValidLicense(profile, time.Now()) {
+			return status.Error(codes.FailedPrecondition, "driver has no valid license document")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.ApproveDriverResponse{Profile: profile}, nil
+}
+
+func (s *Server) RejectDriver(ctx context.Context, req *lastmilev1.RejectDriverRequest) (*lastmilev1.RejectDriverResponse, error) {
+	reason, err := requiredReason(req.GetReason())
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.transitionDriver(ctx, req.GetDriverId(), lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED, reason, func(profile *lastmilev1.DriverProfile) error {
+		if driverStatus(profile) != lastmilev1.DriverStatus_DRIVER_STATUS_PENDING_VERIFICATION {
+			return status.Error(codes.FailedPrecondition, "only drivers pending verification can be rejected")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.RejectDriverResponse{Profile: profile}, nil
+}
+
+func (s *Server) SuspendDriver(ctx context.Context, req *lastmilev1.SuspendDriverRequest) (*lastmilev1.SuspendDriverResponse, error) {
+	reason, err := requiredReason(req.GetReason())
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.transitionDriver(ctx, req.GetDriverId(), lastmilev1.DriverStatus_DRIVER_STATUS_SUSPENDED, reason, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.SuspendDriverResponse{Profile: profile}, nil
+}
+
+func (s *Server) DeactivateDriver(ctx context.Context, req *lastmilev1.DeactivateDriverRequest) (*lastmilev1.DeactivateDriverResponse, error) {
+	reason, err := requiredReason(req.GetReason())
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.transitionDriver(ctx, req.GetDriverId(), lastmilev1.DriverStatus_DRIVER_STATUS_DEACTIVATED, reason, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &lastmilev1.DeactivateDriverResponse{Profile: profile}, nil
+}
+
+func (s *Server) transitionDriver(ctx context.Context, driverID string, to lastmilev1.DriverStatus, reason string, check func(*lastmilev1.DriverProfile) error) (*lastmilev1.DriverProfile, error) {
+	driverID = strings.TrimSpace(driverID)
+	if driverID == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	profile, err := s.drivers.GetDriver(ctx, driverID)
+	if err != nil {
+		return nil, storageStatus(err, "driver")
+	}
+	from := driverStatus(profile)
+	if !slices.Contains(driverTransitions[from], to) {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot move driver from %s to %s", from, to)
+	}
+	if check != nil {
+		if err := check(profile); err != nil {
+			return nil, err
+		}
+	}
+	stored := profile.Status
+	setDriverStatus(profile, to, reason, time.Now())
+	if err := s.drivers.UpdateDriverVerification(ctx, profile, stored); err != nil {
+		return nil, storageStatus(err, "driver")
+	}
+	return cloneDriverProfile(profile), nil
+}
+
+// FlagExpiredDocuments marks documents past their expiry as expired and
+// suspends active drivers whose license has expired.
+func (s *Server) FlagExpiredDocuments(ctx context.Context, now time.Time) (int, error) {
+	flagged := 0
+	for after := ""; ; {
+		profiles, next, err := s.drivers.ListDrivers(ctx, storage.UserFilter{}, after, 100)
+		if err != nil {
+			return flagged, err
+		}
+		for _, profile := range profiles {
+			if !flagExpired(profile, now) {
+				continue
+			}
+			stored := profile.Status
+			if driverStatus(profile) == lastmilev1.DriverStatus_DRIVER_STATUS_ACTIVE && !hasValidLicense(profile, now) {
+				setDriverStatus(profile, lastmilev1.DriverStatus_DRIVER_STATUS_SUSPENDED, licenseExpiredReason, now)
+			}
+			err := s.drivers.UpdateDriverVerification(ctx, profile, stored)
+			if errors.Is(err, storage.ErrStatusChanged) || errors.Is(err, storage.ErrNotFound) {
+				// Changed since the list; the next check sees it.
+				continue
+			}
+			if err != nil {
+				return flagged, err
+			}
+			flagged++
+		}
+		if next == "" {
+			return flagged, nil
+		}
+		after = next
+	}
+}
+
+func (s *Server) RunDocumentExpiryChecks(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	logger := observability.Logger()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		flagged, err := s.FlagExpiredDocuments(ctx, time.Now())
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error().Err(err).Int("flagged", flagged).Msg("document expiry check failed")
+		} else if flagged > 0 {
+			logger.Info().Int("flagged", flagged).Msg("flagged drivers with expired documents")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func flagExpired(profile *lastmilev1.DriverProfile, now time.Time) bool {
+	changed := false
+	for _, document := range profile.Documents {
+		if !document.Expired && document.ExpiresAt != nil && !document.ExpiresAt.AsTime().After(now) {
+			document.Expired = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+func hasValidLicense(profile *lastmilev1.DriverProfile, now time.Time) bool {
+	for _, document := range profile.Documents {
+		if document.Type == lastmilev1.DriverDocumentType_DRIVER_DOCUMENT_TYPE_LICENSE &&
+			!document.Expired && document.ExpiresAt.AsTime().After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func driverStatus(profile *lastmilev1.DriverProfile) lastmilev1.DriverStatus {
+	if profile.Status == lastmilev1.DriverStatus_DRIVER_STATUS_UNSPECIFIED {
+		return lastmilev1.DriverStatus_DRIVER_STATUS_PENDING_VERIFICATION
+	}
+	return profile.Status
+}
+
+func setDriverStatus(profile *lastmilev1.DriverProfile, to lastmilev1.DriverStatus, reason string, now time.Time) {
+	profile.Status = to
+	profile.StatusReason = reason
+	profile.StatusUpdatedAt = timestamppb.New(now)
+}
+
+func requiredReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return "", status.Error(codes.InvalidArgument, "reason is required")
+	}
+	return reason, nil
+}
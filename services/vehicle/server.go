@@ -0,0 +1,256 @@
+package vehicle
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/pagetoken"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const maxSeatCapacity = 60
+
+type Server struct {
+	lastmilev1.UnimplementedVehicleServiceServer
+	vehicles storage.VehicleStore
+	drivers  storage.DriverStore
+}
+
+func NewServer() *Server {
+	return NewServerWithStores(storage.NewMemoryVehicleStore(), storage.NewMemoryUserStore())
+}
+
+func NewServerWithStores(vehicles storage.VehicleStore, drivers storage.DriverStore) *Server {
+	if vehicles == nil {
+		vehicles = storage.NewMemoryVehicleStore()
+	}
+	if drivers == nil {
+		drivers = storage.NewMemoryUserStore()
+	}
+	return &Server{vehicles: vehicles, drivers: drivers}
+}
+
+func (s *Server) CreateVehicle(ctx context.Context, req *lastmilev1.CreateVehicleRequest) (*lastmilev1.CreateVehicleResponse, error) {
+	if req == nil || req.Vehicle == nil {
+		return nil, status.Error(codes.InvalidArgument, "vehicle is required")
+	}
+	vehicle := cloneVehicle(req.Vehicle)
+	vehicle.Plate = normalizePlate(vehicle.Plate)
+	vehicle.AccessibilityFeatures = dedupeFeatures(vehicle.AccessibilityFeatures)
+	if err := validateVehicle(vehicle); err != nil {
+		return nil, err
+	}
+
+	vehicleID := strings.TrimSpace(vehicle.VehicleId)
+	if vehicleID == "" {
+		vehicle.VehicleId = newID("vehicle")
+	} else {
+		vehicle.VehicleId = vehicleID
+	}
+
+	if err := s.vehicles.CreateVehicle(ctx, vehicle); err != nil {
+		return nil, storageStatus(err)
+	}
+	return &lastmilev1.CreateVehicleResponse{Vehicle: cloneVehicle(vehicle)}, nil
+}
+
+func (s *Server) GetVehicle(ctx context.Context, req *lastmilev1.GetVehicleRequest) (*lastmilev1.GetVehicleResponse, error) {
+	if req == nil || strings.TrimSpace(req.VehicleId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "vehicle_id is required")
+	}
+	vehicle, err := s.vehicles.GetVehicle(ctx, strings.TrimSpace(req.VehicleId))
+	if err != nil {
+		return nil, storageStatus(err)
+	}
+	return &lastmilev1.GetVehicleResponse{Vehicle: vehicle}, nil
+}
+
+func (s *Server) UpdateVehicle(ctx context.Context, req *lastmilev1.UpdateVehicleRequest) (*lastmilev1.UpdateVehicleResponse, error) {
+	if req == nil || req.Vehicle == nil {
+		return nil, status.Error(codes.InvalidArgument, "vehicle is required")
+	}
+	vehicleID := strings.TrimSpace(req.Vehicle.VehicleId)
+	if vehicleID == "" {
+		return nil, status.Error(codes.InvalidArgument, "vehicle_id is required")
+	}
+	paths, err := updatePaths(req.UpdateMask)
+	if err != nil {
+		return nil, err
+	}
+
+	vehicle, err := s.vehicles.GetVehicle(ctx, vehicleID)
+	if err != nil {
+		return nil, storageStatus(err)
+	}
+	for _, path := range paths {
+		switch path {
+		case "plate":
+			vehicle.Plate = normalizePlate(req.Vehicle.Plate)
+		case "type":
+			vehicle.Type = req.Vehicle.Type
+		case "seat_capacity":
+			vehicle.SeatCapacity = req.Vehicle.SeatCapacity
+		case "accessibility_features":
+			vehicle.AccessibilityFeatures = dedupeFeatures(req.Vehicle.AccessibilityFeatures)
+		}
+	}
+	if err := validateVehicle(vehicle); err != nil {
+		return nil, err
+	}
+
+	if err := s.vehicles.UpdateVehicle(ctx, vehicle); err != nil {
+		return nil, storageStatus(err)
+	}
+	return &lastmilev1.UpdateVehicleResponse{Vehicle: cloneVehicle(vehicle)}, nil
+}
+
+func (s *Server) DeleteVehicle(ctx context.Context, req *lastmilev1.DeleteVehicleRequest) (*lastmilev1.DeleteVehicleResponse, error) {
+	if req == nil || strings.TrimSpace(req.VehicleId) == "" {
+		return nil, status.Error(codes.InvalidArgument, "vehicle_id is required")
+	}
+	vehicleID := strings.TrimSpace(req.VehicleId)
+
+	_, err := s.drivers.GetDriverByVehicle(ctx, vehicleID)
+	if err == nil {
+		return nil, status.Error(codes.FailedPrecondition, "vehicle is assigned to an active driver")
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return nil, storageStatus(err)
+	}
+	if err := s.vehicles.DeleteVehicle(ctx, vehicleID); err != nil {
+		return nil, storageStatus(err)
+	}
+	return &lastmilev1.DeleteVehicleResponse{}, nil
+}
+
+func (s *Server) ListVehicles(ctx context.Context, req *lastmilev1.ListVehiclesRequest) (*lastmilev1.ListVehiclesResponse, error) {
+	filter := pagetoken.FilterHash("vehicles")
+	after, limit, err := pageParams(req.GetPageSize(), req.GetPageToken(), filter)
+	if err != nil {
+		return nil, err
+	}
+	vehicles, next, err := s.vehicles.ListVehicles(ctx, after, limit)
+	if err != nil {
+		return nil, storageStatus(err)
+	}
+	return &lastmilev1.ListVehiclesResponse{Vehicles: vehicles, NextPageToken: nextPageToken(next, filter)}, nil
+}
+
+func validateVehicle(vehicle *lastmilev1.Vehicle) error {
+	if vehicle.Plate == "" {
+		return status.Error(codes.InvalidArgument, "plate is required")
+	}
+	if _, ok := lastmilev1.VehicleType_name[int32(vehicle.Type)]; !ok || vehicle.Type == lastmilev1.VehicleType_VEHICLE_TYPE_UNSPECIFIED {
+		return status.Error(codes.InvalidArgument, "type is required")
+	}
+	if vehicle.SeatCapacity <= 0 || vehicle.SeatCapacity > maxSeatCapacity {
+		return status.Errorf(codes.InvalidArgument, "seat_capacity must be between 1 and %d", maxSeatCapacity)
+	}
+	for _, feature := range vehicle.AccessibilityFeatures {
+		if _, ok := lastmilev1.AccessibilityFeature_name[int32(feature)]; !ok || feature == lastmilev1.AccessibilityFeature_ACCESSIBILITY_FEATURE_UNSPECIFIED {
+			return status.Error(codes.InvalidArgument, "accessibility_features has an invalid value")
+		}
+	}
+	return nil
+}
+
+func normalizePlate(plate string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(plate)))
+}
+
+func dedupeFeatures(features []lastmilev1.AccessibilityFeature) []lastmilev1.AccessibilityFeature {
+	out := make([]lastmilev1.AccessibilityFeature, 0, len(features))
+	for _, feature := range features {
+		if !slices.Contains(out, feature) {
+			out = append(out, feature)
+		}
+	}
+	return out
+}
+
+var vehicleUpdatableFields = []string{"plate", "type", "seat_capacity", "accessibility_features"}
+
+func updatePaths(mask *fieldmaskpb.FieldMask) ([]string, error) {
+	if len(mask.GetPaths()) == 0 {
+		return vehicleUpdatableFields, nil
+	}
+	for _, path := range mask.GetPaths() {
+		if !slices.Contains(vehicleUpdatableFields, path) {
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q is not supported", path)
+		}
+	}
+	return mask.GetPaths(), nil
+}
+
+// pageParams returns the key to list after and the page size. Tokens are
+// bound to filter, the pagetoken.FilterHash of the request.
+func pageParams(pageSize int32, pageToken, filter string) (string, int, error) {
+	if pageSize < 0 {
+		return "", 0, status.Error(codes.InvalidArgument, "page_size must be positive")
+	}
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	after := ""
+	if pageToken != "" {
+		key, err := pagetoken.Decode(pageToken, filter)
+		if err != nil {
+			return "", 0, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = key
+	}
+	return after, int(pageSize), nil
+}
+
+func nextPageToken(next, filter string) string {
+	if next == "" {
+		return ""
+	}
+	return pagetoken.Encode(next, filter)
+}
+
+func storageStatus(err error) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return status.Error(codes.NotFound, "vehicle not found")
+	}
+	if errors.Is(err, storage.ErrPlateInUse) {
+		return status.Error(codes.AlreadyExists, "plate already registered")
+	}
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return status.Error(codes.AlreadyExists, "vehicle already exists")
+	}
+	if errors.Is(err, storage.ErrInvalidArgument) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, "storage error")
+}
+
+func cloneVehicle(vehicle *lastmilev1.Vehicle) *lastmilev1.Vehicle {
+	if vehicle == nil {
+		return nil
+	}
+	return proto.Clone(vehicle).(*lastmilev1.Vehicle)
+}
+
+func newID(prefix string) string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return prefix + "_" + hex.EncodeToString(buf)
+}
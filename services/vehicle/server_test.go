@@ -0,0 +1,151 @@
+package vehicle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lastmilev1 "github.com/Dheeraj2209/Last_mile_go/gen/go/lastmile/v1"
+	"github.com/Dheeraj2209/Last_mile_go/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestCreateVehicleValidation(t *testing.T) {
+	server := NewServer()
+	cases := []struct {
+		name    string
+		vehicle *lastmilev1.Vehicle
+	}{
+		{name: "nil vehicle"},
+		{name: "missing plate", vehicle: &lastmilev1.Vehicle{Type: lastmilev1.VehicleType_VEHICLE_TYPE_CAB, SeatCapacity: 4}},
+		{name: "missing type", vehicle: &lastmilev1.Vehicle{Plate: "KA01AB1234", SeatCapacity: 4}},
+		{name: "zero capacity", vehicle: &lastmilev1.Vehicle{Plate: "KA01AB1234", Type: lastmilev1.VehicleType_VEHICLE_TYPE_CAB}},
+		{name: "unknown feature", vehicle: &lastmilev1.Vehicle{
+			Plate:                 "KA01AB1234",
+			Type:                  lastmilev1.VehicleType_VEHICLE_TYPE_CAB,
+			SeatCapacity:          4,
+			AccessibilityFeatures: []lastmilev1.AccessibilityFeature{99},
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := server.CreateVehicle(context.Background(), &lastmilev1.CreateVehicleRequest{Vehicle: tc.vehicle})
+			assertStatusCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestCreateVehicleNormalizesAndRejectsDuplicatePlate(t *testing.T) {
+	server := NewServer()
+	ctx := context.Background()
+	resp, err := server.CreateVehicle(ctx, &lastmilev1.CreateVehicleRequest{Vehicle: &lastmilev1.Vehicle{
+		Plate:        " ka-01 ab 1234 ",
+		Type:         lastmilev1.VehicleType_VEHICLE_TYPE_SHUTTLE,
+		SeatCapacity: 12,
+		AccessibilityFeatures: []lastmilev1.AccessibilityFeature{
+			lastmilev1.AccessibilityFeature_ACCESSIBILITY_FEATURE_WHEELCHAIR_RAMP,
+			lastmilev1.AccessibilityFeature_ACCESSIBILITY_FEATURE_WHEELCHAIR_RAMP,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Vehicle.VehicleId == "" {
+		t.Fatalf("expected generated vehicle_id")
+	}
+	if resp.Vehicle.Plate != "KA01AB1234" {
+		t.Fatalf("expected normalized plate, got %q", resp.Vehicle.Plate)
+	}
+	if len(resp.Vehicle.AccessibilityFeatures) != 1 {
+		t.Fatalf("expected deduplicated features, got %v", resp.Vehicle.AccessibilityFeatures)
+	}
+
+	_, err = server.CreateVehicle(ctx, &lastmilev1.CreateVehicleRequest{Vehicle: &lastmilev1.Vehicle{
+		Plate:        "KA01AB1234",
+		Type:         lastmilev1.VehicleType_VEHICLE_TYPE_CAB,
+		SeatCapacity: 4,
+	}})
+	assertStatusCode(t, err, codes.AlreadyExists)
+}
+
+func TestUpdateVehicleFieldMask(t *testing.T) {
+	server := NewServer()
+	ctx := context.Background()
+	if _, err := server.CreateVehicle(ctx, &lastmilev1.CreateVehicleRequest{Vehicle: &lastmilev1.Vehicle{
+		VehicleId:    "v1",
+		Plate:        "KA01AB1234",
+		Type:         lastmilev1.VehicleType_VEHICLE_TYPE_E_RICKSHAW,
+		SeatCapacity: 3,
+	}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := server.UpdateVehicle(ctx, &lastmilev1.UpdateVehicleRequest{
+		Vehicle:    &lastmilev1.Vehicle{VehicleId: "v1", SeatCapacity: 4},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"seat_capacity"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Vehicle.SeatCapacity != 4 || resp.Vehicle.Plate != "KA01AB1234" {
+		t.Fatalf("unexpected vehicle after update: %v", resp.Vehicle)
+	}
+
+	_, err = server.UpdateVehicle(ctx, &lastmilev1.UpdateVehicleRequest{
+		Vehicle:    &lastmilev1.Vehicle{VehicleId: "v1"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"vehicle_id"}},
+	})
+	assertStatusCode(t, err, codes.InvalidArgument)
+
+	_, err = server.UpdateVehicle(ctx, &lastmilev1.UpdateVehicleRequest{
+		Vehicle:    &lastmilev1.Vehicle{VehicleId: "missing", SeatCapacity: 4},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"seat_capacity"}},
+	})
+	assertStatusCode(t, err, codes.NotFound)
+}
+
+func TestDeleteVehicleAssignedToActiveDriver(t *testing.T) {
+	ctx := context.Background()
+	users := storage.NewMemoryUserStore()
+	server := NewServerWithStores(storage.NewMemoryVehicleStore(), users)
+	if _, err := server.CreateVehicle(ctx, &lastmilev1.CreateVehicleRequest{Vehicle: &lastmilev1.Vehicle{
+		VehicleId:    "v1",
+		Plate:        "KA01AB1234",
+		Type:         lastmilev1.VehicleType_VEHICLE_TYPE_CAB,
+		SeatCapacity: 4,
+	}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := users.CreateDriver(ctx, &lastmilev1.DriverProfile{DriverId: "d1", Name: "Dev", VehicleId: "v1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := server.DeleteVehicle(ctx, &lastmilev1.DeleteVehicleRequest{VehicleId: "v1"})
+	assertStatusCode(t, err, codes.FailedPrecondition)
+
+	if err := users.DeleteDriver(ctx, "d1", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := server.DeleteVehicle(ctx, &lastmilev1.DeleteVehicleRequest{VehicleId: "v1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.GetVehicle(ctx, &lastmilev1.GetVehicleRequest{VehicleId: "v1"})
+	assertStatusCode(t, err, codes.NotFound)
+}
+
+func assertStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error with code %s", code.String())
+	}
+	statusErr, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if statusErr.Code() != code {
+		t.Fatalf("expected code %s, got %s", code.String(), statusErr.Code().String())
+	}
+}